@@ -0,0 +1,69 @@
+package oidc
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/cap/oidc/internal/strutils"
+)
+
+// ACRPolicyFunc decides whether the id_token's acr claim is acceptable, given
+// the acr values requested by the Request (see WithACRValues).  The acr is
+// empty when the id_token doesn't have an acr claim.
+type ACRPolicyFunc func(acr string, requested []string) bool
+
+// WithACRVerification optionally verifies that the id_token's acr claim is one
+// of the acr values requested by the oidcRequest (see WithACRValues), and an
+// error wrapping ErrInvalidACR is returned when it's not.  Nothing is verified
+// when the oidcRequest didn't request acr values.  Providers may satisfy a
+// request with an acr which wasn't requested, so the acr isn't verified by
+// default.
+//
+// Valid for: Provider.VerifyIDToken
+func WithACRVerification() Option {
+	return func(o interface{}) {
+		if o, ok := o.(*verifyIDTokenOptions); ok {
+			o.withACRPolicy = requestedACRPolicy
+		}
+	}
+}
+
+// WithACRPolicy optionally verifies the id_token's acr claim using the policy
+// func, which is called even when the oidcRequest didn't request acr values.
+// An error wrapping ErrInvalidACR is returned when the policy rejects the acr.
+// It overrides WithACRVerification.
+//
+// Valid for: Provider.VerifyIDToken
+func WithACRPolicy(policy ACRPolicyFunc) Option {
+	return func(o interface{}) {
+		if policy == nil {
+			return
+		}
+		if o, ok := o.(*verifyIDTokenOptions); ok {
+			o.withACRPolicy = policy
+		}
+	}
+}
+
+// requestedACRPolicy is the ACRPolicyFunc for WithACRVerification, which
+// accepts any acr when none were requested.
+func requestedACRPolicy(acr string, requested []string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+	return strutils.StrListContains(requested, acr)
+}
+
+// verifyACR verifies the acr claim using the policy.  Nothing is verified when
+// the policy is nil.
+func verifyACR(policy ACRPolicyFunc, oidcRequest Request, claims map[string]interface{}) error {
+	const op = "verifyACR"
+	if policy == nil {
+		return nil
+	}
+	acr, _ := claims["acr"].(string)
+	requested := oidcRequest.ACRValues()
+	if !policy(acr, requested) {
+		return fmt.Errorf("%s: acr %q is not acceptable for the requested acr values %q: %w", op, acr, requested, ErrInvalidACR)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_VerifyIDToken_acr(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	priv, _, alg, _ := tp.SigningKeys()
+	redirect := "https://example.com/callback"
+	p := testNewProvider(t, "client-id", "client-secret", redirect, tp)
+
+	silver := func(acr string, _ []string) bool { return acr == "silver" }
+	tests := []struct {
+		name    string
+		acr     interface{}
+		reqOpts []Option
+		opts    []Option
+		wantErr error
+	}{
+		{
+			name:    "not-verified",
+			acr:     "bronze",
+			reqOpts: []Option{WithACRValues("gold", "silver")},
+		},
+		{
+			name:    "requested",
+			acr:     "silver",
+			reqOpts: []Option{WithACRValues("gold", "silver")},
+			opts:    []Option{WithACRVerification()},
+		},
+		{
+			name:    "not-requested",
+			acr:     "bronze",
+			reqOpts: []Option{WithACRValues("gold", "silver")},
+			opts:    []Option{WithACRVerification()},
+			wantErr: ErrInvalidACR,
+		},
+		{
+			name:    "missing",
+			reqOpts: []Option{WithACRValues("gold")},
+			opts:    []Option{WithACRVerification()},
+			wantErr: ErrInvalidACR,
+		},
+		{
+			name: "none-requested",
+			acr:  "bronze",
+			opts: []Option{WithACRVerification()},
+		},
+		{
+			name: "policy",
+			acr:  "silver",
+			opts: []Option{WithACRPolicy(silver)},
+		},
+		{
+			name:    "policy-rejected",
+			acr:     "gold",
+			reqOpts: []Option{WithACRValues("gold")},
+			opts:    []Option{WithACRVerification(), WithACRPolicy(silver)},
+			wantErr: ErrInvalidACR,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			oidcRequest, err := NewRequest(time.Minute, redirect, tt.reqOpts...)
+			require.NoError(err)
+			claims := map[string]interface{}{
+				"iss":   tp.Addr(),
+				"aud":   "client-id",
+				"sub":   "alice@example.com",
+				"nonce": oidcRequest.Nonce(),
+				"iat":   time.Now().Unix(),
+				"exp":   time.Now().Add(time.Minute).Unix(),
+			}
+			if tt.acr != nil {
+				claims["acr"] = tt.acr
+			}
+			idToken := IDToken(TestSignJWT(t, priv, alg, claims, nil))
+			var result VerificationResult
+			got, err := p.VerifyIDToken(ctx, idToken, oidcRequest, append(tt.opts, WithVerificationResult(&result))...)
+			if tt.wantErr != nil {
+				require.Truef(errors.Is(err, tt.wantErr), "wanted \"%s\" but got \"%s\"", tt.wantErr, err)
+				assert.Equal(VerificationCheckACR, result.Failed().Check)
+				assert.Equal("invalid_acr", result.Reason())
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.acr, got["acr"])
+		})
+	}
+}
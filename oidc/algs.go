@@ -1,6 +1,6 @@
 package oidc
 
-// Alg represents asymmetric signing algorithms
+// Alg represents signing algorithms
 type Alg string
 
 const (
@@ -19,6 +19,25 @@ const (
 	EdDSA Alg = "EdDSA"
 )
 
+const (
+	// JOSE HMAC signing algorithm values as defined by RFC 7518, which are
+	// only used to sign client_secret_jwt client assertions (see
+	// Config.ClientSecretJWTAlg) and are never accepted for a provider's JWTs.
+	//
+	// See: https://tools.ietf.org/html/rfc7518#section-3.2
+	HS256 Alg = "HS256" // HMAC using SHA-256
+	HS384 Alg = "HS384" // HMAC using SHA-384
+	HS512 Alg = "HS512" // HMAC using SHA-512
+)
+
+// hmacAlgorithms are the algorithms supported for client_secret_jwt client
+// assertions.
+var hmacAlgorithms = map[Alg]bool{
+	HS256: true,
+	HS384: true,
+	HS512: true,
+}
+
 var supportedAlgorithms = map[Alg]bool{
 	RS256: true,
 	RS384: true,
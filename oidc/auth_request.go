@@ -0,0 +1,159 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AuthRequestContentType is the content type of a POST AuthRequest's Body
+const AuthRequestContentType = "application/x-www-form-urlencoded"
+
+// AuthRequest is an authentication request to send to the provider's
+// authorization endpoint.  It's the structured form of Provider.AuthURL,
+// which can represent requests that aren't a simple redirect to a URL.
+//
+// For a GET request, URL includes the request's parameters and the user's
+// browser is redirected to it (just like the URL returned by
+// Provider.AuthURL).  For a POST request, URL is the authorization endpoint
+// and Body has the form encoded parameters, which the user's browser submits
+// (typically with an auto-submitting HTML form).  See:
+// https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest
+type AuthRequest struct {
+	// URL is the request's URL.
+	URL string
+
+	// Method is the request's http method: http.MethodGet or
+	// http.MethodPost.
+	Method string
+
+	// Body is the request's form encoded body (see AuthRequestContentType),
+	// which is empty for a GET request.
+	Body string
+}
+
+// Params returns the request's parameters, from either its URL's query or
+// its Body.
+func (r *AuthRequest) Params() (url.Values, error) {
+	const op = "AuthRequest.Params"
+	if r.Method == http.MethodPost {
+		v, err := url.ParseQuery(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unable to parse body: %s: %w", op, err, ErrInvalidParameter)
+		}
+		return v, nil
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to parse url: %s: %w", op, err, ErrInvalidParameter)
+	}
+	return u.Query(), nil
+}
+
+// WithAuthRequestMethod provides an optional http method for an AuthRequest,
+// which is either http.MethodGet (the default) or http.MethodPost.
+//
+// Valid for: Provider.AuthRequest
+func WithAuthRequestMethod(method string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*authRequestOptions); ok {
+			o.withMethod = method
+		}
+	}
+}
+
+// AuthRequest will generate an AuthRequest the caller can use to kick off an
+// OIDC authorization code (with optional PKCE) or an implicit flow with an
+// IdP.  It's the same as Provider.AuthURL, except it returns a structured
+// AuthRequest that may use a POST (see WithAuthRequestMethod) and may pass
+// its parameters in a signed and optionally encrypted request object (see
+// WithRequestObject and WithRequestObjectEncryption).
+//
+// Supported options: WithAuthRequestMethod, WithRequestObject,
+// WithRequestObjectEncryption, WithPushedAuthorizationRequest
+func (p *Provider) AuthRequest(ctx context.Context, oidcRequest Request, opt ...Option) (*AuthRequest, error) {
+	const op = "Provider.AuthRequest"
+	opts := getAuthRequestOpts(opt...)
+	switch opts.withMethod {
+	case http.MethodGet, http.MethodPost:
+	default:
+		return nil, fmt.Errorf("%s: unsupported method %q: %w", op, opts.withMethod, ErrInvalidParameter)
+	}
+	if opts.withRequestObjectEncryption && opts.withRequestObjectSigner == nil {
+		return nil, fmt.Errorf("%s: request object encryption requires a request object signer: %w", op, ErrInvalidParameter)
+	}
+	config := p.currentConfig()
+	push := opts.withPushedAuthorizationRequest || config.FAPI
+	authURL, err := p.authURL(ctx, oidcRequest, false)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if opts.withMethod == http.MethodGet && opts.withRequestObjectSigner == nil && !push {
+		return &AuthRequest{URL: authURL, Method: http.MethodGet}, nil
+	}
+	endpoint, params, err := p.authURLParams(ctx, authURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if opts.withRequestObjectSigner != nil {
+		requestObject, err := p.requestObject(ctx, params, opts.withRequestObjectSigner, opts.withRequestObjectEncryption)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		// the required OAuth 2.0 parameters are also sent outside of the
+		// request object.  See:
+		// https://openid.net/specs/openid-connect-core-1_0.html#RequestObject
+		params = url.Values{
+			"client_id":     params["client_id"],
+			"response_type": params["response_type"],
+			"scope":         params["scope"],
+			"request":       {requestObject},
+		}
+	}
+	if push {
+		if params, err = p.pushAuthorizationRequest(ctx, params); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if opts.withMethod == http.MethodGet {
+		return &AuthRequest{URL: authEndpointURL(endpoint, params), Method: http.MethodGet}, nil
+	}
+	return &AuthRequest{URL: endpoint, Method: http.MethodPost, Body: params.Encode()}, nil
+}
+
+// authEndpointURL returns the URL of an authentication request with the
+// params, which are appended to the authorization endpoint's own query
+// parameters.
+func authEndpointURL(endpoint string, params url.Values) string {
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + params.Encode()
+}
+
+// authRequestOptions is the set of available options for the
+// Provider.AuthRequest function
+type authRequestOptions struct {
+	withMethod                  string
+	withRequestObjectSigner     *JWTSigner
+	withRequestObjectEncryption bool
+
+	withPushedAuthorizationRequest bool
+}
+
+// authRequestDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func authRequestDefaults() authRequestOptions {
+	return authRequestOptions{withMethod: http.MethodGet}
+}
+
+// getAuthRequestOpts gets the Provider.AuthRequest defaults and applies the
+// opt overrides passed in
+func getAuthRequestOpts(opt ...Option) authRequestOptions {
+	opts := authRequestDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
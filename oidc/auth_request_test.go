@@ -0,0 +1,91 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_AuthRequest(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	p := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+	oidcRequest, err := NewRequest(time.Minute, redirect)
+	require.NoError(t, err)
+	authURL, err := p.AuthURL(ctx, oidcRequest)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		opt       []Option
+		request   Request
+		want      *AuthRequest
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name:    "default",
+			request: oidcRequest,
+			want:    &AuthRequest{URL: authURL, Method: http.MethodGet},
+		},
+		{
+			name:    "get",
+			opt:     []Option{WithAuthRequestMethod(http.MethodGet)},
+			request: oidcRequest,
+			want:    &AuthRequest{URL: authURL, Method: http.MethodGet},
+		},
+		{
+			name:    "post",
+			opt:     []Option{WithAuthRequestMethod(http.MethodPost)},
+			request: oidcRequest,
+			want: &AuthRequest{
+				URL:    tp.Addr() + "/authorize",
+				Method: http.MethodPost,
+				Body:   authURL[strings.Index(authURL, "?")+1:],
+			},
+		},
+		{
+			name:      "unsupported-method",
+			opt:       []Option{WithAuthRequestMethod(http.MethodPut)},
+			request:   oidcRequest,
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "invalid-request",
+			request:   &Req{},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := p.AuthRequest(ctx, tt.request, tt.opt...)
+			if tt.wantErr {
+				require.Error(err)
+				if tt.wantIsErr != nil {
+					assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				}
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+
+			params, err := got.Params()
+			require.NoError(err)
+			assert.Equal(oidcRequest.State(), params.Get("state"))
+			assert.Equal(oidcRequest.Nonce(), params.Get("nonce"))
+			assert.Equal(clientID, params.Get("client_id"))
+		})
+	}
+}
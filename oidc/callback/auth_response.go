@@ -0,0 +1,164 @@
+package callback
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+const (
+	// maxAuthResponseSize limits the size of an authentication response's
+	// body, which is large enough for an id_token, an access_token and the
+	// response's other parameters.
+	maxAuthResponseSize = 4 * oidc.MaxTokenSize
+
+	// maxAuthResponseParamSize limits the size of the authentication
+	// response's parameters which are not tokens: state, code, error,
+	// error_description and error_uri
+	maxAuthResponseParamSize = 4 * 1024
+)
+
+// authResponse is an authentication response received by a callback.  See:
+// https://openid.net/specs/openid-connect-core-1_0.html#AuthResponse
+type authResponse struct {
+	state       string
+	code        string
+	idToken     string
+	accessToken string
+
+	// iss is the provider's issuer, which is included in responses from
+	// providers that support RFC 9207 (see oidc.Provider.VerifyResponseIssuer)
+	iss string
+
+	// authErr is set when the response is an authentication error response
+	authErr *AuthenErrorResponse
+}
+
+// parseAuthResponse parses the authentication response's parameters using
+// the parser, which by default parses them from either the request's body or
+// query parameters, with body values taking precedence (just like
+// http.Request.FormValue).  The request's body is limited to
+// maxAuthResponseSize, and the parameters must be valid UTF-8 within their
+// size limits.
+//
+// A parameter which appears more than once (including once in the body and
+// once in the query) fails with a *DuplicateParameterError, unless
+// firstDuplicate is set, in which case its first value is used.
+//
+// An authentication error response is detected whether its parameters arrive
+// as query parameters (the code flow's query response mode) or form fields
+// (the form_post response mode used by the implicit flow).  When the parser
+// doesn't return an error parameter, the request's query parameters are
+// checked for an error response, since a provider returns some errors (like an
+// invalid redirect) as query parameters regardless of the requested response
+// mode.  See normalizeErrorParam for how the error's parameters are
+// normalized.
+func parseAuthResponse(w http.ResponseWriter, req *http.Request, parser ResponseParser, firstDuplicate bool) (*authResponse, error) {
+	const op = "callback.parseAuthResponse"
+	if req.Body != nil {
+		req.Body = http.MaxBytesReader(w, req.Body, maxAuthResponseSize)
+	}
+	if parser == nil {
+		parser = formResponseParser
+	}
+	values, err := parser(w, req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	param := func(values url.Values, name string, maxSize int) string {
+		v := values.Get(name)
+		switch {
+		case err != nil:
+		case len(values[name]) > 1 && !firstDuplicate:
+			err = fmt.Errorf("%s: %w", op, &DuplicateParameterError{Name: name})
+		case len(v) > maxSize:
+			err = fmt.Errorf("%s: %s is larger than %d bytes: %w", op, name, maxSize, oidc.ErrInvalidParameter)
+		case !utf8.ValidString(v):
+			err = fmt.Errorf("%s: %s is not valid UTF-8: %w", op, name, oidc.ErrInvalidParameter)
+		}
+		return v
+	}
+	resp := &authResponse{
+		state:       param(values, "state", maxAuthResponseParamSize),
+		code:        param(values, "code", maxAuthResponseParamSize),
+		idToken:     param(values, "id_token", oidc.MaxTokenSize),
+		accessToken: param(values, "access_token", oidc.MaxTokenSize),
+		iss:         param(values, "iss", maxAuthResponseParamSize),
+	}
+	errValues := values
+	if values.Get("error") == "" && req.URL != nil {
+		if query := req.URL.Query(); query.Get("error") != "" {
+			errValues = query
+			if resp.state == "" {
+				resp.state = param(query, "state", maxAuthResponseParamSize)
+			}
+			if resp.iss == "" {
+				resp.iss = param(query, "iss", maxAuthResponseParamSize)
+			}
+		}
+	}
+	if authErr := normalizeErrorParam(param(errValues, "error", maxAuthResponseParamSize)); authErr != "" {
+		resp.authErr = &AuthenErrorResponse{
+			Error:       authErr,
+			Description: normalizeErrorParam(param(errValues, "error_description", maxAuthResponseParamSize)),
+			Uri:         normalizeErrorParam(param(errValues, "error_uri", maxAuthResponseParamSize)),
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// normalizeErrorParam trims the surrounding whitespace of an error response's
+// parameter and replaces its control chars (like the CRLFs some providers
+// include in an error_description) with spaces.
+func normalizeErrorParam(v string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, v))
+}
+
+// DuplicateParameterError is returned when a parameter of an authentication
+// response appears more than once, which may indicate an HTTP parameter
+// pollution attack against the callback (see the OAuth 2.0 Security Best
+// Current Practice).  It wraps oidc.ErrDuplicateParameter.  Use
+// WithFirstDuplicateValue to accept responses from gateways known to
+// duplicate parameters.
+type DuplicateParameterError struct {
+	// Name is the duplicated parameter's name.
+	Name string
+}
+
+// Error satisfies the error interface.
+func (e *DuplicateParameterError) Error() string {
+	return fmt.Sprintf("parameter %q appears more than once: %s", e.Name, e.Unwrap())
+}
+
+// Unwrap returns oidc.ErrDuplicateParameter.
+func (e *DuplicateParameterError) Unwrap() error {
+	return oidc.ErrDuplicateParameter
+}
+
+// WithFirstDuplicateValue provides an optional way to accept authentication
+// responses with duplicate parameters, by using each parameter's first value
+// (the body's value takes precedence over the query's).  By default, a
+// response with duplicate parameters fails with a *DuplicateParameterError.
+// It should only be used for gateways known to duplicate the parameters.
+//
+// Valid for: AuthCode and Implicit
+func WithFirstDuplicateValue() oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*callbackOptions); ok {
+			o.withFirstDuplicateValue = true
+		}
+	}
+}
@@ -0,0 +1,47 @@
+//go:build go1.18
+// +build go1.18
+
+package callback
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+func FuzzParseAuthResponse(f *testing.F) {
+	f.Add("state=s&code=c", "")
+	f.Add("state=s", "id_token=i&access_token=a")
+	f.Add("error=access_denied&error_description=%ff", "")
+	f.Add("", "state=%zz&code")
+	f.Fuzz(func(t *testing.T, query, body string) {
+		req := &http.Request{
+			Method: http.MethodPost,
+			URL:    &url.URL{Path: "/callback", RawQuery: query},
+			Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			Body:   ioutil.NopCloser(strings.NewReader(body)),
+		}
+		got, err := parseAuthResponse(httptest.NewRecorder(), req, nil, false)
+		if err != nil {
+			return
+		}
+		params := []string{got.state, got.code, got.idToken, got.accessToken}
+		if got.authErr != nil {
+			params = append(params, got.authErr.Error, got.authErr.Description, got.authErr.Uri)
+		}
+		for _, p := range params {
+			if !utf8.ValidString(p) {
+				t.Errorf("invalid UTF-8 param accepted: %q", p)
+			}
+			if len(p) > oidc.MaxTokenSize {
+				t.Errorf("param larger than %d bytes accepted", oidc.MaxTokenSize)
+			}
+		}
+	})
+}
@@ -0,0 +1,193 @@
+package callback
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseAuthResponse(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		query     url.Values
+		body      string
+		parser    ResponseParser
+		first     bool
+		want      *authResponse
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name:  "query",
+			query: url.Values{"state": {"s"}, "code": {"c"}},
+			want:  &authResponse{state: "s", code: "c"},
+		},
+		{
+			name:  "issuer",
+			query: url.Values{"state": {"s"}, "code": {"c"}, "iss": {"https://example.com"}},
+			want:  &authResponse{state: "s", code: "c", iss: "https://example.com"},
+		},
+		{
+			name:   "json-parser-query-error-response-issuer",
+			query:  url.Values{"state": {"s"}, "error": {"access_denied"}, "iss": {"https://example.com"}},
+			body:   `{}`,
+			parser: JSONResponseParser,
+			want:   &authResponse{state: "s", iss: "https://example.com", authErr: &AuthenErrorResponse{Error: "access_denied"}},
+		},
+		{
+			name:  "body-takes-precedence",
+			query: url.Values{"state": {"query-state"}},
+			body:  url.Values{"state": {"s"}, "id_token": {"i"}, "access_token": {"a"}}.Encode(),
+			first: true,
+			want:  &authResponse{state: "s", idToken: "i", accessToken: "a"},
+		},
+		{
+			name:      "duplicate-state",
+			query:     url.Values{"state": {"s", "attacker-state"}, "code": {"c"}},
+			wantErr:   true,
+			wantIsErr: oidc.ErrDuplicateParameter,
+		},
+		{
+			name:      "duplicate-code-body-and-query",
+			query:     url.Values{"code": {"attacker-code"}},
+			body:      url.Values{"state": {"s"}, "code": {"c"}}.Encode(),
+			wantErr:   true,
+			wantIsErr: oidc.ErrDuplicateParameter,
+		},
+		{
+			name:      "duplicate-error",
+			query:     url.Values{"state": {"s"}, "error": {"access_denied", "login_required"}},
+			wantErr:   true,
+			wantIsErr: oidc.ErrDuplicateParameter,
+		},
+		{
+			name:  "duplicate-first-value",
+			query: url.Values{"state": {"s", "other-state"}, "code": {"c", "other-code"}},
+			first: true,
+			want:  &authResponse{state: "s", code: "c"},
+		},
+		{
+			name:  "error-response",
+			query: url.Values{"state": {"s"}, "error": {"access_denied"}, "error_description": {"d"}, "error_uri": {"u"}},
+			want:  &authResponse{state: "s", authErr: &AuthenErrorResponse{Error: "access_denied", Description: "d", Uri: "u"}},
+		},
+		{
+			name: "form-post-error-response",
+			body: url.Values{"state": {"s"}, "error": {"login_required"}, "error_description": {"d"}, "error_uri": {"https://example.com/error"}}.Encode(),
+			want: &authResponse{state: "s", authErr: &AuthenErrorResponse{Error: "login_required", Description: "d", Uri: "https://example.com/error"}},
+		},
+		{
+			name:  "normalized-error-response",
+			query: url.Values{"state": {"s"}, "error": {" invalid_request\r\n"}, "error_description": {"AADSTS50011: invalid redirect.\r\nTrace ID: t\r\n"}},
+			want:  &authResponse{state: "s", authErr: &AuthenErrorResponse{Error: "invalid_request", Description: "AADSTS50011: invalid redirect.  Trace ID: t"}},
+		},
+		{
+			name:   "json-parser-query-error-response",
+			query:  url.Values{"state": {"s"}, "error": {"access_denied"}, "error_description": {"d"}},
+			body:   `{"code":"c"}`,
+			parser: JSONResponseParser,
+			want:   &authResponse{state: "s", code: "c", authErr: &AuthenErrorResponse{Error: "access_denied", Description: "d"}},
+		},
+		{
+			name:   "json-parser-body-error-response",
+			query:  url.Values{"error": {"query-error"}},
+			body:   `{"state":"s","error":"access_denied"}`,
+			parser: JSONResponseParser,
+			want:   &authResponse{state: "s", authErr: &AuthenErrorResponse{Error: "access_denied"}},
+		},
+		{
+			name:      "json-parser-query-error-too-large",
+			query:     url.Values{"error": {"access_denied"}, "error_description": {strings.Repeat("d", maxAuthResponseParamSize+1)}},
+			body:      `{"state":"s"}`,
+			parser:    JSONResponseParser,
+			wantErr:   true,
+			wantIsErr: oidc.ErrInvalidParameter,
+		},
+		{
+			name:      "state-too-large",
+			query:     url.Values{"state": {strings.Repeat("s", maxAuthResponseParamSize+1)}},
+			wantErr:   true,
+			wantIsErr: oidc.ErrInvalidParameter,
+		},
+		{
+			name:      "id-token-too-large",
+			body:      url.Values{"id_token": {strings.Repeat("i", oidc.MaxTokenSize+1)}}.Encode(),
+			wantErr:   true,
+			wantIsErr: oidc.ErrInvalidParameter,
+		},
+		{
+			name:      "body-too-large",
+			body:      "state=" + strings.Repeat("s", maxAuthResponseSize),
+			wantErr:   true,
+			wantIsErr: oidc.ErrInvalidParameter,
+		},
+		{
+			name:      "invalid-utf8",
+			query:     url.Values{"error": {"access_denied"}, "error_description": {"\xff\xfe"}},
+			wantErr:   true,
+			wantIsErr: oidc.ErrInvalidParameter,
+		},
+		{
+			name:      "invalid-form",
+			body:      "state=%zz",
+			wantErr:   true,
+			wantIsErr: oidc.ErrInvalidParameter,
+		},
+		{
+			name:   "json-parser",
+			query:  url.Values{"state": {"query-state"}},
+			body:   `{"state":"s","code":"c"}`,
+			parser: JSONResponseParser,
+			want:   &authResponse{state: "s", code: "c"},
+		},
+		{
+			name:      "json-parser-state-too-large",
+			body:      `{"state":"` + strings.Repeat("s", maxAuthResponseParamSize+1) + `"}`,
+			parser:    JSONResponseParser,
+			wantErr:   true,
+			wantIsErr: oidc.ErrInvalidParameter,
+		},
+		{
+			name:      "json-parser-body-too-large",
+			body:      `{"state":"` + strings.Repeat("s", maxAuthResponseSize) + `"}`,
+			parser:    JSONResponseParser,
+			wantErr:   true,
+			wantIsErr: oidc.ErrInvalidParameter,
+		},
+		{
+			name:      "json-parser-invalid-json",
+			body:      `{"state":1}`,
+			parser:    JSONResponseParser,
+			wantErr:   true,
+			wantIsErr: oidc.ErrInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			req := httptest.NewRequest(http.MethodPost, "/callback?"+tt.query.Encode(), strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			got, err := parseAuthResponse(httptest.NewRecorder(), req, tt.parser, tt.first)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				if errors.Is(err, oidc.ErrDuplicateParameter) {
+					var dupErr *DuplicateParameterError
+					require.True(errors.As(err, &dupErr))
+					assert.NotEmpty(dupErr.Name)
+				}
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+		})
+	}
+}
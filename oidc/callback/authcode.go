@@ -18,7 +18,26 @@ import (
 // successful.
 //
 // The ErrorResponseFunc is to create a response when the callback fails.
-func AuthCode(ctx context.Context, p *oidc.Provider, rw RequestReader, sFn SuccessResponseFunc, eFn ErrorResponseFunc) (http.HandlerFunc, error) {
+//
+// When the RequestReader implements the PhaseTracker interface (like the
+// MemoryRequestStore), duplicate and out-of-order responses fail with a
+// PhaseError.
+//
+// Every response's iss parameter is verified using
+// oidc.Provider.VerifyResponseIssuer, and requests bound to a provider (see
+// oidc.Provider.NewRequest) must be completed by the same provider using the
+// request's redirect URL, to protect against mix-up attacks.  A request
+// completed by another provider fails with an error wrapping an
+// *oidc.ProviderMismatchError.
+//
+// A response with a duplicate parameter (like two state parameters) fails
+// with an error wrapping a *DuplicateParameterError, unless the
+// WithFirstDuplicateValue option is used.
+//
+// Supported options: WithResponseParser, WithRedirectURLVerification,
+// WithReturnToAllowList, WithProviderErrorRetry, WithFingerprintVerification,
+// WithFirstDuplicateValue
+func AuthCode(ctx context.Context, p *oidc.Provider, rw RequestReader, sFn SuccessResponseFunc, eFn ErrorResponseFunc, opt ...oidc.Option) (http.HandlerFunc, error) {
 	const op = "callback.AuthCode"
 	if p == nil {
 		return nil, fmt.Errorf("%s: provider is empty: %w", op, oidc.ErrInvalidParameter)
@@ -32,27 +51,39 @@ func AuthCode(ctx context.Context, p *oidc.Provider, rw RequestReader, sFn Succe
 	if eFn == nil {
 		return nil, fmt.Errorf("%s: error response func is empty: %w", op, oidc.ErrInvalidParameter)
 	}
+	opts := getCallbackOpts(opt...)
+	sFn, eFn = withMetrics(p, "authcode", sFn, eFn)
 	return func(w http.ResponseWriter, req *http.Request) {
 		const op = "callback.AuthCode"
 
-		reqState := req.FormValue("state")
-
-		if err := req.FormValue("error"); err != "" {
-			// get parameters from either the body or query parameters.
-			// FormValue prioritizes body values, if found
-			reqError := &AuthenErrorResponse{
-				Error:       err,
-				Description: req.FormValue("error_description"),
-				Uri:         req.FormValue("error_uri"),
+		authResp, err := parseAuthResponse(w, req, opts.withResponseParser, opts.withFirstDuplicateValue)
+		if err != nil {
+			// the response's state can't be trusted, so it's not passed to
+			// the error response func
+			responseErr := fmt.Errorf("%s: unable to parse authentication response: %w", op, err)
+			eFn("", nil, responseErr, w, req)
+			return
+		}
+		reqState := authResp.state
+		if err := p.VerifyResponseIssuer(ctx, authResp.iss); err != nil {
+			// the response may be from another provider (a mix-up attack),
+			// so it's neither retried nor completed
+			responseErr := fmt.Errorf("%s: invalid response issuer: %w", op, err)
+			eFn(reqState, authResp.authErr, responseErr, w, req)
+			return
+		}
+		if authResp.authErr != nil {
+			retried, err := retryAuth(ctx, p, rw, opts, authResp, w, req)
+			switch {
+			case err != nil:
+				responseErr := fmt.Errorf("%s: unable to retry authentication: %w", op, err)
+				eFn(reqState, authResp.authErr, responseErr, w, req)
+			case !retried:
+				eFn(reqState, authResp.authErr, nil, w, req)
 			}
-			eFn(reqState, reqError, nil, w, req)
 			return
 		}
 
-		// get parameters from either the body or query parameters.
-		// FormValue prioritizes body values, if found.
-		reqCode := req.FormValue("code")
-
 		oidcRequest, err := rw.Read(ctx, reqState)
 		if err != nil {
 			responseErr := fmt.Errorf("%s: unable to read auth code request: %w", op, err)
@@ -80,18 +111,53 @@ func AuthCode(ctx context.Context, p *oidc.Provider, rw RequestReader, sFn Succe
 			eFn(reqState, nil, responseErr, w, req)
 			return
 		}
+		if err := verifyProviderBinding(p, req, oidcRequest); err != nil {
+			responseErr := fmt.Errorf("%s: response was not received for the request's provider: %w", op, err)
+			eFn(reqState, nil, responseErr, w, req)
+			return
+		}
+		if err := verifyFingerprint(opts, req, oidcRequest); err != nil {
+			responseErr := fmt.Errorf("%s: response was not received from the request's user agent: %w", op, err)
+			eFn(reqState, nil, responseErr, w, req)
+			return
+		}
+		if opts.withRedirectURLVerification {
+			if err := verifyRedirectURL(req, oidcRequest.RedirectURL()); err != nil {
+				responseErr := fmt.Errorf("%s: response was not received using the request's redirect URL: %w", op, err)
+				eFn(reqState, nil, responseErr, w, req)
+				return
+			}
+		}
+		returnToReq, err := withReturnTo(opts, req, oidcRequest)
+		if err != nil {
+			responseErr := fmt.Errorf("%s: invalid return-to URL: %w", op, err)
+			eFn(reqState, nil, responseErr, w, req)
+			return
+		}
+		req = returnToReq
 		if useImplicit, _ := oidcRequest.ImplicitFlow(); useImplicit {
 			responseErr := fmt.Errorf("%s: state (%s) should not be using the authorization code flow: %w", op, oidcRequest.State(), oidc.ErrInvalidFlow)
 			eFn(reqState, nil, responseErr, w, req)
 			return
 		}
 
-		responseToken, err := p.Exchange(ctx, oidcRequest, reqState, reqCode)
+		if err := transitionPhase(ctx, rw, reqState, PhaseIssued, PhaseCallbackReceived); err != nil {
+			responseErr := fmt.Errorf("%s: unable to receive authentication response: %w", op, err)
+			eFn(reqState, nil, responseErr, w, req)
+			return
+		}
+
+		responseToken, err := p.Exchange(ctx, oidcRequest, reqState, authResp.code)
 		if err != nil {
 			responseErr := fmt.Errorf("%s: unable to exchange authorization code: %w", op, err)
 			eFn(reqState, nil, responseErr, w, req)
 			return
 		}
+		if err := transitionPhase(ctx, rw, reqState, PhaseCallbackReceived, PhaseExchanged); err != nil {
+			responseErr := fmt.Errorf("%s: unable to complete authentication: %w", op, err)
+			eFn(reqState, nil, responseErr, w, req)
+			return
+		}
 		sFn(reqState, responseToken, w, req)
 	}, nil
 }
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
@@ -183,3 +184,70 @@ func Test_AuthCodeResponses(t *testing.T) {
 		})
 	}
 }
+
+func Test_AuthCodeResponseIssuer(t *testing.T) {
+	ctx := context.Background()
+	tp := oidc.StartTestProvider(t)
+	tp.SetExpectedAuthCode("valid-code")
+	redirect := "https://alice.com/callback"
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	p := testNewProvider(t, "test-client-id", "test-client-secret", redirect, tp)
+
+	s, err := NewMemoryRequestStore()
+	require.NoError(t, err)
+	defer s.Close()
+	h, err := AuthCode(ctx, p, s, testSuccessFn, testFailFn)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		iss            string
+		wantStatusCode int
+	}{
+		{name: "mix-up", iss: "https://attacker.example.com", wantStatusCode: http.StatusInternalServerError},
+		{name: "valid", iss: tp.Addr(), wantStatusCode: http.StatusOK},
+		{name: "missing", wantStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			oidcRequest, err := oidc.NewRequest(time.Minute, redirect)
+			require.NoError(err)
+			require.NoError(s.Write(ctx, oidcRequest))
+			tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+
+			q := url.Values{"state": {oidcRequest.State()}, "code": {"valid-code"}}
+			if tt.iss != "" {
+				q.Set("iss", tt.iss)
+			}
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest(http.MethodGet, redirect+"?"+q.Encode(), nil))
+			require.Equal(tt.wantStatusCode, w.Code, w.Body.String())
+			if tt.wantStatusCode != http.StatusOK {
+				assert.Contains(w.Body.String(), oidc.ErrInvalidIssuer.Error())
+			}
+		})
+	}
+
+	t.Run("advertised-missing", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := oidc.StartTestProvider(t)
+		tp.SetExpectedAuthCode("valid-code")
+		tp.SetAllowedRedirectURIs([]string{redirect})
+		tp.SetResponseIssuer(true)
+		p := testNewProvider(t, "test-client-id", "test-client-secret", redirect, tp)
+		h, err := AuthCode(ctx, p, s, testSuccessFn, testFailFn)
+		require.NoError(err)
+
+		oidcRequest, err := oidc.NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		require.NoError(s.Write(ctx, oidcRequest))
+		tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+
+		q := url.Values{"state": {oidcRequest.State()}, "code": {"valid-code"}}
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, redirect+"?"+q.Encode(), nil))
+		require.Equal(http.StatusInternalServerError, w.Code, w.Body.String())
+		assert.Contains(w.Body.String(), oidc.ErrInvalidIssuer.Error())
+	})
+}
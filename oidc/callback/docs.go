@@ -2,5 +2,9 @@
 callback is a package that provides callbacks (in the form of http.HandlerFunc)
 for handling OIDC provider responses to authorization code flow (with optional
 PKCE) and implicit flow authentication attempts.
+
+SuccessPage and ErrorPage provide built-in success and error pages, which are
+translated using the request's Accept-Language header (see NegotiateLanguage
+and WithPageTranslations).
 */
 package callback
@@ -0,0 +1,44 @@
+package callback
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// WithFingerprintVerification provides an optional verification that the
+// callback's request was sent by the user agent which started the
+// oidc.Request's authentication flow (see oidc.WithFingerprint), with the
+// given strictness.  The options are passed to oidc.Fingerprint.Verify(...)
+// (see oidc.WithClientIPHeader) and must match the ones used to capture the
+// fingerprint.  A request without a fingerprint fails the callback, so every
+// request read by the callback must have one.  A mismatch fails the callback
+// with an error wrapping oidc.ErrFingerprintMismatch.
+//
+// Valid for: AuthCode and Implicit
+func WithFingerprintVerification(s oidc.FingerprintStrictness, opt ...oidc.Option) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*callbackOptions); ok {
+			o.withFingerprintStrictness = s
+			o.withFingerprintOptions = opt
+		}
+	}
+}
+
+// verifyFingerprint verifies the callback's request with the oidc.Request's
+// fingerprint, when the WithFingerprintVerification option is used.
+func verifyFingerprint(opts callbackOptions, req *http.Request, oidcRequest oidc.Request) error {
+	const op = "callback.verifyFingerprint"
+	if opts.withFingerprintStrictness == 0 {
+		return nil
+	}
+	fp := oidcRequest.Fingerprint()
+	if fp == nil {
+		return fmt.Errorf("%s: request doesn't have a fingerprint: %w", op, oidc.ErrFingerprintMismatch)
+	}
+	if err := fp.Verify(req, opts.withFingerprintStrictness, opts.withFingerprintOptions...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package callback
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FingerprintVerification(t *testing.T) {
+	ctx := context.Background()
+	clientID := "test-client-id"
+	clientSecret := "test-client-secret"
+	tp := oidc.StartTestProvider(t)
+	tp.SetExpectedAuthCode("valid-code")
+	callbackSrv := httptest.NewTLSServer(nil)
+	defer callbackSrv.Close()
+
+	redirect := callbackSrv.URL
+	tp.SetAllowedRedirectURIs([]string{redirect, redirect})
+	p := testNewProvider(t, clientID, clientSecret, redirect, tp)
+
+	// the fingerprint of the test provider's http client
+	agentReq := httptest.NewRequest(http.MethodGet, redirect, nil)
+	agentReq.RemoteAddr = "127.0.0.1:1234"
+	agentReq.Header.Set("User-Agent", "Go-http-client/1.1")
+	agentFingerprint, err := oidc.NewFingerprint(agentReq)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name                string
+		fingerprint         *oidc.Fingerprint
+		strictness          oidc.FingerprintStrictness
+		wantStatusCode      int
+		wantRespDescription string
+	}{
+		{name: "strict", fingerprint: agentFingerprint, strictness: oidc.FingerprintStrict, wantStatusCode: http.StatusOK},
+		{name: "network", fingerprint: &oidc.Fingerprint{IP: "127.0.0.2", UserAgentHash: agentFingerprint.UserAgentHash}, strictness: oidc.FingerprintNetwork, wantStatusCode: http.StatusOK},
+		{
+			name:                "different-ip",
+			fingerprint:         &oidc.Fingerprint{IP: "192.0.2.1", UserAgentHash: agentFingerprint.UserAgentHash},
+			strictness:          oidc.FingerprintStrict,
+			wantStatusCode:      http.StatusInternalServerError,
+			wantRespDescription: oidc.ErrFingerprintMismatch.Error(),
+		},
+		{
+			name:                "different-agent",
+			fingerprint:         &oidc.Fingerprint{IP: "127.0.0.1", UserAgentHash: "other-agent"},
+			strictness:          oidc.FingerprintUserAgent,
+			wantStatusCode:      http.StatusInternalServerError,
+			wantRespDescription: oidc.ErrFingerprintMismatch.Error(),
+		},
+		{
+			name:                "missing-fingerprint",
+			strictness:          oidc.FingerprintUserAgent,
+			wantStatusCode:      http.StatusInternalServerError,
+			wantRespDescription: "request doesn't have a fingerprint",
+		},
+		{name: "not-verified", fingerprint: &oidc.Fingerprint{IP: "192.0.2.1", UserAgentHash: "other-agent"}, wantStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			oidcRequest, err := oidc.NewRequest(time.Minute, redirect, oidc.WithFingerprint(tt.fingerprint))
+			require.NoError(err)
+			tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+
+			var opts []oidc.Option
+			if tt.strictness != 0 {
+				opts = append(opts, WithFingerprintVerification(tt.strictness))
+			}
+			callbackSrv.Config.Handler, err = AuthCode(ctx, p, &SingleRequestReader{oidcRequest}, testSuccessFn, testFailFn, opts...)
+			require.NoError(err)
+
+			authURL, err := p.AuthURL(ctx, oidcRequest)
+			require.NoError(err)
+			resp, err := tp.HTTPClient().Get(authURL)
+			require.NoError(err)
+			defer resp.Body.Close()
+			contents, err := ioutil.ReadAll(resp.Body)
+			require.NoError(err)
+
+			assert.Equal(tt.wantStatusCode, resp.StatusCode)
+			if tt.wantRespDescription != "" {
+				var errResp AuthenErrorResponse
+				require.NoError(json.Unmarshal(contents, &errResp))
+				assert.Contains(errResp.Description, tt.wantRespDescription)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package callback
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// DefaultPageLanguage is the default language of the built-in success and
+// error pages, which is used when none of the request's Accept-Language
+// languages have a translation.
+const DefaultPageLanguage = "en"
+
+// PageText is the text of the built-in success and error pages in a language.
+type PageText struct {
+	SuccessTitle   string
+	SuccessMessage string
+	ErrorTitle     string
+	ErrorMessage   string
+}
+
+// PageData is the data used to execute the template of a success or error
+// page (see WithPageTemplate).
+type PageData struct {
+	// Lang is the language tag of the page's text.
+	Lang string
+
+	// Title is the page's title.
+	Title string
+
+	// Message is the page's message.
+	Message string
+
+	// Success is true for the success page, and false for the error page.
+	Success bool
+}
+
+// defaultPageTmpl is the template of the built-in success and error pages.
+var defaultPageTmpl = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head><meta charset="UTF-8"><title>{{.Title}}</title></head>
+<body><p>{{.Message}}</p></body>
+</html>`))
+
+// defaultPageTranslations are the built-in translations of the pages' text,
+// keyed by their lowercase language tag.
+var defaultPageTranslations = map[string]PageText{
+	"de": {
+		SuccessTitle:   "Anmeldung erfolgreich",
+		SuccessMessage: "Sie haben sich über Ihren OIDC-Anbieter angemeldet. Sie können dieses Fenster jetzt schließen.",
+		ErrorTitle:     "Anmeldung fehlgeschlagen",
+		ErrorMessage:   "Die Anmeldung über Ihren OIDC-Anbieter ist fehlgeschlagen. Bitte schließen Sie dieses Fenster und versuchen Sie es erneut.",
+	},
+	"en": {
+		SuccessTitle:   "Authentication Succeeded",
+		SuccessMessage: "Signed in via your OIDC provider. You can now close this window.",
+		ErrorTitle:     "Authentication Failed",
+		ErrorMessage:   "Unable to sign in via your OIDC provider. Please close this window and try again.",
+	},
+	"es": {
+		SuccessTitle:   "Autenticación correcta",
+		SuccessMessage: "Ha iniciado sesión a través de su proveedor OIDC. Ya puede cerrar esta ventana.",
+		ErrorTitle:     "Error de autenticación",
+		ErrorMessage:   "No se pudo iniciar sesión a través de su proveedor OIDC. Cierre esta ventana e inténtelo de nuevo.",
+	},
+	"fr": {
+		SuccessTitle:   "Authentification réussie",
+		SuccessMessage: "Vous êtes connecté via votre fournisseur OIDC. Vous pouvez maintenant fermer cette fenêtre.",
+		ErrorTitle:     "Échec de l'authentification",
+		ErrorMessage:   "Impossible de se connecter via votre fournisseur OIDC. Veuillez fermer cette fenêtre et réessayer.",
+	},
+	"ja": {
+		SuccessTitle:   "認証に成功しました",
+		SuccessMessage: "OIDCプロバイダーでサインインしました。このウィンドウを閉じてください。",
+		ErrorTitle:     "認証に失敗しました",
+		ErrorMessage:   "OIDCプロバイダーでサインインできませんでした。このウィンドウを閉じて、もう一度お試しください。",
+	},
+	"pt": {
+		SuccessTitle:   "Autenticação bem-sucedida",
+		SuccessMessage: "Você entrou por meio do seu provedor OIDC. Já pode fechar esta janela.",
+		ErrorTitle:     "Falha na autenticação",
+		ErrorMessage:   "Não foi possível entrar por meio do seu provedor OIDC. Feche esta janela e tente novamente.",
+	},
+}
+
+// DefaultPageTranslations returns a copy of the built-in translations of the
+// success and error pages, keyed by their lowercase language tag.
+func DefaultPageTranslations() map[string]PageText {
+	translations := make(map[string]PageText, len(defaultPageTranslations))
+	for lang, text := range defaultPageTranslations {
+		translations[lang] = text
+	}
+	return translations
+}
+
+// SuccessPage returns a SuccessResponseFunc which writes the built-in success
+// page, in the language negotiated using the request's Accept-Language header.
+//
+// Supported options: WithPageTranslations, WithPageLanguage, WithPageTemplate
+func SuccessPage(opt ...oidc.Option) SuccessResponseFunc {
+	opts := getPageOpts(opt...)
+	return func(_ string, _ oidc.Token, w http.ResponseWriter, req *http.Request) {
+		opts.write(w, req, http.StatusOK, true)
+	}
+}
+
+// ErrorPage returns an ErrorResponseFunc which writes the built-in error page
+// with a 401 status, in the language negotiated using the request's
+// Accept-Language header.  The page doesn't include the error, which should
+// be logged by the app instead.
+//
+// Supported options: WithPageTranslations, WithPageLanguage, WithPageTemplate
+func ErrorPage(opt ...oidc.Option) ErrorResponseFunc {
+	opts := getPageOpts(opt...)
+	return func(_ string, _ *AuthenErrorResponse, _ error, w http.ResponseWriter, req *http.Request) {
+		opts.write(w, req, http.StatusUnauthorized, false)
+	}
+}
+
+// write writes the success or error page with the status.
+func (opts pageOptions) write(w http.ResponseWriter, req *http.Request, status int, success bool) {
+	available := make([]string, 0, len(opts.withTranslations))
+	for lang := range opts.withTranslations {
+		available = append(available, lang)
+	}
+	sort.Strings(available)
+	lang := NegotiateLanguage(req.Header.Get("Accept-Language"), available, opts.withLanguage)
+	text := opts.withTranslations[lang]
+	data := PageData{Lang: lang, Title: text.ErrorTitle, Message: text.ErrorMessage, Success: success}
+	if success {
+		data.Title, data.Message = text.SuccessTitle, text.SuccessMessage
+	}
+	var body bytes.Buffer
+	if err := opts.withTemplate.Execute(&body, data); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Content-Language", lang)
+	h.Set("Cache-Control", "no-store")
+	h.Add("Vary", "Accept-Language")
+	w.WriteHeader(status)
+	_, _ = w.Write(body.Bytes())
+}
+
+// NegotiateLanguage returns the available language which best matches the
+// languages of an Accept-Language header, in the order of their quality
+// values.  A language matches an available language with the same tag, or
+// with the same primary language (for example: "de-CH" matches "de" and "pt"
+// matches "pt-BR").  Tags are compared case-insensitively.  The fallback is
+// returned when there isn't a match.
+//
+// See: https://www.rfc-editor.org/rfc/rfc9110.html#name-accept-language
+func NegotiateLanguage(acceptLanguage string, available []string, fallback string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+				q = v
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		langs = append(langs, weighted{tag: tag, q: q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	for _, l := range langs {
+		if l.tag == "*" {
+			return fallback
+		}
+		for _, a := range available {
+			if strings.ToLower(a) == l.tag {
+				return a
+			}
+		}
+		primary := primaryLanguage(l.tag)
+		for _, a := range available {
+			if primaryLanguage(strings.ToLower(a)) == primary {
+				return a
+			}
+		}
+	}
+	return fallback
+}
+
+// primaryLanguage returns the primary language subtag of the tag.
+func primaryLanguage(tag string) string {
+	if i := strings.Index(tag, "-"); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// pageOptions is the set of available options for SuccessPage and ErrorPage
+type pageOptions struct {
+	withTranslations map[string]PageText
+	withLanguage     string
+	withTemplate     *template.Template
+}
+
+// pageDefaults is a handy way to get the defaults at runtime and during unit
+// tests.
+func pageDefaults() pageOptions {
+	return pageOptions{
+		withTranslations: DefaultPageTranslations(),
+		withLanguage:     DefaultPageLanguage,
+		withTemplate:     defaultPageTmpl,
+	}
+}
+
+// getPageOpts gets the page defaults and applies the opt overrides passed in
+func getPageOpts(opt ...oidc.Option) pageOptions {
+	opts := pageDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	if _, ok := opts.withTranslations[opts.withLanguage]; !ok {
+		opts.withLanguage = DefaultPageLanguage
+	}
+	return opts
+}
+
+// WithPageTranslations provides optional translations of the success and
+// error pages' text, keyed by language tag (for example: "nl" or "pt-BR").
+// They're added to the built-in translations (see DefaultPageTranslations),
+// replacing a built-in translation with the same tag.
+//
+// Valid for: SuccessPage and ErrorPage
+func WithPageTranslations(translations map[string]PageText) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*pageOptions); ok {
+			for lang, text := range translations {
+				o.withTranslations[strings.ToLower(lang)] = text
+			}
+		}
+	}
+}
+
+// WithPageLanguage provides an optional language tag for the success and
+// error pages, which is used when none of the request's Accept-Language
+// languages have a translation.  The default is DefaultPageLanguage, which is
+// also used when the language doesn't have a translation.
+//
+// Valid for: SuccessPage and ErrorPage
+func WithPageLanguage(lang string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*pageOptions); ok && lang != "" {
+			o.withLanguage = strings.ToLower(lang)
+		}
+	}
+}
+
+// WithPageTemplate provides an optional template for the success and error
+// pages, which is executed with a PageData.  The translations are still used
+// for the PageData's Title and Message.
+//
+// Valid for: SuccessPage and ErrorPage
+func WithPageTemplate(t *template.Template) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*pageOptions); ok && t != nil {
+			o.withTemplate = t
+		}
+	}
+}
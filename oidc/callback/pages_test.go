@@ -0,0 +1,142 @@
+package callback
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	t.Parallel()
+	available := []string{"de", "en", "pt-BR"}
+	tests := []struct {
+		name           string
+		acceptLanguage string
+		want           string
+	}{
+		{name: "empty", acceptLanguage: "", want: "en"},
+		{name: "exact", acceptLanguage: "de", want: "de"},
+		{name: "case-insensitive", acceptLanguage: "PT-br", want: "pt-BR"},
+		{name: "region", acceptLanguage: "de-CH", want: "de"},
+		{name: "primary", acceptLanguage: "pt", want: "pt-BR"},
+		{name: "quality", acceptLanguage: "en;q=0.5, de;q=0.9", want: "de"},
+		{name: "order", acceptLanguage: "fr, de, en", want: "de"},
+		{name: "excluded", acceptLanguage: "de;q=0, pt", want: "pt-BR"},
+		{name: "wildcard", acceptLanguage: "fr, *;q=0.5, de;q=0.1", want: "en"},
+		{name: "no-match", acceptLanguage: "fr, ja", want: "en"},
+		{name: "malformed", acceptLanguage: ",;q=x, de;q=abc", want: "de"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, NegotiateLanguage(tt.acceptLanguage, available, "en"))
+		})
+	}
+}
+
+func TestPages(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		opts           []oidc.Option
+		success        bool
+		acceptLanguage string
+		wantStatus     int
+		wantLang       string
+		wantBody       string
+	}{
+		{
+			name:       "success-default",
+			success:    true,
+			wantStatus: http.StatusOK,
+			wantLang:   "en",
+			wantBody:   "You can now close this window.",
+		},
+		{
+			name:       "error-default",
+			wantStatus: http.StatusUnauthorized,
+			wantLang:   "en",
+			wantBody:   "Authentication Failed",
+		},
+		{
+			name:           "success-negotiated",
+			success:        true,
+			acceptLanguage: "fr-CA,fr;q=0.9",
+			wantStatus:     http.StatusOK,
+			wantLang:       "fr",
+			wantBody:       "Vous pouvez maintenant fermer cette fenêtre.",
+		},
+		{
+			name:           "error-negotiated",
+			acceptLanguage: "ja",
+			wantStatus:     http.StatusUnauthorized,
+			wantLang:       "ja",
+			wantBody:       "認証に失敗しました",
+		},
+		{
+			name:           "custom-translation",
+			opts:           []oidc.Option{WithPageTranslations(map[string]PageText{"NL": {SuccessTitle: "Aangemeld", SuccessMessage: "U kunt dit venster sluiten."}})},
+			success:        true,
+			acceptLanguage: "nl-BE",
+			wantStatus:     http.StatusOK,
+			wantLang:       "nl",
+			wantBody:       "U kunt dit venster sluiten.",
+		},
+		{
+			name:           "default-language",
+			opts:           []oidc.Option{WithPageLanguage("DE")},
+			success:        true,
+			acceptLanguage: "it",
+			wantStatus:     http.StatusOK,
+			wantLang:       "de",
+			wantBody:       "Anmeldung erfolgreich",
+		},
+		{
+			name:       "untranslated-default-language",
+			opts:       []oidc.Option{WithPageLanguage("it")},
+			wantStatus: http.StatusUnauthorized,
+			wantLang:   "en",
+			wantBody:   "Authentication Failed",
+		},
+		{
+			name:           "template",
+			opts:           []oidc.Option{WithPageTemplate(template.Must(template.New("t").Parse(`{{.Lang}}:{{.Success}}:{{.Title}}`)))},
+			success:        true,
+			acceptLanguage: "es",
+			wantStatus:     http.StatusOK,
+			wantLang:       "es",
+			wantBody:       "es:true:Autenticación correcta",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			req := httptest.NewRequest(http.MethodGet, "/callback", nil)
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			w := httptest.NewRecorder()
+			if tt.success {
+				SuccessPage(tt.opts...)("state", nil, w, req)
+			} else {
+				ErrorPage(tt.opts...)("state", &AuthenErrorResponse{Error: "access_denied"}, nil, w, req)
+			}
+			assert.Equal(tt.wantStatus, w.Code)
+			assert.Equal(tt.wantLang, w.Header().Get("Content-Language"))
+			assert.Equal("Accept-Language", w.Header().Get("Vary"))
+			assert.Equal("text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Contains(w.Body.String(), tt.wantBody)
+			assert.NotContains(w.Body.String(), "access_denied")
+		})
+	}
+	t.Run("translations-are-copied", func(t *testing.T) {
+		translations := DefaultPageTranslations()
+		translations["en"] = PageText{}
+		assert.NotEmpty(t, DefaultPageTranslations()["en"].SuccessTitle)
+	})
+}
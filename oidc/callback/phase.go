@@ -0,0 +1,118 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// FlowPhase is the phase of an authentication flow, which only moves forward:
+// PhaseIssued → PhaseCallbackReceived → PhaseExchanged.
+type FlowPhase int
+
+const (
+	// PhaseUnknown is the phase of a flow which isn't tracked.
+	PhaseUnknown FlowPhase = iota
+
+	// PhaseIssued is the phase of a flow whose request was written, and whose
+	// authentication response hasn't been received.
+	PhaseIssued
+
+	// PhaseCallbackReceived is the phase of a flow whose authentication
+	// response was received by a callback, which is completing the flow.
+	PhaseCallbackReceived
+
+	// PhaseExchanged is the phase of a completed flow, whose tokens were
+	// received and verified.
+	PhaseExchanged
+)
+
+// String returns the phase's name.
+func (p FlowPhase) String() string {
+	switch p {
+	case PhaseIssued:
+		return "issued"
+	case PhaseCallbackReceived:
+		return "callback-received"
+	case PhaseExchanged:
+		return "exchanged"
+	default:
+		return "unknown"
+	}
+}
+
+// PhaseTracker defines an optional interface for a RequestReader which tracks
+// the phase of each request's flow.  When a callback's RequestReader
+// implements it, the callback transitions the flow's phase before completing
+// it, so a duplicate callback (like when a user double-clicks or refreshes
+// the callback page) or an out-of-order callback fails with a PhaseError
+// instead of exchanging the same authorization code twice.
+//
+// Implementations must be concurrently safe, and Transition must be atomic.
+type PhaseTracker interface {
+	// Transition the phase of the request's flow from the phase to the next
+	// phase.  A PhaseError is returned when the flow isn't in the from phase,
+	// and an error wrapping oidc.ErrNotFound when there isn't a request for
+	// the state.
+	Transition(ctx context.Context, state string, from, to FlowPhase) error
+}
+
+// ensure that MemoryRequestStore implements the PhaseTracker interface.
+var _ PhaseTracker = (*MemoryRequestStore)(nil)
+
+// PhaseError is returned when a flow's phase can't be transitioned, because
+// the flow isn't in the expected phase.  It wraps oidc.ErrDuplicateCallback
+// when the flow has already reached the next phase (or a later one), and
+// oidc.ErrOutOfOrderCallback otherwise.  Use errors.As to get a PhaseError
+// from a callback's error.
+type PhaseError struct {
+	// State is the flow's state.
+	State string
+
+	// Current is the flow's current phase.
+	Current FlowPhase
+
+	// From is the phase the flow was expected to be in.
+	From FlowPhase
+
+	// To is the phase the flow was transitioning to.
+	To FlowPhase
+}
+
+// Error satisfies the error interface.
+func (e *PhaseError) Error() string {
+	return fmt.Sprintf("flow for state %q is %s and can't transition from %s to %s: %s", e.State, e.Current, e.From, e.To, e.Unwrap())
+}
+
+// Unwrap returns oidc.ErrDuplicateCallback or oidc.ErrOutOfOrderCallback.
+func (e *PhaseError) Unwrap() error {
+	if e.Current >= e.To {
+		return oidc.ErrDuplicateCallback
+	}
+	return oidc.ErrOutOfOrderCallback
+}
+
+// validTransition returns an error when the transition isn't to the phase
+// which follows the from phase.
+func validTransition(from, to FlowPhase) error {
+	const op = "callback.validTransition"
+	if from < PhaseIssued || to != from+1 || to > PhaseExchanged {
+		return fmt.Errorf("%s: %s to %s is not a valid transition: %w", op, from, to, oidc.ErrInvalidParameter)
+	}
+	return nil
+}
+
+// transitionPhase transitions the phase of the request's flow, when the
+// RequestReader implements the PhaseTracker interface.
+func transitionPhase(ctx context.Context, rr RequestReader, state string, from, to FlowPhase) error {
+	const op = "callback.transitionPhase"
+	pt, ok := rr.(PhaseTracker)
+	if !ok {
+		return nil
+	}
+	if err := pt.Transition(ctx, state, from, to); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlowPhase_String(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	assert.Equal("unknown", PhaseUnknown.String())
+	assert.Equal("issued", PhaseIssued.String())
+	assert.Equal("callback-received", PhaseCallbackReceived.String())
+	assert.Equal("exchanged", PhaseExchanged.String())
+	assert.Equal("unknown", FlowPhase(42).String())
+}
+
+func TestPhaseError(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	var err error = &PhaseError{State: "st", Current: PhaseExchanged, From: PhaseIssued, To: PhaseCallbackReceived}
+	assert.Truef(errors.Is(err, oidc.ErrDuplicateCallback), "wanted \"%s\" but got \"%s\"", oidc.ErrDuplicateCallback, err)
+	assert.Equal(`flow for state "st" is exchanged and can't transition from issued to callback-received: duplicate callback`, err.Error())
+
+	err = &PhaseError{State: "st", Current: PhaseIssued, From: PhaseCallbackReceived, To: PhaseExchanged}
+	assert.Truef(errors.Is(err, oidc.ErrOutOfOrderCallback), "wanted \"%s\" but got \"%s\"", oidc.ErrOutOfOrderCallback, err)
+}
+
+func TestMemoryRequestStore_Transition(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	s, err := NewMemoryRequestStore()
+	require.NoError(err)
+	defer s.Close()
+	r, err := oidc.NewRequest(time.Minute, "https://alice.com/callback")
+	require.NoError(err)
+	require.NoError(s.Write(ctx, r))
+
+	phase, err := s.Phase(ctx, r.State())
+	require.NoError(err)
+	assert.Equal(PhaseIssued, phase)
+
+	// out-of-order
+	err = s.Transition(ctx, r.State(), PhaseCallbackReceived, PhaseExchanged)
+	var phaseErr *PhaseError
+	require.True(errors.As(err, &phaseErr))
+	assert.Equal(PhaseIssued, phaseErr.Current)
+	assert.Truef(errors.Is(err, oidc.ErrOutOfOrderCallback), "wanted \"%s\" but got \"%s\"", oidc.ErrOutOfOrderCallback, err)
+
+	require.NoError(s.Transition(ctx, r.State(), PhaseIssued, PhaseCallbackReceived))
+	// duplicate
+	err = s.Transition(ctx, r.State(), PhaseIssued, PhaseCallbackReceived)
+	assert.Truef(errors.Is(err, oidc.ErrDuplicateCallback), "wanted \"%s\" but got \"%s\"", oidc.ErrDuplicateCallback, err)
+
+	require.NoError(s.Transition(ctx, r.State(), PhaseCallbackReceived, PhaseExchanged))
+	phase, err = s.Phase(ctx, r.State())
+	require.NoError(err)
+	assert.Equal(PhaseExchanged, phase)
+
+	// rewriting a request restarts its flow
+	require.NoError(s.Write(ctx, r))
+	phase, err = s.Phase(ctx, r.State())
+	require.NoError(err)
+	assert.Equal(PhaseIssued, phase)
+
+	err = s.Transition(ctx, r.State(), PhaseIssued, PhaseExchanged)
+	assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+	err = s.Transition(ctx, "unknown", PhaseIssued, PhaseCallbackReceived)
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+	_, err = s.Phase(ctx, "unknown")
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+}
+
+func Test_DuplicateCallback(t *testing.T) {
+	ctx := context.Background()
+	tp := oidc.StartTestProvider(t)
+	tp.SetExpectedAuthCode("valid-code")
+	redirect := "https://alice.com/callback"
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	p := testNewProvider(t, "test-client-id", "test-client-secret", redirect, tp)
+
+	s, err := NewMemoryRequestStore()
+	require.NoError(t, err)
+	defer s.Close()
+	h, err := AuthCode(ctx, p, s, testSuccessFn, testFailFn)
+	require.NoError(t, err)
+
+	assert, require := assert.New(t), require.New(t)
+	oidcRequest, err := oidc.NewRequest(time.Minute, redirect)
+	require.NoError(err)
+	require.NoError(s.Write(ctx, oidcRequest))
+	tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+
+	callback := func() *httptest.ResponseRecorder {
+		q := url.Values{"state": {oidcRequest.State()}, "code": {"valid-code"}}
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, redirect+"?"+q.Encode(), nil))
+		return w
+	}
+	w := callback()
+	require.Equal(http.StatusOK, w.Code, w.Body.String())
+	phase, err := s.Phase(ctx, oidcRequest.State())
+	require.NoError(err)
+	assert.Equal(PhaseExchanged, phase)
+
+	// the user refreshed the callback page
+	w = callback()
+	assert.Equal(http.StatusInternalServerError, w.Code)
+	assert.Contains(w.Body.String(), oidc.ErrDuplicateCallback.Error())
+}
@@ -0,0 +1,30 @@
+package callback
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// verifyProviderBinding verifies that a request bound to a provider (see
+// oidc.WithProviderBinding) is completed by the callback's provider, and that
+// the callback's request was received using the request's redirect URL.
+func verifyProviderBinding(p *oidc.Provider, req *http.Request, oidcRequest oidc.Request) error {
+	const op = "callback.verifyProviderBinding"
+	if oidcRequest.ProviderIssuer() == "" {
+		return nil
+	}
+	if err := p.VerifyProviderBinding(oidcRequest); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := verifyRedirectURL(req, oidcRequest.RedirectURL()); err != nil {
+		return fmt.Errorf("%s: %s: %w", op, err, &oidc.ProviderMismatchError{
+			State:          oidcRequest.State(),
+			RequestIssuer:  oidcRequest.ProviderIssuer(),
+			ProviderIssuer: p.Config().Issuer,
+			RedirectURL:    req.Host + req.URL.Path,
+		})
+	}
+	return nil
+}
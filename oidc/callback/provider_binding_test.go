@@ -0,0 +1,88 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthCode_providerBinding(t *testing.T) {
+	ctx := context.Background()
+	redirect := "https://app.example.com/callback"
+
+	// two providers share the app's callback
+	tpA := oidc.StartTestProvider(t)
+	tpA.SetExpectedAuthCode("code-a")
+	tpA.SetAllowedRedirectURIs([]string{redirect})
+	pA := testNewProvider(t, "client-a", "secret-a", redirect, tpA)
+	tpB := oidc.StartTestProvider(t)
+	tpB.SetExpectedAuthCode("code-b")
+	tpB.SetAllowedRedirectURIs([]string{redirect})
+	pB := testNewProvider(t, "client-b", "secret-b", redirect, tpB)
+
+	s, err := NewMemoryRequestStore()
+	require.NoError(t, err)
+	defer s.Close()
+
+	var gotErr error
+	eFn := func(_ string, _ *AuthenErrorResponse, e error, w http.ResponseWriter, _ *http.Request) {
+		gotErr = e
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	sFn := func(_ string, _ oidc.Token, w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	hA, err := AuthCode(ctx, pA, s, sFn, eFn)
+	require.NoError(t, err)
+	hB, err := AuthCode(ctx, pB, s, sFn, eFn)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		h               http.HandlerFunc
+		tp              *oidc.TestProvider
+		code            string
+		target          string
+		wantIsErr       error
+		wantRedirectURL string
+	}{
+		{name: "valid", h: hA, tp: tpA, code: "code-a", target: redirect},
+		{name: "wrong-provider", h: hB, tp: tpA, code: "code-b", target: redirect, wantIsErr: oidc.ErrProviderMismatch},
+		{name: "wrong-redirect", h: hA, tp: tpA, code: "code-a", target: "https://other.example.com/callback", wantIsErr: oidc.ErrProviderMismatch, wantRedirectURL: "other.example.com/callback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			gotErr = nil
+			oidcRequest, err := pA.NewRequest(time.Minute, redirect)
+			require.NoError(err)
+			require.NoError(s.Write(ctx, oidcRequest))
+			tt.tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+
+			q := url.Values{"state": {oidcRequest.State()}, "code": {tt.code}}
+			w := httptest.NewRecorder()
+			tt.h(w, httptest.NewRequest(http.MethodGet, tt.target+"?"+q.Encode(), nil))
+			if tt.wantIsErr == nil {
+				require.NoError(gotErr)
+				assert.Equal(http.StatusOK, w.Code)
+				return
+			}
+			assert.Equal(http.StatusUnauthorized, w.Code)
+			require.Error(gotErr)
+			assert.Truef(errors.Is(gotErr, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, gotErr)
+			var mismatch *oidc.ProviderMismatchError
+			require.True(errors.As(gotErr, &mismatch))
+			assert.Equal(oidcRequest.State(), mismatch.State)
+			assert.Equal(tpA.Addr(), mismatch.RequestIssuer)
+			assert.Equal(tt.wantRedirectURL, mismatch.RedirectURL)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package callback
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// WithRedirectURLVerification provides an optional verification that the
+// provider's response was received using the oidc.Request's RedirectURL(),
+// which ensures that a flow started for one of a provider's redirect URLs
+// (see oidc.Provider.NewRequest) is completed using the same one.  The host
+// and path of the callback's request are compared with the redirect URL's.
+// When the callback is behind a proxy, the proxy must preserve the request's
+// Host header.
+//
+// Valid for: AuthCode and Implicit
+func WithRedirectURLVerification() oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*callbackOptions); ok {
+			o.withRedirectURLVerification = true
+		}
+	}
+}
+
+// verifyRedirectURL verifies that the callback's request was received using
+// the redirectURL.
+func verifyRedirectURL(req *http.Request, redirectURL string) error {
+	const op = "callback.verifyRedirectURL"
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return fmt.Errorf("%s: redirect URL %s is an invalid URL %s: %w", op, redirectURL, err.Error(), oidc.ErrInvalidParameter)
+	}
+	if !oidc.RedirectHostsEqual(u.Host, req.Host) {
+		return fmt.Errorf("%s: response host %s is not the redirect URL's host: %w", op, req.Host, oidc.ErrUnauthorizedRedirectURI)
+	}
+	if cleanPath(u.Path) != cleanPath(req.URL.Path) {
+		return fmt.Errorf("%s: response path %s is not the redirect URL's path: %w", op, req.URL.Path, oidc.ErrUnauthorizedRedirectURI)
+	}
+	return nil
+}
+
+// cleanPath returns the path, using "/" for an empty path.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return p
+}
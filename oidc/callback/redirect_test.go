@@ -0,0 +1,82 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_verifyRedirectURL(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		redirectURL string
+		target      string
+		wantErr     bool
+		wantIsErr   error
+	}{
+		{"valid", "https://app.example.com/callback", "https://app.example.com/callback", false, nil},
+		{"valid-host-case", "https://APP.example.com/callback", "https://app.example.com/callback", false, nil},
+		{"valid-empty-path", "https://app.example.com", "https://app.example.com/", false, nil},
+		{"valid-loopback-port", "http://127.0.0.1:8080/callback", "http://127.0.0.1:9999/callback", false, nil},
+		{"different-host", "https://app.example.com/callback", "https://other.example.com/callback", true, oidc.ErrUnauthorizedRedirectURI},
+		{"different-port", "https://app.example.com:8443/callback", "https://app.example.com/callback", true, oidc.ErrUnauthorizedRedirectURI},
+		{"different-path", "https://app.example.com/callback", "https://app.example.com/other", true, oidc.ErrUnauthorizedRedirectURI},
+		{"invalid-redirect-url", "https://app.example.com/%zz", "https://app.example.com/callback", true, oidc.ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			err := verifyRedirectURL(httptest.NewRequest(http.MethodGet, tt.target, nil), tt.redirectURL)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+		})
+	}
+}
+
+func TestAuthCode_WithRedirectURLVerification(t *testing.T) {
+	ctx := context.Background()
+	tp := oidc.StartTestProvider(t)
+	redirect := "https://app.example.com/callback"
+	p := testNewProvider(t, "test-client-id", "test-client-secret", redirect, tp)
+	oidcRequest, err := oidc.NewRequest(time.Minute, redirect)
+	require.NoError(t, err)
+
+	var gotErr error
+	eFn := func(_ string, _ *AuthenErrorResponse, e error, w http.ResponseWriter, _ *http.Request) {
+		gotErr = e
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	sFn := func(_ string, _ oidc.Token, w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	h, err := AuthCode(ctx, p, &SingleRequestReader{Request: oidcRequest}, sFn, eFn, WithRedirectURLVerification())
+	require.NoError(t, err)
+
+	assert, require := assert.New(t), require.New(t)
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest(http.MethodGet, "https://other.example.com/callback?code=code&state="+oidcRequest.State(), nil))
+	assert.Equal(http.StatusUnauthorized, w.Code)
+	require.Error(gotErr)
+	assert.Truef(errors.Is(gotErr, oidc.ErrUnauthorizedRedirectURI), "wanted \"%s\" but got \"%s\"", oidc.ErrUnauthorizedRedirectURI, gotErr)
+}
+
+func Test_WithRedirectURLVerification(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	opts := getCallbackOpts(WithRedirectURLVerification())
+	testOpts := callbackDefaults()
+	testOpts.withRedirectURLVerification = true
+	assert.Equal(opts.withRedirectURLVerification, testOpts.withRedirectURLVerification)
+}
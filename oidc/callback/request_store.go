@@ -0,0 +1,289 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// DefaultRequestStoreGCInterval is the default interval between a
+// MemoryRequestStore's garbage collections of expired requests.
+const DefaultRequestStoreGCInterval = time.Minute
+
+// expirationWindow is the window used for RequestStoreStats.ExpirationsPerMinute
+const expirationWindow = time.Minute
+
+// MemoryRequestStore implements the RequestReader interface using an in-memory
+// map of in-flight requests keyed by their State().  It implements the
+// PhaseTracker interface, so callbacks reject duplicate and out-of-order
+// responses for its requests.  Expired requests (which
+// are usually abandoned authentication flows) are removed by a periodic
+// garbage collection, and the store's Stats() can be inspected (or emitted via
+// the WithRequestStoreStatsHook option after every collection) to detect
+// abandoned-flow buildup and tune request timeouts.
+//
+// It is concurrently safe.  Close() must be called to stop its garbage
+// collection.
+type MemoryRequestStore struct {
+	mu       sync.Mutex
+	requests map[string]*requestStoreEntry
+
+	// expirations are when requests expired during the last
+	// expirationWindow, and expirationCount is the total number of expired
+	// requests removed by the store.
+	expirations     []time.Time
+	expirationCount uint64
+
+	statsHook func(RequestStoreStats)
+	nowFunc   func() time.Time
+
+	stop      chan struct{}
+	stopOnce  sync.Once
+	collector sync.WaitGroup
+}
+
+// requestStoreEntry is a stored request along with when it was written and
+// the phase of its flow.
+type requestStoreEntry struct {
+	request oidc.Request
+	written time.Time
+	phase   FlowPhase
+}
+
+// ensure that MemoryRequestStore implements the RequestReader interface.
+var _ RequestReader = (*MemoryRequestStore)(nil)
+
+// RequestStoreStats are the metrics collected by a MemoryRequestStore.
+type RequestStoreStats struct {
+	// InFlight is the number of requests currently stored.
+	InFlight int
+
+	// OldestAge is the age of the oldest stored request, which is zero when
+	// the store is empty.
+	OldestAge time.Duration
+
+	// Expirations is the total number of expired requests removed by the
+	// store.
+	Expirations uint64
+
+	// ExpirationsPerMinute is the number of expired requests removed by the
+	// store during the last minute.
+	ExpirationsPerMinute int
+}
+
+// NewMemoryRequestStore creates a new MemoryRequestStore and starts its
+// garbage collection of expired requests.
+//
+// Supported options: WithRequestStoreGCInterval, WithRequestStoreStatsHook
+func NewMemoryRequestStore(opt ...oidc.Option) (*MemoryRequestStore, error) {
+	const op = "callback.NewMemoryRequestStore"
+	opts := getRequestStoreOpts(opt...)
+	if opts.withGCInterval <= 0 {
+		return nil, fmt.Errorf("%s: gc interval must be greater than zero: %w", op, oidc.ErrInvalidParameter)
+	}
+	s := &MemoryRequestStore{
+		requests:  map[string]*requestStoreEntry{},
+		statsHook: opts.withStatsHook,
+		nowFunc:   time.Now,
+		stop:      make(chan struct{}),
+	}
+	s.collector.Add(1)
+	go func() {
+		defer s.collector.Done()
+		ticker := time.NewTicker(opts.withGCInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.GC()
+			}
+		}
+	}()
+	return s, nil
+}
+
+// Read implements the RequestReader.Read() interface function.  If a request
+// is not found for the state, then an error wrapping oidc.ErrNotFound is
+// returned.
+func (s *MemoryRequestStore) Read(_ context.Context, state string) (oidc.Request, error) {
+	const op = "MemoryRequestStore.Read"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.requests[state]
+	if !ok {
+		return nil, fmt.Errorf("%s: request for state %q: %w", op, state, oidc.ErrNotFound)
+	}
+	return e.request, nil
+}
+
+// Write a request, keyed by its State(), replacing any existing request for
+// the same state.  The request's flow is in the PhaseIssued phase.
+func (s *MemoryRequestStore) Write(_ context.Context, oidcRequest oidc.Request) error {
+	const op = "MemoryRequestStore.Write"
+	if oidcRequest == nil {
+		return fmt.Errorf("%s: request is nil: %w", op, oidc.ErrNilParameter)
+	}
+	if oidcRequest.State() == "" {
+		return fmt.Errorf("%s: request state is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[oidcRequest.State()] = &requestStoreEntry{
+		request: oidcRequest,
+		written: s.nowFunc(),
+		phase:   PhaseIssued,
+	}
+	return nil
+}
+
+// Phase returns the phase of the request's flow.  If a request is not found
+// for the state, then an error wrapping oidc.ErrNotFound is returned.
+func (s *MemoryRequestStore) Phase(_ context.Context, state string) (FlowPhase, error) {
+	const op = "MemoryRequestStore.Phase"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.requests[state]
+	if !ok {
+		return PhaseUnknown, fmt.Errorf("%s: request for state %q: %w", op, state, oidc.ErrNotFound)
+	}
+	return e.phase, nil
+}
+
+// Transition implements the PhaseTracker.Transition() interface function.
+func (s *MemoryRequestStore) Transition(_ context.Context, state string, from, to FlowPhase) error {
+	const op = "MemoryRequestStore.Transition"
+	if err := validTransition(from, to); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.requests[state]
+	if !ok {
+		return fmt.Errorf("%s: request for state %q: %w", op, state, oidc.ErrNotFound)
+	}
+	if e.phase != from {
+		return fmt.Errorf("%s: %w", op, &PhaseError{State: state, Current: e.phase, From: from, To: to})
+	}
+	e.phase = to
+	return nil
+}
+
+// Delete the request for the state, which should be done once its flow is
+// completed.  It's not an error to delete a state that doesn't exist.
+func (s *MemoryRequestStore) Delete(_ context.Context, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.requests, state)
+	return nil
+}
+
+// GC removes the expired requests and then calls the optional stats hook
+// with the store's Stats().  It's called periodically by the store, but can
+// be called at any time.
+func (s *MemoryRequestStore) GC() {
+	s.mu.Lock()
+	now := s.nowFunc()
+	for state, e := range s.requests {
+		if e.request.IsExpired() {
+			delete(s.requests, state)
+			s.expirations = append(s.expirations, now)
+			s.expirationCount++
+		}
+	}
+	stats := s.statsLocked(now)
+	s.mu.Unlock()
+
+	if s.statsHook != nil {
+		s.statsHook(stats)
+	}
+}
+
+// Stats returns the store's current metrics.
+func (s *MemoryRequestStore) Stats() RequestStoreStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statsLocked(s.nowFunc())
+}
+
+// statsLocked returns the store's metrics and prunes the expirations which
+// are outside of the expirationWindow.  The caller must hold s.mu.
+func (s *MemoryRequestStore) statsLocked(now time.Time) RequestStoreStats {
+	cutoff := now.Add(-expirationWindow)
+	pruned := 0
+	for pruned < len(s.expirations) && !s.expirations[pruned].After(cutoff) {
+		pruned++
+	}
+	s.expirations = s.expirations[pruned:]
+
+	stats := RequestStoreStats{
+		InFlight:             len(s.requests),
+		Expirations:          s.expirationCount,
+		ExpirationsPerMinute: len(s.expirations),
+	}
+	for _, e := range s.requests {
+		if age := now.Sub(e.written); age > stats.OldestAge {
+			stats.OldestAge = age
+		}
+	}
+	return stats
+}
+
+// Close stops the store's garbage collection and waits for it to return.  The
+// store's requests can still be read, written and deleted.  It's safe to call
+// Close more than once.
+func (s *MemoryRequestStore) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.collector.Wait()
+}
+
+// requestStoreOptions is the set of available options for the
+// MemoryRequestStore
+type requestStoreOptions struct {
+	withGCInterval time.Duration
+	withStatsHook  func(RequestStoreStats)
+}
+
+// requestStoreDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func requestStoreDefaults() requestStoreOptions {
+	return requestStoreOptions{withGCInterval: DefaultRequestStoreGCInterval}
+}
+
+// getRequestStoreOpts gets the MemoryRequestStore defaults and applies the opt
+// overrides passed in
+func getRequestStoreOpts(opt ...oidc.Option) requestStoreOptions {
+	opts := requestStoreDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithRequestStoreGCInterval provides an optional interval between the
+// store's garbage collections of expired requests.  The default is
+// DefaultRequestStoreGCInterval.
+//
+// Valid for: MemoryRequestStore
+func WithRequestStoreGCInterval(d time.Duration) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*requestStoreOptions); ok {
+			o.withGCInterval = d
+		}
+	}
+}
+
+// WithRequestStoreStatsHook provides an optional hook which is called with
+// the store's stats after every garbage collection, which allows them to be
+// emitted as metrics.  The hook is called without holding the store's lock.
+//
+// Valid for: MemoryRequestStore
+func WithRequestStoreStatsHook(hook func(RequestStoreStats)) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*requestStoreOptions); ok {
+			o.withStatsHook = hook
+		}
+	}
+}
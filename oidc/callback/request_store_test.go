@@ -0,0 +1,146 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMemoryRequestStore(t *testing.T) {
+	t.Parallel()
+	t.Run("valid", func(t *testing.T) {
+		require := require.New(t)
+		s, err := NewMemoryRequestStore()
+		require.NoError(err)
+		s.Close()
+		// it's safe to call Close more than once
+		s.Close()
+	})
+	t.Run("invalid-gc-interval", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := NewMemoryRequestStore(WithRequestStoreGCInterval(0))
+		require.Error(err)
+		assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+	})
+}
+
+func TestMemoryRequestStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	assert, require := assert.New(t), require.New(t)
+	s, err := NewMemoryRequestStore()
+	require.NoError(err)
+	defer s.Close()
+
+	r := newTestRequest()
+	require.NoError(s.Write(ctx, r))
+	got, err := s.Read(ctx, r.State())
+	require.NoError(err)
+	assert.Equal(r, got)
+
+	_, err = s.Read(ctx, "not-found")
+	require.Error(err)
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+	err = s.Write(ctx, nil)
+	require.Error(err)
+	assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+
+	require.NoError(s.Delete(ctx, r.State()))
+	require.NoError(s.Delete(ctx, r.State()))
+	_, err = s.Read(ctx, r.State())
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+}
+
+func TestMemoryRequestStore_GC(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	assert, require := assert.New(t), require.New(t)
+
+	var mu sync.Mutex
+	var hooked []RequestStoreStats
+	s, err := NewMemoryRequestStore(WithRequestStoreStatsHook(func(stats RequestStoreStats) {
+		mu.Lock()
+		defer mu.Unlock()
+		hooked = append(hooked, stats)
+	}))
+	require.NoError(err)
+	defer s.Close()
+	now := time.Now()
+	s.nowFunc = func() time.Time { return now }
+
+	active := newTestRequest()
+	require.NoError(s.Write(ctx, active))
+	for i := 0; i < 2; i++ {
+		expired, err := oidc.NewRequest(time.Nanosecond, "http://whatever.com")
+		require.NoError(err)
+		require.NoError(s.Write(ctx, expired))
+	}
+	now = now.Add(10 * time.Second)
+	assert.Equal(RequestStoreStats{InFlight: 3, OldestAge: 10 * time.Second}, s.Stats())
+
+	s.GC()
+	want := RequestStoreStats{
+		InFlight:             1,
+		OldestAge:            10 * time.Second,
+		Expirations:          2,
+		ExpirationsPerMinute: 2,
+	}
+	assert.Equal(want, s.Stats())
+	mu.Lock()
+	assert.Equal([]RequestStoreStats{want}, hooked)
+	mu.Unlock()
+
+	// expirations outside of the last minute are no longer counted per minute
+	now = now.Add(2 * time.Minute)
+	assert.Equal(RequestStoreStats{
+		InFlight:    1,
+		OldestAge:   2*time.Minute + 10*time.Second,
+		Expirations: 2,
+	}, s.Stats())
+
+	_, err = s.Read(ctx, active.State())
+	require.NoError(err)
+}
+
+func TestMemoryRequestStore_periodicGC(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	require := require.New(t)
+	collected := make(chan RequestStoreStats, 1)
+	s, err := NewMemoryRequestStore(
+		WithRequestStoreGCInterval(10*time.Millisecond),
+		WithRequestStoreStatsHook(func(stats RequestStoreStats) {
+			select {
+			case collected <- stats:
+			default:
+			}
+		}),
+	)
+	require.NoError(err)
+	defer s.Close()
+	expired, err := oidc.NewRequest(time.Nanosecond, "http://whatever.com")
+	require.NoError(err)
+	require.NoError(s.Write(ctx, expired))
+	require.Eventually(func() bool { return s.Stats().Expirations == 1 }, 5*time.Second, 10*time.Millisecond)
+	select {
+	case <-collected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stats hook was not called")
+	}
+}
+
+func Test_getRequestStoreOpts(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	opts := getRequestStoreOpts(WithRequestStoreGCInterval(time.Second))
+	testOpts := requestStoreDefaults()
+	testOpts.withGCInterval = time.Second
+	assert.Equal(opts, testOpts)
+}
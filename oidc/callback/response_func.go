@@ -41,3 +41,16 @@ type AuthenErrorResponse struct {
 	Description string
 	Uri         string
 }
+
+// withMetrics wraps the response funcs so every callback handled is reported
+// to the provider's oidc.MetricsSink for the flow.
+func withMetrics(p *oidc.Provider, flow string, sFn SuccessResponseFunc, eFn ErrorResponseFunc) (SuccessResponseFunc, ErrorResponseFunc) {
+	issuer := p.Config().Issuer
+	return func(state string, t oidc.Token, w http.ResponseWriter, req *http.Request) {
+			p.Metrics().IncCallback(issuer, flow, true)
+			sFn(state, t, w, req)
+		}, func(state string, r *AuthenErrorResponse, e error, w http.ResponseWriter, req *http.Request) {
+			p.Metrics().IncCallback(issuer, flow, false)
+			eFn(state, r, e, w, req)
+		}
+}
@@ -0,0 +1,60 @@
+package callback
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_withMetrics(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	tp := oidc.StartTestProvider(t)
+	sink := &testCallbackSink{}
+	p, err := oidc.NewProvider(testNewConfig(t, "client-id", "client-secret", "https://redirect", tp), oidc.WithMetricsSink(sink))
+	require.NoError(err)
+	defer p.Done()
+
+	var succeeded, failed bool
+	sFn, eFn := withMetrics(p, "authcode",
+		func(string, oidc.Token, http.ResponseWriter, *http.Request) { succeeded = true },
+		func(string, *AuthenErrorResponse, error, http.ResponseWriter, *http.Request) { failed = true },
+	)
+	req := httptest.NewRequest("GET", "/callback", nil)
+	sFn("state", nil, httptest.NewRecorder(), req)
+	eFn("state", nil, nil, httptest.NewRecorder(), req)
+	eFn("state", nil, nil, httptest.NewRecorder(), req)
+	assert.True(succeeded)
+	assert.True(failed)
+	assert.Equal(map[string]int{
+		tp.Addr() + " authcode true":  1,
+		tp.Addr() + " authcode false": 2,
+	}, sink.callbacks)
+}
+
+// testCallbackSink is an oidc.MetricsSink which records callbacks
+type testCallbackSink struct {
+	mu        sync.Mutex
+	callbacks map[string]int
+}
+
+func (s *testCallbackSink) IncCallback(issuer, flow string, success bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.callbacks == nil {
+		s.callbacks = map[string]int{}
+	}
+	s.callbacks[fmt.Sprintf("%s %s %t", issuer, flow, success)]++
+}
+
+func (s *testCallbackSink) IncExchange(string, bool)                     {}
+func (s *testCallbackSink) IncRefresh(string, bool)                      {}
+func (s *testCallbackSink) IncVerificationFailure(string, string)        {}
+func (s *testCallbackSink) ObserveLatency(string, string, time.Duration) {}
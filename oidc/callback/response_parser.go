@@ -0,0 +1,100 @@
+package callback
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// ResponseParser parses an authentication response's parameters (state,
+// code, id_token, error, etc) from a callback's request.  A ResponseParser
+// allows the callbacks to support extension response modes (see
+// oidc.WithResponseModes), which don't return the parameters as query or form
+// parameters.  For example: with the "web_message" response mode, the
+// parameters are posted to a web page's JavaScript, which may relay them to
+// the callback as JSON (see JSONResponseParser).
+//
+// The request's body is already limited to a safe size before the parser is
+// called, and the parsed parameters are validated just like the parameters of
+// the query, fragment and form_post response modes.
+type ResponseParser func(w http.ResponseWriter, req *http.Request) (url.Values, error)
+
+// WithResponseParser provides an optional ResponseParser for the callback's
+// authentication responses.  By default, the parameters are parsed from the
+// request's query or form parameters (see: http.Request.ParseForm).
+//
+// Valid for: AuthCode and Implicit
+func WithResponseParser(p ResponseParser) oidc.Option {
+	return func(o interface{}) {
+		if p == nil {
+			return
+		}
+		if o, ok := o.(*callbackOptions); ok {
+			o.withResponseParser = p
+		}
+	}
+}
+
+// JSONResponseParser is a ResponseParser for a request whose body is a JSON
+// object with the authentication response's parameters, like:
+//
+//	{"state":"st_...","code":"..."}
+//
+// The object's values must be strings.
+func JSONResponseParser(_ http.ResponseWriter, req *http.Request) (url.Values, error) {
+	const op = "callback.JSONResponseParser"
+	if req.Body == nil {
+		return nil, fmt.Errorf("%s: request body is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	var params map[string]string
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		return nil, fmt.Errorf("%s: unable to decode request body: %s: %w", op, err, oidc.ErrInvalidParameter)
+	}
+	values := make(url.Values, len(params))
+	for k, v := range params {
+		values.Set(k, v)
+	}
+	return values, nil
+}
+
+// formResponseParser is the default ResponseParser, which parses the
+// response's parameters from the request's query or form parameters.
+func formResponseParser(_ http.ResponseWriter, req *http.Request) (url.Values, error) {
+	const op = "callback.formResponseParser"
+	if err := req.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse form: %s: %w", op, err, oidc.ErrInvalidParameter)
+	}
+	return req.Form, nil
+}
+
+// callbackOptions is the set of available options for the AuthCode and
+// Implicit callbacks
+type callbackOptions struct {
+	withResponseParser          ResponseParser
+	withRedirectURLVerification bool
+	withReturnTo                bool
+	withReturnToAllowList       []string
+	withMaxRetries              int
+	withRetryWriter             RequestWriter
+	withRetryRequestFunc        RetryRequestFunc
+	withFingerprintStrictness   oidc.FingerprintStrictness
+	withFingerprintOptions      []oidc.Option
+	withFirstDuplicateValue     bool
+}
+
+// callbackDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func callbackDefaults() callbackOptions {
+	return callbackOptions{withResponseParser: formResponseParser}
+}
+
+// getCallbackOpts gets the callback defaults and applies the opt overrides
+// passed in
+func getCallbackOpts(opt ...oidc.Option) callbackOptions {
+	opts := callbackDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
@@ -0,0 +1,55 @@
+package callback
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithResponseParser(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redirect := "https://alice.com/callback"
+	tp := oidc.StartTestProvider(t)
+	tp.SetExpectedAuthCode("valid-code")
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	p := testNewProvider(t, "test-client-id", "test-client-secret", redirect, tp)
+
+	oidcRequest, err := oidc.NewRequest(time.Minute, redirect, oidc.WithResponseMode("web_message"))
+	require.NoError(t, err)
+	tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+	body := `{"state":"` + oidcRequest.State() + `","code":"valid-code"}`
+
+	t.Run("json", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		h, err := AuthCode(ctx, p, &SingleRequestReader{oidcRequest}, testSuccessFn, testFailFn, WithResponseParser(JSONResponseParser))
+		require.NoError(err)
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body)))
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Equal("login successful", w.Body.String())
+	})
+	t.Run("default-form", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		h, err := AuthCode(ctx, p, &SingleRequestReader{oidcRequest}, testSuccessFn, testFailFn)
+		require.NoError(err)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		h(w, req)
+		// the JSON body isn't parsed by default, so the state is missing
+		assert.Equal(http.StatusInternalServerError, w.Code)
+	})
+	t.Run("nil-parser", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := getCallbackOpts(WithResponseParser(nil))
+		assert.NotNil(opts.withResponseParser)
+	})
+}
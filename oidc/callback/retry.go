@@ -0,0 +1,193 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// retryStateSeparator separates a retried request's state from its attempt
+// number (like: st_xxxx.r2), so the number of attempts is known without any
+// additional storage.
+const retryStateSeparator = ".r"
+
+// RetryableErrors are the authentication error responses which are retried
+// when the WithProviderErrorRetry option is used.  They're the provider's
+// recoverable errors.
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#AuthError
+var RetryableErrors = []string{"temporarily_unavailable", "server_error"}
+
+// RequestWriter defines an interface for writing an oidc.Request, so it can
+// be read by a RequestReader when its authentication response is received.
+//
+// Implementations must be concurrently safe, since the writer will likely be
+// used within a concurrent http.Handler
+type RequestWriter interface {
+	// Write a request, keyed by its State().
+	Write(ctx context.Context, oidcRequest oidc.Request) error
+}
+
+// ensure that MemoryRequestStore implements the RequestWriter interface.
+var _ RequestWriter = (*MemoryRequestStore)(nil)
+
+// RetryRequestFunc is used by callbacks to create a new oidc.Request, with the
+// given state, for retrying the previous request's authentication flow (see
+// WithProviderErrorRetry).
+type RetryRequestFunc func(ctx context.Context, previous oidc.Request, state string) (oidc.Request, error)
+
+// RetryRequest returns a RetryRequestFunc which creates a new request which
+// expires in expireIn, with the previous request's parameters (including its
+// fingerprint and provider binding), the given state, a new nonce and (when
+// the previous request used PKCE) a new code verifier.
+func RetryRequest(expireIn time.Duration) RetryRequestFunc {
+	return func(_ context.Context, previous oidc.Request, state string) (oidc.Request, error) {
+		const op = "callback.RetryRequest"
+		opts := []oidc.Option{
+			oidc.WithState(state),
+			oidc.WithAudiences(previous.Audiences()...),
+			oidc.WithScopes(previous.Scopes()...),
+			oidc.WithPrompts(previous.Prompts()...),
+			oidc.WithDisplay(previous.Display()),
+			oidc.WithUILocales(previous.UILocales()...),
+			oidc.WithClaimsLocales(previous.ClaimsLocales()...),
+			oidc.WithClaims(previous.Claims()),
+			oidc.WithACRValues(previous.ACRValues()...),
+			oidc.WithResponseMode(previous.ResponseMode()),
+			oidc.WithAuthAudience(previous.AuthAudience()),
+			oidc.WithReturnTo(previous.ReturnTo()),
+			oidc.WithRequiredScopes(previous.RequiredScopes()...),
+			oidc.WithFingerprint(previous.Fingerprint()),
+		}
+		if useImplicit, withAccessToken := previous.ImplicitFlow(); useImplicit {
+			opts = append(opts, oidc.WithImplicitFlow(withAccessToken))
+		}
+		if previous.PKCEVerifier() != nil {
+			v, err := oidc.NewCodeVerifier()
+			if err != nil {
+				return nil, fmt.Errorf("%s: unable to create a code verifier: %w", op, err)
+			}
+			opts = append(opts, oidc.WithPKCE(v))
+		}
+		if seconds, _ := previous.MaxAge(); seconds > 0 {
+			opts = append(opts, oidc.WithMaxAge(seconds))
+		}
+		if previous.OfflineAccess() {
+			opts = append(opts, oidc.WithOfflineAccess())
+		}
+		if issuer := previous.ProviderIssuer(); issuer != "" {
+			opts = append(opts, oidc.WithProviderBinding(issuer))
+		}
+		r, err := oidc.NewRequest(expireIn, previous.RedirectURL(), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return r, nil
+	}
+}
+
+// WithProviderErrorRetry provides an optional retry of authentication flows
+// which fail with one of the provider's RetryableErrors.  Instead of calling
+// the ErrorResponseFunc, the callback creates a new request with a fresh
+// state using the RetryRequestFunc, writes it with the RequestWriter and
+// redirects the user to the provider's AuthURL for it.  A flow is retried up
+// to maxRetries times, and then the ErrorResponseFunc is called with the
+// provider's error.  The RequestWriter must write to the store read by the
+// callback's RequestReader.
+//
+// Valid for: AuthCode and Implicit
+func WithProviderErrorRetry(maxRetries int, rw RequestWriter, fn RetryRequestFunc) oidc.Option {
+	return func(o interface{}) {
+		if maxRetries <= 0 || rw == nil || fn == nil {
+			return
+		}
+		if o, ok := o.(*callbackOptions); ok {
+			o.withMaxRetries = maxRetries
+			o.withRetryWriter = rw
+			o.withRetryRequestFunc = fn
+		}
+	}
+}
+
+// retryAuth retries the authentication flow of an error response when it's
+// retryable (see WithProviderErrorRetry) by redirecting the user to the
+// provider.  It returns false when the flow isn't retried, and an error when
+// it's retryable but a new flow can't be started.
+func retryAuth(ctx context.Context, p *oidc.Provider, rr RequestReader, opts callbackOptions, authResp *authResponse, w http.ResponseWriter, req *http.Request) (bool, error) {
+	const op = "callback.retryAuth"
+	if opts.withMaxRetries == 0 || !retryableError(authResp.authErr.Error) {
+		return false, nil
+	}
+	attempt := retryAttempt(authResp.state)
+	if attempt >= opts.withMaxRetries {
+		return false, nil
+	}
+	previous, err := rr.Read(ctx, authResp.state)
+	switch {
+	case err != nil:
+		return false, fmt.Errorf("%s: unable to read request: %w", op, err)
+	case previous == nil:
+		return false, fmt.Errorf("%s: request not found: %w", op, oidc.ErrNotFound)
+	case previous.State() != authResp.state:
+		return false, fmt.Errorf("%s: request state and response state are not equal: %w", op, oidc.ErrInvalidResponseState)
+	case previous.IsExpired():
+		// the user's flow took too long, so it's not retried
+		return false, nil
+	}
+	if err := verifyFingerprint(opts, req, previous); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	// the previous flow's response was received, so a duplicate of it won't
+	// start another retry
+	if err := transitionPhase(ctx, rr, previous.State(), PhaseIssued, PhaseCallbackReceived); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := oidc.NewID(oidc.WithPrefix("st"))
+	if err != nil {
+		return false, fmt.Errorf("%s: unable to generate a state: %w", op, err)
+	}
+	retry, err := opts.withRetryRequestFunc(ctx, previous, id+retryStateSeparator+strconv.Itoa(attempt+1))
+	if err != nil {
+		return false, fmt.Errorf("%s: unable to create retry request: %w", op, err)
+	}
+	if err := opts.withRetryWriter.Write(ctx, retry); err != nil {
+		return false, fmt.Errorf("%s: unable to write retry request: %w", op, err)
+	}
+	authURL, err := p.AuthURL(ctx, retry)
+	if err != nil {
+		return false, fmt.Errorf("%s: unable to get retry request's auth URL: %w", op, err)
+	}
+	http.Redirect(w, req, authURL, http.StatusFound)
+	return true, nil
+}
+
+// retryableError returns true when the error response is one of the
+// RetryableErrors.
+func retryableError(e string) bool {
+	for _, r := range RetryableErrors {
+		if e == r {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAttempt returns the retry attempt of a request's state, which is zero
+// when the state isn't a retry's.
+func retryAttempt(state string) int {
+	i := strings.LastIndex(state, retryStateSeparator)
+	if i < 0 {
+		return 0
+	}
+	attempt, err := strconv.Atoi(state[i+len(retryStateSeparator):])
+	if err != nil || attempt < 0 {
+		return 0
+	}
+	return attempt
+}
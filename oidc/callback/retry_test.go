@@ -0,0 +1,161 @@
+package callback
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ProviderErrorRetry(t *testing.T) {
+	ctx := context.Background()
+	clientID := "test-client-id"
+	clientSecret := "test-client-secret"
+	tp := oidc.StartTestProvider(t)
+	redirect := "https://alice.com/callback"
+	p := testNewProvider(t, clientID, clientSecret, redirect, tp)
+
+	tests := []struct {
+		name           string
+		implicit       bool
+		respError      string
+		attempt        int
+		maxRetries     int
+		wantRetry      bool
+		wantStatusCode int
+	}{
+		{name: "authcode-temporarily-unavailable", respError: "temporarily_unavailable", maxRetries: 2, wantRetry: true},
+		{name: "authcode-server-error", respError: "server_error", attempt: 1, maxRetries: 2, wantRetry: true},
+		{name: "implicit-server-error", implicit: true, respError: "server_error", maxRetries: 1, wantRetry: true},
+		{name: "retries-exhausted", respError: "server_error", attempt: 2, maxRetries: 2, wantStatusCode: http.StatusUnauthorized},
+		{name: "not-retryable", respError: "access_denied", maxRetries: 2, wantStatusCode: http.StatusUnauthorized},
+		{name: "no-retries", respError: "server_error", wantStatusCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			s, err := NewMemoryRequestStore()
+			require.NoError(err)
+			defer s.Close()
+
+			id, err := oidc.NewID(oidc.WithPrefix("st"))
+			require.NoError(err)
+			state := id
+			if tt.attempt > 0 {
+				state = id + retryStateSeparator + strconv.Itoa(tt.attempt)
+			}
+			opts := []oidc.Option{oidc.WithState(state), oidc.WithScopes("email"), oidc.WithReturnTo("/orders"), oidc.WithProviderBinding(tp.Addr())}
+			if tt.implicit {
+				opts = append(opts, oidc.WithImplicitFlow())
+			} else {
+				v, err := oidc.NewCodeVerifier()
+				require.NoError(err)
+				opts = append(opts, oidc.WithPKCE(v))
+			}
+			previous, err := oidc.NewRequest(time.Minute, redirect, opts...)
+			require.NoError(err)
+			require.NoError(s.Write(ctx, previous))
+
+			newHandler := AuthCode
+			if tt.implicit {
+				newHandler = Implicit
+			}
+			h, err := newHandler(ctx, p, s, testSuccessFn, testFailFn, WithProviderErrorRetry(tt.maxRetries, s, RetryRequest(time.Minute)))
+			require.NoError(err)
+
+			req := httptest.NewRequest(http.MethodGet, "/callback?"+url.Values{"state": {state}, "error": {tt.respError}}.Encode(), nil)
+			w := httptest.NewRecorder()
+			h(w, req)
+
+			if !tt.wantRetry {
+				assert.Equal(tt.wantStatusCode, w.Code)
+				assert.Contains(w.Body.String(), tt.respError)
+				return
+			}
+			require.Equal(http.StatusFound, w.Code)
+			authURL, err := url.Parse(w.Header().Get("Location"))
+			require.NoError(err)
+			assert.True(strings.HasPrefix(authURL.String(), tp.Addr()))
+			retryState := authURL.Query().Get("state")
+			assert.NotEqual(state, retryState)
+			assert.Equal(tt.attempt+1, retryAttempt(retryState))
+
+			retry, err := s.Read(ctx, retryState)
+			require.NoError(err)
+			assert.NotEqual(previous.Nonce(), retry.Nonce())
+			assert.Equal(previous.Scopes(), retry.Scopes())
+			assert.Equal(previous.ReturnTo(), retry.ReturnTo())
+			assert.Equal(tp.Addr(), retry.ProviderIssuer())
+			useImplicit, _ := retry.ImplicitFlow()
+			assert.Equal(tt.implicit, useImplicit)
+			if !tt.implicit {
+				require.NotNil(retry.PKCEVerifier())
+				assert.NotEqual(previous.PKCEVerifier().Verifier(), retry.PKCEVerifier().Verifier())
+			}
+		})
+	}
+	t.Run("request-not-found", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		s, err := NewMemoryRequestStore()
+		require.NoError(err)
+		defer s.Close()
+		h, err := AuthCode(ctx, p, s, testSuccessFn, testFailFn, WithProviderErrorRetry(1, s, RetryRequest(time.Minute)))
+		require.NoError(err)
+		req := httptest.NewRequest(http.MethodGet, "/callback?state=st_unknown&error=server_error", nil)
+		w := httptest.NewRecorder()
+		h(w, req)
+		assert.Equal(http.StatusInternalServerError, w.Code)
+		assert.Contains(w.Body.String(), "unable to retry authentication")
+	})
+}
+
+func Test_retryAttempt(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		state string
+		want  int
+	}{
+		{state: "st_abc", want: 0},
+		{state: "st_abc.r1", want: 1},
+		{state: "st_abc.r12", want: 12},
+		{state: "st_abc.r", want: 0},
+		{state: "st_abc.rx", want: 0},
+		{state: "st_abc.r-1", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			assert.Equal(t, tt.want, retryAttempt(tt.state))
+		})
+	}
+}
+
+func Test_WithProviderErrorRetry(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	s, err := NewMemoryRequestStore()
+	require.NoError(t, err)
+	defer s.Close()
+
+	opts := getCallbackOpts(WithProviderErrorRetry(3, s, RetryRequest(time.Minute)))
+	assert.Equal(3, opts.withMaxRetries)
+	assert.Equal(s, opts.withRetryWriter)
+	assert.NotNil(opts.withRetryRequestFunc)
+
+	for _, opt := range []oidc.Option{
+		WithProviderErrorRetry(0, s, RetryRequest(time.Minute)),
+		WithProviderErrorRetry(1, nil, RetryRequest(time.Minute)),
+		WithProviderErrorRetry(1, s, nil),
+	} {
+		opts := getCallbackOpts(opt)
+		assert.Equal(0, opts.withMaxRetries)
+		assert.Nil(opts.withRetryWriter)
+	}
+}
@@ -0,0 +1,112 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// returnToKey is the context key of a callback request's validated return-to
+// URL.
+type returnToKey struct{}
+
+// WithReturnToAllowList provides an optional list of origins (like
+// https://app.example.com) which the oidc.Request's ReturnTo() may be an
+// absolute URL for; relative paths on the callback's own origin are always
+// allowed.  After a successful callback, a valid return-to URL is available to
+// the SuccessResponseFunc via ReturnTo(req), and RedirectReturnTo(...) can be
+// used to redirect the user to it.  An invalid return-to URL fails the
+// callback with an error wrapping oidc.ErrInvalidReturnTo.
+//
+// Valid for: AuthCode and Implicit
+func WithReturnToAllowList(allowed ...string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*callbackOptions); ok {
+			o.withReturnTo = true
+			o.withReturnToAllowList = allowed
+		}
+	}
+}
+
+// ValidReturnTo validates a return-to URL before it's stored with an
+// oidc.Request (see oidc.WithReturnTo), so the app can't be used as an open
+// redirector.  A relative path (like /orders?id=1) is valid, and an absolute
+// http(s) URL is only valid when its origin (scheme and host) is one of the
+// allowed origins.  Scheme-relative URLs (//host/path) and URLs with
+// backslashes or user info are never valid.
+func ValidReturnTo(returnTo string, allowed []string) error {
+	const op = "callback.ValidReturnTo"
+	if returnTo == "" {
+		return fmt.Errorf("%s: return-to URL is empty: %w", op, oidc.ErrInvalidReturnTo)
+	}
+	// browsers treat a backslash like a slash, so /\host is scheme-relative.
+	if strings.ContainsAny(returnTo, "\\\t\r\n") {
+		return fmt.Errorf("%s: return-to URL has invalid characters: %w", op, oidc.ErrInvalidReturnTo)
+	}
+	u, err := url.Parse(returnTo)
+	if err != nil {
+		return fmt.Errorf("%s: unable to parse return-to URL: %s: %w", op, err, oidc.ErrInvalidReturnTo)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%s: return-to URL has user info: %w", op, oidc.ErrInvalidReturnTo)
+	}
+	if u.Scheme == "" && u.Host == "" {
+		if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+			return fmt.Errorf("%s: relative return-to URL must be an absolute path: %w", op, oidc.ErrInvalidReturnTo)
+		}
+		return nil
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%s: return-to URL scheme %q is not allowed: %w", op, u.Scheme, oidc.ErrInvalidReturnTo)
+	}
+	for _, a := range allowed {
+		origin, err := url.Parse(a)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(origin.Scheme, u.Scheme) && strings.EqualFold(origin.Host, u.Host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: return-to URL origin %s://%s is not allowed: %w", op, u.Scheme, u.Host, oidc.ErrInvalidReturnTo)
+}
+
+// ReturnTo returns the validated return-to URL of a successful callback's
+// request, when the WithReturnToAllowList option is used and the
+// oidc.Request has a ReturnTo().
+func ReturnTo(req *http.Request) (string, bool) {
+	if req == nil {
+		return "", false
+	}
+	returnTo, ok := req.Context().Value(returnToKey{}).(string)
+	return returnTo, ok
+}
+
+// RedirectReturnTo redirects the user to the successful callback's return-to
+// URL (see ReturnTo), or to the defaultURL when there isn't one.  It's
+// intended to be called by a SuccessResponseFunc, after the user's session is
+// established.
+func RedirectReturnTo(w http.ResponseWriter, req *http.Request, defaultURL string) {
+	target := defaultURL
+	if returnTo, ok := ReturnTo(req); ok {
+		target = returnTo
+	}
+	http.Redirect(w, req, target, http.StatusSeeOther)
+}
+
+// withReturnTo validates the oidc.Request's return-to URL (when the option is
+// used) and returns the callback's request with it in its context.
+func withReturnTo(opts callbackOptions, req *http.Request, oidcRequest oidc.Request) (*http.Request, error) {
+	const op = "callback.withReturnTo"
+	if !opts.withReturnTo || oidcRequest.ReturnTo() == "" {
+		return req, nil
+	}
+	if err := ValidReturnTo(oidcRequest.ReturnTo(), opts.withReturnToAllowList); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return req.WithContext(context.WithValue(req.Context(), returnToKey{}, oidcRequest.ReturnTo())), nil
+}
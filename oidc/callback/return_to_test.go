@@ -0,0 +1,134 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidReturnTo(t *testing.T) {
+	t.Parallel()
+	allowed := []string{"https://app.example.com", "http://localhost:8080"}
+	tests := []struct {
+		name     string
+		returnTo string
+		wantErr  bool
+	}{
+		{name: "relative", returnTo: "/orders?id=1#top"},
+		{name: "root", returnTo: "/"},
+		{name: "allowed-origin", returnTo: "https://app.example.com/orders"},
+		{name: "allowed-origin-case", returnTo: "https://APP.example.com/orders"},
+		{name: "allowed-origin-port", returnTo: "http://localhost:8080/orders"},
+		{name: "empty", returnTo: "", wantErr: true},
+		{name: "relative-no-slash", returnTo: "orders", wantErr: true},
+		{name: "scheme-relative", returnTo: "//evil.example.com/orders", wantErr: true},
+		{name: "backslash", returnTo: "/\\evil.example.com", wantErr: true},
+		{name: "newline", returnTo: "/orders\r\nLocation: https://evil.example.com", wantErr: true},
+		{name: "unknown-origin", returnTo: "https://evil.example.com/orders", wantErr: true},
+		{name: "different-scheme", returnTo: "http://app.example.com/orders", wantErr: true},
+		{name: "different-port", returnTo: "http://localhost:9090/orders", wantErr: true},
+		{name: "user-info", returnTo: "https://app.example.com@evil.example.com/", wantErr: true},
+		{name: "javascript", returnTo: "javascript:alert(1)", wantErr: true},
+		{name: "malformed", returnTo: "https://app.example.com/%zz", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			err := ValidReturnTo(tt.returnTo, allowed)
+			if tt.wantErr {
+				assert.Truef(errors.Is(err, oidc.ErrInvalidReturnTo), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidReturnTo, err)
+				return
+			}
+			assert.NoError(err)
+		})
+	}
+}
+
+func TestAuthCode_WithReturnToAllowList(t *testing.T) {
+	ctx := context.Background()
+	tp := oidc.StartTestProvider(t)
+	tp.SetExpectedAuthCode("valid-code")
+	redirect := "https://app.example.com/callback"
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	p := testNewProvider(t, "test-client-id", "test-client-secret", redirect, tp)
+
+	var gotErr error
+	eFn := func(_ string, _ *AuthenErrorResponse, e error, w http.ResponseWriter, _ *http.Request) {
+		gotErr = e
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	sFn := func(_ string, _ oidc.Token, w http.ResponseWriter, req *http.Request) {
+		RedirectReturnTo(w, req, "/home")
+	}
+
+	tests := []struct {
+		name         string
+		returnTo     string
+		wantLocation string
+		wantErr      bool
+	}{
+		{name: "return-to", returnTo: "/orders?id=1", wantLocation: "/orders?id=1"},
+		{name: "allowed-origin", returnTo: "https://admin.example.com/", wantLocation: "https://admin.example.com/"},
+		{name: "default", wantLocation: "/home"},
+		{name: "invalid", returnTo: "https://evil.example.com/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			gotErr = nil
+			oidcRequest, err := oidc.NewRequest(time.Minute, redirect, oidc.WithReturnTo(tt.returnTo))
+			require.NoError(err)
+			tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+			h, err := AuthCode(ctx, p, &SingleRequestReader{Request: oidcRequest}, sFn, eFn, WithReturnToAllowList("https://admin.example.com"))
+			require.NoError(err)
+
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest(http.MethodGet, redirect+"?code=valid-code&state="+oidcRequest.State(), nil))
+			if tt.wantErr {
+				assert.Equal(http.StatusUnauthorized, w.Code)
+				assert.Truef(errors.Is(gotErr, oidc.ErrInvalidReturnTo), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidReturnTo, gotErr)
+				return
+			}
+			require.NoError(gotErr)
+			assert.Equal(http.StatusSeeOther, w.Code)
+			assert.Equal(tt.wantLocation, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestReturnTo(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	got, ok := ReturnTo(nil)
+	assert.False(ok)
+	assert.Empty(got)
+	req := httptest.NewRequest(http.MethodGet, "/callback", nil)
+	_, ok = ReturnTo(req)
+	assert.False(ok)
+
+	// without the option, the request's return-to isn't used
+	oidcRequest, err := oidc.NewRequest(time.Minute, "https://app.example.com/callback", oidc.WithReturnTo("https://evil.example.com"))
+	assert.NoError(err)
+	r, err := withReturnTo(getCallbackOpts(), req, oidcRequest)
+	assert.NoError(err)
+	_, ok = ReturnTo(r)
+	assert.False(ok)
+}
+
+func Test_WithReturnToAllowList(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	opts := getCallbackOpts(WithReturnToAllowList("https://app.example.com"))
+	testOpts := callbackDefaults()
+	testOpts.withReturnTo = true
+	testOpts.withReturnToAllowList = []string{"https://app.example.com"}
+	assert.Equal(testOpts.withReturnTo, opts.withReturnTo)
+	assert.Equal(testOpts.withReturnToAllowList, opts.withReturnToAllowList)
+}
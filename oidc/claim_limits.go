@@ -0,0 +1,211 @@
+package oidc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxClaimsSize is the default limit for the bytes of an id_token's
+// decoded payload or a userinfo response's claims.
+const DefaultMaxClaimsSize = 512 * 1024
+
+// DefaultMaxClaimArrayLength is the default limit for the number of elements
+// in each of the claims' arrays.
+const DefaultMaxClaimArrayLength = 10000
+
+// ClaimLimit is a kind of limit enforced by ClaimLimits.
+type ClaimLimit string
+
+const (
+	// ClaimLimitPayloadSize limits the bytes of the claims.
+	ClaimLimitPayloadSize ClaimLimit = "payload size"
+
+	// ClaimLimitArrayLength limits the number of elements of an array.
+	ClaimLimitArrayLength ClaimLimit = "array length"
+
+	// ClaimLimitDepth limits the nesting depth of the objects and arrays.
+	ClaimLimitDepth ClaimLimit = "depth"
+)
+
+// ClaimLimits are the limits enforced on the claims of id_tokens and userinfo
+// responses before they're unmarshaled, which protect a service from
+// adversarial or buggy providers emitting claims (for example: group lists)
+// which are megabytes in size.  Claims which exceed a limit fail with a
+// ClaimLimitError.  A zero limit uses its default.
+type ClaimLimits struct {
+	// MaxPayloadSize limits the bytes of the claims.  The default is
+	// DefaultMaxClaimsSize.  An id_token is also limited to MaxTokenSize, and
+	// a userinfo response to its ResponseLimits.
+	MaxPayloadSize int
+
+	// MaxArrayLength limits the number of elements in each of the claims'
+	// arrays.  The default is DefaultMaxClaimArrayLength.
+	MaxArrayLength int
+
+	// MaxDepth limits the nesting depth of the claims' objects and arrays,
+	// where the claims' top level object has a depth of 1.  The default is
+	// MaxClaimsDepth.
+	MaxDepth int
+}
+
+// ClaimLimitError is returned when claims exceed one of their ClaimLimits.  It
+// wraps ErrClaimLimitExceeded, and errors.As can be used to get a
+// ClaimLimitError from an error.
+type ClaimLimitError struct {
+	// Source is the source of the claims: "id_token" or "userinfo".
+	Source string
+
+	// Limit is the kind of limit which was exceeded.
+	Limit ClaimLimit
+
+	// Claim is the dot separated path of the claim which exceeded the limit
+	// (for example: "groups" or "address.street"), which is empty for the
+	// ClaimLimitPayloadSize limit.
+	Claim string
+
+	// Max is the limit's maximum.
+	Max int
+
+	// Actual is the value which exceeded the limit.  For the
+	// ClaimLimitArrayLength limit, it's the first length which exceeded it.
+	Actual int
+}
+
+// Error satisfies the error interface.
+func (e *ClaimLimitError) Error() string {
+	if e.Claim == "" {
+		return fmt.Sprintf("%s claims %s of %d exceeds %d: %s", e.Source, e.Limit, e.Actual, e.Max, ErrClaimLimitExceeded)
+	}
+	return fmt.Sprintf("%s claim %q %s of %d exceeds %d: %s", e.Source, e.Claim, e.Limit, e.Actual, e.Max, ErrClaimLimitExceeded)
+}
+
+// Unwrap returns ErrClaimLimitExceeded.
+func (e *ClaimLimitError) Unwrap() error { return ErrClaimLimitExceeded }
+
+// WithClaimLimits provides optional limits for the claims of the provider's
+// id_tokens and userinfo responses.  See ClaimLimits.
+//
+// Valid for: Provider
+func WithClaimLimits(l ClaimLimits) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*providerOptions); ok {
+			o.withClaimLimits = l
+		}
+	}
+}
+
+// validate checks that none of the limits are negative.
+func (l ClaimLimits) validate() error {
+	const op = "ClaimLimits.validate"
+	if l.MaxPayloadSize < 0 || l.MaxArrayLength < 0 || l.MaxDepth < 0 {
+		return fmt.Errorf("%s: claim limits must not be negative: %w", op, ErrInvalidParameter)
+	}
+	return nil
+}
+
+// withDefaults returns the limits with their zero limits set to the defaults.
+func (l ClaimLimits) withDefaults() ClaimLimits {
+	if l.MaxPayloadSize == 0 {
+		l.MaxPayloadSize = DefaultMaxClaimsSize
+	}
+	if l.MaxArrayLength == 0 {
+		l.MaxArrayLength = DefaultMaxClaimArrayLength
+	}
+	if l.MaxDepth == 0 {
+		l.MaxDepth = MaxClaimsDepth
+	}
+	return l
+}
+
+// checkJWT checks the claims of the raw jwt's payload.  A jwt whose payload
+// can't be decoded isn't checked, and is left to fail its verification.
+func (l ClaimLimits) checkJWT(source, jwt string) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	return l.check(source, payload)
+}
+
+// check checks the raw claims against the limits, without unmarshaling them.
+// Claims which aren't valid JSON are checked up to the invalid JSON, and are
+// left to fail when they're unmarshaled.
+func (l ClaimLimits) check(source string, raw []byte) error {
+	l = l.withDefaults()
+	if len(raw) > l.MaxPayloadSize {
+		return &ClaimLimitError{Source: source, Limit: ClaimLimitPayloadSize, Max: l.MaxPayloadSize, Actual: len(raw)}
+	}
+	// frame is an object or array being decoded, and its path is the path of
+	// the claim it's the value of.
+	type frame struct {
+		array   bool
+		path    string
+		key     string
+		wantKey bool
+		length  int
+	}
+	var stack []*frame
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		var parent *frame
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 && !stack[len(stack)-1].array {
+				stack[len(stack)-1].wantKey = true
+			}
+			continue
+		}
+		if parent != nil && !parent.array && parent.wantKey {
+			parent.key, parent.wantKey = tok.(string), false
+			continue
+		}
+		// tok is a value
+		path := ""
+		if parent != nil {
+			path = parent.path
+			if !parent.array {
+				path = joinClaimPath(parent.path, parent.key)
+			}
+		}
+		if parent != nil && parent.array {
+			parent.length++
+			if parent.length > l.MaxArrayLength {
+				return &ClaimLimitError{Source: source, Limit: ClaimLimitArrayLength, Claim: parent.path, Max: l.MaxArrayLength, Actual: parent.length}
+			}
+		}
+		d, ok := tok.(json.Delim)
+		if !ok {
+			if parent != nil && !parent.array {
+				parent.wantKey = true
+			}
+			continue
+		}
+		if len(stack)+1 > l.MaxDepth {
+			return &ClaimLimitError{Source: source, Limit: ClaimLimitDepth, Claim: path, Max: l.MaxDepth, Actual: len(stack) + 1}
+		}
+		stack = append(stack, &frame{array: d == '[', path: path, wantKey: d == '{'})
+	}
+}
+
+// joinClaimPath returns the path of the key's claim within the parent claim.
+func joinClaimPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
@@ -0,0 +1,165 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimLimits_check(t *testing.T) {
+	t.Parallel()
+	limits := ClaimLimits{MaxPayloadSize: 100, MaxArrayLength: 3, MaxDepth: 3}
+	tests := []struct {
+		name    string
+		limits  ClaimLimits
+		claims  string
+		wantErr *ClaimLimitError
+	}{
+		{
+			name:   "within-limits",
+			limits: limits,
+			claims: `{"sub":"alice","groups":["a","b","c"],"address":{"street":"main"}}`,
+		},
+		{
+			name:    "payload-size",
+			limits:  limits,
+			claims:  `{"sub":"` + strings.Repeat("a", 100) + `"}`,
+			wantErr: &ClaimLimitError{Source: "test", Limit: ClaimLimitPayloadSize, Max: 100, Actual: 110},
+		},
+		{
+			name:    "array-length",
+			limits:  limits,
+			claims:  `{"sub":"alice","groups":["a","b","c","d"]}`,
+			wantErr: &ClaimLimitError{Source: "test", Limit: ClaimLimitArrayLength, Claim: "groups", Max: 3, Actual: 4},
+		},
+		{
+			name:    "nested-array-length",
+			limits:  limits,
+			claims:  `{"org":{"teams":["a","b","c","d"]}}`,
+			wantErr: &ClaimLimitError{Source: "test", Limit: ClaimLimitArrayLength, Claim: "org.teams", Max: 3, Actual: 4},
+		},
+		{
+			name:    "depth",
+			limits:  limits,
+			claims:  `{"sub":"alice","a":{"b":[{"c":1}]}}`,
+			wantErr: &ClaimLimitError{Source: "test", Limit: ClaimLimitDepth, Claim: "a.b", Max: 3, Actual: 4},
+		},
+		{
+			name:   "defaults",
+			claims: `{"groups":[` + strings.Repeat(`"g",`, DefaultMaxClaimArrayLength-1) + `"g"]}`,
+		},
+		{
+			name:    "default-array-length",
+			claims:  `{"groups":[` + strings.Repeat(`"g",`, DefaultMaxClaimArrayLength) + `"g"]}`,
+			wantErr: &ClaimLimitError{Source: "test", Limit: ClaimLimitArrayLength, Claim: "groups", Max: DefaultMaxClaimArrayLength, Actual: DefaultMaxClaimArrayLength + 1},
+		},
+		{
+			name:    "default-depth",
+			claims:  `{"a":` + strings.Repeat("[", MaxClaimsDepth) + strings.Repeat("]", MaxClaimsDepth) + `}`,
+			wantErr: &ClaimLimitError{Source: "test", Limit: ClaimLimitDepth, Claim: "a", Max: MaxClaimsDepth, Actual: MaxClaimsDepth + 1},
+		},
+		{
+			name:   "invalid-json",
+			limits: limits,
+			claims: `{"sub":`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			err := tt.limits.check("test", []byte(tt.claims))
+			if tt.wantErr == nil {
+				assert.NoError(err)
+				return
+			}
+			assert.Truef(errors.Is(err, ErrClaimLimitExceeded), "wanted \"%s\" but got \"%s\"", ErrClaimLimitExceeded, err)
+			var limitErr *ClaimLimitError
+			if assert.True(errors.As(err, &limitErr)) {
+				assert.Equal(tt.wantErr, limitErr)
+			}
+		})
+	}
+	t.Run("jwt", func(t *testing.T) {
+		assert := assert.New(t)
+		encode := func(s string) string {
+			return "e30." + base64.RawURLEncoding.EncodeToString([]byte(s)) + ".sig"
+		}
+		assert.NoError(limits.checkJWT("id_token", encode(`{"groups":["a"]}`)))
+		assert.NoError(limits.checkJWT("id_token", "not-a-jwt"))
+		err := limits.checkJWT("id_token", encode(`{"groups":["a","b","c","d"]}`))
+		assert.Truef(errors.Is(err, ErrClaimLimitExceeded), "wanted \"%s\" but got \"%s\"", ErrClaimLimitExceeded, err)
+		assert.EqualError(err, `id_token claim "groups" array length of 4 exceeds 3: claim limit exceeded`)
+	})
+}
+
+func TestProvider_claimLimits(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+	tp.SetCustomClaims(map[string]interface{}{"groups": []string{"a", "b", "c"}})
+
+	newProvider := func(t *testing.T, l ClaimLimits) (*Provider, error) {
+		c := testNewConfig(t, clientID, "test-client-secret", redirect, tp)
+		p, err := NewProvider(c, WithClaimLimits(l))
+		if err == nil {
+			t.Cleanup(p.Done)
+		}
+		return p, err
+	}
+	exchange := func(t *testing.T, p *Provider) (*Tk, error) {
+		oidcRequest, err := NewRequest(time.Minute, redirect)
+		require.NoError(t, err)
+		tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+		return p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+	}
+	t.Run("invalid", func(t *testing.T) {
+		_, err := newProvider(t, ClaimLimits{MaxDepth: -1})
+		assert.Truef(t, errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("defaults", func(t *testing.T) {
+		require := require.New(t)
+		p, err := newProvider(t, ClaimLimits{})
+		require.NoError(err)
+		tk, err := exchange(t, p)
+		require.NoError(err)
+		var claims map[string]interface{}
+		require.NoError(p.UserInfo(ctx, tk.StaticTokenSource(), "alice@example.com", &claims))
+	})
+	t.Run("id_token", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, err := newProvider(t, ClaimLimits{MaxArrayLength: 2})
+		require.NoError(err)
+		_, err = exchange(t, p)
+		require.Error(err)
+		var limitErr *ClaimLimitError
+		require.Truef(errors.As(err, &limitErr), "wanted \"%s\" but got \"%s\"", ErrClaimLimitExceeded, err)
+		assert.Equal(&ClaimLimitError{Source: "id_token", Limit: ClaimLimitArrayLength, Claim: "groups", Max: 2, Actual: 3}, limitErr)
+	})
+	t.Run("userinfo", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, err := newProvider(t, ClaimLimits{MaxPayloadSize: 40})
+		require.NoError(err)
+		// the id_token's claims are checked before the userinfo, so the
+		// token is exchanged using a provider with the default limits.
+		defaults, err := newProvider(t, ClaimLimits{})
+		require.NoError(err)
+		tk, err := exchange(t, defaults)
+		require.NoError(err)
+		var claims map[string]interface{}
+		err = p.UserInfo(ctx, tk.StaticTokenSource(), "alice@example.com", &claims)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrClaimLimitExceeded), "wanted \"%s\" but got \"%s\"", ErrClaimLimitExceeded, err)
+		assert.Contains(err.Error(), "userinfo claims payload size")
+	})
+}
@@ -0,0 +1,187 @@
+package oidc
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// ClientAssertionType is the client_assertion_type of a private_key_jwt
+// client assertion.  See: https://tools.ietf.org/html/rfc7523#section-2.2
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// DefaultClientAssertionTTL is the amount of time a client assertion is valid.
+const DefaultClientAssertionTTL = 5 * time.Minute
+
+// ClientAssertion returns a private_key_jwt client assertion for the client,
+// signed by the signer, whose audience is the endpoint (typically the
+// provider's token endpoint).  A new assertion (with a unique jti) is required
+// for every request.
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+func ClientAssertion(signer *JWTSigner, clientID, endpoint string, now time.Time) (string, error) {
+	const op = "ClientAssertion"
+	if signer == nil {
+		return "", fmt.Errorf("%s: signer is nil: %w", op, ErrNilParameter)
+	}
+	claims, err := clientAssertionClaims(clientID, endpoint, now)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	assertion, err := signer.SignJWT(claims)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return assertion, nil
+}
+
+// ClientSecretAssertion returns a client_secret_jwt client assertion for the
+// client, HMAC-signed with the client's secret using the alg (HS256, HS384 or
+// HS512), whose audience is the endpoint (typically the provider's token
+// endpoint).  A new assertion (with a unique jti) is required for every
+// request.
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+func ClientSecretAssertion(secret ClientSecret, alg Alg, clientID, endpoint string, now time.Time) (string, error) {
+	const op = "ClientSecretAssertion"
+	switch {
+	case secret == "":
+		return "", fmt.Errorf("%s: client secret is empty: %w", op, ErrInvalidParameter)
+	case !hmacAlgorithms[alg]:
+		return "", fmt.Errorf("%s: %s is not an HMAC algorithm: %w", op, alg, ErrUnsupportedAlg)
+	}
+	claims, err := clientAssertionClaims(clientID, endpoint, now)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	sig, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.SignatureAlgorithm(alg), Key: []byte(secret)},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to create signer: %w", op, err)
+	}
+	assertion, err := jwt.Signed(sig).Claims(claims).CompactSerialize()
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to sign jwt: %w", op, err)
+	}
+	return assertion, nil
+}
+
+// clientAssertionClaims returns the claims of a client assertion for the
+// client, whose audience is the endpoint.
+func clientAssertionClaims(clientID, endpoint string, now time.Time) (jwt.Claims, error) {
+	const op = "clientAssertionClaims"
+	switch {
+	case clientID == "":
+		return jwt.Claims{}, fmt.Errorf("%s: client ID is empty: %w", op, ErrInvalidParameter)
+	case endpoint == "":
+		return jwt.Claims{}, fmt.Errorf("%s: endpoint is empty: %w", op, ErrInvalidParameter)
+	}
+	jti, err := NewID()
+	if err != nil {
+		return jwt.Claims{}, fmt.Errorf("%s: unable to generate jti: %w", op, err)
+	}
+	return jwt.Claims{
+		Issuer:   clientID,
+		Subject:  clientID,
+		Audience: jwt.Audience{endpoint},
+		ID:       jti,
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(DefaultClientAssertionTTL)),
+	}, nil
+}
+
+// clientAssertionTransport is an http.RoundTripper which authenticates the
+// client's form posts (token, refresh, grant and revocation requests) using a
+// private_key_jwt client assertion signed by the signer, or a
+// client_secret_jwt client assertion signed with the secret when there isn't
+// a signer, instead of sending the client's secret.
+type clientAssertionTransport struct {
+	base      http.RoundTripper
+	signer    *JWTSigner
+	secret    ClientSecret
+	secretAlg Alg
+	clientID  string
+	nowFunc   func() time.Time
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *clientAssertionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	const op = "clientAssertionTransport.RoundTrip"
+	if req.Method != http.MethodPost || req.Body == nil || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return t.base.RoundTrip(req)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to read request body: %w", op, err)
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to parse request body: %w", op, err)
+	}
+	now := time.Now()
+	if t.nowFunc != nil {
+		now = t.nowFunc()
+	}
+	audience := *req.URL
+	audience.RawQuery, audience.Fragment = "", ""
+	var assertion string
+	switch {
+	case t.signer != nil:
+		assertion, err = ClientAssertion(t.signer, t.clientID, audience.String(), now)
+	default:
+		assertion, err = ClientSecretAssertion(t.secret, t.secretAlg, t.clientID, audience.String(), now)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	form.Set("client_id", t.clientID)
+	form.Del("client_secret")
+	form.Set("client_assertion_type", ClientAssertionType)
+	form.Set("client_assertion", assertion)
+	encoded := form.Encode()
+
+	// the request must not be modified, so a clone is sent instead.
+	r := req.Clone(req.Context())
+	r.Header.Del("Authorization")
+	r.Body = ioutil.NopCloser(strings.NewReader(encoded))
+	r.ContentLength = int64(len(encoded))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(encoded)), nil
+	}
+	return t.base.RoundTrip(r)
+}
+
+// WithClientSecretJWT provides an optional HMAC algorithm (HS256, HS384 or
+// HS512) for client_secret_jwt client authentication (see
+// Config.ClientSecretJWTAlg).
+//
+// Valid for: Config
+func WithClientSecretJWT(alg Alg) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withClientSecretJWTAlg = alg
+		}
+	}
+}
+
+// WithClientAssertionSigner provides an optional signer for private_key_jwt
+// client authentication (see Config.ClientAssertionSigner).
+//
+// Valid for: Config
+func WithClientAssertionSigner(s *JWTSigner) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withClientAssertionSigner = s
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestClientAssertion(t *testing.T) {
+	t.Parallel()
+	pub, priv := TestGenerateKeys(t)
+	signer, err := NewJWTSigner(priv.(crypto.Signer), ES256, "rp-key")
+	require.NoError(t, err)
+	now := time.Now()
+
+	t.Run("valid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		assertion, err := ClientAssertion(signer, "client-id", "https://op.example.com/token", now)
+		require.NoError(err)
+		parsed, err := jwt.ParseSigned(assertion)
+		require.NoError(err)
+		var claims jwt.Claims
+		require.NoError(parsed.Claims(pub, &claims))
+		require.NoError(claims.ValidateWithLeeway(jwt.Expected{
+			Issuer:   "client-id",
+			Subject:  "client-id",
+			Audience: jwt.Audience{"https://op.example.com/token"},
+			Time:     now,
+		}, 0))
+		assert.NotEmpty(claims.ID)
+		assert.Equal(now.Add(DefaultClientAssertionTTL).Unix(), claims.Expiry.Time().Unix())
+
+		// every assertion has a unique jti
+		another, err := ClientAssertion(signer, "client-id", "https://op.example.com/token", now)
+		require.NoError(err)
+		assert.NotEqual(assertion, another)
+	})
+	t.Run("invalid-parameters", func(t *testing.T) {
+		assert := assert.New(t)
+		_, err := ClientAssertion(nil, "client-id", "https://op.example.com/token", now)
+		assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+		_, err = ClientAssertion(signer, "", "https://op.example.com/token", now)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+		_, err = ClientAssertion(signer, "client-id", "", now)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
+
+func TestProvider_clientAssertionAuthentication(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	assert, require := assert.New(t), require.New(t)
+	pub, priv := TestGenerateKeys(t)
+	signer, err := NewJWTSigner(&testKMSSigner{signer: priv.(crypto.Signer)}, ES256, "rp-key")
+	require.NoError(err)
+
+	type revocation struct {
+		authorization, clientID, clientSecret, assertionType string
+		claims                                               jwt.Claims
+	}
+	var mu sync.Mutex
+	var revoked []revocation
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/revoke":
+			r := revocation{
+				authorization: req.Header.Get("Authorization"),
+				clientID:      req.FormValue("client_id"),
+				clientSecret:  req.FormValue("client_secret"),
+				assertionType: req.FormValue("client_assertion_type"),
+			}
+			parsed, err := jwt.ParseSigned(req.FormValue("client_assertion"))
+			if err == nil {
+				err = parsed.Claims(pub, &r.claims)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			mu.Lock()
+			revoked = append(revoked, r)
+			mu.Unlock()
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"issuer":              srv.URL,
+				"jwks_uri":            srv.URL + "/jwks",
+				"revocation_endpoint": srv.URL + "/revoke",
+			})
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewConfig(srv.URL, "client-id", "", []Alg{ES256}, []string{"https://redirect"}, WithClientAssertionSigner(signer))
+	require.NoError(err)
+	assert.Equal(signer, c.ClientAssertionSigner)
+	p, err := NewProvider(c)
+	require.NoError(err)
+	defer p.Done()
+
+	require.NoError(p.Close(ctx, WithRevokeRefreshTokens("refresh-1")))
+	require.Len(revoked, 1)
+	assert.Empty(revoked[0].authorization)
+	assert.Empty(revoked[0].clientSecret)
+	assert.Equal("client-id", revoked[0].clientID)
+	assert.Equal(ClientAssertionType, revoked[0].assertionType)
+	assert.Equal("client-id", revoked[0].claims.Issuer)
+	assert.Equal(jwt.Audience{srv.URL + "/revoke"}, revoked[0].claims.Audience)
+}
+
+func Test_WithClientAssertionSigner(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	_, priv := TestGenerateKeys(t)
+	signer, err := NewJWTSigner(priv.(crypto.Signer), ES256, "")
+	require.NoError(t, err)
+	opts := getConfigOpts(WithClientAssertionSigner(signer))
+	testOpts := configDefaults()
+	testOpts.withClientAssertionSigner = signer
+	assert.Equal(opts, testOpts)
+}
+
+func TestClientSecretAssertion(t *testing.T) {
+	t.Parallel()
+	const secret = ClientSecret("a-client-secret-which-is-at-least-64-bytes-long-for-hs512-signing")
+	now := time.Now()
+
+	for _, alg := range []Alg{HS256, HS384, HS512} {
+		alg := alg
+		t.Run(string(alg), func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			assertion, err := ClientSecretAssertion(secret, alg, "client-id", "https://op.example.com/token", now)
+			require.NoError(err)
+			parsed, err := jwt.ParseSigned(assertion)
+			require.NoError(err)
+			require.Len(parsed.Headers, 1)
+			assert.Equal(string(alg), parsed.Headers[0].Algorithm)
+			var claims jwt.Claims
+			require.NoError(parsed.Claims([]byte(secret), &claims))
+			require.NoError(claims.ValidateWithLeeway(jwt.Expected{
+				Issuer:   "client-id",
+				Subject:  "client-id",
+				Audience: jwt.Audience{"https://op.example.com/token"},
+				Time:     now,
+			}, 0))
+			assert.NotEmpty(claims.ID)
+
+			// the assertion can't be verified with another secret
+			assert.Error(parsed.Claims([]byte("another-secret"), &claims))
+		})
+	}
+	t.Run("invalid-parameters", func(t *testing.T) {
+		assert := assert.New(t)
+		_, err := ClientSecretAssertion("", HS256, "client-id", "https://op.example.com/token", now)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+		_, err = ClientSecretAssertion(secret, RS256, "client-id", "https://op.example.com/token", now)
+		assert.Truef(errors.Is(err, ErrUnsupportedAlg), "wanted \"%s\" but got \"%s\"", ErrUnsupportedAlg, err)
+		_, err = ClientSecretAssertion(secret, HS256, "", "https://op.example.com/token", now)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+		_, err = ClientSecretAssertion(secret, HS256, "client-id", "", now)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
+
+func TestProvider_clientSecretJWTAuthentication(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	assert, require := assert.New(t), require.New(t)
+	const secret = ClientSecret("a-client-secret-which-is-at-least-32-bytes")
+
+	var mu sync.Mutex
+	var authorization, clientSecret, assertionType string
+	var claims jwt.Claims
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/revoke":
+			mu.Lock()
+			defer mu.Unlock()
+			authorization = req.Header.Get("Authorization")
+			clientSecret = req.FormValue("client_secret")
+			assertionType = req.FormValue("client_assertion_type")
+			parsed, err := jwt.ParseSigned(req.FormValue("client_assertion"))
+			if err == nil {
+				err = parsed.Claims([]byte(secret), &claims)
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"issuer":              srv.URL,
+				"jwks_uri":            srv.URL + "/jwks",
+				"revocation_endpoint": srv.URL + "/revoke",
+			})
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewConfig(srv.URL, "client-id", secret, []Alg{ES256}, []string{"https://redirect"}, WithClientSecretJWT(HS256))
+	require.NoError(err)
+	assert.Equal(HS256, c.ClientSecretJWTAlg)
+	p, err := NewProvider(c)
+	require.NoError(err)
+	defer p.Done()
+
+	require.NoError(p.Close(ctx, WithRevokeRefreshTokens("refresh-1")))
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Empty(authorization)
+	assert.Empty(clientSecret)
+	assert.Equal(ClientAssertionType, assertionType)
+	assert.Equal("client-id", claims.Subject)
+	assert.Equal(jwt.Audience{srv.URL + "/revoke"}, claims.Audience)
+
+	t.Run("invalid-config", func(t *testing.T) {
+		_, priv := TestGenerateKeys(t)
+		signer, err := NewJWTSigner(priv.(crypto.Signer), ES256, "")
+		require.NoError(err)
+		tests := []struct {
+			name   string
+			secret ClientSecret
+			opts   []Option
+		}{
+			{name: "not-hmac", secret: secret, opts: []Option{WithClientSecretJWT(RS256)}},
+			{name: "no-secret", opts: []Option{WithClientSecretJWT(HS256)}},
+			{name: "with-signer", secret: secret, opts: []Option{WithClientSecretJWT(HS256), WithClientAssertionSigner(signer)}},
+		}
+		for _, tt := range tests {
+			_, err := NewConfig("https://op.example.com", "client-id", tt.secret, []Alg{ES256}, nil, tt.opts...)
+			assert.Truef(errors.Is(err, ErrInvalidParameter), "%s: wanted \"%s\" but got \"%s\"", tt.name, ErrInvalidParameter, err)
+		}
+		// HMAC algorithms are never supported for a provider's JWTs
+		_, err = NewConfig("https://op.example.com", "client-id", secret, []Alg{HS256}, nil)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
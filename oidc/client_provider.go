@@ -0,0 +1,124 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithClient returns a lightweight child provider for another client (relying
+// party) registered with the provider's issuer, which is useful for apps that
+// register many clients with one IdP.  The child shares the provider's
+// discovery document, JWKS key set and http client, so creating it doesn't
+// make any http requests, and the child of a provider created using
+// WithLazyDiscovery shares the provider's discovery when it happens.  The
+// child picks up the provider's refreshed discovery documents (see
+// WithDiscoveryTTL and Provider.RefreshMetadata).
+//
+// The child's config is a copy of the provider's current config with the
+// clientID and clientSecret, and its other settings (like the client's
+// ClientAssertionSigner, ClientCertificates and DPoPKey) are inherited;
+// Provider.UpdateConfig can be used to change them.  Like other providers, a
+// child must be released using Provider.Done() or Provider.Close(), which
+// doesn't affect its parent.  The child is done when its parent is done.
+//
+// Supported options: WithAllowedRedirectURLs, WithScopes, WithAudiences
+func (p *Provider) WithClient(clientID string, clientSecret ClientSecret, opt ...Option) (*Provider, error) {
+	const op = "Provider.WithClient"
+	if clientID == "" {
+		return nil, fmt.Errorf("%s: client ID is empty: %w", op, ErrInvalidParameter)
+	}
+	opts := getClientOpts(opt...)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.backgroundCtx == nil || p.backgroundCtx.Err() != nil {
+		return nil, fmt.Errorf("%s: provider is done: %w", op, ErrInvalidParameter)
+	}
+	c := p.config.copy()
+	c.ClientID = clientID
+	c.ClientSecret = clientSecret
+	if opts.withAllowedRedirectURLs != nil {
+		c.AllowedRedirectURLs = opts.withAllowedRedirectURLs
+	}
+	if opts.withScopes != nil {
+		c.Scopes = opts.withScopes
+	}
+	if opts.withAudiences != nil {
+		c.Audiences = opts.withAudiences
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: client config is invalid: %w", op, err)
+	}
+	client, err := p.httpClient()
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create http client: %w", op, err)
+	}
+
+	// the child is done when its parent is done
+	backgroundCtx, cancel := context.WithCancel(p.backgroundCtx)
+	return &Provider{
+		parent:              p,
+		config:              c,
+		provider:            p.provider,
+		jwksURL:             p.jwksURL,
+		discoveredAt:        p.discoveredAt,
+		keySet:              p.keySet,
+		client:              client,
+		sharedTransport:     true,
+		tracer:              p.tracer,
+		operationTimeout:    p.operationTimeout,
+		metrics:             p.metrics,
+		debugWriter:         p.debugWriter,
+		fetchRetry:          p.fetchRetry,
+		responseLimits:      p.responseLimits,
+		claimLimits:         p.claimLimits,
+		rateLimiters:        p.rateLimiters,
+		throttleFunc:        p.throttleFunc,
+		backgroundCtx:       backgroundCtx,
+		backgroundCtxCancel: cancel,
+	}, nil
+}
+
+// discoverFromParent shares the parent's discovery (which happens now when
+// the parent was created using WithLazyDiscovery) with the child provider.
+func (p *Provider) discoverFromParent(ctx context.Context) error {
+	const op = "Provider.discoverFromParent"
+	if _, _, err := p.parent.discovered(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	p.syncParentDiscovery()
+	return nil
+}
+
+// clientOptions is the set of available options for Provider.WithClient
+type clientOptions struct {
+	withAllowedRedirectURLs []string
+	withScopes              []string
+	withAudiences           []string
+}
+
+// clientDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func clientDefaults() clientOptions {
+	return clientOptions{}
+}
+
+// getClientOpts gets the Provider.WithClient defaults and applies the opt
+// overrides passed in
+func getClientOpts(opt ...Option) clientOptions {
+	opts := clientDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithAllowedRedirectURLs provides optional allowed redirect URLs for a child
+// provider, which replace the parent config's AllowedRedirectURLs.
+//
+// Valid for: Provider.WithClient
+func WithAllowedRedirectURLs(urls ...string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok && len(urls) > 0 {
+			o.withAllowedRedirectURLs = urls
+		}
+	}
+}
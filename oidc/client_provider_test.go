@@ -0,0 +1,100 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_WithClient(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	priv, _, alg, _ := tp.SigningKeys()
+	redirect := "https://example.com/callback"
+
+	verify := func(t *testing.T, p *Provider, clientID string) error {
+		t.Helper()
+		oidcRequest, err := NewRequest(time.Minute, redirect)
+		require.NoError(t, err)
+		idToken := TestSignJWT(t, priv, alg, map[string]interface{}{
+			"iss":   tp.Addr(),
+			"aud":   clientID,
+			"sub":   "alice@example.com",
+			"nonce": oidcRequest.Nonce(),
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}, nil)
+		_, err = p.VerifyIDToken(ctx, IDToken(idToken), oidcRequest)
+		return err
+	}
+
+	t.Run("shared", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		parent := testNewProvider(t, "parent-client-id", "parent-secret", redirect, tp)
+		child, err := parent.WithClient("child-client-id", "child-secret",
+			WithAllowedRedirectURLs("https://child.example.com/callback"),
+			WithScopes("email"),
+			WithAudiences("child-client-id"),
+		)
+		require.NoError(err)
+
+		c := child.Config()
+		assert.Equal("child-client-id", c.ClientID)
+		assert.Equal(ClientSecret("child-secret"), c.ClientSecret)
+		assert.Equal([]string{"https://child.example.com/callback"}, c.AllowedRedirectURLs)
+		assert.Equal([]string{"openid", "email"}, c.Scopes)
+		assert.Equal([]string{"child-client-id"}, c.Audiences)
+		assert.Equal(parent.Config().ProviderCA, c.ProviderCA)
+
+		assert.Same(parent.provider, child.provider)
+		assert.Equal(parent.keySet, child.keySet)
+		assert.Same(parent.client, child.client)
+
+		require.NoError(verify(t, child, "child-client-id"))
+		assert.Truef(errors.Is(verify(t, child, "parent-client-id"), ErrInvalidAudience), "wanted \"%s\"", ErrInvalidAudience)
+
+		// the parent isn't affected when its child is done
+		child.Done()
+		require.NoError(verify(t, parent, "parent-client-id"))
+		assert.Equal("parent-client-id", parent.Config().ClientID)
+	})
+	t.Run("lazy-discovery", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tc := testNewConfig(t, "parent-client-id", "parent-secret", redirect, tp)
+		parent, err := NewProvider(tc, WithLazyDiscovery())
+		require.NoError(err)
+		defer parent.Done()
+		child, err := parent.WithClient("child-client-id", "child-secret")
+		require.NoError(err)
+		defer child.Done()
+		assert.Nil(child.provider)
+
+		require.NoError(verify(t, child, "child-client-id"))
+		assert.NotNil(parent.provider)
+		assert.Same(parent.provider, child.provider)
+	})
+	t.Run("parent-done", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tc := testNewConfig(t, "parent-client-id", "parent-secret", redirect, tp)
+		parent, err := NewProvider(tc)
+		require.NoError(err)
+		child, err := parent.WithClient("child-client-id", "child-secret")
+		require.NoError(err)
+		parent.Done()
+		assert.Error(child.backgroundCtx.Err())
+		_, err = parent.WithClient("another-client-id", "")
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		parent := testNewProvider(t, "parent-client-id", "parent-secret", redirect, tp)
+		_, err := parent.WithClient("", "child-secret")
+		assert.Truef(t, errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+		_, err = parent.WithClient("child-client-id", "child-secret", WithAllowedRedirectURLs("%zzz"))
+		assert.Truef(t, errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
@@ -0,0 +1,92 @@
+package clientauth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// BrowserOpener opens URLs in the user's browser.
+type BrowserOpener interface {
+	// OpenURL opens the url in the user's browser.  An error wrapping
+	// oidc.ErrNoBrowser should be returned when there's no browser (for
+	// example: in an ssh session or a container).
+	OpenURL(url string) error
+}
+
+// BrowserOpenerFunc is an adapter which allows a func to be used as a
+// BrowserOpener.
+type BrowserOpenerFunc func(url string) error
+
+// OpenURL implements the BrowserOpener.OpenURL() interface function.
+func (f BrowserOpenerFunc) OpenURL(url string) error {
+	return f(url)
+}
+
+// SystemBrowser returns the default BrowserOpener, which opens URLs in the
+// user's default browser.  It returns an error wrapping oidc.ErrNoBrowser
+// when the user is logged in via ssh, when there's no display on Linux/BSD or
+// when the command for opening a browser isn't installed.
+func SystemBrowser() BrowserOpener {
+	return BrowserOpenerFunc(openURL)
+}
+
+// openURL opens the specified URL in the default browser of the user.
+// source: https://github.com/hashicorp/vault-plugin-auth-jwt
+func openURL(url string) error {
+	const op = "clientauth.openURL"
+	var cmd string
+	var args []string
+
+	wsl := isWSL()
+	if reason := noBrowserReason(runtime.GOOS, wsl, os.Getenv); reason != "" {
+		return fmt.Errorf("%s: %s: %w", op, reason, oidc.ErrNoBrowser)
+	}
+	switch {
+	case "windows" == runtime.GOOS || wsl:
+		cmd = "cmd.exe"
+		args = []string{"/c", "start"}
+		url = strings.Replace(url, "&", "^&", -1)
+	case "darwin" == runtime.GOOS:
+		cmd = "open"
+	default: // "linux", "freebsd", "openbsd", "netbsd"
+		cmd = "xdg-open"
+	}
+	if _, err := exec.LookPath(cmd); err != nil {
+		return fmt.Errorf("%s: %s not found: %w", op, cmd, oidc.ErrNoBrowser)
+	}
+	args = append(args, url)
+	return exec.Command(cmd, args...).Start()
+}
+
+// noBrowserReason returns why there's no browser for the goos and environment,
+// or an empty string when there might be one.
+func noBrowserReason(goos string, wsl bool, getenv func(string) string) string {
+	switch {
+	case getenv("SSH_CONNECTION") != "" || getenv("SSH_TTY") != "":
+		return "logged in via ssh"
+	case goos == "windows" || goos == "darwin" || wsl:
+		return ""
+	case getenv("DISPLAY") == "" && getenv("WAYLAND_DISPLAY") == "":
+		return "no display"
+	}
+	return ""
+}
+
+// isWSL tests if the binary is being run in Windows Subsystem for Linux
+// source: https://github.com/hashicorp/vault-plugin-auth-jwt
+func isWSL() bool {
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		return false
+	}
+	data, err := ioutil.ReadFile("/proc/version")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(data)), "microsoft")
+}
@@ -0,0 +1,34 @@
+package clientauth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoBrowserReason(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		goos string
+		wsl  bool
+		env  map[string]string
+		want string
+	}{
+		{name: "linux-display", goos: "linux", env: map[string]string{"DISPLAY": ":0"}},
+		{name: "linux-wayland", goos: "linux", env: map[string]string{"WAYLAND_DISPLAY": "wayland-0"}},
+		{name: "linux-no-display", goos: "linux", want: "no display"},
+		{name: "wsl", goos: "linux", wsl: true},
+		{name: "darwin", goos: "darwin"},
+		{name: "windows", goos: "windows"},
+		{name: "ssh-connection", goos: "darwin", env: map[string]string{"SSH_CONNECTION": "10.0.0.1 22 10.0.0.2 22"}, want: "logged in via ssh"},
+		{name: "ssh-tty", goos: "linux", env: map[string]string{"DISPLAY": ":0", "SSH_TTY": "/dev/pts/0"}, want: "logged in via ssh"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(k string) string { return tt.env[k] }
+			assert.Equal(t, tt.want, noBrowserReason(tt.goos, tt.wsl, getenv))
+		})
+	}
+}
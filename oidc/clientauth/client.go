@@ -0,0 +1,636 @@
+package clientauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/callback"
+)
+
+// DefaultLoginTimeout is the default amount of time a user has to complete a
+// login via their browser.
+const DefaultLoginTimeout = 2 * time.Minute
+
+// DefaultCallbackPath is the default path of the loopback callback.
+const DefaultCallbackPath = "/callback"
+
+// Client logs a CLI user in via an OIDC provider and keeps them logged in,
+// using the authorization code flow with PKCE and a loopback redirect.
+//
+// The provider's Config.AllowedRedirectURLs must either be empty or include
+// the loopback redirect (for example: http://127.0.0.1/callback).  Loopback
+// redirects are matched in a port-agnostic manner.
+type Client struct {
+	provider *oidc.Provider
+	store    TokenStore
+	key      string
+	opts     clientOptions
+	prompter Prompter
+
+	// refreshMu serializes refreshes, since a rotated refresh_token can only
+	// be used once.
+	refreshMu sync.Mutex
+}
+
+// NewClient creates a new Client which uses the provider for logins and the
+// store to cache tokens.
+//
+// Supported options: WithTokenKey, WithPort, WithCallbackPath,
+// WithLoginTimeout, WithRequestOptions, WithOpenURL, WithBrowserOpener,
+// WithOutput, WithInput, WithPrompter, WithQRCode, WithInvertedQRCode,
+// WithPageOptions
+func NewClient(p *oidc.Provider, s TokenStore, opt ...oidc.Option) (*Client, error) {
+	const op = "clientauth.NewClient"
+	if p == nil {
+		return nil, fmt.Errorf("%s: provider is nil: %w", op, oidc.ErrNilParameter)
+	}
+	if s == nil {
+		return nil, fmt.Errorf("%s: token store is nil: %w", op, oidc.ErrNilParameter)
+	}
+	opts := getClientOpts(opt...)
+	if opts.withLoginTimeout <= 0 {
+		return nil, fmt.Errorf("%s: login timeout not greater than zero: %w", op, oidc.ErrInvalidParameter)
+	}
+	key := opts.withTokenKey
+	if key == "" {
+		k, err := newTokenKey(p.Config(), opts.withRequestOptions)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		key = k.String()
+	}
+	prompter := opts.withPrompter
+	if prompter == nil {
+		prompter = TerminalPrompter(opts.withOutput, opts.withInput)
+	}
+	return &Client{
+		provider: p,
+		store:    s,
+		key:      key,
+		opts:     opts,
+		prompter: prompter,
+	}, nil
+}
+
+// newTokenKey returns the TokenKey for the config's issuer and client ID, and
+// the scopes and audience requested by the request options.
+func newTokenKey(c *oidc.Config, reqOpts []oidc.Option) (TokenKey, error) {
+	const op = "clientauth.newTokenKey"
+	r, err := oidc.NewRequest(DefaultLoginTimeout, "http://127.0.0.1"+DefaultCallbackPath, reqOpts...)
+	if err != nil {
+		return TokenKey{}, fmt.Errorf("%s: invalid request options: %w", op, err)
+	}
+	return TokenKey{
+		Issuer:   c.Issuer,
+		ClientID: c.ClientID,
+		Scopes:   r.Scopes(),
+		Audience: r.AuthAudience(),
+	}, nil
+}
+
+// Key returns the key of the user's cached Token in the TokenStore.  By
+// default, it's the String() of the TokenKey for the provider's issuer and
+// client ID, and the scopes and audience of the WithRequestOptions.
+func (c *Client) Key() string {
+	return c.key
+}
+
+// Token returns a valid Token for the user.  The cached Token is returned when
+// it's still valid.  Otherwise, an expired cached Token is refreshed when it
+// has a refresh_token.  If there's no cached Token (or it can't be refreshed)
+// then the user is logged in via Login.
+func (c *Client) Token(ctx context.Context) (oidc.Token, error) {
+	const op = "Client.Token"
+	t, err := c.store.Read(ctx, c.key)
+	switch {
+	case err == nil && t.Valid():
+		return t, nil
+	case err != nil && !errors.Is(err, oidc.ErrNotFound):
+		return nil, fmt.Errorf("%s: unable to read cached token: %w", op, err)
+	}
+	if t != nil && t.RefreshToken() != "" {
+		refreshed, err := c.Refresh(ctx, t)
+		if err == nil {
+			return refreshed, nil
+		}
+		// the refresh failed (perhaps the refresh_token expired or was
+		// revoked), so the only option left is an interactive login.
+		fmt.Fprintf(c.opts.withOutput, "Unable to refresh cached token, so a new login is required: %s\n", err)
+	}
+	return c.Login(ctx)
+}
+
+// Refresh refreshes the Token using its refresh_token and caches the new
+// Token.  Providers may rotate refresh tokens on every use, so:
+//
+//   - refreshes are serialized, and when the cached Token's refresh_token has
+//     already replaced t's (by another refresh), the cached Token is returned
+//     when it's valid (or refreshed instead of t), so t's refresh_token isn't
+//     reused.
+//
+//   - the new Token is cached as soon as it's issued, replacing the previous
+//     Token (see FileTokenStore for atomic replacement of a file).
+//
+//   - the replaced refresh_token is remembered when the TokenStore is a
+//     RotatedTokenTracker.  When the provider rejects a refresh_token which
+//     was already rotated, reuse is confirmed: the cached Token is deleted so
+//     a new login is required, and an error wrapping oidc.ErrRefreshTokenReused
+//     is returned (see oidc.RefreshTokenReusedError).
+//
+//   - otherwise, when the provider rejects the refresh_token (perhaps it
+//     expired or was revoked), an error wrapping oidc.ErrRefreshTokenRejected
+//     is returned (see oidc.RefreshTokenRejectedError).
+func (c *Client) Refresh(ctx context.Context, t oidc.Token) (oidc.Token, error) {
+	const op = "Client.Refresh"
+	if t == nil {
+		return nil, fmt.Errorf("%s: token is nil: %w", op, oidc.ErrNilParameter)
+	}
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	cached, err := c.store.Read(ctx, c.key)
+	switch {
+	case err != nil && !errors.Is(err, oidc.ErrNotFound):
+		return nil, fmt.Errorf("%s: unable to read cached token: %w", op, err)
+	case err == nil && cached.RefreshToken() != "" && cached.RefreshToken() != t.RefreshToken():
+		if cached.Valid() {
+			return cached, nil
+		}
+		t = cached
+	}
+	refreshed, err := c.provider.RefreshToken(ctx, t)
+	if err != nil {
+		var rejected *oidc.RefreshTokenRejectedError
+		if !errors.As(err, &rejected) {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		tracker, ok := c.store.(RotatedTokenTracker)
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		reused, trackErr := tracker.Rotated(ctx, c.key, t.RefreshToken())
+		switch {
+		case trackErr != nil:
+			return nil, fmt.Errorf("%s: unable to check for rotated refresh_token: %w", op, trackErr)
+		case !reused:
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := c.store.Delete(ctx, c.key); err != nil {
+			return nil, fmt.Errorf("%s: unable to delete rejected token: %w", op, err)
+		}
+		return nil, fmt.Errorf("%s: %w", op, &oidc.RefreshTokenReusedError{Rejected: rejected})
+	}
+	if err := c.store.Write(ctx, c.key, refreshed); err != nil {
+		return nil, fmt.Errorf("%s: unable to cache token: %w", op, err)
+	}
+	if tracker, ok := c.store.(RotatedTokenTracker); ok && refreshed.RefreshToken() != t.RefreshToken() {
+		if err := tracker.MarkRotated(ctx, c.key, t.RefreshToken()); err != nil {
+			return nil, fmt.Errorf("%s: unable to remember rotated refresh_token: %w", op, err)
+		}
+	}
+	return refreshed, nil
+}
+
+// Login logs the user in via their browser, regardless of whether or not
+// there's a valid cached Token, and caches the new Token.
+//
+// Login starts a loopback listener for the callback, creates an
+// oidc.Request which uses PKCE and opens the user's browser to the provider's
+// auth URL.  It will wait for the callback until the login timeout passes or
+// the ctx is done.
+//
+// When the browser can't be opened (for example: in an ssh session or a
+// container), the user is asked to visit the auth URL manually and may paste
+// the URL their browser is redirected to, which completes the login like the
+// loopback callback would (see Prompter).  This allows logging in via a
+// browser on another machine, which can't reach the loopback listener.
+func (c *Client) Login(ctx context.Context) (oidc.Token, error) {
+	const op = "Client.Login"
+	// loginCtx is done when Login returns, which stops reading pasted
+	// redirects.
+	loginCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(c.opts.withPort)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to start loopback listener: %w", op, err)
+	}
+	defer listener.Close()
+	redirectURL := fmt.Sprintf("http://%s%s", listener.Addr().String(), c.opts.withCallbackPath)
+
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	reqOpts := append([]oidc.Option{}, c.opts.withRequestOptions...)
+	reqOpts = append(reqOpts, oidc.WithPKCE(verifier))
+	oidcRequest, err := oidc.NewRequest(c.opts.withLoginTimeout, redirectURL, reqOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create request: %w", op, err)
+	}
+	authURL, err := c.provider.AuthURL(ctx, oidcRequest)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create auth URL: %w", op, err)
+	}
+
+	resultCh := make(chan loginResult, 1)
+	handler, err := callback.AuthCode(ctx, c.provider, &callback.SingleRequestReader{Request: oidcRequest}, successFn(resultCh, callback.SuccessPage(c.opts.withPageOptions...)), errorFn(resultCh, callback.ErrorPage(c.opts.withPageOptions...)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create callback handler: %w", op, err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(c.opts.withCallbackPath, handler)
+	srv := &http.Server{Handler: mux}
+	srvCh := make(chan error, 1)
+	go func() {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			srvCh <- err
+		}
+	}()
+	defer srv.Close()
+
+	c.prompter.LoginURL(authURL)
+	if c.opts.withQRCode {
+		c.printQRCode(authURL)
+	}
+	if err := c.opts.withBrowserOpener.OpenURL(authURL); err != nil {
+		c.prompter.BrowserFailed(authURL, err)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.readRedirects(loginCtx, redirectURL, handler)
+		}()
+		defer func() {
+			cancel()
+			wg.Wait()
+		}()
+	}
+
+	timer := time.NewTimer(c.opts.withLoginTimeout)
+	defer timer.Stop()
+	var t oidc.Token
+	select {
+	case r := <-resultCh:
+		if r.err != nil {
+			return nil, fmt.Errorf("%s: %w", op, r.err)
+		}
+		t = r.token
+	case err := <-srvCh:
+		return nil, fmt.Errorf("%s: loopback listener failed: %w", op, err)
+	case <-timer.C:
+		return nil, fmt.Errorf("%s: timed out waiting for login: %w", op, oidc.ErrExpiredRequest)
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s: %w", op, ctx.Err())
+	}
+	if err := c.store.Write(ctx, c.key, t); err != nil {
+		return nil, fmt.Errorf("%s: unable to cache token: %w", op, err)
+	}
+	return t, nil
+}
+
+// readRedirects reads redirect URLs pasted by the user until a valid one is
+// read, which is then handled by the callback handler.  It stops reading when
+// the prompter returns an error or the ctx is done (the login is done).
+func (c *Client) readRedirects(ctx context.Context, redirectURL string, handler http.HandlerFunc) {
+	for {
+		pasted, err := c.prompter.ReadRedirect(ctx)
+		if err != nil || ctx.Err() != nil {
+			return
+		}
+		req, err := pastedRequest(ctx, redirectURL, pasted)
+		if err != nil {
+			c.prompter.InvalidRedirect(err)
+			continue
+		}
+		handler(&discardResponseWriter{header: http.Header{}}, req)
+		return
+	}
+}
+
+// pastedRequest returns a callback request for the redirectURL with the query
+// of the pasted redirect URL (or the pasted query string).
+func pastedRequest(ctx context.Context, redirectURL, pasted string) (*http.Request, error) {
+	const op = "clientauth.pastedRequest"
+	query := strings.TrimSpace(pasted)
+	if i := strings.Index(query, "?"); i >= 0 {
+		query = query[i+1:]
+	}
+	if i := strings.Index(query, "#"); i >= 0 {
+		query = query[:i]
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to parse query: %s: %w", op, err, oidc.ErrInvalidParameter)
+	}
+	if params.Get("state") == "" || (params.Get("code") == "" && params.Get("error") == "") {
+		return nil, fmt.Errorf("%s: missing state and code or error: %w", op, oidc.ErrInvalidParameter)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, redirectURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return req, nil
+}
+
+// discardResponseWriter is an http.ResponseWriter for handling a pasted
+// redirect, whose response isn't seen by anyone.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+// DeviceLogin logs the user in via another device (like their phone) using
+// the device authorization grant, regardless of whether or not there's a valid
+// cached Token, and caches the new Token.  It's an alternative to Login for
+// terminals without a browser (like an ssh session).
+//
+// DeviceLogin tells the user the provider's verification URI and the user
+// code via the Prompter (and writes the URI as a QR code to the output when
+// WithQRCode is used), and then polls the
+// provider until the user completes the login, the device code expires or
+// the ctx is done.  The scopes of the WithRequestOptions are requested.
+func (c *Client) DeviceLogin(ctx context.Context) (oidc.Token, error) {
+	const op = "Client.DeviceLogin"
+	d, err := c.provider.DeviceAuthorization(ctx, c.opts.withRequestOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	c.prompter.DeviceCode(d.LoginURI(), d.UserCode)
+	if c.opts.withQRCode {
+		c.printQRCode(d.LoginURI())
+	}
+
+	t, err := c.provider.PollDeviceToken(ctx, d)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := c.store.Write(ctx, c.key, t); err != nil {
+		return nil, fmt.Errorf("%s: unable to cache token: %w", op, err)
+	}
+	return t, nil
+}
+
+// printQRCode writes the url as a QR code to the output.  A url that's too
+// long for a QR code is skipped, since it's also written as text.
+func (c *Client) printQRCode(url string) {
+	var opts []oidc.Option
+	if c.opts.withInvertedQRCode {
+		opts = append(opts, WithInvertedQRCode())
+	}
+	code, err := QRCodeText(url, opts...)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(c.opts.withOutput, "%s\n", code)
+}
+
+// Logout deletes the user's cached Token.
+func (c *Client) Logout(ctx context.Context) error {
+	const op = "Client.Logout"
+	if err := c.store.Delete(ctx, c.key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// loginResult is the result of the callback for a login attempt
+type loginResult struct {
+	token oidc.Token
+	err   error
+}
+
+// successFn returns a callback.SuccessResponseFunc which writes the page and
+// sends the token to the resultCh.
+func successFn(resultCh chan<- loginResult, page callback.SuccessResponseFunc) callback.SuccessResponseFunc {
+	return func(state string, t oidc.Token, w http.ResponseWriter, req *http.Request) {
+		page(state, t, w, req)
+		select {
+		case resultCh <- loginResult{token: t}:
+		default: // a result was already sent
+		}
+	}
+}
+
+// errorFn returns a callback.ErrorResponseFunc which writes the page and sends
+// the error to the resultCh.
+func errorFn(resultCh chan<- loginResult, page callback.ErrorResponseFunc) callback.ErrorResponseFunc {
+	return func(state string, r *callback.AuthenErrorResponse, e error, w http.ResponseWriter, req *http.Request) {
+		var err error
+		switch {
+		case e != nil:
+			err = e
+		case r != nil:
+			err = fmt.Errorf("provider error %s (%s): %w", r.Error, r.Description, oidc.ErrLoginFailed)
+		default:
+			err = fmt.Errorf("unknown error from callback: %w", oidc.ErrLoginFailed)
+		}
+		page(state, r, e, w, req)
+		select {
+		case resultCh <- loginResult{err: err}:
+		default: // a result was already sent
+		}
+	}
+}
+
+// clientOptions is the set of available options for Client functions
+type clientOptions struct {
+	withTokenKey       string
+	withPort           int
+	withCallbackPath   string
+	withLoginTimeout   time.Duration
+	withRequestOptions []oidc.Option
+	withBrowserOpener  BrowserOpener
+	withOutput         io.Writer
+	withInput          io.Reader
+	withPrompter       Prompter
+	withQRCode         bool
+	withInvertedQRCode bool
+	withPageOptions    []oidc.Option
+}
+
+// clientDefaults is a handy way to get the defaults at runtime and during unit
+// tests.
+func clientDefaults() clientOptions {
+	return clientOptions{
+		withCallbackPath:  DefaultCallbackPath,
+		withLoginTimeout:  DefaultLoginTimeout,
+		withBrowserOpener: SystemBrowser(),
+		withOutput:        os.Stderr,
+		withInput:         os.Stdin,
+	}
+}
+
+// getClientOpts gets the client defaults and applies the opt overrides passed
+// in
+func getClientOpts(opt ...oidc.Option) clientOptions {
+	opts := clientDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithTokenKey provides an optional key for caching the user's Token in the
+// TokenStore.  The default key is the String() of the TokenKey for the
+// provider's issuer and client ID, and the scopes and audience of the
+// WithRequestOptions, so Clients requesting different scopes (or audiences)
+// don't share a cached Token.
+//
+// Valid for: Client
+func WithTokenKey(key string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok {
+			o.withTokenKey = key
+		}
+	}
+}
+
+// WithPort provides an optional port for the loopback listener.  The default
+// is zero, which means a random available port is used.
+//
+// Valid for: Client
+func WithPort(port int) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok {
+			o.withPort = port
+		}
+	}
+}
+
+// WithCallbackPath provides an optional path for the loopback callback.  The
+// default is DefaultCallbackPath.
+//
+// Valid for: Client
+func WithCallbackPath(path string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok && path != "" {
+			o.withCallbackPath = path
+		}
+	}
+}
+
+// WithLoginTimeout provides an optional amount of time a user has to complete
+// a login.  The default is DefaultLoginTimeout.
+//
+// Valid for: Client
+func WithLoginTimeout(d time.Duration) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok {
+			o.withLoginTimeout = d
+		}
+	}
+}
+
+// WithRequestOptions provides optional oidc.Request options (for example:
+// oidc.WithScopes) used when creating the oidc.Request for a login.
+// oidc.WithPKCE is always used by a Client.
+//
+// Valid for: Client
+func WithRequestOptions(opt ...oidc.Option) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok {
+			o.withRequestOptions = append(o.withRequestOptions, opt...)
+		}
+	}
+}
+
+// WithOpenURL provides an optional func for opening the auth URL in the user's
+// browser.  The default opens the user's default browser.  It's equivalent to
+// WithBrowserOpener(BrowserOpenerFunc(fn)).
+//
+// Valid for: Client
+func WithOpenURL(fn func(url string) error) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok && fn != nil {
+			o.withBrowserOpener = BrowserOpenerFunc(fn)
+		}
+	}
+}
+
+// WithBrowserOpener provides an optional BrowserOpener for opening the auth
+// URL in the user's browser.  The default is SystemBrowser().
+//
+// Valid for: Client
+func WithBrowserOpener(b BrowserOpener) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok && b != nil {
+			o.withBrowserOpener = b
+		}
+	}
+}
+
+// WithOutput provides an optional writer for user-facing instructions.  The
+// default is os.Stderr.
+//
+// Valid for: Client
+func WithOutput(w io.Writer) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok && w != nil {
+			o.withOutput = w
+		}
+	}
+}
+
+// WithInput provides an optional reader for the redirect URL pasted by the
+// user when their browser can't be opened.  The default is os.Stdin.  It's
+// ignored when WithPrompter is used.
+//
+// Valid for: Client
+func WithInput(r io.Reader) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok && r != nil {
+			o.withInput = r
+		}
+	}
+}
+
+// WithPrompter provides an optional Prompter for user-facing instructions and
+// reading pasted redirect URLs.  The default is a TerminalPrompter using the
+// WithOutput writer and the WithInput reader.
+//
+// Valid for: Client
+func WithPrompter(p Prompter) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok && p != nil {
+			o.withPrompter = p
+		}
+	}
+}
+
+// WithPageOptions provides optional options for the success and error pages
+// shown in the user's browser after a login (for example:
+// callback.WithPageTranslations).  The pages are translated using the
+// browser's Accept-Language by default (see callback.SuccessPage).
+//
+// Valid for: Client
+func WithPageOptions(opt ...oidc.Option) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok {
+			o.withPageOptions = append(o.withPageOptions, opt...)
+		}
+	}
+}
+
+// WithQRCode provides an optional flag to write the auth URL (or the device
+// authorization's verification URI) to the output as a QR code, so the user
+// can complete the login by scanning it with their phone.
+//
+// Valid for: Client
+func WithQRCode() oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*clientOptions); ok {
+			o.withQRCode = true
+		}
+	}
+}
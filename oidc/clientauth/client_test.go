@@ -0,0 +1,531 @@
+package clientauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestNewClient(t *testing.T) {
+	t.Parallel()
+	tp := oidc.StartTestProvider(t)
+	p, _ := testNewProvider(t, tp)
+	s := NewMemoryTokenStore()
+
+	tests := []struct {
+		name      string
+		p         *oidc.Provider
+		s         TokenStore
+		opts      []oidc.Option
+		wantKey   string
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name:    "valid",
+			p:       p,
+			s:       s,
+			wantKey: tp.Addr() + "|test-client-id",
+		},
+		{
+			name:    "with-scopes-and-audience",
+			p:       p,
+			s:       s,
+			opts:    []oidc.Option{WithRequestOptions(oidc.WithScopes("profile", "email"), oidc.WithAuthAudience("api"))},
+			wantKey: tp.Addr() + "|test-client-id|email profile|api",
+		},
+		{
+			name:    "with-token-key",
+			p:       p,
+			s:       s,
+			opts:    []oidc.Option{WithTokenKey("alice")},
+			wantKey: "alice",
+		},
+		{
+			name:      "nil-provider",
+			s:         s,
+			wantErr:   true,
+			wantIsErr: oidc.ErrNilParameter,
+		},
+		{
+			name:      "nil-store",
+			p:         p,
+			wantErr:   true,
+			wantIsErr: oidc.ErrNilParameter,
+		},
+		{
+			name:      "invalid-timeout",
+			p:         p,
+			s:         s,
+			opts:      []oidc.Option{WithLoginTimeout(-1)},
+			wantErr:   true,
+			wantIsErr: oidc.ErrInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := NewClient(tt.p, tt.s, tt.opts...)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.wantKey, got.key)
+		})
+	}
+}
+
+func TestClient_Token(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := oidc.StartTestProvider(t)
+	tp.SetExpectedAuthCode("valid-code")
+	tp.SetExpectedRefreshToken("valid-refresh-token")
+	p, port := testNewProvider(t, tp)
+
+	t.Run("login-and-cache", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		var out bytes.Buffer
+		s := NewMemoryTokenStore()
+		c, err := NewClient(p, s, WithPort(port), WithOpenURL(testBrowser(t, tp)), WithOutput(&out))
+		require.NoError(err)
+
+		tk, err := c.Token(ctx)
+		require.NoError(err)
+		assert.NotEmpty(tk.IDToken())
+		assert.Equal(oidc.RefreshToken("valid-refresh-token"), tk.RefreshToken())
+		assert.Contains(out.String(), tp.Addr())
+
+		cached, err := s.Read(ctx, c.key)
+		require.NoError(err)
+		assert.Equal(tk.IDToken(), cached.IDToken())
+
+		// a valid cached token is returned without another login
+		c.opts.withBrowserOpener = BrowserOpenerFunc(func(string) error {
+			assert.FailNow("unexpected login")
+			return nil
+		})
+		got, err := c.Token(ctx)
+		require.NoError(err)
+		assert.Equal(tk.IDToken(), got.IDToken())
+
+		require.NoError(c.Logout(ctx))
+		_, err = s.Read(ctx, c.key)
+		assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+	})
+	t.Run("refresh-expired", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		s := NewMemoryTokenStore()
+		c, err := NewClient(p, s, WithOpenURL(func(string) error {
+			assert.FailNow("unexpected login")
+			return nil
+		}))
+		require.NoError(err)
+		expired, err := oidc.NewToken(testPriorIDToken(t, tp), &oauth2.Token{
+			AccessToken:  "prior-access-token",
+			RefreshToken: "valid-refresh-token",
+			Expiry:       time.Now().Add(-time.Minute),
+		})
+		require.NoError(err)
+		require.NoError(s.Write(ctx, c.key, expired))
+
+		got, err := c.Token(ctx)
+		require.NoError(err)
+		assert.True(got.Valid())
+		assert.NotEqual(expired.IDToken(), got.IDToken())
+		cached, err := s.Read(ctx, c.key)
+		require.NoError(err)
+		assert.Equal(got.IDToken(), cached.IDToken())
+	})
+	t.Run("refresh-fails-login", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		var out bytes.Buffer
+		s := NewMemoryTokenStore()
+		c, err := NewClient(p, s, WithPort(port), WithOpenURL(testBrowser(t, tp)), WithOutput(&out))
+		require.NoError(err)
+		expired, err := oidc.NewToken(testPriorIDToken(t, tp), &oauth2.Token{
+			AccessToken:  "prior-access-token",
+			RefreshToken: "revoked-refresh-token",
+			Expiry:       time.Now().Add(-time.Minute),
+		})
+		require.NoError(err)
+		require.NoError(s.Write(ctx, c.key, expired))
+
+		got, err := c.Token(ctx)
+		require.NoError(err)
+		assert.Equal(oidc.RefreshToken("valid-refresh-token"), got.RefreshToken())
+		assert.Contains(out.String(), "Unable to refresh cached token")
+	})
+	t.Run("provider-error", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp.SetExpectedAuthCode("")
+		defer tp.SetExpectedAuthCode("valid-code")
+		c, err := NewClient(p, NewMemoryTokenStore(), WithPort(port), WithOpenURL(testBrowser(t, tp)), WithOutput(&bytes.Buffer{}))
+		require.NoError(err)
+		got, err := c.Login(ctx)
+		require.Error(err)
+		assert.Truef(errors.Is(err, oidc.ErrLoginFailed), "wanted \"%s\" but got \"%s\"", oidc.ErrLoginFailed, err)
+		assert.Nil(got)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewClient(p, NewMemoryTokenStore(), WithPort(port), WithLoginTimeout(100*time.Millisecond), WithOpenURL(func(string) error { return nil }), WithOutput(&bytes.Buffer{}))
+		require.NoError(err)
+		got, err := c.Login(ctx)
+		require.Error(err)
+		assert.Truef(errors.Is(err, oidc.ErrExpiredRequest), "wanted \"%s\" but got \"%s\"", oidc.ErrExpiredRequest, err)
+		assert.Nil(got)
+	})
+}
+
+func TestClient_Refresh(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := oidc.StartTestProvider(t)
+	tp.SetExpectedRefreshToken("first-refresh-token")
+	tp.SetRotateRefreshTokens(true)
+	p, _ := testNewProvider(t, tp)
+	expired := func(t *testing.T, refreshToken string) oidc.Token {
+		t.Helper()
+		tk, err := oidc.NewToken(testPriorIDToken(t, tp), &oauth2.Token{
+			AccessToken:  "prior-access-token",
+			RefreshToken: refreshToken,
+			Expiry:       time.Now().Add(-time.Minute),
+		})
+		require.NoError(t, err)
+		return tk
+	}
+
+	assert, require := assert.New(t), require.New(t)
+	s := NewMemoryTokenStore()
+	c, err := NewClient(p, s)
+	require.NoError(err)
+	first := expired(t, "first-refresh-token")
+	require.NoError(s.Write(ctx, c.key, first))
+
+	// the newest token is cached
+	rotated, err := c.Refresh(ctx, first)
+	require.NoError(err)
+	assert.Equal(oidc.RefreshToken(tp.ExpectedRefreshToken()), rotated.RefreshToken())
+	assert.NotEqual(first.RefreshToken(), rotated.RefreshToken())
+	cached, err := s.Read(ctx, c.key)
+	require.NoError(err)
+	assert.Equal(rotated.RefreshToken(), cached.RefreshToken())
+
+	// refreshing the stale token again doesn't reuse its refresh_token, since
+	// the cached token is still valid
+	got, err := c.Refresh(ctx, first)
+	require.NoError(err)
+	assert.Equal(rotated.RefreshToken(), got.RefreshToken())
+
+	// the provider rejects a refresh_token which was never rotated, which
+	// isn't reuse, so the cached token is kept
+	unknown := expired(t, "unknown-refresh-token")
+	require.NoError(s.Write(ctx, c.key, unknown))
+	_, err = c.Refresh(ctx, unknown)
+	require.Error(err)
+	assert.Truef(errors.Is(err, oidc.ErrRefreshTokenRejected), "wanted \"%s\" but got \"%s\"", oidc.ErrRefreshTokenRejected, err)
+	assert.False(errors.Is(err, oidc.ErrRefreshTokenReused))
+	_, err = s.Read(ctx, c.key)
+	require.NoError(err)
+
+	// the provider rejects a reused (rotated) refresh_token, which deletes the
+	// cached token
+	require.NoError(s.Write(ctx, c.key, expired(t, "first-refresh-token")))
+	_, err = c.Refresh(ctx, expired(t, "first-refresh-token"))
+	require.Error(err)
+	assert.Truef(errors.Is(err, oidc.ErrRefreshTokenReused), "wanted \"%s\" but got \"%s\"", oidc.ErrRefreshTokenReused, err)
+	assert.Truef(errors.Is(err, oidc.ErrRefreshTokenRejected), "wanted \"%s\" but got \"%s\"", oidc.ErrRefreshTokenRejected, err)
+	var reusedErr *oidc.RefreshTokenReusedError
+	require.True(errors.As(err, &reusedErr))
+	assert.Equal("invalid_grant", reusedErr.Rejected.OAuthError.Code)
+	_, err = s.Read(ctx, c.key)
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+	_, err = c.Refresh(ctx, nil)
+	assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+}
+
+func TestClient_Login_PastedRedirect(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := oidc.StartTestProvider(t)
+	tp.SetExpectedAuthCode("valid-code")
+	p, port := testNewProvider(t, tp)
+
+	// noRedirects is the test provider's client, without following its
+	// redirect to the unreachable loopback listener.
+	noRedirects := *tp.HTTPClient()
+	noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	tests := []struct {
+		name    string
+		paste   func(location string) string
+		wantErr error
+	}{
+		{
+			name:  "url",
+			paste: func(location string) string { return "not-a-redirect\n" + location + "\n" },
+		},
+		{
+			name: "query",
+			paste: func(location string) string {
+				u, _ := url.Parse(location)
+				return "?" + u.RawQuery + "\n"
+			},
+		},
+		{
+			name: "provider-error",
+			paste: func(location string) string {
+				u, _ := url.Parse(location)
+				return "http://127.0.0.1/callback?error=access_denied&state=" + u.Query().Get("state") + "\n"
+			},
+			wantErr: oidc.ErrLoginFailed,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			var out bytes.Buffer
+			in, pasted := io.Pipe()
+			t.Cleanup(func() { _ = pasted.Close() })
+			opener := BrowserOpenerFunc(func(authURL string) error {
+				u, err := url.Parse(authURL)
+				require.NoError(err)
+				tp.SetExpectedAuthNonce(u.Query().Get("nonce"))
+				go func() {
+					resp, err := noRedirects.Get(authURL)
+					if err != nil {
+						return
+					}
+					resp.Body.Close()
+					_, _ = io.WriteString(pasted, tt.paste(resp.Header.Get("Location")))
+				}()
+				return fmt.Errorf("no display: %w", oidc.ErrNoBrowser)
+			})
+			c, err := NewClient(p, NewMemoryTokenStore(), WithPort(port), WithBrowserOpener(opener), WithOutput(&out), WithInput(in))
+			require.NoError(err)
+			tk, err := c.Login(ctx)
+			assert.Contains(out.String(), oidc.ErrNoBrowser.Error())
+			if tt.wantErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantErr), "wanted \"%s\" but got \"%s\"", tt.wantErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.NotEmpty(tk.IDToken())
+			if tt.name == "url" {
+				assert.Contains(out.String(), "Invalid redirect URL")
+			}
+		})
+	}
+}
+
+// readingPrompter is a Prompter which counts the calls to ReadRedirect which
+// haven't returned, and returns once the ctx is done.
+type readingPrompter struct {
+	Prompter
+	reading int32
+}
+
+func (p *readingPrompter) ReadRedirect(ctx context.Context) (string, error) {
+	atomic.AddInt32(&p.reading, 1)
+	defer atomic.AddInt32(&p.reading, -1)
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestClient_Login_StopsReadingRedirects(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := oidc.StartTestProvider(t)
+	p, port := testNewProvider(t, tp)
+	noBrowser := BrowserOpenerFunc(func(string) error { return oidc.ErrNoBrowser })
+
+	t.Run("timeout", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		prompter := &readingPrompter{Prompter: TerminalPrompter(&bytes.Buffer{}, &bytes.Buffer{})}
+		c, err := NewClient(p, NewMemoryTokenStore(), WithPort(port), WithLoginTimeout(100*time.Millisecond), WithBrowserOpener(noBrowser), WithPrompter(prompter))
+		require.NoError(err)
+		_, err = c.Login(ctx)
+		assert.Truef(errors.Is(err, oidc.ErrExpiredRequest), "wanted \"%s\" but got \"%s\"", oidc.ErrExpiredRequest, err)
+		assert.Equal(int32(0), atomic.LoadInt32(&prompter.reading))
+	})
+	t.Run("canceled", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		prompter := &readingPrompter{Prompter: TerminalPrompter(&bytes.Buffer{}, &bytes.Buffer{})}
+		c, err := NewClient(p, NewMemoryTokenStore(), WithPort(port), WithBrowserOpener(noBrowser), WithPrompter(prompter))
+		require.NoError(err)
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err = c.Login(ctx)
+		assert.Truef(errors.Is(err, context.DeadlineExceeded), "wanted \"%s\" but got \"%s\"", context.DeadlineExceeded, err)
+		assert.Equal(int32(0), atomic.LoadInt32(&prompter.reading))
+	})
+}
+
+func TestClient_DeviceLogin(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pub, priv := oidc.TestGenerateKeys(t)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/device":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"device_code":               "device-code",
+				"user_code":                 "WDJB-MJHT",
+				"verification_uri":          srv.URL + "/activate",
+				"verification_uri_complete": srv.URL + "/activate?user_code=WDJB-MJHT",
+				"expires_in":                60,
+				"interval":                  1,
+			})
+		case "/token":
+			if req.FormValue("device_code") != "device-code" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"access_denied"}`))
+				return
+			}
+			now := time.Now()
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "access-token",
+				"token_type":   "Bearer",
+				"expires_in":   60,
+				"id_token": oidc.TestSignJWT(t, priv, oidc.ES256, map[string]interface{}{
+					"iss": srv.URL,
+					"aud": []string{"client-id"},
+					"sub": "alice@example.com",
+					"exp": now.Add(time.Minute).Unix(),
+					"iat": now.Unix(),
+				}, nil),
+			})
+		case "/jwks":
+			_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: pub, Algorithm: string(oidc.ES256), Use: "sig"}}})
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"issuer":                        srv.URL,
+				"jwks_uri":                      srv.URL + "/jwks",
+				"token_endpoint":                srv.URL + "/token",
+				"device_authorization_endpoint": srv.URL + "/device",
+			})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	config, err := oidc.NewConfig(srv.URL, "client-id", "client-secret", []oidc.Alg{oidc.ES256}, []string{"http://127.0.0.1/callback"})
+	require.NoError(t, err)
+	p, err := oidc.NewProvider(config)
+	require.NoError(t, err)
+	t.Cleanup(p.Done)
+
+	t.Run("valid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		var out bytes.Buffer
+		s := NewMemoryTokenStore()
+		c, err := NewClient(p, s, WithOutput(&out), WithQRCode())
+		require.NoError(err)
+		tk, err := c.DeviceLogin(ctx)
+		require.NoError(err)
+		assert.Equal(oidc.AccessToken("access-token"), tk.AccessToken())
+		assert.Contains(out.String(), srv.URL+"/activate?user_code=WDJB-MJHT")
+		assert.Contains(out.String(), "WDJB-MJHT")
+		assert.Contains(out.String(), "█")
+
+		cached, err := s.Read(ctx, c.key)
+		require.NoError(err)
+		assert.Equal(tk.IDToken(), cached.IDToken())
+	})
+	t.Run("canceled", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		var out bytes.Buffer
+		c, err := NewClient(p, NewMemoryTokenStore(), WithOutput(&out))
+		require.NoError(err)
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = c.DeviceLogin(ctx)
+		require.Error(err)
+		assert.Truef(errors.Is(err, context.Canceled), "wanted \"%s\" but got \"%s\"", context.Canceled, err)
+	})
+}
+
+// testPriorIDToken returns an id_token issued by the tp for the test client,
+// which a refreshed id_token must match.
+func testPriorIDToken(t *testing.T, tp *oidc.TestProvider) oidc.IDToken {
+	t.Helper()
+	priv, _, alg, _ := tp.SigningKeys()
+	return oidc.IDToken(oidc.TestSignJWT(t, priv, alg, map[string]interface{}{
+		"iss": tp.Addr(),
+		"sub": "alice@example.com",
+		"aud": "test-client-id",
+	}, nil))
+}
+
+// testNewProvider creates a new Provider for the TestProvider which allows a
+// loopback redirect on a free port, which is also returned.
+func testNewProvider(t *testing.T, tp *oidc.TestProvider) (*oidc.Provider, int) {
+	t.Helper()
+	require := require.New(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(l.Close())
+
+	tp.SetClientCreds("test-client-id", "test-client-secret")
+	tp.SetAllowedRedirectURIs([]string{(&url.URL{Scheme: "http", Host: l.Addr().String(), Path: DefaultCallbackPath}).String()})
+	_, _, alg, _ := tp.SigningKeys()
+	c, err := oidc.NewConfig(
+		tp.Addr(),
+		"test-client-id",
+		"test-client-secret",
+		[]oidc.Alg{alg},
+		[]string{"http://127.0.0.1/callback"},
+		oidc.WithProviderCA(tp.CACert()),
+	)
+	require.NoError(err)
+	p, err := oidc.NewProvider(c)
+	require.NoError(err)
+	t.Cleanup(p.Done)
+	return p, port
+}
+
+// testBrowser returns a func which acts like a user's browser by following
+// the auth URL's redirects to the loopback callback.
+func testBrowser(t *testing.T, tp *oidc.TestProvider) func(string) error {
+	return func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		tp.SetExpectedAuthNonce(u.Query().Get("nonce"))
+		go func() {
+			resp, err := tp.HTTPClient().Get(authURL)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		return nil
+	}
+}
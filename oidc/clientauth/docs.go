@@ -0,0 +1,31 @@
+/*
+clientauth is a package that provides a batteries-included way to log a CLI
+user in via an OIDC provider and keep them logged in.
+
+A Client combines the pieces needed for a native app's login:
+
+* a loopback http listener for the OIDC callback (see:
+https://tools.ietf.org/html/rfc8252#section-7.3)
+
+* the authorization code flow with PKCE and a unique state/nonce for every
+login attempt
+
+* launching the user's browser to the provider's auth URL (see
+BrowserOpener), and falling back to the user pasting the URL their browser is
+redirected to when there's no browser (like an ssh session or a container)
+
+* user-facing instructions, which can be customized using a Prompter
+
+* a TokenStore for caching the user's tokens between invocations, keyed by
+the issuer, client ID, scopes and audience they were requested with (see
+TokenKey and FindToken)
+
+* refreshing the cached tokens, when the provider issued a refresh_token,
+including providers which rotate refresh tokens on every use
+
+Terminals without a browser (like an ssh session) can use Client.DeviceLogin,
+which uses the device authorization grant so the user can log in via another
+device.  The auth URL (or verification URI) can be rendered as a scannable QR
+code using WithQRCode, QRCodeText or QRCodePNG.
+*/
+package clientauth
@@ -0,0 +1,136 @@
+package clientauth
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Prompter presents user-facing instructions for a login, and reads the
+// user's response when it must be pasted manually because their browser
+// couldn't be opened.
+type Prompter interface {
+	// LoginURL tells the user to complete the login via the url, before their
+	// browser is opened.
+	LoginURL(url string)
+
+	// BrowserFailed tells the user that their browser couldn't be opened, so
+	// they must visit the url manually (perhaps on another device) and then
+	// paste the URL their browser is redirected to once they're logged in.
+	BrowserFailed(url string, err error)
+
+	// ReadRedirect reads the redirect URL (or just its query string) pasted
+	// by the user.  It's called concurrently with the loopback listener, so
+	// the login completes with whichever responds first, and it must return
+	// the ctx's error once the ctx is done (Login waits for it to return).
+	// An error stops reading pasted responses, but the login keeps waiting
+	// for the loopback callback.
+	ReadRedirect(ctx context.Context) (string, error)
+
+	// InvalidRedirect tells the user that their pasted response is invalid,
+	// before the next one is read.
+	InvalidRedirect(err error)
+
+	// DeviceCode tells the user to visit the uri on another device and enter
+	// the userCode.
+	DeviceCode(uri, userCode string)
+}
+
+// TerminalPrompter returns the default Prompter, which writes instructions to
+// the out writer and reads pasted responses from the in reader one line at a
+// time.
+//
+// Reads from the in reader can't be interrupted, so the lines are read by a
+// single goroutine (started by the first ReadRedirect) which keeps reading
+// for the life of the process, or until the in reader returns an error.  The
+// lines read after a ReadRedirect's ctx is done (e.g. typed after the login
+// completed via the loopback listener) are stale, so they're discarded by the
+// next ReadRedirect rather than being mistaken for the response to a later
+// login.
+func TerminalPrompter(out io.Writer, in io.Reader) Prompter {
+	return &terminalPrompter{out: out, in: bufio.NewReader(in), lines: make(chan string, 1)}
+}
+
+// terminalPrompter is the default Prompter.
+type terminalPrompter struct {
+	out io.Writer
+
+	once  sync.Once
+	in    *bufio.Reader
+	lines chan string
+	err   error // set by readLines before lines is closed
+
+	// stale is set when a ReadRedirect returns because its ctx is done, so
+	// the next one discards the lines read in the meantime.  It's only used
+	// by ReadRedirect, which isn't called concurrently.
+	stale bool
+}
+
+// LoginURL implements the Prompter.LoginURL() interface function.
+func (p *terminalPrompter) LoginURL(url string) {
+	fmt.Fprintf(p.out, "Complete the login via your OIDC provider. Launching browser to:\n\n    %s\n\n", url)
+}
+
+// BrowserFailed implements the Prompter.BrowserFailed() interface function.
+func (p *terminalPrompter) BrowserFailed(url string, err error) {
+	fmt.Fprintf(p.out, "Error attempting to automatically open browser: %s\nPlease visit the URL above manually.\n", err)
+	fmt.Fprintf(p.out, "If your browser is on another machine, paste the URL it's redirected to after logging in (the page may fail to load):\n")
+}
+
+// ReadRedirect implements the Prompter.ReadRedirect() interface function.
+func (p *terminalPrompter) ReadRedirect(ctx context.Context) (string, error) {
+	p.once.Do(func() { go p.readLines() })
+	// discard the stale lines read since the last ReadRedirect's ctx was done
+	for drained := !p.stale; !drained; {
+		select {
+		case _, ok := <-p.lines:
+			if !ok {
+				return "", p.err
+			}
+		default:
+			drained = true
+		}
+	}
+	p.stale = false
+	select {
+	case line, ok := <-p.lines:
+		if !ok {
+			return "", p.err
+		}
+		return line, nil
+	case <-ctx.Done():
+		p.stale = true
+		return "", ctx.Err()
+	}
+}
+
+// readLines reads lines from the in reader and sends them to ReadRedirect,
+// until the in reader returns an error.  The error is then returned by every
+// ReadRedirect.
+func (p *terminalPrompter) readLines() {
+	for {
+		line, err := p.in.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if err != nil && (err != io.EOF || line == "") {
+			p.err = err
+			close(p.lines)
+			return
+		}
+		p.lines <- line
+	}
+}
+
+// InvalidRedirect implements the Prompter.InvalidRedirect() interface
+// function.
+func (p *terminalPrompter) InvalidRedirect(err error) {
+	fmt.Fprintf(p.out, "Invalid redirect URL: %s\nPlease paste the complete URL your browser was redirected to:\n", err)
+}
+
+// DeviceCode implements the Prompter.DeviceCode() interface function.
+func (p *terminalPrompter) DeviceCode(uri, userCode string) {
+	fmt.Fprintf(p.out, "Complete the login via your OIDC provider. On another device, visit:\n\n    %s\n\n", uri)
+	fmt.Fprintf(p.out, "and enter the code: %s\n\n", userCode)
+}
@@ -0,0 +1,52 @@
+package clientauth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerminalPrompter_ReadRedirect(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	in, w := io.Pipe()
+	p := TerminalPrompter(&bytes.Buffer{}, in)
+
+	// a read which is blocked waiting for input returns when the ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := p.ReadRedirect(ctx)
+	require.Error(err)
+	assert.Truef(errors.Is(err, context.DeadlineExceeded), "wanted \"%s\" but got \"%s\"", context.DeadlineExceeded, err)
+
+	// a line read after a ReadRedirect's ctx is done is stale and discarded
+	_, err = io.WriteString(w, "stale\n")
+	require.NoError(err)
+	tp := p.(*terminalPrompter)
+	require.Eventually(func() bool { return len(tp.lines) == 1 }, time.Second, time.Millisecond)
+
+	// input is returned by the next reads (the write is delayed until the
+	// stale line has been discarded)
+	time.AfterFunc(50*time.Millisecond, func() {
+		_, _ = io.WriteString(w, "  first  \nlast")
+		_ = w.Close()
+	})
+	got, err := p.ReadRedirect(context.Background())
+	require.NoError(err)
+	assert.Equal("first", got)
+	got, err = p.ReadRedirect(context.Background())
+	require.NoError(err)
+	assert.Equal("last", got)
+
+	// the reader's error is returned by every read
+	for i := 0; i < 2; i++ {
+		_, err = p.ReadRedirect(context.Background())
+		assert.Truef(errors.Is(err, io.EOF), "wanted \"%s\" but got \"%s\"", io.EOF, err)
+	}
+}
@@ -0,0 +1,139 @@
+package clientauth
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/internal/qrcode"
+)
+
+// DefaultQRCodeScale is the default number of pixels per QR code module for
+// QRCodePNG.
+const DefaultQRCodeScale = 8
+
+// qrQuietZone is the number of light modules around a QR code, which scanners
+// need to find the code.
+const qrQuietZone = 4
+
+// QRCodeText renders the data (like an auth URL or a device authorization's
+// LoginURI) as a QR code for a terminal, using unicode half blocks so every
+// line of text is two rows of the code.  The light modules are drawn, so by
+// default the code scans on terminals with a dark background (see
+// WithInvertedQRCode).
+//
+// Supported options: WithInvertedQRCode
+func QRCodeText(data string, opt ...oidc.Option) (string, error) {
+	const op = "clientauth.QRCodeText"
+	c, err := qrcode.Encode([]byte(data), qrcode.Medium)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s: %w", op, err, oidc.ErrInvalidParameter)
+	}
+	opts := getQRCodeOpts(opt...)
+	drawn := func(x, y int) bool {
+		return c.Dark(x, y) == opts.withInverted
+	}
+	var sb strings.Builder
+	for y := -qrQuietZone; y < c.Size+qrQuietZone; y += 2 {
+		for x := -qrQuietZone; x < c.Size+qrQuietZone; x++ {
+			top, bottom := drawn(x, y), drawn(x, y+1)
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// QRCodePNG renders the data (like an auth URL or a device authorization's
+// LoginURI) as a PNG image of a QR code, which can be displayed by a terminal
+// that supports inline images or served to a browser.
+//
+// Supported options: WithQRCodeScale
+func QRCodePNG(data string, opt ...oidc.Option) ([]byte, error) {
+	const op = "clientauth.QRCodePNG"
+	c, err := qrcode.Encode([]byte(data), qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, err, oidc.ErrInvalidParameter)
+	}
+	opts := getQRCodeOpts(opt...)
+	if opts.withScale <= 0 {
+		return nil, fmt.Errorf("%s: scale not greater than zero: %w", op, oidc.ErrInvalidParameter)
+	}
+	size := (c.Size + 2*qrQuietZone) * opts.withScale
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if c.Dark(x/opts.withScale-qrQuietZone, y/opts.withScale-qrQuietZone) {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("%s: unable to encode png: %w", op, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// qrCodeOptions is the set of available options for the QR code functions
+type qrCodeOptions struct {
+	withInverted bool
+	withScale    int
+}
+
+// qrCodeDefaults is a handy way to get the defaults at runtime and during unit
+// tests.
+func qrCodeDefaults() qrCodeOptions {
+	return qrCodeOptions{
+		withScale: DefaultQRCodeScale,
+	}
+}
+
+// getQRCodeOpts gets the QR code defaults and applies the opt overrides passed
+// in
+func getQRCodeOpts(opt ...oidc.Option) qrCodeOptions {
+	opts := qrCodeDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithInvertedQRCode provides an optional flag to draw the dark modules of a
+// QR code rendered as text, which is needed for terminals with a light
+// background.
+//
+// Valid for: QRCodeText and Client
+func WithInvertedQRCode() oidc.Option {
+	return func(o interface{}) {
+		switch o := o.(type) {
+		case *qrCodeOptions:
+			o.withInverted = true
+		case *clientOptions:
+			o.withInvertedQRCode = true
+		}
+	}
+}
+
+// WithQRCodeScale provides an optional number of pixels per QR code module.
+// The default is DefaultQRCodeScale.
+//
+// Valid for: QRCodePNG
+func WithQRCodeScale(scale int) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*qrCodeOptions); ok {
+			o.withScale = scale
+		}
+	}
+}
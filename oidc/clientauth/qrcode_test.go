@@ -0,0 +1,133 @@
+package clientauth
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/internal/qrcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testQRCodeURL = "https://example.com/device?user_code=WDJB-MJHT"
+
+func TestQRCodeText(t *testing.T) {
+	t.Parallel()
+	c, err := qrcode.Encode([]byte(testQRCodeURL), qrcode.Medium)
+	require.NoError(t, err)
+	width := c.Size + 2*qrQuietZone
+
+	// drawnModules returns the modules of the text, which is two rows per line
+	drawnModules := func(t *testing.T, text string) [][]bool {
+		t.Helper()
+		var modules [][]bool
+		for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+			require.Equal(t, width, utf8.RuneCountInString(line))
+			top, bottom := make([]bool, 0, width), make([]bool, 0, width)
+			for _, r := range line {
+				top = append(top, r == '█' || r == '▀')
+				bottom = append(bottom, r == '█' || r == '▄')
+			}
+			modules = append(modules, top, bottom)
+		}
+		return modules
+	}
+	tests := []struct {
+		name string
+		opts []oidc.Option
+		want bool
+	}{
+		{name: "default", want: false},
+		{name: "inverted", opts: []oidc.Option{WithInvertedQRCode()}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			text, err := QRCodeText(testQRCodeURL, tt.opts...)
+			require.NoError(err)
+			modules := drawnModules(t, text)
+			require.Len(modules, width+width%2)
+			for y := 0; y < width; y++ {
+				for x := 0; x < width; x++ {
+					dark := c.Dark(x-qrQuietZone, y-qrQuietZone)
+					assert.Equalf(dark == tt.want, modules[y][x], "module (%d, %d)", x, y)
+				}
+			}
+		})
+	}
+	t.Run("too-long", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := QRCodeText(strings.Repeat("x", 3000))
+		require.Error(err)
+		assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+	})
+}
+
+func TestQRCodePNG(t *testing.T) {
+	t.Parallel()
+	c, err := qrcode.Encode([]byte(testQRCodeURL), qrcode.Medium)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		data      string
+		opts      []oidc.Option
+		wantScale int
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "default", data: testQRCodeURL, wantScale: DefaultQRCodeScale},
+		{name: "with-scale", data: testQRCodeURL, opts: []oidc.Option{WithQRCodeScale(3)}, wantScale: 3},
+		{name: "invalid-scale", data: testQRCodeURL, opts: []oidc.Option{WithQRCodeScale(0)}, wantErr: true, wantIsErr: oidc.ErrInvalidParameter},
+		{name: "too-long", data: strings.Repeat("x", 3000), wantErr: true, wantIsErr: oidc.ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := QRCodePNG(tt.data, tt.opts...)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			img, err := png.Decode(bytes.NewReader(got))
+			require.NoError(err)
+			width := (c.Size + 2*qrQuietZone) * tt.wantScale
+			assert.Equal(width, img.Bounds().Dx())
+			assert.Equal(width, img.Bounds().Dy())
+			for y := 0; y < width; y++ {
+				for x := 0; x < width; x++ {
+					r, _, _, _ := img.At(x, y).RGBA()
+					dark := c.Dark(x/tt.wantScale-qrQuietZone, y/tt.wantScale-qrQuietZone)
+					if dark != (r == 0) {
+						assert.Failf("wrong pixel", "pixel (%d, %d)", x, y)
+						return
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_QRCodeOptions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	opts := getQRCodeOpts(WithInvertedQRCode(), WithQRCodeScale(2))
+	testOpts := qrCodeDefaults()
+	testOpts.withInverted = true
+	testOpts.withScale = 2
+	assert.Equal(opts, testOpts)
+
+	clientOpts := getClientOpts(WithQRCode(), WithInvertedQRCode())
+	testClientOpts := clientDefaults()
+	testClientOpts.withQRCode = true
+	testClientOpts.withInvertedQRCode = true
+	assert.Equal(clientOpts.withQRCode, testClientOpts.withQRCode)
+	assert.Equal(clientOpts.withInvertedQRCode, testClientOpts.withInvertedQRCode)
+}
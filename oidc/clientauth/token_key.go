@@ -0,0 +1,194 @@
+package clientauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// TokenKey identifies a cached Token by the provider and client it was issued
+// for, and the scopes and audience it was requested with, so one CLI (or
+// service) can cache multiple independent Tokens in a TokenStore without
+// collisions.
+//
+// Its String() is the key used with a TokenStore, and it's the same for any
+// ordering (or duplicates) of the Scopes.  The "openid" scope is ignored,
+// since it's always requested.  A TokenKey without scopes or an audience is
+// "<issuer>|<client_id>", which is the key used by earlier versions of the
+// Client.
+type TokenKey struct {
+	// Issuer is the provider's issuer.
+	Issuer string
+
+	// ClientID is the provider's client ID.
+	ClientID string
+
+	// Scopes are the scopes the Token was requested with (see
+	// oidc.WithScopes).
+	Scopes []string
+
+	// Audience is the audience parameter the Token was requested with (see
+	// oidc.WithAuthAudience).
+	Audience string
+}
+
+// tokenKeySeparator separates the fields of a TokenKey's String().
+const tokenKeySeparator = "|"
+
+var (
+	tokenKeyEscaper   = strings.NewReplacer("%", "%25", tokenKeySeparator, "%7C")
+	tokenKeyUnescaper = strings.NewReplacer("%25", "%", "%7C", tokenKeySeparator)
+)
+
+// String returns the key used with a TokenStore.
+func (k TokenKey) String() string {
+	fields := []string{tokenKeyEscaper.Replace(k.Issuer), tokenKeyEscaper.Replace(k.ClientID)}
+	scopes := k.normalizedScopes()
+	if len(scopes) > 0 || k.Audience != "" {
+		fields = append(fields, tokenKeyEscaper.Replace(strings.Join(scopes, " ")), tokenKeyEscaper.Replace(k.Audience))
+	}
+	return strings.Join(fields, tokenKeySeparator)
+}
+
+// normalizedScopes returns the sorted, unique scopes, without "openid".
+func (k TokenKey) normalizedScopes() []string {
+	seen := make(map[string]bool, len(k.Scopes))
+	scopes := make([]string, 0, len(k.Scopes))
+	for _, s := range k.Scopes {
+		if s == "" || s == "openid" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		scopes = append(scopes, s)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// ParseTokenKey parses the String() of a TokenKey.  An error wrapping
+// oidc.ErrInvalidParameter is returned for keys which weren't created by a
+// TokenKey (for example: a key provided using WithTokenKey).
+func ParseTokenKey(key string) (TokenKey, error) {
+	const op = "clientauth.ParseTokenKey"
+	fields := strings.Split(key, tokenKeySeparator)
+	if (len(fields) != 2 && len(fields) != 4) || fields[0] == "" || fields[1] == "" {
+		return TokenKey{}, fmt.Errorf("%s: %q is not a token key: %w", op, key, oidc.ErrInvalidParameter)
+	}
+	k := TokenKey{
+		Issuer:   tokenKeyUnescaper.Replace(fields[0]),
+		ClientID: tokenKeyUnescaper.Replace(fields[1]),
+	}
+	if len(fields) == 4 {
+		if scopes := strings.Fields(tokenKeyUnescaper.Replace(fields[2])); len(scopes) > 0 {
+			k.Scopes = scopes
+		}
+		k.Audience = tokenKeyUnescaper.Replace(fields[3])
+	}
+	return k, nil
+}
+
+// includes returns true when k is for the same issuer, client and audience as
+// want, and k's scopes include all of want's scopes.
+func (k TokenKey) includes(want TokenKey) bool {
+	if k.Issuer != want.Issuer || k.ClientID != want.ClientID || k.Audience != want.Audience {
+		return false
+	}
+	scopes := make(map[string]bool, len(k.Scopes))
+	for _, s := range k.Scopes {
+		scopes[s] = true
+	}
+	for _, s := range want.normalizedScopes() {
+		if !scopes[s] {
+			return false
+		}
+	}
+	return true
+}
+
+// TokenKeyLister is an optional interface of a TokenStore which lists the keys
+// of its cached Tokens.  MemoryTokenStore and FileTokenStore implement it.
+type TokenKeyLister interface {
+	// Keys returns the keys of every cached Token, in sorted order.
+	Keys(ctx context.Context) ([]string, error)
+}
+
+// ListTokenKeys returns the TokenKeys of the store's cached Tokens, in the
+// order of their String().  Keys which weren't created by a TokenKey are
+// skipped.  The store must implement TokenKeyLister, or an error wrapping
+// oidc.ErrInvalidParameter is returned.
+func ListTokenKeys(ctx context.Context, s TokenStore) ([]TokenKey, error) {
+	const op = "clientauth.ListTokenKeys"
+	if s == nil {
+		return nil, fmt.Errorf("%s: token store is nil: %w", op, oidc.ErrNilParameter)
+	}
+	lister, ok := s.(TokenKeyLister)
+	if !ok {
+		return nil, fmt.Errorf("%s: %T doesn't list its keys: %w", op, s, oidc.ErrInvalidParameter)
+	}
+	keys, err := lister.Keys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	tokenKeys := make([]TokenKey, 0, len(keys))
+	for _, key := range keys {
+		k, err := ParseTokenKey(key)
+		if err != nil {
+			continue
+		}
+		tokenKeys = append(tokenKeys, k)
+	}
+	return tokenKeys, nil
+}
+
+// FindToken returns a valid cached Token (and its TokenKey) for the want
+// TokenKey's issuer, client and audience which was requested with at least
+// want's scopes.  The Token cached for want is preferred, and otherwise the
+// valid Token with the fewest scopes is returned.  Only want's Token is
+// considered when the store doesn't implement TokenKeyLister.  If a valid
+// Token is not found, then an error wrapping oidc.ErrNotFound is returned.
+func FindToken(ctx context.Context, s TokenStore, want TokenKey) (TokenKey, oidc.Token, error) {
+	const op = "clientauth.FindToken"
+	if s == nil {
+		return TokenKey{}, nil, fmt.Errorf("%s: token store is nil: %w", op, oidc.ErrNilParameter)
+	}
+	t, err := s.Read(ctx, want.String())
+	switch {
+	case err == nil && t.Valid():
+		return want, t, nil
+	case err != nil && !errors.Is(err, oidc.ErrNotFound):
+		return TokenKey{}, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, ok := s.(TokenKeyLister); !ok {
+		return TokenKey{}, nil, fmt.Errorf("%s: token for %q: %w", op, want, oidc.ErrNotFound)
+	}
+	keys, err := ListTokenKeys(ctx, s)
+	if err != nil {
+		return TokenKey{}, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var (
+		found      TokenKey
+		foundToken oidc.Token
+	)
+	for _, k := range keys {
+		if !k.includes(want) || (foundToken != nil && len(k.Scopes) >= len(found.Scopes)) {
+			continue
+		}
+		t, err := s.Read(ctx, k.String())
+		switch {
+		case errors.Is(err, oidc.ErrNotFound):
+			continue
+		case err != nil:
+			return TokenKey{}, nil, fmt.Errorf("%s: %w", op, err)
+		case t.Valid():
+			found, foundToken = k, t
+		}
+	}
+	if foundToken == nil {
+		return TokenKey{}, nil, fmt.Errorf("%s: token for %q: %w", op, want, oidc.ErrNotFound)
+	}
+	return found, foundToken, nil
+}
@@ -0,0 +1,149 @@
+package clientauth
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestTokenKey(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		key       TokenKey
+		want      string
+		wantParse TokenKey
+	}{
+		{
+			name:      "issuer-and-client",
+			key:       TokenKey{Issuer: "https://example.com", ClientID: "client-id"},
+			want:      "https://example.com|client-id",
+			wantParse: TokenKey{Issuer: "https://example.com", ClientID: "client-id"},
+		},
+		{
+			name:      "only-openid",
+			key:       TokenKey{Issuer: "https://example.com", ClientID: "client-id", Scopes: []string{"openid"}},
+			want:      "https://example.com|client-id",
+			wantParse: TokenKey{Issuer: "https://example.com", ClientID: "client-id"},
+		},
+		{
+			name:      "sorted-unique-scopes",
+			key:       TokenKey{Issuer: "https://example.com", ClientID: "client-id", Scopes: []string{"profile", "openid", "email", "profile"}},
+			want:      "https://example.com|client-id|email profile|",
+			wantParse: TokenKey{Issuer: "https://example.com", ClientID: "client-id", Scopes: []string{"email", "profile"}},
+		},
+		{
+			name:      "audience",
+			key:       TokenKey{Issuer: "https://example.com", ClientID: "client-id", Audience: "https://api.example.com"},
+			want:      "https://example.com|client-id||https://api.example.com",
+			wantParse: TokenKey{Issuer: "https://example.com", ClientID: "client-id", Audience: "https://api.example.com"},
+		},
+		{
+			name:      "escaped",
+			key:       TokenKey{Issuer: "https://example.com/a|b", ClientID: "client%id", Scopes: []string{"a|b"}},
+			want:      "https://example.com/a%7Cb|client%25id|a%7Cb|",
+			wantParse: TokenKey{Issuer: "https://example.com/a|b", ClientID: "client%id", Scopes: []string{"a|b"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got := tt.key.String()
+			assert.Equal(tt.want, got)
+			parsed, err := ParseTokenKey(got)
+			require.NoError(err)
+			assert.Equal(tt.wantParse, parsed)
+			assert.Equal(got, parsed.String())
+		})
+	}
+	t.Run("not-a-token-key", func(t *testing.T) {
+		for _, key := range []string{"", "alice", "a|b|c", "|client-id"} {
+			_, err := ParseTokenKey(key)
+			assert.Truef(t, errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+		}
+	})
+}
+
+func TestFindToken(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	newToken := func(t *testing.T, accessToken string, expiry time.Time) oidc.Token {
+		tk, err := oidc.NewToken("id-token", &oauth2.Token{AccessToken: accessToken, Expiry: expiry})
+		require.NoError(t, err)
+		return tk
+	}
+	fs, err := NewFileTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+
+	base := TokenKey{Issuer: "https://example.com", ClientID: "client-id"}
+	profile := TokenKey{Issuer: base.Issuer, ClientID: base.ClientID, Scopes: []string{"profile"}}
+	profileEmail := TokenKey{Issuer: base.Issuer, ClientID: base.ClientID, Scopes: []string{"profile", "email"}}
+	expiredEmail := TokenKey{Issuer: base.Issuer, ClientID: base.ClientID, Scopes: []string{"email"}}
+	api := TokenKey{Issuer: base.Issuer, ClientID: base.ClientID, Scopes: []string{"profile"}, Audience: "api"}
+	other := TokenKey{Issuer: "https://other.example.com", ClientID: base.ClientID, Scopes: []string{"profile"}}
+
+	stores := []struct {
+		name  string
+		store TokenStore
+	}{
+		{"memory", NewMemoryTokenStore()},
+		{"file", fs},
+	}
+	for _, st := range stores {
+		s := st.store
+		t.Run(st.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			valid := time.Now().Add(time.Hour)
+			require.NoError(s.Write(ctx, profile.String(), newToken(t, "profile", valid)))
+			require.NoError(s.Write(ctx, profileEmail.String(), newToken(t, "profile-email", valid)))
+			require.NoError(s.Write(ctx, expiredEmail.String(), newToken(t, "expired-email", time.Now().Add(-time.Hour))))
+			require.NoError(s.Write(ctx, api.String(), newToken(t, "api", valid)))
+			require.NoError(s.Write(ctx, other.String(), newToken(t, "other", valid)))
+			require.NoError(s.Write(ctx, "custom-key", newToken(t, "custom", valid)))
+
+			keys, err := ListTokenKeys(ctx, s)
+			require.NoError(err)
+			assert.Len(keys, 5)
+
+			tests := []struct {
+				name     string
+				want     TokenKey
+				wantKey  TokenKey
+				wantNone bool
+			}{
+				{name: "exact", want: profileEmail, wantKey: profileEmail},
+				{name: "fewest-scopes", want: base, wantKey: profile},
+				{name: "superset", want: TokenKey{Issuer: base.Issuer, ClientID: base.ClientID, Scopes: []string{"email"}}, wantKey: profileEmail},
+				{name: "audience", want: TokenKey{Issuer: base.Issuer, ClientID: base.ClientID, Audience: "api"}, wantKey: api},
+				{name: "missing-scope", want: TokenKey{Issuer: base.Issuer, ClientID: base.ClientID, Scopes: []string{"groups"}}, wantNone: true},
+				{name: "unknown-issuer", want: TokenKey{Issuer: "https://unknown.example.com", ClientID: base.ClientID}, wantNone: true},
+			}
+			for _, tt := range tests {
+				k, tk, err := FindToken(ctx, s, tt.want)
+				if tt.wantNone {
+					assert.Truef(errors.Is(err, oidc.ErrNotFound), "%s: wanted \"%s\" but got \"%s\"", tt.name, oidc.ErrNotFound, err)
+					continue
+				}
+				require.NoError(err, tt.name)
+				assert.Equal(tt.wantKey.String(), k.String(), tt.name)
+				got, err := s.Read(ctx, k.String())
+				require.NoError(err, tt.name)
+				assert.Equal(got.AccessToken(), tk.AccessToken(), tt.name)
+			}
+		})
+	}
+	t.Run("nil-store", func(t *testing.T) {
+		_, _, err := FindToken(ctx, nil, base)
+		assert.Truef(t, errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+		_, err = ListTokenKeys(ctx, nil)
+		assert.Truef(t, errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+	})
+}
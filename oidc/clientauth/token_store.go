@@ -0,0 +1,518 @@
+package clientauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"golang.org/x/oauth2"
+)
+
+// TokenStore defines an interface for caching a user's oidc.Token(s).
+//
+// Implementations must be concurrently safe.
+type TokenStore interface {
+	// Read an existing Token for the key.  If a Token is not found for the
+	// key, then an error wrapping oidc.ErrNotFound is returned.
+	Read(ctx context.Context, key string) (oidc.Token, error)
+
+	// Write a Token for the key, replacing any existing Token for the key.
+	Write(ctx context.Context, key string, t oidc.Token) error
+
+	// Delete the Token for the key.  It's not an error to delete a key that
+	// doesn't exist.
+	Delete(ctx context.Context, key string) error
+}
+
+// RotatedTokenTracker is an optional interface of a TokenStore which
+// remembers the refresh tokens of a key that were rotated (replaced by a
+// refresh), so a refresh_token rejected by the provider can be confirmed as
+// reused (see Client.Refresh).  Implementations should only persist a hash of
+// each refresh_token.  MemoryTokenStore and FileTokenStore implement it, and
+// remember the last MaxRotatedRefreshTokens for each key.
+type RotatedTokenTracker interface {
+	// MarkRotated remembers that the key's refresh_token was rotated.
+	MarkRotated(ctx context.Context, key string, refreshToken oidc.RefreshToken) error
+
+	// Rotated returns true when the key's refresh_token was rotated.
+	Rotated(ctx context.Context, key string, refreshToken oidc.RefreshToken) (bool, error)
+}
+
+// MaxRotatedRefreshTokens is the number of rotated refresh tokens remembered
+// for each key by MemoryTokenStore and FileTokenStore.
+const MaxRotatedRefreshTokens = 20
+
+// rotatedTokenHash returns the hash of a rotated refresh_token which is
+// remembered, so the refresh_token itself is never persisted once it's
+// rotated.
+func rotatedTokenHash(refreshToken oidc.RefreshToken) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// markRotated returns the hashes with the refresh_token's hash appended,
+// keeping the last MaxRotatedRefreshTokens.
+func markRotated(hashes []string, refreshToken oidc.RefreshToken) []string {
+	h := rotatedTokenHash(refreshToken)
+	for _, v := range hashes {
+		if v == h {
+			return hashes
+		}
+	}
+	hashes = append(hashes, h)
+	if len(hashes) > MaxRotatedRefreshTokens {
+		hashes = hashes[len(hashes)-MaxRotatedRefreshTokens:]
+	}
+	return hashes
+}
+
+// rotated returns true when the hashes include the refresh_token's hash.
+func rotated(hashes []string, refreshToken oidc.RefreshToken) bool {
+	h := rotatedTokenHash(refreshToken)
+	for _, v := range hashes {
+		if v == h {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryTokenStore implements the TokenStore interface using an in-memory
+// map. It is concurrently safe.
+type MemoryTokenStore struct {
+	mu      sync.RWMutex
+	tokens  map[string]oidc.Token
+	rotated map[string][]string
+}
+
+// ensure that MemoryTokenStore implements the TokenStore, TokenKeyLister and
+// RotatedTokenTracker interfaces.
+var (
+	_ TokenStore          = (*MemoryTokenStore)(nil)
+	_ TokenKeyLister      = (*MemoryTokenStore)(nil)
+	_ RotatedTokenTracker = (*MemoryTokenStore)(nil)
+)
+
+// NewMemoryTokenStore creates a new MemoryTokenStore.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens:  map[string]oidc.Token{},
+		rotated: map[string][]string{},
+	}
+}
+
+// Read implements the TokenStore.Read() interface function.
+func (s *MemoryTokenStore) Read(_ context.Context, key string) (oidc.Token, error) {
+	const op = "MemoryTokenStore.Read"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: token for %q: %w", op, key, oidc.ErrNotFound)
+	}
+	return t, nil
+}
+
+// Write implements the TokenStore.Write() interface function.
+func (s *MemoryTokenStore) Write(_ context.Context, key string, t oidc.Token) error {
+	const op = "MemoryTokenStore.Write"
+	if t == nil {
+		return fmt.Errorf("%s: token is nil: %w", op, oidc.ErrNilParameter)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[key] = t
+	return nil
+}
+
+// Delete implements the TokenStore.Delete() interface function.
+func (s *MemoryTokenStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, key)
+	return nil
+}
+
+// MarkRotated implements the RotatedTokenTracker.MarkRotated() interface
+// function.
+func (s *MemoryTokenStore) MarkRotated(_ context.Context, key string, refreshToken oidc.RefreshToken) error {
+	const op = "MemoryTokenStore.MarkRotated"
+	if refreshToken == "" {
+		return fmt.Errorf("%s: refresh_token is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotated[key] = markRotated(s.rotated[key], refreshToken)
+	return nil
+}
+
+// Rotated implements the RotatedTokenTracker.Rotated() interface function.
+func (s *MemoryTokenStore) Rotated(_ context.Context, key string, refreshToken oidc.RefreshToken) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return rotated(s.rotated[key], refreshToken), nil
+}
+
+// Keys implements the TokenKeyLister.Keys() interface function.
+func (s *MemoryTokenStore) Keys(_ context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.tokens))
+	for k := range s.tokens {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// FileTokenStore implements the TokenStore interface using a versioned JSON
+// file which is only readable by the current user (0600).  The file is encrypted when the
+// store has an oidc.Wrapper (see WithWrapper).  It is concurrently safe within
+// a single process.
+type FileTokenStore struct {
+	mu      sync.Mutex
+	path    string
+	wrapper oidc.Wrapper
+}
+
+// ensure that FileTokenStore implements the TokenStore, TokenKeyLister and
+// RotatedTokenTracker interfaces.
+var (
+	_ TokenStore          = (*FileTokenStore)(nil)
+	_ TokenKeyLister      = (*FileTokenStore)(nil)
+	_ RotatedTokenTracker = (*FileTokenStore)(nil)
+)
+
+// NewFileTokenStore creates a new FileTokenStore which uses the file at path.
+// The file (and its parent directory) will be created when the first Token is
+// written.
+//
+// Supported options: WithWrapper
+func NewFileTokenStore(path string, opt ...oidc.Option) (*FileTokenStore, error) {
+	const op = "NewFileTokenStore"
+	if path == "" {
+		return nil, fmt.Errorf("%s: path is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	opts := getTokenStoreOpts(opt...)
+	return &FileTokenStore{
+		path:    path,
+		wrapper: opts.withWrapper,
+	}, nil
+}
+
+// fileTokenStoreAAD is the additional authenticated data used to encrypt a
+// FileTokenStore's file, which prevents the encrypted file from being used as
+// a different kind of encrypted artifact.
+const fileTokenStoreAAD = "cap:clientauth:FileTokenStore"
+
+// encryptedTokens is the persisted form of a FileTokenStore's encrypted file.
+type encryptedTokens struct {
+	Wrapped *oidc.EncryptedBlob `json:"wrapped"`
+}
+
+// tokenFileVersion is the current version of a FileTokenStore's file format.
+const tokenFileVersion = 1
+
+// tokenFile is the persisted form of a FileTokenStore's file.  The tokens are
+// persisted using the oidc.Tk's versioned format (see oidc.MarshalToken), and
+// the hashes of each key's rotated refresh tokens are persisted in Rotated.
+type tokenFile struct {
+	Version int                        `json:"version"`
+	Tokens  map[string]json.RawMessage `json:"tokens"`
+	Rotated map[string][]string        `json:"rotated,omitempty"`
+}
+
+// legacyToken is the persisted form of an oidc.Token in the unversioned file
+// format, which is migrated to the current format when it's loaded.
+type legacyToken struct {
+	IDToken      string    `json:"id_token"`
+	AccessToken  string    `json:"access_token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// Read implements the TokenStore.Read() interface function.
+func (s *FileTokenStore) Read(_ context.Context, key string) (oidc.Token, error) {
+	const op = "FileTokenStore.Read"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.load()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	data, ok := f.Tokens[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: token for %q: %w", op, key, oidc.ErrNotFound)
+	}
+	t, err := oidc.UnmarshalToken(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create token for %q: %w", op, key, err)
+	}
+	return t, nil
+}
+
+// Write implements the TokenStore.Write() interface function.
+func (s *FileTokenStore) Write(_ context.Context, key string, t oidc.Token) error {
+	const op = "FileTokenStore.Write"
+	if t == nil {
+		return fmt.Errorf("%s: token is nil: %w", op, oidc.ErrNilParameter)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.load()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	data, err := oidc.MarshalToken(t)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	f.Tokens[key] = data
+	if err := s.save(f); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Delete implements the TokenStore.Delete() interface function.
+func (s *FileTokenStore) Delete(_ context.Context, key string) error {
+	const op = "FileTokenStore.Delete"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.load()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, ok := f.Tokens[key]; !ok {
+		return nil
+	}
+	delete(f.Tokens, key)
+	if err := s.save(f); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// MarkRotated implements the RotatedTokenTracker.MarkRotated() interface
+// function.
+func (s *FileTokenStore) MarkRotated(_ context.Context, key string, refreshToken oidc.RefreshToken) error {
+	const op = "FileTokenStore.MarkRotated"
+	if refreshToken == "" {
+		return fmt.Errorf("%s: refresh_token is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.load()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	f.Rotated[key] = markRotated(f.Rotated[key], refreshToken)
+	if err := s.save(f); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Rotated implements the RotatedTokenTracker.Rotated() interface function.
+func (s *FileTokenStore) Rotated(_ context.Context, key string, refreshToken oidc.RefreshToken) (bool, error) {
+	const op = "FileTokenStore.Rotated"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.load()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return rotated(f.Rotated[key], refreshToken), nil
+}
+
+// Keys implements the TokenKeyLister.Keys() interface function.
+func (s *FileTokenStore) Keys(_ context.Context) ([]string, error) {
+	const op = "FileTokenStore.Keys"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.load()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	keys := make([]string, 0, len(f.Tokens))
+	for k := range f.Tokens {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// load reads the tokens (and rotated refresh tokens) from the store's file.  A
+// missing file is not an
+// error.  When the store has a wrapper, an unencrypted file is still read, so
+// it's encrypted the next time the store's tokens are written.  A file in the
+// unversioned format is migrated, so it's rewritten in the current format the
+// next time the store's tokens are written.
+func (s *FileTokenStore) load() (*tokenFile, error) {
+	const op = "FileTokenStore.load"
+	data, err := ioutil.ReadFile(s.path)
+	switch {
+	case os.IsNotExist(err):
+		return newTokenFile(nil), nil
+	case err != nil:
+		return nil, fmt.Errorf("%s: unable to read %s: %w", op, s.path, err)
+	}
+	var encrypted encryptedTokens
+	if err := json.Unmarshal(data, &encrypted); err == nil && encrypted.Wrapped != nil && len(encrypted.Wrapped.Ciphertext) > 0 {
+		if s.wrapper == nil {
+			return nil, fmt.Errorf("%s: %s is encrypted and the store doesn't have a wrapper: %w", op, s.path, oidc.ErrInvalidParameter)
+		}
+		data, err = s.wrapper.Decrypt(context.Background(), encrypted.Wrapped, []byte(fileTokenStoreAAD))
+		if err != nil {
+			return nil, fmt.Errorf("%s: unable to decrypt %s: %w", op, s.path, err)
+		}
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%s: unable to unmarshal %s: %w", op, s.path, err)
+	}
+	var version int
+	if err := json.Unmarshal(fields["version"], &version); err != nil || version == 0 {
+		tokens, err := migrateLegacyTokens(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unable to migrate %s: %w", op, s.path, err)
+		}
+		return newTokenFile(tokens), nil
+	}
+	if version > tokenFileVersion {
+		return nil, fmt.Errorf("%s: %s version %d is newer than %d: %w", op, s.path, version, tokenFileVersion, oidc.ErrUnsupportedFormatVersion)
+	}
+	var f tokenFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: unable to unmarshal %s: %w", op, s.path, err)
+	}
+	if f.Tokens == nil {
+		f.Tokens = map[string]json.RawMessage{}
+	}
+	if f.Rotated == nil {
+		f.Rotated = map[string][]string{}
+	}
+	return &f, nil
+}
+
+// newTokenFile returns a tokenFile in the current format for the tokens.
+func newTokenFile(tokens map[string]json.RawMessage) *tokenFile {
+	if tokens == nil {
+		tokens = map[string]json.RawMessage{}
+	}
+	return &tokenFile{
+		Version: tokenFileVersion,
+		Tokens:  tokens,
+		Rotated: map[string][]string{},
+	}
+}
+
+// migrateLegacyTokens migrates the tokens of an unversioned file to the
+// current format.
+func migrateLegacyTokens(data []byte) (map[string]json.RawMessage, error) {
+	const op = "migrateLegacyTokens"
+	var legacy map[string]legacyToken
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	tokens := make(map[string]json.RawMessage, len(legacy))
+	for key, lt := range legacy {
+		t, err := oidc.NewToken(oidc.IDToken(lt.IDToken), &oauth2.Token{
+			AccessToken:  lt.AccessToken,
+			RefreshToken: lt.RefreshToken,
+			Expiry:       lt.Expiry,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: token for %q: %w", op, key, err)
+		}
+		if tokens[key], err = oidc.MarshalToken(t); err != nil {
+			return nil, fmt.Errorf("%s: token for %q: %w", op, key, err)
+		}
+	}
+	return tokens, nil
+}
+
+// save writes the tokens file to the store's file by writing a temp file and
+// then renaming it, so a partially written file is never read.
+func (s *FileTokenStore) save(tf *tokenFile) error {
+	const op = "FileTokenStore.save"
+	tf.Version = tokenFileVersion
+	data, err := json.Marshal(tf)
+	if err != nil {
+		return fmt.Errorf("%s: unable to marshal tokens: %w", op, err)
+	}
+	if s.wrapper != nil {
+		blob, err := s.wrapper.Encrypt(context.Background(), data, []byte(fileTokenStoreAAD))
+		if err != nil {
+			return fmt.Errorf("%s: unable to encrypt tokens: %w", op, err)
+		}
+		if data, err = json.Marshal(encryptedTokens{Wrapped: blob}); err != nil {
+			return fmt.Errorf("%s: unable to marshal encrypted tokens: %w", op, err)
+		}
+	}
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("%s: unable to create %s: %w", op, dir, err)
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("%s: unable to create temp file: %w", op, err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: unable to write temp file: %w", op, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("%s: unable to close temp file: %w", op, err)
+	}
+	if err := os.Chmod(f.Name(), 0600); err != nil {
+		return fmt.Errorf("%s: unable to set permissions on temp file: %w", op, err)
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return fmt.Errorf("%s: unable to rename temp file: %w", op, err)
+	}
+	return nil
+}
+
+// tokenStoreOptions is the set of available options for TokenStore functions
+type tokenStoreOptions struct {
+	withWrapper oidc.Wrapper
+}
+
+// tokenStoreDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func tokenStoreDefaults() tokenStoreOptions {
+	return tokenStoreOptions{}
+}
+
+// getTokenStoreOpts gets the token store defaults and applies the opt
+// overrides passed in
+func getTokenStoreOpts(opt ...oidc.Option) tokenStoreOptions {
+	opts := tokenStoreDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithWrapper provides an optional oidc.Wrapper which encrypts the store's
+// persisted tokens.  The tokens are re-encrypted with the wrapper's current
+// key every time they're written, so they're migrated to a rotated key (and an
+// unencrypted file is encrypted) on the next write.
+//
+// Valid for: FileTokenStore
+func WithWrapper(w oidc.Wrapper) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*tokenStoreOptions); ok {
+			o.withWrapper = w
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package clientauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestTokenStores(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	fs, err := NewFileTokenStore(filepath.Join(t.TempDir(), "nested", "tokens.json"))
+	require.NoError(t, err)
+	wrapper, err := oidc.NewAESGCMWrapper("key-1", make([]byte, 32))
+	require.NoError(t, err)
+	encryptedFS, err := NewFileTokenStore(filepath.Join(t.TempDir(), "tokens.json"), WithWrapper(wrapper))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		store TokenStore
+	}{
+		{"memory", NewMemoryTokenStore()},
+		{"file", fs},
+		{"encrypted-file", encryptedFS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+			tk, err := oidc.NewToken("id-token", &oauth2.Token{
+				AccessToken:  "access-token",
+				RefreshToken: "refresh-token",
+				Expiry:       expiry,
+			})
+			require.NoError(err)
+
+			got, err := tt.store.Read(ctx, "alice")
+			require.Error(err)
+			assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+			assert.Nil(got)
+
+			err = tt.store.Write(ctx, "alice", nil)
+			require.Error(err)
+			assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+
+			require.NoError(tt.store.Write(ctx, "alice", tk))
+			got, err = tt.store.Read(ctx, "alice")
+			require.NoError(err)
+			assert.Equal(tk.IDToken(), got.IDToken())
+			assert.Equal(tk.AccessToken(), got.AccessToken())
+			assert.Equal(tk.RefreshToken(), got.RefreshToken())
+			assert.True(expiry.Equal(got.Expiry()))
+
+			require.NoError(tt.store.Delete(ctx, "alice"))
+			require.NoError(tt.store.Delete(ctx, "alice"))
+			_, err = tt.store.Read(ctx, "alice")
+			assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+		})
+	}
+	t.Run("rotated", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "tokens.json")
+		fs, err := NewFileTokenStore(path)
+		require.NoError(t, err)
+		for _, tracker := range []RotatedTokenTracker{NewMemoryTokenStore(), fs} {
+			assert, require := assert.New(t), require.New(t)
+			got, err := tracker.Rotated(ctx, "alice", "refresh-token-0")
+			require.NoError(err)
+			assert.False(got)
+
+			err = tracker.MarkRotated(ctx, "alice", "")
+			assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+
+			for i := 0; i <= MaxRotatedRefreshTokens; i++ {
+				require.NoError(tracker.MarkRotated(ctx, "alice", oidc.RefreshToken(fmt.Sprintf("refresh-token-%d", i))))
+			}
+			// only the last MaxRotatedRefreshTokens are remembered
+			got, err = tracker.Rotated(ctx, "alice", "refresh-token-0")
+			require.NoError(err)
+			assert.False(got)
+			got, err = tracker.Rotated(ctx, "alice", "refresh-token-1")
+			require.NoError(err)
+			assert.True(got)
+			got, err = tracker.Rotated(ctx, "bob", "refresh-token-1")
+			require.NoError(err)
+			assert.False(got)
+		}
+		// only hashes of the rotated refresh tokens are persisted
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "refresh-token-1")
+		assert.Contains(t, string(data), `"rotated"`)
+	})
+	t.Run("file-permissions", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		path := filepath.Join(t.TempDir(), "tokens.json")
+		s, err := NewFileTokenStore(path)
+		require.NoError(err)
+		tk, err := oidc.NewToken("id-token", nil)
+		require.NoError(err)
+		require.NoError(s.Write(ctx, "alice", tk))
+		info, err := os.Stat(path)
+		require.NoError(err)
+		assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	})
+	t.Run("file-empty-path", func(t *testing.T) {
+		assert := assert.New(t)
+		s, err := NewFileTokenStore("")
+		assert.Error(err)
+		assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+		assert.Nil(s)
+	})
+	t.Run("file-encrypted", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		path := filepath.Join(t.TempDir(), "tokens.json")
+		tk, err := oidc.NewToken("id-token", &oauth2.Token{AccessToken: "access-token", RefreshToken: "refresh-token"})
+		require.NoError(err)
+
+		// an unencrypted file is encrypted when it's written with a wrapper
+		plain, err := NewFileTokenStore(path)
+		require.NoError(err)
+		require.NoError(plain.Write(ctx, "alice", tk))
+
+		w, err := oidc.NewAESGCMWrapper("key-1", []byte("0123456789abcdef"))
+		require.NoError(err)
+		s, err := NewFileTokenStore(path, WithWrapper(w))
+		require.NoError(err)
+		got, err := s.Read(ctx, "alice")
+		require.NoError(err)
+		assert.Equal(tk.RefreshToken(), got.RefreshToken())
+		require.NoError(s.Write(ctx, "bob", tk))
+		data, err := ioutil.ReadFile(path)
+		require.NoError(err)
+		assert.NotContains(string(data), "refresh-token")
+		assert.Contains(string(data), `"key_id":"key-1"`)
+
+		// the file can't be read without the wrapper
+		_, err = plain.Read(ctx, "alice")
+		require.Error(err)
+		assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+
+		// after a rotation, the file is readable and is re-encrypted with the
+		// new key when it's written
+		require.NoError(w.Rotate("key-2", []byte("fedcba9876543210")))
+		_, err = s.Read(ctx, "alice")
+		require.NoError(err)
+		require.NoError(s.Write(ctx, "carol", tk))
+		data, err = ioutil.ReadFile(path)
+		require.NoError(err)
+		assert.Contains(string(data), `"key_id":"key-2"`)
+		require.NoError(w.RemoveKey("key-1"))
+		got, err = s.Read(ctx, "bob")
+		require.NoError(err)
+		assert.Equal(tk.AccessToken(), got.AccessToken())
+
+		// the file can't be decrypted with a different key
+		other, err := oidc.NewAESGCMWrapper("key-2", []byte("0000000000000000"))
+		require.NoError(err)
+		s, err = NewFileTokenStore(path, WithWrapper(other))
+		require.NoError(err)
+		_, err = s.Read(ctx, "bob")
+		require.Error(err)
+		assert.Truef(errors.Is(err, oidc.ErrDecryptionFailed), "wanted \"%s\" but got \"%s\"", oidc.ErrDecryptionFailed, err)
+	})
+	t.Run("file-versions", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		path := filepath.Join(t.TempDir(), "tokens.json")
+		s, err := NewFileTokenStore(path)
+		require.NoError(err)
+
+		// an unversioned file is migrated, and written in the current format
+		legacy := `{"alice":{"id_token":"id-token","access_token":"access-token","refresh_token":"refresh-token","expiry":"2030-01-02T03:04:05Z"}}`
+		require.NoError(ioutil.WriteFile(path, []byte(legacy), 0600))
+		got, err := s.Read(ctx, "alice")
+		require.NoError(err)
+		assert.Equal(oidc.IDToken("id-token"), got.IDToken())
+		assert.Equal(oidc.RefreshToken("refresh-token"), got.RefreshToken())
+		assert.True(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC).Equal(got.Expiry()))
+		require.NoError(s.Write(ctx, "bob", got))
+		data, err := ioutil.ReadFile(path)
+		require.NoError(err)
+		assert.Contains(string(data), `"version":1`)
+		got, err = s.Read(ctx, "alice")
+		require.NoError(err)
+		assert.Equal(oidc.AccessToken("access-token"), got.AccessToken())
+
+		// a file written by a newer version can't be read
+		require.NoError(ioutil.WriteFile(path, []byte(`{"version":2,"tokens":{}}`), 0600))
+		_, err = s.Read(ctx, "alice")
+		require.Error(err)
+		assert.Truef(errors.Is(err, oidc.ErrUnsupportedFormatVersion), "wanted \"%s\" but got \"%s\"", oidc.ErrUnsupportedFormatVersion, err)
+	})
+}
@@ -0,0 +1,52 @@
+package oidc
+
+import "time"
+
+// Clock is a source of the current time.  A provider's clock (see WithClock)
+// is used for its expiration and skew checks: verifying id_tokens, logout
+// tokens and userinfo responses, the expiration of its tokens and of the
+// requests it creates (see Provider.NewRequest), and its client assertions
+// and DPoP proofs.  This allows tests and simulation environments to control
+// the time of the provider's flows.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// ClockFunc is an adapter which allows a func to be used as a Clock.
+type ClockFunc func() time.Time
+
+// Now satisfies the Clock interface.
+func (f ClockFunc) Now() time.Time { return f() }
+
+// WithClock provides an optional Clock for the config's provider, and is
+// the same as WithNow(c.Now).  A nil Clock is ignored.
+//
+// Valid for: Config
+func WithClock(c Clock) Option {
+	return func(o interface{}) {
+		if c == nil {
+			return
+		}
+		if o, ok := o.(*configOptions); ok {
+			o.withNowFunc = c.Now
+		}
+	}
+}
+
+// DefaultClockSkew is the default leeway for the nbf, iat and auth_time
+// claims of id_tokens and logout tokens (see Config.ClockSkew).
+const DefaultClockSkew = time.Minute
+
+// WithClockSkew provides an optional clock skew which is allowed when
+// verifying the exp, nbf, iat and auth_time claims of the provider's
+// id_tokens and logout tokens (see Config.ClockSkew).
+//
+// Valid for: Config
+func WithClockSkew(d time.Duration) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withClockSkew = d
+		}
+	}
+}
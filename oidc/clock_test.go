@@ -0,0 +1,186 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// testClock is a Clock whose time only changes when it's advanced.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestWithClock(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	priv, _, alg, _ := tp.SigningKeys()
+	redirect := "https://example.com/callback"
+
+	// the provider's clock is an hour behind
+	clock := &testClock{now: time.Now().Add(-time.Hour)}
+	tc := testNewConfig(t, "client-id", "client-secret", redirect, tp)
+	c, err := NewConfig(tc.Issuer, tc.ClientID, tc.ClientSecret, tc.SupportedSigningAlgs, tc.AllowedRedirectURLs, WithProviderCA(tc.ProviderCA), WithClock(clock))
+	require.NoError(t, err)
+	assert.Equal(t, clock.Now(), c.Now())
+	p, err := NewProvider(c)
+	require.NoError(t, err)
+	t.Cleanup(p.Done)
+
+	t.Run("verify-id-token", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		oidcRequest, err := p.NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		idToken := TestSignJWT(t, priv, alg, map[string]interface{}{
+			"iss":   tp.Addr(),
+			"aud":   "client-id",
+			"sub":   "alice@example.com",
+			"nonce": oidcRequest.Nonce(),
+			"iat":   clock.Now().Unix(),
+			"exp":   clock.Now().Add(time.Minute).Unix(),
+		}, nil)
+		// the id_token expired an hour ago, but not according to the clock
+		_, err = p.VerifyIDToken(ctx, IDToken(idToken), oidcRequest)
+		require.NoError(err)
+		assert.False(oidcRequest.IsExpired())
+	})
+	t.Run("request-expiration", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		clock := &testClock{now: time.Now()}
+		c := p.Config()
+		c.NowFunc = clock.Now
+		p, err := NewProvider(c)
+		require.NoError(err)
+		defer p.Done()
+		oidcRequest, err := p.NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		assert.False(oidcRequest.IsExpired())
+		clock.advance(2 * time.Minute)
+		assert.True(oidcRequest.IsExpired())
+	})
+	t.Run("token-expiration", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		clock := &testClock{now: time.Now()}
+		tk, err := NewToken(IDToken("header.payload.signature"), &oauth2.Token{AccessToken: "access-token", Expiry: clock.Now().Add(time.Minute)}, WithNow(clock.Now))
+		require.NoError(err)
+		assert.True(tk.Valid())
+		clock.advance(2 * time.Minute)
+		assert.True(tk.IsExpired())
+		assert.False(tk.Valid())
+	})
+	t.Run("nil-clock", func(t *testing.T) {
+		c, err := NewConfig(tc.Issuer, tc.ClientID, tc.ClientSecret, tc.SupportedSigningAlgs, tc.AllowedRedirectURLs, WithClock(nil))
+		require.NoError(t, err)
+		assert.Nil(t, c.NowFunc)
+	})
+}
+
+func TestProvider_VerifyIDToken_clockSkew(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	priv, _, alg, _ := tp.SigningKeys()
+	redirect := "https://example.com/callback"
+
+	tc := testNewConfig(t, "client-id", "client-secret", redirect, tp)
+	p := testNewProvider(t, "client-id", "client-secret", redirect, tp)
+	skewed, err := NewConfig(tc.Issuer, tc.ClientID, tc.ClientSecret, tc.SupportedSigningAlgs, tc.AllowedRedirectURLs, WithProviderCA(tc.ProviderCA), WithClockSkew(5*time.Minute))
+	require.NoError(t, err)
+	skewedProvider, err := NewProvider(skewed)
+	require.NoError(t, err)
+	t.Cleanup(skewedProvider.Done)
+
+	now := time.Now()
+	tests := []struct {
+		name          string
+		claims        map[string]interface{}
+		wantErr       error
+		wantSkewedErr error
+	}{
+		{
+			name:   "valid",
+			claims: map[string]interface{}{},
+		},
+		{
+			name:    "iat-ahead",
+			claims:  map[string]interface{}{"iat": now.Add(3 * time.Minute).Unix()},
+			wantErr: ErrInvalidIssuedAt,
+		},
+		{
+			name:    "nbf-ahead",
+			claims:  map[string]interface{}{"nbf": now.Add(3 * time.Minute).Unix()},
+			wantErr: ErrInvalidNotBefore,
+		},
+		{
+			name:    "exp-behind",
+			claims:  map[string]interface{}{"exp": now.Add(-3 * time.Minute).Unix()},
+			wantErr: ErrExpiredToken,
+		},
+		{
+			name:          "nbf-beyond-skew",
+			claims:        map[string]interface{}{"nbf": now.Add(10 * time.Minute).Unix()},
+			wantErr:       ErrInvalidNotBefore,
+			wantSkewedErr: ErrInvalidNotBefore,
+		},
+		{
+			name:          "exp-beyond-skew",
+			claims:        map[string]interface{}{"exp": now.Add(-10 * time.Minute).Unix()},
+			wantErr:       ErrExpiredToken,
+			wantSkewedErr: ErrExpiredToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			oidcRequest, err := NewRequest(time.Minute, redirect)
+			require.NoError(err)
+			claims := map[string]interface{}{
+				"iss":   tp.Addr(),
+				"aud":   "client-id",
+				"sub":   "alice@example.com",
+				"nonce": oidcRequest.Nonce(),
+				"iat":   now.Unix(),
+				"exp":   now.Add(time.Minute).Unix(),
+			}
+			for k, v := range tt.claims {
+				claims[k] = v
+			}
+			idToken := IDToken(TestSignJWT(t, priv, alg, claims, nil))
+			for _, v := range []struct {
+				p       *Provider
+				wantErr error
+			}{{p, tt.wantErr}, {skewedProvider, tt.wantSkewedErr}} {
+				_, err := v.p.VerifyIDToken(ctx, idToken, oidcRequest)
+				if v.wantErr != nil {
+					require.Truef(errors.Is(err, v.wantErr), "wanted \"%s\" but got \"%s\"", v.wantErr, err)
+					continue
+				}
+				require.NoError(err)
+			}
+		})
+	}
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewConfig(tc.Issuer, tc.ClientID, tc.ClientSecret, tc.SupportedSigningAlgs, tc.AllowedRedirectURLs, WithClockSkew(-time.Second))
+		assert.Truef(t, errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
@@ -0,0 +1,198 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Close gracefully shuts down the provider, so long-running servers can
+// release its resources while draining.  Close will:
+//
+//   * revoke the refresh tokens provided via the WithRevokeRefreshTokens
+//   option using the provider's revocation_endpoint.
+//
+//   * stop the provider's background activities (health checks, lazy
+//   discovery and JWKS refreshes) and wait for them to return.
+//
+//   * close the idle connections of the provider's http client, unless its
+//   transport is shared via a TransportRegistry.
+//
+// The ctx bounds the revocations and the wait for the background activities.
+// The provider is always shut down, even when a revocation fails, and the
+// first revocation error is returned (see OAuthError).  Close may be called
+// instead of Provider.Done(), and it's safe to call both.
+//
+// Supported options: WithRevokeRefreshTokens
+func (p *Provider) Close(ctx context.Context, opt ...Option) error {
+	const op = "Provider.Close"
+	if p == nil {
+		return nil
+	}
+	if ctx == nil {
+		return fmt.Errorf("%s: context is nil: %w", op, ErrNilParameter)
+	}
+	opts := getCloseOpts(opt...)
+	for _, t := range opts.withRevokeRefreshTokens {
+		if t == "" {
+			return fmt.Errorf("%s: refresh_token to revoke is empty: %w", op, ErrInvalidParameter)
+		}
+	}
+	var revokeErr error
+	if len(opts.withRevokeRefreshTokens) > 0 {
+		revokeErr = p.revokeRefreshTokens(ctx, opts.withRevokeRefreshTokens)
+	}
+
+	p.Done()
+	stopped := make(chan struct{})
+	go func() {
+		p.background.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		return fmt.Errorf("%s: background activities did not stop: %w", op, ctx.Err())
+	}
+
+	// the background activities may have opened connections before they
+	// stopped, so their idle connections are closed as well.
+	p.mu.RLock()
+	if p.client != nil && !p.sharedTransport {
+		p.client.CloseIdleConnections()
+	}
+	p.mu.RUnlock()
+
+	if revokeErr != nil {
+		return fmt.Errorf("%s: %w", op, revokeErr)
+	}
+	return nil
+}
+
+// RevokeRefreshTokens revokes the refresh tokens using the provider's
+// revocation_endpoint, which invalidates them (and, depending on the provider,
+// their access tokens) when a user logs out.  Every token is revoked, even
+// when a revocation fails, and the first revocation error is returned (see
+// OAuthError).
+func (p *Provider) RevokeRefreshTokens(ctx context.Context, tokens ...RefreshToken) error {
+	const op = "Provider.RevokeRefreshTokens"
+	for _, t := range tokens {
+		if t == "" {
+			return fmt.Errorf("%s: refresh_token to revoke is empty: %w", op, ErrInvalidParameter)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	if err := p.revokeRefreshTokens(ctx, tokens); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// revokeRefreshTokens revokes every token using the provider's
+// revocation_endpoint, and returns the first revocation error.  The requests
+// share the token endpoint's response and rate limits.
+func (p *Provider) revokeRefreshTokens(ctx context.Context, tokens []RefreshToken) error {
+	const op = "Provider.revokeRefreshTokens"
+	config := p.currentConfig()
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	provider, _, err := p.discovered(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	var m providerMetadata
+	if err := provider.Claims(&m); err != nil {
+		return fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+	}
+	if m.RevocationEndpoint == "" {
+		return fmt.Errorf("%s: provider doesn't have a revocation_endpoint: %w", op, ErrRevocationFailed)
+	}
+	client, err := p.HTTPClient()
+	if err != nil {
+		return fmt.Errorf("%s: unable to create http client: %w", op, err)
+	}
+	client = p.endpointClient(client, tokenEndpoint)
+	var firstErr error
+	for _, t := range tokens {
+		if err := revokeToken(ctx, client, config, m.RevocationEndpoint, string(t), "refresh_token"); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return firstErr
+}
+
+// revokeToken revokes the token using the revocation endpoint.  The client
+// authenticates with its secret using basic auth, and a public client (without
+// a secret) includes its client_id.  See:
+// https://tools.ietf.org/html/rfc7009#section-2.1
+func revokeToken(ctx context.Context, client *http.Client, config *Config, endpoint, token, tokenTypeHint string) error {
+	const op = "revokeToken"
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {tokenTypeHint},
+	}
+	if config.ClientSecret == "" {
+		form.Set("client_id", config.ClientID)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%s: unable to create request: %s: %w", op, err, ErrRevocationFailed)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(string(config.ClientSecret)))
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", op, err, ErrRevocationFailed)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: unable to read response body: %s: %w", op, err, ErrRevocationFailed)
+	}
+	if resp.StatusCode != http.StatusOK {
+		oauthErr := parseOAuthErrorBody(body)
+		oauthErr.StatusCode = resp.StatusCode
+		oauthErr.err = fmt.Errorf("%s: %s %s: %w", op, resp.Status, body, ErrRevocationFailed)
+		return oauthErr
+	}
+	return nil
+}
+
+// closeOptions is the set of available options for Provider.Close
+type closeOptions struct {
+	withRevokeRefreshTokens []RefreshToken
+}
+
+// closeDefaults is a handy way to get the defaults at runtime and during unit
+// tests.
+func closeDefaults() closeOptions {
+	return closeOptions{}
+}
+
+// getCloseOpts gets the Provider.Close defaults and applies the opt overrides
+// passed in
+func getCloseOpts(opt ...Option) closeOptions {
+	opts := closeDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithRevokeRefreshTokens provides optional refresh tokens that are revoked
+// when the provider is closed, which allows a server that manages refresh
+// tokens on behalf of its users to revoke them while it's drained.
+//
+// Valid for: Provider.Close
+func WithRevokeRefreshTokens(tokens ...RefreshToken) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*closeOptions); ok {
+			o.withRevokeRefreshTokens = append(o.withRevokeRefreshTokens, tokens...)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_Close(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	type revocation struct {
+		token, hint, clientID, clientSecret string
+	}
+	newProvider := func(t *testing.T, withRevocation bool, status int) (*Provider, func() []revocation) {
+		t.Helper()
+		var mu sync.Mutex
+		var revoked []revocation
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/revoke":
+				id, secret, _ := req.BasicAuth()
+				mu.Lock()
+				revoked = append(revoked, revocation{
+					token:        req.FormValue("token"),
+					hint:         req.FormValue("token_type_hint"),
+					clientID:     id,
+					clientSecret: secret,
+				})
+				mu.Unlock()
+				w.WriteHeader(status)
+				if status != http.StatusOK {
+					_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+				}
+			default:
+				doc := map[string]interface{}{
+					"issuer":   srv.URL,
+					"jwks_uri": srv.URL + "/jwks",
+				}
+				if withRevocation {
+					doc["revocation_endpoint"] = srv.URL + "/revoke"
+				}
+				_ = json.NewEncoder(w).Encode(doc)
+			}
+		}))
+		t.Cleanup(srv.Close)
+		c, err := NewConfig(srv.URL, "client-id", "client-secret", []Alg{ES256}, []string{"https://redirect"})
+		require.NoError(t, err)
+		p, err := NewProvider(c)
+		require.NoError(t, err)
+		t.Cleanup(p.Done)
+		return p, func() []revocation {
+			mu.Lock()
+			defer mu.Unlock()
+			return revoked
+		}
+	}
+
+	t.Run("revoke-refresh-tokens", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, revoked := newProvider(t, true, http.StatusOK)
+		err := p.Close(ctx, WithRevokeRefreshTokens("refresh-1", "refresh-2"))
+		require.NoError(err)
+		assert.Equal([]revocation{
+			{token: "refresh-1", hint: "refresh_token", clientID: "client-id", clientSecret: "client-secret"},
+			{token: "refresh-2", hint: "refresh_token", clientID: "client-id", clientSecret: "client-secret"},
+		}, revoked())
+		assert.Error(p.backgroundCtx.Err())
+	})
+	t.Run("revocation-error", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, revoked := newProvider(t, true, http.StatusUnauthorized)
+		err := p.Close(ctx, WithRevokeRefreshTokens("refresh-1", "refresh-2"))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrRevocationFailed), "wanted \"%s\" but got \"%s\"", ErrRevocationFailed, err)
+		var oauthErr *OAuthError
+		require.True(errors.As(err, &oauthErr))
+		assert.Equal("invalid_client", oauthErr.Code)
+		assert.Equal(http.StatusUnauthorized, oauthErr.StatusCode)
+		// every token is revoked and the provider is shut down regardless
+		assert.Len(revoked(), 2)
+		assert.Error(p.backgroundCtx.Err())
+	})
+	t.Run("missing-revocation-endpoint", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, _ := newProvider(t, false, http.StatusOK)
+		err := p.Close(ctx, WithRevokeRefreshTokens("refresh-1"))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrRevocationFailed), "wanted \"%s\" but got \"%s\"", ErrRevocationFailed, err)
+		assert.Error(p.backgroundCtx.Err())
+	})
+	t.Run("empty-refresh-token", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, revoked := newProvider(t, true, http.StatusOK)
+		err := p.Close(ctx, WithRevokeRefreshTokens("refresh-1", ""))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+		assert.Empty(revoked())
+	})
+	t.Run("stops-health-checks", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, _ := newProvider(t, false, http.StatusOK)
+		require.NoError(p.StartHealthChecks(time.Hour))
+		require.NoError(p.Close(ctx))
+		p.health.mu.Lock()
+		running := p.health.running
+		p.health.mu.Unlock()
+		assert.False(running)
+
+		// it's safe to call Done and Close again
+		p.Done()
+		require.NoError(p.Close(ctx))
+		err := p.StartHealthChecks(time.Hour)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("nil-ctx", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, _ := newProvider(t, false, http.StatusOK)
+		//nolint:staticcheck // testing a nil ctx
+		err := p.Close(nil)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+	t.Run("nil-provider", func(t *testing.T) {
+		var p *Provider
+		require.NoError(t, p.Close(ctx))
+	})
+}
+
+func Test_WithRevokeRefreshTokens(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	opts := getCloseOpts(WithRevokeRefreshTokens("refresh-1"), WithRevokeRefreshTokens("refresh-2"))
+	testOpts := closeDefaults()
+	testOpts.withRevokeRefreshTokens = []RefreshToken{"refresh-1", "refresh-2"}
+	assert.Equal(opts, testOpts)
+}
+
+func TestProvider_RevokeRefreshTokens(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	var mu sync.Mutex
+	var revoked []string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/revoke":
+			mu.Lock()
+			revoked = append(revoked, req.FormValue("token"))
+			mu.Unlock()
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"issuer":              srv.URL,
+				"jwks_uri":            srv.URL + "/jwks",
+				"revocation_endpoint": srv.URL + "/revoke",
+			})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	c, err := NewConfig(srv.URL, "client-id", "client-secret", []Alg{ES256}, []string{"https://redirect"})
+	require.NoError(t, err)
+	p, err := NewProvider(c)
+	require.NoError(t, err)
+	t.Cleanup(p.Done)
+
+	assert, require := assert.New(t), require.New(t)
+	require.NoError(p.RevokeRefreshTokens(ctx))
+	require.NoError(p.RevokeRefreshTokens(ctx, "refresh-1", "refresh-2"))
+	err = p.RevokeRefreshTokens(ctx, "refresh-3", "")
+	require.Error(err)
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal([]string{"refresh-1", "refresh-2"}, revoked)
+	// the provider isn't shut down
+	assert.NoError(p.backgroundCtx.Err())
+}
@@ -2,6 +2,7 @@ package oidc
 
 import (
 	"bytes"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
@@ -64,11 +65,27 @@ type Config struct {
 	// access_token, etc.
 	SupportedSigningAlgs []Alg
 
+	// UserInfoSigningAlgs is an optional list of supported signing algorithms
+	// for signed userinfo responses, for providers which sign them with
+	// different keys or algorithms than id_tokens.  If it's empty, the
+	// SupportedSigningAlgs are used.
+	UserInfoSigningAlgs []Alg
+
+	// LogoutTokenSigningAlgs is an optional list of supported signing
+	// algorithms for back-channel logout tokens, for providers which sign
+	// them with different keys or algorithms than id_tokens.  If it's empty,
+	// the SupportedSigningAlgs are used.
+	LogoutTokenSigningAlgs []Alg
+
 	// AllowedRedirectURLs is a list of allowed URLs for the provider to
 	// redirect to after a user authenticates.  If AllowedRedirects is empty,
 	// the package will not check the Request.RedirectURL() to see if it's
 	// allowed, and the check will be left to the OIDC provider's /authorize
 	// endpoint.
+	//
+	// An app serving multiple hostnames can register a redirect URL for each
+	// of them, and select one per Request (see Provider.NewRequest and
+	// Provider.RedirectURLForHost).
 	AllowedRedirectURLs []string
 
 	// Audiences is an optional default list of case-sensitive strings to use when
@@ -83,8 +100,103 @@ type Config struct {
 	// see EncodeCertificates(...) to PEM encode them.
 	ProviderCA string
 
-	// NowFunc is a time func that returns the current time.
+	// NowFunc is a time func that returns the current time, which is the
+	// provider's clock (see Clock and WithClock).
 	NowFunc func() time.Time
+
+	// ClockSkew is the allowed clock skew between the provider and the
+	// client when verifying id_tokens and logout tokens: their exp, nbf, iat
+	// and auth_time claims are verified with a leeway of the ClockSkew.  When
+	// it's zero, the nbf, iat and auth_time claims are verified with a leeway
+	// of DefaultClockSkew, and the exp claim is verified without one.
+	ClockSkew time.Duration
+
+	// JWKSCache is an optional cache for the provider's JSON Web Key Set. If
+	// it's nil, the process-wide DefaultJWKSCache() is used.
+	JWKSCache *JWKSCache
+
+	// TransportRegistry is an optional registry of http transports which are
+	// shared by providers with the same ProviderCA.  If it's nil, the
+	// provider creates its own transport.
+	TransportRegistry *TransportRegistry
+
+	// ResponseModes is an optional list of extension response modes (like
+	// "web_message") which may be used by Requests, in addition to the query,
+	// fragment and form_post response modes.
+	ResponseModes []ResponseMode
+
+	// Profile is an optional compatibility profile for the provider's IdP,
+	// which adjusts the provider for the IdP's known deviations from the
+	// specification.
+	Profile Profile
+
+	// Prompts is an optional default list of prompt values for the provider's
+	// authentication requests (like select_account).  If a Request has
+	// prompts, they will override this configured list for a specific
+	// authentication attempt.
+	Prompts []Prompt
+
+	// Display is an optional default display value for the provider's
+	// authentication requests.  If a Request has a display value, it will
+	// override this configured value for a specific authentication attempt.
+	Display Display
+
+	// ClientAssertionSigner is an optional signer for private_key_jwt client
+	// authentication.  When it's set, the provider's token endpoint requests
+	// (and revocation requests) authenticate the client with a signed client
+	// assertion rather than its ClientSecret.
+	ClientAssertionSigner *JWTSigner
+
+	// ClientSecretJWTAlg is an optional HMAC algorithm (HS256, HS384 or
+	// HS512) for client_secret_jwt client authentication.  When it's set, the
+	// provider's token endpoint requests (and revocation requests)
+	// authenticate the client with a client assertion HMAC-signed with its
+	// ClientSecret, rather than sending the ClientSecret.  It can't be used
+	// with a ClientAssertionSigner.
+	ClientSecretJWTAlg Alg
+
+	// JWKSPins optionally restrict the keys accepted from the provider's
+	// jwks_uri.  If it's nil, every published key is accepted.
+	JWKSPins *JWKSPins
+
+	// ClientCertificates are optional client certificates for mutual TLS with
+	// the provider, which are used for tls_client_auth client authentication
+	// and certificate-bound (sender-constrained) access tokens.  They can't be
+	// used with a TransportRegistry, since its transports are shared.  See:
+	// https://tools.ietf.org/html/rfc8705
+	ClientCertificates []tls.Certificate
+
+	// DPoPKey is an optional key for DPoP sender-constrained access tokens.
+	// When it's set, the provider's token endpoint and userinfo requests
+	// include a DPoP proof signed by the key, and the access tokens returned
+	// by Provider.Exchange and Provider.RefreshToken must be bound to it.
+	// See: https://tools.ietf.org/html/rfc9449
+	DPoPKey *DPoPKey
+
+	// IDTokenDecryptionKeys are optional keys for decrypting the provider's
+	// encrypted (JWE) id_tokens, when the client is registered with an
+	// id_token_encrypted_response_alg.  An encrypted id_token is decrypted
+	// before its signature is verified, and is rejected when the config
+	// doesn't have a key which can decrypt it.
+	IDTokenDecryptionKeys []DecryptionKey
+
+	// UserInfoURL is an optional userinfo endpoint, which overrides the
+	// provider's advertised userinfo_endpoint.  It's useful for providers
+	// that have a userinfo endpoint, but don't advertise it in their
+	// discovery document.
+	UserInfoURL string
+
+	// ProviderMetadata is optional static metadata for the provider, which
+	// is used instead of its discovery document.  It's useful for providers
+	// which don't have a /.well-known/openid-configuration, since the
+	// provider is created without a discovery request.  A provider picks up
+	// changed metadata (see Provider.UpdateConfig) when its metadata is
+	// refreshed (see Provider.RefreshMetadata).
+	ProviderMetadata *ProviderMetadata
+
+	// FAPI enforces the FAPI 2.0 security profile's requirements for the
+	// provider's flows (see WithFAPIProfile).
+	FAPI bool
 }
 
 // NewConfig composes a new config for a provider.
@@ -93,20 +205,50 @@ type Config struct {
 // regardless of what additional scopes are requested via the WithScopes option
 // and duplicate scopes are allowed.
 //
-// Supported options: WithProviderCA, WithScopes, WithAudiences, WithNow
+// When the ProfileAuth0 profile is used, a trailing slash is added to the
+// issuer when it's missing.
+//
+// Supported options: WithProviderCA, WithScopes, WithAudiences, WithNow,
+// WithJWKSCache, WithTransportRegistry, WithResponseModes, WithProfile,
+// WithPrompts, WithDisplay, WithClientAssertionSigner, WithClientSecretJWT,
+// WithJWKSPins, WithUserInfoSigningAlgs, WithLogoutTokenSigningAlgs,
+// WithClientCertificates, WithFAPIProfile, WithDPoPKey,
+// WithIDTokenDecryptionKeys, WithUserInfoURL, WithProviderMetadata, WithClock,
+// WithClockSkew
 func NewConfig(issuer string, clientID string, clientSecret ClientSecret, supported []Alg, allowedRedirectURLs []string, opt ...Option) (*Config, error) {
 	const op = "NewConfig"
 	opts := getConfigOpts(opt...)
 	c := &Config{
-		Issuer:               issuer,
-		ClientID:             clientID,
-		ClientSecret:         clientSecret,
-		SupportedSigningAlgs: supported,
-		Scopes:               opts.withScopes,
-		ProviderCA:           opts.withProviderCA,
-		Audiences:            opts.withAudiences,
-		NowFunc:              opts.withNowFunc,
-		AllowedRedirectURLs:  allowedRedirectURLs,
+		Issuer:                 issuer,
+		ClientID:               clientID,
+		ClientSecret:           clientSecret,
+		SupportedSigningAlgs:   supported,
+		Scopes:                 opts.withScopes,
+		ProviderCA:             opts.withProviderCA,
+		Audiences:              opts.withAudiences,
+		NowFunc:                opts.withNowFunc,
+		ClockSkew:              opts.withClockSkew,
+		AllowedRedirectURLs:    allowedRedirectURLs,
+		JWKSCache:              opts.withJWKSCache,
+		TransportRegistry:      opts.withTransportRegistry,
+		ResponseModes:          opts.withResponseModes,
+		Profile:                opts.withProfile,
+		Prompts:                opts.withPrompts,
+		Display:                opts.withDisplay,
+		ClientAssertionSigner:  opts.withClientAssertionSigner,
+		ClientSecretJWTAlg:     opts.withClientSecretJWTAlg,
+		JWKSPins:               opts.withJWKSPins,
+		UserInfoSigningAlgs:    opts.withUserInfoSigningAlgs,
+		LogoutTokenSigningAlgs: opts.withLogoutTokenSigningAlgs,
+		ClientCertificates:     opts.withClientCertificates,
+		DPoPKey:                opts.withDPoPKey,
+		IDTokenDecryptionKeys:  opts.withIDTokenDecryptionKeys,
+		UserInfoURL:            opts.withUserInfoURL,
+		ProviderMetadata:       opts.withProviderMetadata,
+		FAPI:                   opts.withFAPI,
+	}
+	if c.quirks().issuerTrailingSlash && !strings.HasSuffix(c.Issuer, "/") {
+		c.Issuer += "/"
 	}
 	if err := c.Validate(); err != nil {
 		return nil, fmt.Errorf("%s: invalid provider config: %w", op, err)
@@ -160,12 +302,72 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("%s: unsupported algorithm %s: %w", op, a, ErrInvalidParameter)
 		}
 	}
+	for _, a := range append(copyAlgs(c.UserInfoSigningAlgs), c.LogoutTokenSigningAlgs...) {
+		if !supportedAlgorithms[a] {
+			return fmt.Errorf("%s: unsupported algorithm %s: %w", op, a, ErrInvalidParameter)
+		}
+	}
+	if err := validProfile(c.Profile); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, m := range c.ResponseModes {
+		if err := validResponseMode(m); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if len(c.Prompts) > 1 {
+		for _, p := range c.Prompts {
+			if p == None {
+				return fmt.Errorf(`%s: prompts (%s) includes "none" with other values: %w`, op, c.Prompts, ErrInvalidParameter)
+			}
+		}
+	}
+	if c.ClientSecretJWTAlg != "" {
+		switch {
+		case !hmacAlgorithms[c.ClientSecretJWTAlg]:
+			return fmt.Errorf("%s: client_secret_jwt algorithm %s is not an HMAC algorithm: %w", op, c.ClientSecretJWTAlg, ErrInvalidParameter)
+		case c.ClientSecret == "":
+			return fmt.Errorf("%s: client_secret_jwt requires a client secret: %w", op, ErrInvalidParameter)
+		case c.ClientAssertionSigner != nil:
+			return fmt.Errorf("%s: client_secret_jwt can't be used with a client assertion signer: %w", op, ErrInvalidParameter)
+		}
+	}
+	if c.JWKSPins != nil {
+		if err := c.JWKSPins.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
 	if c.ProviderCA != "" {
 		certPool := x509.NewCertPool()
 		if ok := certPool.AppendCertsFromPEM([]byte(c.ProviderCA)); !ok {
 			return fmt.Errorf("%s: %w", op, ErrInvalidCACert)
 		}
 	}
+	if err := validDecryptionKeys(c.IDTokenDecryptionKeys); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if c.ClockSkew < 0 {
+		return fmt.Errorf("%s: clock skew must not be negative: %w", op, ErrInvalidParameter)
+	}
+	if c.UserInfoURL != "" {
+		u, err := url.Parse(c.UserInfoURL)
+		if err != nil || !strutils.StrListContains([]string{"https", "http"}, u.Scheme) || u.Host == "" {
+			return fmt.Errorf("%s: userinfo URL %s is not an http or https URL: %w", op, c.UserInfoURL, ErrInvalidParameter)
+		}
+	}
+	if c.ProviderMetadata != nil {
+		if err := c.ProviderMetadata.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if len(c.ClientCertificates) > 0 && c.TransportRegistry != nil {
+		return fmt.Errorf("%s: client certificates can't be used with a transport registry: %w", op, ErrInvalidParameter)
+	}
+	if c.FAPI {
+		if err := c.validFAPI(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
 	return nil
 }
 
@@ -177,12 +379,76 @@ func (c *Config) Now() time.Time {
 	return time.Now() // fallback to this default
 }
 
+// copy returns a copy of the config, including copies of its slices.
+func (c *Config) copy() *Config {
+	if c == nil {
+		return nil
+	}
+	cp := *c
+	cp.Scopes = copyStrings(c.Scopes)
+	cp.AllowedRedirectURLs = copyStrings(c.AllowedRedirectURLs)
+	cp.Audiences = copyStrings(c.Audiences)
+	if c.SupportedSigningAlgs != nil {
+		cp.SupportedSigningAlgs = make([]Alg, len(c.SupportedSigningAlgs))
+		copy(cp.SupportedSigningAlgs, c.SupportedSigningAlgs)
+	}
+	cp.UserInfoSigningAlgs = copyAlgs(c.UserInfoSigningAlgs)
+	cp.LogoutTokenSigningAlgs = copyAlgs(c.LogoutTokenSigningAlgs)
+	if c.ResponseModes != nil {
+		cp.ResponseModes = make([]ResponseMode, len(c.ResponseModes))
+		copy(cp.ResponseModes, c.ResponseModes)
+	}
+	if c.Prompts != nil {
+		cp.Prompts = make([]Prompt, len(c.Prompts))
+		copy(cp.Prompts, c.Prompts)
+	}
+	cp.JWKSPins = c.JWKSPins.copy()
+	if c.ClientCertificates != nil {
+		cp.ClientCertificates = make([]tls.Certificate, len(c.ClientCertificates))
+		copy(cp.ClientCertificates, c.ClientCertificates)
+	}
+	if c.IDTokenDecryptionKeys != nil {
+		cp.IDTokenDecryptionKeys = make([]DecryptionKey, len(c.IDTokenDecryptionKeys))
+		copy(cp.IDTokenDecryptionKeys, c.IDTokenDecryptionKeys)
+	}
+	cp.ProviderMetadata = c.ProviderMetadata.copy()
+	return &cp
+}
+
+// copyStrings returns a copy of the slice or nil if the slice is nil.
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	cp := make([]string, len(s))
+	copy(cp, s)
+	return cp
+}
+
 // configOptions is the set of available options
 type configOptions struct {
-	withScopes     []string
-	withAudiences  []string
-	withProviderCA string
-	withNowFunc    func() time.Time
+	withScopes                 []string
+	withAudiences              []string
+	withProviderCA             string
+	withNowFunc                func() time.Time
+	withClockSkew              time.Duration
+	withJWKSCache              *JWKSCache
+	withTransportRegistry      *TransportRegistry
+	withResponseModes          []ResponseMode
+	withProfile                Profile
+	withPrompts                []Prompt
+	withDisplay                Display
+	withClientAssertionSigner  *JWTSigner
+	withClientSecretJWTAlg     Alg
+	withJWKSPins               *JWKSPins
+	withUserInfoSigningAlgs    []Alg
+	withLogoutTokenSigningAlgs []Alg
+	withClientCertificates     []tls.Certificate
+	withDPoPKey                *DPoPKey
+	withIDTokenDecryptionKeys  []DecryptionKey
+	withUserInfoURL            string
+	withProviderMetadata       *ProviderMetadata
+	withFAPI                   bool
 }
 
 // configDefaults is a handy way to get the defaults at runtime and
@@ -205,13 +471,58 @@ func getConfigOpts(opt ...Option) configOptions {
 // config.  These certs will can be used when making http requests to the
 // provider.
 //
-// Valid for: Config
+// Valid for: Config, IssuerKeySet and NewRegistrationClient
 //
 // See EncodeCertificates(...) to PEM encode a number of certs.
 func WithProviderCA(cert string) Option {
+	return func(o interface{}) {
+		switch v := o.(type) {
+		case *configOptions:
+			v.withProviderCA = cert
+		case *keySetOptions:
+			v.withProviderCA = cert
+		case *registrationOptions:
+			v.withProviderCA = cert
+		}
+	}
+}
+
+// WithJWKSCache provides an optional JWKSCache for the provider's config.
+// Providers which share a cache will share the keys fetched from a jwks_uri.
+//
+// Valid for: Config and IssuerKeySet
+func WithJWKSCache(c *JWKSCache) Option {
+	return func(o interface{}) {
+		switch v := o.(type) {
+		case *configOptions:
+			v.withJWKSCache = c
+		case *keySetOptions:
+			v.withJWKSCache = c
+		}
+	}
+}
+
+// WithTransportRegistry provides an optional TransportRegistry for the
+// provider's config.  Providers which share a registry and have the same
+// ProviderCA will share an http transport and its connection pool.
+//
+// Valid for: Config
+func WithTransportRegistry(r *TransportRegistry) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withTransportRegistry = r
+		}
+	}
+}
+
+// WithUserInfoURL provides an optional userinfo endpoint, which overrides the
+// provider's advertised userinfo_endpoint (see Config.UserInfoURL).
+//
+// Valid for: Config
+func WithUserInfoURL(u string) Option {
 	return func(o interface{}) {
 		if o, ok := o.(*configOptions); ok {
-			o.withProviderCA = cert
+			o.withUserInfoURL = u
 		}
 	}
 }
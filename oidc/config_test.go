@@ -69,6 +69,8 @@ func TestNewConfig(t *testing.T) {
 					WithScopes("email", "profile"),
 					WithProviderCA(testCaPem),
 					WithNow(testNow),
+					WithPrompts(SelectAccount),
+					WithDisplay(Popup),
 				},
 			},
 			want: &Config{
@@ -80,6 +82,8 @@ func TestNewConfig(t *testing.T) {
 				Scopes:               []string{oidc.ScopeOpenID, "email", "profile"},
 				ProviderCA:           testCaPem,
 				NowFunc:              testNow,
+				Prompts:              []Prompt{SelectAccount},
+				Display:              Popup,
 				AllowedRedirectURLs: []string{
 					"http://your_redirect_url",
 					"http://redirect_url_two",
@@ -190,6 +194,18 @@ func TestNewConfig(t *testing.T) {
 			wantErr:   true,
 			wantIsErr: ErrInvalidCACert,
 		},
+		{
+			name: "invalid-prompts",
+			args: args{
+				issuer:       "http://your_issuer/",
+				clientID:     "your_client_id",
+				clientSecret: "your_client_secret",
+				supported:    []Alg{RS512},
+				opt:          []Option{WithPrompts(None, SelectAccount)},
+			},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
 		{
 			name: "invalid-alg",
 			args: args{
@@ -223,6 +239,8 @@ func TestNewConfig(t *testing.T) {
 			assert.Equalf(tt.want.ProviderCA, got.ProviderCA, "ProviderCA = %v, want %v", got.ProviderCA, tt.want.ProviderCA)
 			testAssertEqualFunc(t, tt.want.NowFunc, got.NowFunc, "NowFunc = %p,want %p", tt.want.NowFunc, got.NowFunc)
 			assert.Equalf(tt.want.AllowedRedirectURLs, got.AllowedRedirectURLs, "AllowedRedirectURLs = %v, want %v", got.AllowedRedirectURLs, tt.want.AllowedRedirectURLs)
+			assert.Equalf(tt.want.Prompts, got.Prompts, "Prompts = %v, want %v", got.Prompts, tt.want.Prompts)
+			assert.Equalf(tt.want.Display, got.Display, "Display = %v, want %v", got.Display, tt.want.Display)
 		})
 	}
 }
@@ -0,0 +1,382 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	// DPoPHeader is the request header which contains a DPoP proof.
+	DPoPHeader = "DPoP"
+
+	// DPoPProofType is the required typ header of a DPoP proof.
+	DPoPProofType = "dpop+jwt"
+
+	// DefaultDPoPProofMaxAge is the default max age of a DPoP proof's iat
+	// (see WithDPoPProofMaxAge).
+	DefaultDPoPProofMaxAge = 5 * time.Minute
+
+	// dpopIssuedAtSkew is the allowed clock skew for a DPoP proof which was
+	// issued in the future.
+	dpopIssuedAtSkew = time.Minute
+)
+
+// Confirmation is a sender-constrained access token's confirmation (cnf)
+// claim, which binds the token to a key held by the client that presents it.
+// Resource servers verify the binding, so a stolen token can't be used
+// without the client's key.
+type Confirmation struct {
+	// X5TS256 is the base64url (no padding) encoded SHA-256 thumbprint of the
+	// client's mTLS certificate (x5t#S256), which is empty when the token
+	// isn't bound to a certificate.
+	//
+	// See: https://tools.ietf.org/html/rfc8705#section-3.1
+	X5TS256 string `json:"x5t#S256,omitempty"`
+
+	// JKT is the base64url (no padding) encoded SHA-256 thumbprint of the
+	// client's DPoP public key (jkt), which is empty when the token isn't
+	// bound to a DPoP key.
+	//
+	// See: https://tools.ietf.org/html/rfc9449#section-6.1
+	JKT string `json:"jkt,omitempty"`
+}
+
+// ConfirmationFromClaims returns the confirmation (cnf) claim of an access
+// token's verified claims (or introspection response).  An error wrapping
+// ErrMissingClaim is returned when the token doesn't have a cnf claim with an
+// x5t#S256 or jkt member.
+func ConfirmationFromClaims(claims map[string]interface{}) (*Confirmation, error) {
+	const op = "ConfirmationFromClaims"
+	raw, ok := claims["cnf"]
+	if !ok {
+		return nil, fmt.Errorf("%s: missing cnf claim: %w", op, ErrMissingClaim)
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to encode cnf claim: %w", op, err)
+	}
+	var c Confirmation
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%s: cnf claim is not a confirmation: %s: %w", op, err, ErrInvalidTokenBinding)
+	}
+	if c.X5TS256 == "" && c.JKT == "" {
+		return nil, fmt.Errorf("%s: cnf claim doesn't have a x5t#S256 or jkt member: %w", op, ErrMissingClaim)
+	}
+	return &c, nil
+}
+
+// CertificateThumbprint returns the certificate's base64url (no padding)
+// encoded SHA-256 thumbprint, which is the x5t#S256 of a token bound to it.
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCertificate verifies the confirmation's certificate binding with the
+// client certificate of the mTLS connection which presented the token.  An
+// error wrapping ErrInvalidTokenBinding is returned when the token isn't
+// bound to the certificate.
+func (c *Confirmation) VerifyCertificate(cert *x509.Certificate) error {
+	const op = "Confirmation.VerifyCertificate"
+	if cert == nil {
+		return fmt.Errorf("%s: certificate is nil: %w", op, ErrNilParameter)
+	}
+	if c.X5TS256 == "" {
+		return fmt.Errorf("%s: token isn't bound to a certificate: %w", op, ErrInvalidTokenBinding)
+	}
+	if !constantTimeEqual(c.X5TS256, CertificateThumbprint(cert)) {
+		return fmt.Errorf("%s: certificate thumbprint doesn't match x5t#S256: %w", op, ErrInvalidTokenBinding)
+	}
+	return nil
+}
+
+// VerifyDPoPProof verifies the confirmation's DPoP binding with a verified
+// DPoP proof (see VerifyDPoPProof).  An error wrapping ErrInvalidTokenBinding
+// is returned when the token isn't bound to the proof's key.
+func (c *Confirmation) VerifyDPoPProof(p *DPoPProof) error {
+	const op = "Confirmation.VerifyDPoPProof"
+	if p == nil {
+		return fmt.Errorf("%s: proof is nil: %w", op, ErrNilParameter)
+	}
+	if c.JKT == "" {
+		return fmt.Errorf("%s: token isn't bound to a DPoP key: %w", op, ErrInvalidTokenBinding)
+	}
+	if !constantTimeEqual(c.JKT, p.Thumbprint) {
+		return fmt.Errorf("%s: proof key thumbprint doesn't match jkt: %w", op, ErrInvalidTokenBinding)
+	}
+	return nil
+}
+
+// VerifyRequest verifies every binding of the confirmation with the request
+// which presented the access token: the x5t#S256 with the request's mTLS
+// client certificate, and the jkt with the request's DPoP proof (see
+// VerifyDPoPProof).  The options are passed to VerifyDPoPProof(...).
+//
+// Supported options: WithDPoPProofMaxAge, WithDPoPTargetURL, WithNow
+func (c *Confirmation) VerifyRequest(req *http.Request, t AccessToken, opt ...Option) error {
+	const op = "Confirmation.VerifyRequest"
+	if req == nil {
+		return fmt.Errorf("%s: request is nil: %w", op, ErrNilParameter)
+	}
+	if c.X5TS256 == "" && c.JKT == "" {
+		return fmt.Errorf("%s: confirmation doesn't have any bindings: %w", op, ErrInvalidTokenBinding)
+	}
+	if c.X5TS256 != "" {
+		if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+			return fmt.Errorf("%s: request doesn't have a client certificate: %w", op, ErrInvalidTokenBinding)
+		}
+		if err := c.VerifyCertificate(req.TLS.PeerCertificates[0]); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if c.JKT != "" {
+		p, err := VerifyDPoPProof(req, t, opt...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := c.VerifyDPoPProof(p); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// DPoPProof is a verified DPoP proof, which proves the client that sent a
+// request holds the private key of the proof's JWK.
+//
+// See: https://tools.ietf.org/html/rfc9449#section-4
+type DPoPProof struct {
+	// JWK is the proof's public key.
+	JWK jose.JSONWebKey
+
+	// Thumbprint is the JWK's base64url (no padding) encoded SHA-256
+	// thumbprint, which is the jkt of a token bound to it.
+	Thumbprint string
+
+	// ID is the proof's unique ID (jti), which can be used to detect replayed
+	// proofs.
+	ID string
+
+	// IssuedAt is when the proof was created (iat).
+	IssuedAt time.Time
+
+	// Claims are all of the proof's claims.
+	Claims map[string]interface{}
+}
+
+// VerifyDPoPProof verifies the DPoP proof of a request which presents the
+// access token (use an empty token for a proof sent to a token endpoint):
+//
+//   - the request has a single DPoP header with a JWT whose typ is
+//     DPoPProofType, which is signed with a supported asymmetric algorithm by
+//     the public key in its jwk header.
+//
+//   - its htm is the request's method and its htu is the request's URL
+//     (without its query and fragment), or the WithDPoPTargetURL.
+//
+//   - it has a jti, and its iat is within the WithDPoPProofMaxAge.
+//
+//   - its ath is the hash of the access token, when a token is provided.
+//
+// An error wrapping ErrInvalidTokenBinding is returned when the proof isn't
+// valid.  Replayed proofs are only detected when a WithReplayCache is
+// provided, and then an error wrapping ErrReplayDetected is returned when the
+// proof's jti was already used by its key.
+//
+// Supported options: WithDPoPProofMaxAge, WithDPoPTargetURL, WithNow,
+// WithReplayCache
+//
+// See: https://tools.ietf.org/html/rfc9449#section-4.3
+func VerifyDPoPProof(req *http.Request, t AccessToken, opt ...Option) (*DPoPProof, error) {
+	const op = "VerifyDPoPProof"
+	if req == nil {
+		return nil, fmt.Errorf("%s: request is nil: %w", op, ErrNilParameter)
+	}
+	opts := getDPoPOpts(opt...)
+	headers := req.Header.Values(DPoPHeader)
+	switch {
+	case len(headers) == 0:
+		return nil, fmt.Errorf("%s: request doesn't have a DPoP proof: %w", op, ErrInvalidTokenBinding)
+	case len(headers) > 1:
+		return nil, fmt.Errorf("%s: request has more than one DPoP proof: %w", op, ErrInvalidTokenBinding)
+	case len(headers[0]) > MaxTokenSize:
+		return nil, fmt.Errorf("%s: proof is larger than %d bytes: %w", op, MaxTokenSize, ErrInvalidTokenBinding)
+	}
+
+	jws, err := jose.ParseSigned(headers[0])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, err, ErrInvalidTokenBinding)
+	}
+	if len(jws.Signatures) != 1 {
+		return nil, fmt.Errorf("%s: proof must have a single signature: %w", op, ErrInvalidTokenBinding)
+	}
+	header := jws.Signatures[0].Header
+	if typ, _ := header.ExtraHeaders[jose.HeaderType].(string); typ != DPoPProofType {
+		return nil, fmt.Errorf("%s: proof typ is not %s: %w", op, DPoPProofType, ErrInvalidTokenBinding)
+	}
+	if !supportedAlgorithms[Alg(header.Algorithm)] {
+		return nil, fmt.Errorf("%s: %s is not a supported algorithm: %w", op, header.Algorithm, ErrInvalidTokenBinding)
+	}
+	if header.JSONWebKey == nil || !header.JSONWebKey.IsPublic() {
+		return nil, fmt.Errorf("%s: proof jwk is missing or not a public key: %w", op, ErrInvalidTokenBinding)
+	}
+	payload, err := jws.Verify(header.JSONWebKey.Key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, err, ErrInvalidTokenBinding)
+	}
+	thumbprint, err := header.JSONWebKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to compute the jwk thumbprint: %s: %w", op, err, ErrInvalidTokenBinding)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse claims: %s: %w", op, err, ErrInvalidTokenBinding)
+	}
+	var registered struct {
+		ID       string           `json:"jti"`
+		IssuedAt *jwt.NumericDate `json:"iat"`
+		Method   string           `json:"htm"`
+		URL      string           `json:"htu"`
+		Hash     string           `json:"ath"`
+	}
+	if err := json.Unmarshal(payload, &registered); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse claims: %s: %w", op, err, ErrInvalidTokenBinding)
+	}
+	targetURL := opts.withTargetURL
+	if targetURL == "" {
+		targetURL = requestTargetURL(req)
+	}
+	now := time.Now()
+	if opts.withNowFunc != nil {
+		now = opts.withNowFunc()
+	}
+	switch {
+	case registered.ID == "":
+		return nil, fmt.Errorf("%s: jti claim is missing: %w", op, ErrInvalidTokenBinding)
+	case registered.Method != req.Method:
+		return nil, fmt.Errorf("%s: htm %q is not the request's method: %w", op, registered.Method, ErrInvalidTokenBinding)
+	case !equalTargetURL(registered.URL, targetURL):
+		return nil, fmt.Errorf("%s: htu %q is not the request's URL: %w", op, registered.URL, ErrInvalidTokenBinding)
+	case registered.IssuedAt == nil:
+		return nil, fmt.Errorf("%s: iat claim is missing: %w", op, ErrInvalidTokenBinding)
+	case registered.IssuedAt.Time().After(now.Add(dpopIssuedAtSkew)):
+		return nil, fmt.Errorf("%s: proof was issued in the future at %s: %w", op, registered.IssuedAt.Time(), ErrInvalidTokenBinding)
+	case registered.IssuedAt.Time().Before(now.Add(-opts.withMaxAge)):
+		return nil, fmt.Errorf("%s: proof was issued more than %s ago: %w", op, opts.withMaxAge, ErrInvalidTokenBinding)
+	}
+	if t != "" {
+		sum := sha256.Sum256([]byte(t))
+		if !constantTimeEqual(registered.Hash, base64.RawURLEncoding.EncodeToString(sum[:])) {
+			return nil, fmt.Errorf("%s: ath is not the access token's hash: %w", op, ErrInvalidTokenBinding)
+		}
+	}
+	p := &DPoPProof{
+		JWK:        *header.JSONWebKey,
+		Thumbprint: base64.RawURLEncoding.EncodeToString(thumbprint),
+		ID:         registered.ID,
+		IssuedAt:   registered.IssuedAt.Time(),
+		Claims:     claims,
+	}
+	if opts.withReplayCache != nil {
+		// the proof can't be used after its max age, so that's when its jti
+		// expires
+		id := "dpop:" + p.Thumbprint + ":" + p.ID
+		if err := opts.withReplayCache.Add(req.Context(), id, p.IssuedAt.Add(opts.withMaxAge)); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return p, nil
+}
+
+// requestTargetURL returns the request's URL without its query and fragment,
+// as seen by the client.
+func requestTargetURL(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	u := url.URL{Scheme: scheme, Host: req.Host, Path: req.URL.Path}
+	return u.String()
+}
+
+// equalTargetURL returns true when the htu is the target URL, ignoring the
+// htu's query and fragment and the case of its scheme and host.
+func equalTargetURL(htu, target string) bool {
+	h, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	t, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(h.Scheme, t.Scheme) &&
+		strings.EqualFold(h.Host, t.Host) &&
+		h.EscapedPath() == t.EscapedPath()
+}
+
+// constantTimeEqual compares the strings in constant time.
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// dpopOptions is the set of available options for VerifyDPoPProof
+type dpopOptions struct {
+	withMaxAge      time.Duration
+	withTargetURL   string
+	withNowFunc     func() time.Time
+	withReplayCache ReplayCache
+}
+
+// dpopDefaults is a handy way to get the defaults at runtime and during unit
+// tests.
+func dpopDefaults() dpopOptions {
+	return dpopOptions{
+		withMaxAge: DefaultDPoPProofMaxAge,
+	}
+}
+
+// getDPoPOpts gets the VerifyDPoPProof defaults and applies the opt overrides
+// passed in
+func getDPoPOpts(opt ...Option) dpopOptions {
+	opts := dpopDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithDPoPProofMaxAge provides an optional max age of a DPoP proof's iat.
+//
+// Valid for: VerifyDPoPProof and Confirmation.VerifyRequest
+func WithDPoPProofMaxAge(d time.Duration) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*dpopOptions); ok && d > 0 {
+			o.withMaxAge = d
+		}
+	}
+}
+
+// WithDPoPTargetURL provides an optional URL which a DPoP proof's htu must
+// match, instead of the request's URL.  It's required when the resource
+// server is behind a proxy which changes the request's scheme, host or path.
+//
+// Valid for: VerifyDPoPProof and Confirmation.VerifyRequest
+func WithDPoPTargetURL(u string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*dpopOptions); ok {
+			o.withTargetURL = u
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// testDPoPProof returns a DPoP proof signed by a new key, and the key's
+// thumbprint.
+func testDPoPProof(t *testing.T, typ string, claims map[string]interface{}) (string, string) {
+	t.Helper()
+	require := require.New(t)
+	pub, priv := TestGenerateKeys(t)
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: priv},
+		(&jose.SignerOptions{EmbedJWK: true}).WithType(jose.ContentType(typ)),
+	)
+	require.NoError(err)
+	proof, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	require.NoError(err)
+	jkt, err := JWKThumbprint(jose.JSONWebKey{Key: pub})
+	require.NoError(err)
+	return proof, jkt
+}
+
+// testCertificate returns a new self-signed certificate.
+func testCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	require := require.New(t)
+	pub, priv := TestGenerateKeys(t)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	require.NoError(err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(err)
+	return cert
+}
+
+func TestConfirmationFromClaims(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		claims    map[string]interface{}
+		want      *Confirmation
+		wantIsErr error
+	}{
+		{
+			name:   "x5t",
+			claims: map[string]interface{}{"cnf": map[string]interface{}{"x5t#S256": "thumbprint"}},
+			want:   &Confirmation{X5TS256: "thumbprint"},
+		},
+		{
+			name:   "jkt",
+			claims: map[string]interface{}{"cnf": map[string]interface{}{"jkt": "thumbprint"}},
+			want:   &Confirmation{JKT: "thumbprint"},
+		},
+		{
+			name:      "missing-cnf",
+			claims:    map[string]interface{}{"sub": "alice"},
+			wantIsErr: ErrMissingClaim,
+		},
+		{
+			name:      "unknown-confirmation-method",
+			claims:    map[string]interface{}{"cnf": map[string]interface{}{"jwk": map[string]interface{}{}}},
+			wantIsErr: ErrMissingClaim,
+		},
+		{
+			name:      "invalid-cnf",
+			claims:    map[string]interface{}{"cnf": "thumbprint"},
+			wantIsErr: ErrInvalidTokenBinding,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert, require := assert.New(t), require.New(t)
+			got, err := ConfirmationFromClaims(tt.claims)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestConfirmation_VerifyCertificate(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	cert := testCertificate(t)
+	sum := sha256.Sum256(cert.Raw)
+	assert.Equal(base64.RawURLEncoding.EncodeToString(sum[:]), CertificateThumbprint(cert))
+
+	c := &Confirmation{X5TS256: CertificateThumbprint(cert)}
+	assert.NoError(c.VerifyCertificate(cert))
+
+	err := c.VerifyCertificate(testCertificate(t))
+	assert.Truef(errors.Is(err, ErrInvalidTokenBinding), "wanted \"%s\" but got \"%s\"", ErrInvalidTokenBinding, err)
+	err = c.VerifyCertificate(nil)
+	assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	err = (&Confirmation{JKT: "thumbprint"}).VerifyCertificate(cert)
+	assert.Truef(errors.Is(err, ErrInvalidTokenBinding), "wanted \"%s\" but got \"%s\"", ErrInvalidTokenBinding, err)
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	const accessToken = AccessToken("access-token")
+	ath := func(t AccessToken) string {
+		sum := sha256.Sum256([]byte(t))
+		return base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	validClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"jti": "proof-id",
+			"htm": http.MethodGet,
+			"htu": "https://api.example.com/resource",
+			"iat": now.Unix(),
+			"ath": ath(accessToken),
+		}
+	}
+	newReq := func(proofs ...string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "https://api.example.com/resource?q=1", nil)
+		for _, p := range proofs {
+			req.Header.Add(DPoPHeader, p)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name      string
+		typ       string
+		claims    func(map[string]interface{})
+		token     AccessToken
+		opt       []Option
+		proofs    func(proof string) []string
+		wantIsErr error
+	}{
+		{name: "valid", token: accessToken},
+		{name: "valid-without-token", claims: func(c map[string]interface{}) { delete(c, "ath") }},
+		{
+			name:   "valid-with-target-url",
+			claims: func(c map[string]interface{}) { c["htu"] = "https://proxy.example.com/api/resource" },
+			token:  accessToken,
+			opt:    []Option{WithDPoPTargetURL("https://proxy.example.com/api/resource")},
+		},
+		{name: "missing-proof", proofs: func(string) []string { return nil }, wantIsErr: ErrInvalidTokenBinding},
+		{name: "multiple-proofs", proofs: func(p string) []string { return []string{p, p} }, wantIsErr: ErrInvalidTokenBinding},
+		{name: "malformed-proof", proofs: func(string) []string { return []string{"not-a-jwt"} }, wantIsErr: ErrInvalidTokenBinding},
+		{name: "invalid-typ", typ: "JWT", wantIsErr: ErrInvalidTokenBinding},
+		{name: "missing-jti", claims: func(c map[string]interface{}) { delete(c, "jti") }, wantIsErr: ErrInvalidTokenBinding},
+		{name: "wrong-htm", claims: func(c map[string]interface{}) { c["htm"] = http.MethodPost }, wantIsErr: ErrInvalidTokenBinding},
+		{name: "wrong-htu", claims: func(c map[string]interface{}) { c["htu"] = "https://api.example.com/other" }, wantIsErr: ErrInvalidTokenBinding},
+		{name: "missing-iat", claims: func(c map[string]interface{}) { delete(c, "iat") }, wantIsErr: ErrInvalidTokenBinding},
+		{name: "future-iat", claims: func(c map[string]interface{}) { c["iat"] = now.Add(2 * time.Minute).Unix() }, wantIsErr: ErrInvalidTokenBinding},
+		{name: "old-iat", claims: func(c map[string]interface{}) { c["iat"] = now.Add(-10 * time.Minute).Unix() }, wantIsErr: ErrInvalidTokenBinding},
+		{
+			name:   "old-iat-with-max-age",
+			claims: func(c map[string]interface{}) { c["iat"] = now.Add(-10 * time.Minute).Unix() },
+			token:  accessToken,
+			opt:    []Option{WithDPoPProofMaxAge(time.Hour)},
+		},
+		{name: "wrong-ath", token: "other-token", wantIsErr: ErrInvalidTokenBinding},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert, require := assert.New(t), require.New(t)
+			claims := validClaims()
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			typ := DPoPProofType
+			if tt.typ != "" {
+				typ = tt.typ
+			}
+			proof, jkt := testDPoPProof(t, typ, claims)
+			proofs := []string{proof}
+			if tt.proofs != nil {
+				proofs = tt.proofs(proof)
+			}
+			opt := append([]Option{WithNow(func() time.Time { return now })}, tt.opt...)
+			got, err := VerifyDPoPProof(newReq(proofs...), tt.token, opt...)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(jkt, got.Thumbprint)
+			assert.Equal("proof-id", got.ID)
+			assert.True(got.JWK.IsPublic())
+
+			assert.NoError((&Confirmation{JKT: jkt}).VerifyDPoPProof(got))
+			err = (&Confirmation{JKT: "other"}).VerifyDPoPProof(got)
+			assert.Truef(errors.Is(err, ErrInvalidTokenBinding), "wanted \"%s\" but got \"%s\"", ErrInvalidTokenBinding, err)
+		})
+	}
+	t.Run("nil-request", func(t *testing.T) {
+		_, err := VerifyDPoPProof(nil, accessToken)
+		assert.Truef(t, errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+	t.Run("replayed", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		cache := NewMemoryReplayCache(WithNow(func() time.Time { return now }))
+		proof, _ := testDPoPProof(t, DPoPProofType, validClaims())
+		opt := []Option{WithNow(func() time.Time { return now }), WithReplayCache(cache)}
+		_, err := VerifyDPoPProof(newReq(proof), accessToken, opt...)
+		require.NoError(err)
+		_, err = VerifyDPoPProof(newReq(proof), accessToken, opt...)
+		assert.Truef(errors.Is(err, ErrReplayDetected), "wanted \"%s\" but got \"%s\"", ErrReplayDetected, err)
+
+		// the same jti can be used by another key
+		other, _ := testDPoPProof(t, DPoPProofType, validClaims())
+		_, err = VerifyDPoPProof(newReq(other), accessToken, opt...)
+		require.NoError(err)
+		assert.Equal(2, cache.Len())
+	})
+}
+
+func TestConfirmation_VerifyRequest(t *testing.T) {
+	t.Parallel()
+	const accessToken = AccessToken("access-token")
+	cert := testCertificate(t)
+	sum := sha256.Sum256([]byte(accessToken))
+	proof, jkt := testDPoPProof(t, DPoPProofType, map[string]interface{}{
+		"jti": "proof-id",
+		"htm": http.MethodGet,
+		"htu": "https://api.example.com/resource",
+		"iat": time.Now().Unix(),
+		"ath": base64.RawURLEncoding.EncodeToString(sum[:]),
+	})
+	newReq := func(withCert, withProof bool) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "https://api.example.com/resource", nil)
+		req.TLS = &tls.ConnectionState{}
+		if withCert {
+			req.TLS.PeerCertificates = []*x509.Certificate{cert}
+		}
+		if withProof {
+			req.Header.Set(DPoPHeader, proof)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name      string
+		c         *Confirmation
+		req       *http.Request
+		wantIsErr error
+	}{
+		{name: "mtls", c: &Confirmation{X5TS256: CertificateThumbprint(cert)}, req: newReq(true, false)},
+		{name: "dpop", c: &Confirmation{JKT: jkt}, req: newReq(false, true)},
+		{name: "both", c: &Confirmation{X5TS256: CertificateThumbprint(cert), JKT: jkt}, req: newReq(true, true)},
+		{name: "missing-cert", c: &Confirmation{X5TS256: CertificateThumbprint(cert)}, req: newReq(false, true), wantIsErr: ErrInvalidTokenBinding},
+		{name: "missing-proof", c: &Confirmation{X5TS256: CertificateThumbprint(cert), JKT: jkt}, req: newReq(true, false), wantIsErr: ErrInvalidTokenBinding},
+		{name: "wrong-jkt", c: &Confirmation{JKT: "other"}, req: newReq(false, true), wantIsErr: ErrInvalidTokenBinding},
+		{name: "no-bindings", c: &Confirmation{}, req: newReq(true, true), wantIsErr: ErrInvalidTokenBinding},
+		{name: "nil-request", c: &Confirmation{JKT: jkt}, wantIsErr: ErrNilParameter},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			err := tt.c.VerifyRequest(tt.req, accessToken)
+			if tt.wantIsErr != nil {
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			assert.NoError(err)
+		})
+	}
+}
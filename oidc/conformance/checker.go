@@ -0,0 +1,447 @@
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// Checks run by a Checker (see WithChecks)
+const (
+	CheckStateEcho        = "state_echo"
+	CheckNonce            = "nonce"
+	CheckPKCEEnforcement  = "pkce_enforcement"
+	CheckErrorPropagation = "error_propagation"
+)
+
+// AllChecks are the checks run by default, in the order they're run.
+var AllChecks = []string{CheckStateEcho, CheckNonce, CheckPKCEEnforcement, CheckErrorPropagation}
+
+// checkSpecs are the spec sections of each check
+var checkSpecs = map[string]string{
+	CheckStateEcho:        "https://tools.ietf.org/html/rfc6749#section-4.1.2",
+	CheckNonce:            "https://openid.net/specs/openid-connect-core-1_0.html#IDToken",
+	CheckPKCEEnforcement:  "https://tools.ietf.org/html/rfc7636#section-4.6",
+	CheckErrorPropagation: "https://tools.ietf.org/html/rfc6749#section-4.1.2.1",
+}
+
+// DefaultRequestTimeout is the default amount of time each check's
+// authentication request is valid for.
+const DefaultRequestTimeout = 5 * time.Minute
+
+// invalidResponseType is the response_type of the error_propagation check's
+// invalid authentication request.
+const invalidResponseType = "cap_conformance_invalid"
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	// StatusPass is a check which the provider passed.
+	StatusPass Status = "pass"
+
+	// StatusFail is a check which the provider failed.
+	StatusFail Status = "fail"
+
+	// StatusSkip is a check which couldn't be run, for example because the
+	// login it depends on failed.
+	StatusSkip Status = "skip"
+)
+
+// Result is the result of a single check.
+type Result struct {
+	// Check is the check's name (see the Check constants).
+	Check string `json:"check"`
+
+	// Status is the check's outcome.
+	Status Status `json:"status"`
+
+	// Message explains why the check failed or was skipped, or describes
+	// the provider's response when it passed.
+	Message string `json:"message,omitempty"`
+
+	// Spec is the URL of the spec section the check is based on.
+	Spec string `json:"spec"`
+
+	// Duration is how long the check took.
+	Duration time.Duration `json:"duration"`
+}
+
+// Report is the structured result of running a Checker.
+type Report struct {
+	// Issuer is the provider's issuer.
+	Issuer string `json:"issuer"`
+
+	// ClientID is the client used by the checks.
+	ClientID string `json:"client_id"`
+
+	// StartedAt is when the checks started.
+	StartedAt time.Time `json:"started_at"`
+
+	// Duration is how long the checks took.
+	Duration time.Duration `json:"duration"`
+
+	// Results are the results of the checks, in the order they were run.
+	Results []Result `json:"results"`
+}
+
+// Passed returns true when none of the report's checks failed.
+func (r *Report) Passed() bool {
+	return len(r.Failures()) == 0
+}
+
+// Failures returns the report's failed checks.
+func (r *Report) Failures() []Result {
+	var failures []Result
+	for _, res := range r.Results {
+		if res.Status == StatusFail {
+			failures = append(failures, res)
+		}
+	}
+	return failures
+}
+
+// Authenticator logs the test user in, for the checks' authentication
+// requests.
+type Authenticator interface {
+	// Authenticate follows the authURL through the provider's login, and
+	// returns the URL (the client's redirect URL, including the
+	// authentication response's parameters) the provider redirected to.
+	// The redirect URL doesn't need to be served, so it shouldn't be
+	// followed.
+	Authenticate(ctx context.Context, authURL string) (*url.URL, error)
+}
+
+// AuthenticatorFunc is an adapter which allows a func to be used as an
+// Authenticator.
+type AuthenticatorFunc func(ctx context.Context, authURL string) (*url.URL, error)
+
+// Authenticate satisfies the Authenticator interface.
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, authURL string) (*url.URL, error) {
+	return f(ctx, authURL)
+}
+
+// Checker runs the conformance checks of a provider's authorization code
+// flow.
+type Checker struct {
+	provider       *oidc.Provider
+	authenticator  Authenticator
+	redirectURL    string
+	checks         []string
+	requestTimeout time.Duration
+}
+
+// NewChecker creates a new Checker for the provider, whose config must have
+// a client registered with its issuer.  The checks' authentication requests
+// use the config's first AllowedRedirectURLs, unless WithRedirectURL is
+// provided.
+//
+// Supported options: WithRedirectURL, WithChecks, WithRequestTimeout
+func NewChecker(p *oidc.Provider, a Authenticator, opt ...oidc.Option) (*Checker, error) {
+	const op = "conformance.NewChecker"
+	switch {
+	case p == nil:
+		return nil, fmt.Errorf("%s: provider is nil: %w", op, oidc.ErrNilParameter)
+	case a == nil:
+		return nil, fmt.Errorf("%s: authenticator is nil: %w", op, oidc.ErrNilParameter)
+	}
+	opts := getCheckerOpts(opt...)
+	redirectURL := opts.withRedirectURL
+	if redirectURL == "" {
+		if allowed := p.Config().AllowedRedirectURLs; len(allowed) > 0 {
+			redirectURL = allowed[0]
+		}
+	}
+	if redirectURL == "" {
+		return nil, fmt.Errorf("%s: redirect URL is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	for _, check := range opts.withChecks {
+		if _, ok := checkSpecs[check]; !ok {
+			return nil, fmt.Errorf("%s: unknown check %q: %w", op, check, oidc.ErrInvalidParameter)
+		}
+	}
+	if opts.withRequestTimeout <= 0 {
+		return nil, fmt.Errorf("%s: request timeout must be greater than zero: %w", op, oidc.ErrInvalidParameter)
+	}
+	return &Checker{
+		provider:       p,
+		authenticator:  a,
+		redirectURL:    redirectURL,
+		checks:         opts.withChecks,
+		requestTimeout: opts.withRequestTimeout,
+	}, nil
+}
+
+// Run runs the checks against the provider and returns their report.  A
+// failed check is reported in the report's Results, and an error is only
+// returned when the checks couldn't be run (for example: when the ctx is
+// done).
+func (c *Checker) Run(ctx context.Context) (*Report, error) {
+	const op = "Checker.Run"
+	config := c.provider.Config()
+	r := &Report{
+		Issuer:    config.Issuer,
+		ClientID:  config.ClientID,
+		StartedAt: time.Now(),
+	}
+	// the state_echo and nonce checks share a login, which is made by the
+	// first of them to run.
+	var shared *login
+	for _, check := range c.checks {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		start := time.Now()
+		var status Status
+		var msg string
+		switch check {
+		case CheckStateEcho, CheckNonce:
+			if shared == nil {
+				shared = c.login(ctx)
+			}
+			if check == CheckStateEcho {
+				status, msg = c.checkStateEcho(shared)
+			} else {
+				status, msg = c.checkNonce(ctx, shared)
+			}
+		case CheckPKCEEnforcement:
+			status, msg = c.checkPKCEEnforcement(ctx)
+		case CheckErrorPropagation:
+			status, msg = c.checkErrorPropagation(ctx)
+		}
+		r.Results = append(r.Results, Result{
+			Check:    check,
+			Status:   status,
+			Message:  msg,
+			Spec:     checkSpecs[check],
+			Duration: time.Since(start),
+		})
+	}
+	r.Duration = time.Since(r.StartedAt)
+	return r, nil
+}
+
+// login is the outcome of logging the test user in for a request
+type login struct {
+	request  oidc.Request
+	response url.Values
+	err      error
+}
+
+// login logs the test user in for a new request, made with the options.
+func (c *Checker) login(ctx context.Context, opt ...oidc.Option) *login {
+	l := &login{}
+	l.request, l.err = oidc.NewRequest(c.requestTimeout, c.redirectURL, opt...)
+	if l.err != nil {
+		return l
+	}
+	authURL, err := c.provider.AuthURL(ctx, l.request)
+	if err != nil {
+		l.err = fmt.Errorf("unable to create authentication request: %w", err)
+		return l
+	}
+	l.response, l.err = c.authenticate(ctx, authURL)
+	return l
+}
+
+// authenticate follows the authURL using the authenticator, and returns the
+// parameters of the authentication response it was redirected to.
+func (c *Checker) authenticate(ctx context.Context, authURL string) (url.Values, error) {
+	u, err := c.authenticator.Authenticate(ctx, authURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to authenticate: %w", err)
+	}
+	if u == nil {
+		return nil, errors.New("authenticator didn't return the redirect URL")
+	}
+	params := u.Query()
+	// the response may be encoded in the fragment (response_mode=fragment)
+	if frag, err := url.ParseQuery(u.Fragment); err == nil {
+		for k, v := range frag {
+			if _, ok := params[k]; !ok {
+				params[k] = v
+			}
+		}
+	}
+	return params, nil
+}
+
+// checkStateEcho checks that the login's response echoed the request's state
+func (c *Checker) checkStateEcho(l *login) (Status, string) {
+	switch {
+	case l.err != nil:
+		return StatusFail, l.err.Error()
+	case l.response.Get("error") != "":
+		return StatusFail, fmt.Sprintf("authentication failed: %s", responseError(l.response))
+	case l.response.Get("state") != l.request.State():
+		return StatusFail, fmt.Sprintf("response state %q doesn't match the request's state", l.response.Get("state"))
+	case l.response.Get("code") == "":
+		return StatusFail, "response doesn't have an authorization code"
+	}
+	return StatusPass, "response echoed the request's state"
+}
+
+// checkNonce checks that the id_token of the login's code has the request's
+// nonce
+func (c *Checker) checkNonce(ctx context.Context, l *login) (Status, string) {
+	if l.err != nil || l.response.Get("code") == "" {
+		return StatusSkip, "login didn't return an authorization code"
+	}
+	// the request's state is used, so this check is independent of the
+	// state_echo check
+	_, err := c.provider.Exchange(ctx, l.request, l.request.State(), l.response.Get("code"))
+	switch {
+	case errors.Is(err, oidc.ErrInvalidNonce):
+		return StatusFail, fmt.Sprintf("id_token doesn't have the request's nonce: %s", err)
+	case err != nil:
+		return StatusFail, fmt.Sprintf("unable to exchange the authorization code: %s", err)
+	}
+	return StatusPass, "id_token has the request's nonce"
+}
+
+// checkPKCEEnforcement checks that the token endpoint rejects a code_verifier
+// which doesn't match the request's code_challenge
+func (c *Checker) checkPKCEEnforcement(ctx context.Context) (Status, string) {
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return StatusSkip, fmt.Sprintf("unable to create code verifier: %s", err)
+	}
+	l := c.login(ctx, oidc.WithPKCE(verifier))
+	switch {
+	case l.err != nil:
+		return StatusSkip, l.err.Error()
+	case l.response.Get("code") == "":
+		return StatusSkip, fmt.Sprintf("login didn't return an authorization code: %s", responseError(l.response))
+	}
+	wrongVerifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return StatusSkip, fmt.Sprintf("unable to create code verifier: %s", err)
+	}
+	// the exchange's request matches the login's request, except for its
+	// code_verifier
+	exchangeRequest, err := oidc.NewRequest(c.requestTimeout, c.redirectURL,
+		oidc.WithState(l.request.State()),
+		oidc.WithNonce(l.request.Nonce()),
+		oidc.WithPKCE(wrongVerifier),
+	)
+	if err != nil {
+		return StatusSkip, fmt.Sprintf("unable to create exchange request: %s", err)
+	}
+	_, err = c.provider.Exchange(ctx, exchangeRequest, l.request.State(), l.response.Get("code"))
+	var oauthErr *oidc.OAuthError
+	switch {
+	case err == nil:
+		return StatusFail, "token endpoint accepted a code_verifier which doesn't match the code_challenge"
+	case errors.As(err, &oauthErr):
+		return StatusPass, fmt.Sprintf("token endpoint rejected the code_verifier with %q", oauthErr.Code)
+	}
+	return StatusFail, fmt.Sprintf("token endpoint didn't return an OAuth error response: %s", err)
+}
+
+// checkErrorPropagation checks that an invalid authentication request is
+// answered with an error response redirected to the client
+func (c *Checker) checkErrorPropagation(ctx context.Context) (Status, string) {
+	request, err := oidc.NewRequest(c.requestTimeout, c.redirectURL)
+	if err != nil {
+		return StatusSkip, fmt.Sprintf("unable to create request: %s", err)
+	}
+	authURL, err := c.provider.AuthURL(ctx, request)
+	if err != nil {
+		return StatusSkip, fmt.Sprintf("unable to create authentication request: %s", err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return StatusSkip, fmt.Sprintf("unable to parse authentication request: %s", err)
+	}
+	q := u.Query()
+	q.Set("response_type", invalidResponseType)
+	u.RawQuery = q.Encode()
+
+	params, err := c.authenticate(ctx, u.String())
+	switch {
+	case err != nil:
+		return StatusFail, fmt.Sprintf("provider didn't redirect an error response: %s", err)
+	case params.Get("error") == "":
+		return StatusFail, "provider didn't return an error for an unsupported response_type"
+	case params.Get("state") != request.State():
+		return StatusFail, fmt.Sprintf("error response state %q doesn't match the request's state", params.Get("state"))
+	}
+	return StatusPass, fmt.Sprintf("provider returned %s", responseError(params))
+}
+
+// responseError returns the error of an authentication response
+func responseError(params url.Values) string {
+	switch {
+	case params.Get("error") == "":
+		return "response doesn't have an error"
+	case params.Get("error_description") != "":
+		return fmt.Sprintf("%s: %s", params.Get("error"), params.Get("error_description"))
+	}
+	return params.Get("error")
+}
+
+// checkerOptions is the set of available options for a Checker
+type checkerOptions struct {
+	withRedirectURL    string
+	withChecks         []string
+	withRequestTimeout time.Duration
+}
+
+// checkerDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func checkerDefaults() checkerOptions {
+	return checkerOptions{
+		withChecks:         append([]string(nil), AllChecks...),
+		withRequestTimeout: DefaultRequestTimeout,
+	}
+}
+
+// getCheckerOpts gets the checker defaults and applies the opt overrides
+// passed in
+func getCheckerOpts(opt ...oidc.Option) checkerOptions {
+	opts := checkerDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithRedirectURL provides an optional redirect URL for the checks'
+// authentication requests, which must be registered for the client.
+//
+// Valid for: Checker
+func WithRedirectURL(u string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*checkerOptions); ok {
+			o.withRedirectURL = u
+		}
+	}
+}
+
+// WithChecks provides an optional list of the checks to run, in the order
+// they're run (see the Check constants).  The default is AllChecks.
+//
+// Valid for: Checker
+func WithChecks(checks ...string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*checkerOptions); ok && len(checks) > 0 {
+			o.withChecks = checks
+		}
+	}
+}
+
+// WithRequestTimeout provides an optional amount of time each check's
+// authentication request is valid for, which must be long enough for the
+// Authenticator to log the test user in.  The default is
+// DefaultRequestTimeout.
+//
+// Valid for: Checker
+func WithRequestTimeout(d time.Duration) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*checkerOptions); ok {
+			o.withRequestTimeout = d
+		}
+	}
+}
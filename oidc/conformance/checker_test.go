@@ -0,0 +1,162 @@
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProvider returns a TestProvider and a Provider for it, along with an
+// Authenticator which logs in to the TestProvider.
+func testProvider(t *testing.T) (*oidc.TestProvider, *oidc.Provider, Authenticator) {
+	t.Helper()
+	redirect := "https://example.com/callback"
+	tp := oidc.StartTestProvider(t)
+	tp.SetClientCreds("test-client-id", "test-client-secret")
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+	_, _, alg, _ := tp.SigningKeys()
+	c, err := oidc.NewConfig(tp.Addr(), "test-client-id", "test-client-secret", []oidc.Alg{alg}, []string{redirect}, oidc.WithProviderCA(tp.CACert()))
+	require.NoError(t, err)
+	p, err := oidc.NewProvider(c)
+	require.NoError(t, err)
+	t.Cleanup(p.Done)
+
+	client := *tp.HTTPClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	a := AuthenticatorFunc(func(ctx context.Context, authURL string) (*url.URL, error) {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return nil, err
+		}
+		// the test provider's id_tokens have the nonce it expects
+		tp.SetExpectedAuthNonce(u.Query().Get("nonce"))
+		req, err := http.NewRequest(http.MethodGet, authURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return resp.Location()
+	})
+	return tp, p, a
+}
+
+func TestChecker_Run(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("conformant", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp, p, a := testProvider(t)
+		c, err := NewChecker(p, a)
+		require.NoError(err)
+		r, err := c.Run(ctx)
+		require.NoError(err)
+		assert.Equal(tp.Addr(), r.Issuer)
+		assert.Equal("test-client-id", r.ClientID)
+		require.Len(r.Results, len(AllChecks))
+		for i, res := range r.Results {
+			assert.Equal(AllChecks[i], res.Check)
+			assert.Equalf(StatusPass, res.Status, "%s: %s", res.Check, res.Message)
+			assert.NotEmpty(res.Spec)
+		}
+		assert.True(r.Passed())
+		assert.Empty(r.Failures())
+
+		b, err := json.Marshal(r)
+		require.NoError(err)
+		var decoded Report
+		require.NoError(json.Unmarshal(b, &decoded))
+		assert.Equal(r.Results, decoded.Results)
+	})
+	t.Run("state-not-echoed", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp, p, a := testProvider(t)
+		tp.SetExpectedState("not-the-request-state")
+		c, err := NewChecker(p, a, WithChecks(CheckStateEcho, CheckNonce))
+		require.NoError(err)
+		r, err := c.Run(ctx)
+		require.NoError(err)
+		require.Len(r.Results, 2)
+		assert.Equal(StatusFail, r.Results[0].Status)
+		assert.Contains(r.Results[0].Message, "not-the-request-state")
+		// the nonce check is independent of the state
+		assert.Equal(StatusPass, r.Results[1].Status)
+		assert.False(r.Passed())
+		assert.Len(r.Failures(), 1)
+	})
+	t.Run("login-failed", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, p, _ := testProvider(t)
+		a := AuthenticatorFunc(func(context.Context, string) (*url.URL, error) {
+			return nil, errors.New("login form not found")
+		})
+		c, err := NewChecker(p, a)
+		require.NoError(err)
+		r, err := c.Run(ctx)
+		require.NoError(err)
+		got := map[string]Status{}
+		for _, res := range r.Results {
+			got[res.Check] = res.Status
+		}
+		assert.Equal(map[string]Status{
+			CheckStateEcho:        StatusFail,
+			CheckNonce:            StatusSkip,
+			CheckPKCEEnforcement:  StatusSkip,
+			CheckErrorPropagation: StatusFail,
+		}, got)
+	})
+	t.Run("ctx-done", func(t *testing.T) {
+		require := require.New(t)
+		_, p, a := testProvider(t)
+		c, err := NewChecker(p, a)
+		require.NoError(err)
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = c.Run(cancelled)
+		require.Truef(errors.Is(err, context.Canceled), "wanted \"%s\" but got \"%s\"", context.Canceled, err)
+	})
+}
+
+func TestNewChecker(t *testing.T) {
+	_, p, a := testProvider(t)
+	tests := []struct {
+		name    string
+		p       *oidc.Provider
+		a       Authenticator
+		opt     []oidc.Option
+		wantErr error
+	}{
+		{name: "valid", p: p, a: a},
+		{name: "redirect-url", p: p, a: a, opt: []oidc.Option{WithRedirectURL("https://example.com/other")}},
+		{name: "nil-provider", a: a, wantErr: oidc.ErrNilParameter},
+		{name: "nil-authenticator", p: p, wantErr: oidc.ErrNilParameter},
+		{name: "unknown-check", p: p, a: a, opt: []oidc.Option{WithChecks("unknown")}, wantErr: oidc.ErrInvalidParameter},
+		{name: "invalid-timeout", p: p, a: a, opt: []oidc.Option{WithRequestTimeout(-1)}, wantErr: oidc.ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			c, err := NewChecker(tt.p, tt.a, tt.opt...)
+			if tt.wantErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantErr), "wanted \"%s\" but got \"%s\"", tt.wantErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.NotNil(c)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+/*
+Package conformance checks that an IdP's authorization code flow behaves as
+the specs require, which is useful for vetting a new IdP (and the client
+registered with it) before onboarding it.
+
+A Checker runs a configured oidc.Provider through a battery of checks against
+its issuer, and returns a structured Report (which can be encoded as JSON):
+
+	* state_echo: the authentication response echoes the request's state
+	* nonce: the id_token returned by the token endpoint has the request's
+	nonce
+	* pkce_enforcement: the token endpoint rejects a code_verifier which
+	doesn't match the request's code_challenge
+	* error_propagation: an invalid authentication request is answered by
+	redirecting an error response (with the request's state) to the client
+
+The checks log the test user in via an Authenticator, which follows an
+authentication request's URL through the IdP's login and returns the URL the
+IdP redirected to, for example by submitting the IdP's login forms or by
+driving a headless browser.  The test user must not require MFA or consent.
+
+	checker, err := conformance.NewChecker(p, authenticator)
+	if err != nil {
+		// handle error
+	}
+	report, err := checker.Run(ctx)
+	if err != nil {
+		// handle error
+	}
+	if !report.Passed() {
+		for _, r := range report.Failures() {
+			fmt.Printf("%s: %s\n", r.Check, r.Message)
+		}
+	}
+*/
+package conformance
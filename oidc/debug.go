@@ -0,0 +1,137 @@
+package oidc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"sync"
+)
+
+// redacted replaces the sensitive values in debug dumps
+const redacted = "[REDACTED]"
+
+// maxDebugBodySize is the number of bytes of a response body included in a
+// dump.  Only a prefix of the body is read before it's returned to the
+// caller, so the dump never buffers a body beyond the provider's response
+// limits (see WithResponseLimits).
+const maxDebugBodySize = 64 * 1024
+
+// WithDebugWriter provides an optional io.Writer which receives a dump of
+// every http request the provider makes and the response it receives
+// (discovery, JWKS, exchange, refresh, userinfo, etc).  Sensitive values are
+// masked before they are written: authorization and cookie headers, client
+// secrets and assertions, authorization codes, PKCE verifiers, passwords and
+// tokens (including anything that looks like a JWT).  Dumps are intended to
+// help debug integrations with an IdP and shouldn't be enabled by default.
+//
+// Valid for: Provider
+func WithDebugWriter(w io.Writer) Option {
+	return func(o interface{}) {
+		if w == nil {
+			return
+		}
+		if o, ok := o.(*providerOptions); ok {
+			o.withDebugWriter = w
+		}
+	}
+}
+
+// debugTransport is an http.RoundTripper which writes a sanitized dump of each
+// request and response to w.
+type debugTransport struct {
+	base http.RoundTripper
+
+	// mu keeps the dumps of concurrent requests from being interleaved
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqDump, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		reqDump = []byte(fmt.Sprintf("unable to dump request: %s", err))
+	}
+	resp, respErr := t.base.RoundTrip(req)
+	var respDump []byte
+	switch {
+	case respErr != nil:
+		respDump = []byte(fmt.Sprintf("request failed: %s", respErr))
+	default:
+		if respDump, err = dumpResponse(resp); err != nil {
+			respDump = []byte(fmt.Sprintf("unable to dump response: %s", err))
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _ = fmt.Fprintf(t.w, "---[ oidc request ]---\n%s\n---[ oidc response ]---\n%s\n", sanitizeHTTPDump(reqDump), sanitizeHTTPDump(respDump))
+	return resp, respErr
+}
+
+// dumpResponse dumps the response's headers and at most maxDebugBodySize
+// bytes of its body.  The prefix that was read is put back in front of the
+// rest of the body, which is left for the caller (and any limits it applies)
+// to read.
+func dumpResponse(resp *http.Response) ([]byte, error) {
+	dump, err := httputil.DumpResponse(resp, false)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return dump, nil
+	}
+	prefix, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDebugBodySize+1))
+	resp.Body = &prefixedBody{
+		Reader: io.MultiReader(bytes.NewReader(prefix), resp.Body),
+		Closer: resp.Body,
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(prefix) > maxDebugBodySize {
+		return append(append(dump, prefix[:maxDebugBodySize]...), fmt.Sprintf("\n[TRUNCATED after %d bytes]", maxDebugBodySize)...), nil
+	}
+	return append(dump, prefix...), nil
+}
+
+// prefixedBody is a response body whose prefix has already been read from
+// the original body.
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// CloseIdleConnections closes the base transport's idle connections, which
+// allows http.Client.CloseIdleConnections() to work with the debugTransport.
+func (t *debugTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if tr, ok := t.base.(closeIdler); ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// sensitiveParams are the form, query and JSON parameters masked in dumps
+const sensitiveParams = `client_secret|client_assertion|assertion|code|code_verifier|password|access_token|id_token|refresh_token|token|device_code|user_code`
+
+var (
+	sensitiveHeaderRE    = regexp.MustCompile(`(?mi)^((?:proxy-)?authorization|cookie|set-cookie):[^\r\n]*`)
+	sensitiveFormParamRE = regexp.MustCompile(`(^|[?&\s])(` + sensitiveParams + `)=[^&\s]*`)
+	sensitiveJSONParamRE = regexp.MustCompile(`"(` + sensitiveParams + `)"(\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	jwtRE                = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+// sanitizeHTTPDump masks the sensitive values in an http request or response
+// dump.
+func sanitizeHTTPDump(dump []byte) []byte {
+	dump = sensitiveHeaderRE.ReplaceAll(dump, []byte("$1: "+redacted))
+	dump = sensitiveFormParamRE.ReplaceAll(dump, []byte("${1}${2}="+redacted))
+	dump = sensitiveJSONParamRE.ReplaceAll(dump, []byte(`"$1"$2"`+redacted+`"`))
+	return jwtRE.ReplaceAll(dump, []byte(redacted))
+}
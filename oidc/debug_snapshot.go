@@ -0,0 +1,324 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// urlCredentialsRE matches the userinfo (credentials) of URLs
+var urlCredentialsRE = regexp.MustCompile(`(://)[^/@"\s]+@`)
+
+// operationErrors counts a provider's operation errors, along with the most
+// recent error of each operation.
+type operationErrors struct {
+	mu     sync.Mutex
+	errors map[string]*snapshotErrors
+}
+
+// record counts the operation's error
+func (e *operationErrors) record(config *Config, operation string, err error) {
+	now := time.Now()
+	if config != nil {
+		now = config.Now()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.errors == nil {
+		e.errors = map[string]*snapshotErrors{}
+	}
+	s, ok := e.errors[operation]
+	if !ok {
+		s = &snapshotErrors{}
+		e.errors[operation] = s
+	}
+	s.Count++
+	s.LastError = string(sanitizeSnapshot([]byte(err.Error())))
+	s.LastErrorAt = now
+}
+
+// snapshot returns a copy of the counts
+func (e *operationErrors) snapshot() map[string]snapshotErrors {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m := make(map[string]snapshotErrors, len(e.errors))
+	for op, s := range e.errors {
+		m[op] = *s
+	}
+	return m
+}
+
+// debugSnapshot is the document returned by Provider.DebugSnapshot
+type debugSnapshot struct {
+	CreatedAt         time.Time                 `json:"created_at"`
+	Issuer            string                    `json:"issuer"`
+	ConfigFingerprint string                    `json:"config_fingerprint"`
+	Config            snapshotConfig            `json:"config"`
+	Discovery         *snapshotDiscovery        `json:"discovery,omitempty"`
+	JWKS              *snapshotJWKS             `json:"jwks,omitempty"`
+	JWKSCache         JWKSCacheStats            `json:"jwks_cache"`
+	Health            *snapshotHealth           `json:"health,omitempty"`
+	Errors            map[string]snapshotErrors `json:"errors"`
+}
+
+// snapshotConfig is the non-secret part of the provider's config.  Secrets
+// and keys are only reported as being configured.
+type snapshotConfig struct {
+	ClientID               string            `json:"client_id"`
+	Scopes                 []string          `json:"scopes,omitempty"`
+	SupportedSigningAlgs   []Alg             `json:"supported_signing_algs,omitempty"`
+	UserInfoSigningAlgs    []Alg             `json:"userinfo_signing_algs,omitempty"`
+	LogoutTokenSigningAlgs []Alg             `json:"logout_token_signing_algs,omitempty"`
+	AllowedRedirectURLs    []string          `json:"allowed_redirect_urls,omitempty"`
+	Audiences              []string          `json:"audiences,omitempty"`
+	ResponseModes          []ResponseMode    `json:"response_modes,omitempty"`
+	Profile                Profile           `json:"profile,omitempty"`
+	Prompts                []Prompt          `json:"prompts,omitempty"`
+	Display                Display           `json:"display,omitempty"`
+	ClientSecretJWTAlg     Alg               `json:"client_secret_jwt_alg,omitempty"`
+	UserInfoURL            string            `json:"userinfo_url,omitempty"`
+	ProviderMetadata       *ProviderMetadata `json:"provider_metadata,omitempty"`
+	FAPI                   bool              `json:"fapi,omitempty"`
+
+	// ProviderCAFingerprints are the SHA-256 fingerprints of the ProviderCA
+	// certificates
+	ProviderCAFingerprints []string `json:"provider_ca_fingerprints,omitempty"`
+
+	HasClientSecret          bool   `json:"has_client_secret"`
+	HasClientAssertionSigner bool   `json:"has_client_assertion_signer"`
+	ClientCertificates       int    `json:"client_certificates"`
+	DPoPKeyThumbprint        string `json:"dpop_key_thumbprint,omitempty"`
+	IDTokenDecryptionKeys    int    `json:"id_token_decryption_keys"`
+	HasJWKSPins              bool   `json:"has_jwks_pins"`
+}
+
+// snapshotDiscovery is the provider's discovery document and its advertised
+// algorithms
+type snapshotDiscovery struct {
+	DiscoveredAt   time.Time           `json:"discovered_at"`
+	Age            string              `json:"age"`
+	AdvertisedAlgs map[string][]string `json:"advertised_algs,omitempty"`
+	Document       json.RawMessage     `json:"document"`
+}
+
+// snapshotJWKS is the state of the provider's cached JWKS
+type snapshotJWKS struct {
+	URL       string    `json:"url"`
+	Cached    bool      `json:"cached"`
+	Keys      int       `json:"keys,omitempty"`
+	KeyIDs    []string  `json:"key_ids,omitempty"`
+	FetchedAt time.Time `json:"fetched_at,omitempty"`
+	Age       string    `json:"age,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// snapshotHealth is the provider's most recent HealthStatus
+type snapshotHealth struct {
+	Healthy     bool      `json:"healthy"`
+	CheckedAt   time.Time `json:"checked_at"`
+	Error       string    `json:"error,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitempty"`
+}
+
+// snapshotErrors are the error counts of an operation
+type snapshotErrors struct {
+	Count       uint64    `json:"count"`
+	LastError   string    `json:"last_error"`
+	LastErrorAt time.Time `json:"last_error_at"`
+}
+
+// DebugSnapshot returns a sanitized JSON document describing the provider,
+// which can be attached to support tickets when debugging an integration
+// with an IdP.  It includes the provider's discovery document and its
+// advertised algorithms, the ages of the cached discovery document and JWKS,
+// the JWKSCache stats, the most recent health status, the error counts of
+// the provider's operations (see the MetricsOp constants) and the non-secret
+// parts of its config along with their fingerprint, which can be compared to
+// detect config changes.
+//
+// Secrets, keys and tokens are never included: client secrets and keys are
+// only reported as configured, and values that look like tokens are masked.
+// DebugSnapshot doesn't make any http requests, so the discovery document is
+// omitted when the provider was created using WithLazyDiscovery and hasn't
+// been discovered yet.
+func (p *Provider) DebugSnapshot() ([]byte, error) {
+	const op = "Provider.DebugSnapshot"
+	p.mu.RLock()
+	config, provider, jwksURL, discoveredAt := p.config, p.provider, p.jwksURL, p.discoveredAt
+	p.mu.RUnlock()
+	now := config.Now()
+
+	snapshotCfg := newSnapshotConfig(config)
+	fingerprint, err := json.Marshal(struct {
+		Issuer string         `json:"issuer"`
+		Config snapshotConfig `json:"config"`
+	}{config.Issuer, snapshotCfg})
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to fingerprint config: %w", op, err)
+	}
+	sum := sha256.Sum256(fingerprint)
+
+	s := debugSnapshot{
+		CreatedAt:         now,
+		Issuer:            config.Issuer,
+		ConfigFingerprint: hex.EncodeToString(sum[:]),
+		Config:            snapshotCfg,
+		Errors:            p.operationErrors.snapshot(),
+	}
+	if provider != nil {
+		var doc map[string]interface{}
+		if err := provider.Claims(&doc); err != nil {
+			return nil, fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+		}
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unable to encode discovery document: %w", op, err)
+		}
+		s.Discovery = &snapshotDiscovery{
+			DiscoveredAt:   discoveredAt,
+			Age:            now.Sub(discoveredAt).String(),
+			AdvertisedAlgs: advertisedAlgs(doc),
+			Document:       sanitizeSnapshot(raw),
+		}
+	}
+
+	cache := config.JWKSCache
+	if cache == nil {
+		cache = DefaultJWKSCache()
+	}
+	s.JWKSCache = cache.Stats()
+	if jwksURL != "" {
+		s.JWKS = &snapshotJWKS{URL: string(sanitizeSnapshot([]byte(jwksURL)))}
+		if e, ok := cache.entry(jwksURL); ok {
+			s.JWKS.Cached = true
+			s.JWKS.Keys = len(e.keys)
+			for _, k := range e.keys {
+				if k.KeyID != "" {
+					s.JWKS.KeyIDs = append(s.JWKS.KeyIDs, k.KeyID)
+				}
+			}
+			s.JWKS.FetchedAt = e.fetchedAt
+			s.JWKS.Age = cache.now().Sub(e.fetchedAt).String()
+			s.JWKS.ExpiresAt = e.expiry
+		}
+	}
+
+	if status := p.HealthStatus(); status != nil {
+		s.Health = &snapshotHealth{
+			Healthy:     status.Healthy,
+			CheckedAt:   status.CheckedAt,
+			LastErrorAt: status.LastErrorAt,
+		}
+		if status.Err != nil {
+			s.Health.Error = string(sanitizeSnapshot([]byte(status.Err.Error())))
+		}
+		if status.LastError != nil {
+			s.Health.LastError = string(sanitizeSnapshot([]byte(status.LastError.Error())))
+		}
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to encode snapshot: %w", op, err)
+	}
+	return b, nil
+}
+
+// newSnapshotConfig returns the non-secret part of the config
+func newSnapshotConfig(c *Config) snapshotConfig {
+	s := snapshotConfig{
+		ClientID:                 c.ClientID,
+		Scopes:                   c.Scopes,
+		SupportedSigningAlgs:     c.SupportedSigningAlgs,
+		UserInfoSigningAlgs:      c.UserInfoSigningAlgs,
+		LogoutTokenSigningAlgs:   c.LogoutTokenSigningAlgs,
+		AllowedRedirectURLs:      c.AllowedRedirectURLs,
+		Audiences:                c.Audiences,
+		ResponseModes:            c.ResponseModes,
+		Profile:                  c.Profile,
+		Prompts:                  c.Prompts,
+		Display:                  c.Display,
+		ClientSecretJWTAlg:       c.ClientSecretJWTAlg,
+		UserInfoURL:              c.UserInfoURL,
+		ProviderMetadata:         c.ProviderMetadata,
+		FAPI:                     c.FAPI,
+		HasClientSecret:          c.ClientSecret != "",
+		HasClientAssertionSigner: c.ClientAssertionSigner != nil,
+		ClientCertificates:       len(c.ClientCertificates),
+		IDTokenDecryptionKeys:    len(c.IDTokenDecryptionKeys),
+		HasJWKSPins:              c.JWKSPins != nil,
+	}
+	if c.DPoPKey != nil {
+		s.DPoPKeyThumbprint = c.DPoPKey.Thumbprint()
+	}
+	if c.ProviderCA != "" {
+		certs, _ := parseCertsPEM([]byte(c.ProviderCA))
+		for _, cert := range certs {
+			sum := sha256.Sum256(cert.Raw)
+			s.ProviderCAFingerprints = append(s.ProviderCAFingerprints, hex.EncodeToString(sum[:]))
+		}
+	}
+	return s
+}
+
+// advertisedAlgs returns the algorithms advertised by the discovery document:
+// its *_alg_values_supported, *_enc_values_supported and
+// code_challenge_methods_supported metadata.
+func advertisedAlgs(doc map[string]interface{}) map[string][]string {
+	algs := map[string][]string{}
+	for k, v := range doc {
+		if !strings.HasSuffix(k, "_alg_values_supported") && !strings.HasSuffix(k, "_enc_values_supported") && k != "code_challenge_methods_supported" {
+			continue
+		}
+		values, ok := v.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, a := range values {
+			if s, ok := a.(string); ok {
+				algs[k] = append(algs[k], s)
+			}
+		}
+		sort.Strings(algs[k])
+	}
+	if len(algs) == 0 {
+		return nil
+	}
+	return algs
+}
+
+// sanitizeSnapshot masks the sensitive values in a snapshot's document or
+// error, including the credentials of URLs.
+func sanitizeSnapshot(b []byte) []byte {
+	b = sanitizeHTTPDump(b)
+	return urlCredentialsRE.ReplaceAll(b, []byte("${1}"+redacted+"@"))
+}
+
+// parseCertsPEM returns the certificates of the PEM data
+func parseCertsPEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
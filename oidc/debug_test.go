@@ -0,0 +1,204 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_debugWriter(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	clientID := "test-client-id"
+	clientSecret := "test-client-secret"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+	tp.SetExpectedRefreshToken("test-refresh-token")
+
+	w := &testSyncBuffer{}
+	p, err := NewProvider(testNewConfig(t, clientID, clientSecret, redirect, tp), WithDebugWriter(w))
+	require.NoError(err)
+	defer p.Done()
+
+	verifier, err := NewCodeVerifier()
+	require.NoError(err)
+	oidcRequest, err := NewRequest(time.Minute, redirect, WithPKCE(verifier))
+	require.NoError(err)
+	tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+	tp.SetPKCEVerifier(oidcRequest.PKCEVerifier())
+
+	tk, err := p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+	require.NoError(err)
+	_, err = p.RefreshToken(ctx, tk)
+	require.NoError(err)
+	var claims map[string]interface{}
+	require.NoError(p.UserInfo(ctx, tk.StaticTokenSource(), "alice@example.com", &claims))
+
+	dump := w.String()
+	for _, want := range []string{
+		"GET /.well-known/openid-configuration",
+		"GET /.well-known/jwks.json",
+		"POST /token",
+		"GET /userinfo",
+		"HTTP/1.1 200 OK",
+		"Authorization: " + redacted,
+		"refresh_token=" + redacted,
+		`"access_token":` + `"` + redacted + `"`,
+	} {
+		assert.Contains(dump, want)
+	}
+	for _, secret := range []string{
+		clientSecret,
+		"test-code",
+		"test-refresh-token",
+		oidcRequest.PKCEVerifier().Verifier(),
+		string(tk.AccessToken()),
+		string(tk.IDToken()),
+	} {
+		assert.NotContains(dump, secret)
+	}
+
+	// closing the idle connections works with the debug transport
+	p.Done()
+}
+
+func Test_sanitizeHTTPDump(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		dump string
+		want string
+	}{
+		{
+			name: "headers",
+			dump: "GET /userinfo HTTP/1.1\r\nAuthorization: Bearer secret\r\nproxy-authorization: Basic secret\r\nCookie: session=secret\r\nAccept: */*\r\n",
+			want: "GET /userinfo HTTP/1.1\r\nAuthorization: [REDACTED]\r\nproxy-authorization: [REDACTED]\r\nCookie: [REDACTED]\r\nAccept: */*\r\n",
+		},
+		{
+			name: "form",
+			dump: "POST /token HTTP/1.1\r\n\r\nclient_id=alice&client_secret=secret&code=secret&code_verifier=secret&grant_type=authorization_code",
+			want: "POST /token HTTP/1.1\r\n\r\nclient_id=alice&client_secret=[REDACTED]&code=[REDACTED]&code_verifier=[REDACTED]&grant_type=authorization_code",
+		},
+		{
+			name: "saml2-bearer-form",
+			dump: "POST /token HTTP/1.1\r\n\r\ngrant_type=urn%3Aietf%3Aparams%3Aoauth%3Agrant-type%3Asaml2-bearer&assertion=PHNhbWw6QXNzZXJ0aW9uPg&scope=openid",
+			want: "POST /token HTTP/1.1\r\n\r\ngrant_type=urn%3Aietf%3Aparams%3Aoauth%3Agrant-type%3Asaml2-bearer&assertion=[REDACTED]&scope=openid",
+		},
+		{
+			name: "query",
+			dump: "GET /callback?code=secret&state=state HTTP/1.1",
+			want: "GET /callback?code=[REDACTED]&state=state HTTP/1.1",
+		},
+		{
+			name: "json",
+			dump: `{"access_token": "secret", "refresh_token":"sec\"ret","token_type":"Bearer","expires_in":60}`,
+			want: `{"access_token": "[REDACTED]", "refresh_token":"[REDACTED]","token_type":"Bearer","expires_in":60}`,
+		},
+		{
+			name: "jwt",
+			dump: "HTTP/1.1 200 OK\r\nContent-Type: application/jwt\r\n\r\neyJhbGciOiJFUzI1NiJ9.eyJzdWIiOiJhbGljZSJ9.c2lnbmF0dXJl",
+			want: "HTTP/1.1 200 OK\r\nContent-Type: application/jwt\r\n\r\n[REDACTED]",
+		},
+		{
+			name: "nothing-sensitive",
+			dump: "GET /.well-known/openid-configuration HTTP/1.1\r\nHost: example.com\r\n",
+			want: "GET /.well-known/openid-configuration HTTP/1.1\r\nHost: example.com\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(sanitizeHTTPDump([]byte(tt.dump))))
+		})
+	}
+}
+
+// testSyncBuffer is a bytes.Buffer which is safe for concurrent use
+type testSyncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *testSyncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *testSyncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func Test_debugTransport_boundedDump(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	body := &countingReader{r: strings.NewReader(strings.Repeat("a", 4*maxDebugBodySize))}
+	base := testRoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			Body:          ioutil.NopCloser(body),
+			ContentLength: -1,
+			Request:       req,
+		}, nil
+	})
+	w := &testSyncBuffer{}
+	tr := &limitTransport{
+		base:     &debugTransport{base: base, w: w},
+		endpoint: "token",
+		limit:    2 * maxDebugBodySize,
+	}
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/token", nil)
+	require.NoError(err)
+	resp, err := tr.RoundTrip(req)
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	// only a bounded prefix was read (and dumped) before the response
+	// was returned
+	assert.LessOrEqual(body.n, maxDebugBodySize+1)
+	dump := w.String()
+	assert.Contains(dump, "[TRUNCATED after")
+	assert.Less(len(dump), 2*maxDebugBodySize)
+
+	// the response limit still applies to the whole body
+	_, err = ioutil.ReadAll(resp.Body)
+	require.Error(err)
+	assert.Truef(errors.Is(err, ErrResponseTooLarge), "wanted \"%s\" but got \"%s\"", ErrResponseTooLarge, err)
+}
+
+type testRoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f testRoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
@@ -0,0 +1,614 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/cap/oidc/internal/strutils"
+)
+
+const (
+	// DefaultDevClientID is the client ID of a DevProvider's default client.
+	DefaultDevClientID = "dev-client"
+
+	// DefaultDevClientSecret is the client secret of a DevProvider's default
+	// client.
+	DefaultDevClientSecret = "dev-secret"
+
+	// DefaultDevTokenTTL is the default lifetime of the tokens issued by a
+	// DevProvider.
+	DefaultDevTokenTTL = time.Hour
+
+	// devCodeTTL is the lifetime of a DevProvider's authorization codes.
+	devCodeTTL = time.Minute
+)
+
+// DevClient is a client registered with a DevProvider.
+type DevClient struct {
+	// ID is the client's ID.
+	ID string
+
+	// Secret is the client's secret.  When it's empty, the client is a public
+	// client which must use PKCE.
+	Secret string
+
+	// RedirectURIs are the client's allowed redirect URIs.  The ports of
+	// loopback redirect URIs are ignored.  When it's empty, any redirect URI
+	// is allowed.
+	RedirectURIs []string
+}
+
+// DevUser is a user of a DevProvider.
+type DevUser struct {
+	// Subject is the user's sub claim.
+	Subject string
+
+	// Claims are added to the user's id_tokens and userinfo.
+	Claims map[string]interface{}
+}
+
+// DevProvider is a local OIDC provider for development and docker-compose
+// setups, which is built on the TestProvider.  Unlike a TestProvider, it has
+// a fixed set of clients and users, and logins aren't interactive: the user
+// is selected by the auth request's login_hint (which is the user's subject or
+// email), or it's the first user when there isn't a login_hint.
+//
+// A DevProvider supports the authorization code flow (with optional PKCE),
+// refresh tokens and userinfo.  It must never be used in production.
+type DevProvider struct {
+	tp      *TestProvider
+	t       *devT
+	clients map[string]DevClient
+	users   []DevUser
+
+	// mu serializes the requests which configure the TestProvider for the
+	// request's client and user.
+	mu            sync.Mutex
+	codes         map[string]devGrant
+	refreshTokens map[string]devGrant
+	accessTokens  map[string]DevUser
+}
+
+// devGrant is a user's authorization of a client.
+type devGrant struct {
+	client      DevClient
+	user        DevUser
+	nonce       string
+	challenge   string
+	redirectURI string
+	expiresAt   time.Time
+}
+
+// StartDevProvider starts a DevProvider, which must be stopped by calling
+// Stop().  By default, it has a client with the DefaultDevClientID and
+// DefaultDevClientSecret, and a single user: alice@example.com.
+//
+// Supported options: WithDevClient, WithDevUser, WithDevTokenTTL,
+// WithTestPort
+func StartDevProvider(opt ...Option) (*DevProvider, error) {
+	const op = "StartDevProvider"
+	opts := getDevProviderOpts(opt...)
+	if opts.withTokenTTL <= 0 {
+		return nil, fmt.Errorf("%s: token ttl not greater than zero: %w", op, ErrInvalidParameter)
+	}
+	d := &DevProvider{
+		clients:       map[string]DevClient{},
+		users:         opts.withUsers,
+		codes:         map[string]devGrant{},
+		refreshTokens: map[string]devGrant{},
+		accessTokens:  map[string]DevUser{},
+	}
+	for _, c := range opts.withClients {
+		if c.ID == "" {
+			return nil, fmt.Errorf("%s: client ID is empty: %w", op, ErrInvalidParameter)
+		}
+		d.clients[c.ID] = c
+	}
+	if len(d.clients) == 0 {
+		d.clients[DefaultDevClientID] = DevClient{ID: DefaultDevClientID, Secret: DefaultDevClientSecret}
+	}
+	for _, u := range d.users {
+		if u.Subject == "" {
+			return nil, fmt.Errorf("%s: user subject is empty: %w", op, ErrInvalidParameter)
+		}
+	}
+	if len(d.users) == 0 {
+		d.users = []DevUser{{
+			Subject: "alice@example.com",
+			Claims: map[string]interface{}{
+				"email":          "alice@example.com",
+				"email_verified": true,
+				"name":           "Alice",
+			},
+		}}
+	}
+
+	d.t = &devT{}
+	tp, err := startDevTestProvider(d.t, append(opt, withTestHandler(func(tp *TestProvider) http.Handler {
+		d.tp = tp
+		return d
+	}))...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	tp.SetExpectedExpiry(opts.withTokenTTL)
+	tp.SetResponseIssuer(true)
+	return d, nil
+}
+
+// RunDevProvider runs a DevProvider until the ctx is done.  The provider's
+// issuer, CA certificate, clients and users are written to the output when
+// it starts, so they can be used to configure the app being developed.  The
+// CA certificate can also be written to a file (see WithDevCACertFile), which
+// is handy for sharing it with other containers.
+//
+// Supported options: WithDevClient, WithDevUser, WithDevTokenTTL,
+// WithDevOutput, WithDevCACertFile, WithTestPort
+func RunDevProvider(ctx context.Context, opt ...Option) error {
+	const op = "RunDevProvider"
+	if ctx == nil {
+		return fmt.Errorf("%s: ctx is nil: %w", op, ErrNilParameter)
+	}
+	d, err := StartDevProvider(opt...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer d.Stop()
+
+	opts := getDevProviderOpts(opt...)
+	if opts.withCACertFile != "" {
+		if err := ioutil.WriteFile(opts.withCACertFile, []byte(d.CACert()), 0644); err != nil {
+			return fmt.Errorf("%s: unable to write ca cert: %w", op, err)
+		}
+	}
+	out := opts.withOutput
+	fmt.Fprintf(out, "Dev OIDC provider issuer: %s\n\nClients:\n", d.Addr())
+	for _, c := range d.clients {
+		fmt.Fprintf(out, "    %s (secret: %q)\n", c.ID, c.Secret)
+	}
+	fmt.Fprintf(out, "\nUsers (select one with the login_hint parameter):\n")
+	for _, u := range d.users {
+		fmt.Fprintf(out, "    %s\n", u.Subject)
+	}
+	fmt.Fprintf(out, "\nCA certificate:\n%s\n", d.CACert())
+
+	<-ctx.Done()
+	return nil
+}
+
+// Addr returns the DevProvider's issuer.
+func (d *DevProvider) Addr() string { return d.tp.Addr() }
+
+// CACert returns the pem-encoded CA certificate of the DevProvider's https
+// server.
+func (d *DevProvider) CACert() string { return d.tp.CACert() }
+
+// HTTPClient returns an http.Client which trusts the DevProvider's CA
+// certificate.
+func (d *DevProvider) HTTPClient() *http.Client { return d.tp.HTTPClient() }
+
+// Stop stops the DevProvider.
+func (d *DevProvider) Stop() { d.tp.Stop() }
+
+// ServeHTTP implements the DevProvider's http.Handler.  The authorize, token
+// and userinfo endpoints are handled by the DevProvider, and the rest are
+// handled by its TestProvider.  A failure reported by the TestProvider (which
+// fails its devT) is returned as a 500 response.
+func (d *DevProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(devFailure); !ok {
+				panic(r)
+			}
+			http.Error(w, fmt.Sprintf("dev provider failure: %s", d.t.err()), http.StatusInternalServerError)
+		}
+	}()
+	switch req.URL.Path {
+	case "/authorize":
+		d.authorize(w, req)
+	case "/token":
+		d.token(w, req)
+	case "/userinfo":
+		d.userInfo(w, req)
+	default:
+		d.tp.ServeHTTP(w, req)
+	}
+}
+
+// authorize handles an authorization code flow's auth request.
+func (d *DevProvider) authorize(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	client, ok := d.clients[req.FormValue("client_id")]
+	if !ok {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI := req.FormValue("redirect_uri")
+	if !devValidRedirect(client, redirectURI) {
+		http.Error(w, "redirect_uri is not allowed", http.StatusBadRequest)
+		return
+	}
+	state := req.FormValue("state")
+	switch {
+	case req.FormValue("response_type") != "code":
+		devAuthRedirect(w, req, redirectURI, d.Addr(), url.Values{"state": {state}, "error": {"unsupported_response_type"}})
+		return
+	case !strutils.StrListContains(strings.Fields(req.FormValue("scope")), "openid"):
+		devAuthRedirect(w, req, redirectURI, d.Addr(), url.Values{"state": {state}, "error": {"invalid_scope"}})
+		return
+	case req.FormValue("response_mode") != "" && req.FormValue("response_mode") != string(QueryResponseMode):
+		devAuthRedirect(w, req, redirectURI, d.Addr(), url.Values{"state": {state}, "error": {"unsupported_response_mode"}})
+		return
+	case req.FormValue("code_challenge") != "" && req.FormValue("code_challenge_method") != string(S256):
+		devAuthRedirect(w, req, redirectURI, d.Addr(), url.Values{"state": {state}, "error": {"invalid_request"}, "error_description": {"code_challenge_method must be S256"}})
+		return
+	case client.Secret == "" && req.FormValue("code_challenge") == "":
+		devAuthRedirect(w, req, redirectURI, d.Addr(), url.Values{"state": {state}, "error": {"invalid_request"}, "error_description": {"public clients must use PKCE"}})
+		return
+	}
+	user, ok := d.user(req.FormValue("login_hint"))
+	if !ok {
+		devAuthRedirect(w, req, redirectURI, d.Addr(), url.Values{"state": {state}, "error": {"access_denied"}, "error_description": {"unknown login_hint"}})
+		return
+	}
+	code, err := NewID(WithPrefix("code"))
+	if err != nil {
+		http.Error(w, "unable to create code", http.StatusInternalServerError)
+		return
+	}
+	d.mu.Lock()
+	d.codes[code] = devGrant{
+		client:      client,
+		user:        user,
+		nonce:       req.FormValue("nonce"),
+		challenge:   req.FormValue("code_challenge"),
+		redirectURI: redirectURI,
+		expiresAt:   time.Now().Add(devCodeTTL),
+	}
+	d.mu.Unlock()
+	devAuthRedirect(w, req, redirectURI, d.Addr(), url.Values{"state": {state}, "code": {code}})
+}
+
+// token handles the authorization_code and refresh_token grants, by
+// configuring the TestProvider for the grant's client and user before it
+// issues the tokens.
+func (d *DevProvider) token(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		devTokenError(w, http.StatusBadRequest, "invalid_request", "unable to parse form")
+		return
+	}
+	client, ok := d.authenticate(req)
+	if !ok {
+		devTokenError(w, http.StatusUnauthorized, "invalid_client", "")
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var g devGrant
+	refreshToken := req.FormValue("refresh_token")
+	switch req.FormValue("grant_type") {
+	case "authorization_code":
+		code := req.FormValue("code")
+		g, ok = d.codes[code]
+		delete(d.codes, code)
+		switch {
+		case !ok || time.Now().After(g.expiresAt) || g.client.ID != client.ID:
+			devTokenError(w, http.StatusBadRequest, "invalid_grant", "unknown or expired code")
+			return
+		case req.FormValue("redirect_uri") != g.redirectURI:
+			devTokenError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri doesn't match")
+			return
+		case g.challenge != "" && !devValidVerifier(g.challenge, req.FormValue("code_verifier")):
+			devTokenError(w, http.StatusBadRequest, "invalid_grant", "invalid code_verifier")
+			return
+		}
+		var err error
+		if refreshToken, err = NewID(WithPrefix("rt")); err != nil {
+			devTokenError(w, http.StatusInternalServerError, "server_error", "unable to create refresh_token")
+			return
+		}
+		d.tp.SetExpectedAuthCode(code)
+		d.tp.SetExpectedAuthNonce(g.nonce)
+		d.tp.SetAllowedRedirectURIs([]string{g.redirectURI})
+	case "refresh_token":
+		g, ok = d.refreshTokens[refreshToken]
+		if !ok || g.client.ID != client.ID {
+			devTokenError(w, http.StatusBadRequest, "invalid_grant", "unknown refresh_token")
+			return
+		}
+		d.tp.SetExpectedAuthNonce("")
+	default:
+		devTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+	claims := make(map[string]interface{}, len(g.user.Claims)+1)
+	for k, v := range g.user.Claims {
+		claims[k] = v
+	}
+	claims["sub"] = g.user.Subject
+	d.tp.SetCustomClaims(claims)
+	d.tp.SetClientCreds(client.ID, client.Secret)
+	d.tp.SetExpectedRefreshToken(refreshToken)
+	// the code_verifier was verified using the grant's code_challenge
+	req.Form.Del("code_verifier")
+
+	rec := httptest.NewRecorder()
+	d.tp.ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK {
+		var reply struct {
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &reply); err == nil && reply.AccessToken != "" {
+			d.accessTokens[reply.AccessToken] = g.user
+		}
+		d.refreshTokens[refreshToken] = g
+	}
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rec.Code)
+	_, _ = w.Write(rec.Body.Bytes())
+}
+
+// userInfo handles a userinfo request, which returns the claims of the
+// access_token's user.
+func (d *DevProvider) userInfo(w http.ResponseWriter, req *http.Request) {
+	accessToken := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	d.mu.Lock()
+	user, ok := d.accessTokens[accessToken]
+	d.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	claims := make(map[string]interface{}, len(user.Claims)+1)
+	for k, v := range user.Claims {
+		claims[k] = v
+	}
+	claims["sub"] = user.Subject
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(claims)
+}
+
+// authenticate returns the request's client, which authenticates using http
+// basic auth or the request's form.
+func (d *DevProvider) authenticate(req *http.Request) (DevClient, bool) {
+	id, secret, ok := req.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = req.FormValue("client_id"), req.FormValue("client_secret")
+	}
+	client, ok := d.clients[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(client.Secret), []byte(secret)) != 1 {
+		return DevClient{}, false
+	}
+	return client, true
+}
+
+// user returns the user for the login_hint, which is the first user when the
+// hint is empty.
+func (d *DevProvider) user(hint string) (DevUser, bool) {
+	if hint == "" {
+		return d.users[0], true
+	}
+	for _, u := range d.users {
+		if u.Subject == hint || u.Claims["email"] == hint {
+			return u, true
+		}
+	}
+	return DevUser{}, false
+}
+
+// devValidRedirect returns true when the client allows the redirect URI.
+func devValidRedirect(c DevClient, redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	if err != nil || redirectURI == "" {
+		return false
+	}
+	if len(c.RedirectURIs) == 0 {
+		return true
+	}
+	for _, allowed := range c.RedirectURIs {
+		if allowed == redirectURI {
+			return true
+		}
+		a, err := url.Parse(allowed)
+		if err != nil || !isLoopback(u.Hostname()) {
+			continue
+		}
+		if a.Scheme == u.Scheme && a.Hostname() == u.Hostname() && a.Path == u.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// devValidVerifier returns true when the PKCE verifier matches the S256
+// challenge.
+func devValidVerifier(challenge, verifier string) bool {
+	h := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(h[:]) == challenge
+}
+
+// devAuthRedirect redirects an auth response to the redirect URI.  The
+// issuer is always included as the response's iss parameter.
+// See: https://www.rfc-editor.org/rfc/rfc9207.html
+func devAuthRedirect(w http.ResponseWriter, req *http.Request, redirectURI, issuer string, params url.Values) {
+	u, _ := url.Parse(redirectURI)
+	q := u.Query()
+	q.Set("iss", issuer)
+	for k, v := range params {
+		if len(v) > 0 && v[0] != "" {
+			q[k] = v
+		}
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, req, u.String(), http.StatusFound)
+}
+
+// devTokenError writes a token endpoint's error response.
+func devTokenError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
+
+// startDevTestProvider starts a TestProvider outside of a test, which reports
+// its failures to t, and returns an error (rather than failing a test) when
+// it can't be started.
+func startDevTestProvider(t *devT, opt ...Option) (tp *TestProvider, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(devFailure); !ok {
+				panic(r)
+			}
+			err = t.err()
+		}
+	}()
+	return StartTestProvider(t, opt...), nil
+}
+
+// devT implements the TestingT interface for a DevProvider's TestProvider.  A
+// failure panics to stop the failing function, and the panic is recovered by
+// startDevTestProvider or DevProvider.ServeHTTP.
+type devT struct {
+	mu     sync.Mutex
+	errors []string
+}
+
+// devFailure is the value of a devT's FailNow() panic.
+type devFailure struct{}
+
+// Errorf implements the TestingT.Errorf() interface function.
+func (t *devT) Errorf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+// FailNow implements the TestingT.FailNow() interface function.
+func (t *devT) FailNow() {
+	panic(devFailure{})
+}
+
+// err returns the errors reported to the devT, and clears them so they're
+// only reported once.
+func (t *devT) err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	err := errors.New(strings.Join(t.errors, "; "))
+	t.errors = nil
+	return err
+}
+
+// devProviderOptions is the set of available options for DevProvider
+// functions
+type devProviderOptions struct {
+	withClients    []DevClient
+	withUsers      []DevUser
+	withTokenTTL   time.Duration
+	withOutput     io.Writer
+	withCACertFile string
+}
+
+// devProviderDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func devProviderDefaults() devProviderOptions {
+	return devProviderOptions{
+		withTokenTTL: DefaultDevTokenTTL,
+		withOutput:   os.Stderr,
+	}
+}
+
+// getDevProviderOpts gets the DevProvider defaults and applies the opt
+// overrides passed in
+func getDevProviderOpts(opt ...Option) devProviderOptions {
+	opts := devProviderDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithDevClient provides an optional client to register with a DevProvider,
+// which replaces the default client.  It may be used more than once.
+//
+// Valid for: DevProvider
+func WithDevClient(c DevClient) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*devProviderOptions); ok {
+			o.withClients = append(o.withClients, c)
+		}
+	}
+}
+
+// WithDevUser provides an optional user of a DevProvider, which replaces the
+// default user.  It may be used more than once, and the first user is logged
+// in when an auth request doesn't have a login_hint.
+//
+// Valid for: DevProvider
+func WithDevUser(u DevUser) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*devProviderOptions); ok {
+			o.withUsers = append(o.withUsers, u)
+		}
+	}
+}
+
+// WithDevTokenTTL provides an optional lifetime for the tokens issued by a
+// DevProvider.  The default is DefaultDevTokenTTL.
+//
+// Valid for: DevProvider
+func WithDevTokenTTL(ttl time.Duration) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*devProviderOptions); ok {
+			o.withTokenTTL = ttl
+		}
+	}
+}
+
+// WithDevOutput provides an optional writer for the DevProvider's startup
+// information.  The default is os.Stderr.
+//
+// Valid for: RunDevProvider
+func WithDevOutput(w io.Writer) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*devProviderOptions); ok && w != nil {
+			o.withOutput = w
+		}
+	}
+}
+
+// WithDevCACertFile provides an optional file which the DevProvider's
+// pem-encoded CA certificate is written to when it starts.
+//
+// Valid for: RunDevProvider
+func WithDevCACertFile(path string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*devProviderOptions); ok {
+			o.withCACertFile = path
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDevProvider(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const redirect = "http://127.0.0.1:8250/callback"
+
+	d, err := StartDevProvider(
+		WithDevClient(DevClient{ID: "app", Secret: "app-secret", RedirectURIs: []string{"http://127.0.0.1/callback"}}),
+		WithDevClient(DevClient{ID: "public-app"}),
+		WithDevUser(DevUser{Subject: "alice", Claims: map[string]interface{}{"email": "alice@example.com"}}),
+		WithDevUser(DevUser{Subject: "bob", Claims: map[string]interface{}{"email": "bob@example.com", "groups": []interface{}{"admins"}}}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(d.Stop)
+
+	newProvider := func(t *testing.T, clientID, clientSecret string) *Provider {
+		t.Helper()
+		c, err := NewConfig(d.Addr(), clientID, ClientSecret(clientSecret), []Alg{ES256}, []string{redirect}, WithProviderCA(d.CACert()))
+		require.NoError(t, err)
+		p, err := NewProvider(c)
+		require.NoError(t, err)
+		t.Cleanup(p.Done)
+		return p
+	}
+	// authorize follows the auth URL (with optional extra params) and returns
+	// the callback's query.
+	authorize := func(t *testing.T, p *Provider, r Request, extra url.Values) url.Values {
+		t.Helper()
+		authURL, err := p.AuthURL(ctx, r)
+		require.NoError(t, err)
+		u, err := url.Parse(authURL)
+		require.NoError(t, err)
+		q := u.Query()
+		for k, v := range extra {
+			q[k] = v
+		}
+		u.RawQuery = q.Encode()
+		client := *d.HTTPClient()
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		resp, err := client.Get(u.String())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+		location, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		return location.Query()
+	}
+
+	t.Run("login-hint-refresh-and-userinfo", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p := newProvider(t, "app", "app-secret")
+		v, err := NewCodeVerifier()
+		require.NoError(err)
+		r, err := NewRequest(time.Minute, redirect, WithPKCE(v))
+		require.NoError(err)
+
+		q := authorize(t, p, r, url.Values{"login_hint": {"bob@example.com"}})
+		require.Empty(q.Get("error"))
+		assert.Equal(r.State(), q.Get("state"))
+		assert.Equal(d.Addr(), q.Get("iss"))
+		require.NoError(p.VerifyResponseIssuer(ctx, q.Get("iss")))
+		tk, err := p.Exchange(ctx, r, q.Get("state"), q.Get("code"))
+		require.NoError(err)
+		var claims map[string]interface{}
+		require.NoError(tk.IDToken().Claims(&claims))
+		assert.Equal("bob", claims["sub"])
+		assert.Equal([]interface{}{"admins"}, claims["groups"])
+		assert.Equal(r.Nonce(), claims["nonce"])
+		assert.True(tk.Valid())
+
+		var info map[string]interface{}
+		require.NoError(p.UserInfo(ctx, tk.StaticTokenSource(), "bob", &info))
+		assert.Equal("bob@example.com", info["email"])
+
+		require.NotEmpty(tk.RefreshToken())
+		refreshed, err := p.RefreshToken(ctx, tk)
+		require.NoError(err)
+		require.NoError(refreshed.IDToken().Claims(&claims))
+		assert.Equal("bob", claims["sub"])
+
+		// a code can only be used once
+		_, err = p.Exchange(ctx, r, q.Get("state"), q.Get("code"))
+		require.Error(err)
+	})
+	t.Run("default-user-public-client", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p := newProvider(t, "public-app", "")
+		v, err := NewCodeVerifier()
+		require.NoError(err)
+		r, err := NewRequest(time.Minute, redirect, WithPKCE(v))
+		require.NoError(err)
+		q := authorize(t, p, r, nil)
+		tk, err := p.Exchange(ctx, r, q.Get("state"), q.Get("code"))
+		require.NoError(err)
+		var claims map[string]interface{}
+		require.NoError(tk.IDToken().Claims(&claims))
+		assert.Equal("alice", claims["sub"])
+	})
+	t.Run("public-client-without-pkce", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p := newProvider(t, "public-app", "")
+		r, err := NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		q := authorize(t, p, r, nil)
+		assert.Equal("invalid_request", q.Get("error"))
+	})
+	t.Run("unknown-login-hint", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p := newProvider(t, "app", "app-secret")
+		r, err := NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		q := authorize(t, p, r, url.Values{"login_hint": {"eve"}})
+		assert.Equal("access_denied", q.Get("error"))
+		assert.Equal(r.State(), q.Get("state"))
+	})
+	t.Run("invalid-verifier", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p := newProvider(t, "app", "app-secret")
+		v, err := NewCodeVerifier()
+		require.NoError(err)
+		r, err := NewRequest(time.Minute, redirect, WithPKCE(v))
+		require.NoError(err)
+		q := authorize(t, p, r, nil)
+		other, err := NewCodeVerifier()
+		require.NoError(err)
+		r.withVerifier = other
+		_, err = p.Exchange(ctx, r, q.Get("state"), q.Get("code"))
+		require.Error(err)
+		var oauthErr *OAuthError
+		require.True(errors.As(err, &oauthErr))
+		assert.Equal("invalid_grant", oauthErr.Code)
+	})
+	t.Run("invalid-client-secret", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		r, err := NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		q := authorize(t, newProvider(t, "app", "app-secret"), r, nil)
+		_, err = newProvider(t, "app", "wrong-secret").Exchange(ctx, r, q.Get("state"), q.Get("code"))
+		require.Error(err)
+		var oauthErr *OAuthError
+		require.True(errors.As(err, &oauthErr))
+		assert.Equal("invalid_client", oauthErr.Code)
+	})
+	t.Run("unauthorized-redirect", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		resp, err := d.HTTPClient().Get(d.Addr() + "/authorize?" + url.Values{
+			"client_id":     {"app"},
+			"redirect_uri":  {"https://evil.example.com/callback"},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+		}.Encode())
+		require.NoError(err)
+		resp.Body.Close()
+		assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	})
+	t.Run("unknown-client", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		resp, err := d.HTTPClient().Get(d.Addr() + "/authorize?" + url.Values{
+			"client_id":    {"unknown"},
+			"redirect_uri": {redirect},
+		}.Encode())
+		require.NoError(err)
+		resp.Body.Close()
+		assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestDevProvider_failure(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	const redirect = "http://127.0.0.1:8250/callback"
+
+	// the user's claims can't be marshaled, which fails the TestProvider
+	// when it signs the id_token
+	d, err := StartDevProvider(WithDevUser(DevUser{Subject: "alice", Claims: map[string]interface{}{"invalid": func() {}}}))
+	require.NoError(err)
+	t.Cleanup(d.Stop)
+	c, err := NewConfig(d.Addr(), DefaultDevClientID, ClientSecret(DefaultDevClientSecret), []Alg{ES256}, []string{redirect}, WithProviderCA(d.CACert()))
+	require.NoError(err)
+	p, err := NewProvider(c)
+	require.NoError(err)
+	t.Cleanup(p.Done)
+
+	r, err := NewRequest(time.Minute, redirect)
+	require.NoError(err)
+	authURL, err := p.AuthURL(ctx, r)
+	require.NoError(err)
+	client := *d.HTTPClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	require.NoError(err)
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(err)
+
+	// the failure is returned as a 500 response
+	resp, err = d.HTTPClient().PostForm(d.Addr()+"/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+		"redirect_uri":  {redirect},
+		"client_id":     {DefaultDevClientID},
+		"client_secret": {DefaultDevClientSecret},
+	})
+	require.NoError(err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(err)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+	assert.Contains(string(body), "dev provider failure")
+
+	// and the provider keeps serving requests
+	resp, err = d.HTTPClient().Get(d.Addr() + "/.well-known/openid-configuration")
+	require.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+}
+
+func TestStartDevProvider(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "defaults"},
+		{name: "empty-client-id", opts: []Option{WithDevClient(DevClient{})}, wantErr: true, wantIsErr: ErrInvalidParameter},
+		{name: "empty-subject", opts: []Option{WithDevUser(DevUser{})}, wantErr: true, wantIsErr: ErrInvalidParameter},
+		{name: "invalid-ttl", opts: []Option{WithDevTokenTTL(0)}, wantErr: true, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			d, err := StartDevProvider(tt.opts...)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			defer d.Stop()
+			assert.Equal(DevClient{ID: DefaultDevClientID, Secret: DefaultDevClientSecret}, d.clients[DefaultDevClientID])
+			require.Len(d.users, 1)
+			assert.Equal("alice@example.com", d.users[0].Subject)
+		})
+	}
+}
+
+func TestRunDevProvider(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	done := make(chan error)
+	go func() {
+		done <- RunDevProvider(ctx, WithDevOutput(&out), WithDevCACertFile(caFile))
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	require.NoError(<-done)
+	ca, err := ioutil.ReadFile(caFile)
+	require.NoError(err)
+	assert.Contains(out.String(), string(ca))
+	assert.Contains(out.String(), "Dev OIDC provider issuer: https://127.0.0.1:")
+	assert.Contains(out.String(), DefaultDevClientID)
+	assert.Contains(out.String(), "alice@example.com")
+	assert.True(strings.Contains(out.String(), "BEGIN CERTIFICATE"))
+
+	//nolint:staticcheck // testing a nil ctx
+	err = RunDevProvider(nil)
+	require.Error(err)
+	assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+}
+
+func Test_DevProviderOptions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	var out bytes.Buffer
+	opts := getDevProviderOpts(
+		WithDevClient(DevClient{ID: "a"}),
+		WithDevClient(DevClient{ID: "b"}),
+		WithDevUser(DevUser{Subject: "alice"}),
+		WithDevTokenTTL(time.Minute),
+		WithDevOutput(&out),
+		WithDevCACertFile("ca.pem"),
+	)
+	testOpts := devProviderDefaults()
+	testOpts.withClients = []DevClient{{ID: "a"}, {ID: "b"}}
+	testOpts.withUsers = []DevUser{{Subject: "alice"}}
+	testOpts.withTokenTTL = time.Minute
+	testOpts.withOutput = &out
+	testOpts.withCACertFile = "ca.pem"
+	assert.Equal(opts, testOpts)
+}
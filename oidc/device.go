@@ -0,0 +1,295 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/hashicorp/cap/oidc/internal/strutils"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// DeviceCodeGrantType is the grant_type of the device authorization grant.
+// See: https://tools.ietf.org/html/rfc8628#section-3.4
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DefaultDevicePollInterval is the interval between token requests when the
+// provider's device authorization response doesn't include one.
+const DefaultDevicePollInterval = 5 * time.Second
+
+// deviceSlowDownIncrement is added to the poll interval every time the
+// provider responds with slow_down.
+const deviceSlowDownIncrement = 5 * time.Second
+
+// DeviceAuthorization is the provider's response to a device authorization
+// request, which the user completes on another device (like their phone) by
+// visiting the VerificationURI and entering the UserCode.
+//
+// See: https://tools.ietf.org/html/rfc8628#section-3.2
+type DeviceAuthorization struct {
+	// DeviceCode is the device verification code, which is used to poll for
+	// the user's tokens.  It must not be shown to the user.
+	DeviceCode string
+
+	// UserCode is the code the user enters at the VerificationURI.
+	UserCode string
+
+	// VerificationURI is where the user authorizes the device.
+	VerificationURI string
+
+	// VerificationURIComplete is an optional VerificationURI which includes
+	// the UserCode, and is intended to be displayed as a QR code.
+	VerificationURIComplete string
+
+	// ExpiresAt is when the DeviceCode and UserCode expire.  It's a zero
+	// value when the provider didn't specify when they expire.
+	ExpiresAt time.Time
+
+	// Interval is the minimum amount of time between token requests.
+	Interval time.Duration
+}
+
+// LoginURI returns the URI to present to the user, which is the
+// VerificationURIComplete when the provider returned one.
+func (d *DeviceAuthorization) LoginURI() string {
+	if d.VerificationURIComplete != "" {
+		return d.VerificationURIComplete
+	}
+	return d.VerificationURI
+}
+
+// DeviceAuthorization starts a device authorization grant, which allows a
+// device without a browser (or a terminal app) to log a user in via another
+// device.  The returned DeviceAuthorization's LoginURI() and UserCode should
+// be presented to the user, and then PollDeviceToken(...) used to wait for
+// them to complete the login.
+//
+// The openid scope is always requested.  The WithScopes option is supported to
+// request scopes other than the config's Scopes.
+//
+// See: https://tools.ietf.org/html/rfc8628
+func (p *Provider) DeviceAuthorization(ctx context.Context, opt ...Option) (*DeviceAuthorization, error) {
+	const op = "Provider.DeviceAuthorization"
+	config := p.currentConfig()
+	if config == nil {
+		return nil, fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
+	}
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	opts := getGrantOpts(opt...)
+	provider, _, err := p.discovered(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	var m providerMetadata
+	if err := provider.Claims(&m); err != nil {
+		return nil, fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+	}
+	if m.DeviceAuthorizationEndpoint == "" {
+		return nil, fmt.Errorf("%s: provider doesn't have a device_authorization_endpoint: %w", op, ErrInvalidParameter)
+	}
+	client, err := p.HTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create http client: %w", op, err)
+	}
+	client = p.endpointClient(client, tokenEndpoint)
+
+	form := url.Values{
+		"client_id": {config.ClientID},
+		"scope":     {strings.Join(grantScopes(config, opts), " ")},
+	}
+	req, err := http.NewRequest(http.MethodPost, m.DeviceAuthorizationEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create request: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(string(config.ClientSecret)))
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to read response body: %w", op, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		oauthErr := parseOAuthErrorBody(body)
+		oauthErr.StatusCode = resp.StatusCode
+		oauthErr.err = fmt.Errorf("%s: %s %s: %w", op, resp.Status, body, ErrLoginFailed)
+		return nil, oauthErr
+	}
+	var da struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURL         string `json:"verification_url"` // used by some providers (like Google)
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int64  `json:"expires_in"`
+		Interval                int64  `json:"interval"`
+	}
+	if err := json.Unmarshal(body, &da); err != nil {
+		return nil, fmt.Errorf("%s: unable to decode response: %w", op, err)
+	}
+	if da.VerificationURI == "" {
+		da.VerificationURI = da.VerificationURL
+	}
+	switch {
+	case da.DeviceCode == "":
+		return nil, fmt.Errorf("%s: response is missing the device_code: %w", op, ErrLoginFailed)
+	case da.UserCode == "":
+		return nil, fmt.Errorf("%s: response is missing the user_code: %w", op, ErrLoginFailed)
+	case da.VerificationURI == "":
+		return nil, fmt.Errorf("%s: response is missing the verification_uri: %w", op, ErrLoginFailed)
+	}
+	d := &DeviceAuthorization{
+		DeviceCode:              da.DeviceCode,
+		UserCode:                da.UserCode,
+		VerificationURI:         da.VerificationURI,
+		VerificationURIComplete: da.VerificationURIComplete,
+		Interval:                DefaultDevicePollInterval,
+	}
+	if da.ExpiresIn > 0 {
+		d.ExpiresAt = config.Now().Add(time.Duration(da.ExpiresIn) * time.Second)
+	}
+	if da.Interval > 0 {
+		d.Interval = time.Duration(da.Interval) * time.Second
+	}
+	return d, nil
+}
+
+// PollDeviceToken polls the provider's token endpoint until the user
+// completes (or denies) the device authorization, and returns their Token.
+// The poll interval is the DeviceAuthorization's Interval, which is increased
+// when the provider asks the client to slow down.  The ctx can be used to
+// cancel polling.
+//
+// If the user denies the authorization, then an error wrapping ErrLoginFailed
+// is returned.  If the device code expires, then an error wrapping
+// ErrExpiredRequest is returned.
+//
+// The provider's response must include an id_token, which is verified like
+// Provider.SAML2BearerGrant(...).
+func (p *Provider) PollDeviceToken(ctx context.Context, d *DeviceAuthorization) (*Tk, error) {
+	const op = "Provider.PollDeviceToken"
+	config := p.currentConfig()
+	if config == nil {
+		return nil, fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
+	}
+	if d == nil {
+		return nil, fmt.Errorf("%s: device authorization is nil: %w", op, ErrNilParameter)
+	}
+	if d.DeviceCode == "" {
+		return nil, fmt.Errorf("%s: device code is empty: %w", op, ErrInvalidParameter)
+	}
+	interval := d.Interval
+	if interval <= 0 {
+		interval = DefaultDevicePollInterval
+	}
+	for {
+		if !d.ExpiresAt.IsZero() && !config.Now().Before(d.ExpiresAt) {
+			return nil, fmt.Errorf("%s: device code is expired: %w", op, ErrExpiredRequest)
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%s: %w", op, ctx.Err())
+		case <-timer.C:
+		}
+		t, err := p.deviceToken(ctx, config, d.DeviceCode)
+		var oauthErr *OAuthError
+		switch {
+		case err == nil:
+			return t, nil
+		case errors.As(err, &oauthErr) && oauthErr.Code == "authorization_pending":
+			continue
+		case errors.As(err, &oauthErr) && oauthErr.Code == "slow_down":
+			interval += deviceSlowDownIncrement
+			continue
+		case errors.As(err, &oauthErr) && oauthErr.Code == "access_denied":
+			return nil, fmt.Errorf("%s: user denied the device authorization: %s: %w", op, err, ErrLoginFailed)
+		case errors.As(err, &oauthErr) && oauthErr.Code == "expired_token":
+			return nil, fmt.Errorf("%s: device code is expired: %s: %w", op, err, ErrExpiredRequest)
+		default:
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+}
+
+// deviceToken makes a single token request for the device code.
+func (p *Provider) deviceToken(ctx context.Context, config *Config, deviceCode string) (*Tk, error) {
+	const op = "Provider.deviceToken"
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	provider, _, err := p.discovered(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	oidcCtx, err := p.limitedClientContext(ctx, tokenEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create http client: %w", op, err)
+	}
+	// the client credentials token source allows its grant_type to be
+	// overridden, which avoids reimplementing the token request.
+	grantConfig := clientcredentials.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: string(config.ClientSecret),
+		TokenURL:     provider.Endpoint().TokenURL,
+		EndpointParams: map[string][]string{
+			"grant_type":  {DeviceCodeGrantType},
+			"device_code": {deviceCode},
+		},
+		AuthStyle: provider.Endpoint().AuthStyle,
+	}
+	if config.ClientSecret == "" {
+		grantConfig.EndpointParams["client_id"] = []string{config.ClientID}
+	}
+	oauth2Token, err := grantConfig.Token(oidcCtx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to get token from provider: %w", op, newOAuthError(err, convertError(err)))
+	}
+	idToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok || idToken == "" {
+		return nil, fmt.Errorf("%s: id_token is missing from device code grant: %w", op, ErrMissingIDToken)
+	}
+	decrypted, err := decryptIDToken(config.IDTokenDecryptionKeys, IDToken(idToken))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	t, err := NewToken(decrypted, oauth2Token, WithNow(config.NowFunc))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create new token: %w", op, err)
+	}
+	if _, err := p.verifyIDToken(ctx, t.IDToken(), nil, nil); err != nil {
+		return nil, fmt.Errorf("%s: id_token failed verification: %w", op, err)
+	}
+	if t.AccessToken() != "" {
+		if _, err := t.IDToken().VerifyAccessToken(t.AccessToken()); err != nil {
+			return nil, fmt.Errorf("%s: access_token failed verification: %w", op, err)
+		}
+	}
+	return t, nil
+}
+
+// grantScopes returns the scopes requested by a grant, which always include
+// the "openid" scope since it's required for an id_token.
+func grantScopes(config *Config, opts grantOptions) []string {
+	scopes := config.Scopes
+	if len(opts.withScopes) > 0 {
+		scopes = opts.withScopes
+	}
+	if !strutils.StrListContains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	return scopes
+}
@@ -0,0 +1,296 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestProvider_DeviceAuthorization(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	type deviceRequest struct {
+		clientID, secret, scope string
+	}
+	newProvider := func(t *testing.T, withEndpoint bool, resp map[string]interface{}) (*Provider, func() []deviceRequest) {
+		t.Helper()
+		var mu sync.Mutex
+		var requests []deviceRequest
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/device":
+				id, secret, _ := req.BasicAuth()
+				mu.Lock()
+				requests = append(requests, deviceRequest{clientID: id, secret: secret, scope: req.FormValue("scope")})
+				mu.Unlock()
+				if _, ok := resp["error"]; ok {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+				_ = json.NewEncoder(w).Encode(resp)
+			default:
+				doc := map[string]interface{}{
+					"issuer":         srv.URL,
+					"jwks_uri":       srv.URL + "/jwks",
+					"token_endpoint": srv.URL + "/token",
+				}
+				if withEndpoint {
+					doc["device_authorization_endpoint"] = srv.URL + "/device"
+				}
+				_ = json.NewEncoder(w).Encode(doc)
+			}
+		}))
+		t.Cleanup(srv.Close)
+		c, err := NewConfig(srv.URL, "client-id", "client-secret", []Alg{ES256}, []string{"https://redirect"}, WithScopes("email"))
+		require.NoError(t, err)
+		p, err := NewProvider(c)
+		require.NoError(t, err)
+		t.Cleanup(p.Done)
+		return p, func() []deviceRequest {
+			mu.Lock()
+			defer mu.Unlock()
+			return requests
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, requests := newProvider(t, true, map[string]interface{}{
+			"device_code":               "device-code",
+			"user_code":                 "WDJB-MJHT",
+			"verification_uri":          "https://example.com/device",
+			"verification_uri_complete": "https://example.com/device?user_code=WDJB-MJHT",
+			"expires_in":                1800,
+			"interval":                  10,
+		})
+		now := time.Now()
+		p.config.NowFunc = func() time.Time { return now }
+		d, err := p.DeviceAuthorization(ctx)
+		require.NoError(err)
+		assert.Equal(&DeviceAuthorization{
+			DeviceCode:              "device-code",
+			UserCode:                "WDJB-MJHT",
+			VerificationURI:         "https://example.com/device",
+			VerificationURIComplete: "https://example.com/device?user_code=WDJB-MJHT",
+			ExpiresAt:               now.Add(30 * time.Minute),
+			Interval:                10 * time.Second,
+		}, d)
+		assert.Equal("https://example.com/device?user_code=WDJB-MJHT", d.LoginURI())
+		assert.Equal([]deviceRequest{{clientID: "client-id", secret: "client-secret", scope: "openid email"}}, requests())
+	})
+	t.Run("verification-url-and-defaults", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, requests := newProvider(t, true, map[string]interface{}{
+			"device_code":      "device-code",
+			"user_code":        "WDJB-MJHT",
+			"verification_url": "https://example.com/device",
+		})
+		d, err := p.DeviceAuthorization(ctx, WithScopes("profile"))
+		require.NoError(err)
+		assert.Equal("https://example.com/device", d.LoginURI())
+		assert.Equal(DefaultDevicePollInterval, d.Interval)
+		assert.True(d.ExpiresAt.IsZero())
+		assert.Equal("openid profile", requests()[0].scope)
+	})
+	t.Run("missing-user-code", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, _ := newProvider(t, true, map[string]interface{}{
+			"device_code":      "device-code",
+			"verification_uri": "https://example.com/device",
+		})
+		_, err := p.DeviceAuthorization(ctx)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrLoginFailed), "wanted \"%s\" but got \"%s\"", ErrLoginFailed, err)
+	})
+	t.Run("error-response", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, _ := newProvider(t, true, map[string]interface{}{"error": "unauthorized_client"})
+		_, err := p.DeviceAuthorization(ctx)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrLoginFailed), "wanted \"%s\" but got \"%s\"", ErrLoginFailed, err)
+		var oauthErr *OAuthError
+		require.True(errors.As(err, &oauthErr))
+		assert.Equal("unauthorized_client", oauthErr.Code)
+		assert.Equal(http.StatusBadRequest, oauthErr.StatusCode)
+	})
+	t.Run("missing-endpoint", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, requests := newProvider(t, false, nil)
+		_, err := p.DeviceAuthorization(ctx)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+		assert.Empty(requests())
+	})
+}
+
+func TestProvider_PollDeviceToken(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pub, priv := TestGenerateKeys(t)
+
+	// newProvider returns a provider whose token endpoint responds with the
+	// errors in order and then with a token, along with a func which returns
+	// the number of token requests.
+	newProvider := func(t *testing.T, errs ...string) (*Provider, func() int) {
+		t.Helper()
+		var mu sync.Mutex
+		var count int
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/jwks":
+				_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: pub, Algorithm: string(ES256), Use: "sig"}}})
+			case "/token":
+				if req.FormValue("grant_type") != DeviceCodeGrantType || req.FormValue("device_code") != "device-code" {
+					w.WriteHeader(http.StatusBadRequest)
+					_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+					return
+				}
+				// the token source retries a failed request using the form
+				// for client auth, which is counted as the same poll
+				mu.Lock()
+				n := count - 1
+				if _, _, ok := req.BasicAuth(); ok {
+					n = count
+					count++
+				}
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				if n < len(errs) {
+					w.WriteHeader(http.StatusBadRequest)
+					_ = json.NewEncoder(w).Encode(map[string]string{"error": errs[n]})
+					return
+				}
+				now := time.Now()
+				idToken := TestSignJWT(t, priv, ES256, map[string]interface{}{
+					"iss": srv.URL,
+					"aud": []string{"client-id"},
+					"sub": "alice@example.com",
+					"exp": now.Add(time.Minute).Unix(),
+					"iat": now.Unix(),
+					"nbf": now.Unix(),
+				}, nil)
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"access_token": "access-token",
+					"token_type":   "Bearer",
+					"expires_in":   60,
+					"id_token":     idToken,
+				})
+			default:
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"issuer":         srv.URL,
+					"jwks_uri":       srv.URL + "/jwks",
+					"token_endpoint": srv.URL + "/token",
+				})
+			}
+		}))
+		t.Cleanup(srv.Close)
+		c, err := NewConfig(srv.URL, "client-id", "client-secret", []Alg{ES256}, []string{"https://redirect"})
+		require.NoError(t, err)
+		p, err := NewProvider(c)
+		require.NoError(t, err)
+		t.Cleanup(p.Done)
+		return p, func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return count
+		}
+	}
+	device := func() *DeviceAuthorization {
+		return &DeviceAuthorization{DeviceCode: "device-code", Interval: time.Millisecond}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, count := newProvider(t, "authorization_pending", "authorization_pending")
+		tk, err := p.PollDeviceToken(ctx, device())
+		require.NoError(err)
+		assert.Equal(AccessToken("access-token"), tk.AccessToken())
+		claims := map[string]interface{}{}
+		require.NoError(tk.IDToken().Claims(&claims))
+		assert.Equal("alice@example.com", claims["sub"])
+		assert.Equal(3, count())
+	})
+	t.Run("slow-down", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, count := newProvider(t, "slow_down")
+		ctx, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+		defer cancel()
+		_, err := p.PollDeviceToken(ctx, device())
+		require.Error(err)
+		assert.Truef(errors.Is(err, context.DeadlineExceeded), "wanted \"%s\" but got \"%s\"", context.DeadlineExceeded, err)
+		// the interval was increased, so there wasn't a second request
+		assert.Equal(1, count())
+	})
+	t.Run("access-denied", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, _ := newProvider(t, "authorization_pending", "access_denied")
+		_, err := p.PollDeviceToken(ctx, device())
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrLoginFailed), "wanted \"%s\" but got \"%s\"", ErrLoginFailed, err)
+	})
+	t.Run("expired-token", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, _ := newProvider(t, "expired_token")
+		_, err := p.PollDeviceToken(ctx, device())
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrExpiredRequest), "wanted \"%s\" but got \"%s\"", ErrExpiredRequest, err)
+	})
+	t.Run("expires-at", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, count := newProvider(t)
+		d := device()
+		d.ExpiresAt = time.Now().Add(-time.Second)
+		_, err := p.PollDeviceToken(ctx, d)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrExpiredRequest), "wanted \"%s\" but got \"%s\"", ErrExpiredRequest, err)
+		assert.Equal(0, count())
+	})
+	t.Run("invalid-grant", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, _ := newProvider(t)
+		d := device()
+		d.DeviceCode = "unknown"
+		_, err := p.PollDeviceToken(ctx, d)
+		require.Error(err)
+		var oauthErr *OAuthError
+		require.True(errors.As(err, &oauthErr))
+		assert.Equal("invalid_grant", oauthErr.Code)
+	})
+	t.Run("canceled", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, count := newProvider(t)
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		d := device()
+		d.Interval = time.Hour
+		_, err := p.PollDeviceToken(ctx, d)
+		require.Error(err)
+		assert.Truef(errors.Is(err, context.Canceled), "wanted \"%s\" but got \"%s\"", context.Canceled, err)
+		assert.Equal(0, count())
+	})
+	t.Run("nil-device-authorization", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, _ := newProvider(t)
+		_, err := p.PollDeviceToken(ctx, nil)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+	t.Run("empty-device-code", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, _ := newProvider(t)
+		_, err := p.PollDeviceToken(ctx, &DeviceAuthorization{})
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
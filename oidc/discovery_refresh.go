@@ -0,0 +1,120 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WithDiscoveryTTL provides an optional amount of time the provider's
+// discovery document is cached, after which it's refreshed in the background,
+// so long-lived providers pick up IdPs moving their endpoints or jwks_uri.
+// A failed refresh is recorded (see Provider.DebugSnapshot and
+// WithMetricsSink) and the cached document continues to be used until the
+// next refresh.  The default of zero never refreshes the document.
+//
+// See Provider.RefreshMetadata to refresh the document on demand.
+//
+// Valid for: Provider
+func WithDiscoveryTTL(ttl time.Duration) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*providerOptions); ok {
+			o.withDiscoveryTTL = ttl
+		}
+	}
+}
+
+// RefreshMetadata fetches the provider's discovery document again, and
+// replaces the provider's cached document and its key set for the jwks_uri
+// (the JWKS is cached separately by the config's JWKSCache).  When the
+// refresh fails, the cached document continues to be used.  Concurrent
+// refreshes share a single request.
+//
+// The metadata of a child provider (see Provider.WithClient) is refreshed by
+// refreshing its parent's.
+func (p *Provider) RefreshMetadata(ctx context.Context) error {
+	const op = "Provider.RefreshMetadata"
+	if ctx == nil {
+		return fmt.Errorf("%s: context is nil: %w", op, ErrNilParameter)
+	}
+	if p.parent != nil {
+		if err := p.parent.RefreshMetadata(ctx); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		p.syncParentDiscovery()
+		return nil
+	}
+	// like a lazy discovery, the shared refresh isn't bound to any one
+	// caller's ctx, but each caller stops waiting when its ctx is done.
+	ch := p.discoveryGroup.DoChan("refresh", func() (interface{}, error) {
+		refreshCtx, cancel := p.operationContext(p.backgroundContext(ctx))
+		defer cancel()
+		return nil, p.discover(refreshCtx)
+	})
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", op, ctx.Err())
+	case r := <-ch:
+		if r.Err != nil {
+			return fmt.Errorf("%s: %w", op, r.Err)
+		}
+	}
+	return nil
+}
+
+// startDiscoveryRefresh refreshes the provider's discovery document in the
+// background every discoveryTTL, until the provider is done.
+func (p *Provider) startDiscoveryRefresh() {
+	p.runEvery(p.discoveryTTL, func(ctx context.Context) {
+		// failures are recorded by discover(...)
+		_ = p.RefreshMetadata(ctx)
+	})
+}
+
+// runEvery runs fn in the background every interval, until the provider is
+// done.  Nothing is run when the interval isn't positive.
+func (p *Provider) runEvery(interval time.Duration, fn func(ctx context.Context)) {
+	if interval <= 0 {
+		return
+	}
+	// the background activity is tracked while holding mu, so it's either
+	// tracked before the provider is done or not started at all.
+	p.mu.RLock()
+	ctx := p.backgroundCtx
+	if ctx == nil || ctx.Err() != nil {
+		p.mu.RUnlock()
+		return
+	}
+	p.background.Add(1)
+	p.mu.RUnlock()
+
+	go func() {
+		defer p.background.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(ctx)
+			}
+		}
+	}()
+}
+
+// syncParentDiscovery shares the parent's current discovery with the child
+// provider, when the parent has been discovered.
+func (p *Provider) syncParentDiscovery() {
+	p.parent.mu.RLock()
+	provider, jwksURL, discoveredAt, keySet := p.parent.provider, p.parent.jwksURL, p.parent.discoveredAt, p.parent.keySet
+	p.parent.mu.RUnlock()
+	if provider == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.provider != provider {
+		p.provider, p.jwksURL, p.discoveredAt, p.keySet = provider, jwksURL, discoveredAt, keySet
+	}
+}
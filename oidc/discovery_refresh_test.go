@@ -0,0 +1,108 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_RefreshMetadata(t *testing.T) {
+	ctx := context.Background()
+	redirect := "https://example.com/callback"
+	supportsUserInfo := func(t *testing.T, p *Provider) bool {
+		t.Helper()
+		ok, err := p.Supports(ctx, FeatureUserInfo)
+		require.NoError(t, err)
+		return ok
+	}
+
+	t.Run("refreshed", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := StartTestProvider(t)
+		p := testNewProvider(t, "client-id", "client-secret", redirect, tp)
+		require.True(supportsUserInfo(t, p))
+		p.mu.RLock()
+		discoveredAt := p.discoveredAt
+		p.mu.RUnlock()
+
+		tp.SetDisableUserInfo(true)
+		time.Sleep(time.Millisecond)
+		require.NoError(p.RefreshMetadata(ctx))
+		assert.False(supportsUserInfo(t, p))
+		p.mu.RLock()
+		assert.True(p.discoveredAt.After(discoveredAt))
+		p.mu.RUnlock()
+	})
+	t.Run("background", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := StartTestProvider(t)
+		tc := testNewConfig(t, "client-id", "client-secret", redirect, tp)
+		p, err := NewProvider(tc, WithDiscoveryTTL(10*time.Millisecond))
+		require.NoError(err)
+		defer p.Done()
+		require.True(supportsUserInfo(t, p))
+
+		tp.SetDisableUserInfo(true)
+		assert.Eventually(func() bool {
+			return !supportsUserInfo(t, p)
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+	t.Run("child", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := StartTestProvider(t)
+		parent := testNewProvider(t, "parent-client-id", "parent-secret", redirect, tp)
+		child, err := parent.WithClient("child-client-id", "child-secret")
+		require.NoError(err)
+		defer child.Done()
+
+		tp.SetDisableUserInfo(true)
+		require.NoError(parent.RefreshMetadata(ctx))
+		assert.False(supportsUserInfo(t, child))
+		assert.Same(parent.provider, child.provider)
+
+		tp.SetDisableUserInfo(false)
+		require.NoError(child.RefreshMetadata(ctx))
+		assert.True(supportsUserInfo(t, parent))
+		assert.Same(parent.provider, child.provider)
+	})
+	t.Run("failed", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := StartTestProvider(t)
+		tc := testNewConfig(t, "client-id", "client-secret", redirect, tp)
+		p, err := NewProvider(tc)
+		require.NoError(err)
+		p.mu.RLock()
+		provider := p.provider
+		p.mu.RUnlock()
+
+		p.Done()
+		assert.Error(p.RefreshMetadata(ctx))
+		p.mu.RLock()
+		assert.Same(provider, p.provider)
+		p.mu.RUnlock()
+	})
+	t.Run("ctx-done", func(t *testing.T) {
+		tp := StartTestProvider(t)
+		p := testNewProvider(t, "client-id", "client-secret", redirect, tp)
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		err := p.RefreshMetadata(cancelled)
+		assert.Truef(t, errors.Is(err, context.Canceled), "wanted \"%s\" but got \"%s\"", context.Canceled, err)
+	})
+	t.Run("nil-ctx", func(t *testing.T) {
+		tp := StartTestProvider(t)
+		p := testNewProvider(t, "client-id", "client-secret", redirect, tp)
+		err := p.RefreshMetadata(nil) // nolint:staticcheck
+		assert.Truef(t, errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+	t.Run("invalid-ttl", func(t *testing.T) {
+		tp := StartTestProvider(t)
+		tc := testNewConfig(t, "client-id", "client-secret", redirect, tp)
+		_, err := NewProvider(tc, WithDiscoveryTTL(-time.Second))
+		assert.Truef(t, errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
@@ -89,10 +89,28 @@ func ExampleNewConfig() {
 	if err != nil {
 		// handle error
 	}
-	fmt.Println(pc)
+	fmt.Println(pc.Issuer, pc.ClientID, pc.ClientSecret, pc.SupportedSigningAlgs, pc.AllowedRedirectURLs)
+
+	// Create a new Config which decrypts encrypted id_tokens.  The decryption
+	// keys are redacted when they're printed.
+	pc, err = oidc.NewConfig(
+		"http://your_issuer/",
+		"your_client_id",
+		"your_client_secret",
+		[]oidc.Alg{oidc.RS256},
+		[]string{"http://your_redirect_url/callback"},
+		oidc.WithIDTokenDecryptionKeys(oidc.DecryptionKey{KeyID: "your_key_id", Key: []byte("your-32-byte-symmetric-key-value")}),
+	)
+	if err != nil {
+		// handle error
+	}
+	fmt.Println(pc.IDTokenDecryptionKeys)
+	fmt.Printf("%#v\n", pc.IDTokenDecryptionKeys)
 
 	// Output:
-	// &{your_client_id [REDACTED: client secret] [openid] http://your_issuer/ [RS256] [http://your_redirect_url/callback] []  <nil>}
+	// http://your_issuer/ your_client_id [REDACTED: client secret] [RS256] [http://your_redirect_url/callback]
+	// [{your_key_id [REDACTED: decryption key]}]
+	// []oidc.DecryptionKey{oidc.DecryptionKey{KeyID:"your_key_id", Key:"[REDACTED: decryption key]"}}
 }
 
 func ExampleNewProvider() {
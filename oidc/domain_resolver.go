@@ -0,0 +1,275 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebFingerIssuerRel is the WebFinger link relation of an OIDC issuer.
+// See: https://openid.net/specs/openid-connect-discovery-1_0.html#IssuerDiscovery
+const WebFingerIssuerRel = "http://openid.net/specs/connect/1.0/issuer"
+
+// DefaultDomainResolverCacheTTL is the default amount of time a
+// DomainResolver caches the issuer discovered for a domain via WebFinger.
+const DefaultDomainResolverCacheTTL = time.Hour
+
+// maxWebFingerResponseSize is the maximum size of a WebFinger response.
+const maxWebFingerResponseSize = 1 << 20
+
+// DomainResolver routes login identifiers (like an email address) to the
+// Provider of the user's organization, which supports "enter your email to
+// sign in" flows for multi-tenant apps.  The identifier's domain is mapped to
+// an issuer using the resolver's domains (see AddDomain) and, optionally, by
+// WebFinger issuer discovery at the domain (see WithWebFinger).  The issuer's
+// Provider must be in the resolver's ProviderRegistry, so an identifier can
+// never route a user to an IdP that the app hasn't registered.
+//
+// A DomainResolver is safe for concurrent use.
+type DomainResolver struct {
+	registry  *ProviderRegistry
+	webFinger *http.Client
+	cacheTTL  time.Duration
+	nowFunc   func() time.Time
+
+	mu      sync.RWMutex
+	domains map[string]string
+	cache   map[string]domainCacheEntry
+}
+
+// domainCacheEntry is an issuer discovered via WebFinger (which is empty if
+// the discovery failed) along with when it expires.
+type domainCacheEntry struct {
+	issuer string
+	expiry time.Time
+}
+
+// NewDomainResolver creates a new DomainResolver which resolves Providers
+// from the registry.
+//
+// Supported options: WithWebFinger, WithDomainResolverCacheTTL, WithNow
+func NewDomainResolver(registry *ProviderRegistry, opt ...Option) (*DomainResolver, error) {
+	const op = "NewDomainResolver"
+	if registry == nil {
+		return nil, fmt.Errorf("%s: provider registry is nil: %w", op, ErrNilParameter)
+	}
+	opts := getDomainResolverOpts(opt...)
+	if opts.withCacheTTL < 0 {
+		return nil, fmt.Errorf("%s: cache ttl must not be negative: %w", op, ErrInvalidParameter)
+	}
+	return &DomainResolver{
+		registry:  registry,
+		webFinger: opts.withWebFingerClient,
+		cacheTTL:  opts.withCacheTTL,
+		nowFunc:   opts.withNowFunc,
+		domains:   map[string]string{},
+		cache:     map[string]domainCacheEntry{},
+	}, nil
+}
+
+// AddDomain maps the domain (like example.com) to the issuer, whose Provider
+// must be registered when identifiers for the domain are resolved.  Domains
+// are case-insensitive.
+func (r *DomainResolver) AddDomain(domain, issuer string) error {
+	const op = "DomainResolver.AddDomain"
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	switch {
+	case domain == "":
+		return fmt.Errorf("%s: domain is empty: %w", op, ErrInvalidParameter)
+	case issuer == "":
+		return fmt.Errorf("%s: issuer is empty: %w", op, ErrInvalidParameter)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.domains[domain] = issuer
+	return nil
+}
+
+// RemoveDomain removes the domain's mapping and any issuer cached for it.
+func (r *DomainResolver) RemoveDomain(domain string) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.domains, domain)
+	delete(r.cache, domain)
+}
+
+// Resolve returns the Provider for the login identifier, which is an email
+// address (or an acct: URI).  If the identifier's domain can't be mapped to a
+// registered Provider, then an error wrapping ErrNotFound is returned.
+func (r *DomainResolver) Resolve(ctx context.Context, identifier string) (*Provider, error) {
+	const op = "DomainResolver.Resolve"
+	account, domain, err := parseLoginIdentifier(identifier)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	issuer, err := r.issuer(ctx, account, domain)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	p, err := r.registry.Provider(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return p, nil
+}
+
+// issuer returns the issuer for the domain from its mapping, the cache or
+// via WebFinger.
+func (r *DomainResolver) issuer(ctx context.Context, account, domain string) (string, error) {
+	const op = "DomainResolver.issuer"
+	now := r.now()
+	r.mu.RLock()
+	issuer, ok := r.domains[domain]
+	cached, isCached := r.cache[domain]
+	r.mu.RUnlock()
+	switch {
+	case ok:
+		return issuer, nil
+	case r.webFinger == nil:
+		return "", fmt.Errorf("%s: domain %s: %w", op, domain, ErrNotFound)
+	case isCached && now.Before(cached.expiry):
+		if cached.issuer == "" {
+			return "", fmt.Errorf("%s: domain %s (cached): %w", op, domain, ErrNotFound)
+		}
+		return cached.issuer, nil
+	}
+
+	issuer, err := r.webFingerIssuer(ctx, account, domain)
+	if r.cacheTTL > 0 {
+		r.mu.Lock()
+		r.cache[domain] = domainCacheEntry{issuer: issuer, expiry: now.Add(r.cacheTTL)}
+		r.mu.Unlock()
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return issuer, nil
+}
+
+// webFingerIssuer discovers the account's issuer using WebFinger at the
+// domain.  See: https://tools.ietf.org/html/rfc7033
+func (r *DomainResolver) webFingerIssuer(ctx context.Context, account, domain string) (string, error) {
+	const op = "DomainResolver.webFingerIssuer"
+	u := url.URL{
+		Scheme: "https",
+		Host:   domain,
+		Path:   "/.well-known/webfinger",
+		RawQuery: url.Values{
+			"resource": {"acct:" + account},
+			"rel":      {WebFingerIssuerRel},
+		}.Encode(),
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to create request: %s: %w", op, err, ErrNotFound)
+	}
+	req.Header.Set("Accept", "application/jrd+json")
+	resp, err := r.webFinger.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("%s: %s: %w", op, err, ErrNotFound)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s returned %s: %w", op, domain, resp.Status, ErrNotFound)
+	}
+	var jrd struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxWebFingerResponseSize)).Decode(&jrd); err != nil {
+		return "", fmt.Errorf("%s: unable to decode response: %s: %w", op, err, ErrNotFound)
+	}
+	for _, l := range jrd.Links {
+		if l.Rel == WebFingerIssuerRel && l.Href != "" {
+			return l.Href, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %s didn't return an issuer: %w", op, domain, ErrNotFound)
+}
+
+// now returns the current time using the resolver's optional now func
+func (r *DomainResolver) now() time.Time {
+	if r.nowFunc != nil {
+		return r.nowFunc()
+	}
+	return time.Now()
+}
+
+// parseLoginIdentifier returns the account (user@domain) and lowercase domain
+// of an email address or acct: URI.
+func parseLoginIdentifier(identifier string) (string, string, error) {
+	const op = "parseLoginIdentifier"
+	account := strings.TrimPrefix(strings.TrimSpace(identifier), "acct:")
+	i := strings.LastIndex(account, "@")
+	if i <= 0 || i == len(account)-1 {
+		return "", "", fmt.Errorf("%s: identifier %q doesn't have a domain: %w", op, identifier, ErrInvalidParameter)
+	}
+	domain := strings.ToLower(account[i+1:])
+	if strings.ContainsAny(domain, "/?#@ ") {
+		return "", "", fmt.Errorf("%s: identifier %q has an invalid domain: %w", op, identifier, ErrInvalidParameter)
+	}
+	return account, domain, nil
+}
+
+// domainResolverOptions is the set of available options for the
+// DomainResolver
+type domainResolverOptions struct {
+	withWebFingerClient *http.Client
+	withCacheTTL        time.Duration
+	withNowFunc         func() time.Time
+}
+
+// domainResolverDefaults is a handy way to get the defaults at runtime and
+// during unit tests.
+func domainResolverDefaults() domainResolverOptions {
+	return domainResolverOptions{
+		withCacheTTL: DefaultDomainResolverCacheTTL,
+	}
+}
+
+// getDomainResolverOpts gets the DomainResolver defaults and applies the opt
+// overrides passed in
+func getDomainResolverOpts(opt ...Option) domainResolverOptions {
+	opts := domainResolverDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithWebFinger enables WebFinger issuer discovery for domains that haven't
+// been added to the resolver, using the http client (or http.DefaultClient
+// when the client is nil).  The discovered issuer must still be registered.
+//
+// Valid for: DomainResolver
+func WithWebFinger(client *http.Client) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*domainResolverOptions); ok {
+			if client == nil {
+				client = http.DefaultClient
+			}
+			o.withWebFingerClient = client
+		}
+	}
+}
+
+// WithDomainResolverCacheTTL provides an optional amount of time that the
+// result of a domain's WebFinger discovery (including a failed discovery) is
+// cached.  The default is DefaultDomainResolverCacheTTL, and zero disables
+// caching.
+//
+// Valid for: DomainResolver
+func WithDomainResolverCacheTTL(ttl time.Duration) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*domainResolverOptions); ok {
+			o.withCacheTTL = ttl
+		}
+	}
+}
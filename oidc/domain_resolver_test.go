@@ -0,0 +1,165 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainResolver_Resolve(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp1, tp2 := StartTestProvider(t), StartTestProvider(t)
+	p1 := testNewProvider(t, "test-client-id", "test-client-secret", "https://app.example.com/callback", tp1)
+	p2 := testNewProvider(t, "test-client-id", "test-client-secret", "https://app.example.com/callback", tp2)
+	registry := NewProviderRegistry()
+	require.NoError(t, registry.Register(p1))
+	require.NoError(t, registry.Register(p2))
+
+	var webFingerCalls int32
+	var webFingerIssuer atomic.Value
+	webFingerIssuer.Store(tp2.Addr())
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&webFingerCalls, 1)
+		if req.URL.Path != "/.well-known/webfinger" || req.URL.Query().Get("rel") != WebFingerIssuerRel {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		issuer := webFingerIssuer.Load().(string)
+		if issuer == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/jrd+json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"subject": req.URL.Query().Get("resource"),
+			"links": []map[string]string{
+				{"rel": "http://webfinger.net/rel/profile-page", "href": "https://example.com/alice"},
+				{"rel": WebFingerIssuerRel, "href": issuer},
+			},
+		})
+	}))
+	defer srv.Close()
+	srvURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	webFingerDomain := srvURL.Host
+
+	now := time.Now()
+	r, err := NewDomainResolver(registry, WithWebFinger(srv.Client()), WithDomainResolverCacheTTL(time.Minute), WithNow(func() time.Time { return now }))
+	require.NoError(t, err)
+	require.NoError(t, r.AddDomain("Example.COM", tp1.Addr()))
+	require.NoError(t, r.AddDomain("unregistered.com", "https://unregistered.com"))
+
+	t.Run("static", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		for _, id := range []string{"alice@example.com", "Bob@EXAMPLE.com", "acct:carol@example.com"} {
+			got, err := r.Resolve(ctx, id)
+			require.NoError(err)
+			assert.Equal(p1, got)
+		}
+	})
+	t.Run("unregistered-issuer", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := r.Resolve(ctx, "alice@unregistered.com")
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrNotFound), "wanted \"%s\" but got \"%s\"", ErrNotFound, err)
+	})
+	t.Run("invalid-identifier", func(t *testing.T) {
+		assert := assert.New(t)
+		for _, id := range []string{"", "alice", "alice@", "@example.com", "alice@example.com/path"} {
+			_, err := r.Resolve(ctx, id)
+			assert.Truef(errors.Is(err, ErrInvalidParameter), "%q: wanted \"%s\" but got \"%s\"", id, ErrInvalidParameter, err)
+		}
+	})
+	t.Run("webfinger", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		atomic.StoreInt32(&webFingerCalls, 0)
+		got, err := r.Resolve(ctx, "alice@"+webFingerDomain)
+		require.NoError(err)
+		assert.Equal(p2, got)
+
+		// the discovered issuer is cached until the ttl expires
+		webFingerIssuer.Store(tp1.Addr())
+		got, err = r.Resolve(ctx, "bob@"+webFingerDomain)
+		require.NoError(err)
+		assert.Equal(p2, got)
+		assert.Equal(int32(1), atomic.LoadInt32(&webFingerCalls))
+
+		now = now.Add(2 * time.Minute)
+		got, err = r.Resolve(ctx, "bob@"+webFingerDomain)
+		require.NoError(err)
+		assert.Equal(p1, got)
+		assert.Equal(int32(2), atomic.LoadInt32(&webFingerCalls))
+
+		// a failed discovery is cached too
+		webFingerIssuer.Store("")
+		now = now.Add(2 * time.Minute)
+		_, err = r.Resolve(ctx, "bob@"+webFingerDomain)
+		assert.Truef(errors.Is(err, ErrNotFound), "wanted \"%s\" but got \"%s\"", ErrNotFound, err)
+		_, err = r.Resolve(ctx, "bob@"+webFingerDomain)
+		assert.Truef(errors.Is(err, ErrNotFound), "wanted \"%s\" but got \"%s\"", ErrNotFound, err)
+		assert.Equal(int32(3), atomic.LoadInt32(&webFingerCalls))
+
+		// a static mapping takes precedence over webfinger
+		require.NoError(r.AddDomain(webFingerDomain, tp2.Addr()))
+		got, err = r.Resolve(ctx, "bob@"+webFingerDomain)
+		require.NoError(err)
+		assert.Equal(p2, got)
+		r.RemoveDomain(webFingerDomain)
+		assert.Equal(int32(3), atomic.LoadInt32(&webFingerCalls))
+	})
+	t.Run("webfinger-disabled", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		r, err := NewDomainResolver(registry)
+		require.NoError(err)
+		atomic.StoreInt32(&webFingerCalls, 0)
+		_, err = r.Resolve(ctx, "alice@"+webFingerDomain)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrNotFound), "wanted \"%s\" but got \"%s\"", ErrNotFound, err)
+		assert.Equal(int32(0), atomic.LoadInt32(&webFingerCalls))
+	})
+}
+
+func TestNewDomainResolver(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	r, err := NewDomainResolver(nil)
+	assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	assert.Nil(r)
+	r, err = NewDomainResolver(NewProviderRegistry(), WithDomainResolverCacheTTL(-1))
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	assert.Nil(r)
+
+	r, err = NewDomainResolver(NewProviderRegistry())
+	assert.NoError(err)
+	err = r.AddDomain("", "https://example.com")
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	err = r.AddDomain("example.com", "")
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+}
+
+func Test_DomainResolverOptions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	opts := getDomainResolverOpts()
+	assert.Equal(domainResolverDefaults(), opts)
+
+	client := &http.Client{}
+	opts = getDomainResolverOpts(WithWebFinger(client), WithDomainResolverCacheTTL(time.Second))
+	testOpts := domainResolverDefaults()
+	testOpts.withWebFingerClient = client
+	testOpts.withCacheTTL = time.Second
+	assert.Equal(testOpts, opts)
+
+	opts = getDomainResolverOpts(WithWebFinger(nil))
+	assert.Equal(http.DefaultClient, opts.withWebFingerClient)
+}
@@ -0,0 +1,345 @@
+package oidc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	// DPoPTokenType is the token_type of a DPoP-bound access token, and the
+	// authorization scheme used to present one.
+	DPoPTokenType = "DPoP"
+
+	// DPoPNonceHeader is the response header which contains a server provided
+	// nonce for the client's DPoP proofs.
+	DPoPNonceHeader = "DPoP-Nonce"
+
+	// dpopNonceError is the error code of a response which requires the
+	// client to retry its request with a DPoP proof containing a nonce.
+	dpopNonceError = "use_dpop_nonce"
+)
+
+// DPoPKey is a client's DPoP key, which signs the DPoP proofs sent with its
+// token endpoint and userinfo requests, so the provider can bind the access
+// tokens it issues to the key (sender-constrained tokens).  The key must be
+// used for every request made with the tokens, so it should live as long as
+// the tokens it's bound to.  A DPoPKey also holds the most recent nonce
+// provided by each server for its proofs.
+//
+// A DPoPKey is safe for concurrent use if its crypto.Signer is.
+//
+// See: https://tools.ietf.org/html/rfc9449
+type DPoPKey struct {
+	signer     crypto.Signer
+	alg        Alg
+	thumbprint string
+
+	mu     sync.Mutex
+	nonces map[string]string
+}
+
+// NewDPoPKey creates a new DPoPKey for the signer, which signs proofs using
+// the alg.  Any crypto.Signer whose public key is an RSA, ECDSA or Ed25519
+// key can be used, which allows the key to live in an HSM or a cloud KMS.
+func NewDPoPKey(signer crypto.Signer, alg Alg) (*DPoPKey, error) {
+	const op = "NewDPoPKey"
+	if signer == nil {
+		return nil, fmt.Errorf("%s: signer is nil: %w", op, ErrNilParameter)
+	}
+	if err := validSignerAlg(signer.Public(), alg); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	thumbprint, err := (&jose.JSONWebKey{Key: signer.Public()}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to compute the key's thumbprint: %w", op, err)
+	}
+	return &DPoPKey{
+		signer:     signer,
+		alg:        alg,
+		thumbprint: base64.RawURLEncoding.EncodeToString(thumbprint),
+		nonces:     map[string]string{},
+	}, nil
+}
+
+// GenerateDPoPKey generates a new in-memory ES256 DPoPKey.
+func GenerateDPoPKey() (*DPoPKey, error) {
+	const op = "GenerateDPoPKey"
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to generate key: %w", op, err)
+	}
+	k, err := NewDPoPKey(priv, ES256)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return k, nil
+}
+
+// Alg returns the key's signing algorithm.
+func (k *DPoPKey) Alg() Alg { return k.alg }
+
+// Public returns the key's public key.
+func (k *DPoPKey) Public() crypto.PublicKey { return k.signer.Public() }
+
+// Thumbprint returns the base64url (no padding) encoded SHA-256 thumbprint of
+// the key's public key, which is the jkt of the access tokens bound to it.
+func (k *DPoPKey) Thumbprint() string { return k.thumbprint }
+
+// Proof returns a new DPoP proof for a request with the method to the target
+// URL (whose query and fragment are ignored).  The access token is optional,
+// and its hash (ath) is included when the request presents it.  The proof
+// includes the most recent nonce provided by the target URL's server (see
+// SetNonce).  A new proof (with a unique jti) is required for every request.
+//
+// See: https://tools.ietf.org/html/rfc9449#section-4.2
+func (k *DPoPKey) Proof(method, targetURL string, t AccessToken, now time.Time) (string, error) {
+	const op = "DPoPKey.Proof"
+	switch {
+	case method == "":
+		return "", fmt.Errorf("%s: method is empty: %w", op, ErrInvalidParameter)
+	case targetURL == "":
+		return "", fmt.Errorf("%s: target URL is empty: %w", op, ErrInvalidParameter)
+	}
+	htu, err := dpopTargetURL(targetURL)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	jti, err := NewID()
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to generate jti: %w", op, err)
+	}
+	claims := struct {
+		ID       string           `json:"jti"`
+		Method   string           `json:"htm"`
+		URL      string           `json:"htu"`
+		IssuedAt *jwt.NumericDate `json:"iat"`
+		Hash     string           `json:"ath,omitempty"`
+		Nonce    string           `json:"nonce,omitempty"`
+	}{
+		ID:       jti,
+		Method:   method,
+		URL:      htu,
+		IssuedAt: jwt.NewNumericDate(now),
+		Nonce:    k.nonce(htu),
+	}
+	if t != "" {
+		sum := sha256.Sum256([]byte(t))
+		claims.Hash = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	opts := (&jose.SignerOptions{EmbedJWK: true}).WithType(DPoPProofType)
+	sig, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.SignatureAlgorithm(k.alg), Key: &opaqueSigner{signer: k.signer, alg: k.alg}},
+		opts,
+	)
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to create signer: %w", op, err)
+	}
+	proof, err := jwt.Signed(sig).Claims(claims).CompactSerialize()
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to sign proof: %w", op, err)
+	}
+	return proof, nil
+}
+
+// SetNonce sets the nonce for the proofs of requests to the target URL's
+// server, which is provided by the server's DPoPNonceHeader.  The nonces of
+// the provider's responses are set automatically.
+//
+// See: https://tools.ietf.org/html/rfc9449#section-8
+func (k *DPoPKey) SetNonce(targetURL, nonce string) {
+	origin, err := dpopOrigin(targetURL)
+	if err != nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.nonces[origin] = nonce
+}
+
+// nonce returns the nonce for the target URL's server.
+func (k *DPoPKey) nonce(targetURL string) string {
+	origin, err := dpopOrigin(targetURL)
+	if err != nil {
+		return ""
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.nonces[origin]
+}
+
+// dpopTargetURL returns the target URL without its query and fragment.
+func dpopTargetURL(targetURL string) (string, error) {
+	const op = "dpopTargetURL"
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return "", fmt.Errorf("%s: invalid target URL: %s: %w", op, err, ErrInvalidParameter)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%s: target URL %q is not absolute: %w", op, targetURL, ErrInvalidParameter)
+	}
+	u.RawQuery, u.Fragment, u.RawFragment = "", "", ""
+	return u.String(), nil
+}
+
+// dpopOrigin returns the target URL's origin (scheme and host), since a
+// server's nonce is used for all of its endpoints.
+func dpopOrigin(targetURL string) (string, error) {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// verifyDPoPTokenBinding verifies that the provider's token response issued
+// a DPoP-bound access token: its token_type must be DPoPTokenType and, when
+// the access token is a JWT with a cnf claim, its jkt must be the key's
+// thumbprint.  The binding of an opaque access token can only be verified by
+// its resource servers.  An error wrapping ErrInvalidTokenBinding is
+// returned when the token isn't bound to the key.
+func verifyDPoPTokenBinding(k *DPoPKey, t *oauth2.Token) error {
+	const op = "verifyDPoPTokenBinding"
+	if t == nil || t.AccessToken == "" {
+		return nil
+	}
+	if !strings.EqualFold(t.TokenType, DPoPTokenType) {
+		return fmt.Errorf("%s: token_type %q is not %s: %w", op, t.TokenType, DPoPTokenType, ErrInvalidTokenBinding)
+	}
+	if strings.Count(t.AccessToken, ".") != 2 {
+		return nil
+	}
+	var claims struct {
+		Cnf *Confirmation `json:"cnf"`
+	}
+	if err := UnmarshalClaims(t.AccessToken, &claims); err != nil || claims.Cnf == nil {
+		return nil
+	}
+	if !constantTimeEqual(claims.Cnf.JKT, k.Thumbprint()) {
+		return fmt.Errorf("%s: access_token jkt doesn't match the DPoP key: %w", op, ErrInvalidTokenBinding)
+	}
+	return nil
+}
+
+// dpopTransport is an http.RoundTripper which sends a DPoP proof signed by
+// the key with every request.  A request which presents a DPoP-bound access
+// token (using the DPoP authorization scheme) includes the token's hash in its
+// proof.  The nonces of the responses are saved in the key, and a request
+// which is rejected because its proof requires a nonce is retried once.
+type dpopTransport struct {
+	base    http.RoundTripper
+	key     *DPoPKey
+	nowFunc func() time.Time
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *dpopTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	const op = "dpopTransport.RoundTrip"
+	resp, err := t.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+	retry, err := requiresDPoPNonce(resp)
+	if err != nil || !retry {
+		return resp, err
+	}
+	_, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	r := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if r.Body, err = req.GetBody(); err != nil {
+			return nil, fmt.Errorf("%s: unable to get request body: %w", op, err)
+		}
+	}
+	return t.roundTrip(r)
+}
+
+// roundTrip sends the request with a new proof, and saves the response's
+// nonce.
+func (t *dpopTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	const op = "dpopTransport.roundTrip"
+	now := time.Now()
+	if t.nowFunc != nil {
+		now = t.nowFunc()
+	}
+	var at AccessToken
+	if parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], DPoPTokenType) {
+		at = AccessToken(parts[1])
+	}
+	targetURL := req.URL.String()
+	proof, err := t.key.Proof(req.Method, targetURL, at, now)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// the request must not be modified, so a clone is sent instead.
+	r := req.Clone(req.Context())
+	r.Header.Set(DPoPHeader, proof)
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if nonce := resp.Header.Get(DPoPNonceHeader); nonce != "" {
+		t.key.SetNonce(targetURL, nonce)
+	}
+	return resp, nil
+}
+
+// requiresDPoPNonce returns true when the response rejected the request
+// because its proof didn't have the server's nonce: a token endpoint's 400
+// response with a use_dpop_nonce error, or a resource server's 401 response
+// with a use_dpop_nonce WWW-Authenticate error.  A 400 response's body is
+// read and replaced, so it can still be read by the caller.
+func requiresDPoPNonce(resp *http.Response) (bool, error) {
+	if resp.Header.Get(DPoPNonceHeader) == "" {
+		return false, nil
+	}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return strings.Contains(resp.Header.Get("WWW-Authenticate"), dpopNonceError), nil
+	case http.StatusBadRequest:
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return false, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(body, &e)
+		return e.Error == dpopNonceError, nil
+	default:
+		return false, nil
+	}
+}
+
+// WithDPoPKey provides an optional DPoP key for sender-constrained access
+// tokens (see Config.DPoPKey).
+//
+// Valid for: Config
+func WithDPoPKey(k *DPoPKey) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withDPoPKey = k
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestNewDPoPKey(t *testing.T) {
+	t.Parallel()
+	_, priv := TestGenerateKeys(t)
+	tests := []struct {
+		name    string
+		signer  crypto.Signer
+		alg     Alg
+		wantErr error
+	}{
+		{name: "valid", signer: priv.(*ecdsa.PrivateKey), alg: ES256},
+		{name: "nil-signer", alg: ES256, wantErr: ErrNilParameter},
+		{name: "hmac", signer: priv.(*ecdsa.PrivateKey), alg: HS256, wantErr: ErrUnsupportedAlg},
+		{name: "wrong-key-type", signer: priv.(*ecdsa.PrivateKey), alg: RS256, wantErr: ErrUnsupportedAlg},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			k, err := NewDPoPKey(tt.signer, tt.alg)
+			if tt.wantErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantErr), "wanted \"%s\" but got \"%s\"", tt.wantErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.alg, k.Alg())
+			assert.Equal(tt.signer.Public(), k.Public())
+			assert.NotEmpty(k.Thumbprint())
+		})
+	}
+}
+
+func TestDPoPKey_Proof(t *testing.T) {
+	t.Parallel()
+	k, err := GenerateDPoPKey()
+	require.NoError(t, err)
+	now := time.Now()
+	tests := []struct {
+		name        string
+		method      string
+		targetURL   string
+		accessToken AccessToken
+		nonce       string
+		wantErr     error
+	}{
+		{name: "token-endpoint", method: http.MethodPost, targetURL: "https://op.example.com/token?a=b#c"},
+		{name: "resource", method: http.MethodGet, targetURL: "https://rs.example.com/userinfo", accessToken: "access-token"},
+		{name: "nonce", method: http.MethodPost, targetURL: "https://nonce.example.com/token", nonce: "server-nonce"},
+		{name: "empty-method", targetURL: "https://op.example.com/token", wantErr: ErrInvalidParameter},
+		{name: "empty-url", method: http.MethodPost, wantErr: ErrInvalidParameter},
+		{name: "relative-url", method: http.MethodPost, targetURL: "/token", wantErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			if tt.nonce != "" {
+				k.SetNonce(tt.targetURL, tt.nonce)
+			}
+			proof, err := k.Proof(tt.method, tt.targetURL, tt.accessToken, now)
+			if tt.wantErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantErr), "wanted \"%s\" but got \"%s\"", tt.wantErr, err)
+				return
+			}
+			require.NoError(err)
+			req := httptest.NewRequest(tt.method, tt.targetURL, nil)
+			req.Header.Set(DPoPHeader, proof)
+			verified, err := VerifyDPoPProof(req, tt.accessToken, WithDPoPTargetURL(tt.targetURL), WithNow(func() time.Time { return now }))
+			require.NoError(err)
+			assert.Equal(k.Thumbprint(), verified.Thumbprint)
+			assert.NoError((&Confirmation{JKT: k.Thumbprint()}).VerifyDPoPProof(verified))
+			if tt.nonce != "" {
+				assert.Equal(tt.nonce, verified.Claims["nonce"])
+			} else {
+				assert.NotContains(verified.Claims, "nonce")
+			}
+		})
+	}
+}
+
+func Test_dpopTransport(t *testing.T) {
+	t.Parallel()
+	k, err := GenerateDPoPKey()
+	require.NoError(t, err)
+	const serverNonce = "server-nonce"
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var at AccessToken
+		if strings.HasPrefix(req.Header.Get("Authorization"), "DPoP ") {
+			at = AccessToken(strings.TrimPrefix(req.Header.Get("Authorization"), "DPoP "))
+		}
+		p, err := VerifyDPoPProof(req, at)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if p.Claims["nonce"] != serverNonce {
+			w.Header().Set(DPoPNonceHeader, serverNonce)
+			if req.URL.Path == "/userinfo" {
+				w.Header().Set("WWW-Authenticate", `DPoP error="use_dpop_nonce"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"use_dpop_nonce"}`))
+			return
+		}
+		if req.URL.Path == "/token" {
+			require.NoError(t, req.ParseForm())
+			assert.Equal(t, "authorization_code", req.PostForm.Get("grant_type"))
+		}
+		_, _ = w.Write([]byte(p.Thumbprint))
+	}))
+	t.Cleanup(srv.Close)
+	client := &http.Client{Transport: &dpopTransport{base: http.DefaultTransport, key: k}}
+
+	t.Run("token-endpoint-nonce", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		atomic.StoreInt32(&requests, 0)
+		resp, err := client.PostForm(srv.URL+"/token", map[string][]string{"grant_type": {"authorization_code"}})
+		require.NoError(err)
+		defer resp.Body.Close()
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		assert.Equal(int32(2), atomic.LoadInt32(&requests))
+	})
+	t.Run("userinfo-saved-nonce", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		atomic.StoreInt32(&requests, 0)
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/userinfo", nil)
+		require.NoError(err)
+		req.Header.Set("Authorization", "DPoP access-token")
+		resp, err := client.Do(req)
+		require.NoError(err)
+		defer resp.Body.Close()
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		// the nonce was saved by the previous request to the server
+		assert.Equal(int32(1), atomic.LoadInt32(&requests))
+	})
+	t.Run("userinfo-nonce", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		atomic.StoreInt32(&requests, 0)
+		k.SetNonce(srv.URL, "stale-nonce")
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/userinfo", nil)
+		require.NoError(err)
+		req.Header.Set("Authorization", "DPoP access-token")
+		resp, err := client.Do(req)
+		require.NoError(err)
+		defer resp.Body.Close()
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		assert.Equal(int32(2), atomic.LoadInt32(&requests))
+	})
+}
+
+func Test_verifyDPoPTokenBinding(t *testing.T) {
+	t.Parallel()
+	k, err := GenerateDPoPKey()
+	require.NoError(t, err)
+	_, priv := TestGenerateKeys(t)
+	jwtWithJKT := func(jkt string) string {
+		return TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice", "cnf": map[string]interface{}{"jkt": jkt}}, nil)
+	}
+	tests := []struct {
+		name    string
+		token   *oauth2.Token
+		wantErr bool
+	}{
+		{name: "opaque", token: &oauth2.Token{AccessToken: "opaque", TokenType: "DPoP"}},
+		{name: "case-insensitive-type", token: &oauth2.Token{AccessToken: "opaque", TokenType: "dpop"}},
+		{name: "no-access-token", token: &oauth2.Token{TokenType: "Bearer"}},
+		{name: "bearer", token: &oauth2.Token{AccessToken: "opaque", TokenType: "Bearer"}, wantErr: true},
+		{name: "jwt-bound", token: &oauth2.Token{AccessToken: jwtWithJKT(k.Thumbprint()), TokenType: "DPoP"}},
+		{name: "jwt-bound-to-other-key", token: &oauth2.Token{AccessToken: jwtWithJKT("other"), TokenType: "DPoP"}, wantErr: true},
+		{name: "jwt-without-cnf", token: &oauth2.Token{AccessToken: TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil), TokenType: "DPoP"}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyDPoPTokenBinding(k, tt.token)
+			if tt.wantErr {
+				assert.Truef(t, errors.Is(err, ErrInvalidTokenBinding), "wanted \"%s\" but got \"%s\"", ErrInvalidTokenBinding, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/text/language"
+)
+
+// RequestFormatVersion is the current version of a Req's persisted format
+// (see Req.MarshalBinary).
+const RequestFormatVersion = 1
+
+// TokenFormatVersion is the current version of a Tk's persisted format (see
+// Tk.MarshalBinary).
+const TokenFormatVersion = 1
+
+// formatMigration migrates a persisted format from one version to the next.
+type formatMigration func(data map[string]json.RawMessage) error
+
+// requestMigrations and tokenMigrations are keyed by the version they
+// migrate from, so a future release which changes a format adds a migration
+// from the prior version and increments the format's version.
+var (
+	requestMigrations = map[int]formatMigration{}
+	tokenMigrations   = map[int]formatMigration{}
+)
+
+// migrateFormat returns the persisted data after it's been migrated from its
+// version to the current version.  Data without a version,
+// or with a version that's newer than the current version, returns an error
+// wrapping ErrUnsupportedFormatVersion.
+func migrateFormat(data []byte, current int, migrations map[int]formatMigration) ([]byte, error) {
+	const op = "migrateFormat"
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%s: unable to unmarshal: %w", op, err)
+	}
+	var version int
+	if raw, ok := fields["version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, fmt.Errorf("%s: unable to unmarshal version: %w", op, err)
+		}
+	}
+	switch {
+	case version < 1:
+		return nil, fmt.Errorf("%s: version is missing: %w", op, ErrUnsupportedFormatVersion)
+	case version > current:
+		return nil, fmt.Errorf("%s: version %d is newer than %d: %w", op, version, current, ErrUnsupportedFormatVersion)
+	case version == current:
+		return data, nil
+	}
+	for ; version < current; version++ {
+		migrate, ok := migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("%s: unable to migrate version %d: %w", op, version, ErrUnsupportedFormatVersion)
+		}
+		if err := migrate(fields); err != nil {
+			return nil, fmt.Errorf("%s: unable to migrate version %d: %w", op, version, err)
+		}
+	}
+	fields["version"] = json.RawMessage(fmt.Sprint(current))
+	migrated, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to marshal migrated data: %w", op, err)
+	}
+	return migrated, nil
+}
+
+// storedRequest is the persisted format of a Req.
+type storedRequest struct {
+	Version        int           `json:"version"`
+	State          string        `json:"state"`
+	Nonce          string        `json:"nonce"`
+	Expiration     time.Time     `json:"expiration"`
+	RedirectURL    string        `json:"redirect_url"`
+	Scopes         []string      `json:"scopes,omitempty"`
+	Audiences      []string      `json:"audiences,omitempty"`
+	Implicit       bool          `json:"implicit,omitempty"`
+	ImplicitAccess bool          `json:"implicit_access_token,omitempty"`
+	PKCEVerifier   string        `json:"pkce_verifier,omitempty"`
+	PKCEMethod     string        `json:"pkce_method,omitempty"`
+	MaxAge         *storedMaxAge `json:"max_age,omitempty"`
+	Prompts        []Prompt      `json:"prompts,omitempty"`
+	Display        Display       `json:"display,omitempty"`
+	UILocales      []string      `json:"ui_locales,omitempty"`
+	ClaimsLocales  []string      `json:"claims_locales,omitempty"`
+	Claims         []byte        `json:"claims,omitempty"`
+	ACRValues      []string      `json:"acr_values,omitempty"`
+	ResponseMode   ResponseMode  `json:"response_mode,omitempty"`
+	OfflineAccess  bool          `json:"offline_access,omitempty"`
+	AuthAudience   string        `json:"auth_audience,omitempty"`
+	ReturnTo       string        `json:"return_to,omitempty"`
+	RequiredScopes []string      `json:"required_scopes,omitempty"`
+	Fingerprint    *Fingerprint  `json:"fingerprint,omitempty"`
+	ProviderIssuer string        `json:"provider_issuer,omitempty"`
+}
+
+// storedMaxAge is the persisted format of a Req's max age.
+type storedMaxAge struct {
+	Seconds   uint      `json:"seconds"`
+	AuthAfter time.Time `json:"auth_after"`
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler (which is also used by
+// encoding/gob), so a Req can be persisted by a request store that's shared
+// between processes.  The format is versioned JSON (see
+// RequestFormatVersion), which includes the request's nonce and PKCE
+// verifier, so it must be stored securely.  The Req's WithNow func isn't
+// persisted.
+func (r *Req) MarshalBinary() ([]byte, error) {
+	const op = "Req.MarshalBinary"
+	s := storedRequest{
+		Version:        RequestFormatVersion,
+		State:          r.state,
+		Nonce:          r.nonce,
+		Expiration:     r.expiration,
+		RedirectURL:    r.redirectURL,
+		Scopes:         r.scopes,
+		Audiences:      r.audiences,
+		Prompts:        r.withPrompts,
+		Display:        r.withDisplay,
+		UILocales:      tagStrings(r.withUILocales),
+		ClaimsLocales:  tagStrings(r.withClaimsLocales),
+		Claims:         r.withClaims,
+		ACRValues:      r.withACRValues,
+		ResponseMode:   r.withResponseMode,
+		OfflineAccess:  r.withOfflineAccess,
+		AuthAudience:   r.withAuthAudience,
+		ReturnTo:       r.withReturnTo,
+		RequiredScopes: r.withRequiredScopes,
+		Fingerprint:    r.withFingerprint,
+		ProviderIssuer: r.withProviderIssuer,
+	}
+	if r.withImplicit != nil {
+		s.Implicit = true
+		s.ImplicitAccess = r.withImplicit.withAccessToken
+	}
+	if r.withVerifier != nil {
+		s.PKCEVerifier = r.withVerifier.Verifier()
+		s.PKCEMethod = string(r.withVerifier.Method())
+	}
+	if r.withMaxAge != nil {
+		s.MaxAge = &storedMaxAge{Seconds: r.withMaxAge.seconds, AuthAfter: r.withMaxAge.authAfter}
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler (which is also used
+// by encoding/gob).  Data persisted by a prior version of the format is
+// migrated to the current version.  Data persisted by a newer version returns
+// an error wrapping ErrUnsupportedFormatVersion.
+func (r *Req) UnmarshalBinary(data []byte) error {
+	const op = "Req.UnmarshalBinary"
+	data, err := migrateFormat(data, RequestFormatVersion, requestMigrations)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	var s storedRequest
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	uiLocales, err := parseTags(s.UILocales)
+	if err != nil {
+		return fmt.Errorf("%s: invalid ui locales: %w", op, err)
+	}
+	claimsLocales, err := parseTags(s.ClaimsLocales)
+	if err != nil {
+		return fmt.Errorf("%s: invalid claims locales: %w", op, err)
+	}
+	*r = Req{
+		state:              s.State,
+		nonce:              s.Nonce,
+		expiration:         s.Expiration,
+		redirectURL:        s.RedirectURL,
+		scopes:             s.Scopes,
+		audiences:          s.Audiences,
+		withPrompts:        s.Prompts,
+		withDisplay:        s.Display,
+		withUILocales:      uiLocales,
+		withClaimsLocales:  claimsLocales,
+		withClaims:         s.Claims,
+		withACRValues:      s.ACRValues,
+		withResponseMode:   s.ResponseMode,
+		withOfflineAccess:  s.OfflineAccess,
+		withAuthAudience:   s.AuthAudience,
+		withReturnTo:       s.ReturnTo,
+		withRequiredScopes: s.RequiredScopes,
+		withFingerprint:    s.Fingerprint,
+		withProviderIssuer: s.ProviderIssuer,
+	}
+	if s.Implicit {
+		r.withImplicit = &implicitFlow{withAccessToken: s.ImplicitAccess}
+	}
+	if s.PKCEVerifier != "" {
+		v := &S256Verifier{verifier: s.PKCEVerifier, method: ChallengeMethod(s.PKCEMethod)}
+		if v.challenge, err = CreateCodeChallenge(v); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		r.withVerifier = v
+	}
+	if s.MaxAge != nil {
+		r.withMaxAge = &maxAge{seconds: s.MaxAge.Seconds, authAfter: s.MaxAge.AuthAfter}
+	}
+	return nil
+}
+
+// storedToken is the persisted format of a Tk.  The IDToken, AccessToken and
+// RefreshToken redact themselves when they're marshaled, so they're persisted
+// as strings.
+type storedToken struct {
+	Version         int       `json:"version"`
+	IDToken         string    `json:"id_token"`
+	AccessToken     string    `json:"access_token,omitempty"`
+	RefreshToken    string    `json:"refresh_token,omitempty"`
+	TokenType       string    `json:"token_type,omitempty"`
+	Expiry          time.Time `json:"expiry,omitempty"`
+	OfflineAccess   bool      `json:"offline_access,omitempty"`
+	RequestedScopes []string  `json:"requested_scopes,omitempty"`
+	GrantedScopes   []string  `json:"granted_scopes,omitempty"`
+	RequiredScopes  []string  `json:"required_scopes,omitempty"`
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler (which is also used by
+// encoding/gob), so a Tk can be persisted by a token or session store.  The
+// format is versioned JSON (see TokenFormatVersion), which includes the
+// unredacted tokens, so it must be stored securely.  The oauth2.Token's extra
+// fields and the Tk's WithNow func aren't persisted.
+func (t *Tk) MarshalBinary() ([]byte, error) {
+	const op = "Tk.MarshalBinary"
+	s := storedToken{
+		Version:         TokenFormatVersion,
+		IDToken:         string(t.idToken),
+		OfflineAccess:   t.offlineAccess,
+		RequestedScopes: t.requestedScopes,
+		GrantedScopes:   t.grantedScopes,
+		RequiredScopes:  t.requiredScopes,
+	}
+	if t.underlying != nil {
+		s.AccessToken = t.underlying.AccessToken
+		s.RefreshToken = t.underlying.RefreshToken
+		s.TokenType = t.underlying.TokenType
+		s.Expiry = t.underlying.Expiry
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler (which is also used
+// by encoding/gob).  Data persisted by a prior version of the format is
+// migrated to the current version.  Data persisted by a newer version returns
+// an error wrapping ErrUnsupportedFormatVersion.
+func (t *Tk) UnmarshalBinary(data []byte) error {
+	const op = "Tk.UnmarshalBinary"
+	data, err := migrateFormat(data, TokenFormatVersion, tokenMigrations)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	var s storedToken
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if s.IDToken == "" {
+		return fmt.Errorf("%s: id_token is empty: %w", op, ErrInvalidParameter)
+	}
+	*t = Tk{
+		idToken:         IDToken(s.IDToken),
+		offlineAccess:   s.OfflineAccess,
+		requestedScopes: s.RequestedScopes,
+		grantedScopes:   s.GrantedScopes,
+		requiredScopes:  s.RequiredScopes,
+	}
+	if s.AccessToken != "" || s.RefreshToken != "" || !s.Expiry.IsZero() {
+		t.underlying = &oauth2.Token{
+			AccessToken:  s.AccessToken,
+			RefreshToken: s.RefreshToken,
+			TokenType:    s.TokenType,
+			Expiry:       s.Expiry,
+		}
+	}
+	return nil
+}
+
+// MarshalToken marshals any Token implementation using the Tk's versioned
+// format (see Tk.MarshalBinary), so a store can persist the Tokens returned
+// by a Provider and by other implementations alike.
+func MarshalToken(t Token) ([]byte, error) {
+	const op = "MarshalToken"
+	if t == nil {
+		return nil, fmt.Errorf("%s: token is nil: %w", op, ErrNilParameter)
+	}
+	tk, ok := t.(*Tk)
+	if !ok {
+		var err error
+		tk, err = NewToken(t.IDToken(), &oauth2.Token{
+			AccessToken:  string(t.AccessToken()),
+			RefreshToken: string(t.RefreshToken()),
+			Expiry:       t.Expiry(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	data, err := tk.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return data, nil
+}
+
+// UnmarshalToken unmarshals a Tk which was marshaled by MarshalToken (or
+// Tk.MarshalBinary).
+//
+// Supported options: WithNow
+func UnmarshalToken(data []byte, opt ...Option) (*Tk, error) {
+	const op = "UnmarshalToken"
+	tk := &Tk{}
+	if err := tk.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	tk.nowFunc = getTokenOpts(opt...).withNowFunc
+	return tk, nil
+}
+
+// tagStrings returns the BCP 47 strings of the language tags.
+func tagStrings(tags []language.Tag) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	s := make([]string, 0, len(tags))
+	for _, t := range tags {
+		s = append(s, t.String())
+	}
+	return s
+}
+
+// parseTags parses BCP 47 strings into language tags.
+func parseTags(s []string) ([]language.Tag, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	tags := make([]language.Tag, 0, len(s))
+	for _, v := range s {
+		t, err := language.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
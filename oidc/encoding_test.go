@@ -0,0 +1,231 @@
+package oidc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"golang.org/x/text/language"
+)
+
+func TestReq_MarshalBinary(t *testing.T) {
+	t.Parallel()
+	// the times are UTC, since a Local time is unmarshaled with a different
+	// (but equal) location
+	now := time.Now().UTC().Truncate(time.Second)
+	verifier, err := NewCodeVerifier()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "defaults"},
+		{
+			name: "all-options",
+			opts: []Option{
+				WithState("st_0123456789abcdefghij"),
+				WithNonce("n_0123456789abcdefghij"),
+				WithScopes("email", "profile"),
+				WithAudiences("aud-1", "aud-2"),
+				WithPKCE(verifier),
+				WithMaxAge(60),
+				WithPrompts(Login, Consent),
+				WithDisplay(Page),
+				WithUILocales(language.AmericanEnglish, language.German),
+				WithClaimsLocales(language.French),
+				WithClaims([]byte(`{"userinfo":{"email":null}}`)),
+				WithACRValues("phr", "phrh"),
+				WithResponseMode(FormPostResponseMode),
+				WithOfflineAccess(),
+				WithAuthAudience("https://api.example.com"),
+				WithReturnTo("/dashboard"),
+				WithRequiredScopes("email"),
+				WithFingerprint(&Fingerprint{IP: "192.0.2.1", UserAgentHash: hashUserAgent("test-agent")}),
+				WithProviderBinding("https://example.com"),
+			},
+		},
+		{
+			name: "implicit",
+			opts: []Option{WithImplicitFlow(true)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			opts := append([]Option{WithNow(func() time.Time { return now })}, tt.opts...)
+			r, err := NewRequest(time.Minute, "https://example.com/callback", opts...)
+			require.NoError(err)
+			r.nowFunc = nil
+
+			data, err := r.MarshalBinary()
+			require.NoError(err)
+			got := &Req{}
+			require.NoError(got.UnmarshalBinary(data))
+			assert.Equal(r, got)
+
+			// a Req can be persisted using gob
+			var buf bytes.Buffer
+			require.NoError(gob.NewEncoder(&buf).Encode(r))
+			got = &Req{}
+			require.NoError(gob.NewDecoder(&buf).Decode(got))
+			assert.Equal(r, got)
+		})
+	}
+	t.Run("newer-version", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		err := (&Req{}).UnmarshalBinary([]byte(`{"version":2,"state":"st_0123456789"}`))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrUnsupportedFormatVersion), "wanted \"%s\" but got \"%s\"", ErrUnsupportedFormatVersion, err)
+	})
+	t.Run("missing-version", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		err := (&Req{}).UnmarshalBinary([]byte(`{"state":"st_0123456789"}`))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrUnsupportedFormatVersion), "wanted \"%s\" but got \"%s\"", ErrUnsupportedFormatVersion, err)
+	})
+}
+
+func TestTk_MarshalBinary(t *testing.T) {
+	t.Parallel()
+	expiry := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name string
+		tk   *Tk
+	}{
+		{
+			name: "all-fields",
+			tk: &Tk{
+				idToken: "id-token",
+				underlying: &oauth2.Token{
+					AccessToken:  "access-token",
+					RefreshToken: "refresh-token",
+					TokenType:    "Bearer",
+					Expiry:       expiry,
+				},
+				offlineAccess:   true,
+				requestedScopes: []string{"openid", "email", "profile"},
+				grantedScopes:   []string{"openid", "email"},
+				requiredScopes:  []string{"email"},
+			},
+		},
+		{
+			name: "id-token-only",
+			tk:   &Tk{idToken: "id-token"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			data, err := tt.tk.MarshalBinary()
+			require.NoError(err)
+			// the tokens aren't redacted
+			assert.Contains(string(data), `"id_token":"id-token"`)
+			got := &Tk{}
+			require.NoError(got.UnmarshalBinary(data))
+			assert.Equal(tt.tk, got)
+
+			var buf bytes.Buffer
+			require.NoError(gob.NewEncoder(&buf).Encode(tt.tk))
+			got = &Tk{}
+			require.NoError(gob.NewDecoder(&buf).Decode(got))
+			assert.Equal(tt.tk, got)
+		})
+	}
+	t.Run("empty-id-token", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		err := (&Tk{}).UnmarshalBinary([]byte(`{"version":1,"access_token":"access-token"}`))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("newer-version", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		err := (&Tk{}).UnmarshalBinary([]byte(`{"version":2,"id_token":"id-token"}`))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrUnsupportedFormatVersion), "wanted \"%s\" but got \"%s\"", ErrUnsupportedFormatVersion, err)
+	})
+}
+
+// testToken is a Token implementation other than a Tk.
+type testToken struct {
+	Tk
+}
+
+func TestMarshalToken(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	now := time.Now()
+	expiry := now.Add(time.Hour).Truncate(time.Second)
+	tk, err := NewToken("id-token", &oauth2.Token{AccessToken: "access-token", RefreshToken: "refresh-token", Expiry: expiry})
+	require.NoError(err)
+
+	for _, token := range []Token{tk, &testToken{Tk: *tk}} {
+		data, err := MarshalToken(token)
+		require.NoError(err)
+		got, err := UnmarshalToken(data, WithNow(func() time.Time { return now }))
+		require.NoError(err)
+		assert.Equal(tk.IDToken(), got.IDToken())
+		assert.Equal(tk.AccessToken(), got.AccessToken())
+		assert.Equal(tk.RefreshToken(), got.RefreshToken())
+		assert.True(expiry.Equal(got.Expiry()))
+		assert.Equal(now, got.now())
+	}
+
+	_, err = MarshalToken(nil)
+	require.Error(err)
+	assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	_, err = UnmarshalToken([]byte("{"))
+	assert.Error(err)
+}
+
+func Test_migrateFormat(t *testing.T) {
+	t.Parallel()
+	// migrations of a format which renamed "name" to "full_name" in version 2
+	// and added "kind" in version 3
+	migrations := map[int]formatMigration{
+		1: func(data map[string]json.RawMessage) error {
+			data["full_name"] = data["name"]
+			delete(data, "name")
+			return nil
+		},
+		2: func(data map[string]json.RawMessage) error {
+			data["kind"] = json.RawMessage(`"user"`)
+			return nil
+		},
+	}
+	tests := []struct {
+		name      string
+		data      string
+		current   int
+		want      string
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "current", data: `{"version":3,"full_name":"alice","kind":"admin"}`, current: 3, want: `{"version":3,"full_name":"alice","kind":"admin"}`},
+		{name: "from-v1", data: `{"version":1,"name":"alice"}`, current: 3, want: `{"version":3,"full_name":"alice","kind":"user"}`},
+		{name: "from-v2", data: `{"version":2,"full_name":"alice"}`, current: 3, want: `{"version":3,"full_name":"alice","kind":"user"}`},
+		{name: "missing-migration", data: `{"version":1,"name":"alice"}`, current: 4, wantErr: true, wantIsErr: ErrUnsupportedFormatVersion},
+		{name: "newer", data: `{"version":4}`, current: 3, wantErr: true, wantIsErr: ErrUnsupportedFormatVersion},
+		{name: "missing-version", data: `{"name":"alice"}`, current: 3, wantErr: true, wantIsErr: ErrUnsupportedFormatVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := migrateFormat([]byte(tt.data), tt.current, migrations)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.JSONEq(tt.want, string(got))
+		})
+	}
+}
@@ -37,4 +37,32 @@ var (
 	ErrUnsupportedChallengeMethod = errors.New("unsupported PKCE challenge method")
 	ErrExpiredAuthTime            = errors.New("expired auth_time")
 	ErrMissingClaim               = errors.New("missing required claim")
+	ErrUnhealthyProvider          = errors.New("provider is unhealthy")
+	ErrResponseTooLarge           = errors.New("response too large")
+	ErrRevocationFailed           = errors.New("revocation failed")
+	ErrDecryptionFailed           = errors.New("decryption failed")
+	ErrUnknownIssuer              = errors.New("unknown issuer")
+	ErrExpiredSession             = errors.New("session is expired")
+	ErrInvalidReturnTo            = errors.New("invalid return-to URL")
+	ErrUnsupportedFormatVersion   = errors.New("unsupported format version")
+	ErrUnpinnedKey                = errors.New("signing key is not pinned")
+	ErrScopesNotGranted           = errors.New("required scopes not granted")
+	ErrFingerprintMismatch        = errors.New("fingerprint mismatch")
+	ErrInvalidLogoutToken         = errors.New("invalid logout token")
+	ErrInvalidTokenBinding        = errors.New("invalid token binding")
+	ErrInvalidACR                 = errors.New("invalid authentication context class reference (acr)")
+	ErrDuplicateCallback          = errors.New("duplicate callback")
+	ErrOutOfOrderCallback         = errors.New("out-of-order callback")
+	ErrPushedAuthorizationFailed  = errors.New("pushed authorization request failed")
+	ErrFAPIViolation              = errors.New("FAPI profile violation")
+	ErrProviderMismatch           = errors.New("provider mismatch")
+	ErrReplayDetected             = errors.New("replay detected")
+	ErrRefreshTokenReused         = errors.New("refresh token reused")
+	ErrRefreshTokenRejected       = errors.New("refresh token rejected")
+	ErrNoBrowser                  = errors.New("no browser available")
+	ErrClaimLimitExceeded         = errors.New("claim limit exceeded")
+	ErrGroupsResolutionFailed     = errors.New("groups resolution failed")
+	ErrUserInfoUnsupported        = errors.New("userinfo endpoint not supported")
+	ErrDuplicateParameter         = errors.New("duplicate parameter")
+	ErrRegistrationFailed         = errors.New("client registration failed")
 )
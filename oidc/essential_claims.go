@@ -0,0 +1,110 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Members of the claims parameter, which request the claims returned in the
+// id_token and the userinfo response.  See:
+// https://openid.net/specs/openid-connect-core-1_0.html#ClaimsParameter
+const (
+	claimsParamIDToken  = "id_token"
+	claimsParamUserInfo = "userinfo"
+)
+
+// WithEssentialClaims optionally enforces the essential claims requested by
+// the oidcRequest's claims parameter (see WithClaims), like:
+//
+//	{"id_token":{"acr":{"essential":true}},"userinfo":{"email":{"essential":true}}}
+//
+// Provider.VerifyIDToken enforces the claims requested for the id_token, and
+// Provider.UserInfo (and RawUserInfo) enforce the claims requested for the
+// userinfo response.  The claims are enforced after the token or response is
+// verified, and an error wrapping ErrMissingClaim (which lists the names of the
+// essential claims which are missing or null) is returned.  Providers aren't
+// required to return essential claims, so they're not enforced by default.
+//
+// Valid for: Provider.VerifyIDToken, Provider.UserInfo and
+// Provider.RawUserInfo
+func WithEssentialClaims(oidcRequest Request) Option {
+	return func(o interface{}) {
+		switch v := o.(type) {
+		case *verifyIDTokenOptions:
+			v.withEssentialClaims = oidcRequest
+		case *userInfoOptions:
+			v.withEssentialClaims = oidcRequest
+		}
+	}
+}
+
+// essentialClaims returns the sorted names of the claims which the claims
+// parameter requests as essential for the member (id_token or userinfo).
+func essentialClaims(claimsParam []byte, member string) ([]string, error) {
+	const op = "essentialClaims"
+	if len(claimsParam) == 0 {
+		return nil, nil
+	}
+	var requested map[string]map[string]*struct {
+		Essential bool `json:"essential"`
+	}
+	if err := json.Unmarshal(claimsParam, &requested); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse claims parameter: %s: %w", op, err, ErrInvalidParameter)
+	}
+	var names []string
+	for name, c := range requested[member] {
+		if c != nil && c.Essential {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// verifyEssentialClaims verifies that the claims include the oidcRequest's
+// essential claims for the member (id_token or userinfo).  Nothing is
+// verified when the oidcRequest is nil.
+func verifyEssentialClaims(oidcRequest Request, member string, claims map[string]interface{}) error {
+	const op = "verifyEssentialClaims"
+	if oidcRequest == nil {
+		return nil
+	}
+	names, err := essentialClaims(oidcRequest.Claims(), member)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	var missing []string
+	for _, name := range names {
+		if v, ok := claims[name]; !ok || v == nil {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: %s is missing essential claims: %s: %w", op, member, strings.Join(missing, ", "), ErrMissingClaim)
+	}
+	return nil
+}
+
+// verifyIDTokenOptions is the set of available options for the
+// Provider.VerifyIDToken function
+type verifyIDTokenOptions struct {
+	withEssentialClaims    Request
+	withVerificationResult *VerificationResult
+	withACRPolicy          ACRPolicyFunc
+}
+
+// verifyIDTokenDefaults is a handy way to get the defaults at runtime and
+// during unit tests.
+func verifyIDTokenDefaults() verifyIDTokenOptions {
+	return verifyIDTokenOptions{}
+}
+
+// getVerifyIDTokenOpts gets the Provider.VerifyIDToken defaults and applies
+// the opt overrides passed in
+func getVerifyIDTokenOpts(opt ...Option) verifyIDTokenOptions {
+	opts := verifyIDTokenDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
@@ -0,0 +1,105 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_verifyEssentialClaims(t *testing.T) {
+	t.Parallel()
+	const claimsParam = `{"id_token":{"acr":{"essential":true},"email":{"essential":true},"name":null,"locale":{"essential":false}},"userinfo":{"phone_number":{"essential":true}}}`
+	tests := []struct {
+		name      string
+		claims    []byte
+		member    string
+		got       map[string]interface{}
+		wantErr   error
+		wantNames string
+	}{
+		{
+			name:   "no-claims-param",
+			member: claimsParamIDToken,
+			got:    map[string]interface{}{},
+		},
+		{
+			name:   "present",
+			claims: []byte(claimsParam),
+			member: claimsParamIDToken,
+			got:    map[string]interface{}{"acr": "1", "email": "alice@example.com"},
+		},
+		{
+			name:      "missing-and-null",
+			claims:    []byte(claimsParam),
+			member:    claimsParamIDToken,
+			got:       map[string]interface{}{"email": nil},
+			wantErr:   ErrMissingClaim,
+			wantNames: "acr, email",
+		},
+		{
+			name:      "userinfo",
+			claims:    []byte(claimsParam),
+			member:    claimsParamUserInfo,
+			got:       map[string]interface{}{"acr": "1"},
+			wantErr:   ErrMissingClaim,
+			wantNames: "phone_number",
+		},
+		{
+			name:    "invalid-claims-param",
+			claims:  []byte(`{"id_token":[]}`),
+			member:  claimsParamIDToken,
+			wantErr: ErrInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			oidcRequest, err := NewRequest(time.Minute, "https://example.com/callback", WithClaims(tt.claims))
+			require.NoError(err)
+			err = verifyEssentialClaims(oidcRequest, tt.member, tt.got)
+			if tt.wantErr != nil {
+				require.Truef(errors.Is(err, tt.wantErr), "wanted \"%s\" but got \"%s\"", tt.wantErr, err)
+				assert.Contains(err.Error(), tt.wantNames)
+				return
+			}
+			require.NoError(err)
+		})
+	}
+	t.Run("nil-request", func(t *testing.T) {
+		assert.NoError(t, verifyEssentialClaims(nil, claimsParamIDToken, nil))
+	})
+}
+
+func TestProvider_VerifyIDToken_essentialClaims(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	priv, _, alg, _ := tp.SigningKeys()
+	redirect := "https://example.com/callback"
+	p := testNewProvider(t, "client-id", "client-secret", redirect, tp)
+
+	oidcRequest, err := NewRequest(time.Minute, redirect, WithClaims([]byte(`{"id_token":{"acr":{"essential":true}}}`)))
+	require.NoError(t, err)
+	idToken := IDToken(TestSignJWT(t, priv, alg, map[string]interface{}{
+		"iss":   tp.Addr(),
+		"aud":   "client-id",
+		"sub":   "alice@example.com",
+		"nonce": oidcRequest.Nonce(),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}, nil))
+
+	t.Run("not-enforced", func(t *testing.T) {
+		_, err := p.VerifyIDToken(ctx, idToken, oidcRequest)
+		require.NoError(t, err)
+	})
+	t.Run("enforced", func(t *testing.T) {
+		_, err := p.VerifyIDToken(ctx, idToken, oidcRequest, WithEssentialClaims(oidcRequest))
+		require.Truef(t, errors.Is(err, ErrMissingClaim), "wanted \"%s\" but got \"%s\"", ErrMissingClaim, err)
+		assert.Contains(t, err.Error(), "acr")
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+func main() {
+	port := flag.Int("port", 0, "port of the provider (default: a random port)")
+	clientID := flag.String("client-id", oidc.DefaultDevClientID, "client ID of the provider's client")
+	clientSecret := flag.String("client-secret", oidc.DefaultDevClientSecret, "client secret of the provider's client (empty for a public client)")
+	redirects := flag.String("redirect-uris", "", "comma separated redirect URIs allowed for the client (default: any)")
+	users := flag.String("users", "alice@example.com", "comma separated emails of the provider's users")
+	caFile := flag.String("ca-file", "", "file to write the provider's CA certificate to")
+	flag.Parse()
+
+	opts := []oidc.Option{
+		oidc.WithTestPort(*port),
+		oidc.WithDevClient(oidc.DevClient{ID: *clientID, Secret: *clientSecret, RedirectURIs: splitList(*redirects)}),
+		oidc.WithDevCACertFile(*caFile),
+	}
+	for _, email := range splitList(*users) {
+		opts = append(opts, oidc.WithDevUser(oidc.DevUser{
+			Subject: email,
+			Claims:  map[string]interface{}{"email": email, "email_verified": true},
+		}))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigintCh := make(chan os.Signal, 1)
+	signal.Notify(sigintCh, os.Interrupt)
+	go func() {
+		<-sigintCh
+		cancel()
+	}()
+	if err := oidc.RunDevProvider(ctx, opts...); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+// splitList splits a comma separated list, ignoring empty values.
+func splitList(s string) []string {
+	var l []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/cap/oidc/internal/strutils"
+)
+
+// WithFAPIProfile optionally enforces the FAPI 2.0 security profile's
+// requirements across the provider's flows, which fail fast when the config,
+// the provider or a request can't satisfy them:
+//
+//   - the config must have ClientCertificates (see WithClientCertificates),
+//     which are used for certificate-bound (sender-constrained) access tokens,
+//     and it can't authenticate the client using its ClientSecret.
+//
+//   - the provider's discovery document must advertise a
+//     pushed_authorization_request_endpoint, the S256 PKCE code challenge
+//     method, the iss authorization response parameter and certificate-bound
+//     access tokens, otherwise NewProvider fails.
+//
+//   - every Request must use PKCE with the S256 method and the implicit flow
+//     isn't allowed.
+//
+//   - authentication requests are always pushed (see
+//     WithPushedAuthorizationRequest).
+//
+//   - authorization responses must include an iss parameter matching the
+//     config's Issuer (see Provider.VerifyResponseIssuer).
+//
+// Every violation is an error wrapping ErrFAPIViolation.  See:
+// https://openid.net/specs/fapi-2_0-security-profile.html
+//
+// Valid for: Config
+func WithFAPIProfile() Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withFAPI = true
+		}
+	}
+}
+
+// validFAPI verifies the config satisfies the FAPI profile.
+func (c *Config) validFAPI() error {
+	const op = "Config.validFAPI"
+	if len(c.ClientCertificates) == 0 {
+		return fmt.Errorf("%s: client certificates are required for sender-constrained access tokens: %w", op, ErrFAPIViolation)
+	}
+	if c.ClientSecret != "" && c.ClientAssertionSigner == nil {
+		return fmt.Errorf("%s: client secret authentication is not allowed: %w", op, ErrFAPIViolation)
+	}
+	return nil
+}
+
+// validFAPIProvider verifies the provider's discovery metadata satisfies the
+// FAPI profile.
+func validFAPIProvider(m providerMetadata) error {
+	const op = "validFAPIProvider"
+	var missing []string
+	if m.PushedAuthorizationEndpoint == "" {
+		missing = append(missing, "pushed_authorization_request_endpoint")
+	}
+	if !strutils.StrListContains(m.CodeChallengeMethods, string(S256)) {
+		missing = append(missing, "S256 code_challenge_methods_supported")
+	}
+	if !m.ResponseIssuer {
+		missing = append(missing, "authorization_response_iss_parameter_supported")
+	}
+	if !m.CertificateBoundTokens {
+		missing = append(missing, "tls_client_certificate_bound_access_tokens")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: provider doesn't support %s: %w", op, strings.Join(missing, ", "), ErrFAPIViolation)
+	}
+	return nil
+}
+
+// validFAPIRequest verifies the request satisfies the FAPI profile.
+func validFAPIRequest(oidcRequest Request) error {
+	const op = "validFAPIRequest"
+	if useImplicit, _ := oidcRequest.ImplicitFlow(); useImplicit {
+		return fmt.Errorf("%s: the implicit flow is not allowed: %w", op, ErrFAPIViolation)
+	}
+	v := oidcRequest.PKCEVerifier()
+	if v == nil || v.Method() != S256 {
+		return fmt.Errorf("%s: PKCE with the S256 method is required: %w", op, ErrFAPIViolation)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package oidc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testFAPIProvider is a TLS provider which requests client certificates and
+// has a pushed_authorization_request_endpoint.
+type testFAPIProvider struct {
+	srv *httptest.Server
+
+	mu sync.Mutex
+	// pushed are the forms received by the pushed_authorization_request_endpoint
+	pushed []url.Values
+	// peerCerts is the number of client certificates presented for each
+	// pushed authorization request
+	peerCerts []int
+}
+
+func startTestFAPIProvider(t *testing.T, metadata map[string]interface{}) *testFAPIProvider {
+	t.Helper()
+	tp := &testFAPIProvider{}
+	tp.srv = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/par":
+			_ = req.ParseForm()
+			tp.mu.Lock()
+			tp.pushed = append(tp.pushed, req.PostForm)
+			tp.peerCerts = append(tp.peerCerts, len(req.TLS.PeerCertificates))
+			tp.mu.Unlock()
+			if req.PostForm.Get("client_id") != "client-id" {
+				w.WriteHeader(http.StatusUnauthorized)
+				_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"request_uri":"urn:ietf:params:oauth:request_uri:test","expires_in":60}`))
+		default:
+			doc := map[string]interface{}{
+				"issuer":                                tp.srv.URL,
+				"authorization_endpoint":                tp.srv.URL + "/authorize",
+				"token_endpoint":                        tp.srv.URL + "/token",
+				"jwks_uri":                              tp.srv.URL + "/jwks",
+				"pushed_authorization_request_endpoint": tp.srv.URL + "/par",
+				"code_challenge_methods_supported":      []string{"plain", "S256"},
+				"authorization_response_iss_parameter_supported": true,
+				"tls_client_certificate_bound_access_tokens":     true,
+			}
+			for k, v := range metadata {
+				if v == nil {
+					delete(doc, k)
+					continue
+				}
+				doc[k] = v
+			}
+			_ = json.NewEncoder(w).Encode(doc)
+		}
+	}))
+	tp.srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	tp.srv.StartTLS()
+	t.Cleanup(tp.srv.Close)
+	return tp
+}
+
+// config returns a FAPI config for the provider.
+func (tp *testFAPIProvider) config(t *testing.T, opt ...Option) *Config {
+	t.Helper()
+	ca, err := EncodeCertificates(tp.srv.Certificate())
+	require.NoError(t, err)
+	opts := append([]Option{WithProviderCA(ca), WithClientCertificates(testClientCertificate(t)), WithFAPIProfile()}, opt...)
+	c, err := NewConfig(tp.srv.URL, "client-id", "", []Alg{ES256}, []string{"https://example.com/callback"}, opts...)
+	require.NoError(t, err)
+	return c
+}
+
+func (tp *testFAPIProvider) lastPushed() (url.Values, int) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if len(tp.pushed) == 0 {
+		return nil, 0
+	}
+	return tp.pushed[len(tp.pushed)-1], tp.peerCerts[len(tp.peerCerts)-1]
+}
+
+// testPlainVerifier is a CodeVerifier which uses the plain challenge method
+type testPlainVerifier string
+
+func (v testPlainVerifier) Verifier() string        { return string(v) }
+func (v testPlainVerifier) Challenge() string       { return string(v) }
+func (v testPlainVerifier) Method() ChallengeMethod { return "plain" }
+func (v testPlainVerifier) Copy() CodeVerifier      { return v }
+
+func TestConfig_validFAPI(t *testing.T) {
+	t.Parallel()
+	cert := testClientCertificate(t)
+	redirect := []string{"https://example.com/callback"}
+	tests := []struct {
+		name      string
+		secret    ClientSecret
+		opts      []Option
+		wantIsErr error
+	}{
+		{name: "valid", opts: []Option{WithFAPIProfile(), WithClientCertificates(cert)}},
+		{name: "missing-client-certificates", opts: []Option{WithFAPIProfile()}, wantIsErr: ErrFAPIViolation},
+		{name: "client-secret", secret: "secret", opts: []Option{WithFAPIProfile(), WithClientCertificates(cert)}, wantIsErr: ErrFAPIViolation},
+		{name: "client-secret-without-fapi", secret: "secret"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			c, err := NewConfig("https://example.com", "client-id", tt.secret, []Alg{ES256}, redirect, tt.opts...)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(len(tt.opts) > 0, c.FAPI)
+		})
+	}
+}
+
+func Test_validFAPIProvider(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	valid := providerMetadata{
+		PushedAuthorizationEndpoint: "https://example.com/par",
+		CodeChallengeMethods:        []string{"S256"},
+		ResponseIssuer:              true,
+		CertificateBoundTokens:      true,
+	}
+	assert.NoError(validFAPIProvider(valid))
+
+	err := validFAPIProvider(providerMetadata{CodeChallengeMethods: []string{"plain"}})
+	assert.Truef(errors.Is(err, ErrFAPIViolation), "wanted \"%s\" but got \"%s\"", ErrFAPIViolation, err)
+	assert.Contains(err.Error(), "pushed_authorization_request_endpoint, S256 code_challenge_methods_supported, authorization_response_iss_parameter_supported, tls_client_certificate_bound_access_tokens")
+}
+
+func TestNewProvider_FAPI(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		metadata map[string]interface{}
+		wantErr  bool
+	}{
+		{name: "valid"},
+		{name: "missing-par", metadata: map[string]interface{}{"pushed_authorization_request_endpoint": nil}, wantErr: true},
+		{name: "missing-s256", metadata: map[string]interface{}{"code_challenge_methods_supported": []string{"plain"}}, wantErr: true},
+		{name: "missing-iss", metadata: map[string]interface{}{"authorization_response_iss_parameter_supported": false}, wantErr: true},
+		{name: "missing-bound-tokens", metadata: map[string]interface{}{"tls_client_certificate_bound_access_tokens": nil}, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			tp := startTestFAPIProvider(t, tt.metadata)
+			p, err := NewProvider(tp.config(t))
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, ErrFAPIViolation), "wanted \"%s\" but got \"%s\"", ErrFAPIViolation, err)
+				return
+			}
+			require.NoError(err)
+			p.Done()
+		})
+	}
+}
+
+func TestProvider_AuthURL_FAPI(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := startTestFAPIProvider(t, nil)
+	p, err := NewProvider(tp.config(t))
+	require.NoError(t, err)
+	defer p.Done()
+
+	s256, err := NewCodeVerifier()
+	require.NoError(t, err)
+	plain := testPlainVerifier("plain-verifier")
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantIsErr error
+	}{
+		{name: "valid", opts: []Option{WithPKCE(s256)}},
+		{name: "missing-pkce", wantIsErr: ErrFAPIViolation},
+		{name: "plain-pkce", opts: []Option{WithPKCE(plain)}, wantIsErr: ErrFAPIViolation},
+		{name: "implicit", opts: []Option{WithImplicitFlow()}, wantIsErr: ErrFAPIViolation},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			oidcRequest, err := NewRequest(time.Minute, "https://example.com/callback", tt.opts...)
+			require.NoError(err)
+			authURL, err := p.AuthURL(ctx, oidcRequest)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			u, err := url.Parse(authURL)
+			require.NoError(err)
+			assert.Equal(tp.srv.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+			assert.Equal(url.Values{
+				"client_id":   {"client-id"},
+				"request_uri": {"urn:ietf:params:oauth:request_uri:test"},
+			}, u.Query())
+
+			pushed, peerCerts := tp.lastPushed()
+			assert.Equal(1, peerCerts)
+			assert.Equal(oidcRequest.State(), pushed.Get("state"))
+			assert.Equal(oidcRequest.Nonce(), pushed.Get("nonce"))
+			assert.Equal(s256.Challenge(), pushed.Get("code_challenge"))
+			assert.Equal(string(S256), pushed.Get("code_challenge_method"))
+		})
+	}
+}
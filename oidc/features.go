@@ -0,0 +1,162 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/cap/oidc/internal/strutils"
+)
+
+// Feature is an optional provider capability, which is advertised in the
+// provider's discovery document.  See:
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type Feature string
+
+const (
+	// FeaturePKCES256 is PKCE with the S256 code challenge method
+	FeaturePKCES256 Feature = "pkce_s256"
+
+	// FeaturePKCEPlain is PKCE with the plain code challenge method
+	FeaturePKCEPlain Feature = "pkce_plain"
+
+	// FeatureRequestURI is passing a request object by reference using the
+	// request_uri parameter
+	FeatureRequestURI Feature = "request_uri"
+
+	// FeatureRequestObject is passing a request object by value using the
+	// request parameter
+	FeatureRequestObject Feature = "request_object"
+
+	// FeatureEndSession is RP-initiated logout using the end_session_endpoint
+	// (see Provider.LogoutURL)
+	FeatureEndSession Feature = "end_session"
+
+	// FeatureIntrospection is token introspection using the
+	// introspection_endpoint
+	FeatureIntrospection Feature = "introspection"
+
+	// FeatureRevocation is token revocation using the revocation_endpoint
+	FeatureRevocation Feature = "revocation"
+
+	// FeatureDeviceAuthorization is the device authorization grant using the
+	// device_authorization_endpoint (see Provider.DeviceAuthorization)
+	FeatureDeviceAuthorization Feature = "device_authorization"
+
+	// FeatureUserInfo is the userinfo_endpoint, which is also supported when
+	// the config has a UserInfoURL
+	FeatureUserInfo Feature = "userinfo"
+
+	// FeatureClaimsParameter is requesting individual claims using the claims
+	// parameter (see WithClaims)
+	FeatureClaimsParameter Feature = "claims_parameter"
+
+	// FeatureResponseModeQuery is the query response mode
+	FeatureResponseModeQuery Feature = "response_mode_query"
+
+	// FeatureResponseModeFragment is the fragment response mode
+	FeatureResponseModeFragment Feature = "response_mode_fragment"
+
+	// FeatureResponseModeFormPost is the form_post response mode, which is
+	// used by the implicit flow (see WithImplicitFlow)
+	FeatureResponseModeFormPost Feature = "response_mode_form_post"
+
+	// FeaturePushedAuthorizationRequest is pushing authentication requests
+	// using the pushed_authorization_request_endpoint (see
+	// WithPushedAuthorizationRequest)
+	FeaturePushedAuthorizationRequest Feature = "pushed_authorization_request"
+
+	// FeatureResponseIssuer is the iss parameter of authorization responses
+	// (see Provider.VerifyResponseIssuer)
+	FeatureResponseIssuer Feature = "response_issuer"
+
+	// FeatureCertificateBoundAccessTokens is mutual TLS certificate-bound
+	// access tokens (see WithClientCertificates)
+	FeatureCertificateBoundAccessTokens Feature = "certificate_bound_access_tokens"
+
+	// FeatureDynamicRegistration is dynamic client registration using the
+	// registration_endpoint (see NewRegistrationClient)
+	FeatureDynamicRegistration Feature = "dynamic_registration"
+)
+
+// providerMetadata is the discovery metadata used to determine a provider's
+// features
+type providerMetadata struct {
+	CodeChallengeMethods        []string `json:"code_challenge_methods_supported"`
+	RequestURIParameter         *bool    `json:"request_uri_parameter_supported"`
+	RequestParameter            bool     `json:"request_parameter_supported"`
+	EndSessionEndpoint          string   `json:"end_session_endpoint"`
+	IntrospectionEndpoint       string   `json:"introspection_endpoint"`
+	RevocationEndpoint          string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint string   `json:"device_authorization_endpoint"`
+	UserInfoEndpoint            string   `json:"userinfo_endpoint"`
+	ClaimsParameterSupported    bool     `json:"claims_parameter_supported"`
+	ResponseModes               []string `json:"response_modes_supported"`
+	PushedAuthorizationEndpoint string   `json:"pushed_authorization_request_endpoint"`
+	ResponseIssuer              bool     `json:"authorization_response_iss_parameter_supported"`
+	CertificateBoundTokens      bool     `json:"tls_client_certificate_bound_access_tokens"`
+	RegistrationEndpoint        string   `json:"registration_endpoint"`
+}
+
+// Supports returns true when the provider's discovery document advertises
+// the feature, which allows apps to enable or disable options based on each
+// IdP's capabilities.  When the discovery document omits an optional
+// parameter, the specification's default is used (for example:
+// request_uri_parameter_supported defaults to true, and
+// response_modes_supported defaults to query and fragment).
+//
+// An ErrInvalidParameter error is returned for an unknown feature.
+func (p *Provider) Supports(ctx context.Context, f Feature) (bool, error) {
+	const op = "Provider.Supports"
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	provider, _, err := p.discovered(ctx)
+	if err != nil {
+		return false, fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	var m providerMetadata
+	if err := provider.Claims(&m); err != nil {
+		return false, fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+	}
+	responseModes := m.ResponseModes
+	if len(responseModes) == 0 {
+		responseModes = []string{"query", "fragment"}
+	}
+	switch f {
+	case FeaturePKCES256:
+		return strutils.StrListContains(m.CodeChallengeMethods, string(S256)), nil
+	case FeaturePKCEPlain:
+		return strutils.StrListContains(m.CodeChallengeMethods, "plain"), nil
+	case FeatureRequestURI:
+		return m.RequestURIParameter == nil || *m.RequestURIParameter, nil
+	case FeatureRequestObject:
+		return m.RequestParameter, nil
+	case FeatureEndSession:
+		return m.EndSessionEndpoint != "", nil
+	case FeatureIntrospection:
+		return m.IntrospectionEndpoint != "", nil
+	case FeatureRevocation:
+		return m.RevocationEndpoint != "", nil
+	case FeatureDeviceAuthorization:
+		return m.DeviceAuthorizationEndpoint != "", nil
+	case FeatureUserInfo:
+		return m.UserInfoEndpoint != "" || p.currentConfig().UserInfoURL != "", nil
+	case FeatureClaimsParameter:
+		return m.ClaimsParameterSupported, nil
+	case FeatureResponseModeQuery:
+		return strutils.StrListContains(responseModes, "query"), nil
+	case FeatureResponseModeFragment:
+		return strutils.StrListContains(responseModes, "fragment"), nil
+	case FeatureResponseModeFormPost:
+		return strutils.StrListContains(responseModes, "form_post"), nil
+	case FeaturePushedAuthorizationRequest:
+		return m.PushedAuthorizationEndpoint != "", nil
+	case FeatureResponseIssuer:
+		return m.ResponseIssuer, nil
+	case FeatureCertificateBoundAccessTokens:
+		return m.CertificateBoundTokens, nil
+	case FeatureDynamicRegistration:
+		return m.RegistrationEndpoint != "", nil
+	default:
+		return false, fmt.Errorf("%s: unknown feature %q: %w", op, f, ErrInvalidParameter)
+	}
+}
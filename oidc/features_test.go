@@ -0,0 +1,108 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_Supports(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	newProvider := func(t *testing.T, metadata map[string]interface{}) *Provider {
+		t.Helper()
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			doc := map[string]interface{}{
+				"issuer":   srv.URL,
+				"jwks_uri": srv.URL + "/jwks",
+			}
+			for k, v := range metadata {
+				doc[k] = v
+			}
+			_ = json.NewEncoder(w).Encode(doc)
+		}))
+		t.Cleanup(srv.Close)
+		c, err := NewConfig(srv.URL, "client-id", "client-secret", []Alg{ES256}, []string{"https://redirect"})
+		require.NoError(t, err)
+		p, err := NewProvider(c)
+		require.NoError(t, err)
+		t.Cleanup(p.Done)
+		return p
+	}
+	full := newProvider(t, map[string]interface{}{
+		"code_challenge_methods_supported":               []string{"S256"},
+		"request_uri_parameter_supported":                false,
+		"request_parameter_supported":                    true,
+		"end_session_endpoint":                           "https://example.com/logout",
+		"introspection_endpoint":                         "https://example.com/introspect",
+		"revocation_endpoint":                            "https://example.com/revoke",
+		"userinfo_endpoint":                              "https://example.com/userinfo",
+		"claims_parameter_supported":                     true,
+		"response_modes_supported":                       []string{"query", "form_post"},
+		"device_authorization_endpoint":                  "https://example.com/device",
+		"pushed_authorization_request_endpoint":          "https://example.com/par",
+		"authorization_response_iss_parameter_supported": true,
+		"tls_client_certificate_bound_access_tokens":     true,
+		"registration_endpoint":                          "https://example.com/register",
+	})
+	minimal := newProvider(t, nil)
+
+	tests := []struct {
+		name      string
+		p         *Provider
+		feature   Feature
+		want      bool
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "pkce-s256", p: full, feature: FeaturePKCES256, want: true},
+		{name: "pkce-plain", p: full, feature: FeaturePKCEPlain, want: false},
+		{name: "request-uri", p: full, feature: FeatureRequestURI, want: false},
+		{name: "request-object", p: full, feature: FeatureRequestObject, want: true},
+		{name: "end-session", p: full, feature: FeatureEndSession, want: true},
+		{name: "introspection", p: full, feature: FeatureIntrospection, want: true},
+		{name: "revocation", p: full, feature: FeatureRevocation, want: true},
+		{name: "userinfo", p: full, feature: FeatureUserInfo, want: true},
+		{name: "claims-parameter", p: full, feature: FeatureClaimsParameter, want: true},
+		{name: "response-mode-query", p: full, feature: FeatureResponseModeQuery, want: true},
+		{name: "response-mode-fragment", p: full, feature: FeatureResponseModeFragment, want: false},
+		{name: "response-mode-form-post", p: full, feature: FeatureResponseModeFormPost, want: true},
+		{name: "device-authorization", p: full, feature: FeatureDeviceAuthorization, want: true},
+		{name: "pushed-authorization-request", p: full, feature: FeaturePushedAuthorizationRequest, want: true},
+		{name: "response-issuer", p: full, feature: FeatureResponseIssuer, want: true},
+		{name: "certificate-bound-access-tokens", p: full, feature: FeatureCertificateBoundAccessTokens, want: true},
+		{name: "dynamic-registration", p: full, feature: FeatureDynamicRegistration, want: true},
+		{name: "default-dynamic-registration", p: minimal, feature: FeatureDynamicRegistration, want: false},
+		{name: "default-pushed-authorization-request", p: minimal, feature: FeaturePushedAuthorizationRequest, want: false},
+		{name: "default-response-issuer", p: minimal, feature: FeatureResponseIssuer, want: false},
+		{name: "default-pkce-s256", p: minimal, feature: FeaturePKCES256, want: false},
+		{name: "default-request-uri", p: minimal, feature: FeatureRequestURI, want: true},
+		{name: "default-end-session", p: minimal, feature: FeatureEndSession, want: false},
+		{name: "default-claims-parameter", p: minimal, feature: FeatureClaimsParameter, want: false},
+		{name: "default-response-mode-query", p: minimal, feature: FeatureResponseModeQuery, want: true},
+		{name: "default-response-mode-fragment", p: minimal, feature: FeatureResponseModeFragment, want: true},
+		{name: "default-response-mode-form-post", p: minimal, feature: FeatureResponseModeFormPost, want: false},
+		{name: "default-device-authorization", p: minimal, feature: FeatureDeviceAuthorization, want: false},
+		{name: "unknown", p: full, feature: Feature("unknown"), wantErr: true, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := tt.p.Supports(ctx, tt.feature)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+		})
+	}
+}
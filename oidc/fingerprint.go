@@ -0,0 +1,198 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// FingerprintStrictness defines how a request's Fingerprint is verified.
+type FingerprintStrictness int
+
+const (
+	// FingerprintUserAgent only verifies the user agent, which tolerates
+	// users whose IP changes during authentication (like mobile users).
+	FingerprintUserAgent FingerprintStrictness = iota + 1
+
+	// FingerprintNetwork verifies the user agent and that the IP is in the
+	// same network as the fingerprint's IP (see FingerprintIPv4PrefixLen and
+	// FingerprintIPv6PrefixLen).
+	FingerprintNetwork
+
+	// FingerprintStrict verifies the user agent and that the IP is the
+	// fingerprint's IP.
+	FingerprintStrict
+)
+
+const (
+	// FingerprintIPv4PrefixLen is the network prefix length of an IPv4
+	// address verified with FingerprintNetwork.
+	FingerprintIPv4PrefixLen = 24
+
+	// FingerprintIPv6PrefixLen is the network prefix length of an IPv6
+	// address verified with FingerprintNetwork.
+	FingerprintIPv6PrefixLen = 64
+)
+
+// Fingerprint is a user agent's fingerprint, which is captured when a
+// request's authentication flow is started (see WithFingerprint) and verified
+// when its authentication response is received.  It binds the request's state
+// to the user agent which started the flow, which detects a stolen state (for
+// example, a phishing attack which tricks a user into completing an attacker's
+// flow).  Fingerprints aren't secrets, but they should only be used to detect
+// attacks, since IPs and user agents can be spoofed.
+type Fingerprint struct {
+	// IP is the user agent's IP.
+	IP string `json:"ip"`
+
+	// UserAgentHash is the base64url encoded SHA-256 hash of the user agent's
+	// User-Agent header.
+	UserAgentHash string `json:"user_agent_hash"`
+}
+
+// NewFingerprint captures the fingerprint of the user agent which sent the
+// http request.  By default, the IP is the request's remote address.
+//
+// Supported options: WithClientIPHeader
+func NewFingerprint(req *http.Request, opt ...Option) (*Fingerprint, error) {
+	const op = "oidc.NewFingerprint"
+	if req == nil {
+		return nil, fmt.Errorf("%s: http request is nil: %w", op, ErrInvalidParameter)
+	}
+	opts := getFingerprintOpts(opt...)
+	ip := clientIP(req, opts.withClientIPHeader)
+	if ip == nil {
+		return nil, fmt.Errorf("%s: unable to determine the client's IP: %w", op, ErrInvalidParameter)
+	}
+	return &Fingerprint{
+		IP:            ip.String(),
+		UserAgentHash: hashUserAgent(req.UserAgent()),
+	}, nil
+}
+
+// Verify verifies that the http request was sent by the fingerprint's user
+// agent, with the given strictness.  An error wrapping ErrFingerprintMismatch
+// is returned when it wasn't.
+//
+// Supported options: WithClientIPHeader
+func (f *Fingerprint) Verify(req *http.Request, s FingerprintStrictness, opt ...Option) error {
+	const op = "Fingerprint.Verify"
+	if f == nil {
+		return fmt.Errorf("%s: fingerprint is nil: %w", op, ErrInvalidParameter)
+	}
+	if req == nil {
+		return fmt.Errorf("%s: http request is nil: %w", op, ErrInvalidParameter)
+	}
+	if s < FingerprintUserAgent || s > FingerprintStrict {
+		return fmt.Errorf("%s: unknown strictness %d: %w", op, s, ErrInvalidParameter)
+	}
+	opts := getFingerprintOpts(opt...)
+	if subtle.ConstantTimeCompare([]byte(f.UserAgentHash), []byte(hashUserAgent(req.UserAgent()))) != 1 {
+		return fmt.Errorf("%s: user agent doesn't match: %w", op, ErrFingerprintMismatch)
+	}
+	if s == FingerprintUserAgent {
+		return nil
+	}
+	want, got := net.ParseIP(f.IP), clientIP(req, opts.withClientIPHeader)
+	if want == nil || got == nil {
+		return fmt.Errorf("%s: invalid IP: %w", op, ErrFingerprintMismatch)
+	}
+	if s == FingerprintStrict {
+		if !want.Equal(got) {
+			return fmt.Errorf("%s: IP %s doesn't match: %w", op, got, ErrFingerprintMismatch)
+		}
+		return nil
+	}
+	mask := net.CIDRMask(FingerprintIPv6PrefixLen, 8*net.IPv6len)
+	if want.To4() != nil {
+		want, got = want.To4(), got.To4()
+		mask = net.CIDRMask(FingerprintIPv4PrefixLen, 8*net.IPv4len)
+	}
+	if got == nil || !want.Mask(mask).Equal(got.Mask(mask)) {
+		return fmt.Errorf("%s: IP %s isn't in the fingerprint's network: %w", op, clientIP(req, opts.withClientIPHeader), ErrFingerprintMismatch)
+	}
+	return nil
+}
+
+// copy returns a copy of the fingerprint.
+func (f *Fingerprint) copy() *Fingerprint {
+	if f == nil {
+		return nil
+	}
+	cp := *f
+	return &cp
+}
+
+// clientIP returns the IP of the http request's client, which is the first
+// address of the header (when it's not empty and the request has it) or the
+// request's remote address.  It returns nil when the IP is invalid.
+func clientIP(req *http.Request, header string) net.IP {
+	if header != "" {
+		if v := req.Header.Get(header); v != "" {
+			return net.ParseIP(strings.TrimSpace(strings.Split(v, ",")[0]))
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// hashUserAgent returns the base64url encoded SHA-256 hash of the user agent.
+func hashUserAgent(userAgent string) string {
+	sum := sha256.Sum256([]byte(userAgent))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// fingerprintOptions is the set of available options for Fingerprint
+// functions
+type fingerprintOptions struct {
+	withClientIPHeader string
+}
+
+// fingerprintDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func fingerprintDefaults() fingerprintOptions {
+	return fingerprintOptions{}
+}
+
+// getFingerprintOpts gets the fingerprint defaults and applies the opt
+// overrides passed in
+func getFingerprintOpts(opt ...Option) fingerprintOptions {
+	opts := fingerprintDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithClientIPHeader provides an optional header (like X-Forwarded-For) whose
+// first address is the client's IP, which is required when the app is behind
+// a proxy.  The header must be set by a trusted proxy, since it's otherwise
+// set by the client.  When a request doesn't have the header, its remote
+// address is used.
+//
+// Valid for: NewFingerprint and Fingerprint.Verify
+func WithClientIPHeader(header string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*fingerprintOptions); ok {
+			o.withClientIPHeader = header
+		}
+	}
+}
+
+// WithFingerprint optionally binds the request to the fingerprint of the user
+// agent which started its authentication flow (see NewFingerprint), which can
+// be verified by a callback (see callback.WithFingerprintVerification).
+//
+// Option is valid for: Request
+func WithFingerprint(f *Fingerprint) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*reqOptions); ok {
+			o.withFingerprint = f.copy()
+		}
+	}
+}
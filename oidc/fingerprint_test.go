@@ -0,0 +1,152 @@
+package oidc
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFingerprintRequest(remoteAddr, userAgent string, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/callback", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("User-Agent", userAgent)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+func TestNewFingerprint(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		req       *http.Request
+		opts      []Option
+		want      *Fingerprint
+		wantIsErr error
+	}{
+		{
+			name: "remote-addr",
+			req:  testFingerprintRequest("192.0.2.1:1234", "test-agent", nil),
+			want: &Fingerprint{IP: "192.0.2.1", UserAgentHash: hashUserAgent("test-agent")},
+		},
+		{
+			name: "ipv6-remote-addr",
+			req:  testFingerprintRequest("[2001:db8::1]:1234", "test-agent", nil),
+			want: &Fingerprint{IP: "2001:db8::1", UserAgentHash: hashUserAgent("test-agent")},
+		},
+		{
+			name: "client-ip-header",
+			req:  testFingerprintRequest("10.0.0.1:1234", "test-agent", map[string]string{"X-Forwarded-For": "198.51.100.7, 10.0.0.2"}),
+			opts: []Option{WithClientIPHeader("X-Forwarded-For")},
+			want: &Fingerprint{IP: "198.51.100.7", UserAgentHash: hashUserAgent("test-agent")},
+		},
+		{
+			name: "missing-client-ip-header",
+			req:  testFingerprintRequest("10.0.0.1:1234", "test-agent", nil),
+			opts: []Option{WithClientIPHeader("X-Forwarded-For")},
+			want: &Fingerprint{IP: "10.0.0.1", UserAgentHash: hashUserAgent("test-agent")},
+		},
+		{
+			name:      "invalid-ip",
+			req:       testFingerprintRequest("not-an-ip", "test-agent", nil),
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "nil-req",
+			wantIsErr: ErrInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := NewFingerprint(tt.req, tt.opts...)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestFingerprint_Verify(t *testing.T) {
+	t.Parallel()
+	v4, err := NewFingerprint(testFingerprintRequest("192.0.2.1:1234", "test-agent", nil))
+	require.NoError(t, err)
+	v6, err := NewFingerprint(testFingerprintRequest("[2001:db8:0:1::1]:1234", "test-agent", nil))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		fp        *Fingerprint
+		req       *http.Request
+		s         FingerprintStrictness
+		opts      []Option
+		wantIsErr error
+	}{
+		{name: "strict", fp: v4, req: testFingerprintRequest("192.0.2.1:4321", "test-agent", nil), s: FingerprintStrict},
+		{name: "strict-different-ip", fp: v4, req: testFingerprintRequest("192.0.2.2:4321", "test-agent", nil), s: FingerprintStrict, wantIsErr: ErrFingerprintMismatch},
+		{name: "strict-different-agent", fp: v4, req: testFingerprintRequest("192.0.2.1:4321", "other-agent", nil), s: FingerprintStrict, wantIsErr: ErrFingerprintMismatch},
+		{name: "network", fp: v4, req: testFingerprintRequest("192.0.2.200:4321", "test-agent", nil), s: FingerprintNetwork},
+		{name: "network-different-network", fp: v4, req: testFingerprintRequest("192.0.3.1:4321", "test-agent", nil), s: FingerprintNetwork, wantIsErr: ErrFingerprintMismatch},
+		{name: "network-different-family", fp: v4, req: testFingerprintRequest("[2001:db8::1]:4321", "test-agent", nil), s: FingerprintNetwork, wantIsErr: ErrFingerprintMismatch},
+		{name: "network-ipv6", fp: v6, req: testFingerprintRequest("[2001:db8:0:1::ffff]:4321", "test-agent", nil), s: FingerprintNetwork},
+		{name: "network-ipv6-different-network", fp: v6, req: testFingerprintRequest("[2001:db8:0:2::1]:4321", "test-agent", nil), s: FingerprintNetwork, wantIsErr: ErrFingerprintMismatch},
+		{name: "user-agent", fp: v4, req: testFingerprintRequest("203.0.113.1:4321", "test-agent", nil), s: FingerprintUserAgent},
+		{name: "user-agent-different-agent", fp: v4, req: testFingerprintRequest("192.0.2.1:4321", "other-agent", nil), s: FingerprintUserAgent, wantIsErr: ErrFingerprintMismatch},
+		{
+			name: "client-ip-header",
+			fp:   v4,
+			req:  testFingerprintRequest("10.0.0.1:4321", "test-agent", map[string]string{"X-Real-Ip": "192.0.2.1"}),
+			s:    FingerprintStrict,
+			opts: []Option{WithClientIPHeader("X-Real-Ip")},
+		},
+		{name: "unknown-strictness", fp: v4, req: testFingerprintRequest("192.0.2.1:4321", "test-agent", nil), s: 0, wantIsErr: ErrInvalidParameter},
+		{name: "nil-fingerprint", req: testFingerprintRequest("192.0.2.1:4321", "test-agent", nil), s: FingerprintStrict, wantIsErr: ErrInvalidParameter},
+		{name: "nil-req", fp: v4, s: FingerprintStrict, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			err := tt.fp.Verify(tt.req, tt.s, tt.opts...)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+		})
+	}
+}
+
+func Test_WithFingerprint(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	fp := &Fingerprint{IP: "192.0.2.1", UserAgentHash: hashUserAgent("test-agent")}
+	opts := getReqOpts(WithFingerprint(fp))
+	testOpts := reqDefaults()
+	testOpts.withFingerprint = fp
+	assert.Equal(opts, testOpts)
+
+	r, err := NewRequest(time.Minute, "https://redirect", WithFingerprint(fp))
+	require.NoError(err)
+	assert.Equal(fp, r.Fingerprint())
+	// the request's fingerprint can't be modified
+	r.Fingerprint().IP = "203.0.113.1"
+	fp.IP = "203.0.113.1"
+	assert.Equal("192.0.2.1", r.Fingerprint().IP)
+
+	r, err = NewRequest(time.Minute, "https://redirect")
+	require.NoError(err)
+	assert.Nil(r.Fingerprint())
+}
@@ -0,0 +1,177 @@
+package oidc
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// FormPostNoncePlaceholder is replaced with the page's CSP nonce in a policy
+// provided using WithContentSecurityPolicy.
+const FormPostNoncePlaceholder = "{nonce}"
+
+// formPostTmpl is an auto-submitting form, whose script is allowed by a CSP
+// nonce (rather than an inline event handler) and which can be submitted
+// manually when scripts are disabled.
+var formPostTmpl = template.Must(template.New("form_post").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><title>Submit This Form</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+{{range .Params}}<input type="hidden" name="{{.Name}}" id="{{.Name}}" value="{{.Value}}"/>
+{{end}}<noscript>
+<p>Scripts are disabled in your browser, so select Continue to finish signing in.</p>
+<button type="submit">Continue</button>
+</noscript>
+</form>
+<script nonce="{{.Nonce}}">document.forms[0].submit();</script>
+</body>
+</html>`))
+
+// formPostParam is a hidden input of a form_post page.
+type formPostParam struct {
+	Name  string
+	Value string
+}
+
+// WriteFormPost writes an HTML page which automatically submits the params to
+// the action URL using an http POST, like an authentication response using
+// the form_post response mode.  The page is hardened for security reviews:
+//
+//   - its script is allowed by a per-response CSP nonce, rather than an inline
+//     event handler.
+//
+//   - a Content-Security-Policy header only allows the script and submitting
+//     the form to the action URL's origin (see WithContentSecurityPolicy).
+//
+//   - it has a Continue button for user agents with scripts disabled.
+//
+//   - it isn't cached, and it doesn't send a referrer.
+//
+// Supported options: WithContentSecurityPolicy, WithCSPNonce
+//
+// See: https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html
+func WriteFormPost(w http.ResponseWriter, action string, params url.Values, opt ...Option) error {
+	const op = "oidc.WriteFormPost"
+	if w == nil {
+		return fmt.Errorf("%s: response writer is nil: %w", op, ErrNilParameter)
+	}
+	actionURL, err := url.Parse(action)
+	if err != nil || action == "" {
+		return fmt.Errorf("%s: action %q is an invalid URL: %w", op, action, ErrInvalidParameter)
+	}
+	opts := getFormPostOpts(opt...)
+	nonce := opts.withCSPNonce
+	if nonce == "" {
+		if nonce, err = NewID(); err != nil {
+			return fmt.Errorf("%s: unable to generate CSP nonce: %w", op, err)
+		}
+	}
+	policy := defaultFormPostPolicy(actionURL)
+	if opts.withCSP != nil {
+		policy = *opts.withCSP
+	}
+
+	names := make([]string, 0, len(params))
+	for k := range params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	inputs := make([]formPostParam, 0, len(names))
+	for _, k := range names {
+		for _, v := range params[k] {
+			inputs = append(inputs, formPostParam{Name: k, Value: v})
+		}
+	}
+	var body bytes.Buffer
+	data := struct {
+		Action string
+		Params []formPostParam
+		Nonce  string
+	}{
+		Action: action,
+		Params: inputs,
+		Nonce:  nonce,
+	}
+	if err := formPostTmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("%s: unable to render form: %w", op, err)
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	h.Set("Pragma", "no-cache")
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("X-Content-Type-Options", "nosniff")
+	if policy != "" {
+		h.Set("Content-Security-Policy", strings.ReplaceAll(policy, FormPostNoncePlaceholder, nonce))
+	}
+	if _, err := w.Write(body.Bytes()); err != nil {
+		return fmt.Errorf("%s: unable to write form: %w", op, err)
+	}
+	return nil
+}
+
+// defaultFormPostPolicy returns the default Content-Security-Policy of a
+// form_post page, which only allows its nonced script and submitting the form
+// to the action URL's origin.
+func defaultFormPostPolicy(action *url.URL) string {
+	formAction := "'self'"
+	if action.IsAbs() {
+		formAction = action.Scheme + "://" + action.Host
+	}
+	return "default-src 'none'; script-src 'nonce-" + FormPostNoncePlaceholder + "'; form-action " + formAction + "; base-uri 'none'; frame-ancestors 'none'"
+}
+
+// formPostOptions is the set of available options for WriteFormPost
+type formPostOptions struct {
+	withCSP      *string
+	withCSPNonce string
+}
+
+// formPostDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func formPostDefaults() formPostOptions {
+	return formPostOptions{}
+}
+
+// getFormPostOpts gets the WriteFormPost defaults and applies the opt
+// overrides passed in
+func getFormPostOpts(opt ...Option) formPostOptions {
+	opts := formPostDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithContentSecurityPolicy optionally overrides the Content-Security-Policy
+// header of a form_post page.  Any FormPostNoncePlaceholder in the policy is
+// replaced with the page's nonce, so the policy can allow its script (for
+// example: "script-src 'nonce-{nonce}'").  An empty policy omits the header,
+// which should only be used when the app sets its own policy (see
+// WithCSPNonce).
+//
+// Valid for: WriteFormPost
+func WithContentSecurityPolicy(policy string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*formPostOptions); ok {
+			o.withCSP = &policy
+		}
+	}
+}
+
+// WithCSPNonce optionally provides the nonce used to allow a form_post page's
+// script, which is typically the nonce of a Content-Security-Policy set by the
+// app's middleware.  A new random nonce is generated for each page by default.
+//
+// Valid for: WriteFormPost
+func WithCSPNonce(nonce string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*formPostOptions); ok {
+			o.withCSPNonce = nonce
+		}
+	}
+}
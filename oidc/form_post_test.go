@@ -0,0 +1,104 @@
+package oidc
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFormPost(t *testing.T) {
+	t.Parallel()
+	params := url.Values{
+		"state":    {"st_123"},
+		"id_token": {`"><script>alert(1)</script>`},
+	}
+	tests := []struct {
+		name      string
+		action    string
+		opts      []Option
+		wantCSP   string
+		wantNonce string
+		wantIsErr error
+	}{
+		{
+			name:    "default-policy",
+			action:  "https://app.example.com/callback",
+			wantCSP: "default-src 'none'; script-src 'nonce-%s'; form-action https://app.example.com; base-uri 'none'; frame-ancestors 'none'",
+		},
+		{
+			name:    "relative-action",
+			action:  "/callback",
+			wantCSP: "default-src 'none'; script-src 'nonce-%s'; form-action 'self'; base-uri 'none'; frame-ancestors 'none'",
+		},
+		{
+			name:      "custom-policy-and-nonce",
+			action:    "https://app.example.com/callback",
+			opts:      []Option{WithContentSecurityPolicy("script-src 'nonce-{nonce}' 'strict-dynamic'"), WithCSPNonce("app-nonce")},
+			wantCSP:   "script-src 'nonce-%s' 'strict-dynamic'",
+			wantNonce: "app-nonce",
+		},
+		{
+			name:      "without-policy",
+			action:    "https://app.example.com/callback",
+			opts:      []Option{WithContentSecurityPolicy(""), WithCSPNonce("app-nonce")},
+			wantNonce: "app-nonce",
+		},
+		{name: "missing-action", wantIsErr: ErrInvalidParameter},
+		{name: "invalid-action", action: "https://app.example.com/%zz", wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			w := httptest.NewRecorder()
+			err := WriteFormPost(w, tt.action, params, tt.opts...)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			body := w.Body.String()
+
+			const scriptPrefix = `<script nonce="`
+			i := strings.Index(body, scriptPrefix)
+			require.NotEqual(-1, i)
+			nonce := body[i+len(scriptPrefix):]
+			nonce = nonce[:strings.Index(nonce, `"`)]
+			require.NotEmpty(nonce)
+			if tt.wantNonce != "" {
+				assert.Equal(tt.wantNonce, nonce)
+			}
+
+			h := w.Header()
+			assert.Equal("text/html; charset=utf-8", h.Get("Content-Type"))
+			assert.Equal("no-store", h.Get("Cache-Control"))
+			assert.Equal("no-referrer", h.Get("Referrer-Policy"))
+			if tt.wantCSP == "" {
+				assert.Empty(h.Get("Content-Security-Policy"))
+			} else {
+				assert.Equal(strings.Replace(tt.wantCSP, "%s", nonce, 1), h.Get("Content-Security-Policy"))
+			}
+
+			assert.Contains(body, `<form method="post" action="`+tt.action+`">`)
+			assert.Contains(body, `<input type="hidden" name="state" id="state" value="st_123"/>`)
+			assert.NotContains(body, "<script>alert(1)</script>")
+			assert.NotContains(body, "onload")
+			assert.Contains(body, `<noscript>`)
+			assert.Contains(body, `<button type="submit">Continue</button>`)
+		})
+	}
+
+	t.Run("unique-nonces", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		w1, w2 := httptest.NewRecorder(), httptest.NewRecorder()
+		require.NoError(WriteFormPost(w1, "/callback", params))
+		require.NoError(WriteFormPost(w2, "/callback", params))
+		assert.NotEqual(w1.Header().Get("Content-Security-Policy"), w2.Header().Get("Content-Security-Policy"))
+	})
+}
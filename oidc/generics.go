@@ -0,0 +1,62 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/oauth2"
+)
+
+// VerifyIDTokenClaims verifies the IDToken (see Provider.VerifyIDToken) and
+// returns its claims unmarshaled into a T, which is typically a struct with
+// json tags for the claims the caller needs:
+//
+//	type myClaims struct {
+//		Email  string   `json:"email"`
+//		Groups []string `json:"groups"`
+//	}
+//	claims, err := oidc.VerifyIDTokenClaims[myClaims](ctx, p, t, oidcRequest)
+//
+// The claims are only returned when the id_token is successfully verified, and
+// they're unmarshaled from the verified claims, so an encrypted (JWE) id_token
+// is supported.
+func VerifyIDTokenClaims[T any](ctx context.Context, p *Provider, t IDToken, oidcRequest Request) (T, error) {
+	const op = "VerifyIDTokenClaims"
+	var claims T
+	if p == nil {
+		return claims, fmt.Errorf("%s: provider is nil: %w", op, ErrNilParameter)
+	}
+	verified, err := p.VerifyIDToken(ctx, t, oidcRequest)
+	if err != nil {
+		return claims, fmt.Errorf("%s: %w", op, err)
+	}
+	b, err := json.Marshal(verified)
+	if err != nil {
+		return claims, fmt.Errorf("%s: unable to marshal claims: %w", op, err)
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		var zero T
+		return zero, fmt.Errorf("%s: unable to unmarshal claims: %w", op, err)
+	}
+	return claims, nil
+}
+
+// UserInfoClaims gets the UserInfo claims from the provider (see
+// Provider.UserInfo) and returns them unmarshaled into a T.  The WithAudiences
+// option is supported.
+//
+// The claims are only returned when the UserInfo response is successfully
+// verified.
+func UserInfoClaims[T any](ctx context.Context, p *Provider, tokenSource oauth2.TokenSource, validSubject string, opt ...Option) (T, error) {
+	const op = "UserInfoClaims"
+	var claims T
+	if p == nil {
+		return claims, fmt.Errorf("%s: provider is nil: %w", op, ErrNilParameter)
+	}
+	if err := p.UserInfo(ctx, tokenSource, validSubject, &claims, opt...); err != nil {
+		var zero T
+		return zero, fmt.Errorf("%s: %w", op, err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,138 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestVerifyIDTokenClaims(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+	tp.SetCustomClaims(map[string]interface{}{"email": "alice@example.com", "groups": []string{"admin"}})
+	p := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+
+	oidcRequest, err := NewRequest(time.Minute, redirect)
+	require.NoError(t, err)
+	tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+	tk, err := p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+	require.NoError(t, err)
+
+	type testClaims struct {
+		Sub    string   `json:"sub"`
+		Email  string   `json:"email"`
+		Groups []string `json:"groups"`
+	}
+	t.Run("valid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		claims, err := VerifyIDTokenClaims[testClaims](ctx, p, tk.IDToken(), oidcRequest)
+		require.NoError(err)
+		assert.Equal(testClaims{Sub: "alice@example.com", Email: "alice@example.com", Groups: []string{"admin"}}, claims)
+	})
+	t.Run("map", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		claims, err := VerifyIDTokenClaims[map[string]interface{}](ctx, p, tk.IDToken(), oidcRequest)
+		require.NoError(err)
+		assert.Equal("alice@example.com", claims["email"])
+	})
+	t.Run("invalid-nonce", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		otherRequest, err := NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		claims, err := VerifyIDTokenClaims[testClaims](ctx, p, tk.IDToken(), otherRequest)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidNonce), "wanted \"%s\" but got \"%s\"", ErrInvalidNonce, err)
+		assert.Equal(testClaims{}, claims)
+	})
+	t.Run("encrypted", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		priv, _, alg, _ := tp.SigningKeys()
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(err)
+		tc := testNewConfig(t, clientID, "test-client-secret", redirect, tp)
+		tc.IDTokenDecryptionKeys = []DecryptionKey{{Key: rsaKey}}
+		p, err := NewProvider(tc)
+		require.NoError(err)
+		defer p.Done()
+		idToken := testEncryptJWT(t, TestSignJWT(t, priv, alg, map[string]interface{}{
+			"iss":   tp.Addr(),
+			"aud":   clientID,
+			"sub":   "alice@example.com",
+			"email": "alice@example.com",
+			"nonce": oidcRequest.Nonce(),
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}, nil), jose.RSA_OAEP_256, jose.A256GCM, &rsaKey.PublicKey, "")
+		claims, err := VerifyIDTokenClaims[testClaims](ctx, p, idToken, oidcRequest)
+		require.NoError(err)
+		assert.Equal(testClaims{Sub: "alice@example.com", Email: "alice@example.com"}, claims)
+	})
+	t.Run("nil-provider", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := VerifyIDTokenClaims[testClaims](ctx, nil, tk.IDToken(), oidcRequest)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+}
+
+func TestUserInfoClaims(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	p := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+	tp.SetUserInfoReply(map[string]interface{}{
+		"sub":      "alice@example.com",
+		"nickname": "A",
+		"aud":      []string{clientID},
+	})
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{
+		AccessToken: "dummy_access_token",
+		Expiry:      time.Now().Add(10 * time.Second),
+	})
+
+	type testClaims struct {
+		Sub      string `json:"sub"`
+		Nickname string `json:"nickname"`
+	}
+	t.Run("valid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		claims, err := UserInfoClaims[testClaims](ctx, p, tokenSource, "alice@example.com", WithAudiences(clientID))
+		require.NoError(err)
+		assert.Equal(testClaims{Sub: "alice@example.com", Nickname: "A"}, claims)
+	})
+	t.Run("invalid-subject", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		claims, err := UserInfoClaims[testClaims](ctx, p, tokenSource, "bob@example.com")
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidSubject), "wanted \"%s\" but got \"%s\"", ErrInvalidSubject, err)
+		assert.Equal(testClaims{}, claims)
+	})
+	t.Run("invalid-audience", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := UserInfoClaims[testClaims](ctx, p, tokenSource, "alice@example.com", WithAudiences("other-client"))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidAudience), "wanted \"%s\" but got \"%s\"", ErrInvalidAudience, err)
+	})
+	t.Run("nil-provider", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := UserInfoClaims[testClaims](ctx, nil, tokenSource, "alice@example.com")
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+}
@@ -0,0 +1,305 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultGraphURL is the default base URL of the Microsoft Graph API used by a
+// GraphGroupsResolver.
+const DefaultGraphURL = "https://graph.microsoft.com/v1.0"
+
+// maxGraphPages bounds the pages of groups a GraphGroupsResolver will follow,
+// so a misbehaving API can't keep it paging forever.
+const maxGraphPages = 100
+
+// GroupsOverage is Azure AD's groups overage indicator, which replaces the
+// groups claim of an id_token (or access token) when the user is a member of
+// more groups than fit in the token (200 for JWTs).  The app must get the
+// user's groups from the Graph API instead, or group-based authorization
+// silently treats the user as a member of no groups.
+//
+// See: https://learn.microsoft.com/en-us/entra/identity-platform/id-token-claims-reference#groups-overage-claim
+type GroupsOverage struct {
+	// Subject is the token's sub.
+	Subject string
+
+	// ObjectID is the user's object ID (oid), which identifies the user in
+	// the Graph API.
+	ObjectID string
+
+	// TenantID is the user's tenant (tid).
+	TenantID string
+
+	// Endpoint is the groups claim source's endpoint from the token's
+	// _claim_sources, which is empty for the hasgroups indicator of the
+	// implicit flow.  It's typically a deprecated Azure AD Graph endpoint,
+	// so resolvers should prefer the Microsoft Graph API.
+	Endpoint string
+
+	// Token is the token whose claims have the overage, whose access token
+	// can be used to call the Graph API when it was granted a Graph scope
+	// (for example: GroupMember.Read.All).  It's nil when the claims are
+	// checked without a token.
+	Token Token
+}
+
+// GroupsOverageFromClaims returns the groups overage indicator of a token's
+// verified claims: the groups member of its _claim_names (the distributed
+// claim of the authorization code flow) or its hasgroups claim (the implicit
+// flow).  It returns false when the claims don't have an overage.
+func GroupsOverageFromClaims(claims map[string]interface{}) (*GroupsOverage, bool) {
+	var endpoint string
+	var overage bool
+	if names, ok := claims["_claim_names"].(map[string]interface{}); ok {
+		if source, ok := names["groups"].(string); ok {
+			overage = true
+			if sources, ok := claims["_claim_sources"].(map[string]interface{}); ok {
+				if s, ok := sources[source].(map[string]interface{}); ok {
+					endpoint, _ = s["endpoint"].(string)
+				}
+			}
+		}
+	}
+	if hasGroups, ok := claims["hasgroups"].(bool); ok && hasGroups {
+		overage = true
+	}
+	if !overage {
+		return nil, false
+	}
+	o := &GroupsOverage{Endpoint: endpoint}
+	o.Subject, _ = claims["sub"].(string)
+	o.ObjectID, _ = claims["oid"].(string)
+	o.TenantID, _ = claims["tid"].(string)
+	return o, true
+}
+
+// GroupsResolver resolves the full group membership of a user whose token has
+// a GroupsOverage, typically by calling the Graph API (see
+// GraphGroupsResolver).
+type GroupsResolver interface {
+	// ResolveGroups returns the groups of the overage's user.
+	ResolveGroups(ctx context.Context, o *GroupsOverage) ([]string, error)
+}
+
+// GroupsResolverFunc is an adapter which allows a func to be used as a
+// GroupsResolver.
+type GroupsResolverFunc func(ctx context.Context, o *GroupsOverage) ([]string, error)
+
+// ResolveGroups satisfies the GroupsResolver interface.
+func (f GroupsResolverFunc) ResolveGroups(ctx context.Context, o *GroupsOverage) ([]string, error) {
+	return f(ctx, o)
+}
+
+// ResolveGroupsOverage resolves the groups overage of a token's verified
+// claims (see GroupsOverageFromClaims) using the resolver, and merges the
+// resolved groups into the claims' groups claim.  The overage indicators
+// (the groups member of _claim_names and the hasgroups claim) are removed, so
+// the claims can be mapped to the user's identity as if the provider had
+// included every group.  The token is optional, and is provided to the
+// resolver for its Graph API calls.
+//
+// It returns false when the claims don't have an overage, and an error
+// wrapping ErrGroupsResolutionFailed when the resolver fails, in which case
+// the claims aren't modified.
+func ResolveGroupsOverage(ctx context.Context, claims map[string]interface{}, t Token, r GroupsResolver) (bool, error) {
+	const op = "ResolveGroupsOverage"
+	o, ok := GroupsOverageFromClaims(claims)
+	if !ok {
+		return false, nil
+	}
+	if r == nil {
+		return false, fmt.Errorf("%s: claims have a groups overage, but the resolver is nil: %w", op, ErrNilParameter)
+	}
+	o.Token = t
+	groups, err := r.ResolveGroups(ctx, o)
+	if err != nil {
+		return false, fmt.Errorf("%s: %s: %w", op, err, ErrGroupsResolutionFailed)
+	}
+	var merged []interface{}
+	seen := map[string]bool{}
+	add := func(g string) {
+		if g != "" && !seen[g] {
+			seen[g] = true
+			merged = append(merged, g)
+		}
+	}
+	switch existing := claims["groups"].(type) {
+	case []interface{}:
+		for _, g := range existing {
+			if s, ok := g.(string); ok {
+				add(s)
+			}
+		}
+	case []string:
+		for _, g := range existing {
+			add(g)
+		}
+	}
+	for _, g := range groups {
+		add(g)
+	}
+	if merged == nil {
+		merged = []interface{}{}
+	}
+	claims["groups"] = merged
+	delete(claims, "hasgroups")
+	if names, ok := claims["_claim_names"].(map[string]interface{}); ok {
+		delete(names, "groups")
+		if len(names) == 0 {
+			delete(claims, "_claim_names")
+			delete(claims, "_claim_sources")
+		}
+	}
+	return true, nil
+}
+
+// GraphGroupsResolver is a GroupsResolver which gets a user's groups (their
+// object IDs, which is also the format of Azure AD's groups claim) from the
+// Microsoft Graph API's transitiveMemberOf, following its pages.  It uses
+// the GroupsOverage token's access token, which must be granted a Graph scope
+// which can read the user's group memberships (for example:
+// GroupMember.Read.All).
+//
+// See: https://learn.microsoft.com/en-us/graph/api/user-list-transitivememberof
+type GraphGroupsResolver struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewGraphGroupsResolver creates a new GraphGroupsResolver.
+//
+// Supported options: WithGraphClient, WithGraphURL
+func NewGraphGroupsResolver(opt ...Option) (*GraphGroupsResolver, error) {
+	const op = "NewGraphGroupsResolver"
+	opts := getGraphGroupsResolverOpts(opt...)
+	u, err := url.Parse(opts.withURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%s: graph URL %q is not an absolute URL: %w", op, opts.withURL, ErrInvalidParameter)
+	}
+	return &GraphGroupsResolver{
+		client:  opts.withClient,
+		baseURL: strings.TrimSuffix(opts.withURL, "/"),
+	}, nil
+}
+
+// ResolveGroups satisfies the GroupsResolver interface.  The groups of the
+// overage's ObjectID are requested, or the groups of the access token's user
+// (/me) when it doesn't have an ObjectID.  An error wrapping
+// ErrMissingAccessToken is returned when the overage doesn't have a token with
+// an access token.
+func (r *GraphGroupsResolver) ResolveGroups(ctx context.Context, o *GroupsOverage) ([]string, error) {
+	const op = "GraphGroupsResolver.ResolveGroups"
+	if o == nil {
+		return nil, fmt.Errorf("%s: overage is nil: %w", op, ErrNilParameter)
+	}
+	if o.Token == nil || o.Token.AccessToken() == "" {
+		return nil, fmt.Errorf("%s: %w", op, ErrMissingAccessToken)
+	}
+	user := "me"
+	if o.ObjectID != "" {
+		user = "users/" + url.PathEscape(o.ObjectID)
+	}
+	next := r.baseURL + "/" + user + "/transitiveMemberOf/microsoft.graph.group?$select=id&$top=999"
+	var groups []string
+	for page := 0; next != ""; page++ {
+		if page == maxGraphPages {
+			return nil, fmt.Errorf("%s: groups exceed %d pages: %w", op, maxGraphPages, ErrGroupsResolutionFailed)
+		}
+		// the access token must only be sent to the Graph API
+		if !strings.HasPrefix(next, r.baseURL+"/") {
+			return nil, fmt.Errorf("%s: next page %q isn't a graph URL: %w", op, next, ErrGroupsResolutionFailed)
+		}
+		var resp struct {
+			Value []struct {
+				ID string `json:"id"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		if err := r.get(ctx, next, o.Token.AccessToken(), &resp); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		for _, v := range resp.Value {
+			groups = append(groups, v.ID)
+		}
+		next = resp.NextLink
+	}
+	return groups, nil
+}
+
+// get gets a page of the Graph API using the access token.
+func (r *GraphGroupsResolver) get(ctx context.Context, u string, t AccessToken, v interface{}) error {
+	const op = "GraphGroupsResolver.get"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return fmt.Errorf("%s: unable to create request: %w", op, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	req.Header.Set("Accept", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", op, err, ErrGroupsResolutionFailed)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: graph returned %s: %w", op, resp.Status, ErrGroupsResolutionFailed)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, DefaultMaxResponseSize)).Decode(v); err != nil {
+		return fmt.Errorf("%s: unable to decode response: %s: %w", op, err, ErrGroupsResolutionFailed)
+	}
+	return nil
+}
+
+// graphGroupsResolverOptions is the set of available options for the
+// GraphGroupsResolver
+type graphGroupsResolverOptions struct {
+	withClient *http.Client
+	withURL    string
+}
+
+// graphGroupsResolverDefaults is a handy way to get the defaults at runtime
+// and during unit tests.
+func graphGroupsResolverDefaults() graphGroupsResolverOptions {
+	return graphGroupsResolverOptions{
+		withClient: http.DefaultClient,
+		withURL:    DefaultGraphURL,
+	}
+}
+
+// getGraphGroupsResolverOpts gets the GraphGroupsResolver defaults and
+// applies the opt overrides passed in
+func getGraphGroupsResolverOpts(opt ...Option) graphGroupsResolverOptions {
+	opts := graphGroupsResolverDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithGraphClient provides an optional http client for the Graph API
+// requests.  The default is http.DefaultClient.
+//
+// Valid for: GraphGroupsResolver
+func WithGraphClient(c *http.Client) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*graphGroupsResolverOptions); ok && c != nil {
+			o.withClient = c
+		}
+	}
+}
+
+// WithGraphURL provides an optional base URL of the Graph API (for example:
+// a national cloud's https://graph.microsoft.us/v1.0).  The default is
+// DefaultGraphURL.
+//
+// Valid for: GraphGroupsResolver
+func WithGraphURL(u string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*graphGroupsResolverOptions); ok && u != "" {
+			o.withURL = u
+		}
+	}
+}
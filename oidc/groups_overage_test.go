@@ -0,0 +1,175 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestGroupsOverageFromClaims(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   *GroupsOverage
+	}{
+		{
+			name:   "no-overage",
+			claims: map[string]interface{}{"sub": "alice", "groups": []interface{}{"g1"}},
+		},
+		{
+			name: "claim-names",
+			claims: map[string]interface{}{
+				"sub":            "alice",
+				"oid":            "object-id",
+				"tid":            "tenant-id",
+				"_claim_names":   map[string]interface{}{"groups": "src1"},
+				"_claim_sources": map[string]interface{}{"src1": map[string]interface{}{"endpoint": "https://graph.windows.net/tenant-id/users/object-id/getMemberObjects"}},
+			},
+			want: &GroupsOverage{Subject: "alice", ObjectID: "object-id", TenantID: "tenant-id", Endpoint: "https://graph.windows.net/tenant-id/users/object-id/getMemberObjects"},
+		},
+		{
+			name:   "hasgroups",
+			claims: map[string]interface{}{"sub": "alice", "hasgroups": true},
+			want:   &GroupsOverage{Subject: "alice"},
+		},
+		{
+			name:   "other-claim-names",
+			claims: map[string]interface{}{"sub": "alice", "_claim_names": map[string]interface{}{"roles": "src1"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := GroupsOverageFromClaims(tt.claims)
+			assert.Equal(t, tt.want != nil, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResolveGroupsOverage(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tk, err := NewToken("id-token", &oauth2.Token{AccessToken: "graph-token"})
+	require.NoError(t, err)
+	overage := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":            "alice",
+			"oid":            "object-id",
+			"groups":         []interface{}{"g1"},
+			"_claim_names":   map[string]interface{}{"groups": "src1"},
+			"_claim_sources": map[string]interface{}{"src1": map[string]interface{}{"endpoint": "https://graph.windows.net"}},
+		}
+	}
+	resolver := GroupsResolverFunc(func(_ context.Context, o *GroupsOverage) ([]string, error) {
+		if o.Token == nil || o.Token.AccessToken() != "graph-token" || o.ObjectID != "object-id" {
+			return nil, errors.New("unexpected overage")
+		}
+		return []string{"g1", "g2", "g3"}, nil
+	})
+
+	t.Run("resolved", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		claims := overage()
+		resolved, err := ResolveGroupsOverage(ctx, claims, tk, resolver)
+		require.NoError(err)
+		assert.True(resolved)
+		assert.Equal(map[string]interface{}{"sub": "alice", "oid": "object-id", "groups": []interface{}{"g1", "g2", "g3"}}, claims)
+	})
+	t.Run("no-overage", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		claims := map[string]interface{}{"sub": "alice"}
+		resolved, err := ResolveGroupsOverage(ctx, claims, tk, nil)
+		require.NoError(err)
+		assert.False(resolved)
+		assert.Equal(map[string]interface{}{"sub": "alice"}, claims)
+	})
+	t.Run("nil-resolver", func(t *testing.T) {
+		_, err := ResolveGroupsOverage(ctx, overage(), tk, nil)
+		assert.Truef(t, errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+	t.Run("resolver-failed", func(t *testing.T) {
+		assert := assert.New(t)
+		claims := overage()
+		_, err := ResolveGroupsOverage(ctx, claims, nil, resolver)
+		assert.Truef(errors.Is(err, ErrGroupsResolutionFailed), "wanted \"%s\" but got \"%s\"", ErrGroupsResolutionFailed, err)
+		assert.Equal(overage(), claims)
+	})
+}
+
+func TestGraphGroupsResolver(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer graph-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/v1.0/users/object-id/transitiveMemberOf/microsoft.graph.group":
+			assert.Equal(t, "id", req.URL.Query().Get("$select"))
+			fmt.Fprintf(w, `{"value":[{"id":"g1"},{"id":"g2"}],"@odata.nextLink":"%s/v1.0/users/object-id/page2"}`, srvURL)
+		case "/v1.0/users/object-id/page2":
+			_, _ = w.Write([]byte(`{"value":[{"id":"g3"}]}`))
+		case "/v1.0/me/transitiveMemberOf/microsoft.graph.group":
+			_, _ = w.Write([]byte(`{"value":[{"id":"me"}]}`))
+		case "/v1.0/users/evil/transitiveMemberOf/microsoft.graph.group":
+			_, _ = w.Write([]byte(`{"value":[],"@odata.nextLink":"https://evil.example.com/steal"}`))
+		case "/v1.0/users/loop/transitiveMemberOf/microsoft.graph.group":
+			fmt.Fprintf(w, `{"value":[{"id":"g"}],"@odata.nextLink":"%s%s"}`, srvURL, req.URL.RequestURI())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	srvURL = srv.URL
+
+	r, err := NewGraphGroupsResolver(WithGraphClient(srv.Client()), WithGraphURL(srv.URL+"/v1.0/"))
+	require.NoError(t, err)
+	tk, err := NewToken("id-token", &oauth2.Token{AccessToken: "graph-token"})
+	require.NoError(t, err)
+	wrongTk, err := NewToken("id-token", &oauth2.Token{AccessToken: "wrong-token"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		overage *GroupsOverage
+		want    []string
+		wantErr error
+	}{
+		{name: "paged", overage: &GroupsOverage{ObjectID: "object-id", Token: tk}, want: []string{"g1", "g2", "g3"}},
+		{name: "me", overage: &GroupsOverage{Token: tk}, want: []string{"me"}},
+		{name: "nil-overage", wantErr: ErrNilParameter},
+		{name: "missing-token", overage: &GroupsOverage{ObjectID: "object-id"}, wantErr: ErrMissingAccessToken},
+		{name: "unauthorized", overage: &GroupsOverage{ObjectID: "object-id", Token: wrongTk}, wantErr: ErrGroupsResolutionFailed},
+		{name: "foreign-next-link", overage: &GroupsOverage{ObjectID: "evil", Token: tk}, wantErr: ErrGroupsResolutionFailed},
+		{name: "too-many-pages", overage: &GroupsOverage{ObjectID: "loop", Token: tk}, wantErr: ErrGroupsResolutionFailed},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := r.ResolveGroups(ctx, tt.overage)
+			if tt.wantErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantErr), "wanted \"%s\" but got \"%s\"", tt.wantErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+		})
+	}
+	t.Run("invalid-url", func(t *testing.T) {
+		_, err := NewGraphGroupsResolver(WithGraphURL("graph.microsoft.com"))
+		assert.Truef(t, errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
@@ -0,0 +1,212 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// HealthStatus is the result of a provider health check.
+type HealthStatus struct {
+	// Healthy is true when both the issuer's discovery document and its JWKS
+	// were reachable and valid.
+	Healthy bool
+
+	// CheckedAt is when the check began.
+	CheckedAt time.Time
+
+	// DiscoveryLatency is how long the discovery document request took, which
+	// is zero for a config with static ProviderMetadata.
+	DiscoveryLatency time.Duration
+
+	// JWKSLatency is how long the JWKS request took.  It's zero when the JWKS
+	// wasn't requested because the discovery request failed.
+	JWKSLatency time.Duration
+
+	// Err is the reason the check failed, or nil when it's Healthy.
+	Err error
+
+	// LastError is the most recent error reported by any of the provider's
+	// checks, even when the current check is Healthy.
+	LastError error
+
+	// LastErrorAt is when the LastError occurred.
+	LastErrorAt time.Time
+}
+
+// providerHealth holds the provider's most recent health status
+type providerHealth struct {
+	mu      sync.Mutex
+	status  *HealthStatus
+	running bool
+}
+
+// HealthCheck probes the reachability of the provider's discovery document
+// and JWKS, and returns the resulting status.  Unlike the provider's other
+// methods, it always makes http requests (the JWKSCache is not used).  The
+// returned error wraps ErrUnhealthyProvider when the check failed, and the
+// status is returned either way, so it can be reported by readiness endpoints.
+//
+// See Provider.HealthStatus() to get the most recent status without making a
+// request.
+func (p *Provider) HealthCheck(ctx context.Context) (*HealthStatus, error) {
+	const op = "Provider.HealthCheck"
+	config := p.currentConfig()
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	status := &HealthStatus{
+		CheckedAt: config.Now(),
+	}
+	if err := p.healthCheck(ctx, config, status); err != nil {
+		status.Err = fmt.Errorf("%s: %w", op, err)
+	} else {
+		status.Healthy = true
+	}
+
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	if status.Err != nil {
+		status.LastError, status.LastErrorAt = status.Err, status.CheckedAt
+	} else if p.health.status != nil {
+		status.LastError, status.LastErrorAt = p.health.status.LastError, p.health.status.LastErrorAt
+	}
+	p.health.status = status
+	cp := *status
+	return &cp, cp.Err
+}
+
+// healthCheck does the work for HealthCheck and fills in the status latencies
+func (p *Provider) healthCheck(ctx context.Context, config *Config, status *HealthStatus) error {
+	client, err := p.HTTPClient()
+	if err != nil {
+		return fmt.Errorf("unable to create http client: %s: %w", err, ErrUnhealthyProvider)
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURL string `json:"jwks_uri"`
+	}
+	if config.ProviderMetadata != nil {
+		// there's no discovery document to check
+		discovery.JWKSURL = config.ProviderMetadata.JWKSURL
+	} else {
+		start := time.Now()
+		wellKnown := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+		err = healthGet(ctx, p.endpointClient(client, discoveryEndpoint), wellKnown, &discovery)
+		status.DiscoveryLatency = time.Since(start)
+		if err != nil {
+			return fmt.Errorf("discovery request failed: %s: %w", err, ErrUnhealthyProvider)
+		}
+		if discovery.Issuer != config.Issuer {
+			return fmt.Errorf("discovery issuer %s does not match %s: %w", discovery.Issuer, config.Issuer, ErrUnhealthyProvider)
+		}
+		if discovery.JWKSURL == "" {
+			return fmt.Errorf("discovery is missing jwks_uri: %w", ErrUnhealthyProvider)
+		}
+	}
+
+	start := time.Now()
+	var keySet jose.JSONWebKeySet
+	err = healthGet(ctx, p.endpointClient(client, jwksEndpoint), discovery.JWKSURL, &keySet)
+	status.JWKSLatency = time.Since(start)
+	if err != nil {
+		return fmt.Errorf("jwks request failed: %s: %w", err, ErrUnhealthyProvider)
+	}
+	if len(keySet.Keys) == 0 {
+		return fmt.Errorf("jwks has no keys: %w", ErrUnhealthyProvider)
+	}
+	return nil
+}
+
+// healthGet gets the url and decodes its json response into v
+func healthGet(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// HealthStatus returns a copy of the provider's most recent health status or
+// nil if the provider hasn't been checked yet.
+func (p *Provider) HealthStatus() *HealthStatus {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	if p.health.status == nil {
+		return nil
+	}
+	cp := *p.health.status
+	return &cp
+}
+
+// StartHealthChecks starts checking the provider's health in the background
+// every interval.  The first check is made immediately and the checks stop
+// when Provider.Done() or Provider.Close() is called.  Each check is limited
+// to the interval.
+//
+// See Provider.HealthStatus() to get the most recent status.
+func (p *Provider) StartHealthChecks(interval time.Duration) error {
+	const op = "Provider.StartHealthChecks"
+	if interval <= 0 {
+		return fmt.Errorf("%s: interval must be greater than zero: %w", op, ErrInvalidParameter)
+	}
+	// the background activity is tracked while holding mu, so it's either
+	// tracked before the provider is done or not started at all.
+	p.mu.RLock()
+	ctx := p.backgroundCtx
+	if ctx == nil || ctx.Err() != nil {
+		p.mu.RUnlock()
+		return fmt.Errorf("%s: provider is done: %w", op, ErrInvalidParameter)
+	}
+	p.background.Add(1)
+	p.mu.RUnlock()
+
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	if p.health.running {
+		p.background.Done()
+		return fmt.Errorf("%s: health checks are already running: %w", op, ErrInvalidParameter)
+	}
+	p.health.running = true
+
+	go func() {
+		defer p.background.Done()
+		defer func() {
+			p.health.mu.Lock()
+			p.health.running = false
+			p.health.mu.Unlock()
+		}()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			checkCtx, cancel := context.WithTimeout(ctx, interval)
+			_, _ = p.HealthCheck(checkCtx)
+			cancel()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
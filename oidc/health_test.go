@@ -0,0 +1,149 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_HealthCheck(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	p := testNewProvider(t, "client-id", "client-secret", "https://redirect", tp)
+
+	unreachable := testNewConfig(t, "client-id", "client-secret", "https://redirect", tp)
+	unreachable.Issuer = "https://127.0.0.1:1"
+	unreachableProvider, err := NewProvider(unreachable, WithLazyDiscovery())
+	require.NoError(t, err)
+	t.Cleanup(unreachableProvider.Done)
+
+	tests := []struct {
+		name        string
+		p           *Provider
+		disableJWKs bool
+		invalidJWKS bool
+		wantJWKS    bool
+		wantErr     bool
+	}{
+		{
+			name:     "healthy",
+			p:        p,
+			wantJWKS: true,
+		},
+		{
+			name:        "jwks-disabled",
+			p:           p,
+			disableJWKs: true,
+			wantJWKS:    true,
+			wantErr:     true,
+		},
+		{
+			name:        "invalid-jwks",
+			p:           p,
+			invalidJWKS: true,
+			wantJWKS:    true,
+			wantErr:     true,
+		},
+		{
+			name:    "unreachable-issuer",
+			p:       unreachableProvider,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			tp.SetDisableJWKs(tt.disableJWKs)
+			tp.SetInvalidJWKS(tt.invalidJWKS)
+			defer func() {
+				tp.SetDisableJWKs(false)
+				tp.SetInvalidJWKS(false)
+			}()
+			got, err := tt.p.HealthCheck(ctx)
+			require.NotNil(got)
+			assert.False(got.CheckedAt.IsZero())
+			assert.NotZero(got.DiscoveryLatency)
+			if tt.wantJWKS {
+				assert.NotZero(got.JWKSLatency)
+			} else {
+				assert.Zero(got.JWKSLatency)
+			}
+			assert.Equal(got, tt.p.HealthStatus())
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, ErrUnhealthyProvider), "wanted \"%s\" but got \"%s\"", ErrUnhealthyProvider, err)
+				assert.False(got.Healthy)
+				assert.Equal(err, got.Err)
+				assert.Equal(err, got.LastError)
+				return
+			}
+			require.NoError(err)
+			assert.True(got.Healthy)
+			assert.Nil(got.Err)
+		})
+	}
+	t.Run("last-error-retained", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp.SetDisableJWKs(true)
+		_, err := p.HealthCheck(ctx)
+		require.Error(err)
+		tp.SetDisableJWKs(false)
+		got, err := p.HealthCheck(ctx)
+		require.NoError(err)
+		assert.True(got.Healthy)
+		assert.Truef(errors.Is(got.LastError, ErrUnhealthyProvider), "wanted \"%s\" but got \"%s\"", ErrUnhealthyProvider, got.LastError)
+		assert.False(got.LastErrorAt.IsZero())
+	})
+}
+
+func TestProvider_StartHealthChecks(t *testing.T) {
+	t.Parallel()
+	tp := StartTestProvider(t)
+
+	t.Run("invalid-interval", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p := testNewProvider(t, "client-id", "client-secret", "https://redirect", tp)
+		err := p.StartHealthChecks(0)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("done-provider", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p := testNewProvider(t, "client-id", "client-secret", "https://redirect", tp)
+		p.Done()
+		err := p.StartHealthChecks(time.Second)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("valid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p := testNewProvider(t, "client-id", "client-secret", "https://redirect", tp)
+		assert.Nil(p.HealthStatus())
+		require.NoError(p.StartHealthChecks(10 * time.Millisecond))
+
+		err := p.StartHealthChecks(10 * time.Millisecond)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+
+		require.Eventually(func() bool {
+			s := p.HealthStatus()
+			return s != nil && s.Healthy
+		}, 5*time.Second, 10*time.Millisecond)
+		first := p.HealthStatus().CheckedAt
+		require.Eventually(func() bool {
+			return p.HealthStatus().CheckedAt.After(first)
+		}, 5*time.Second, 10*time.Millisecond)
+
+		p.Done()
+		require.Eventually(func() bool {
+			p.health.mu.Lock()
+			defer p.health.mu.Unlock()
+			return !p.health.running
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
@@ -1,9 +1,15 @@
 package oidc
 
 import (
+	"crypto/rand"
 	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
 
 	"github.com/hashicorp/cap/oidc/internal/base62"
+	uuid "github.com/hashicorp/go-uuid"
 )
 
 // DefaultIDLength is the default length for generated IDs, which are used for
@@ -13,20 +19,60 @@ import (
 // https://tools.ietf.org/html/rfc6749#section-10.10
 const DefaultIDLength = 20
 
+// DefaultIDAlphabet is the default alphabet for generated IDs (base62).
+const DefaultIDAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// sortableTimestampBits is the number of bits of the millisecond timestamp of
+// a sortable ID, which (like a ULID) won't overflow until the year 10889.
+const sortableTimestampBits = 48
+
 // NewID generates a ID with an optional prefix.   The ID generated is suitable
 // for a Request's State or Nonce. The ID length will be DefaultIDLen, unless an
 // optional prefix is provided which will add the prefix's length + an
-// underscore.  The WithPrefix, WithLen options are supported.
+// underscore.  The WithPrefix, WithLen, WithEntropy, WithAlphabet,
+// WithSortable, WithNow and WithRandReader options are supported.
+//
+// When the WithSortable option is provided, the ID's random chars are
+// preceded by an encoding of the current time, so IDs sort by the time they
+// were generated (like a ULID).
 //
 // For ID length requirements see:
 // https://tools.ietf.org/html/rfc6749#section-10.10
 func NewID(opt ...Option) (string, error) {
 	const op = "NewID"
 	opts := getIDOpts(opt...)
-	id, err := base62.Random(opts.withLen)
+	if err := validAlphabet(opts.withAlphabet); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	length := opts.withLen
+	if opts.withEntropy > 0 {
+		length = int(math.Ceil(float64(opts.withEntropy) / math.Log2(float64(len(opts.withAlphabet)))))
+	}
+	if length < 1 {
+		return "", fmt.Errorf("%s: id length must be greater than zero: %w", op, ErrInvalidParameter)
+	}
+	reader := opts.withRandReader
+	if reader == nil {
+		reader = rand.Reader
+	}
+	var id string
+	var err error
+	switch opts.withAlphabet {
+	case DefaultIDAlphabet:
+		id, err = base62.RandomWithReader(length, reader)
+	default:
+		id, err = randomString(opts.withAlphabet, length, reader)
+	}
 	if err != nil {
 		return "", fmt.Errorf("%s: unable to generate id: %w", op, err)
 	}
+	if opts.withSortable {
+		now := time.Now
+		if opts.withNowFunc != nil {
+			now = opts.withNowFunc
+		}
+		id = sortableTimestamp(opts.withAlphabet, now()) + id
+	}
 	switch {
 	case opts.withPrefix != "":
 		return fmt.Sprintf("%s_%s", opts.withPrefix, id), nil
@@ -35,17 +81,90 @@ func NewID(opt ...Option) (string, error) {
 	}
 }
 
+// validAlphabet checks that an alphabet has at least 2 chars, which are
+// unique and printable ASCII.
+func validAlphabet(alphabet string) error {
+	const op = "validAlphabet"
+	if len(alphabet) < 2 {
+		return fmt.Errorf("%s: alphabet must have at least 2 chars: %w", op, ErrInvalidParameter)
+	}
+	seen := map[byte]bool{}
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if c < '!' || c > '~' {
+			return fmt.Errorf("%s: alphabet must be printable ASCII: %w", op, ErrInvalidParameter)
+		}
+		if seen[c] {
+			return fmt.Errorf("%s: alphabet has a duplicate char %q: %w", op, c, ErrInvalidParameter)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+// randomString generates a random string of the alphabet's chars using the
+// reader's random bytes.
+func randomString(alphabet string, length int, reader io.Reader) (string, error) {
+	n := len(alphabet)
+	// Avoid bias by only using the values below a multiple of n
+	limit := 256 - 256%n
+	output := make([]byte, 0, length)
+
+	// Request a bit more than length to reduce the chance of needing more than
+	// one batch of random bytes
+	batchSize := length + length/4
+	for {
+		buf, err := uuid.GenerateRandomBytesWithReader(batchSize, reader)
+		if err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) < limit {
+				output = append(output, alphabet[int(b)%n])
+				if len(output) == length {
+					return string(output), nil
+				}
+			}
+		}
+	}
+}
+
+// sortableTimestamp encodes the time's milliseconds using a fixed number of
+// the alphabet's chars.  The chars are sorted, so the encoded timestamps sort
+// by time.
+func sortableTimestamp(alphabet string, t time.Time) string {
+	chars := []byte(alphabet)
+	sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
+	n := uint64(len(chars))
+
+	// the number of chars needed to encode every timestamp
+	width := int(math.Ceil(sortableTimestampBits / math.Log2(float64(n))))
+	ms := uint64(t.Unix()*1000+int64(t.Nanosecond())/int64(time.Millisecond)) & (1<<sortableTimestampBits - 1)
+	output := make([]byte, width)
+	for i := width - 1; i >= 0; i-- {
+		output[i] = chars[ms%n]
+		ms /= n
+	}
+	return string(output)
+}
+
 // idOptions is the set of available options.
 type idOptions struct {
-	withPrefix string
-	withLen    int
+	withPrefix     string
+	withLen        int
+	withEntropy    int
+	withAlphabet   string
+	withSortable   bool
+	withNowFunc    func() time.Time
+	withRandReader io.Reader
 }
 
 // idDefaults is a handy way to get the defaults at runtime and
 // during unit tests.
 func idDefaults() idOptions {
 	return idOptions{
-		withLen: DefaultIDLength,
+		withLen:      DefaultIDLength,
+		withAlphabet: DefaultIDAlphabet,
 	}
 }
 
@@ -69,3 +188,58 @@ func WithPrefix(prefix string) Option {
 		}
 	}
 }
+
+// WithLen provides an optional length for a new ID's random chars, which
+// doesn't include the length of its prefix or its sortable timestamp.
+//
+// Valid for: ID
+func WithLen(l int) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*idOptions); ok {
+			o.withLen = l
+		}
+	}
+}
+
+// WithEntropy provides an optional minimum entropy (in bits) for a new ID's
+// random chars.  The ID's length is determined by the entropy and the size of
+// its alphabet, and the WithLen option is ignored.
+//
+// Valid for: ID
+func WithEntropy(bits int) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*idOptions); ok {
+			o.withEntropy = bits
+		}
+	}
+}
+
+// WithAlphabet provides an optional alphabet for a new ID, which defaults to
+// DefaultIDAlphabet.  The alphabet must have at least 2 chars, which must be
+// unique and printable ASCII.
+//
+// Valid for: ID
+func WithAlphabet(alphabet string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*idOptions); ok {
+			o.withAlphabet = alphabet
+		}
+	}
+}
+
+// WithSortable provides an option to generate a k-sortable ID (like a ULID),
+// which can double as a time-ordered key.  The ID's random chars are preceded
+// by an encoding of the current time's milliseconds (see WithNow), so IDs
+// with the same prefix and alphabet sort by the time they were generated.
+// The timestamp is encoded with the alphabet's chars in byte order, using the
+// number of chars needed for a 48-bit timestamp (9 chars for
+// DefaultIDAlphabet).
+//
+// Valid for: ID
+func WithSortable() Option {
+	return func(o interface{}) {
+		if o, ok := o.(*idOptions); ok {
+			o.withSortable = true
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package oidc
 
 import (
+	"errors"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -10,11 +14,13 @@ import (
 func TestNewID(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
-		name       string
-		opt        []Option
-		wantErr    bool
-		wantPrefix string
-		wantLen    int
+		name         string
+		opt          []Option
+		wantErr      bool
+		wantIsErr    error
+		wantPrefix   string
+		wantLen      int
+		wantAlphabet string
 	}{
 		{
 			name:    "no-prefix",
@@ -26,6 +32,58 @@ func TestNewID(t *testing.T) {
 			wantPrefix: "alice",
 			wantLen:    DefaultIDLength + len("alice_"),
 		},
+		{
+			name:    "with-len",
+			opt:     []Option{WithLen(32)},
+			wantLen: 32,
+		},
+		{
+			name:    "with-entropy",
+			opt:     []Option{WithEntropy(128), WithLen(5)},
+			wantLen: 22,
+		},
+		{
+			name:         "with-alphabet",
+			opt:          []Option{WithAlphabet("0123456789abcdef"), WithEntropy(128)},
+			wantLen:      32,
+			wantAlphabet: "0123456789abcdef",
+		},
+		{
+			name:       "with-sortable",
+			opt:        []Option{WithSortable(), WithPrefix("alice")},
+			wantPrefix: "alice",
+			wantLen:    9 + DefaultIDLength + len("alice_"),
+		},
+		{
+			name:         "with-sortable-alphabet",
+			opt:          []Option{WithSortable(), WithAlphabet("0123456789abcdef")},
+			wantLen:      12 + DefaultIDLength,
+			wantAlphabet: "0123456789abcdef",
+		},
+		{
+			name:      "zero-len",
+			opt:       []Option{WithLen(0)},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "short-alphabet",
+			opt:       []Option{WithAlphabet("a")},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "duplicate-alphabet",
+			opt:       []Option{WithAlphabet("abca")},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "non-printable-alphabet",
+			opt:       []Option{WithAlphabet("ab c")},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -33,6 +91,7 @@ func TestNewID(t *testing.T) {
 			got, err := NewID(tt.opt...)
 			if tt.wantErr {
 				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
 				return
 			}
 			require.NoError(err)
@@ -40,6 +99,11 @@ func TestNewID(t *testing.T) {
 				assert.Containsf(got, tt.wantPrefix, "NewID() = %v and wanted prefix %s", got, tt.wantPrefix)
 			}
 			assert.Equalf(tt.wantLen, len(got), "NewID() = %v, with len of %d and wanted len of %v", got, len(got), tt.wantLen)
+			if tt.wantAlphabet != "" {
+				for _, c := range got {
+					assert.Containsf(tt.wantAlphabet, string(c), "NewID() = %v, with char %q not in alphabet", got, c)
+				}
+			}
 		})
 	}
 }
@@ -52,3 +116,40 @@ func Test_WithPrefix(t *testing.T) {
 	testOpts.withPrefix = "alice"
 	assert.Equal(opts, testOpts)
 }
+
+func Test_WithSortable(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	opts := getIDOpts(WithSortable())
+	testOpts := idDefaults()
+	testOpts.withSortable = true
+	assert.Equal(opts, testOpts)
+
+	start := time.Now()
+	var ids []string
+	for i := 0; i < 50; i++ {
+		// the timestamps must differ by at least a millisecond to be ordered
+		now := start.Add(time.Duration(i) * time.Millisecond)
+		id, err := NewID(WithSortable(), WithPrefix("audit"), WithNow(func() time.Time { return now }))
+		require.NoError(err)
+		ids = append(ids, id)
+	}
+	assert.Truef(sort.StringsAreSorted(ids), "wanted sorted ids: %s", strings.Join(ids, ", "))
+
+	// the timestamp is the same for IDs generated at the same time
+	at := func() time.Time { return start }
+	id1, err := NewID(WithSortable(), WithNow(at))
+	require.NoError(err)
+	id2, err := NewID(WithSortable(), WithNow(at))
+	require.NoError(err)
+	assert.Equal(id1[:9], id2[:9])
+	assert.NotEqual(id1, id2)
+}
+
+func Test_sortableTimestamp(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	assert.Equal("000000000000", sortableTimestamp("fedcba9876543210", time.Unix(0, 0)))
+	assert.Equal("0000000003e8", sortableTimestamp("0123456789abcdef", time.Unix(1, 0)))
+	assert.Equal("ffffffffffff", sortableTimestamp("0123456789abcdef", time.Unix((1<<48-1)/1000, (1<<48-1)%1000*int64(time.Millisecond))))
+}
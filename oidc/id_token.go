@@ -116,30 +116,50 @@ func (t IDToken) verifyHashClaim(claimName string, token string) (bool, error) {
 		return false, fmt.Errorf("%s: id_token signed with algorithm %q: %w", op, sig.Header.Algorithm, ErrUnsupportedAlg)
 	}
 	sigAlgorithm := Alg(sig.Header.Algorithm)
+	if sigAlgorithm == EdDSA {
+		// the hash of an EdDSA signed id_token depends on its curve, which
+		// isn't known, so it can't be verified.
+		return false, nil
+	}
+	actual, err := TokenHash(sigAlgorithm, token)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if actual != tokenHash {
+		switch claimName {
+		case "at_hash":
+			return false, fmt.Errorf("%s: %w", op, ErrInvalidAtHash)
+		case "c_hash":
+			return false, fmt.Errorf("%s: %w", op, ErrInvalidCodeHash)
+		}
+	}
+	return true, nil
+}
 
+// TokenHash computes the value of an id_token's at_hash or c_hash claim for
+// the access_token or authorization code, when the id_token is signed with
+// the alg.  It's the base64url encoding of the left-most half of the token's
+// hash, using the hash function of the alg.  EdDSA isn't supported, since its
+// hash function depends on the key's curve.
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#CodeIDToken
+func TokenHash(alg Alg, token string) (string, error) {
+	const op = "TokenHash"
+	if token == "" {
+		return "", fmt.Errorf("%s: token is empty: %w", op, ErrInvalidParameter)
+	}
 	var h hash.Hash
-	switch sigAlgorithm {
+	switch alg {
 	case RS256, ES256, PS256:
 		h = sha256.New()
 	case RS384, ES384, PS384:
 		h = sha512.New384()
 	case RS512, ES512, PS512:
 		h = sha512.New()
-	case EdDSA:
-		return false, nil
 	default:
-		return false, fmt.Errorf("%s: unsupported signing algorithm %s: %w", op, sigAlgorithm, ErrUnsupportedAlg)
+		return "", fmt.Errorf("%s: unsupported signing algorithm %s: %w", op, alg, ErrUnsupportedAlg)
 	}
 	_, _ = h.Write([]byte(token)) // hash documents that Write will never return an error
 	sum := h.Sum(nil)[:h.Size()/2]
-	actual := base64.RawURLEncoding.EncodeToString(sum)
-	if actual != tokenHash {
-		switch claimName {
-		case "at_hash":
-			return false, fmt.Errorf("%s: %w", op, ErrInvalidAtHash)
-		case "c_hash":
-			return false, fmt.Errorf("%s: %w", op, ErrInvalidCodeHash)
-		}
-	}
-	return true, nil
+	return base64.RawURLEncoding.EncodeToString(sum), nil
 }
@@ -0,0 +1,170 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// DecryptionKey is a private key of the RP, which decrypts the encrypted (JWE)
+// id_tokens issued by a provider that's registered to encrypt them (see the
+// id_token_encrypted_response_alg client metadata).
+type DecryptionKey struct {
+	// KeyID is the key's optional ID, which is matched against the kid header
+	// of an encrypted id_token.  A key without an ID is tried for every
+	// id_token.
+	KeyID string
+
+	// Key is an *rsa.PrivateKey (RSA-OAEP and RSA-OAEP-256), an
+	// *ecdsa.PrivateKey (ECDH-ES and ECDH-ES+A*KW), or a []byte symmetric key
+	// (dir, A*KW and A*GCMKW).
+	Key interface{}
+}
+
+// RedactedDecryptionKey is the redacted string or json for a DecryptionKey's
+// Key.
+const RedactedDecryptionKey = "[REDACTED: decryption key]"
+
+// String will redact the key.
+func (k DecryptionKey) String() string {
+	return fmt.Sprintf("{%s %s}", k.KeyID, RedactedDecryptionKey)
+}
+
+// GoString will redact the key.
+func (k DecryptionKey) GoString() string {
+	return fmt.Sprintf("oidc.DecryptionKey{KeyID:%q, Key:%q}", k.KeyID, RedactedDecryptionKey)
+}
+
+// MarshalJSON will redact the key.
+func (k DecryptionKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		KeyID string `json:"key_id,omitempty"`
+		Key   string `json:"key"`
+	}{KeyID: k.KeyID, Key: RedactedDecryptionKey})
+}
+
+// idTokenKeyAlgorithms are the supported key management algorithms (alg) of
+// encrypted id_tokens.  RSA1_5 isn't supported, since it's vulnerable to
+// padding oracle attacks, and neither are the PBES2 algorithms, which are
+// meant for passwords.
+var idTokenKeyAlgorithms = map[jose.KeyAlgorithm]bool{
+	jose.RSA_OAEP:       true,
+	jose.RSA_OAEP_256:   true,
+	jose.ECDH_ES:        true,
+	jose.ECDH_ES_A128KW: true,
+	jose.ECDH_ES_A192KW: true,
+	jose.ECDH_ES_A256KW: true,
+	jose.DIRECT:         true,
+	jose.A128KW:         true,
+	jose.A192KW:         true,
+	jose.A256KW:         true,
+	jose.A128GCMKW:      true,
+	jose.A192GCMKW:      true,
+	jose.A256GCMKW:      true,
+}
+
+// idTokenContentEncryptions are the supported content encryption algorithms
+// (enc) of encrypted id_tokens.
+var idTokenContentEncryptions = map[jose.ContentEncryption]bool{
+	jose.A128CBC_HS256: true,
+	jose.A192CBC_HS384: true,
+	jose.A256CBC_HS512: true,
+	jose.A128GCM:       true,
+	jose.A192GCM:       true,
+	jose.A256GCM:       true,
+}
+
+// WithIDTokenDecryptionKeys provides optional keys for decrypting encrypted
+// (JWE) id_tokens (see Config.IDTokenDecryptionKeys).
+//
+// Valid for: Config
+func WithIDTokenDecryptionKeys(keys ...DecryptionKey) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withIDTokenDecryptionKeys = keys
+		}
+	}
+}
+
+// validDecryptionKeys checks that the keys have a supported key type.
+func validDecryptionKeys(keys []DecryptionKey) error {
+	const op = "validDecryptionKeys"
+	for i, k := range keys {
+		switch key := k.Key.(type) {
+		case *rsa.PrivateKey:
+			if key == nil {
+				return fmt.Errorf("%s: decryption key %d is nil: %w", op, i, ErrInvalidParameter)
+			}
+		case *ecdsa.PrivateKey:
+			if key == nil {
+				return fmt.Errorf("%s: decryption key %d is nil: %w", op, i, ErrInvalidParameter)
+			}
+		case []byte:
+			if len(key) == 0 {
+				return fmt.Errorf("%s: decryption key %d is empty: %w", op, i, ErrInvalidParameter)
+			}
+		default:
+			return fmt.Errorf("%s: decryption key %d has an unsupported key type %T: %w", op, i, k.Key, ErrInvalidParameter)
+		}
+	}
+	return nil
+}
+
+// encrypted returns true when the id_token is encrypted (a JWE).  A JWE's
+// compact serialization has 5 parts and a JWS has 3.
+func (t IDToken) encrypted() bool {
+	return strings.Count(string(t), ".") == 4
+}
+
+// decryptIDToken returns the signed id_token nested in an encrypted (JWE)
+// id_token, which is decrypted using the keys.  An id_token which isn't
+// encrypted is returned unchanged.  An error wrapping ErrUnsupportedAlg is
+// returned when the id_token's alg or enc isn't supported, and an error
+// wrapping ErrDecryptionFailed when it can't be decrypted by any of the keys.
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#Encryption
+func decryptIDToken(keys []DecryptionKey, t IDToken) (IDToken, error) {
+	const op = "decryptIDToken"
+	if !t.encrypted() {
+		return t, nil
+	}
+	if len(t) > MaxTokenSize {
+		return "", fmt.Errorf("%s: id_token is larger than %d bytes: %w", op, MaxTokenSize, ErrMalformedToken)
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("%s: id_token is encrypted, but the config doesn't have IDTokenDecryptionKeys: %w", op, ErrDecryptionFailed)
+	}
+	jwe, err := jose.ParseEncrypted(string(t))
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to parse encrypted id_token: %s: %w", op, err, ErrMalformedToken)
+	}
+	alg := jose.KeyAlgorithm(jwe.Header.Algorithm)
+	if !idTokenKeyAlgorithms[alg] {
+		return "", fmt.Errorf("%s: id_token key management algorithm %q is not supported: %w", op, alg, ErrUnsupportedAlg)
+	}
+	enc, _ := jwe.Header.ExtraHeaders["enc"].(string)
+	if !idTokenContentEncryptions[jose.ContentEncryption(enc)] {
+		return "", fmt.Errorf("%s: id_token content encryption algorithm %q is not supported: %w", op, enc, ErrUnsupportedAlg)
+	}
+	var plaintext []byte
+	for _, k := range keys {
+		if k.KeyID != "" && jwe.Header.KeyID != "" && k.KeyID != jwe.Header.KeyID {
+			continue
+		}
+		if plaintext, err = jwe.Decrypt(k.Key); err == nil {
+			break
+		}
+	}
+	if plaintext == nil {
+		return "", fmt.Errorf("%s: id_token can't be decrypted with any of the IDTokenDecryptionKeys: %w", op, ErrDecryptionFailed)
+	}
+	// the id_token must be signed and then encrypted (a nested JWT)
+	if strings.Count(string(plaintext), ".") != 2 {
+		return "", fmt.Errorf("%s: decrypted id_token is not a signed JWT: %w", op, ErrTokenNotSigned)
+	}
+	return IDToken(plaintext), nil
+}
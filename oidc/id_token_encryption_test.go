@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestDecryptionKey_redacted(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	k := DecryptionKey{KeyID: "key-1", Key: []byte("bob's symmetric key")}
+	for _, format := range []string{"%s", "%v", "%+v", "%#v"} {
+		got := fmt.Sprintf(format, []DecryptionKey{k})
+		assert.Contains(got, RedactedDecryptionKey)
+		assert.Contains(got, "key-1")
+		assert.NotContains(got, "symmetric", "format %s", format)
+	}
+	got, err := json.Marshal(k)
+	require.NoError(err)
+	assert.Equal(`{"key_id":"key-1","key":"[REDACTED: decryption key]"}`, string(got))
+}
+
+// testEncryptJWT encrypts the plaintext (typically a signed JWT) as a JWE for
+// the recipient's key.
+func testEncryptJWT(t *testing.T, plaintext string, alg jose.KeyAlgorithm, enc jose.ContentEncryption, key interface{}, keyID string) IDToken {
+	t.Helper()
+	e, err := jose.NewEncrypter(enc, jose.Recipient{Algorithm: alg, Key: key, KeyID: keyID}, (&jose.EncrypterOptions{}).WithContentType("JWT"))
+	require.NoError(t, err)
+	obj, err := e.Encrypt([]byte(plaintext))
+	require.NoError(t, err)
+	jwe, err := obj.CompactSerialize()
+	require.NoError(t, err)
+	return IDToken(jwe)
+}
+
+func Test_decryptIDToken(t *testing.T) {
+	t.Parallel()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	_, priv := TestGenerateKeys(t)
+	signed := TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil)
+
+	tests := []struct {
+		name    string
+		keys    []DecryptionKey
+		token   IDToken
+		want    IDToken
+		wantErr error
+	}{
+		{
+			name:  "not-encrypted",
+			token: IDToken(signed),
+			want:  IDToken(signed),
+		},
+		{
+			name:  "rsa-oaep-256",
+			keys:  []DecryptionKey{{Key: rsaKey}},
+			token: testEncryptJWT(t, signed, jose.RSA_OAEP_256, jose.A256GCM, &rsaKey.PublicKey, ""),
+			want:  IDToken(signed),
+		},
+		{
+			name:  "ecdh-es",
+			keys:  []DecryptionKey{{Key: ecKey}},
+			token: testEncryptJWT(t, signed, jose.ECDH_ES_A128KW, jose.A128CBC_HS256, &ecKey.PublicKey, ""),
+			want:  IDToken(signed),
+		},
+		{
+			name:  "dir",
+			keys:  []DecryptionKey{{Key: secret}},
+			token: testEncryptJWT(t, signed, jose.DIRECT, jose.A256GCM, secret, ""),
+			want:  IDToken(signed),
+		},
+		{
+			name:  "key-id",
+			keys:  []DecryptionKey{{KeyID: "old", Key: otherRSAKey}, {KeyID: "new", Key: rsaKey}},
+			token: testEncryptJWT(t, signed, jose.RSA_OAEP, jose.A128GCM, &rsaKey.PublicKey, "new"),
+			want:  IDToken(signed),
+		},
+		{
+			name:  "key-rotation",
+			keys:  []DecryptionKey{{Key: otherRSAKey}, {Key: rsaKey}},
+			token: testEncryptJWT(t, signed, jose.RSA_OAEP, jose.A128GCM, &rsaKey.PublicKey, ""),
+			want:  IDToken(signed),
+		},
+		{
+			name:    "no-keys",
+			token:   testEncryptJWT(t, signed, jose.RSA_OAEP, jose.A128GCM, &rsaKey.PublicKey, ""),
+			wantErr: ErrDecryptionFailed,
+		},
+		{
+			name:    "wrong-key",
+			keys:    []DecryptionKey{{Key: otherRSAKey}},
+			token:   testEncryptJWT(t, signed, jose.RSA_OAEP, jose.A128GCM, &rsaKey.PublicKey, ""),
+			wantErr: ErrDecryptionFailed,
+		},
+		{
+			name:    "unsupported-alg",
+			keys:    []DecryptionKey{{Key: rsaKey}},
+			token:   testEncryptJWT(t, signed, jose.RSA1_5, jose.A128GCM, &rsaKey.PublicKey, ""),
+			wantErr: ErrUnsupportedAlg,
+		},
+		{
+			name:    "not-signed",
+			keys:    []DecryptionKey{{Key: rsaKey}},
+			token:   testEncryptJWT(t, `{"sub":"alice"}`, jose.RSA_OAEP, jose.A128GCM, &rsaKey.PublicKey, ""),
+			wantErr: ErrTokenNotSigned,
+		},
+		{
+			name:    "malformed",
+			keys:    []DecryptionKey{{Key: rsaKey}},
+			token:   "a.b.c.d.e",
+			wantErr: ErrMalformedToken,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := decryptIDToken(tt.keys, tt.token)
+			if tt.wantErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantErr), "wanted \"%s\" but got \"%s\"", tt.wantErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+		})
+	}
+}
+
+func TestProvider_VerifyIDToken_encrypted(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	priv, _, alg, _ := tp.SigningKeys()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	oidcRequest, err := NewRequest(time.Minute, "https://example.com/callback")
+	require.NoError(t, err)
+	idToken := testEncryptJWT(t, TestSignJWT(t, priv, alg, map[string]interface{}{
+		"iss":   tp.Addr(),
+		"aud":   "test-client-id",
+		"sub":   "alice@example.com",
+		"nonce": oidcRequest.Nonce(),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}, nil), jose.RSA_OAEP_256, jose.A256GCM, &rsaKey.PublicKey, "")
+
+	t.Run("decrypted", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tc := testNewConfig(t, "test-client-id", "test-client-secret", "https://example.com/callback", tp)
+		tc.IDTokenDecryptionKeys = []DecryptionKey{{Key: rsaKey}}
+		p, err := NewProvider(tc)
+		require.NoError(err)
+		defer p.Done()
+		claims, err := p.VerifyIDToken(ctx, idToken, oidcRequest)
+		require.NoError(err)
+		assert.Equal("alice@example.com", claims["sub"])
+	})
+	t.Run("no-decryption-keys", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tc := testNewConfig(t, "test-client-id", "test-client-secret", "https://example.com/callback", tp)
+		p, err := NewProvider(tc)
+		require.NoError(err)
+		defer p.Done()
+		_, err = p.VerifyIDToken(ctx, idToken, oidcRequest)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrDecryptionFailed), "wanted \"%s\" but got \"%s\"", ErrDecryptionFailed, err)
+	})
+	t.Run("invalid-key", func(t *testing.T) {
+		tc := testNewConfig(t, "test-client-id", "test-client-secret", "https://example.com/callback", tp)
+		tc.IDTokenDecryptionKeys = []DecryptionKey{{Key: "not-a-key"}}
+		_, err := NewProvider(tc)
+		assert.Truef(t, errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
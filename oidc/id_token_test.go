@@ -345,3 +345,37 @@ func TestIDToken_VerifyAuthorizationCode(t *testing.T) {
 		assert.Falsef(verified, "should not have been verified.")
 	})
 }
+
+func TestTokenHash(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		alg       Alg
+		token     string
+		want      string
+		wantErr   bool
+		wantIsErr error
+	}{
+		// examples from https://openid.net/specs/openid-connect-core-1_0.html#code-id_tokenExample
+		{name: "at_hash", alg: RS256, token: "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y", want: "77QmUPtjPfzWtF2AnpK9RQ"},
+		{name: "c_hash", alg: RS256, token: "Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk", want: "LDktKdoQak3Pk0cnXxCltA"},
+		{name: "ES384", alg: ES384, token: "token", want: "Cm6hANx1qgPTYYSWu3KFaieklEAsPkh3"},
+		{name: "PS512", alg: PS512, token: "token", want: "ImXaughy_DrvFp0Hk2XlkPDLyO1GwqeYTIpkKAPP2Ww"},
+		{name: "empty-token", alg: RS256, wantErr: true, wantIsErr: ErrInvalidParameter},
+		{name: "EdDSA", alg: EdDSA, token: "token", wantErr: true, wantIsErr: ErrUnsupportedAlg},
+		{name: "unknown-alg", alg: "none", token: "token", wantErr: true, wantIsErr: ErrUnsupportedAlg},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := TokenHash(tt.alg, tt.token)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package qrcode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReedSolomon(t *testing.T) {
+	t.Parallel()
+	// the "HELLO WORLD" 1-M example from https://www.thonky.com/qr-code-tutorial/
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	assert.Equal(t, want, reedSolomonRemainder(data, reedSolomonDivisor(10)))
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	// values from the format and version information tables of ISO/IEC 18004
+	assert.Equal(0x77C4, formatBits(Low, 0))
+	assert.Equal(0x5412, formatBits(Medium, 0))
+	assert.Equal(0x355F, formatBits(Quartile, 0))
+	assert.Equal(0x1689, formatBits(High, 0))
+	assert.Equal(0x07C94, versionBits(7))
+	assert.Equal(0x28C69, versionBits(40))
+}
+
+func TestCapacity(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	// byte mode capacities from ISO/IEC 18004
+	tests := []struct {
+		version  int
+		level    Level
+		capacity int
+	}{
+		{1, Low, 17},
+		{1, Medium, 14},
+		{1, Quartile, 11},
+		{1, High, 7},
+		{10, Medium, 213},
+		{40, Low, 2953},
+		{40, Medium, 2331},
+		{40, Quartile, 1663},
+		{40, High, 1273},
+	}
+	for _, tt := range tests {
+		c, err := Encode(bytes.Repeat([]byte("a"), tt.capacity), tt.level)
+		assert.NoError(err)
+		assert.Equalf(tt.version, c.Version, "version %d level %d", tt.version, tt.level)
+		if tt.version < maxVersion {
+			c, err = Encode(bytes.Repeat([]byte("a"), tt.capacity+1), tt.level)
+			assert.NoError(err)
+			assert.Equal(tt.version+1, c.Version)
+			continue
+		}
+		_, err = Encode(bytes.Repeat([]byte("a"), tt.capacity+1), tt.level)
+		assert.Equal(ErrTooLong, err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		data  string
+		level Level
+	}{
+		{"empty", "", Medium},
+		{"short", "https://example.com", Low},
+		{"auth-url", "https://example.com/authorize?client_id=abc&state=st_0123456789&nonce=n_0123456789&redirect_uri=http%3A%2F%2F127.0.0.1%3A8080%2Fcallback", Medium},
+		{"version-7", strings.Repeat("x", 120), Quartile},
+		{"long", strings.Repeat("0123456789", 120), High},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			c, err := Encode([]byte(tt.data), tt.level)
+			require.NoError(err)
+			assert.Equal(c.Version*4+17, c.Size)
+			got := testDecode(t, c, tt.level)
+			assert.Equal(tt.data, string(got))
+		})
+	}
+}
+
+// testDecode decodes a code, which verifies its format bits, version bits,
+// ecc and data.
+func testDecode(t *testing.T, c *Code, level Level) []byte {
+	t.Helper()
+	require := require.New(t)
+
+	// read the first copy of the format bits
+	var bits int
+	for i := 0; i <= 5; i++ {
+		bits |= b2i(c.Dark(8, i)) << uint(i)
+	}
+	bits |= b2i(c.Dark(8, 7)) << 6
+	bits |= b2i(c.Dark(8, 8)) << 7
+	bits |= b2i(c.Dark(7, 8)) << 8
+	for i := 9; i < 15; i++ {
+		bits |= b2i(c.Dark(14-i, 8)) << uint(i)
+	}
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if formatBits(level, m) == bits {
+			mask = m
+		}
+	}
+	require.NotEqual(-1, mask, "format bits don't match the level")
+	require.True(c.Dark(8, c.Size-8), "dark module is missing")
+	if c.Version >= 7 {
+		var v int
+		for i := 0; i < 18; i++ {
+			v |= b2i(c.Dark(c.Size-11+i%3, i/3)) << uint(i)
+		}
+		require.Equal(versionBits(c.Version), v)
+	}
+
+	// unmask a copy and read the codewords
+	u := newCode(c.Version)
+	u.drawFunctionPatterns(level)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if u.isFunction[y][x] {
+				// the function patterns must be identical
+				if y != 8 && x != 8 {
+					require.Equalf(u.modules[y][x], c.modules[y][x], "function module (%d, %d)", x, y)
+				}
+				continue
+			}
+			u.modules[y][x] = c.modules[y][x]
+		}
+	}
+	u.applyMask(mask)
+	var raw []byte
+	var cur, n int
+	for right := u.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < u.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = u.Size - 1 - vert
+				}
+				if u.isFunction[y][x] {
+					continue
+				}
+				cur = cur<<1 | b2i(u.modules[y][x])
+				if n++; n%8 == 0 {
+					raw = append(raw, byte(cur))
+					cur = 0
+				}
+			}
+		}
+	}
+	rawCodewords := numRawDataModules(c.Version) / 8
+	require.Len(raw, rawCodewords)
+
+	// de-interleave the blocks and check their ecc
+	numBlocks := numErrorCorrectionBlocks[level][c.Version]
+	eccLen := eccCodewordsPerBlock[level][c.Version]
+	numShort := numBlocks - rawCodewords%numBlocks
+	shortDataLen := rawCodewords/numBlocks - eccLen
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i <= shortDataLen; i++ {
+		for j := range blocks {
+			if i == shortDataLen && j < numShort {
+				continue
+			}
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+	// the ecc codewords are interleaved too
+	eccs := make([][]byte, numBlocks)
+	for i := 0; i < eccLen; i++ {
+		for j := range eccs {
+			eccs[j] = append(eccs[j], raw[k])
+			k++
+		}
+	}
+	var data []byte
+	divisor := reedSolomonDivisor(eccLen)
+	for j, block := range blocks {
+		require.Equal(reedSolomonRemainder(block, divisor), eccs[j])
+		data = append(data, block...)
+	}
+
+	// parse the byte mode segment
+	var bb bitBuffer
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+	read := func(pos *int, n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			v = v<<1 | b2i(bb[*pos+i])
+		}
+		*pos += n
+		return v
+	}
+	pos := 0
+	require.Equal(0x4, read(&pos, 4))
+	count := read(&pos, charCountBits(c.Version))
+	out := make([]byte, 0, count)
+	for i := 0; i < count; i++ {
+		out = append(out, byte(read(&pos, 8)))
+	}
+	return out
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+/*
+Package interop is an optional conformance-style test harness, which runs
+cap's authorization code flow (with PKCE and offline access), userinfo,
+refresh and logout against real IdPs.  It catches regressions caused by
+provider quirks, which the oidc.TestProvider can't.
+
+The harness's tests are skipped unless providers are configured using
+environment variables.  CAP_INTEROP_PROVIDERS is a comma separated list of
+provider names, and each provider is configured with variables prefixed by
+its upper case name (for example, for "keycloak"):
+
+	CAP_INTEROP_KEYCLOAK_ISSUER         the provider's issuer (required)
+	CAP_INTEROP_KEYCLOAK_CLIENT_ID      the client's ID (required)
+	CAP_INTEROP_KEYCLOAK_CLIENT_SECRET  the client's secret
+	CAP_INTEROP_KEYCLOAK_REDIRECT_URL   the client's registered redirect URL
+	                                    (default: http://127.0.0.1:8250/callback)
+	CAP_INTEROP_KEYCLOAK_USERNAME       the test user's username (required)
+	CAP_INTEROP_KEYCLOAK_PASSWORD       the test user's password (required)
+	CAP_INTEROP_KEYCLOAK_PROFILE        the provider's oidc.Profile (optional)
+	CAP_INTEROP_KEYCLOAK_CA_FILE        a PEM file of the provider's CA certs
+	CAP_INTEROP_KEYCLOAK_USERNAME_FIELD the login form's username field
+	                                    (default: username)
+	CAP_INTEROP_KEYCLOAK_PASSWORD_FIELD the login form's password field
+	                                    (default: password)
+
+The user is logged in by submitting the provider's HTML login forms (nothing
+is rendered, so login pages which require javascript aren't supported), and
+the callback's code is read from the redirect to the redirect URL, which
+doesn't need to be served.  The test user must not require MFA or consent.
+
+StartKeycloak runs a Keycloak container with docker and provisions a realm,
+with a client and a user, via its admin API.  Its Config can be used by any
+integration test which needs a real OIDC implementation, and the harness runs
+against it when CAP_INTEROP_DOCKER is set:
+
+	CAP_INTEROP_DOCKER=1 go test -v -run TestInterop_keycloak ./oidc/interop/...
+
+Alternatively, a long running Keycloak realm for the harness can be run with
+docker compose:
+
+	docker compose -f oidc/interop/testdata/keycloak/docker-compose.yml up -d
+
+	CAP_INTEROP_PROVIDERS=keycloak \
+	CAP_INTEROP_KEYCLOAK_ISSUER=http://127.0.0.1:8080/realms/cap \
+	CAP_INTEROP_KEYCLOAK_CLIENT_ID=cap-interop \
+	CAP_INTEROP_KEYCLOAK_CLIENT_SECRET=cap-interop-secret \
+	CAP_INTEROP_KEYCLOAK_USERNAME=alice \
+	CAP_INTEROP_KEYCLOAK_PASSWORD=alice-password \
+	CAP_INTEROP_KEYCLOAK_PROFILE=keycloak \
+	go test -v ./oidc/interop/...
+
+Okta and Auth0 sandboxes can be tested by registering a web app with the
+redirect URL and a user without MFA (for Auth0, use the Universal Login
+experience, since its login forms don't require javascript).
+*/
+package interop
@@ -0,0 +1,247 @@
+package interop
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// interopProvider is a provider (and its client and test user) configured for
+// the harness.
+type interopProvider struct {
+	name          string
+	issuer        string
+	clientID      string
+	clientSecret  string
+	redirectURL   string
+	username      string
+	password      string
+	profile       oidc.Profile
+	caPEM         string
+	usernameField string
+	passwordField string
+}
+
+// providersFromEnv returns the providers configured by the environment (see
+// the package docs).
+func providersFromEnv(t *testing.T) []interopProvider {
+	t.Helper()
+	var providers []interopProvider
+	for _, name := range strings.Split(os.Getenv("CAP_INTEROP_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "CAP_INTEROP_" + strings.ToUpper(name) + "_"
+		env := func(key, defaultValue string) string {
+			if v := os.Getenv(prefix + key); v != "" {
+				return v
+			}
+			return defaultValue
+		}
+		ip := interopProvider{
+			name:          name,
+			issuer:        env("ISSUER", ""),
+			clientID:      env("CLIENT_ID", ""),
+			clientSecret:  env("CLIENT_SECRET", ""),
+			redirectURL:   env("REDIRECT_URL", defaultRedirectURL),
+			username:      env("USERNAME", ""),
+			password:      env("PASSWORD", ""),
+			profile:       oidc.Profile(env("PROFILE", "")),
+			usernameField: env("USERNAME_FIELD", "username"),
+			passwordField: env("PASSWORD_FIELD", "password"),
+		}
+		for key, v := range map[string]string{"ISSUER": ip.issuer, "CLIENT_ID": ip.clientID, "USERNAME": ip.username, "PASSWORD": ip.password} {
+			if v == "" {
+				t.Fatalf("%s%s is required for interop provider %q", prefix, key, name)
+			}
+		}
+		if caFile := env("CA_FILE", ""); caFile != "" {
+			ca, err := ioutil.ReadFile(caFile)
+			require.NoError(t, err)
+			ip.caPEM = string(ca)
+		}
+		providers = append(providers, ip)
+	}
+	return providers
+}
+
+func TestInterop(t *testing.T) {
+	providers := providersFromEnv(t)
+	if len(providers) == 0 {
+		t.Skip("no interop providers are configured (see CAP_INTEROP_PROVIDERS)")
+	}
+	for _, ip := range providers {
+		ip := ip
+		t.Run(ip.name, func(t *testing.T) {
+			runConformance(t, ip)
+		})
+	}
+}
+
+// TestInterop_devProvider runs the harness against an oidc.DevProvider, which
+// tests the harness itself without a real IdP.
+func TestInterop_devProvider(t *testing.T) {
+	t.Parallel()
+	d, err := oidc.StartDevProvider(
+		oidc.WithDevClient(oidc.DevClient{ID: "cap-interop", Secret: "cap-interop-secret", RedirectURIs: []string{defaultRedirectURL}}),
+		oidc.WithDevUser(oidc.DevUser{Subject: "alice", Claims: map[string]interface{}{"email": "alice@example.com"}}),
+	)
+	require.NoError(t, err)
+	t.Cleanup(d.Stop)
+	runConformance(t, interopProvider{
+		name:          "dev",
+		issuer:        d.Addr(),
+		clientID:      "cap-interop",
+		clientSecret:  "cap-interop-secret",
+		redirectURL:   defaultRedirectURL,
+		username:      "alice",
+		password:      "not-used",
+		caPEM:         d.CACert(),
+		usernameField: "username",
+		passwordField: "password",
+	})
+}
+
+// runConformance runs the code flow, userinfo, refresh, revocation and logout
+// against the provider.  The steps depend on the previous steps, so they stop
+// at the first failure.  Steps for features the provider doesn't advertise
+// are skipped.
+func runConformance(t *testing.T, ip interopProvider) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	allAlgs := []oidc.Alg{oidc.RS256, oidc.RS384, oidc.RS512, oidc.ES256, oidc.ES384, oidc.ES512, oidc.PS256, oidc.PS384, oidc.PS512, oidc.EdDSA}
+	c, err := oidc.NewConfig(ip.issuer, ip.clientID, oidc.ClientSecret(ip.clientSecret), allAlgs, []string{ip.redirectURL},
+		oidc.WithProviderCA(ip.caPEM),
+		oidc.WithProfile(ip.profile),
+	)
+	require.NoError(t, err)
+
+	var p *oidc.Provider
+	var client *http.Client
+	if !t.Run("discovery", func(t *testing.T) {
+		require := require.New(t)
+		p, err = oidc.NewProvider(c)
+		require.NoError(err)
+		t.Cleanup(p.Done)
+		client, err = p.HTTPClient()
+		require.NoError(err)
+		supported, err := p.Supports(ctx, oidc.FeaturePKCES256)
+		require.NoError(err)
+		if !supported {
+			t.Log("the provider doesn't advertise PKCE (S256), which is used anyway")
+		}
+	}) {
+		return
+	}
+
+	var tk *oidc.Tk
+	var sub string
+	if !t.Run("code-flow", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		verifier, err := oidc.NewCodeVerifier()
+		require.NoError(err)
+		r, err := oidc.NewRequest(2*time.Minute, ip.redirectURL,
+			oidc.WithPKCE(verifier),
+			oidc.WithOfflineAccess(),
+			oidc.WithScopes("email", "profile"),
+		)
+		require.NoError(err)
+		authURL, err := p.AuthURL(ctx, r)
+		require.NoError(err)
+
+		q, err := ip.login(ctx, client, authURL)
+		require.NoError(err)
+		require.Emptyf(q.Get("error"), "%s: %s", q.Get("error"), q.Get("error_description"))
+		assert.Equal(r.State(), q.Get("state"))
+
+		tk, err = p.Exchange(ctx, r, q.Get("state"), q.Get("code"))
+		require.NoError(err)
+		var claims map[string]interface{}
+		require.NoError(tk.IDToken().Claims(&claims))
+		sub, _ = claims["sub"].(string)
+		require.NotEmpty(sub)
+		assert.Equal(r.Nonce(), claims["nonce"])
+		if denied := tk.DeniedScopes(); len(denied) > 0 {
+			t.Logf("the provider didn't grant: %s", strings.Join(denied, " "))
+		}
+	}) {
+		return
+	}
+
+	t.Run("userinfo", func(t *testing.T) {
+		require := require.New(t)
+		if supported, err := p.Supports(ctx, oidc.FeatureUserInfo); err != nil || !supported {
+			t.Skip("the provider doesn't advertise a userinfo_endpoint")
+		}
+		var claims map[string]interface{}
+		require.NoError(p.UserInfo(ctx, tk.StaticTokenSource(), sub, &claims))
+		require.Equal(sub, claims["sub"])
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		if !tk.RefreshTokenGranted() {
+			t.Skip("the provider didn't grant a refresh_token")
+		}
+		refreshed, err := p.RefreshToken(ctx, tk)
+		require.NoError(err)
+		assert.True(refreshed.Valid())
+		var claims map[string]interface{}
+		require.NoError(refreshed.IDToken().Claims(&claims))
+		assert.Equal(sub, claims["sub"])
+		tk = refreshed
+	})
+
+	t.Run("revocation", func(t *testing.T) {
+		require := require.New(t)
+		if supported, err := p.Supports(ctx, oidc.FeatureRevocation); err != nil || !supported {
+			t.Skip("the provider doesn't advertise a revocation_endpoint")
+		}
+		if !tk.RefreshTokenGranted() {
+			t.Skip("the provider didn't grant a refresh_token")
+		}
+		// the refresh_token is revoked by closing another provider, so p can
+		// still be used to verify the revocation
+		rp, err := oidc.NewProvider(c)
+		require.NoError(err)
+		require.NoError(rp.Close(ctx, oidc.WithRevokeRefreshTokens(tk.RefreshToken())))
+		_, err = p.RefreshToken(ctx, tk)
+		require.Error(err)
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		require := require.New(t)
+		if supported, err := p.Supports(ctx, oidc.FeatureEndSession); err != nil || !supported {
+			t.Skip("the provider doesn't advertise an end_session_endpoint")
+		}
+		var discovery struct {
+			EndSessionEndpoint string `json:"end_session_endpoint"`
+		}
+		resp, err := client.Get(strings.TrimSuffix(c.Issuer, "/") + "/.well-known/openid-configuration")
+		require.NoError(err)
+		defer resp.Body.Close()
+		require.NoError(json.NewDecoder(resp.Body).Decode(&discovery))
+
+		u, err := url.Parse(discovery.EndSessionEndpoint)
+		require.NoError(err)
+		q := u.Query()
+		q.Set("id_token_hint", string(tk.IDToken()))
+		q.Set("client_id", ip.clientID)
+		u.RawQuery = q.Encode()
+		logoutResp, err := client.Get(u.String())
+		require.NoError(err)
+		defer logoutResp.Body.Close()
+		require.Lessf(logoutResp.StatusCode, http.StatusBadRequest, "logout failed: %s", logoutResp.Status)
+	})
+}
@@ -0,0 +1,379 @@
+package interop
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// DefaultKeycloakImage is the default docker image of a Keycloak.
+	DefaultKeycloakImage = "quay.io/keycloak/keycloak:24.0"
+
+	// defaultRedirectURL is the default redirect URL of an interop provider's
+	// client.
+	defaultRedirectURL = "http://127.0.0.1:8250/callback"
+
+	// keycloakAdmin is the username and password of the Keycloak's admin.
+	keycloakAdmin = "admin"
+)
+
+// SkipT defines a single function interface for a testing.Skip(...).
+type SkipT interface{ Skip(args ...interface{}) }
+
+// Keycloak is a Keycloak container, with a realm which has a confidential
+// client and a user for tests.
+type Keycloak struct {
+	containerID string
+	addr        string
+
+	realm        string
+	clientID     string
+	clientSecret string
+	redirectURLs []string
+	username     string
+	password     string
+
+	t oidc.TestingT
+}
+
+// StartKeycloak runs a Keycloak container with docker, provisions a realm with
+// a confidential client and a user via its admin API, and returns it once the
+// realm is ready.  The container is removed when the test and all it's
+// subtests complete via a registered function with t.Cleanup(...).  When t
+// doesn't support Cleanup (see oidc.CleanupT), the caller must Stop() the
+// Keycloak.
+//
+// When docker isn't installed, the test is skipped (see SkipT) or fails when
+// t doesn't support Skip.  Pulling the image and starting Keycloak can take a
+// while, so the caller should guard its tests.
+//
+// Supported options: WithKeycloakImage, WithKeycloakRealm,
+// WithKeycloakClient, WithKeycloakUser, WithKeycloakStartTimeout
+func StartKeycloak(t oidc.TestingT, opt ...oidc.Option) *Keycloak {
+	if v, ok := t.(oidc.HelperT); ok {
+		v.Helper()
+	}
+	require := require.New(t)
+	opts := getKeycloakOpts(opt...)
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		if v, ok := t.(SkipT); ok {
+			v.Skip("docker is required to start a Keycloak")
+		}
+		require.FailNow("docker is required to start a Keycloak")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.withStartTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "docker", "run", "--detach", "--rm",
+		"--publish", "127.0.0.1::8080",
+		"--env", "KEYCLOAK_ADMIN="+keycloakAdmin,
+		"--env", "KEYCLOAK_ADMIN_PASSWORD="+keycloakAdmin,
+		"--env", "KC_BOOTSTRAP_ADMIN_USERNAME="+keycloakAdmin,
+		"--env", "KC_BOOTSTRAP_ADMIN_PASSWORD="+keycloakAdmin,
+		opts.withImage, "start-dev",
+	).Output()
+	require.NoErrorf(err, "unable to run %s: %s", opts.withImage, exitErrorOutput(err))
+	k := &Keycloak{
+		containerID:  strings.TrimSpace(string(out)),
+		realm:        opts.withRealm,
+		clientID:     opts.withClientID,
+		clientSecret: opts.withClientSecret,
+		redirectURLs: opts.withRedirectURLs,
+		username:     opts.withUsername,
+		password:     opts.withPassword,
+		t:            t,
+	}
+	if c, ok := t.(oidc.CleanupT); ok {
+		c.Cleanup(k.Stop)
+	}
+
+	out, err = exec.CommandContext(ctx, "docker", "port", k.containerID, "8080/tcp").Output()
+	require.NoErrorf(err, "unable to get the Keycloak's port: %s", exitErrorOutput(err))
+	// docker may list a port per IP family, and the first one is used
+	hostPort := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	k.addr = "http://" + hostPort
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	require.NoError(waitForKeycloak(ctx, client, k.addr))
+	require.NoError(k.provision(ctx, client))
+	return k
+}
+
+// Stop removes the Keycloak's container.
+func (k *Keycloak) Stop() {
+	if k.containerID == "" {
+		return
+	}
+	_ = exec.Command("docker", "rm", "--force", k.containerID).Run()
+	k.containerID = ""
+}
+
+// Addr returns the Keycloak's base URL.
+func (k *Keycloak) Addr() string { return k.addr }
+
+// Issuer returns the issuer of the Keycloak's realm.
+func (k *Keycloak) Issuer() string { return k.addr + "/realms/" + url.PathEscape(k.realm) }
+
+// ClientCreds returns the ID and secret of the realm's client.
+func (k *Keycloak) ClientCreds() (clientID, clientSecret string) {
+	return k.clientID, k.clientSecret
+}
+
+// User returns the username and password of the realm's user.
+func (k *Keycloak) User() (username, password string) { return k.username, k.password }
+
+// Config returns a config for the realm's client, using the realm's issuer,
+// the client's redirect URLs, RS256 and the Keycloak profile.  Options are
+// passed to oidc.NewConfig.
+func (k *Keycloak) Config(opt ...oidc.Option) *oidc.Config {
+	if v, ok := k.t.(oidc.HelperT); ok {
+		v.Helper()
+	}
+	opt = append([]oidc.Option{oidc.WithProfile(oidc.ProfileKeycloak)}, opt...)
+	c, err := oidc.NewConfig(k.Issuer(), k.clientID, oidc.ClientSecret(k.clientSecret), []oidc.Alg{oidc.RS256}, k.redirectURLs, opt...)
+	require.NoError(k.t, err)
+	return c
+}
+
+// waitForKeycloak polls the Keycloak's master realm until it's ready.
+func waitForKeycloak(ctx context.Context, client *http.Client, addr string) error {
+	const op = "waitForKeycloak"
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		req, err := http.NewRequest(http.MethodGet, addr+"/realms/master", nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if resp, err := client.Do(req.WithContext(ctx)); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s: Keycloak isn't ready: %w", op, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// provision creates the realm, with its client and user, using the admin
+// API.
+func (k *Keycloak) provision(ctx context.Context, client *http.Client) error {
+	const op = "Keycloak.provision"
+	form := url.Values{
+		"grant_type": {"password"},
+		"client_id":  {"admin-cli"},
+		"username":   {keycloakAdmin},
+		"password":   {keycloakAdmin},
+	}
+	req, err := http.NewRequest(http.MethodPost, k.addr+"/realms/master/protocol/openid-connect/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var tk struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := keycloakDo(ctx, client, req, &tk); err != nil {
+		return fmt.Errorf("%s: unable to get an admin token: %w", op, err)
+	}
+
+	realm, err := json.Marshal(k.realmRepresentation())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req, err = http.NewRequest(http.MethodPost, k.addr+"/admin/realms", bytes.NewReader(realm))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tk.AccessToken)
+	if err := keycloakDo(ctx, client, req, nil); err != nil {
+		return fmt.Errorf("%s: unable to create realm %q: %w", op, k.realm, err)
+	}
+	return nil
+}
+
+// realmRepresentation returns the admin API's representation of the realm,
+// with its client and user.  The user has the profile's required attributes,
+// so Keycloak doesn't ask for them during logins.
+func (k *Keycloak) realmRepresentation() map[string]interface{} {
+	return map[string]interface{}{
+		"realm":   k.realm,
+		"enabled": true,
+		"clients": []map[string]interface{}{
+			{
+				"clientId":                  k.clientID,
+				"secret":                    k.clientSecret,
+				"enabled":                   true,
+				"publicClient":              false,
+				"standardFlowEnabled":       true,
+				"directAccessGrantsEnabled": false,
+				"redirectUris":              k.redirectURLs,
+				"attributes": map[string]string{
+					"pkce.code.challenge.method": "S256",
+					"post.logout.redirect.uris":  "+",
+				},
+			},
+		},
+		"users": []map[string]interface{}{
+			{
+				"username":      k.username,
+				"enabled":       true,
+				"email":         k.username + "@example.com",
+				"emailVerified": true,
+				"firstName":     k.username,
+				"lastName":      "Test",
+				"credentials": []map[string]interface{}{
+					{"type": "password", "value": k.password, "temporary": false},
+				},
+			},
+		},
+	}
+}
+
+// keycloakDo sends the admin API request and unmarshals a successful
+// response's body into v, when v isn't nil.
+func keycloakDo(ctx context.Context, client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
+
+// exitErrorOutput returns the stderr of a failed command, if any.
+func exitErrorOutput(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return strings.TrimSpace(string(exitErr.Stderr))
+	}
+	return ""
+}
+
+// keycloakOptions is the set of available options for StartKeycloak
+type keycloakOptions struct {
+	withImage        string
+	withRealm        string
+	withClientID     string
+	withClientSecret string
+	withRedirectURLs []string
+	withUsername     string
+	withPassword     string
+	withStartTimeout time.Duration
+}
+
+// keycloakDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func keycloakDefaults() keycloakOptions {
+	return keycloakOptions{
+		withImage:        DefaultKeycloakImage,
+		withRealm:        "cap",
+		withClientID:     "cap-interop",
+		withClientSecret: "cap-interop-secret",
+		withRedirectURLs: []string{defaultRedirectURL},
+		withUsername:     "alice",
+		withPassword:     "alice-password",
+		withStartTimeout: 3 * time.Minute,
+	}
+}
+
+// getKeycloakOpts gets the keycloak defaults and applies the opt overrides
+// passed in
+func getKeycloakOpts(opt ...oidc.Option) keycloakOptions {
+	opts := keycloakDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithKeycloakImage provides an optional docker image for the Keycloak.  The
+// default is DefaultKeycloakImage.
+//
+// Valid for: StartKeycloak
+func WithKeycloakImage(image string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*keycloakOptions); ok && image != "" {
+			o.withImage = image
+		}
+	}
+}
+
+// WithKeycloakRealm provides an optional name for the provisioned realm.  The
+// default is "cap".
+//
+// Valid for: StartKeycloak
+func WithKeycloakRealm(realm string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*keycloakOptions); ok && realm != "" {
+			o.withRealm = realm
+		}
+	}
+}
+
+// WithKeycloakClient provides an optional ID, secret and redirect URLs for
+// the realm's confidential client.  The default is "cap-interop" with the
+// secret "cap-interop-secret" and the redirect URL
+// http://127.0.0.1:8250/callback.
+//
+// Valid for: StartKeycloak
+func WithKeycloakClient(clientID, clientSecret string, redirectURLs ...string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*keycloakOptions); ok {
+			o.withClientID = clientID
+			o.withClientSecret = clientSecret
+			if len(redirectURLs) > 0 {
+				o.withRedirectURLs = redirectURLs
+			}
+		}
+	}
+}
+
+// WithKeycloakUser provides an optional username and password for the
+// realm's user.  The default is "alice" with the password "alice-password".
+//
+// Valid for: StartKeycloak
+func WithKeycloakUser(username, password string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*keycloakOptions); ok {
+			o.withUsername = username
+			o.withPassword = password
+		}
+	}
+}
+
+// WithKeycloakStartTimeout provides an optional timeout for starting the
+// Keycloak, which includes pulling its image.  The default is 3 minutes.
+//
+// Valid for: StartKeycloak
+func WithKeycloakStartTimeout(d time.Duration) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*keycloakOptions); ok && d > 0 {
+			o.withStartTimeout = d
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package interop
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestInterop_keycloak runs the harness against a Keycloak container, when
+// CAP_INTEROP_DOCKER is set.
+func TestInterop_keycloak(t *testing.T) {
+	if os.Getenv("CAP_INTEROP_DOCKER") == "" {
+		t.Skip("CAP_INTEROP_DOCKER isn't set")
+	}
+	k := StartKeycloak(t)
+	clientID, clientSecret := k.ClientCreds()
+	username, password := k.User()
+	c := k.Config()
+	runConformance(t, interopProvider{
+		name:          "keycloak",
+		issuer:        k.Issuer(),
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		redirectURL:   c.AllowedRedirectURLs[0],
+		username:      username,
+		password:      password,
+		profile:       c.Profile,
+		usernameField: "username",
+		passwordField: "password",
+	})
+}
+
+func TestKeycloak_provision(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		realmReply int
+		wantErrStr string
+	}{
+		{name: "valid", realmReply: http.StatusCreated},
+		{name: "realm-exists", realmReply: http.StatusConflict, wantErrStr: `unable to create realm "test-realm": 409 Conflict`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			var gotRealm map[string]interface{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/realms/master/protocol/openid-connect/token":
+					if req.FormValue("grant_type") != "password" || req.FormValue("client_id") != "admin-cli" ||
+						req.FormValue("username") != keycloakAdmin || req.FormValue("password") != keycloakAdmin {
+						http.Error(w, "invalid admin creds", http.StatusUnauthorized)
+						return
+					}
+					_, _ = w.Write([]byte(`{"access_token":"admin-token"}`))
+				case "/admin/realms":
+					if req.Header.Get("Authorization") != "Bearer admin-token" {
+						http.Error(w, "invalid token", http.StatusUnauthorized)
+						return
+					}
+					if err := json.NewDecoder(req.Body).Decode(&gotRealm); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					w.WriteHeader(tt.realmReply)
+				default:
+					http.NotFound(w, req)
+				}
+			}))
+			defer srv.Close()
+
+			k := &Keycloak{
+				addr:         srv.URL,
+				realm:        "test-realm",
+				clientID:     "test-client",
+				clientSecret: "test-secret",
+				redirectURLs: []string{"http://127.0.0.1/callback"},
+				username:     "bob",
+				password:     "bob-password",
+				t:            t,
+			}
+			err := k.provision(context.Background(), srv.Client())
+			if tt.wantErrStr != "" {
+				require.Error(err)
+				assert.Contains(err.Error(), tt.wantErrStr)
+				return
+			}
+			require.NoError(err)
+			assert.Equal("test-realm", gotRealm["realm"])
+			client := gotRealm["clients"].([]interface{})[0].(map[string]interface{})
+			assert.Equal("test-client", client["clientId"])
+			assert.Equal("test-secret", client["secret"])
+			assert.Equal([]interface{}{"http://127.0.0.1/callback"}, client["redirectUris"])
+			user := gotRealm["users"].([]interface{})[0].(map[string]interface{})
+			assert.Equal("bob", user["username"])
+			assert.Equal("bob@example.com", user["email"])
+			creds := user["credentials"].([]interface{})[0].(map[string]interface{})
+			assert.Equal("bob-password", creds["value"])
+
+			assert.Equal(srv.URL+"/realms/test-realm", k.Issuer())
+			c := k.Config()
+			assert.Equal("test-client", c.ClientID)
+			assert.Equal([]string{"http://127.0.0.1/callback"}, c.AllowedRedirectURLs)
+		})
+	}
+}
+
+func Test_waitForKeycloak(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if requests < 2 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"realm":"master"}`))
+	}))
+	defer srv.Close()
+	require.NoError(waitForKeycloak(context.Background(), srv.Client(), srv.URL))
+	assert.Equal(2, requests)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := waitForKeycloak(ctx, srv.Client(), "http://127.0.0.1:0")
+	require.Error(err)
+	assert.Contains(err.Error(), "Keycloak isn't ready")
+}
+
+func Test_getKeycloakOpts(t *testing.T) {
+	t.Parallel()
+	t.Run("defaults", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal(keycloakDefaults(), getKeycloakOpts())
+	})
+	t.Run("WithKeycloakImage", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal("keycloak:test", getKeycloakOpts(WithKeycloakImage("keycloak:test")).withImage)
+		assert.Equal(DefaultKeycloakImage, getKeycloakOpts(WithKeycloakImage("")).withImage)
+	})
+	t.Run("WithKeycloakRealm", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal("test-realm", getKeycloakOpts(WithKeycloakRealm("test-realm")).withRealm)
+	})
+	t.Run("WithKeycloakClient", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := getKeycloakOpts(WithKeycloakClient("test-client", "test-secret", "http://127.0.0.1/callback"))
+		testOpts := keycloakDefaults()
+		testOpts.withClientID = "test-client"
+		testOpts.withClientSecret = "test-secret"
+		testOpts.withRedirectURLs = []string{"http://127.0.0.1/callback"}
+		assert.Equal(testOpts, opts)
+		assert.Equal([]string{defaultRedirectURL}, getKeycloakOpts(WithKeycloakClient("test-client", "test-secret")).withRedirectURLs)
+	})
+	t.Run("WithKeycloakUser", func(t *testing.T) {
+		assert := assert.New(t)
+		opts := getKeycloakOpts(WithKeycloakUser("bob", "bob-password"))
+		assert.Equal("bob", opts.withUsername)
+		assert.Equal("bob-password", opts.withPassword)
+	})
+	t.Run("WithKeycloakStartTimeout", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.Equal(time.Minute, getKeycloakOpts(WithKeycloakStartTimeout(time.Minute)).withStartTimeout)
+		assert.Equal(keycloakDefaults().withStartTimeout, getKeycloakOpts(WithKeycloakStartTimeout(0)).withStartTimeout)
+	})
+}
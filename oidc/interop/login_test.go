@@ -0,0 +1,215 @@
+package interop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxLoginForms is the maximum number of login forms submitted during a login,
+// which allows for identifier-first logins (a username form followed by a
+// password form).
+const maxLoginForms = 5
+
+// login follows the authURL and submits the provider's login forms with the
+// user's credentials, until the provider redirects to the redirect URL.  It
+// returns the redirect's query.  The client is copied, so the login's cookies
+// aren't shared with other logins.
+func (ip interopProvider) login(ctx context.Context, client *http.Client, authURL string) (url.Values, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	c := *client
+	c.Jar = jar
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if strings.HasPrefix(req.URL.String(), ip.redirectURL) {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodGet, authURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < maxLoginForms; i++ {
+		resp, err := c.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if location := resp.Header.Get("Location"); strings.HasPrefix(location, ip.redirectURL) {
+			resp.Body.Close()
+			u, err := url.Parse(location)
+			if err != nil {
+				return nil, err
+			}
+			return u.Query(), nil
+		}
+		req, err = ip.loginForm(resp)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("the provider didn't redirect after %d login forms", maxLoginForms)
+}
+
+// loginForm returns the request which submits the login form of the
+// response's page.  The login form is the first form with a username or
+// password field, which are set to the user's credentials.  The form's other
+// fields keep their values.
+func (ip interopProvider) loginForm(resp *http.Response) (*http.Request, error) {
+	root, err := html.Parse(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the login page: %w", err)
+	}
+	isField := func(name string) bool { return name == ip.usernameField || name == ip.passwordField }
+	form, ok := scrape.Find(root, func(n *html.Node) bool {
+		if n.DataAtom != atom.Form {
+			return false
+		}
+		_, ok := scrape.Find(n, func(in *html.Node) bool { return in.DataAtom == atom.Input && isField(scrape.Attr(in, "name")) })
+		return ok
+	})
+	if !ok {
+		title := ""
+		if n, ok := scrape.Find(root, scrape.ByTag(atom.Title)); ok {
+			title = scrape.Text(n)
+		}
+		return nil, fmt.Errorf("the page (%s %q) doesn't have a login form", resp.Status, title)
+	}
+
+	values := url.Values{}
+	for _, in := range scrape.FindAll(form, scrape.ByTag(atom.Input)) {
+		name := scrape.Attr(in, "name")
+		switch {
+		case name == "":
+		case name == ip.usernameField:
+			values.Set(name, ip.username)
+		case name == ip.passwordField:
+			values.Set(name, ip.password)
+		case scrape.Attr(in, "type") == "submit", scrape.Attr(in, "type") == "checkbox" && !hasAttr(in, "checked"):
+		default:
+			values.Add(name, scrape.Attr(in, "value"))
+		}
+	}
+	// the first named submit button is the one which is pressed
+	if button, ok := scrape.Find(form, func(n *html.Node) bool {
+		return (n.DataAtom == atom.Button || n.DataAtom == atom.Input) && scrape.Attr(n, "type") == "submit" && scrape.Attr(n, "name") != ""
+	}); ok {
+		values.Set(scrape.Attr(button, "name"), scrape.Attr(button, "value"))
+	}
+
+	action, err := resp.Request.URL.Parse(scrape.Attr(form, "action"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid login form action: %w", err)
+	}
+	if strings.EqualFold(scrape.Attr(form, "method"), http.MethodPost) {
+		req, err := http.NewRequest(http.MethodPost, action.String(), strings.NewReader(values.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}
+	action.RawQuery = values.Encode()
+	return http.NewRequest(http.MethodGet, action.String(), nil)
+}
+
+// hasAttr returns true when the node has the attribute.
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_login(t *testing.T) {
+	t.Parallel()
+	const redirectURL = "http://127.0.0.1:8250/callback"
+	// srv is an identifier-first login, which sets a cookie with the username
+	// and has relative form actions, hidden fields and submit buttons.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_ = req.ParseForm()
+		switch req.URL.Path {
+		case "/authorize":
+			fmt.Fprintf(w, `<html><head><title>Login</title></head><body>
+<form action="/logo" method="post"><input type="text" name="search"></form>
+<form action="identifier?state=%s" method="post">
+  <input type="hidden" name="csrf" value="csrf-token">
+  <input type="text" name="username">
+  <input type="checkbox" name="remember">
+  <button type="submit" name="action" value="default">Continue</button>
+</form></body></html>`, req.FormValue("state"))
+		case "/identifier":
+			if req.FormValue("csrf") != "csrf-token" || req.FormValue("action") != "default" || req.Form["remember"] != nil {
+				http.Error(w, "invalid form", http.StatusBadRequest)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "username", Value: req.FormValue("username")})
+			fmt.Fprintf(w, `<html><body><form action="/password" method="POST">
+  <input type="hidden" name="state" value="%s">
+  <input type="password" name="password">
+  <input type="submit" value="Log in">
+</form></body></html>`, req.URL.Query().Get("state"))
+		case "/password":
+			cookie, err := req.Cookie("username")
+			if err != nil || cookie.Value != "alice" || req.FormValue("password") != "alice-password" {
+				fmt.Fprint(w, `<html><head><title>Invalid credentials</title></head></html>`)
+				return
+			}
+			http.Redirect(w, req, redirectURL+"?"+url.Values{"code": {"test-code"}, "state": {req.FormValue("state")}}.Encode(), http.StatusFound)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name       string
+		password   string
+		want       url.Values
+		wantErrStr string
+	}{
+		{name: "valid", password: "alice-password", want: url.Values{"code": {"test-code"}, "state": {"test-state"}}},
+		{name: "invalid-password", password: "wrong", wantErrStr: `"Invalid credentials"`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			ip := interopProvider{
+				redirectURL:   redirectURL,
+				username:      "alice",
+				password:      tt.password,
+				usernameField: "username",
+				passwordField: "password",
+			}
+			got, err := ip.login(context.Background(), srv.Client(), srv.URL+"/authorize?state=test-state")
+			if tt.wantErrStr != "" {
+				require.Error(err)
+				assert.Contains(err.Error(), tt.wantErrStr)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc"
+)
+
+// UnknownIssuerError is returned by IssuerVerifier.VerifyIDToken when a
+// token's issuer (iss) isn't in the verifier's allow-list, or its allowed
+// window has ended (see WithAllowedUntil).  It wraps ErrUnknownIssuer, so it
+// can be checked with either errors.As(...) or errors.Is(err,
+// ErrUnknownIssuer).
+type UnknownIssuerError struct {
+	// Issuer is the token's (unverified) issuer.
+	Issuer string
+
+	// AllowedUntil is when the issuer's allowed window ended, which is zero
+	// when the issuer was never allowed.
+	AllowedUntil time.Time
+}
+
+// Error implements the error interface.
+func (e *UnknownIssuerError) Error() string {
+	if !e.AllowedUntil.IsZero() {
+		return fmt.Sprintf("issuer %q is no longer allowed since %s: %s", e.Issuer, e.AllowedUntil.Format(time.RFC3339), ErrUnknownIssuer)
+	}
+	return fmt.Sprintf("issuer %q is not allowed: %s", e.Issuer, ErrUnknownIssuer)
+}
+
+// Unwrap returns ErrUnknownIssuer.
+func (e *UnknownIssuerError) Unwrap() error { return ErrUnknownIssuer }
+
+// IssuerVerifier verifies bearer id_tokens (or other OIDC JWTs) issued by any
+// issuer in its allow-list, which allows an API edge to accept tokens from
+// several IdPs.  The token's issuer (iss) selects the Provider or key set used
+// to verify it, and tokens from issuers that aren't allowed are rejected with
+// an UnknownIssuerError before any keys are fetched.
+//
+// An issuer can be allowed for a limited window (see WithAllowedUntil), which
+// eases an IdP migration: both the old and new issuers are allowed, each
+// with its own keys, until the old issuer's window ends (see
+// NewIssuerMigration).
+//
+// An IssuerVerifier is safe for concurrent use.
+type IssuerVerifier struct {
+	mu      sync.RWMutex
+	issuers map[string]*allowedIssuer
+	nowFunc func() time.Time
+}
+
+// issuerVerifyFunc verifies a token for an allowed issuer.
+type issuerVerifyFunc func(ctx context.Context, t IDToken) (map[string]interface{}, error)
+
+// allowedIssuer is an allowed issuer's verify func, along with when its
+// allowed window ends (which is zero when it's allowed indefinitely) and the
+// quirks of its profile.
+type allowedIssuer struct {
+	verify issuerVerifyFunc
+	until  time.Time
+	quirks quirks
+}
+
+// NewIssuerVerifier creates a new IssuerVerifier with an empty allow-list.
+//
+// Supported options: WithNow
+func NewIssuerVerifier(opt ...Option) *IssuerVerifier {
+	opts := getIssuerVerifierOpts(opt...)
+	return &IssuerVerifier{
+		issuers: map[string]*allowedIssuer{},
+		nowFunc: opts.withNowFunc,
+	}
+}
+
+// NewIssuerMigration creates a new IssuerVerifier for an IdP migration, which
+// allows tokens from either the from or to Provider's issuer (each verified
+// with its own keys) for the window, and then only allows tokens from the to
+// Provider's issuer.  This avoids a hard cutover outage while the tokens
+// issued by the old IdP expire.
+//
+// Supported options: WithNow
+func NewIssuerMigration(from, to *Provider, window time.Duration, opt ...Option) (*IssuerVerifier, error) {
+	const op = "NewIssuerMigration"
+	if window <= 0 {
+		return nil, fmt.Errorf("%s: migration window must be greater than zero: %w", op, ErrInvalidParameter)
+	}
+	v := NewIssuerVerifier(opt...)
+	if err := v.AllowProvider(to); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := v.AllowProvider(from, WithAllowedUntil(v.now().Add(window))); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return v, nil
+}
+
+// AllowProvider adds the Provider's issuer to the allow-list.  Its tokens are
+// verified like an id_token returned from a refresh: the nonce and max_age
+// aren't verified and the Provider config's audiences are used.
+//
+// Supported options: WithAllowedUntil
+func (v *IssuerVerifier) AllowProvider(p *Provider, opt ...Option) error {
+	const op = "IssuerVerifier.AllowProvider"
+	if p == nil {
+		return fmt.Errorf("%s: provider is nil: %w", op, ErrNilParameter)
+	}
+	config := p.currentConfig()
+	if config == nil {
+		return fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
+	}
+	verify := func(ctx context.Context, t IDToken) (map[string]interface{}, error) {
+		ctx, cancel := p.operationContext(ctx)
+		defer cancel()
+		return p.verifyIDToken(ctx, t, nil, nil)
+	}
+	if err := v.allow(config.Issuer, config.quirks(), verify, opt...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// AllowRegistry adds the issuers of every Provider in the registry to the
+// allow-list.  Providers registered afterwards aren't added.
+//
+// Supported options: WithAllowedUntil
+func (v *IssuerVerifier) AllowRegistry(r *ProviderRegistry, opt ...Option) error {
+	const op = "IssuerVerifier.AllowRegistry"
+	if r == nil {
+		return fmt.Errorf("%s: provider registry is nil: %w", op, ErrNilParameter)
+	}
+	for _, iss := range r.Issuers() {
+		p, err := r.Provider(iss)
+		if err != nil {
+			// the provider was removed after the issuers were listed.
+			continue
+		}
+		if err := v.AllowProvider(p, opt...); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// AllowIssuer adds the expected Issuer to the allow-list, without a Provider.
+// Its tokens are verified with the keySet (see IssuerKeySet) like
+// VerifyIDToken(...).
+//
+// Supported options: WithAllowedUntil
+func (v *IssuerVerifier) AllowIssuer(keySet oidc.KeySet, expected IDTokenExpectations, opt ...Option) error {
+	const op = "IssuerVerifier.AllowIssuer"
+	if keySet == nil {
+		return fmt.Errorf("%s: key set is nil: %w", op, ErrNilParameter)
+	}
+	config := &Config{
+		Issuer:               expected.Issuer,
+		ClientID:             expected.ClientID,
+		SupportedSigningAlgs: expected.SupportedSigningAlgs,
+		Audiences:            expected.Audiences,
+		Profile:              expected.Profile,
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("%s: invalid expectations: %w", op, err)
+	}
+	verify := func(ctx context.Context, t IDToken) (map[string]interface{}, error) {
+		return VerifyIDToken(ctx, keySet, t, expected)
+	}
+	if err := v.allow(expected.Issuer, config.quirks(), verify, opt...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Remove the issuer from the allow-list.
+func (v *IssuerVerifier) Remove(issuer string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.issuers, issuer)
+}
+
+// Issuers returns the sorted allow-list of issuers, without the issuers whose
+// allowed window has ended.
+func (v *IssuerVerifier) Issuers() []string {
+	now := v.now()
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	issuers := make([]string, 0, len(v.issuers))
+	for iss, a := range v.issuers {
+		if a.expired(now) {
+			continue
+		}
+		issuers = append(issuers, iss)
+	}
+	sort.Strings(issuers)
+	return issuers
+}
+
+// VerifyIDToken verifies the token using its issuer's Provider or key set and
+// returns its claims.  The token's issuer is matched using the allowed
+// issuer's profile (see WithProfile), so a ProfileGoogle token's issuer
+// without the https scheme matches the allowed https issuer.  If the token's
+// issuer isn't allowed (or its allowed window has ended), then an
+// *UnknownIssuerError is returned.
+func (v *IssuerVerifier) VerifyIDToken(ctx context.Context, t IDToken) (map[string]interface{}, error) {
+	const op = "IssuerVerifier.VerifyIDToken"
+	if t == "" {
+		return nil, fmt.Errorf("%s: id_token is empty: %w", op, ErrInvalidParameter)
+	}
+	var unverified struct {
+		Issuer string `json:"iss"`
+	}
+	if err := UnmarshalClaims(string(t), &unverified); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, err, ErrMalformedToken)
+	}
+	a, ok := v.lookup(unverified.Issuer)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%s: %w", op, &UnknownIssuerError{Issuer: unverified.Issuer})
+	case a.expired(v.now()):
+		return nil, fmt.Errorf("%s: %w", op, &UnknownIssuerError{Issuer: unverified.Issuer, AllowedUntil: a.until})
+	}
+	claims, err := a.verify(ctx, t)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return claims, nil
+}
+
+// lookup returns the allowed issuer of a token's (unverified) iss, which is
+// normalized by the allowed issuer's quirks before it's compared: an iss
+// without a scheme matches an https issuer whose profile allows it.
+func (v *IssuerVerifier) lookup(iss string) (*allowedIssuer, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if a, ok := v.issuers[iss]; ok {
+		return a, true
+	}
+	if !strings.Contains(iss, "://") {
+		if a, ok := v.issuers["https://"+iss]; ok && a.quirks.issuerWithoutScheme {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+// allow adds the issuer's verify func to the allow-list.  An issuer whose
+// allowed window has ended can be allowed again.
+func (v *IssuerVerifier) allow(issuer string, q quirks, verify issuerVerifyFunc, opt ...Option) error {
+	const op = "IssuerVerifier.allow"
+	if issuer == "" {
+		return fmt.Errorf("%s: issuer is empty: %w", op, ErrInvalidParameter)
+	}
+	opts := getAllowIssuerOpts(opt...)
+	now := v.now()
+	if !opts.withAllowedUntil.IsZero() && !opts.withAllowedUntil.After(now) {
+		return fmt.Errorf("%s: issuer %s allowed until %s is already expired: %w", op, issuer, opts.withAllowedUntil, ErrInvalidParameter)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if a, ok := v.issuers[issuer]; ok && !a.expired(now) {
+		return fmt.Errorf("%s: issuer %s is already allowed: %w", op, issuer, ErrInvalidParameter)
+	}
+	v.issuers[issuer] = &allowedIssuer{verify: verify, until: opts.withAllowedUntil, quirks: q}
+	return nil
+}
+
+// now returns the verifier's current time.
+func (v *IssuerVerifier) now() time.Time {
+	if v.nowFunc != nil {
+		return v.nowFunc()
+	}
+	return time.Now()
+}
+
+// expired returns true when the issuer's allowed window has ended.
+func (a *allowedIssuer) expired(now time.Time) bool {
+	return !a.until.IsZero() && !now.Before(a.until)
+}
+
+// issuerVerifierOptions is the set of available options for an
+// IssuerVerifier
+type issuerVerifierOptions struct {
+	withNowFunc func() time.Time
+}
+
+// issuerVerifierDefaults is a handy way to get the defaults at runtime and
+// during unit tests.
+func issuerVerifierDefaults() issuerVerifierOptions {
+	return issuerVerifierOptions{}
+}
+
+// getIssuerVerifierOpts gets the IssuerVerifier defaults and applies the opt
+// overrides passed in
+func getIssuerVerifierOpts(opt ...Option) issuerVerifierOptions {
+	opts := issuerVerifierDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// allowIssuerOptions is the set of available options for the IssuerVerifier's
+// allow functions
+type allowIssuerOptions struct {
+	withAllowedUntil time.Time
+}
+
+// allowIssuerDefaults is a handy way to get the defaults at runtime and
+// during unit tests.
+func allowIssuerDefaults() allowIssuerOptions {
+	return allowIssuerOptions{}
+}
+
+// getAllowIssuerOpts gets the allow defaults and applies the opt overrides
+// passed in
+func getAllowIssuerOpts(opt ...Option) allowIssuerOptions {
+	opts := allowIssuerDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithAllowedUntil provides an optional end of an issuer's allowed window,
+// after which its tokens are rejected with an *UnknownIssuerError.  It's
+// typically used for the old issuer of an IdP migration.
+//
+// Valid for: IssuerVerifier.AllowProvider, IssuerVerifier.AllowRegistry and
+// IssuerVerifier.AllowIssuer
+func WithAllowedUntil(t time.Time) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*allowIssuerOptions); ok {
+			o.withAllowedUntil = t
+		}
+	}
+}
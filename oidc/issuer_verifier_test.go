@@ -0,0 +1,198 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuerVerifier_VerifyIDToken(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+
+	// tp1 is allowed via its Provider
+	tp1 := StartTestProvider(t)
+	p1 := testNewProvider(t, clientID, "test-client-secret", "https://app.example.com/callback", tp1)
+	registry := NewProviderRegistry()
+	require.NoError(t, registry.Register(p1))
+
+	// tp2 is allowed via its key set
+	tp2 := StartTestProvider(t)
+	tp2.SetClientCreds(clientID, "test-client-secret")
+	_, _, alg, _ := tp2.SigningKeys()
+	cache, err := NewJWKSCache()
+	require.NoError(t, err)
+	keySet, err := IssuerKeySet(ctx, tp2.Addr(), WithProviderCA(tp2.CACert()), WithJWKSCache(cache))
+	require.NoError(t, err)
+
+	// tp3 isn't allowed
+	tp3 := StartTestProvider(t)
+	tp3.SetClientCreds(clientID, "test-client-secret")
+
+	v := NewIssuerVerifier()
+	require.NoError(t, v.AllowRegistry(registry))
+	require.NoError(t, v.AllowIssuer(keySet, IDTokenExpectations{
+		Issuer:               tp2.Addr(),
+		ClientID:             clientID,
+		SupportedSigningAlgs: []Alg{alg},
+	}))
+	issuers := []string{tp1.Addr(), tp2.Addr()}
+	if issuers[0] > issuers[1] {
+		issuers[0], issuers[1] = issuers[1], issuers[0]
+	}
+	assert.Equal(t, issuers, v.Issuers())
+
+	tests := []struct {
+		name       string
+		token      IDToken
+		wantIssuer string
+		wantErr    bool
+		wantIsErr  error
+	}{
+		{name: "provider", token: IDToken(tp1.issueSignedJWT()), wantIssuer: tp1.Addr()},
+		{name: "key-set", token: IDToken(tp2.issueSignedJWT()), wantIssuer: tp2.Addr()},
+		{name: "unknown-issuer", token: IDToken(tp3.issueSignedJWT()), wantErr: true, wantIsErr: ErrUnknownIssuer},
+		{name: "empty", wantErr: true, wantIsErr: ErrInvalidParameter},
+		{name: "malformed", token: "not-a-jwt", wantErr: true, wantIsErr: ErrMalformedToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			claims, err := v.VerifyIDToken(ctx, tt.token)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.wantIssuer, claims["iss"])
+		})
+	}
+	t.Run("unknown-issuer-error", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := v.VerifyIDToken(ctx, IDToken(tp3.issueSignedJWT()))
+		var unknown *UnknownIssuerError
+		require.True(errors.As(err, &unknown))
+		assert.Equal(tp3.Addr(), unknown.Issuer)
+	})
+	t.Run("wrong-keys", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		// a token claiming to be from tp2, but signed by tp3's keys
+		tp3.SetCustomClaims(map[string]interface{}{"iss": tp2.Addr()})
+		defer tp3.SetCustomClaims(map[string]interface{}{})
+		_, err := v.VerifyIDToken(ctx, IDToken(tp3.issueSignedJWT()))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidSignature), "wanted \"%s\" but got \"%s\"", ErrInvalidSignature, err)
+	})
+	t.Run("issuer-without-scheme", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		// like Google, tp2 issues a token whose iss doesn't have the https
+		// scheme
+		iss := strings.TrimPrefix(tp2.Addr(), "https://")
+		tp2.SetCustomClaims(map[string]interface{}{"iss": iss})
+		defer tp2.SetCustomClaims(map[string]interface{}{})
+		token := IDToken(tp2.issueSignedJWT())
+
+		// it's unknown without the profile which allows it
+		_, err := v.VerifyIDToken(ctx, token)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrUnknownIssuer), "wanted \"%s\" but got \"%s\"", ErrUnknownIssuer, err)
+
+		google := NewIssuerVerifier()
+		require.NoError(google.AllowIssuer(keySet, IDTokenExpectations{
+			Issuer:               tp2.Addr(),
+			ClientID:             clientID,
+			SupportedSigningAlgs: []Alg{alg},
+			Profile:              ProfileGoogle,
+		}))
+		claims, err := google.VerifyIDToken(ctx, token)
+		require.NoError(err)
+		assert.Equal(iss, claims["iss"])
+	})
+	t.Run("removed", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		v := NewIssuerVerifier()
+		require.NoError(v.AllowProvider(p1))
+		v.Remove(tp1.Addr())
+		_, err := v.VerifyIDToken(ctx, IDToken(tp1.issueSignedJWT()))
+		assert.Truef(errors.Is(err, ErrUnknownIssuer), "wanted \"%s\" but got \"%s\"", ErrUnknownIssuer, err)
+	})
+}
+
+func TestIssuerVerifier_Allow(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	p := testNewProvider(t, "test-client-id", "test-client-secret", "https://app.example.com/callback", tp)
+	keySet, err := IssuerKeySet(ctx, tp.Addr(), WithProviderCA(tp.CACert()))
+	require.NoError(t, err)
+
+	assert := assert.New(t)
+	v := NewIssuerVerifier()
+	err = v.AllowProvider(nil)
+	assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	err = v.AllowRegistry(nil)
+	assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	err = v.AllowIssuer(nil, IDTokenExpectations{})
+	assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	err = v.AllowIssuer(keySet, IDTokenExpectations{Issuer: tp.Addr()})
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+
+	assert.NoError(v.AllowProvider(p))
+	err = v.AllowIssuer(keySet, IDTokenExpectations{Issuer: tp.Addr(), ClientID: "test-client-id", SupportedSigningAlgs: []Alg{RS256}})
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+}
+
+func TestNewIssuerMigration(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	oldTP, newTP := StartTestProvider(t), StartTestProvider(t)
+	oldP := testNewProvider(t, clientID, "test-client-secret", "https://app.example.com/callback", oldTP)
+	newP := testNewProvider(t, clientID, "test-client-secret", "https://app.example.com/callback", newTP)
+
+	assert, require := assert.New(t), require.New(t)
+	now := time.Now()
+	clock := func() time.Time { return now }
+	v, err := NewIssuerMigration(oldP, newP, time.Hour, WithNow(func() time.Time { return clock() }))
+	require.NoError(err)
+	assert.ElementsMatch([]string{oldTP.Addr(), newTP.Addr()}, v.Issuers())
+
+	// during the window, tokens from both issuers are accepted
+	claims, err := v.VerifyIDToken(ctx, IDToken(oldTP.issueSignedJWT()))
+	require.NoError(err)
+	assert.Equal(oldTP.Addr(), claims["iss"])
+	claims, err = v.VerifyIDToken(ctx, IDToken(newTP.issueSignedJWT()))
+	require.NoError(err)
+	assert.Equal(newTP.Addr(), claims["iss"])
+
+	// after the window, only the new issuer's tokens are accepted
+	clock = func() time.Time { return now.Add(time.Hour) }
+	assert.Equal([]string{newTP.Addr()}, v.Issuers())
+	_, err = v.VerifyIDToken(ctx, IDToken(oldTP.issueSignedJWT()))
+	var unknown *UnknownIssuerError
+	require.True(errors.As(err, &unknown))
+	assert.Equal(oldTP.Addr(), unknown.Issuer)
+	assert.Equal(now.Add(time.Hour), unknown.AllowedUntil)
+	assert.Contains(err.Error(), "no longer allowed")
+	_, err = v.VerifyIDToken(ctx, IDToken(newTP.issueSignedJWT()))
+	assert.NoError(err)
+
+	// an issuer whose window ended can be allowed again
+	assert.NoError(v.AllowProvider(oldP, WithAllowedUntil(now.Add(2*time.Hour))))
+	_, err = v.VerifyIDToken(ctx, IDToken(oldTP.issueSignedJWT()))
+	assert.NoError(err)
+
+	err = v.AllowProvider(oldP, WithAllowedUntil(now))
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	_, err = NewIssuerMigration(oldP, newP, 0)
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	_, err = NewIssuerMigration(nil, newP, time.Hour)
+	assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+}
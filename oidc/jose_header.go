@@ -0,0 +1,78 @@
+package oidc
+
+import (
+	"fmt"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// JOSEHeader is the JOSE header of a signed JWT, which identifies the
+// algorithm and key used to sign it.
+//
+// See: https://tools.ietf.org/html/rfc7515#section-4
+type JOSEHeader struct {
+	// Algorithm is the alg used to sign the JWT.
+	Algorithm Alg
+
+	// KeyID is the kid of the key used to sign the JWT, which is empty when
+	// the provider doesn't include one.
+	KeyID string
+
+	// Type is the typ of the JWT (for example: "JWT"), which is optional.
+	Type string
+
+	// ContentType is the cty of the JWT, which is optional.
+	ContentType string
+}
+
+// Header returns the id_token's JOSE header, which can be used to log (or
+// enforce) which of the provider's keys signed a login and to alert on
+// unexpected key ID changes.  The header is parsed without verifying the
+// id_token, so it should only be trusted for a verified id_token (like the
+// id_token of a Token returned by Provider.Exchange).
+func (t IDToken) Header() (*JOSEHeader, error) {
+	const op = "IDToken.Header"
+	if len(t) == 0 {
+		return nil, fmt.Errorf("%s: id_token is empty: %w", op, ErrInvalidParameter)
+	}
+	h, err := parseJOSEHeader(string(t))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return h, nil
+}
+
+// IDTokenHeader returns the JOSE header of the Token's id_token (see
+// IDToken.Header).
+func (t *Tk) IDTokenHeader() (*JOSEHeader, error) {
+	const op = "Tk.IDTokenHeader"
+	h, err := t.IDToken().Header()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return h, nil
+}
+
+// parseJOSEHeader parses the JOSE header of the signed JWT.
+func parseJOSEHeader(jwt string) (*JOSEHeader, error) {
+	const op = "parseJOSEHeader"
+	jws, err := jose.ParseSigned(jwt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: malformed jwt (%v): %w", op, err, ErrMalformedToken)
+	}
+	switch len(jws.Signatures) {
+	case 0:
+		return nil, fmt.Errorf("%s: jwt not signed: %w", op, ErrTokenNotSigned)
+	case 1:
+	default:
+		return nil, fmt.Errorf("%s: multiple signatures on jwt not supported: %w", op, ErrMalformedToken)
+	}
+	sig := jws.Signatures[0].Header
+	h := &JOSEHeader{
+		Algorithm: Alg(sig.Algorithm),
+		KeyID:     sig.KeyID,
+	}
+	h.Type, _ = sig.ExtraHeaders[jose.HeaderType].(string)
+	h.ContentType, _ = sig.ExtraHeaders[jose.HeaderContentType].(string)
+	return h, nil
+}
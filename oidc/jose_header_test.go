@@ -0,0 +1,78 @@
+package oidc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestIDToken_Header(t *testing.T) {
+	t.Parallel()
+	_, priv := TestGenerateKeys(t)
+	claims := map[string]interface{}{"iss": "https://example.com", "sub": "alice"}
+
+	signed := func(t *testing.T, opts *jose.SignerOptions) IDToken {
+		t.Helper()
+		sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: priv}, opts)
+		require.NoError(t, err)
+		raw, err := jwt.Signed(sig).Claims(claims).CompactSerialize()
+		require.NoError(t, err)
+		return IDToken(raw)
+	}
+
+	tests := []struct {
+		name      string
+		token     func(t *testing.T) IDToken
+		want      *JOSEHeader
+		wantIsErr error
+	}{
+		{
+			name: "kid-typ-cty",
+			token: func(t *testing.T) IDToken {
+				opts := (&jose.SignerOptions{}).WithType("JWT").WithContentType("JWT").WithHeader("kid", "key-1")
+				return signed(t, opts)
+			},
+			want: &JOSEHeader{Algorithm: ES256, KeyID: "key-1", Type: "JWT", ContentType: "JWT"},
+		},
+		{
+			name:  "alg-only",
+			token: func(t *testing.T) IDToken { return signed(t, nil) },
+			want:  &JOSEHeader{Algorithm: ES256},
+		},
+		{
+			name:      "empty",
+			token:     func(*testing.T) IDToken { return "" },
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "malformed",
+			token:     func(*testing.T) IDToken { return "not-a-jwt" },
+			wantIsErr: ErrMalformedToken,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			idToken := tt.token(t)
+			got, err := idToken.Header()
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+
+			tk, err := NewToken(idToken, nil)
+			require.NoError(err)
+			fromToken, err := tk.IDTokenHeader()
+			require.NoError(err)
+			assert.Equal(tt.want, fromToken)
+		})
+	}
+}
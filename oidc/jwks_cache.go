@@ -0,0 +1,593 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"golang.org/x/sync/singleflight"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// DefaultJWKSCacheTTL is the default amount of time a JWKS is cached before
+// it's fetched again from its jwks_uri.
+const DefaultJWKSCacheTTL = 5 * time.Minute
+
+// defaultJWKSCache is the process-wide cache shared by every Provider that
+// isn't configured with its own cache via WithJWKSCache(...)
+var defaultJWKSCache = mustNewJWKSCache()
+
+// DefaultJWKSCache returns the process-wide JWKSCache which is shared by all
+// Providers that haven't been configured with their own cache.
+func DefaultJWKSCache() *JWKSCache {
+	return defaultJWKSCache
+}
+
+// JWKSCache is a cache of JSON Web Key Sets keyed by their jwks_uri. A single
+// cache can be shared by any number of Providers (see WithJWKSCache), so a
+// fleet of Providers for the same issuer will only fetch the issuer's keys
+// once per TTL.  Concurrent refreshes for the same jwks_uri are collapsed into
+// a single http request, and fetches which fail with a transient error are
+// retried (see WithFetchRetries).
+//
+// Optionally, expired keys can continue to be used for a stale TTL while
+// they're refreshed in the background (see WithJWKSCacheStaleTTL), so
+// verifications aren't blocked by (or fail because of) a slow or briefly
+// unavailable jwks_uri.  Expired keys can also be used for a max staleness
+// when they can't be fetched (see WithJWKSCacheMaxStaleness), so
+// verifications don't fail during a jwks_uri outage.  A Provider can refresh
+// its keys in the background before they expire (see
+// WithJWKSRefreshInterval).
+//
+// A JWKSCache is safe for concurrent use.
+type JWKSCache struct {
+	ttl          time.Duration
+	staleTTL     time.Duration
+	maxStaleness time.Duration
+	retry        retryPolicy
+	nowFunc      func() time.Time
+
+	// operationTimeout limits each shared fetch when the ctx of the caller
+	// which started it doesn't have a deadline (see WithOperationTimeout)
+	operationTimeout time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]*jwksCacheEntry
+
+	group singleflight.Group
+
+	hits        uint64
+	staleHits   uint64
+	misses      uint64
+	fetches     uint64
+	fetchErrors uint64
+	staleErrors uint64
+}
+
+// jwksCacheEntry is a cached key set along with when it expires.
+type jwksCacheEntry struct {
+	keys      []jose.JSONWebKey
+	fetchedAt time.Time
+	expiry    time.Time
+
+	// generation is incremented every time the entry's keys are fetched,
+	// which allows a refresh to detect that the keys were fetched after its
+	// caller looked them up.
+	generation uint64
+}
+
+// JWKSCacheStats are the metrics collected by a JWKSCache.
+type JWKSCacheStats struct {
+	// Hits is the number of key lookups answered from the cache.
+	Hits uint64
+
+	// StaleHits is the number of key lookups answered with expired keys
+	// during their stale TTL (see WithJWKSCacheStaleTTL).  StaleHits are also
+	// counted as Hits.
+	StaleHits uint64
+
+	// Misses is the number of key lookups which required a fetch, either
+	// because the cached keys were missing/expired or because a token's key
+	// was not found in the cached keys.
+	Misses uint64
+
+	// Fetches is the number of http requests made to jwks_uris.
+	Fetches uint64
+
+	// FetchErrors is the number of fetches which failed.
+	FetchErrors uint64
+
+	// StaleErrorHits is the number of key lookups answered with expired keys
+	// because their jwks_uri couldn't be fetched (see
+	// WithJWKSCacheMaxStaleness).  StaleErrorHits are also counted as Misses.
+	StaleErrorHits uint64
+
+	// Entries is the number of jwks_uris currently cached.
+	Entries int
+}
+
+// NewJWKSCache creates a new JWKSCache.
+//
+// Supported options: WithJWKSCacheTTL, WithJWKSCacheStaleTTL,
+// WithJWKSCacheMaxStaleness, WithFetchRetries, WithOperationTimeout, WithNow
+func NewJWKSCache(opt ...Option) (*JWKSCache, error) {
+	const op = "NewJWKSCache"
+	opts := getJWKSCacheOpts(opt...)
+	switch {
+	case opts.withTTL <= 0:
+		return nil, fmt.Errorf("%s: ttl must be greater than zero: %w", op, ErrInvalidParameter)
+	case opts.withStaleTTL < 0:
+		return nil, fmt.Errorf("%s: stale ttl must not be negative: %w", op, ErrInvalidParameter)
+	case opts.withMaxStaleness < 0:
+		return nil, fmt.Errorf("%s: max staleness must not be negative: %w", op, ErrInvalidParameter)
+	case opts.withFetchRetries.retries < 0 || opts.withFetchRetries.backoff < 0:
+		return nil, fmt.Errorf("%s: fetch retries and backoff must not be negative: %w", op, ErrInvalidParameter)
+	case opts.withOperationTimeout < 0:
+		return nil, fmt.Errorf("%s: operation timeout must not be negative: %w", op, ErrInvalidParameter)
+	}
+	return &JWKSCache{
+		ttl:              opts.withTTL,
+		staleTTL:         opts.withStaleTTL,
+		maxStaleness:     opts.withMaxStaleness,
+		retry:            opts.withFetchRetries,
+		nowFunc:          opts.withNowFunc,
+		operationTimeout: opts.withOperationTimeout,
+		entries:          map[string]*jwksCacheEntry{},
+	}, nil
+}
+
+// mustNewJWKSCache creates a JWKSCache with the default options and panics
+// if that fails (which it won't)
+func mustNewJWKSCache() *JWKSCache {
+	c, err := NewJWKSCache()
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// KeySet returns an oidc.KeySet which verifies signatures using the keys
+// published at jwksURL.  The keys are stored in (and shared via) the cache and
+// fetched using the client when they're missing, expired or when a token is
+// signed by a key that's not in the cache (key rotation).  If the client is
+// nil, http.DefaultClient is used.
+func (c *JWKSCache) KeySet(jwksURL string, client *http.Client) oidc.KeySet {
+	return c.keySet(context.Background(), jwksURL, client)
+}
+
+// keySet returns a key set like KeySet, whose background refreshes stop when
+// the backgroundCtx is done.
+func (c *JWKSCache) keySet(backgroundCtx context.Context, jwksURL string, client *http.Client) *cachedKeySet {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if backgroundCtx == nil {
+		backgroundCtx = context.Background()
+	}
+	return &cachedKeySet{
+		cache:         c,
+		jwksURL:       jwksURL,
+		client:        client,
+		backgroundCtx: backgroundCtx,
+	}
+}
+
+// Stats returns the cache's current metrics.
+func (c *JWKSCache) Stats() JWKSCacheStats {
+	c.mu.RLock()
+	entries := len(c.entries)
+	c.mu.RUnlock()
+	return JWKSCacheStats{
+		Hits:           atomic.LoadUint64(&c.hits),
+		StaleHits:      atomic.LoadUint64(&c.staleHits),
+		Misses:         atomic.LoadUint64(&c.misses),
+		Fetches:        atomic.LoadUint64(&c.fetches),
+		FetchErrors:    atomic.LoadUint64(&c.fetchErrors),
+		StaleErrorHits: atomic.LoadUint64(&c.staleErrors),
+		Entries:        entries,
+	}
+}
+
+// Purge removes the cached keys for the jwksURLs provided.  If no jwksURLs
+// are provided, then every entry is removed.
+func (c *JWKSCache) Purge(jwksURLs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(jwksURLs) == 0 {
+		c.entries = map[string]*jwksCacheEntry{}
+		return
+	}
+	for _, u := range jwksURLs {
+		delete(c.entries, u)
+	}
+}
+
+// now returns the current time using the cache's optional now func
+func (c *JWKSCache) now() time.Time {
+	if c.nowFunc != nil {
+		return c.nowFunc()
+	}
+	return time.Now()
+}
+
+// cachedKeys returns the keys cached for the jwksURL, which are stale when
+// they have expired but are still within the cache's stale TTL.  The
+// generation of the cached keys is returned even when they're not ok, so it
+// can be passed to refresh(...)
+func (c *JWKSCache) cachedKeys(jwksURL string) (keys []jose.JSONWebKey, generation uint64, stale bool, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[jwksURL]
+	if !ok {
+		return nil, 0, false, false
+	}
+	now := c.now()
+	switch {
+	case now.Before(e.expiry):
+		return e.keys, e.generation, false, true
+	case now.Before(e.expiry.Add(c.staleTTL)):
+		return e.keys, e.generation, true, true
+	default:
+		return nil, e.generation, false, false
+	}
+}
+
+// staleKeys returns the keys cached for the jwksURL when they expired within
+// the cache's max staleness, which are used when the keys can't be fetched.
+func (c *JWKSCache) staleKeys(jwksURL string) ([]jose.JSONWebKey, bool) {
+	if c.maxStaleness <= 0 {
+		return nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[jwksURL]
+	if !ok || !c.now().Before(e.expiry.Add(c.maxStaleness)) {
+		return nil, false
+	}
+	return e.keys, true
+}
+
+// entry returns a copy of the entry cached for the jwksURL.
+func (c *JWKSCache) entry(jwksURL string) (jwksCacheEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[jwksURL]
+	if !ok {
+		return jwksCacheEntry{}, false
+	}
+	return *e, true
+}
+
+// fetchedSince returns the unexpired keys for the jwksURL when they were
+// fetched after the generation.
+func (c *JWKSCache) fetchedSince(jwksURL string, generation uint64) ([]jose.JSONWebKey, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[jwksURL]
+	if !ok || e.generation <= generation || !c.now().Before(e.expiry) {
+		return nil, false
+	}
+	return e.keys, true
+}
+
+// refresh fetches the keys from the jwksURL and caches them, unless they've
+// already been fetched since the generation the caller looked up.  Concurrent
+// refreshes for the same jwksURL share a single fetch, and transient fetch
+// failures are retried.
+//
+// The shared fetch isn't canceled with any one caller's ctx (so a caller
+// giving up doesn't fail the fetch for everyone else), but each caller stops
+// waiting when its ctx is done.  The fetch is limited by the deadline of the
+// ctx of the caller which started it, or by the cache's operation timeout when
+// that ctx doesn't have a deadline (see WithOperationTimeout).
+func (c *JWKSCache) refresh(ctx context.Context, jwksURL string, client *http.Client, generation uint64) ([]jose.JSONWebKey, error) {
+	if keys, ok := c.fetchedSince(jwksURL, generation); ok {
+		return keys, nil
+	}
+	ch := c.group.DoChan(jwksURL, func() (interface{}, error) {
+		// another refresh may have completed between the caller's check and
+		// this refresh starting
+		if keys, ok := c.fetchedSince(jwksURL, generation); ok {
+			return keys, nil
+		}
+		ctx, cancel := c.fetchContext(ctx)
+		defer cancel()
+		var keys []jose.JSONWebKey
+		err := c.retry.do(ctx, func() error {
+			atomic.AddUint64(&c.fetches, 1)
+			var err error
+			if keys, err = fetchJWKS(ctx, jwksURL, client); err != nil {
+				atomic.AddUint64(&c.fetchErrors, 1)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		var prevGeneration uint64
+		if prev, ok := c.entries[jwksURL]; ok {
+			prevGeneration = prev.generation
+		}
+		now := c.now()
+		c.entries[jwksURL] = &jwksCacheEntry{
+			keys:       keys,
+			fetchedAt:  now,
+			expiry:     now.Add(c.ttl),
+			generation: prevGeneration + 1,
+		}
+		return keys, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("get keys failed: %w", ctx.Err())
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.([]jose.JSONWebKey), nil
+	}
+}
+
+// fetchContext returns the ctx for a shared fetch started by a caller with the
+// ctx.  It isn't canceled with the caller's ctx, but has the same deadline or
+// (when the caller's ctx doesn't have a deadline) the cache's operation
+// timeout.
+func (c *JWKSCache) fetchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(context.Background(), deadline)
+	}
+	if c.operationTimeout > 0 {
+		return context.WithTimeout(context.Background(), c.operationTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// fetchJWKS gets the key set published at the jwksURL.  Its error messages
+// intentionally match the ones returned by the coreos remote key set, so
+// they're classified the same way by convertError(...)
+func fetchJWKS(ctx context.Context, jwksURL string, client *http.Client) ([]jose.JSONWebKey, error) {
+	req, err := http.NewRequest(http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get keys failed: unable to create request: %v", err)
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("get keys failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("get keys failed: unable to read response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &fetchStatusError{
+			statusCode: resp.StatusCode,
+			msg:        fmt.Sprintf("get keys failed: %s %s", resp.Status, body),
+		}
+	}
+
+	var keySet jose.JSONWebKeySet
+	if err := json.Unmarshal(body, &keySet); err != nil {
+		return nil, fmt.Errorf("failed to decode keys: %v %s", err, body)
+	}
+	return keySet.Keys, nil
+}
+
+// cachedKeySet is an oidc.KeySet backed by a JWKSCache
+type cachedKeySet struct {
+	cache   *JWKSCache
+	jwksURL string
+	client  *http.Client
+
+	// pins optionally restrict the keys used to verify signatures (see
+	// JWKSPins)
+	pins *JWKSPins
+
+	// backgroundCtx stops the key set's background refreshes when it's done
+	// (see Provider.Close)
+	backgroundCtx context.Context
+
+	// operationTimeout optionally limits the key set's background refreshes
+	// (see WithOperationTimeout).  The cache's operation timeout is used when
+	// it's zero.
+	operationTimeout time.Duration
+}
+
+// VerifySignature satisfies the oidc.KeySet interface.  It verifies the JWT
+// using the cached keys, and will refresh the keys once when the JWT's key is
+// not found in the cache.
+func (ks *cachedKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	jws, err := jose.ParseSigned(jwt)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: malformed jwt: %v", err)
+	}
+	keyID := ""
+	for _, sig := range jws.Signatures {
+		keyID = sig.Header.KeyID
+		break
+	}
+
+	keys, generation, stale, ok := ks.cache.cachedKeys(ks.jwksURL)
+	if ok {
+		if payload, ok := verifyWithKeys(jws, keyID, ks.pins.pinned(keys)); ok {
+			atomic.AddUint64(&ks.cache.hits, 1)
+			if stale {
+				atomic.AddUint64(&ks.cache.staleHits, 1)
+				ks.backgroundRefresh(generation)
+			}
+			return payload, nil
+		}
+	}
+
+	// either the keys aren't cached or the token's key wasn't found, so the
+	// keys may have been rotated.
+	atomic.AddUint64(&ks.cache.misses, 1)
+	cached := ok
+	keys, err = ks.cache.refresh(ctx, ks.jwksURL, ks.client, generation)
+	if err != nil {
+		// expired keys may be used when they can't be fetched, but keys
+		// which were already tried won't verify the token either.
+		if staleKeys, ok := ks.cache.staleKeys(ks.jwksURL); ok && !cached {
+			if payload, ok := verifyWithKeys(jws, keyID, ks.pins.pinned(staleKeys)); ok {
+				atomic.AddUint64(&ks.cache.staleErrors, 1)
+				return payload, nil
+			}
+		}
+		return nil, fmt.Errorf("fetching keys %v", err)
+	}
+	if payload, ok := verifyWithKeys(jws, keyID, ks.pins.pinned(keys)); ok {
+		return payload, nil
+	}
+	if _, ok := verifyWithKeys(jws, keyID, keys); ok {
+		return nil, fmt.Errorf("failed to verify id token signature: %s: %s", keyID, ErrUnpinnedKey)
+	}
+	return nil, errors.New("failed to verify id token signature")
+}
+
+// keys returns the key set's keys (including keys which aren't used for
+// signatures, like encryption keys), which are fetched when they're not
+// cached.  Only pinned keys are returned.
+func (ks *cachedKeySet) keys(ctx context.Context) ([]jose.JSONWebKey, error) {
+	keys, generation, stale, ok := ks.cache.cachedKeys(ks.jwksURL)
+	if ok {
+		if stale {
+			ks.backgroundRefresh(generation)
+		}
+		return ks.pins.pinned(keys), nil
+	}
+	keys, err := ks.cache.refresh(ctx, ks.jwksURL, ks.client, generation)
+	if err != nil {
+		if staleKeys, ok := ks.cache.staleKeys(ks.jwksURL); ok {
+			atomic.AddUint64(&ks.cache.staleErrors, 1)
+			return ks.pins.pinned(staleKeys), nil
+		}
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+	return ks.pins.pinned(keys), nil
+}
+
+// refresh fetches the key set's keys, even when the cached keys haven't
+// expired.
+func (ks *cachedKeySet) refresh(ctx context.Context) error {
+	_, generation, _, _ := ks.cache.cachedKeys(ks.jwksURL)
+	if _, err := ks.cache.refresh(ctx, ks.jwksURL, ks.client, generation); err != nil {
+		return fmt.Errorf("fetching keys: %w", err)
+	}
+	return nil
+}
+
+// backgroundRefresh refreshes the key set's keys without blocking the caller.
+// Concurrent refreshes are collapsed into a single fetch by the cache.  No
+// refresh is started once the key set's backgroundCtx is done.
+func (ks *cachedKeySet) backgroundRefresh(generation uint64) {
+	if ks.backgroundCtx.Err() != nil {
+		return
+	}
+	go func() {
+		ctx := ks.backgroundCtx
+		if ks.operationTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, ks.operationTimeout)
+			defer cancel()
+		}
+		_, _ = ks.cache.refresh(ctx, ks.jwksURL, ks.client, generation)
+	}()
+}
+
+// verifyWithKeys verifies the jws with keys that match the keyID.  Every key
+// is tried when keyID is empty.
+func verifyWithKeys(jws *jose.JSONWebSignature, keyID string, keys []jose.JSONWebKey) ([]byte, bool) {
+	for i := range keys {
+		k := &keys[i] // avoids copying each key
+		if keyID != "" && k.KeyID != keyID {
+			continue
+		}
+		if payload, err := jws.Verify(k); err == nil {
+			return payload, true
+		}
+	}
+	return nil, false
+}
+
+// jwksCacheOptions is the set of available options for JWKSCache functions
+type jwksCacheOptions struct {
+	withTTL          time.Duration
+	withStaleTTL     time.Duration
+	withMaxStaleness time.Duration
+	withFetchRetries retryPolicy
+	withNowFunc      func() time.Time
+
+	withOperationTimeout time.Duration
+}
+
+// jwksCacheDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func jwksCacheDefaults() jwksCacheOptions {
+	return jwksCacheOptions{
+		withTTL:              DefaultJWKSCacheTTL,
+		withFetchRetries:     defaultRetryPolicy(),
+		withOperationTimeout: DefaultOperationTimeout,
+	}
+}
+
+// getJWKSCacheOpts gets the JWKSCache defaults and applies the opt overrides
+// passed in
+func getJWKSCacheOpts(opt ...Option) jwksCacheOptions {
+	opts := jwksCacheDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithJWKSCacheTTL provides an optional amount of time keys are cached before
+// they are fetched again.
+//
+// Valid for: JWKSCache
+func WithJWKSCacheTTL(ttl time.Duration) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*jwksCacheOptions); ok {
+			o.withTTL = ttl
+		}
+	}
+}
+
+// WithJWKSCacheStaleTTL provides an optional amount of time that expired keys
+// continue to be used, while they're refreshed in the background.  Keys which
+// are used during their stale TTL are counted as StaleHits.  A token signed
+// by a key that's not in the stale keys still requires a refresh before it's
+// verified.  The default is zero, which disables using stale keys.
+//
+// Valid for: JWKSCache
+func WithJWKSCacheStaleTTL(staleTTL time.Duration) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*jwksCacheOptions); ok {
+			o.withStaleTTL = staleTTL
+		}
+	}
+}
+
+// WithJWKSCacheMaxStaleness provides an optional amount of time that expired
+// keys continue to be used when they can't be fetched, so verifications don't
+// fail while a jwks_uri is briefly unavailable.  Unlike the stale TTL, the
+// keys are only used after a fetch fails, and they're counted as
+// StaleErrorHits.  A token signed by a key that's not in the expired keys
+// still fails.  The default is zero, which disables using expired keys when
+// they can't be fetched.
+//
+// Valid for: JWKSCache
+func WithJWKSCacheMaxStaleness(d time.Duration) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*jwksCacheOptions); ok {
+			o.withMaxStaleness = d
+		}
+	}
+}
@@ -0,0 +1,514 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestNewJWKSCache(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantTTL   time.Duration
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name:    "default",
+			wantTTL: DefaultJWKSCacheTTL,
+		},
+		{
+			name:    "with-ttl",
+			opts:    []Option{WithJWKSCacheTTL(time.Hour)},
+			wantTTL: time.Hour,
+		},
+		{
+			name:      "invalid-ttl",
+			opts:      []Option{WithJWKSCacheTTL(0)},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "invalid-stale-ttl",
+			opts:      []Option{WithJWKSCacheStaleTTL(-1)},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "invalid-max-staleness",
+			opts:      []Option{WithJWKSCacheMaxStaleness(-1)},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "invalid-retries",
+			opts:      []Option{WithFetchRetries(-1, time.Millisecond)},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "invalid-operation-timeout",
+			opts:      []Option{WithOperationTimeout(-1)},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := NewJWKSCache(tt.opts...)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.wantTTL, got.ttl)
+			assert.Equal(JWKSCacheStats{}, got.Stats())
+		})
+	}
+	t.Run("default-cache", func(t *testing.T) {
+		assert := assert.New(t)
+		assert.NotNil(DefaultJWKSCache())
+		assert.Equal(DefaultJWKSCache(), DefaultJWKSCache())
+	})
+}
+
+func TestJWKSCache_KeySet(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pub, priv := TestGenerateKeys(t)
+	srv := newTestJWKSServer(t, pub, "key-1")
+
+	t.Run("shared-fetch", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewJWKSCache()
+		require.NoError(err)
+		before := srv.count()
+		ks1 := c.KeySet(srv.URL, nil)
+		ks2 := c.KeySet(srv.URL, srv.Client())
+		jwt := TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil)
+
+		for _, ks := range []interface {
+			VerifySignature(context.Context, string) ([]byte, error)
+		}{ks1, ks2, ks1} {
+			payload, err := ks.VerifySignature(ctx, jwt)
+			require.NoError(err)
+			assert.Contains(string(payload), "alice")
+		}
+		assert.Equal(before+1, srv.count())
+		assert.Equal(JWKSCacheStats{Hits: 2, Misses: 1, Fetches: 1, Entries: 1}, c.Stats())
+	})
+	t.Run("concurrent-fetch", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewJWKSCache()
+		require.NoError(err)
+		srv.setDelay(50 * time.Millisecond)
+		defer srv.setDelay(0)
+		before := srv.count()
+		jwt := TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := c.KeySet(srv.URL, nil).VerifySignature(ctx, jwt)
+				assert.NoError(err)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(before+1, srv.count())
+		assert.Equal(uint64(1), c.Stats().Fetches)
+	})
+	t.Run("concurrent-unknown-key", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewJWKSCache()
+		require.NoError(err)
+		rotated := newTestJWKSServer(t, pub, "key-1")
+		ks := c.KeySet(rotated.URL, nil)
+		_, err = ks.VerifySignature(ctx, TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil))
+		require.NoError(err)
+
+		newPub, newPriv := TestGenerateKeys(t)
+		rotated.setKey(newPub, "key-2")
+		rotated.setDelay(50 * time.Millisecond)
+		jwt := TestSignJWT(t, newPriv, ES256, map[string]interface{}{"sub": "alice"}, nil)
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := ks.VerifySignature(ctx, jwt)
+				assert.NoError(err)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(int64(2), rotated.count())
+	})
+	t.Run("refreshed-since-lookup", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewJWKSCache()
+		require.NoError(err)
+		before := srv.count()
+		_, generation, _, ok := c.cachedKeys(srv.URL)
+		require.False(ok)
+
+		// the first refresh fetches the keys, but a refresh for a caller
+		// which looked up the keys before that fetch completed doesn't
+		_, err = c.refresh(ctx, srv.URL, srv.Client(), generation)
+		require.NoError(err)
+		keys, err := c.refresh(ctx, srv.URL, srv.Client(), generation)
+		require.NoError(err)
+		assert.Len(keys, 1)
+		assert.Equal(before+1, srv.count())
+
+		// a caller which looked up the current keys gets new ones
+		_, generation, _, ok = c.cachedKeys(srv.URL)
+		require.True(ok)
+		_, err = c.refresh(ctx, srv.URL, srv.Client(), generation)
+		require.NoError(err)
+		assert.Equal(before+2, srv.count())
+	})
+	t.Run("caller-gives-up", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewJWKSCache()
+		require.NoError(err)
+		slow := newTestJWKSServer(t, pub, "key-1")
+		slow.setDelay(100 * time.Millisecond)
+		jwt := TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shortCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+			defer cancel()
+			_, err := c.KeySet(slow.URL, nil).VerifySignature(shortCtx, jwt)
+			assert.Error(err)
+		}()
+		_, err = c.KeySet(slow.URL, nil).VerifySignature(ctx, jwt)
+		require.NoError(err)
+		wg.Wait()
+		assert.Equal(int64(1), slow.count())
+	})
+	t.Run("ttl-expired", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		now := time.Now()
+		c, err := NewJWKSCache(WithJWKSCacheTTL(time.Minute), WithNow(func() time.Time { return now }))
+		require.NoError(err)
+		ks := c.KeySet(srv.URL, nil)
+		jwt := TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil)
+
+		_, err = ks.VerifySignature(ctx, jwt)
+		require.NoError(err)
+		_, err = ks.VerifySignature(ctx, jwt)
+		require.NoError(err)
+		assert.Equal(uint64(1), c.Stats().Fetches)
+
+		now = now.Add(2 * time.Minute)
+		_, err = ks.VerifySignature(ctx, jwt)
+		require.NoError(err)
+		assert.Equal(uint64(2), c.Stats().Fetches)
+	})
+	t.Run("rotated-keys", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewJWKSCache()
+		require.NoError(err)
+		rotated := newTestJWKSServer(t, pub, "key-1")
+		ks := c.KeySet(rotated.URL, nil)
+		_, err = ks.VerifySignature(ctx, TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil))
+		require.NoError(err)
+
+		newPub, newPriv := TestGenerateKeys(t)
+		rotated.setKey(newPub, "key-2")
+		_, err = ks.VerifySignature(ctx, TestSignJWT(t, newPriv, ES256, map[string]interface{}{"sub": "alice"}, nil))
+		require.NoError(err)
+		assert.Equal(uint64(2), c.Stats().Fetches)
+	})
+	t.Run("invalid-signature", func(t *testing.T) {
+		require := require.New(t)
+		c, err := NewJWKSCache()
+		require.NoError(err)
+		_, wrongPriv := TestGenerateKeys(t)
+		_, err = c.KeySet(srv.URL, nil).VerifySignature(ctx, TestSignJWT(t, wrongPriv, ES256, map[string]interface{}{"sub": "alice"}, nil))
+		require.Error(err)
+		require.Contains(err.Error(), "failed to verify id token signature")
+	})
+	t.Run("fetch-error", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewJWKSCache()
+		require.NoError(err)
+		_, err = c.KeySet(srv.URL+"/not-found", nil).VerifySignature(ctx, TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil))
+		require.Error(err)
+		assert.Contains(err.Error(), "get keys failed")
+		assert.Equal(uint64(1), c.Stats().FetchErrors)
+		assert.Equal(0, c.Stats().Entries)
+	})
+	t.Run("transient-fetch-error", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewJWKSCache(WithFetchRetries(2, time.Millisecond))
+		require.NoError(err)
+		flaky := newTestJWKSServer(t, pub, "key-1")
+		flaky.setFailures(2)
+		_, err = c.KeySet(flaky.URL, nil).VerifySignature(ctx, TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil))
+		require.NoError(err)
+		assert.Equal(int64(3), flaky.count())
+		assert.Equal(uint64(3), c.Stats().Fetches)
+		assert.Equal(uint64(2), c.Stats().FetchErrors)
+
+		// fetches are not retried once the retries are exhausted
+		c.Purge()
+		flaky.setFailures(3)
+		_, err = c.KeySet(flaky.URL, nil).VerifySignature(ctx, TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil))
+		require.Error(err)
+		assert.Contains(err.Error(), "503 Service Unavailable")
+		assert.Equal(int64(6), flaky.count())
+	})
+	t.Run("signature-failures-not-retried", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewJWKSCache(WithFetchRetries(2, time.Millisecond))
+		require.NoError(err)
+		before := srv.count()
+		_, wrongPriv := TestGenerateKeys(t)
+		_, err = c.KeySet(srv.URL, nil).VerifySignature(ctx, TestSignJWT(t, wrongPriv, ES256, map[string]interface{}{"sub": "alice"}, nil))
+		require.Error(err)
+		assert.Equal(before+1, srv.count())
+	})
+	t.Run("stale-while-revalidate", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		var now atomic.Value
+		now.Store(time.Now())
+		c, err := NewJWKSCache(
+			WithJWKSCacheTTL(time.Minute),
+			WithJWKSCacheStaleTTL(time.Minute),
+			WithFetchRetries(0, 0),
+			WithNow(func() time.Time { return now.Load().(time.Time) }),
+		)
+		require.NoError(err)
+		stale := newTestJWKSServer(t, pub, "key-1")
+		ks := c.KeySet(stale.URL, nil)
+		jwt := TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil)
+		_, err = ks.VerifySignature(ctx, jwt)
+		require.NoError(err)
+
+		// expired keys are used during the stale ttl, even when the refresh
+		// fails
+		stale.setFailures(1)
+		now.Store(now.Load().(time.Time).Add(90 * time.Second))
+		_, err = ks.VerifySignature(ctx, jwt)
+		require.NoError(err)
+		assert.Equal(uint64(1), c.Stats().StaleHits)
+		require.Eventually(func() bool { return c.Stats().FetchErrors == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		// the next stale hit refreshes the keys in the background
+		_, err = ks.VerifySignature(ctx, jwt)
+		require.NoError(err)
+		require.Eventually(func() bool { return c.Stats().Fetches == 3 && c.Stats().FetchErrors == 1 }, 5*time.Second, 10*time.Millisecond)
+		_, err = ks.VerifySignature(ctx, jwt)
+		require.NoError(err)
+		assert.Equal(uint64(2), c.Stats().StaleHits)
+
+		// keys beyond the stale ttl are not used
+		stale.setFailures(1)
+		now.Store(now.Load().(time.Time).Add(3 * time.Minute))
+		_, err = ks.VerifySignature(ctx, jwt)
+		require.Error(err)
+		assert.Equal(uint64(2), c.Stats().StaleHits)
+	})
+	t.Run("max-staleness", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		var now atomic.Value
+		now.Store(time.Now())
+		c, err := NewJWKSCache(
+			WithJWKSCacheTTL(time.Minute),
+			WithJWKSCacheMaxStaleness(time.Hour),
+			WithFetchRetries(0, 0),
+			WithNow(func() time.Time { return now.Load().(time.Time) }),
+		)
+		require.NoError(err)
+		unavailable := newTestJWKSServer(t, pub, "key-1")
+		ks := c.KeySet(unavailable.URL, nil)
+		jwt := TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil)
+		_, err = ks.VerifySignature(ctx, jwt)
+		require.NoError(err)
+
+		// expired keys are refreshed, but used when they can't be fetched
+		unavailable.setFailures(1)
+		now.Store(now.Load().(time.Time).Add(30 * time.Minute))
+		_, err = ks.VerifySignature(ctx, jwt)
+		require.NoError(err)
+		assert.Equal(uint64(1), c.Stats().StaleErrorHits)
+		assert.Equal(uint64(1), c.Stats().FetchErrors)
+
+		// a token signed by a key that's not cached still fails
+		_, rotatedPriv := TestGenerateKeys(t)
+		unavailable.setFailures(1)
+		_, err = ks.VerifySignature(ctx, TestSignJWT(t, rotatedPriv, ES256, map[string]interface{}{"sub": "alice"}, nil))
+		require.Error(err)
+		assert.Equal(uint64(1), c.Stats().StaleErrorHits)
+
+		// keys beyond the max staleness are not used
+		unavailable.setFailures(1)
+		now.Store(now.Load().(time.Time).Add(time.Hour))
+		_, err = ks.VerifySignature(ctx, jwt)
+		require.Error(err)
+		assert.Equal(uint64(1), c.Stats().StaleErrorHits)
+	})
+	t.Run("operation-timeout", func(t *testing.T) {
+		// slow never responds, and reports when its request is canceled
+		canceled := make(chan struct{}, 2)
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			select {
+			case <-req.Context().Done():
+				canceled <- struct{}{}
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		t.Cleanup(slow.Close)
+		jwt := TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil)
+
+		// the fetch is limited by the cache's operation timeout when the ctx
+		// doesn't have a deadline
+		c, err := NewJWKSCache(WithOperationTimeout(50*time.Millisecond), WithFetchRetries(0, 0))
+		require.NoError(t, err)
+		_, err = c.KeySet(slow.URL, nil).VerifySignature(ctx, jwt)
+		require.Error(t, err)
+		select {
+		case <-canceled:
+		case <-time.After(2 * time.Second):
+			require.Fail(t, "fetch wasn't limited by the cache's operation timeout")
+		}
+
+		// the fetch is limited by the deadline of the caller's ctx
+		c, err = NewJWKSCache(WithFetchRetries(0, 0))
+		require.NoError(t, err)
+		deadlineCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = c.KeySet(slow.URL, nil).VerifySignature(deadlineCtx, jwt)
+		require.Error(t, err)
+		select {
+		case <-canceled:
+		case <-time.After(2 * time.Second):
+			require.Fail(t, "fetch wasn't limited by the ctx deadline")
+		}
+	})
+	t.Run("purge", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewJWKSCache()
+		require.NoError(err)
+		_, err = c.KeySet(srv.URL, nil).VerifySignature(ctx, TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, nil))
+		require.NoError(err)
+		assert.Equal(1, c.Stats().Entries)
+		c.Purge(srv.URL)
+		assert.Equal(0, c.Stats().Entries)
+	})
+}
+
+func TestProvider_JWKSCache(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	cache, err := NewJWKSCache()
+	require.NoError(err)
+
+	tc := testNewConfig(t, "test-client-id", "test-client-secret", "https://example.com/callback", tp)
+	tc.JWKSCache = cache
+	var providers []*Provider
+	for i := 0; i < 3; i++ {
+		p, err := NewProvider(tc)
+		require.NoError(err)
+		t.Cleanup(p.Done)
+		providers = append(providers, p)
+	}
+
+	oidcRequest, err := NewRequest(time.Minute, "https://example.com/callback")
+	require.NoError(err)
+	priv, _, alg, _ := tp.SigningKeys()
+	claims := map[string]interface{}{
+		"iss":   tp.Addr(),
+		"aud":   "test-client-id",
+		"sub":   "alice@example.com",
+		"nonce": oidcRequest.Nonce(),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}
+	idToken := IDToken(TestSignJWT(t, priv, alg, claims, nil))
+	for _, p := range providers {
+		_, err := p.VerifyIDToken(ctx, idToken, oidcRequest)
+		require.NoError(err)
+	}
+	assert.Equal(uint64(1), cache.Stats().Fetches)
+	assert.Equal(uint64(2), cache.Stats().Hits)
+}
+
+// testJWKSServer is an http server which serves a JWKS with a single key and
+// counts the requests it receives.
+type testJWKSServer struct {
+	*httptest.Server
+	requests int64
+	failures int64
+
+	mu    sync.Mutex
+	keys  jose.JSONWebKeySet
+	delay time.Duration
+}
+
+func newTestJWKSServer(t *testing.T, pub crypto.PublicKey, keyID string) *testJWKSServer {
+	t.Helper()
+	s := &testJWKSServer{}
+	s.setKey(pub, keyID)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(&s.requests, 1)
+		if atomic.AddInt64(&s.failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if req.URL.Path != "/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.mu.Lock()
+		keys, delay := s.keys, s.delay
+		s.mu.Unlock()
+		time.Sleep(delay)
+		_ = json.NewEncoder(w).Encode(keys)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testJWKSServer) setKey(pub crypto.PublicKey, keyID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: pub, KeyID: keyID, Algorithm: string(ES256), Use: "sig"}}}
+}
+
+func (s *testJWKSServer) setDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// setFailures causes the next n requests to fail with a 503
+func (s *testJWKSServer) setFailures(n int64) {
+	atomic.StoreInt64(&s.failures, n)
+}
+
+func (s *testJWKSServer) count() int64 {
+	return atomic.LoadInt64(&s.requests)
+}
@@ -0,0 +1,133 @@
+package oidc
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/cap/oidc/internal/strutils"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// JWKSPins restricts the keys which are accepted from a provider's jwks_uri,
+// for deployments which don't want to trust whatever keys the jwks_uri serves
+// (for example, after a DNS or issuer compromise).  Tokens signed by a key
+// which isn't pinned fail verification with an error wrapping
+// ErrUnpinnedKey, even when the key is published by the jwks_uri.
+//
+// Keys can be pinned by their key ID (kid) and by their RFC 7638 thumbprint.
+// When both are provided, a key must match both.  A kid is chosen by the
+// provider, so pinning thumbprints is the stronger choice.  Out-of-band key
+// sets (like one distributed with the app's configuration) can be pinned with
+// NewJWKSPinsFromKeySet(...).  Pins must be updated when the provider rotates
+// its keys.
+type JWKSPins struct {
+	// KeyIDs are the pinned key IDs.
+	KeyIDs []string
+
+	// Thumbprints are the pinned keys' base64url (no padding) encoded
+	// SHA-256 thumbprints (see JWKThumbprint).
+	Thumbprints []string
+}
+
+// NewJWKSPinsFromKeySet returns JWKSPins which pin the thumbprints of every
+// key in the JSON Web Key Set document (the jwks), which is an out-of-band
+// allow-list of the provider's keys.
+func NewJWKSPinsFromKeySet(jwks []byte) (*JWKSPins, error) {
+	const op = "NewJWKSPinsFromKeySet"
+	var keySet jose.JSONWebKeySet
+	if err := json.Unmarshal(jwks, &keySet); err != nil {
+		return nil, fmt.Errorf("%s: unable to decode key set: %s: %w", op, err, ErrInvalidJWKs)
+	}
+	if len(keySet.Keys) == 0 {
+		return nil, fmt.Errorf("%s: key set is empty: %w", op, ErrInvalidJWKs)
+	}
+	pins := &JWKSPins{}
+	for _, k := range keySet.Keys {
+		t, err := JWKThumbprint(k)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		pins.Thumbprints = append(pins.Thumbprints, t)
+	}
+	return pins, nil
+}
+
+// JWKThumbprint returns the key's base64url (no padding) encoded SHA-256
+// thumbprint (see https://tools.ietf.org/html/rfc7638).
+func JWKThumbprint(key jose.JSONWebKey) (string, error) {
+	const op = "JWKThumbprint"
+	t, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to compute thumbprint: %s: %w", op, err, ErrInvalidJWKs)
+	}
+	return base64.RawURLEncoding.EncodeToString(t), nil
+}
+
+// Validate the pins.  At least one key ID or thumbprint is required, and the
+// thumbprints must be base64url (no padding) encoded SHA-256 hashes.
+func (p *JWKSPins) Validate() error {
+	const op = "JWKSPins.Validate"
+	if p == nil {
+		return fmt.Errorf("%s: pins are nil: %w", op, ErrNilParameter)
+	}
+	if len(p.KeyIDs) == 0 && len(p.Thumbprints) == 0 {
+		return fmt.Errorf("%s: no key IDs or thumbprints are pinned: %w", op, ErrInvalidParameter)
+	}
+	for _, t := range p.Thumbprints {
+		raw, err := base64.RawURLEncoding.DecodeString(t)
+		if err != nil || len(raw) != crypto.SHA256.Size() {
+			return fmt.Errorf("%s: thumbprint %q is not a base64url encoded SHA-256 hash: %w", op, t, ErrInvalidParameter)
+		}
+	}
+	return nil
+}
+
+// copy returns a copy of the pins, including copies of its slices.
+func (p *JWKSPins) copy() *JWKSPins {
+	if p == nil {
+		return nil
+	}
+	return &JWKSPins{
+		KeyIDs:      copyStrings(p.KeyIDs),
+		Thumbprints: copyStrings(p.Thumbprints),
+	}
+}
+
+// pinned returns the keys which are pinned.  Every key is pinned when the pins
+// are nil.
+func (p *JWKSPins) pinned(keys []jose.JSONWebKey) []jose.JSONWebKey {
+	if p == nil {
+		return keys
+	}
+	pinned := make([]jose.JSONWebKey, 0, len(keys))
+	for _, k := range keys {
+		if len(p.KeyIDs) > 0 && !strutils.StrListContains(p.KeyIDs, k.KeyID) {
+			continue
+		}
+		if len(p.Thumbprints) > 0 {
+			t, err := JWKThumbprint(k)
+			if err != nil || !strutils.StrListContains(p.Thumbprints, t) {
+				continue
+			}
+		}
+		pinned = append(pinned, k)
+	}
+	return pinned
+}
+
+// WithJWKSPins provides optional JWKSPins, which restrict the keys accepted
+// from the provider's jwks_uri.
+//
+// Valid for: Config and IssuerKeySet
+func WithJWKSPins(p *JWKSPins) Option {
+	return func(o interface{}) {
+		switch v := o.(type) {
+		case *configOptions:
+			v.withJWKSPins = p
+		case *keySetOptions:
+			v.withJWKSPins = p
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestJWKThumbprint(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	// the example from https://tools.ietf.org/html/rfc7638#section-3.1
+	const rfcKey = `{"kty":"RSA","e":"AQAB","kid":"2011-04-29","n":"0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw"}`
+	var k jose.JSONWebKey
+	require.NoError(json.Unmarshal([]byte(rfcKey), &k))
+	got, err := JWKThumbprint(k)
+	require.NoError(err)
+	assert.Equal("NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", got)
+
+	_, err = JWKThumbprint(jose.JSONWebKey{})
+	require.Error(err)
+	assert.Truef(errors.Is(err, ErrInvalidJWKs), "wanted \"%s\" but got \"%s\"", ErrInvalidJWKs, err)
+}
+
+func TestNewJWKSPinsFromKeySet(t *testing.T) {
+	t.Parallel()
+	pub1, _ := TestGenerateKeys(t)
+	pub2, _ := TestGenerateKeys(t)
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: pub1, KeyID: "key-1"}, {Key: pub2, KeyID: "key-2"}}})
+	require.NoError(t, err)
+	thumbprint := func(pub interface{}) string {
+		tp, err := JWKThumbprint(jose.JSONWebKey{Key: pub})
+		require.NoError(t, err)
+		return tp
+	}
+
+	tests := []struct {
+		name      string
+		jwks      []byte
+		want      *JWKSPins
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "valid", jwks: jwks, want: &JWKSPins{Thumbprints: []string{thumbprint(pub1), thumbprint(pub2)}}},
+		{name: "invalid-json", jwks: []byte("{"), wantErr: true, wantIsErr: ErrInvalidJWKs},
+		{name: "empty", jwks: []byte(`{"keys":[]}`), wantErr: true, wantIsErr: ErrInvalidJWKs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := NewJWKSPinsFromKeySet(tt.jwks)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+			assert.NoError(got.Validate())
+		})
+	}
+}
+
+func TestJWKSPins_Validate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		pins      *JWKSPins
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "key-ids", pins: &JWKSPins{KeyIDs: []string{"key-1"}}},
+		{name: "thumbprints", pins: &JWKSPins{Thumbprints: []string{"NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"}}},
+		{name: "nil", wantErr: true, wantIsErr: ErrNilParameter},
+		{name: "empty", pins: &JWKSPins{}, wantErr: true, wantIsErr: ErrInvalidParameter},
+		{name: "not-base64url", pins: &JWKSPins{Thumbprints: []string{"not/base64url"}}, wantErr: true, wantIsErr: ErrInvalidParameter},
+		{name: "not-sha256", pins: &JWKSPins{Thumbprints: []string{"c2hvcnQ"}}, wantErr: true, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			err := tt.pins.Validate()
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+		})
+	}
+}
+
+func TestJWKSPins_KeySet(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pub, priv := TestGenerateKeys(t)
+	srv := newTestJWKSServer(t, pub, "key-1")
+	jwt := TestSignJWT(t, priv, ES256, map[string]interface{}{"sub": "alice"}, []byte("key-1"))
+	pinned, err := JWKThumbprint(jose.JSONWebKey{Key: pub})
+	require.NoError(t, err)
+	other, err := JWKThumbprint(jose.JSONWebKey{Key: func() interface{} { pub, _ := TestGenerateKeys(t); return pub }()})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		pins    *JWKSPins
+		wantErr bool
+	}{
+		{name: "no-pins"},
+		{name: "key-id", pins: &JWKSPins{KeyIDs: []string{"key-0", "key-1"}}},
+		{name: "thumbprint", pins: &JWKSPins{Thumbprints: []string{pinned}}},
+		{name: "key-id-and-thumbprint", pins: &JWKSPins{KeyIDs: []string{"key-1"}, Thumbprints: []string{pinned}}},
+		{name: "unpinned-key-id", pins: &JWKSPins{KeyIDs: []string{"key-2"}}, wantErr: true},
+		{name: "unpinned-thumbprint", pins: &JWKSPins{Thumbprints: []string{other}}, wantErr: true},
+		{name: "thumbprint-of-another-key-id", pins: &JWKSPins{KeyIDs: []string{"key-2"}, Thumbprints: []string{pinned}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			c, err := NewJWKSCache()
+			require.NoError(err)
+			ks := c.keySet(ctx, srv.URL, nil)
+			ks.pins = tt.pins
+			payload, err := ks.VerifySignature(ctx, jwt)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(convertError(err), ErrUnpinnedKey), "wanted \"%s\" but got \"%s\"", ErrUnpinnedKey, err)
+				return
+			}
+			require.NoError(err)
+			assert.Contains(string(payload), "alice")
+		})
+	}
+}
+
+func TestProvider_JWKSPins(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	priv, pub, alg, keyID := tp.SigningKeys()
+	pinned, err := JWKThumbprint(jose.JSONWebKey{Key: pub})
+	require.NoError(t, err)
+
+	oidcRequest, err := NewRequest(time.Minute, "https://example.com/callback")
+	require.NoError(t, err)
+	idToken := IDToken(TestSignJWT(t, priv, alg, map[string]interface{}{
+		"iss":   tp.Addr(),
+		"aud":   "test-client-id",
+		"sub":   "alice@example.com",
+		"nonce": oidcRequest.Nonce(),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}, []byte(keyID)))
+
+	t.Run("pinned", func(t *testing.T) {
+		require := require.New(t)
+		tc := testNewConfig(t, "test-client-id", "test-client-secret", "https://example.com/callback", tp)
+		tc.JWKSPins = &JWKSPins{Thumbprints: []string{pinned}}
+		p, err := NewProvider(tc)
+		require.NoError(err)
+		defer p.Done()
+		_, err = p.VerifyIDToken(ctx, idToken, oidcRequest)
+		require.NoError(err)
+	})
+	t.Run("unpinned", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tc := testNewConfig(t, "test-client-id", "test-client-secret", "https://example.com/callback", tp)
+		tc.JWKSPins = &JWKSPins{KeyIDs: []string{"another-key-id"}}
+		p, err := NewProvider(tc)
+		require.NoError(err)
+		defer p.Done()
+		_, err = p.VerifyIDToken(ctx, idToken, oidcRequest)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrUnpinnedKey), "wanted \"%s\" but got \"%s\"", ErrUnpinnedKey, err)
+
+		// updating the pins takes effect immediately
+		tc.JWKSPins = &JWKSPins{KeyIDs: []string{keyID}}
+		require.NoError(p.UpdateConfig(tc))
+		_, err = p.VerifyIDToken(ctx, idToken, oidcRequest)
+		require.NoError(err)
+	})
+	t.Run("invalid-pins", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tc := testNewConfig(t, "test-client-id", "test-client-secret", "https://example.com/callback", tp)
+		tc.JWKSPins = &JWKSPins{}
+		_, err := NewProvider(tc)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("issuer-key-set", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		ks, err := IssuerKeySet(ctx, tp.Addr(), WithProviderCA(tp.CACert()), WithJWKSPins(&JWKSPins{KeyIDs: []string{"another-key-id"}}))
+		require.NoError(err)
+		_, err = ks.VerifySignature(ctx, string(idToken))
+		require.Error(err)
+		assert.Truef(errors.Is(convertError(err), ErrUnpinnedKey), "wanted \"%s\" but got \"%s\"", ErrUnpinnedKey, err)
+
+		_, err = IssuerKeySet(ctx, tp.Addr(), WithProviderCA(tp.CACert()), WithJWKSPins(&JWKSPins{}))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
+
+func Test_WithJWKSPins(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	pins := &JWKSPins{KeyIDs: []string{"key-1"}}
+	opts := getConfigOpts(WithJWKSPins(pins))
+	testOpts := configDefaults()
+	testOpts.withJWKSPins = pins
+	assert.Equal(opts, testOpts)
+
+	ksOpts := getKeySetOpts(WithJWKSPins(pins))
+	testKSOpts := keySetDefaults()
+	testKSOpts.withJWKSPins = pins
+	assert.Equal(ksOpts, testKSOpts)
+}
@@ -0,0 +1,266 @@
+package oidc
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// WellKnownJWKSPath is the conventional path for publishing an RP's JWKS.
+const WellKnownJWKSPath = "/.well-known/jwks.json"
+
+// DefaultJWKSRotationGracePeriod is the default amount of time a rotated key
+// continues to be published, which allows providers that cached the RP's
+// previous JWKS to refresh it before the previous key is removed.
+const DefaultJWKSRotationGracePeriod = 24 * time.Hour
+
+// JWKSPublisher publishes an RP's own public keys (like the keys used for
+// private_key_jwt client authentication, signed request objects or DPoP
+// proofs) as a JSON Web Key Set, which providers can fetch using the RP's
+// registered jwks_uri.  A JWKSPublisher is an http.Handler, which is typically
+// served at WellKnownJWKSPath.
+//
+// Keys are rotated using Rotate(...), which publishes the new key immediately
+// and continues to publish the previous keys for a grace period (see
+// WithJWKSRotationGracePeriod), so providers that cached the previous JWKS can
+// still verify what was signed with the previous keys.
+//
+// A JWKSPublisher is safe for concurrent use.
+type JWKSPublisher struct {
+	gracePeriod time.Duration
+	maxAge      time.Duration
+	nowFunc     func() time.Time
+
+	mu   sync.RWMutex
+	keys []publishedKey
+}
+
+// publishedKey is a published key along with when it's retired.  A zero
+// retireAt means the key is published until it's removed.
+type publishedKey struct {
+	jwk      jose.JSONWebKey
+	retireAt time.Time
+}
+
+// NewJWKSPublisher creates a new JWKSPublisher without any keys.
+//
+// Supported options: WithJWKSRotationGracePeriod, WithJWKSMaxAge, WithNow
+func NewJWKSPublisher(opt ...Option) (*JWKSPublisher, error) {
+	const op = "NewJWKSPublisher"
+	opts := getJWKSPublisherOpts(opt...)
+	switch {
+	case opts.withGracePeriod < 0:
+		return nil, fmt.Errorf("%s: rotation grace period must not be negative: %w", op, ErrInvalidParameter)
+	case opts.withMaxAge < 0:
+		return nil, fmt.Errorf("%s: max age must not be negative: %w", op, ErrInvalidParameter)
+	}
+	return &JWKSPublisher{
+		gracePeriod: opts.withGracePeriod,
+		maxAge:      opts.withMaxAge,
+		nowFunc:     opts.withNowFunc,
+	}, nil
+}
+
+// AddKey publishes the public key with the key ID and signing algorithm.  If
+// the key is a crypto.Signer (like a private key), its public key is
+// published.  Key IDs must be unique.
+func (p *JWKSPublisher) AddKey(keyID string, alg Alg, key crypto.PublicKey) error {
+	const op = "JWKSPublisher.AddKey"
+	jwk, err := publicJWK(keyID, alg, key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removeRetired()
+	for _, k := range p.keys {
+		if k.jwk.KeyID == keyID {
+			return fmt.Errorf("%s: key ID %s is already published: %w", op, keyID, ErrInvalidParameter)
+		}
+	}
+	p.keys = append(p.keys, publishedKey{jwk: jwk})
+	return nil
+}
+
+// Rotate publishes the new key and retires every other published key after
+// the publisher's rotation grace period.  The new key is published first, so
+// providers can prefer it.
+func (p *JWKSPublisher) Rotate(keyID string, alg Alg, key crypto.PublicKey) error {
+	const op = "JWKSPublisher.Rotate"
+	jwk, err := publicJWK(keyID, alg, key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removeRetired()
+	retireAt := p.now().Add(p.gracePeriod)
+	keys := make([]publishedKey, 0, len(p.keys)+1)
+	keys = append(keys, publishedKey{jwk: jwk})
+	for _, k := range p.keys {
+		if k.jwk.KeyID == keyID {
+			return fmt.Errorf("%s: key ID %s is already published: %w", op, keyID, ErrInvalidParameter)
+		}
+		if k.retireAt.IsZero() || k.retireAt.After(retireAt) {
+			k.retireAt = retireAt
+		}
+		keys = append(keys, k)
+	}
+	p.keys = keys
+	return nil
+}
+
+// RemoveKey immediately stops publishing the key.  It's not an error to
+// remove a key that isn't published.
+func (p *JWKSPublisher) RemoveKey(keyID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := p.keys[:0]
+	for _, k := range p.keys {
+		if k.jwk.KeyID != keyID {
+			keys = append(keys, k)
+		}
+	}
+	p.keys = keys
+}
+
+// KeySet returns the currently published keys.
+func (p *JWKSPublisher) KeySet() jose.JSONWebKeySet {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	now := p.now()
+	set := jose.JSONWebKeySet{Keys: make([]jose.JSONWebKey, 0, len(p.keys))}
+	for _, k := range p.keys {
+		if !k.retireAt.IsZero() && !now.Before(k.retireAt) {
+			continue
+		}
+		set.Keys = append(set.Keys, k.jwk)
+	}
+	return set
+}
+
+// ServeHTTP implements the http.Handler interface and responds to GET and
+// HEAD requests with the currently published keys.  When the publisher has a
+// max age (see WithJWKSMaxAge), the response's Cache-Control header allows
+// providers to cache the keys for that long.
+func (p *JWKSPublisher) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := json.Marshal(p.KeySet())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if p.maxAge > 0 {
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(p.maxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodGet {
+		_, _ = w.Write(body)
+	}
+}
+
+// removeRetired removes the keys whose grace period has passed.  The caller
+// must hold p.mu.
+func (p *JWKSPublisher) removeRetired() {
+	now := p.now()
+	keys := p.keys[:0]
+	for _, k := range p.keys {
+		if k.retireAt.IsZero() || now.Before(k.retireAt) {
+			keys = append(keys, k)
+		}
+	}
+	p.keys = keys
+}
+
+// now returns the current time using the publisher's optional now func
+func (p *JWKSPublisher) now() time.Time {
+	if p.nowFunc != nil {
+		return p.nowFunc()
+	}
+	return time.Now()
+}
+
+// publicJWK returns the public JWK for the key, and never a private key.
+func publicJWK(keyID string, alg Alg, key crypto.PublicKey) (jose.JSONWebKey, error) {
+	const op = "publicJWK"
+	switch {
+	case keyID == "":
+		return jose.JSONWebKey{}, fmt.Errorf("%s: key ID is empty: %w", op, ErrInvalidParameter)
+	case key == nil:
+		return jose.JSONWebKey{}, fmt.Errorf("%s: key is nil: %w", op, ErrNilParameter)
+	case !supportedAlgorithms[alg]:
+		return jose.JSONWebKey{}, fmt.Errorf("%s: %s is not a supported algorithm: %w", op, alg, ErrUnsupportedAlg)
+	}
+	if signer, ok := key.(crypto.Signer); ok {
+		key = signer.Public()
+	}
+	jwk := jose.JSONWebKey{Key: key, KeyID: keyID, Algorithm: string(alg), Use: "sig"}
+	if !jwk.Valid() || !jwk.IsPublic() {
+		return jose.JSONWebKey{}, fmt.Errorf("%s: key is not a valid public key: %w", op, ErrInvalidParameter)
+	}
+	return jwk, nil
+}
+
+// jwksPublisherOptions is the set of available options for the
+// JWKSPublisher
+type jwksPublisherOptions struct {
+	withGracePeriod time.Duration
+	withMaxAge      time.Duration
+	withNowFunc     func() time.Time
+}
+
+// jwksPublisherDefaults is a handy way to get the defaults at runtime and
+// during unit tests.
+func jwksPublisherDefaults() jwksPublisherOptions {
+	return jwksPublisherOptions{
+		withGracePeriod: DefaultJWKSRotationGracePeriod,
+	}
+}
+
+// getJWKSPublisherOpts gets the JWKSPublisher defaults and applies the opt
+// overrides passed in
+func getJWKSPublisherOpts(opt ...Option) jwksPublisherOptions {
+	opts := jwksPublisherDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithJWKSRotationGracePeriod provides an optional amount of time that
+// rotated keys continue to be published.  The default is
+// DefaultJWKSRotationGracePeriod, which should be longer than the amount of
+// time providers cache the RP's JWKS.
+//
+// Valid for: JWKSPublisher
+func WithJWKSRotationGracePeriod(d time.Duration) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*jwksPublisherOptions); ok {
+			o.withGracePeriod = d
+		}
+	}
+}
+
+// WithJWKSMaxAge provides an optional amount of time that providers may cache
+// the published keys, using the response's Cache-Control header.  The default
+// is zero, which doesn't allow the keys to be cached.
+//
+// Valid for: JWKSPublisher
+func WithJWKSMaxAge(d time.Duration) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*jwksPublisherOptions); ok {
+			o.withMaxAge = d
+		}
+	}
+}
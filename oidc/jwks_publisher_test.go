@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestNewJWKSPublisher(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		opt       []Option
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "valid"},
+		{name: "valid-with-options", opt: []Option{WithJWKSRotationGracePeriod(time.Hour), WithJWKSMaxAge(time.Minute)}},
+		{name: "negative-grace-period", opt: []Option{WithJWKSRotationGracePeriod(-1)}, wantErr: true, wantIsErr: ErrInvalidParameter},
+		{name: "negative-max-age", opt: []Option{WithJWKSMaxAge(-1)}, wantErr: true, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := NewJWKSPublisher(tt.opt...)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Empty(got.KeySet().Keys)
+		})
+	}
+}
+
+func TestJWKSPublisher_AddKey(t *testing.T) {
+	t.Parallel()
+	pub, priv := TestGenerateKeys(t)
+	tests := []struct {
+		name      string
+		keyID     string
+		alg       Alg
+		key       interface{}
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "valid-public-key", keyID: "public", alg: ES256, key: pub},
+		{name: "valid-private-key", keyID: "private", alg: ES256, key: priv},
+		{name: "empty-key-id", alg: ES256, key: pub, wantErr: true, wantIsErr: ErrInvalidParameter},
+		{name: "nil-key", keyID: "nil", alg: ES256, wantErr: true, wantIsErr: ErrNilParameter},
+		{name: "unsupported-alg", keyID: "alg", alg: "none", key: pub, wantErr: true, wantIsErr: ErrUnsupportedAlg},
+		{name: "invalid-key", keyID: "invalid", alg: ES256, key: "not-a-key", wantErr: true, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			p, err := NewJWKSPublisher()
+			require.NoError(err)
+			err = p.AddKey(tt.keyID, tt.alg, tt.key)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			keys := p.KeySet().Keys
+			require.Len(keys, 1)
+			assert.Equal(tt.keyID, keys[0].KeyID)
+			assert.Equal(string(tt.alg), keys[0].Algorithm)
+			assert.Equal("sig", keys[0].Use)
+			assert.True(keys[0].IsPublic())
+			assert.Equal(pub, keys[0].Key)
+
+			err = p.AddKey(tt.keyID, tt.alg, tt.key)
+			require.Error(err)
+			assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+		})
+	}
+}
+
+func TestJWKSPublisher_Rotate(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	pub1, _ := TestGenerateKeys(t)
+	pub2, _ := TestGenerateKeys(t)
+	pub3, _ := TestGenerateKeys(t)
+	now := time.Now()
+	p, err := NewJWKSPublisher(WithJWKSRotationGracePeriod(time.Hour), WithNow(func() time.Time { return now }))
+	require.NoError(err)
+	keyIDs := func() []string {
+		var ids []string
+		for _, k := range p.KeySet().Keys {
+			ids = append(ids, k.KeyID)
+		}
+		return ids
+	}
+
+	require.NoError(p.AddKey("key-1", ES256, pub1))
+	require.NoError(p.Rotate("key-2", ES256, pub2))
+	assert.Equal([]string{"key-2", "key-1"}, keyIDs())
+
+	// the first key's grace period isn't extended by another rotation
+	now = now.Add(30 * time.Minute)
+	require.NoError(p.Rotate("key-3", ES256, pub3))
+	assert.Equal([]string{"key-3", "key-2", "key-1"}, keyIDs())
+
+	now = now.Add(30 * time.Minute)
+	assert.Equal([]string{"key-3", "key-2"}, keyIDs())
+
+	now = now.Add(30 * time.Minute)
+	assert.Equal([]string{"key-3"}, keyIDs())
+
+	err = p.Rotate("key-3", ES256, pub1)
+	require.Error(err)
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+
+	p.RemoveKey("key-3")
+	p.RemoveKey("key-3")
+	assert.Empty(p.KeySet().Keys)
+}
+
+func TestJWKSPublisher_ServeHTTP(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pub, priv := TestGenerateKeys(t)
+
+	t.Run("verify-with-jwks-uri", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, err := NewJWKSPublisher(WithJWKSMaxAge(time.Hour))
+		require.NoError(err)
+		require.NoError(p.AddKey("rp-key", ES256, priv))
+		mux := http.NewServeMux()
+		mux.Handle(WellKnownJWKSPath, p)
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL + WellKnownJWKSPath)
+		require.NoError(err)
+		defer resp.Body.Close()
+		assert.Equal(http.StatusOK, resp.StatusCode)
+		assert.Equal("application/json", resp.Header.Get("Content-Type"))
+		assert.Equal("public, max-age=3600", resp.Header.Get("Cache-Control"))
+		var set jose.JSONWebKeySet
+		require.NoError(json.NewDecoder(resp.Body).Decode(&set))
+		require.Len(set.Keys, 1)
+		assert.Equal(pub, set.Keys[0].Key)
+
+		// a provider fetching the RP's keys by its jwks_uri can verify what
+		// the RP signed
+		cache, err := NewJWKSCache()
+		require.NoError(err)
+		signed := TestSignJWT(t, priv, ES256, map[string]interface{}{"iss": "rp"}, []byte("rp-key"))
+		_, err = cache.KeySet(srv.URL+WellKnownJWKSPath, nil).VerifySignature(ctx, signed)
+		require.NoError(err)
+	})
+	t.Run("no-store", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, err := NewJWKSPublisher()
+		require.NoError(err)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodHead, WellKnownJWKSPath, nil))
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Equal("no-store", w.Header().Get("Cache-Control"))
+		assert.Empty(w.Body.String())
+	})
+	t.Run("method-not-allowed", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, err := NewJWKSPublisher()
+		require.NoError(err)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodPost, WellKnownJWKSPath, nil))
+		assert.Equal(http.StatusMethodNotAllowed, w.Code)
+		assert.Equal("GET, HEAD", w.Header().Get("Allow"))
+	})
+}
+
+func Test_getJWKSPublisherOpts(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	opts := getJWKSPublisherOpts(WithJWKSRotationGracePeriod(time.Hour), WithJWKSMaxAge(time.Minute))
+	testOpts := jwksPublisherDefaults()
+	testOpts.withGracePeriod = time.Hour
+	testOpts.withMaxAge = time.Minute
+	assert.Equal(opts, testOpts)
+}
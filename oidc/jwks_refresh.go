@@ -0,0 +1,61 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WithJWKSRefreshInterval provides an optional interval for refreshing the
+// provider's JWKS in the background, so keys the provider rotates in are
+// cached before its tokens are signed with them, and verifications don't
+// wait for keys to be fetched when they expire.  The interval should be
+// shorter than the JWKSCache's TTL (see WithJWKSCacheTTL).  A failed refresh
+// is recorded (see Provider.DebugSnapshot and WithMetricsSink) and the cached
+// keys continue to be used.  The default of zero disables background
+// refreshes, and keys are only fetched when they're missing, expired or when
+// a token is signed by a key that's not cached.
+//
+// Valid for: Provider
+func WithJWKSRefreshInterval(interval time.Duration) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*providerOptions); ok {
+			o.withJWKSRefreshInterval = interval
+		}
+	}
+}
+
+// startJWKSRefresh refreshes the provider's JWKS in the background every
+// jwksRefreshInterval, until the provider is done.
+func (p *Provider) startJWKSRefresh() {
+	p.runEvery(p.jwksRefreshInterval, func(ctx context.Context) {
+		// failures are recorded by refreshJWKS(...)
+		_ = p.refreshJWKS(ctx)
+	})
+}
+
+// refreshJWKS fetches the provider's JWKS into its cache.  Nothing is fetched
+// before the provider is discovered.
+func (p *Provider) refreshJWKS(ctx context.Context) (e error) {
+	const op = "Provider.refreshJWKS"
+	config := p.currentConfig()
+	p.mu.RLock()
+	keySet := p.keySet
+	p.mu.RUnlock()
+	ks, ok := keySet.(*cachedKeySet)
+	if !ok {
+		return nil
+	}
+	start := time.Now()
+	ctx, span := p.startSpan(ctx, "oidc.JWKSRefresh", config)
+	defer func() {
+		span.End(e)
+		p.recordOperation(config, MetricsOpJWKSRefresh, start, e)
+	}()
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	if err := ks.refresh(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_JWKSRefreshInterval(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redirect := "https://example.com/callback"
+
+	t.Run("rotated-keys", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := StartTestProvider(t)
+		cache, err := NewJWKSCache(WithJWKSCacheTTL(time.Hour))
+		require.NoError(err)
+		tc := testNewConfig(t, "client-id", "client-secret", redirect, tp)
+		tc.JWKSCache = cache
+		p, err := NewProvider(tc, WithJWKSRefreshInterval(10*time.Millisecond))
+		require.NoError(err)
+		defer p.Done()
+		require.Eventually(func() bool { return cache.Stats().Fetches >= 1 }, 5*time.Second, 10*time.Millisecond)
+
+		// the rotated key is fetched in the background, before a token is
+		// signed with it
+		pub, priv := TestGenerateKeys(t)
+		tp.SetSigningKeys(priv, pub, ES256, "rotated-key")
+		fetches := cache.Stats().Fetches
+		require.Eventually(func() bool { return cache.Stats().Fetches >= fetches+2 }, 5*time.Second, 10*time.Millisecond)
+
+		oidcRequest, err := NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		idToken := TestSignJWT(t, priv, ES256, map[string]interface{}{
+			"iss":   tp.Addr(),
+			"aud":   "client-id",
+			"sub":   "alice@example.com",
+			"nonce": oidcRequest.Nonce(),
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}, nil)
+		tc.SupportedSigningAlgs = []Alg{ES256}
+		require.NoError(p.UpdateConfig(tc))
+		_, err = p.VerifyIDToken(ctx, IDToken(idToken), oidcRequest)
+		require.NoError(err)
+		assert.Zero(cache.Stats().Misses)
+	})
+	t.Run("failed-refresh", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := StartTestProvider(t)
+		tc := testNewConfig(t, "client-id", "client-secret", redirect, tp)
+		tc.JWKSCache, _ = NewJWKSCache(WithFetchRetries(0, 0))
+		p, err := NewProvider(tc)
+		require.NoError(err)
+		defer p.Done()
+		tp.SetDisableJWKs(true)
+		err = p.refreshJWKS(ctx)
+		require.Error(err)
+		assert.Equal(uint64(1), p.operationErrors.snapshot()[MetricsOpJWKSRefresh].Count)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		tp := StartTestProvider(t)
+		tc := testNewConfig(t, "client-id", "client-secret", redirect, tp)
+		_, err := NewProvider(tc, WithJWKSRefreshInterval(-time.Second))
+		assert.Truef(t, errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
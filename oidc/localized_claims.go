@@ -0,0 +1,63 @@
+package oidc
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// LocalizedClaim selects the value of a claim which may be returned in
+// multiple languages and scripts, using claim names like "family_name#ja-JP"
+// or "family_name#ja-Kana-JP".  The best match for the locales (ordered by
+// preference, typically the request's ClaimsLocales or UILocales) is
+// returned, along with its language Tag.  When none of the localized values
+// match, or no locales are provided, the claim's unlocalized value (without a
+// language tag) is returned with language.Und.  The bool is false when the
+// claim isn't found.
+//
+// https://openid.net/specs/openid-connect-core-1_0.html#ClaimsLanguagesAndScripts
+func LocalizedClaim(claims map[string]interface{}, name string, locales ...language.Tag) (interface{}, language.Tag, bool) {
+	if len(locales) > 0 {
+		prefix := name + "#"
+		var tags []language.Tag
+		values := map[language.Tag]interface{}{}
+		for k, v := range claims {
+			if !strings.HasPrefix(k, prefix) {
+				continue
+			}
+			tag, err := language.Parse(strings.TrimPrefix(k, prefix))
+			if err != nil {
+				continue
+			}
+			tags = append(tags, tag)
+			values[tag] = v
+		}
+		if len(tags) > 0 {
+			// sorting the tags makes the match deterministic when there are
+			// equally good matches, since claims is a map.
+			sort.Slice(tags, func(i, j int) bool { return tags[i].String() < tags[j].String() })
+			_, i, confidence := language.NewMatcher(tags).Match(locales...)
+			if confidence != language.No {
+				return values[tags[i]], tags[i], true
+			}
+		}
+	}
+	v, ok := claims[name]
+	return v, language.Und, ok
+}
+
+// LocalizedStringClaim is the same as LocalizedClaim, except the claim's
+// value must be a string.  The bool is false when the claim isn't found or
+// isn't a string.
+func LocalizedStringClaim(claims map[string]interface{}, name string, locales ...language.Tag) (string, language.Tag, bool) {
+	v, tag, ok := LocalizedClaim(claims, name, locales...)
+	if !ok {
+		return "", language.Und, false
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", language.Und, false
+	}
+	return s, tag, true
+}
@@ -0,0 +1,108 @@
+package oidc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestLocalizedClaim(t *testing.T) {
+	t.Parallel()
+	claims := map[string]interface{}{
+		"family_name":         "Doe",
+		"family_name#ja-Kana": "ドウ",
+		"family_name#ja-Hani": "土井",
+		"family_name#es":      "Díaz",
+		"family_name#bad tag": "ignored",
+		"nickname#fr":         "Jeannot",
+		"age":                 float64(42),
+	}
+	tests := []struct {
+		name    string
+		claim   string
+		locales []language.Tag
+		want    interface{}
+		wantTag language.Tag
+		wantOk  bool
+	}{
+		{
+			name:    "no-locales",
+			claim:   "family_name",
+			want:    "Doe",
+			wantTag: language.Und,
+			wantOk:  true,
+		},
+		{
+			name:    "exact",
+			claim:   "family_name",
+			locales: []language.Tag{language.MustParse("ja-Kana")},
+			want:    "ドウ",
+			wantTag: language.MustParse("ja-Kana"),
+			wantOk:  true,
+		},
+		{
+			name:    "region",
+			claim:   "family_name",
+			locales: []language.Tag{language.MustParse("es-MX")},
+			want:    "Díaz",
+			wantTag: language.Spanish,
+			wantOk:  true,
+		},
+		{
+			name:    "preference-order",
+			claim:   "family_name",
+			locales: []language.Tag{language.German, language.Spanish, language.Japanese},
+			want:    "Díaz",
+			wantTag: language.Spanish,
+			wantOk:  true,
+		},
+		{
+			name:    "no-match",
+			claim:   "family_name",
+			locales: []language.Tag{language.German},
+			want:    "Doe",
+			wantTag: language.Und,
+			wantOk:  true,
+		},
+		{
+			name:    "no-match-no-default",
+			claim:   "nickname",
+			locales: []language.Tag{language.German},
+			wantTag: language.Und,
+		},
+		{
+			name:    "localized-only",
+			claim:   "nickname",
+			locales: []language.Tag{language.French},
+			want:    "Jeannot",
+			wantTag: language.French,
+			wantOk:  true,
+		},
+		{
+			name:    "missing",
+			claim:   "given_name",
+			locales: []language.Tag{language.English},
+			wantTag: language.Und,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			got, gotTag, gotOk := LocalizedClaim(claims, tt.claim, tt.locales...)
+			assert.Equal(tt.want, got)
+			assert.Equal(tt.wantTag, gotTag)
+			assert.Equal(tt.wantOk, gotOk)
+		})
+	}
+	t.Run("string", func(t *testing.T) {
+		assert := assert.New(t)
+		got, gotTag, ok := LocalizedStringClaim(claims, "family_name", language.Spanish)
+		assert.True(ok)
+		assert.Equal("Díaz", got)
+		assert.Equal(language.Spanish, gotTag)
+
+		_, _, ok = LocalizedStringClaim(claims, "age")
+		assert.False(ok)
+	})
+}
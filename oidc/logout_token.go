@@ -0,0 +1,92 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+)
+
+// BackChannelLogoutEvent is the event member of a logout token's events
+// claim.
+const BackChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// LogoutToken is a verified back-channel logout token, which the provider
+// sends to the relying party when one of its end-user's sessions is logged
+// out.  The relying party should log out the sessions with the token's
+// SessionID or (when it doesn't have one) Subject.
+//
+// See: https://openid.net/specs/openid-connect-backchannel-1_0.html#LogoutToken
+type LogoutToken struct {
+	// Issuer is the token's issuer (iss).
+	Issuer string
+
+	// Subject is the end-user's subject (sub), which is empty when the token
+	// only has a SessionID.
+	Subject string
+
+	// SessionID is the provider's session ID (sid) of the end-user's session,
+	// which is empty when the token only has a Subject.
+	SessionID string
+
+	// ID is the token's unique ID (jti), which can be used to detect replayed
+	// tokens.
+	ID string
+
+	// Claims are all of the token's claims.
+	Claims map[string]interface{}
+}
+
+// VerifyLogoutToken verifies a back-channel logout token.  Its signature, iss,
+// aud, azp, iat and exp are verified like an id_token's (see
+// Provider.VerifyIDToken), except its signing algorithm must be one of the
+// config's LogoutTokenSigningAlgs (when they're provided), and then:
+//
+//   - it must have a sub or sid claim (or both).
+//
+//   - its events claim must have a BackChannelLogoutEvent member.
+//
+//   - it must not have a nonce claim, so an id_token can't be used as a
+//     logout token.
+//
+// An error wrapping ErrInvalidLogoutToken is returned when a claim isn't
+// valid.  Replayed tokens aren't detected, which is left to the caller (see
+// LogoutToken.ID).
+//
+// See: https://openid.net/specs/openid-connect-backchannel-1_0.html#Validation
+func (p *Provider) VerifyLogoutToken(ctx context.Context, t string) (*LogoutToken, error) {
+	const op = "Provider.VerifyLogoutToken"
+	if t == "" {
+		return nil, fmt.Errorf("%s: logout token is empty: %w", op, ErrInvalidParameter)
+	}
+	if len(t) > MaxTokenSize {
+		return nil, fmt.Errorf("%s: logout token is larger than %d bytes: %w", op, MaxTokenSize, ErrMalformedToken)
+	}
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	config := p.currentConfig()
+	_, keySet, err := p.discovered(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	verifier := newJWTVerifier(config, keySet, config.logoutTokenSigningAlgs())
+	claims, err := verifyIDTokenClaims(ctx, config, verifier, IDToken(t), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	lt := &LogoutToken{Claims: claims}
+	lt.Issuer, _ = claims["iss"].(string)
+	lt.Subject, _ = claims["sub"].(string)
+	lt.SessionID, _ = claims["sid"].(string)
+	lt.ID, _ = claims["jti"].(string)
+	if lt.Subject == "" && lt.SessionID == "" {
+		return nil, fmt.Errorf("%s: missing sub and sid claims: %w", op, ErrInvalidLogoutToken)
+	}
+	events, _ := claims["events"].(map[string]interface{})
+	if _, ok := events[BackChannelLogoutEvent].(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("%s: events claim doesn't have a %s member: %w", op, BackChannelLogoutEvent, ErrInvalidLogoutToken)
+	}
+	if _, ok := claims["nonce"]; ok {
+		return nil, fmt.Errorf("%s: prohibited nonce claim: %w", op, ErrInvalidLogoutToken)
+	}
+	return lt, nil
+}
@@ -0,0 +1,109 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_VerifyLogoutToken(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	p := testNewProvider(t, "test-client-id", "test-client-secret", "https://example.com/callback", tp)
+	priv, _, alg, _ := tp.SigningKeys()
+
+	logoutClaims := func(overrides map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"iss":    tp.Addr(),
+			"aud":    []string{"test-client-id"},
+			"iat":    time.Now().Unix(),
+			"exp":    time.Now().Add(time.Minute).Unix(),
+			"jti":    "test-jti",
+			"sub":    "alice@example.com",
+			"sid":    "test-sid",
+			"events": map[string]interface{}{BackChannelLogoutEvent: map[string]interface{}{}},
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(claims, k)
+				continue
+			}
+			claims[k] = v
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		want      *LogoutToken
+		wantIsErr error
+	}{
+		{
+			name:  "valid",
+			token: TestSignJWT(t, priv, alg, logoutClaims(nil), nil),
+			want:  &LogoutToken{Issuer: tp.Addr(), Subject: "alice@example.com", SessionID: "test-sid", ID: "test-jti"},
+		},
+		{
+			name:  "only-sid",
+			token: TestSignJWT(t, priv, alg, logoutClaims(map[string]interface{}{"sub": nil}), nil),
+			want:  &LogoutToken{Issuer: tp.Addr(), SessionID: "test-sid", ID: "test-jti"},
+		},
+		{
+			name:      "missing-sub-and-sid",
+			token:     TestSignJWT(t, priv, alg, logoutClaims(map[string]interface{}{"sub": nil, "sid": nil}), nil),
+			wantIsErr: ErrInvalidLogoutToken,
+		},
+		{
+			name:      "missing-event",
+			token:     TestSignJWT(t, priv, alg, logoutClaims(map[string]interface{}{"events": map[string]interface{}{"other": map[string]interface{}{}}}), nil),
+			wantIsErr: ErrInvalidLogoutToken,
+		},
+		{
+			name:      "nonce",
+			token:     TestSignJWT(t, priv, alg, logoutClaims(map[string]interface{}{"nonce": "test-nonce"}), nil),
+			wantIsErr: ErrInvalidLogoutToken,
+		},
+		{
+			name:      "wrong-audience",
+			token:     TestSignJWT(t, priv, alg, logoutClaims(map[string]interface{}{"aud": []string{"other-client"}}), nil),
+			wantIsErr: ErrInvalidAuthorizedParty,
+		},
+		{
+			name:      "expired",
+			token:     TestSignJWT(t, priv, alg, logoutClaims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}), nil),
+			wantIsErr: ErrExpiredToken,
+		},
+		{
+			name:      "empty",
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "too-large",
+			token:     strings.Repeat("a", MaxTokenSize+1),
+			wantIsErr: ErrMalformedToken,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := p.VerifyLogoutToken(ctx, tt.token)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.NotEmpty(got.Claims)
+			got.Claims = nil
+			assert.Equal(tt.want, got)
+		})
+	}
+}
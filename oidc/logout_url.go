@@ -0,0 +1,71 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// LogoutURL returns a URL for RP-initiated logout, which the user agent should
+// be redirected to so the End-User is logged out of the provider (and not
+// just the app).  It uses the end_session_endpoint from the provider's
+// discovery document, and an error wrapping ErrInvalidParameter is returned
+// when the provider doesn't advertise one (see FeatureEndSession).
+//
+// The idTokenHint is the End-User's most recently issued id_token, which is
+// recommended and is used by the provider to identify the session to end.
+// The config's ClientID is always included.  The optional
+// postLogoutRedirectURL is where the provider redirects the user agent after
+// logging out, which must be registered with the provider.  The optional
+// state is returned to the postLogoutRedirectURL, so it requires a
+// postLogoutRedirectURL.
+//
+// See: https://openid.net/specs/openid-connect-rpinitiated-1_0.html
+func (p *Provider) LogoutURL(ctx context.Context, idTokenHint IDToken, postLogoutRedirectURL, state string) (string, error) {
+	const op = "Provider.LogoutURL"
+	config := p.currentConfig()
+	if config == nil {
+		return "", fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
+	}
+	if state != "" && postLogoutRedirectURL == "" {
+		return "", fmt.Errorf("%s: state requires a post logout redirect URL: %w", op, ErrInvalidParameter)
+	}
+	if postLogoutRedirectURL != "" {
+		u, err := url.Parse(postLogoutRedirectURL)
+		if err != nil || !u.IsAbs() {
+			return "", fmt.Errorf("%s: post logout redirect URL %q is not an absolute URL: %w", op, postLogoutRedirectURL, ErrInvalidParameter)
+		}
+	}
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	provider, _, err := p.discovered(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	var m providerMetadata
+	if err := provider.Claims(&m); err != nil {
+		return "", fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+	}
+	if m.EndSessionEndpoint == "" {
+		return "", fmt.Errorf("%s: provider doesn't have an end_session_endpoint: %w", op, ErrInvalidParameter)
+	}
+	endpoint, err := url.Parse(m.EndSessionEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%s: end_session_endpoint %q is an invalid URL: %s: %w", op, m.EndSessionEndpoint, err, ErrInvalidParameter)
+	}
+
+	// the endpoint's own query parameters are kept
+	params := endpoint.Query()
+	params.Set("client_id", config.ClientID)
+	if idTokenHint != "" {
+		params.Set("id_token_hint", string(idTokenHint))
+	}
+	if postLogoutRedirectURL != "" {
+		params.Set("post_logout_redirect_uri", postLogoutRedirectURL)
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+	endpoint.RawQuery = params.Encode()
+	return endpoint.String(), nil
+}
@@ -0,0 +1,70 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_LogoutURL(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	p := testRequestObjectProvider(t, nil, map[string]interface{}{"end_session_endpoint": "https://idp.example.com/logout?tenant=acme"})
+	withoutEndpoint := testRequestObjectProvider(t, nil, nil)
+
+	tests := []struct {
+		name         string
+		p            *Provider
+		idTokenHint  IDToken
+		redirectURL  string
+		state        string
+		want         url.Values
+		wantIsErr    error
+		wantErrMatch string
+	}{
+		{
+			name:        "valid",
+			p:           p,
+			idTokenHint: "id-token",
+			redirectURL: "https://app.example.com/logged-out",
+			state:       "logout-state",
+			want: url.Values{
+				"tenant":                   {"acme"},
+				"client_id":                {"client-id"},
+				"id_token_hint":            {"id-token"},
+				"post_logout_redirect_uri": {"https://app.example.com/logged-out"},
+				"state":                    {"logout-state"},
+			},
+		},
+		{
+			name: "client-id-only",
+			p:    p,
+			want: url.Values{"tenant": {"acme"}, "client_id": {"client-id"}},
+		},
+		{name: "missing-endpoint", p: withoutEndpoint, wantIsErr: ErrInvalidParameter, wantErrMatch: "end_session_endpoint"},
+		{name: "state-without-redirect", p: p, state: "logout-state", wantIsErr: ErrInvalidParameter},
+		{name: "relative-redirect", p: p, redirectURL: "/logged-out", wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := tt.p.LogoutURL(ctx, tt.idTokenHint, tt.redirectURL, tt.state)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				assert.Contains(err.Error(), tt.wantErrMatch)
+				return
+			}
+			require.NoError(err)
+			u, err := url.Parse(got)
+			require.NoError(err)
+			assert.Equal("https://idp.example.com/logout", u.Scheme+"://"+u.Host+u.Path)
+			assert.Equal(tt.want, u.Query())
+		})
+	}
+}
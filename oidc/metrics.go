@@ -0,0 +1,149 @@
+package oidc
+
+import (
+	"errors"
+	"time"
+)
+
+// Operations reported to a MetricsSink via ObserveLatency(...)
+const (
+	MetricsOpDiscovery        = "discovery"
+	MetricsOpExchange         = "exchange"
+	MetricsOpRefreshToken     = "refresh_token"
+	MetricsOpUserInfo         = "userinfo"
+	MetricsOpVerifyIDToken    = "verify_id_token"
+	MetricsOpSAML2BearerGrant = "saml2_bearer_grant"
+	MetricsOpOnBehalfOf       = "on_behalf_of"
+	MetricsOpJWKSRefresh      = "jwks_refresh"
+)
+
+// MetricsSink receives metrics from a Provider and the callback handlers. A
+// sink's methods are called synchronously, so they should be fast and must be
+// safe for concurrent use.  Labels are limited to low cardinality values (the
+// issuer, operation, flow and error type); tokens, codes, secrets, states and
+// nonces are never passed to a sink.
+//
+// See the oidc/metrics/prometheus module for a ready-made Prometheus sink.
+type MetricsSink interface {
+	// IncExchange is called for every authorization code exchange.
+	IncExchange(issuer string, success bool)
+
+	// IncRefresh is called for every refresh_token request.
+	IncRefresh(issuer string, success bool)
+
+	// IncVerificationFailure is called for every failed id_token verification.
+	// The errType is the result of MetricsErrorType(...)
+	IncVerificationFailure(issuer, errType string)
+
+	// IncCallback is called for every callback handled, where the flow is
+	// either "authcode" or "implicit".
+	IncCallback(issuer, flow string, success bool)
+
+	// ObserveLatency is called with the duration of every provider operation
+	// (see the MetricsOp constants).
+	ObserveLatency(issuer, operation string, d time.Duration)
+}
+
+// WithMetricsSink provides an optional MetricsSink which receives the
+// provider's metrics.  Metrics are not recorded by default.
+//
+// Valid for: Provider
+func WithMetricsSink(s MetricsSink) Option {
+	return func(o interface{}) {
+		if s == nil {
+			return
+		}
+		if o, ok := o.(*providerOptions); ok {
+			o.withMetricsSink = s
+		}
+	}
+}
+
+// Metrics returns the provider's MetricsSink, which is a no-op sink when the
+// provider wasn't created using WithMetricsSink(...)
+func (p *Provider) Metrics() MetricsSink {
+	if p.metrics == nil {
+		return noopMetricsSink{}
+	}
+	return p.metrics
+}
+
+// metricsErrorTypes maps errors to their MetricsErrorType(...) in the order
+// they're checked.
+var metricsErrorTypes = []struct {
+	err     error
+	errType string
+}{
+	{ErrExpiredToken, "expired_token"},
+	{ErrInvalidSignature, "invalid_signature"},
+	{ErrInvalidIssuer, "invalid_issuer"},
+	{ErrInvalidAudience, "invalid_audience"},
+	{ErrInvalidAuthorizedParty, "invalid_authorized_party"},
+	{ErrInvalidNonce, "invalid_nonce"},
+	{ErrInvalidNotBefore, "invalid_not_before"},
+	{ErrInvalidIssuedAt, "invalid_issued_at"},
+	{ErrInvalidAtHash, "invalid_at_hash"},
+	{ErrInvalidCodeHash, "invalid_code_hash"},
+	{ErrExpiredAuthTime, "expired_auth_time"},
+	{ErrInvalidACR, "invalid_acr"},
+	{ErrMissingClaim, "missing_claim"},
+	{ErrUnsupportedAlg, "unsupported_alg"},
+	{ErrTokenNotSigned, "token_not_signed"},
+	{ErrDecryptionFailed, "decryption_failed"},
+	{ErrMalformedToken, "malformed_token"},
+	{ErrInvalidJWKs, "invalid_jwks"},
+	{ErrMissingIDToken, "missing_id_token"},
+	{ErrMissingAccessToken, "missing_access_token"},
+	{ErrInvalidParameter, "invalid_parameter"},
+	{ErrNilParameter, "nil_parameter"},
+}
+
+// MetricsErrorType classifies the err as a low cardinality label suitable for
+// metrics.  It returns "none" for a nil err and "unknown" when the err isn't
+// one of the package's well known errors.
+func MetricsErrorType(err error) string {
+	if err == nil {
+		return "none"
+	}
+	for _, t := range metricsErrorTypes {
+		if errors.Is(err, t.err) {
+			return t.errType
+		}
+	}
+	return "unknown"
+}
+
+// recordOperation reports an operation's latency and outcome to the
+// provider's sink, and counts its error for Provider.DebugSnapshot.
+func (p *Provider) recordOperation(config *Config, operation string, start time.Time, err error) {
+	if err != nil {
+		p.operationErrors.record(config, operation, err)
+	}
+	if p.metrics == nil {
+		return
+	}
+	var issuer string
+	if config != nil {
+		issuer = config.Issuer
+	}
+	p.metrics.ObserveLatency(issuer, operation, time.Since(start))
+	switch operation {
+	case MetricsOpExchange:
+		p.metrics.IncExchange(issuer, err == nil)
+	case MetricsOpRefreshToken:
+		p.metrics.IncRefresh(issuer, err == nil)
+	case MetricsOpVerifyIDToken:
+		if err != nil {
+			p.metrics.IncVerificationFailure(issuer, MetricsErrorType(err))
+		}
+	}
+}
+
+// noopMetricsSink is a MetricsSink that discards everything
+type noopMetricsSink struct{}
+
+func (noopMetricsSink) IncExchange(string, bool)                     {}
+func (noopMetricsSink) IncRefresh(string, bool)                      {}
+func (noopMetricsSink) IncVerificationFailure(string, string)        {}
+func (noopMetricsSink) IncCallback(string, string, bool)             {}
+func (noopMetricsSink) ObserveLatency(string, string, time.Duration) {}
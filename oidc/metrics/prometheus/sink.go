@@ -0,0 +1,111 @@
+// Package prometheus provides an oidc.MetricsSink which records the metrics
+// of oidc Providers and callbacks using Prometheus collectors.
+//
+// Example:
+//
+//	sink, err := prometheus.NewSink("myapp", prom.DefaultRegisterer)
+//	if err != nil {
+//	  // handle err
+//	}
+//	p, err := oidc.NewProvider(pc, oidc.WithMetricsSink(sink))
+package prometheus
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Sink is an oidc.MetricsSink backed by Prometheus collectors.  Its metrics
+// are:
+//   * <namespace>_oidc_exchanges_total{issuer,success}
+//   * <namespace>_oidc_refreshes_total{issuer,success}
+//   * <namespace>_oidc_verification_failures_total{issuer,error_type}
+//   * <namespace>_oidc_callbacks_total{issuer,flow,success}
+//   * <namespace>_oidc_provider_latency_seconds{issuer,operation}
+type Sink struct {
+	exchanges            *prom.CounterVec
+	refreshes            *prom.CounterVec
+	verificationFailures *prom.CounterVec
+	callbacks            *prom.CounterVec
+	latency              *prom.HistogramVec
+}
+
+// ensure that Sink implements the oidc.MetricsSink interface
+var _ oidc.MetricsSink = (*Sink)(nil)
+
+// NewSink creates a Sink and registers its collectors with the registerer.
+// The namespace is optional and prefixes every metric name.
+func NewSink(namespace string, registerer prom.Registerer) (*Sink, error) {
+	const op = "prometheus.NewSink"
+	if registerer == nil {
+		return nil, fmt.Errorf("%s: registerer is nil: %w", op, oidc.ErrNilParameter)
+	}
+	s := &Sink{
+		exchanges: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "oidc",
+			Name:      "exchanges_total",
+			Help:      "Number of authorization code exchanges.",
+		}, []string{"issuer", "success"}),
+		refreshes: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "oidc",
+			Name:      "refreshes_total",
+			Help:      "Number of refresh_token requests.",
+		}, []string{"issuer", "success"}),
+		verificationFailures: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "oidc",
+			Name:      "verification_failures_total",
+			Help:      "Number of failed id_token verifications by error type.",
+		}, []string{"issuer", "error_type"}),
+		callbacks: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "oidc",
+			Name:      "callbacks_total",
+			Help:      "Number of callbacks handled.",
+		}, []string{"issuer", "flow", "success"}),
+		latency: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "oidc",
+			Name:      "provider_latency_seconds",
+			Help:      "Latency of provider operations.",
+			Buckets:   prom.DefBuckets,
+		}, []string{"issuer", "operation"}),
+	}
+	for _, c := range []prom.Collector{s.exchanges, s.refreshes, s.verificationFailures, s.callbacks, s.latency} {
+		if err := registerer.Register(c); err != nil {
+			return nil, fmt.Errorf("%s: unable to register collector: %w", op, err)
+		}
+	}
+	return s, nil
+}
+
+// IncExchange satisfies the oidc.MetricsSink interface.
+func (s *Sink) IncExchange(issuer string, success bool) {
+	s.exchanges.WithLabelValues(issuer, strconv.FormatBool(success)).Inc()
+}
+
+// IncRefresh satisfies the oidc.MetricsSink interface.
+func (s *Sink) IncRefresh(issuer string, success bool) {
+	s.refreshes.WithLabelValues(issuer, strconv.FormatBool(success)).Inc()
+}
+
+// IncVerificationFailure satisfies the oidc.MetricsSink interface.
+func (s *Sink) IncVerificationFailure(issuer, errType string) {
+	s.verificationFailures.WithLabelValues(issuer, errType).Inc()
+}
+
+// IncCallback satisfies the oidc.MetricsSink interface.
+func (s *Sink) IncCallback(issuer, flow string, success bool) {
+	s.callbacks.WithLabelValues(issuer, flow, strconv.FormatBool(success)).Inc()
+}
+
+// ObserveLatency satisfies the oidc.MetricsSink interface.
+func (s *Sink) ObserveLatency(issuer, operation string, d time.Duration) {
+	s.latency.WithLabelValues(issuer, operation).Observe(d.Seconds())
+}
@@ -0,0 +1,74 @@
+package prometheus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSink(t *testing.T) {
+	t.Parallel()
+	t.Run("nil-registerer", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := NewSink("test", nil)
+		require.Error(err)
+		assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+	})
+	t.Run("already-registered", func(t *testing.T) {
+		require := require.New(t)
+		reg := prom.NewPedanticRegistry()
+		_, err := NewSink("test", reg)
+		require.NoError(err)
+		_, err = NewSink("test", reg)
+		require.Error(err)
+	})
+}
+
+func TestSink(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	reg := prom.NewPedanticRegistry()
+	s, err := NewSink("test", reg)
+	require.NoError(err)
+
+	const issuer = "https://example.com"
+	s.IncExchange(issuer, true)
+	s.IncExchange(issuer, false)
+	s.IncRefresh(issuer, true)
+	s.IncVerificationFailure(issuer, oidc.MetricsErrorType(oidc.ErrExpiredToken))
+	s.IncCallback(issuer, "authcode", true)
+	s.ObserveLatency(issuer, oidc.MetricsOpExchange, 50*time.Millisecond)
+
+	assert.Equal(1.0, testutil.ToFloat64(s.exchanges.WithLabelValues(issuer, "true")))
+	assert.Equal(1.0, testutil.ToFloat64(s.exchanges.WithLabelValues(issuer, "false")))
+	assert.Equal(1.0, testutil.ToFloat64(s.refreshes.WithLabelValues(issuer, "true")))
+	assert.Equal(1.0, testutil.ToFloat64(s.verificationFailures.WithLabelValues(issuer, "expired_token")))
+	assert.Equal(1.0, testutil.ToFloat64(s.callbacks.WithLabelValues(issuer, "authcode", "true")))
+
+	const wantLatency = `
+# HELP test_oidc_provider_latency_seconds Latency of provider operations.
+# TYPE test_oidc_provider_latency_seconds histogram
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="0.005"} 0
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="0.01"} 0
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="0.025"} 0
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="0.05"} 1
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="0.1"} 1
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="0.25"} 1
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="0.5"} 1
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="1"} 1
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="2.5"} 1
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="5"} 1
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="10"} 1
+test_oidc_provider_latency_seconds_bucket{issuer="https://example.com",operation="exchange",le="+Inf"} 1
+test_oidc_provider_latency_seconds_sum{issuer="https://example.com",operation="exchange"} 0.05
+test_oidc_provider_latency_seconds_count{issuer="https://example.com",operation="exchange"} 1
+`
+	require.NoError(testutil.GatherAndCompare(reg, strings.NewReader(wantLatency), "test_oidc_provider_latency_seconds"))
+}
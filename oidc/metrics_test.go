@@ -0,0 +1,138 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_metrics(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+	tp.SetExpectedRefreshToken("test-refresh-token")
+
+	sink := &testMetricsSink{}
+	p, err := NewProvider(testNewConfig(t, clientID, "test-client-secret", redirect, tp), WithMetricsSink(sink))
+	require.NoError(err)
+	defer p.Done()
+	assert.Equal(sink, p.Metrics())
+
+	oidcRequest, err := NewRequest(time.Minute, redirect)
+	require.NoError(err)
+	tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+
+	tk, err := p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+	require.NoError(err)
+	_, err = p.Exchange(ctx, oidcRequest, oidcRequest.State(), "bad-code")
+	require.Error(err)
+	_, err = p.RefreshToken(ctx, tk)
+	require.NoError(err)
+	var claims map[string]interface{}
+	require.NoError(p.UserInfo(ctx, tk.StaticTokenSource(), "alice@example.com", &claims))
+	_, err = p.VerifyIDToken(ctx, "not-a-token", oidcRequest)
+	require.Error(err)
+
+	issuer := tp.Addr()
+	assert.Equal(map[string]int{
+		fmt.Sprintf("exchange %s true", issuer):                        1,
+		fmt.Sprintf("exchange %s false", issuer):                       1,
+		fmt.Sprintf("refresh %s true", issuer):                         1,
+		fmt.Sprintf("verification_failure %s malformed_token", issuer): 1,
+	}, sink.counters())
+	assert.Equal(map[string]int{
+		fmt.Sprintf("%s %s", issuer, MetricsOpDiscovery):     1,
+		fmt.Sprintf("%s %s", issuer, MetricsOpExchange):      2,
+		fmt.Sprintf("%s %s", issuer, MetricsOpRefreshToken):  1,
+		fmt.Sprintf("%s %s", issuer, MetricsOpUserInfo):      1,
+		fmt.Sprintf("%s %s", issuer, MetricsOpVerifyIDToken): 3,
+	}, sink.latencies())
+
+	// without a sink, the provider's metrics are discarded
+	noSink := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+	assert.Equal(noopMetricsSink{}, noSink.Metrics())
+}
+
+func TestMetricsErrorType(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, "none"},
+		{"unknown", errors.New("unknown"), "unknown"},
+		{"expired", ErrExpiredToken, "expired_token"},
+		{"wrapped", fmt.Errorf("op: invalid id_token: %w", ErrInvalidSignature), "invalid_signature"},
+		{"first-match", fmt.Errorf("%s: %w", ErrInvalidParameter, ErrInvalidAudience), "invalid_audience"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MetricsErrorType(tt.err))
+		})
+	}
+}
+
+// testMetricsSink is a MetricsSink which records the metrics it receives
+type testMetricsSink struct {
+	mu      sync.Mutex
+	counts  map[string]int
+	latency map[string]int
+}
+
+func (s *testMetricsSink) inc(format string, a ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts == nil {
+		s.counts = map[string]int{}
+	}
+	s.counts[fmt.Sprintf(format, a...)]++
+}
+
+func (s *testMetricsSink) IncExchange(issuer string, success bool) {
+	s.inc("exchange %s %t", issuer, success)
+}
+
+func (s *testMetricsSink) IncRefresh(issuer string, success bool) {
+	s.inc("refresh %s %t", issuer, success)
+}
+
+func (s *testMetricsSink) IncVerificationFailure(issuer, errType string) {
+	s.inc("verification_failure %s %s", issuer, errType)
+}
+
+func (s *testMetricsSink) IncCallback(issuer, flow string, success bool) {
+	s.inc("callback %s %s %t", issuer, flow, success)
+}
+
+func (s *testMetricsSink) ObserveLatency(issuer, operation string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latency == nil {
+		s.latency = map[string]int{}
+	}
+	s.latency[issuer+" "+operation]++
+}
+
+func (s *testMetricsSink) counters() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts
+}
+
+func (s *testMetricsSink) latencies() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latency
+}
@@ -0,0 +1,34 @@
+package oidc
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// withClientCertificates returns the transport with the client certificates
+// presented during its TLS handshakes.  The transport's TLS config is cloned,
+// so it's not modified.
+func withClientCertificates(tr *http.Transport, certs []tls.Certificate) *http.Transport {
+	if len(certs) == 0 {
+		return tr
+	}
+	tlsConfig := &tls.Config{}
+	if tr.TLSClientConfig != nil {
+		tlsConfig = tr.TLSClientConfig.Clone()
+	}
+	tlsConfig.Certificates = certs
+	tr.TLSClientConfig = tlsConfig
+	return tr
+}
+
+// WithClientCertificates provides optional client certificates for mutual TLS
+// with the provider (see Config.ClientCertificates).
+//
+// Valid for: Config
+func WithClientCertificates(certs ...tls.Certificate) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withClientCertificates = certs
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClientCertificate returns a new self-signed client certificate.
+func testClientCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	require := require.New(t)
+	pub, priv := TestGenerateKeys(t)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	require.NoError(err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv, Leaf: leaf}
+}
+
+func Test_withClientCertificates(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	cert := testClientCertificate(t)
+
+	tr := &http.Transport{}
+	assert.Equal(tr, withClientCertificates(tr, nil))
+	assert.Nil(tr.TLSClientConfig)
+
+	tr = withClientCertificates(tr, []tls.Certificate{cert})
+	assert.Equal([]tls.Certificate{cert}, tr.TLSClientConfig.Certificates)
+
+	// the transport's TLS config is cloned
+	tlsConfig := &tls.Config{ServerName: "example.com"}
+	tr = withClientCertificates(&http.Transport{TLSClientConfig: tlsConfig}, []tls.Certificate{cert})
+	assert.Empty(tlsConfig.Certificates)
+	assert.Equal("example.com", tr.TLSClientConfig.ServerName)
+	assert.Equal([]tls.Certificate{cert}, tr.TLSClientConfig.Certificates)
+}
+
+func TestConfig_clientCertificates(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	cert := testClientCertificate(t)
+	redirect := []string{"https://example.com/callback"}
+
+	c, err := NewConfig("https://example.com", "client-id", "", []Alg{ES256}, redirect, WithClientCertificates(cert))
+	require.NoError(err)
+	assert.Equal([]tls.Certificate{cert}, c.ClientCertificates)
+	cp := c.copy()
+	cp.ClientCertificates[0] = tls.Certificate{}
+	assert.Equal([]tls.Certificate{cert}, c.ClientCertificates)
+
+	r := NewTransportRegistry()
+	defer r.CloseIdleConnections()
+	_, err = NewConfig("https://example.com", "client-id", "", []Alg{ES256}, redirect, WithClientCertificates(cert), WithTransportRegistry(r))
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+}
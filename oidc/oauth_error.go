@@ -0,0 +1,141 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// OAuthError is an unsuccessful response from a provider's token or userinfo
+// endpoint, which is returned by Provider.Exchange, Provider.RefreshToken and
+// Provider.UserInfo instead of requiring callers to match error strings like
+// "401 Unauthorized".  Use errors.As to get an OAuthError from the returned
+// error:
+//
+//	var oauthErr *oidc.OAuthError
+//	if errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant" {
+//		// the refresh token has expired or been revoked
+//	}
+//
+// The Code, Description and URI are only set when the response's body is an
+// OAuth error response.  See:
+// https://tools.ietf.org/html/rfc6749#section-5.2
+type OAuthError struct {
+	// Code is the response's error code (invalid_grant, invalid_client, etc)
+	Code string `json:"error"`
+
+	// Description is the response's optional human-readable error_description
+	Description string `json:"error_description"`
+
+	// URI is the response's optional error_uri, which identifies a web page
+	// with information about the error
+	URI string `json:"error_uri"`
+
+	// StatusCode is the response's HTTP status code
+	StatusCode int `json:"-"`
+
+	// err is the classified error, which is unwrapped so errors.Is continues
+	// to work with the package's error kinds (ErrNotFound, etc)
+	err error
+}
+
+// Error satisfies the error interface and returns the same message as the
+// error it wraps.
+func (e *OAuthError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	msg := fmt.Sprintf("oauth error: %d", e.StatusCode)
+	if e.Code != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Code)
+	}
+	if e.Description != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Description)
+	}
+	return msg
+}
+
+// Unwrap returns the error wrapped by the OAuthError.
+func (e *OAuthError) Unwrap() error {
+	return e.err
+}
+
+// Retryable returns true when the request may succeed if it's retried later:
+// a 429 or 5xx response, or a temporarily_unavailable or server_error error
+// code.  Responses like invalid_grant or invalid_client are never retryable.
+func (e *OAuthError) Retryable() bool {
+	switch e.Code {
+	case "temporarily_unavailable", "server_error", "slow_down":
+		return true
+	}
+	return isTransientStatus(e.StatusCode)
+}
+
+// Temporary is the same as Retryable.  It allows an OAuthError to be
+// classified like a net.Error.
+func (e *OAuthError) Temporary() bool {
+	return e.Retryable()
+}
+
+var (
+	// retrieveErrorRE matches the message of an oauth2.RetrieveError which has
+	// been formatted into another error (like the token source errors
+	// returned for userinfo requests).
+	retrieveErrorRE = regexp.MustCompile(`(?s)cannot fetch token: ([1-5][0-9][0-9])[^\n]*\nResponse: (.*)$`)
+
+	// statusBodyRE matches the "<status>: <body>" errors returned by the
+	// coreos package for unsuccessful userinfo responses.
+	statusBodyRE = regexp.MustCompile(`(?s)^([1-5][0-9][0-9]) [^:]*: (.*)$`)
+)
+
+// newOAuthError returns an OAuthError wrapping the classified error, when err
+// is an unsuccessful token or userinfo response.  Otherwise, it returns the
+// classified error.
+func newOAuthError(err error, classified error) error {
+	var statusCode int
+	var body []byte
+	var retrieveErr *oauth2.RetrieveError
+	switch {
+	case errors.As(err, &retrieveErr) && retrieveErr.Response != nil:
+		statusCode, body = retrieveErr.Response.StatusCode, retrieveErr.Body
+	default:
+		m := retrieveErrorRE.FindStringSubmatch(err.Error())
+		if m == nil {
+			m = statusBodyRE.FindStringSubmatch(err.Error())
+		}
+		if m == nil {
+			return classified
+		}
+		statusCode, _ = strconv.Atoi(m[1])
+		body = []byte(m[2])
+	}
+	oauthErr := parseOAuthErrorBody(body)
+	oauthErr.StatusCode = statusCode
+	oauthErr.err = classified
+	return oauthErr
+}
+
+// parseOAuthErrorBody parses the error parameters from either a JSON or form
+// encoded response body.  The parameters are left empty when the body isn't
+// an OAuth error response.
+func parseOAuthErrorBody(body []byte) *OAuthError {
+	var oauthErr OAuthError
+	body = []byte(strings.TrimSpace(string(body)))
+	if err := json.Unmarshal(body, &oauthErr); err == nil {
+		return &oauthErr
+	}
+	if values, err := url.ParseQuery(string(body)); err == nil && values.Get("error") != "" {
+		return &OAuthError{
+			Code:        values.Get("error"),
+			Description: values.Get("error_description"),
+			URI:         values.Get("error_uri"),
+		}
+	}
+	return &OAuthError{}
+}
@@ -0,0 +1,149 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func Test_newOAuthError(t *testing.T) {
+	t.Parallel()
+	classified := errors.New("classified")
+	retrieveErr := func(statusCode int, body string) error {
+		return &oauth2.RetrieveError{Response: &http.Response{StatusCode: statusCode, Status: http.StatusText(statusCode)}, Body: []byte(body)}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want *OAuthError
+	}{
+		{
+			name: "json",
+			err:  retrieveErr(http.StatusBadRequest, `{"error":"invalid_grant","error_description":"expired","error_uri":"https://example.com/err"}`),
+			want: &OAuthError{Code: "invalid_grant", Description: "expired", URI: "https://example.com/err", StatusCode: http.StatusBadRequest},
+		},
+		{
+			name: "form",
+			err:  retrieveErr(http.StatusUnauthorized, "error=invalid_client&error_description=bad+secret"),
+			want: &OAuthError{Code: "invalid_client", Description: "bad secret", StatusCode: http.StatusUnauthorized},
+		},
+		{
+			name: "not-oauth-body",
+			err:  retrieveErr(http.StatusBadGateway, "<html>bad gateway</html>"),
+			want: &OAuthError{StatusCode: http.StatusBadGateway},
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("wrapped: %w", retrieveErr(http.StatusBadRequest, `{"error":"invalid_request"}`)),
+			want: &OAuthError{Code: "invalid_request", StatusCode: http.StatusBadRequest},
+		},
+		{
+			name: "userinfo",
+			err:  errors.New(`401 Unauthorized: {"error":"invalid_token","error_description":"token expired"}`),
+			want: &OAuthError{Code: "invalid_token", Description: "token expired", StatusCode: http.StatusUnauthorized},
+		},
+		{
+			name: "userinfo-token-source",
+			err:  errors.New("oidc: get access token: oauth2: cannot fetch token: 400 Bad Request\nResponse: {\"error\":\"invalid_grant\"}"),
+			want: &OAuthError{Code: "invalid_grant", StatusCode: http.StatusBadRequest},
+		},
+		{
+			name: "not-a-response",
+			err:  errors.New("dial tcp: connection refused"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got := newOAuthError(tt.err, classified)
+			if tt.want == nil {
+				assert.Equal(classified, got)
+				return
+			}
+			var oauthErr *OAuthError
+			require.Truef(errors.As(got, &oauthErr), "wanted an *OAuthError but got \"%s\"", got)
+			assert.Equal(tt.want.Code, oauthErr.Code)
+			assert.Equal(tt.want.Description, oauthErr.Description)
+			assert.Equal(tt.want.URI, oauthErr.URI)
+			assert.Equal(tt.want.StatusCode, oauthErr.StatusCode)
+			assert.Truef(errors.Is(got, classified), "wanted \"%s\" but got \"%s\"", classified, got)
+			assert.Equal(classified.Error(), got.Error())
+		})
+	}
+}
+
+func TestOAuthError_Retryable(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		err  *OAuthError
+		want bool
+	}{
+		{"invalid-grant", &OAuthError{Code: "invalid_grant", StatusCode: http.StatusBadRequest}, false},
+		{"unauthorized", &OAuthError{StatusCode: http.StatusUnauthorized}, false},
+		{"too-many-requests", &OAuthError{StatusCode: http.StatusTooManyRequests}, true},
+		{"server-error-status", &OAuthError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"temporarily-unavailable", &OAuthError{Code: "temporarily_unavailable", StatusCode: http.StatusBadRequest}, true},
+		{"server-error-code", &OAuthError{Code: "server_error", StatusCode: http.StatusBadRequest}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			assert.Equal(tt.want, tt.err.Retryable())
+			assert.Equal(tt.want, tt.err.Temporary())
+		})
+	}
+}
+
+func TestOAuthError_Error(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	assert.Equal("oauth error: 400: invalid_grant: expired", (&OAuthError{Code: "invalid_grant", Description: "expired", StatusCode: 400}).Error())
+	assert.Equal("oauth error: 502", (&OAuthError{StatusCode: 502}).Error())
+}
+
+func TestProvider_OAuthError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	p := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+
+	t.Run("exchange", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp.SetExpectedAuthCode("test-code")
+		oidcRequest, err := NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+		_, err = p.Exchange(ctx, oidcRequest, oidcRequest.State(), "wrong-code")
+		require.Error(err)
+		var oauthErr *OAuthError
+		require.Truef(errors.As(err, &oauthErr), "wanted an *OAuthError but got \"%s\"", err)
+		assert.Equal("invalid_grant", oauthErr.Code)
+		assert.Equal("unexpected auth code", oauthErr.Description)
+		assert.Equal(http.StatusUnauthorized, oauthErr.StatusCode)
+		assert.False(oauthErr.Retryable())
+	})
+	t.Run("userinfo", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp.SetDisableUserInfo(true)
+		defer tp.SetDisableUserInfo(false)
+		tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "dummy_access_token", Expiry: time.Now().Add(10 * time.Second)})
+		var claims map[string]interface{}
+		err := p.UserInfo(ctx, tokenSource, "alice@example.com", &claims)
+		require.Error(err)
+		var oauthErr *OAuthError
+		require.Truef(errors.As(err, &oauthErr), "wanted an *OAuthError but got \"%s\"", err)
+		assert.Equal(http.StatusNotFound, oauthErr.StatusCode)
+		assert.Truef(errors.Is(err, ErrNotFound), "wanted \"%s\" but got \"%s\"", ErrNotFound, err)
+	})
+}
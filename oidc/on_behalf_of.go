@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	// JWTBearerGrantType is the grant_type of the JWT bearer assertion grant,
+	// which is used by the on-behalf-of flow.
+	// See: https://tools.ietf.org/html/rfc7523#section-2.1
+	JWTBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+	// OnBehalfOfTokenUse is the requested_token_use of an on-behalf-of request.
+	OnBehalfOfTokenUse = "on_behalf_of"
+)
+
+// OnBehalfOf will request an access token for a downstream API from the
+// provider's token endpoint using the Microsoft on-behalf-of flow, so a
+// middle-tier service can call the downstream API as the end user.  The
+// assertion is the access token the service received (whose audience is the
+// service), and the scopes are the downstream API's scopes (for example:
+// "api://downstream/.default").  The client authenticates with its client
+// secret, or its ClientAssertionSigner when the config has one.
+//
+// Unlike the provider's other grants, the openid scope isn't requested and an
+// id_token isn't required, so the provider's access token response is returned
+// (including its refresh_token, when one is issued).  An error wrapping an
+// OAuthError is returned when the provider rejects the request (for example:
+// an interaction_required error when the end user must consent to the
+// downstream API).
+//
+// See: https://learn.microsoft.com/en-us/entra/identity-platform/v2-oauth2-on-behalf-of-flow
+func (p *Provider) OnBehalfOf(ctx context.Context, assertion AccessToken, scopes ...string) (_ *oauth2.Token, e error) {
+	const op = "Provider.OnBehalfOf"
+	config := p.currentConfig()
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	start := time.Now()
+	ctx, span := p.startSpan(ctx, "oidc.OnBehalfOf", config)
+	defer func() {
+		span.End(e)
+		p.recordOperation(config, MetricsOpOnBehalfOf, start, e)
+	}()
+	switch {
+	case config == nil:
+		return nil, fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
+	case assertion == "":
+		return nil, fmt.Errorf("%s: assertion is empty: %w", op, ErrInvalidParameter)
+	case len(scopes) == 0:
+		return nil, fmt.Errorf("%s: scopes are empty: %w", op, ErrInvalidParameter)
+	}
+	provider, _, err := p.discovered(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	oidcCtx, err := p.limitedClientContext(ctx, tokenEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create http client: %w", op, err)
+	}
+	// the client credentials token source allows its grant_type to be
+	// overridden, which avoids reimplementing the token request.
+	grantConfig := clientcredentials.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: string(config.ClientSecret),
+		TokenURL:     provider.Endpoint().TokenURL,
+		Scopes:       scopes,
+		EndpointParams: map[string][]string{
+			"grant_type":          {JWTBearerGrantType},
+			"assertion":           {string(assertion)},
+			"requested_token_use": {OnBehalfOfTokenUse},
+		},
+		AuthStyle: provider.Endpoint().AuthStyle,
+	}
+	t, err := grantConfig.Token(oidcCtx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to get token from provider: %w", op, newOAuthError(err, convertError(err)))
+	}
+	return t, nil
+}
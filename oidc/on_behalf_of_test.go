@@ -0,0 +1,91 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_OnBehalfOf(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	const incoming = AccessToken("incoming-access-token")
+	downstream := []string{"api://downstream/.default"}
+
+	tests := []struct {
+		name      string
+		assertion AccessToken
+		scopes    []string
+		setup     func(tp *TestProvider)
+		wantErr   bool
+		wantIsErr error
+		wantCode  string
+	}{
+		{
+			name:      "valid",
+			assertion: incoming,
+			scopes:    downstream,
+		},
+		{
+			name:      "valid-with-refresh-token",
+			assertion: incoming,
+			scopes:    downstream,
+			setup:     func(tp *TestProvider) { tp.SetExpectedRefreshToken("refresh-token") },
+		},
+		{
+			name:      "empty-assertion",
+			scopes:    downstream,
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "empty-scopes",
+			assertion: incoming,
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "unexpected-assertion",
+			assertion: "other-access-token",
+			scopes:    downstream,
+			wantErr:   true,
+			wantCode:  "invalid_grant",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			tp := StartTestProvider(t)
+			tp.SetExpectedOnBehalfOfAssertion(string(incoming))
+			if tt.setup != nil {
+				tt.setup(tp)
+			}
+			p := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+			defer p.Done()
+
+			got, err := p.OnBehalfOf(ctx, tt.assertion, tt.scopes...)
+			if tt.wantErr {
+				require.Error(err)
+				if tt.wantIsErr != nil {
+					assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				}
+				if tt.wantCode != "" {
+					var oauthErr *OAuthError
+					require.True(errors.As(err, &oauthErr))
+					assert.Equal(tt.wantCode, oauthErr.Code)
+				}
+				return
+			}
+			require.NoError(err)
+			assert.NotEmpty(got.AccessToken)
+			assert.Equal("Bearer", got.TokenType)
+			assert.Equal(tp.ExpectedRefreshToken(), got.RefreshToken)
+			assert.Equal(downstream[0], got.Extra("scope"))
+		})
+	}
+}
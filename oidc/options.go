@@ -1,6 +1,7 @@
 package oidc
 
 import (
+	"io"
 	"time"
 
 	"github.com/coreos/go-oidc"
@@ -23,9 +24,12 @@ func ApplyOpts(opts interface{}, opt ...Option) {
 }
 
 // WithNow provides an optional func for determining what the current time it
-// is.
+// is.  See WithClock for providing a Config's clock.
 //
-// Valid for: Config, Tk and Request
+// Valid for: Config, Tk, Request, JWKSCache, JWKSPublisher, DomainResolver,
+// ID, VerifySelfIssuedIDToken, EvaluateStepUp, VerifyDPoPProof,
+// Confirmation.VerifyRequest, IssuerVerifier, NewIssuerMigration and
+// NewMemoryReplayCache
 func WithNow(now func() time.Time) Option {
 	return func(o interface{}) {
 		if now == nil {
@@ -38,13 +42,52 @@ func WithNow(now func() time.Time) Option {
 			v.withNowFunc = now
 		case *reqOptions:
 			v.withNowFunc = now
+		case *jwksCacheOptions:
+			v.withNowFunc = now
+		case *idOptions:
+			v.withNowFunc = now
+		case *selfIssuedOptions:
+			v.withNowFunc = now
+		case *jwksPublisherOptions:
+			v.withNowFunc = now
+		case *stepUpOptions:
+			v.withNowFunc = now
+		case *domainResolverOptions:
+			v.withNowFunc = now
+		case *dpopOptions:
+			v.withNowFunc = now
+		case *issuerVerifierOptions:
+			v.withNowFunc = now
+		case *replayCacheOptions:
+			v.withNowFunc = now
+		}
+	}
+}
+
+// WithRandReader provides an optional source of random bytes, which replaces
+// crypto/rand when generating IDs, a Request's state and nonce, and PKCE code
+// verifiers.  It's intended for tests that need deterministic values (for
+// example: golden files of AuthURL output) and must never be used in
+// production, since predictable values defeat the CSRF, replay and code
+// interception protections they provide.  See TestSeededRandReader.
+//
+// Valid for: ID, Request and NewCodeVerifier
+func WithRandReader(r io.Reader) Option {
+	return func(o interface{}) {
+		switch v := o.(type) {
+		case *idOptions:
+			v.withRandReader = r
+		case *reqOptions:
+			v.withRandReader = r
+		case *codeVerifierOptions:
+			v.withRandReader = r
 		}
 	}
 }
 
 // WithScopes provides an optional list of scopes.
 //
-// Valid for: Config and Request
+// Valid for: Config, Request, Provider.SAML2BearerGrant and Provider.WithClient
 func WithScopes(scopes ...string) Option {
 	return func(o interface{}) {
 		if len(scopes) == 0 {
@@ -60,13 +103,23 @@ func WithScopes(scopes ...string) Option {
 			ts := append([]string{oidc.ScopeOpenID}, scopes...)
 			scopes = strutils.RemoveDuplicatesStable(ts, false)
 			v.withScopes = append(v.withScopes, scopes...)
+		case *grantOptions:
+			// need to prepend the oidc.ScopeOpenID
+			ts := append([]string{oidc.ScopeOpenID}, scopes...)
+			scopes = strutils.RemoveDuplicatesStable(ts, false)
+			v.withScopes = append(v.withScopes, scopes...)
+		case *clientOptions:
+			// need to prepend the oidc.ScopeOpenID
+			ts := append([]string{oidc.ScopeOpenID}, scopes...)
+			v.withScopes = strutils.RemoveDuplicatesStable(ts, false)
 		}
 	}
 }
 
 // WithAudiences provides an optional list of audiences.
 //
-//Valid for: Config and Request
+//Valid for: Config, Request, Provider.UserInfo, Provider.VerifiedTokenSource
+//and Provider.WithClient
 func WithAudiences(auds ...string) Option {
 	return func(o interface{}) {
 		if len(auds) == 0 {
@@ -80,6 +133,10 @@ func WithAudiences(auds ...string) Option {
 			v.withAudiences = append(v.withAudiences, auds...)
 		case *userInfoOptions:
 			v.withAudiences = append(v.withAudiences, auds...)
+		case *tokenSourceOptions:
+			v.withAudiences = append(v.withAudiences, auds...)
+		case *clientOptions:
+			v.withAudiences = append(v.withAudiences, auds...)
 		}
 	}
 }
@@ -1,11 +1,13 @@
 package oidc
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/coreos/go-oidc"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestApplyOpts(t *testing.T) {
@@ -40,6 +42,65 @@ func Test_WithNow(t *testing.T) {
 	})
 }
 
+func Test_WithRandReader(t *testing.T) {
+	t.Parallel()
+	t.Run("options", func(t *testing.T) {
+		assert := assert.New(t)
+		r := TestSeededRandReader(t, 1)
+
+		idOpts := getIDOpts(WithRandReader(r))
+		testIDOpts := idDefaults()
+		testIDOpts.withRandReader = r
+		assert.Equal(testIDOpts, idOpts)
+
+		reqOpts := getReqOpts(WithRandReader(r))
+		testReqOpts := reqDefaults()
+		testReqOpts.withRandReader = r
+		assert.Equal(testReqOpts, reqOpts)
+
+		verifierOpts := getCodeVerifierOpts(WithRandReader(r))
+		testVerifierOpts := codeVerifierDefaults()
+		testVerifierOpts.withRandReader = r
+		assert.Equal(testVerifierOpts, verifierOpts)
+	})
+	t.Run("deterministic", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		generate := func(seed int64) []string {
+			r := TestSeededRandReader(t, seed)
+			id, err := NewID(WithRandReader(r))
+			require.NoError(err)
+			hexID, err := NewID(WithAlphabet("0123456789abcdef"), WithRandReader(r))
+			require.NoError(err)
+			verifier, err := NewCodeVerifier(WithRandReader(r))
+			require.NoError(err)
+			oidcRequest, err := NewRequest(time.Minute, "https://redirect", WithRandReader(r))
+			require.NoError(err)
+			return []string{id, hexID, verifier.Verifier(), oidcRequest.State(), oidcRequest.Nonce()}
+		}
+		assert.Equal(generate(1), generate(1))
+		assert.NotEqual(generate(1), generate(2))
+	})
+	t.Run("auth-url", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		ctx := context.Background()
+		redirect := "https://test-redirect"
+		tp := StartTestProvider(t)
+		p := testNewProvider(t, "test-client-id", "test-client-secret", redirect, tp)
+		defer p.Done()
+		authURL := func() string {
+			r := TestSeededRandReader(t, 1)
+			verifier, err := NewCodeVerifier(WithRandReader(r))
+			require.NoError(err)
+			oidcRequest, err := NewRequest(time.Minute, redirect, WithPKCE(verifier), WithRandReader(r))
+			require.NoError(err)
+			got, err := p.AuthURL(ctx, oidcRequest)
+			require.NoError(err)
+			return got
+		}
+		assert.Equal(authURL(), authURL())
+	})
+}
+
 func Test_WithAudiences(t *testing.T) {
 	t.Parallel()
 	t.Run("configOptions", func(t *testing.T) {
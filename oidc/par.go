@@ -0,0 +1,102 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// pushedAuthorizationResponse is the response of a provider's
+// pushed_authorization_request_endpoint.  See:
+// https://tools.ietf.org/html/rfc9126#section-2.2
+type pushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// pushAuthorizationRequest pushes the authentication request's params to the
+// provider's pushed_authorization_request_endpoint, and returns the params of
+// an authentication request which references them using the returned
+// request_uri.  The client authenticates the same way it does for revocation
+// requests, and the requests share the token endpoint's response and rate
+// limits.  See: https://tools.ietf.org/html/rfc9126
+func (p *Provider) pushAuthorizationRequest(ctx context.Context, params url.Values) (url.Values, error) {
+	const op = "Provider.pushAuthorizationRequest"
+	config := p.currentConfig()
+	provider, _, err := p.discovered(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	var m providerMetadata
+	if err := provider.Claims(&m); err != nil {
+		return nil, fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+	}
+	if m.PushedAuthorizationEndpoint == "" {
+		return nil, fmt.Errorf("%s: provider doesn't have a pushed_authorization_request_endpoint: %w", op, ErrPushedAuthorizationFailed)
+	}
+	client, err := p.HTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create http client: %w", op, err)
+	}
+	client = p.endpointClient(client, tokenEndpoint)
+
+	form := url.Values{}
+	for k, v := range params {
+		form[k] = v
+	}
+	form.Set("client_id", config.ClientID)
+	req, err := http.NewRequest(http.MethodPost, m.PushedAuthorizationEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create request: %s: %w", op, err, ErrPushedAuthorizationFailed)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(string(config.ClientSecret)))
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, err, ErrPushedAuthorizationFailed)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to read response body: %s: %w", op, err, ErrPushedAuthorizationFailed)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		oauthErr := parseOAuthErrorBody(body)
+		oauthErr.StatusCode = resp.StatusCode
+		oauthErr.err = fmt.Errorf("%s: %s %s: %w", op, resp.Status, body, ErrPushedAuthorizationFailed)
+		return nil, oauthErr
+	}
+	var pushed pushedAuthorizationResponse
+	if err := json.Unmarshal(body, &pushed); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse response: %s: %w", op, err, ErrPushedAuthorizationFailed)
+	}
+	if pushed.RequestURI == "" {
+		return nil, fmt.Errorf("%s: response is missing the request_uri: %w", op, ErrPushedAuthorizationFailed)
+	}
+	return url.Values{
+		"client_id":   {config.ClientID},
+		"request_uri": {pushed.RequestURI},
+	}, nil
+}
+
+// WithPushedAuthorizationRequest optionally pushes an AuthRequest's
+// parameters (or its request object, see WithRequestObject) to the
+// provider's pushed_authorization_request_endpoint, so the user's browser is
+// only sent the client_id and the request_uri which references them.  It's
+// always used when the config enforces the FAPI profile (see
+// WithFAPIProfile).
+//
+// Valid for: Provider.AuthRequest
+func WithPushedAuthorizationRequest() Option {
+	return func(o interface{}) {
+		if o, ok := o.(*authRequestOptions); ok {
+			o.withPushedAuthorizationRequest = true
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_AuthRequest_pushed(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, priv := TestGenerateKeys(t)
+	signer, err := NewJWTSigner(priv.(crypto.Signer), ES256, "rp-key")
+	require.NoError(t, err)
+
+	type pushed struct {
+		form           url.Values
+		user, password string
+	}
+	var mu sync.Mutex
+	var received []pushed
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/par":
+			_ = req.ParseForm()
+			user, password, _ := req.BasicAuth()
+			mu.Lock()
+			received = append(received, pushed{form: req.PostForm, user: user, password: password})
+			mu.Unlock()
+			if req.PostForm.Get("state") == "rejected-state" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"invalid_request","error_description":"rejected"}`))
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"request_uri":"urn:ietf:params:oauth:request_uri:test","expires_in":60}`))
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"issuer":                                srv.URL,
+				"authorization_endpoint":                srv.URL + "/authorize?tenant=acme",
+				"token_endpoint":                        srv.URL + "/token",
+				"jwks_uri":                              srv.URL + "/jwks",
+				"pushed_authorization_request_endpoint": srv.URL + "/par",
+			})
+		}
+	}))
+	defer srv.Close()
+	c, err := NewConfig(srv.URL, "client-id", "client-secret", []Alg{ES256}, []string{"https://example.com/callback"})
+	require.NoError(t, err)
+	p, err := NewProvider(c)
+	require.NoError(t, err)
+	defer p.Done()
+
+	supported, err := p.Supports(ctx, FeaturePushedAuthorizationRequest)
+	require.NoError(t, err)
+	assert.True(t, supported)
+
+	tests := []struct {
+		name              string
+		opts              []Option
+		state             string
+		wantRequestObject bool
+		wantIsErr         error
+		wantOAuthErr      bool
+	}{
+		{name: "get", opts: []Option{WithPushedAuthorizationRequest()}},
+		{name: "post", opts: []Option{WithPushedAuthorizationRequest(), WithAuthRequestMethod(http.MethodPost)}},
+		{name: "request-object", opts: []Option{WithPushedAuthorizationRequest(), WithRequestObject(signer)}, wantRequestObject: true},
+		{name: "rejected", opts: []Option{WithPushedAuthorizationRequest()}, state: "rejected-state", wantIsErr: ErrPushedAuthorizationFailed, wantOAuthErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			var reqOpts []Option
+			if tt.state != "" {
+				reqOpts = append(reqOpts, WithState(tt.state))
+			}
+			oidcRequest, err := NewRequest(time.Minute, "https://example.com/callback", reqOpts...)
+			require.NoError(err)
+			r, err := p.AuthRequest(ctx, oidcRequest, tt.opts...)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				var oauthErr *OAuthError
+				assert.Equal(tt.wantOAuthErr, errors.As(err, &oauthErr))
+				if tt.wantOAuthErr {
+					assert.Equal("invalid_request", oauthErr.Code)
+					assert.Equal(http.StatusBadRequest, oauthErr.StatusCode)
+				}
+				return
+			}
+			require.NoError(err)
+			params, err := r.Params()
+			require.NoError(err)
+			wantParams := url.Values{
+				"client_id":   {"client-id"},
+				"request_uri": {"urn:ietf:params:oauth:request_uri:test"},
+			}
+			if r.Method == http.MethodGet {
+				// the authorization endpoint's own query parameters are kept
+				wantParams.Set("tenant", "acme")
+			}
+			assert.Equal(wantParams, params)
+
+			mu.Lock()
+			last := received[len(received)-1]
+			mu.Unlock()
+			assert.Equal("client-id", last.user)
+			assert.Equal("client-secret", last.password)
+			assert.Equal("client-id", last.form.Get("client_id"))
+			assert.Empty(last.form.Get("tenant"))
+			if tt.wantRequestObject {
+				assert.NotEmpty(last.form.Get("request"))
+				assert.Empty(last.form.Get("state"))
+				return
+			}
+			assert.Equal(oidcRequest.State(), last.form.Get("state"))
+			assert.Equal("https://example.com/callback", last.form.Get("redirect_uri"))
+		})
+	}
+}
+
+func TestProvider_AuthRequest_pushedWithoutEndpoint(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	p := testRequestObjectProvider(t, nil, nil)
+	oidcRequest, err := NewRequest(time.Minute, "https://example.com/callback")
+	require.NoError(err)
+	_, err = p.AuthRequest(context.Background(), oidcRequest, WithPushedAuthorizationRequest())
+	require.Error(err)
+	assert.Truef(errors.Is(err, ErrPushedAuthorizationFailed), "wanted \"%s\" but got \"%s\"", ErrPushedAuthorizationFailed, err)
+}
@@ -1,9 +1,11 @@
 package oidc
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"io"
 
 	"github.com/hashicorp/cap/oidc/internal/base62"
 )
@@ -51,12 +53,18 @@ type S256Verifier struct {
 // min len of 43 chars per https://tools.ietf.org/html/rfc7636#section-4.1
 const verifierLen = 43
 
-// NewCodeVerifier creates a new CodeVerifier (*S256Verifier).
+// NewCodeVerifier creates a new CodeVerifier (*S256Verifier).  The
+// WithRandReader option is supported.
 //
 // See: https://tools.ietf.org/html/rfc7636#section-4.1
-func NewCodeVerifier() (*S256Verifier, error) {
+func NewCodeVerifier(opt ...Option) (*S256Verifier, error) {
 	const op = "NewCodeVerifier"
-	data, err := base62.Random(verifierLen)
+	opts := getCodeVerifierOpts(opt...)
+	reader := opts.withRandReader
+	if reader == nil {
+		reader = rand.Reader
+	}
+	data, err := base62.RandomWithReader(verifierLen, reader)
 	if err != nil {
 		return nil, fmt.Errorf("%s: unable to create verifier data %w", op, err)
 	}
@@ -97,3 +105,22 @@ func CreateCodeChallenge(v CodeVerifier) (string, error) {
 	sum := h.Sum(nil)
 	return base64.RawURLEncoding.EncodeToString(sum), nil
 }
+
+// codeVerifierOptions is the set of available options for NewCodeVerifier
+type codeVerifierOptions struct {
+	withRandReader io.Reader
+}
+
+// codeVerifierDefaults is a handy way to get the defaults at runtime and
+// during unit tests.
+func codeVerifierDefaults() codeVerifierOptions {
+	return codeVerifierOptions{}
+}
+
+// getCodeVerifierOpts gets the NewCodeVerifier defaults and applies the opt
+// overrides passed in
+func getCodeVerifierOpts(opt ...Option) codeVerifierOptions {
+	opts := codeVerifierDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
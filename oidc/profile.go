@@ -0,0 +1,137 @@
+package oidc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profile is an optional compatibility profile for a major IdP, which
+// adjusts the provider for the IdP's known deviations from the OIDC
+// specification, so integrators don't need their own workarounds.  The zero
+// value ("") is the specification's behavior.
+type Profile string
+
+const (
+	// ProfileAzureAD is Azure AD (Microsoft identity platform).  Refresh
+	// tokens are granted with the offline_access scope, so prompt=consent
+	// isn't added for offline access (it would force the consent page on
+	// every authentication).  See ResolveGroupsOverage for users who are
+	// members of too many groups to fit in a token.
+	ProfileAzureAD Profile = "azure_ad"
+
+	// ProfileGoogle is Google.  Id_tokens may have an issuer (iss) without
+	// the https scheme, and a cross-client id_token's authorized party (azp)
+	// is another of the app's client IDs.  Refresh tokens are requested with
+	// access_type=offline and prompt=consent, since Google rejects the
+	// offline_access scope.
+	ProfileGoogle Profile = "google"
+
+	// ProfileOkta is Okta.  Refresh tokens are granted with the offline_access
+	// scope, and prompt=consent isn't added for offline access, since Okta
+	// rejects it unless user consent is enabled for the app.
+	ProfileOkta Profile = "okta"
+
+	// ProfileAuth0 is Auth0.  The issuer has a trailing slash, which NewConfig
+	// adds when it's missing.  Refresh tokens are granted with the
+	// offline_access scope, without prompt=consent.
+	ProfileAuth0 Profile = "auth0"
+
+	// ProfileCognito is Amazon Cognito.  Refresh tokens are always granted for
+	// the authorization code flow and Cognito rejects the offline_access scope
+	// and prompt=consent, so neither is added for offline access.
+	ProfileCognito Profile = "cognito"
+
+	// ProfileKeycloak is Keycloak.  Refresh tokens are granted with the
+	// offline_access scope, without prompt=consent (which would force the
+	// consent page on every authentication).
+	ProfileKeycloak Profile = "keycloak"
+)
+
+// quirks are the deviations from the specification which are adjusted by a
+// Profile.  The zero value is the specification's behavior.
+type quirks struct {
+	// issuerWithoutScheme allows an id_token's iss to be the config's issuer
+	// without its https scheme.
+	issuerWithoutScheme bool
+
+	// issuerTrailingSlash adds a trailing slash to the config's issuer.
+	issuerTrailingSlash bool
+
+	// foreignAuthorizedParty allows an id_token's azp to be another client,
+	// when its aud includes the config's client_id.
+	foreignAuthorizedParty bool
+
+	// omitOfflineAccessScope doesn't request the offline_access scope for
+	// offline access.
+	omitOfflineAccessScope bool
+
+	// omitOfflineAccessConsent doesn't add prompt=consent for offline access.
+	omitOfflineAccessConsent bool
+
+	// offlineAccessParams are additional auth URL params for offline access.
+	offlineAccessParams map[string]string
+}
+
+// profileQuirks are the quirks for each of the supported profiles.
+var profileQuirks = map[Profile]quirks{
+	"": {},
+	ProfileAzureAD: {
+		omitOfflineAccessConsent: true,
+	},
+	ProfileGoogle: {
+		issuerWithoutScheme:    true,
+		foreignAuthorizedParty: true,
+		omitOfflineAccessScope: true,
+		offlineAccessParams:    map[string]string{"access_type": "offline"},
+	},
+	ProfileOkta: {
+		omitOfflineAccessConsent: true,
+	},
+	ProfileAuth0: {
+		issuerTrailingSlash:      true,
+		omitOfflineAccessConsent: true,
+	},
+	ProfileCognito: {
+		omitOfflineAccessScope:   true,
+		omitOfflineAccessConsent: true,
+	},
+	ProfileKeycloak: {
+		omitOfflineAccessConsent: true,
+	},
+}
+
+// WithProfile provides an optional compatibility Profile for the provider's
+// IdP.
+//
+// Valid for: Config
+func WithProfile(p Profile) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withProfile = p
+		}
+	}
+}
+
+// validProfile checks that the profile is supported.
+func validProfile(p Profile) error {
+	const op = "validProfile"
+	if _, ok := profileQuirks[p]; !ok {
+		return fmt.Errorf("%s: unknown profile %q: %w", op, p, ErrInvalidParameter)
+	}
+	return nil
+}
+
+// quirks returns the quirks of the config's profile.
+func (c *Config) quirks() quirks {
+	return profileQuirks[c.Profile]
+}
+
+// verifyIssuer checks an id_token's iss, when the config's profile allows an
+// issuer which the verifier can't check.
+func (q quirks) verifyIssuer(c *Config, iss string) error {
+	const op = "quirks.verifyIssuer"
+	if iss == c.Issuer || (q.issuerWithoutScheme && iss == strings.TrimPrefix(c.Issuer, "https://")) {
+		return nil
+	}
+	return fmt.Errorf("%s: id token issued by a different provider, expected %q got %q: %w", op, c.Issuer, iss, ErrInvalidIssuer)
+}
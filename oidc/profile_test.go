@@ -0,0 +1,188 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfig_profile(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		issuer     string
+		profile    Profile
+		wantIssuer string
+		wantErr    bool
+		wantIsErr  error
+	}{
+		{name: "default", issuer: "https://example.com", wantIssuer: "https://example.com"},
+		{name: "google", issuer: "https://accounts.google.com", profile: ProfileGoogle, wantIssuer: "https://accounts.google.com"},
+		{name: "auth0", issuer: "https://tenant.auth0.com", profile: ProfileAuth0, wantIssuer: "https://tenant.auth0.com/"},
+		{name: "auth0-with-slash", issuer: "https://tenant.auth0.com/", profile: ProfileAuth0, wantIssuer: "https://tenant.auth0.com/"},
+		{name: "unknown", issuer: "https://example.com", profile: "unknown", wantErr: true, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			c, err := NewConfig(tt.issuer, "client-id", "client-secret", []Alg{RS256}, nil, WithProfile(tt.profile))
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.profile, c.Profile)
+			assert.Equal(tt.wantIssuer, c.Issuer)
+		})
+	}
+}
+
+func TestProvider_AuthURL_profile(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+
+	tests := []struct {
+		profile        Profile
+		wantScope      string
+		wantPrompt     string
+		wantAccessType string
+		withoutOffline bool
+	}{
+		{profile: "", wantScope: "openid offline_access", wantPrompt: "consent"},
+		{profile: ProfileAzureAD, wantScope: "openid offline_access"},
+		{profile: ProfileGoogle, wantScope: "openid", wantPrompt: "consent", wantAccessType: "offline"},
+		{profile: ProfileOkta, wantScope: "openid offline_access"},
+		{profile: ProfileAuth0, wantScope: "openid offline_access"},
+		{profile: ProfileCognito, wantScope: "openid"},
+		{profile: ProfileKeycloak, wantScope: "openid offline_access"},
+		{profile: ProfileGoogle, wantScope: "openid", withoutOffline: true},
+	}
+	for _, tt := range tests {
+		name := string(tt.profile)
+		if name == "" {
+			name = "default"
+		}
+		if tt.withoutOffline {
+			name += "-without-offline-access"
+		}
+		t.Run(name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			c := testNewConfig(t, "test-client-id", "test-client-secret", redirect, tp)
+			c.Profile = tt.profile
+			p, err := NewProvider(c)
+			require.NoError(err)
+			t.Cleanup(p.Done)
+
+			var opts []Option
+			if !tt.withoutOffline {
+				opts = append(opts, WithOfflineAccess())
+			}
+			oidcRequest, err := NewRequest(time.Minute, redirect, opts...)
+			require.NoError(err)
+			got, err := p.AuthURL(ctx, oidcRequest)
+			require.NoError(err)
+			u, err := url.Parse(got)
+			require.NoError(err)
+			assert.Equal(tt.wantScope, u.Query().Get("scope"))
+			assert.Equal(tt.wantPrompt, u.Query().Get("prompt"))
+			assert.Equal(tt.wantAccessType, u.Query().Get("access_type"))
+		})
+	}
+}
+
+func TestProvider_VerifyIDToken_profile(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+
+	tests := []struct {
+		name      string
+		profile   Profile
+		claims    func(tp *TestProvider) map[string]interface{}
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name:    "google-issuer-without-scheme",
+			profile: ProfileGoogle,
+			claims: func(tp *TestProvider) map[string]interface{} {
+				return map[string]interface{}{"iss": strings.TrimPrefix(tp.Addr(), "https://")}
+			},
+		},
+		{
+			name: "default-issuer-without-scheme",
+			claims: func(tp *TestProvider) map[string]interface{} {
+				return map[string]interface{}{"iss": strings.TrimPrefix(tp.Addr(), "https://")}
+			},
+			wantErr:   true,
+			wantIsErr: ErrInvalidIssuer,
+		},
+		{
+			name:    "google-different-issuer",
+			profile: ProfileGoogle,
+			claims: func(tp *TestProvider) map[string]interface{} {
+				return map[string]interface{}{"iss": "https://different.example.com"}
+			},
+			wantErr:   true,
+			wantIsErr: ErrInvalidIssuer,
+		},
+		{
+			name:    "google-cross-client-azp",
+			profile: ProfileGoogle,
+			claims: func(tp *TestProvider) map[string]interface{} {
+				return map[string]interface{}{"azp": "another-client-id"}
+			},
+		},
+		{
+			name: "default-cross-client-azp",
+			claims: func(tp *TestProvider) map[string]interface{} {
+				return map[string]interface{}{"azp": "another-client-id"}
+			},
+			wantErr:   true,
+			wantIsErr: ErrInvalidAuthorizedParty,
+		},
+		{
+			name:    "okta-cross-client-azp",
+			profile: ProfileOkta,
+			claims: func(tp *TestProvider) map[string]interface{} {
+				return map[string]interface{}{"azp": "another-client-id"}
+			},
+			wantErr:   true,
+			wantIsErr: ErrInvalidAuthorizedParty,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			tp := StartTestProvider(t)
+			c := testNewConfig(t, clientID, "test-client-secret", redirect, tp)
+			c.Profile = tt.profile
+			p, err := NewProvider(c)
+			require.NoError(err)
+			t.Cleanup(p.Done)
+
+			oidcRequest, err := NewRequest(time.Minute, redirect)
+			require.NoError(err)
+			tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+			tp.SetCustomClaims(tt.claims(tp))
+
+			_, err = p.VerifyIDToken(ctx, IDToken(tp.issueSignedJWT()), oidcRequest)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+		})
+	}
+}
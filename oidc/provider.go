@@ -2,9 +2,10 @@ package oidc
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -15,8 +16,8 @@ import (
 
 	"github.com/coreos/go-oidc"
 	"github.com/hashicorp/cap/oidc/internal/strutils"
-	"github.com/hashicorp/go-cleanhttp"
 	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
 )
 
 // Provider provides integration with an OIDC provider.
@@ -30,16 +31,58 @@ import (
 //   * Verifying an id_token issued by a provider with p.VerifyIDToken(...)
 //
 //   * Retrieving a user's OAuth claims with p.UserInfo(...)
+//
+// A Provider is safe for concurrent use.  Its config may be replaced while
+// it's in use via p.UpdateConfig(...) and each method call uses a snapshot of
+// the config taken when the call began.
 type Provider struct {
+	// config is never modified once it's assigned to the provider; it's
+	// replaced as a whole by UpdateConfig while holding mu.
 	config   *Config
 	provider *oidc.Provider
 
+	// discoveryGroup ensures concurrent callers share a single lazy discovery
+	// (see WithLazyDiscovery)
+	discoveryGroup singleflight.Group
+
+	// parent is the provider whose discovery, key set and http client are
+	// shared by this child provider (see Provider.WithClient)
+	parent *Provider
+
+	// jwksURL is the jwks_uri from the provider's discovery document
+	jwksURL string
+
+	// discoveredAt is when the provider's discovery document was fetched
+	discoveredAt time.Time
+
+	// discoveryTTL is how often the discovery document is refreshed in the
+	// background (see WithDiscoveryTTL)
+	discoveryTTL time.Duration
+
+	// jwksRefreshInterval is how often the JWKS is refreshed in the
+	// background (see WithJWKSRefreshInterval)
+	jwksRefreshInterval time.Duration
+
+	// keySet verifies id_token signatures using keys from the provider's
+	// jwks_uri which are shared via the config's JWKSCache.
+	keySet oidc.KeySet
+
 	// client uses a pooled transport that uses the config's ProviderCA if
 	// provided, otherwise it will use the installed system CA chain.  This
 	// client's resources idle connections are closed in Provider.Done()
 	client *http.Client
 
-	mu sync.Mutex
+	// verifier is the most recently built id_token verifier
+	verifier *providerVerifier
+
+	// sharedTransport is true when the client's transport is from the config's
+	// TransportRegistry, in which case its idle connections are not closed in
+	// Provider.Done()
+	sharedTransport bool
+
+	// mu guards config, provider, jwksURL, discoveredAt, keySet, verifier,
+	// client, sharedTransport and backgroundCtxCancel
+	mu sync.RWMutex
 
 	// backgroundCtx is the context used by the provider for background
 	// activities like: refreshing JWKs Key sets, refreshing tokens, etc
@@ -48,51 +91,316 @@ type Provider struct {
 	// backgroundCtxCancel is used to cancel any background activities running
 	// in spawned go routines.
 	backgroundCtxCancel context.CancelFunc
+
+	// background tracks the provider's running background activities, so
+	// Provider.Close can wait for them to stop.
+	background sync.WaitGroup
+
+	// health is the provider's most recent health status
+	health providerHealth
+
+	// tracer creates the provider's trace spans (see WithTracer), and is nil
+	// when tracing isn't enabled
+	tracer Tracer
+
+	// operationTimeout limits each of the provider's network operations when
+	// the operation's ctx doesn't have a deadline (see WithOperationTimeout)
+	operationTimeout time.Duration
+
+	// metrics receives the provider's metrics (see WithMetricsSink)
+	metrics MetricsSink
+
+	// operationErrors counts the provider's recent operation errors, which
+	// are reported by Provider.DebugSnapshot
+	operationErrors operationErrors
+
+	// fetchRetry bounds the retries of transient discovery failures (see
+	// WithFetchRetries)
+	fetchRetry retryPolicy
+
+	// responseLimits limits the bytes read from the provider's responses
+	// (see WithResponseLimits)
+	responseLimits ResponseLimits
+
+	// claimLimits limits the claims of the provider's id_tokens and userinfo
+	// responses (see WithClaimLimits)
+	claimLimits ClaimLimits
+
+	// rateLimiters are the token buckets for the provider's rate limited
+	// endpoints and throttleFunc observes the requests they delay (see
+	// WithRateLimits)
+	rateLimiters map[string]*tokenBucket
+	throttleFunc ThrottleFunc
+
+	// debugWriter receives sanitized dumps of the provider's http requests
+	// and responses (see WithDebugWriter)
+	debugWriter io.Writer
 }
 
 // NewProvider creates and initializes a Provider. Intializing the provider,
-// includes making an http request to the provider's issuer.
+// includes making an http request to the provider's issuer, unless the
+// WithLazyDiscovery option is used or the config has static ProviderMetadata
+// (which is used instead of the issuer's discovery document). The provider uses a copy of the config, so
+// changes made to c after the provider is created have no effect (see
+// Provider.UpdateConfig)
 //
-// See Provider.Done() which must be called to release provider resources.
-func NewProvider(c *Config) (*Provider, error) {
+// See Provider.Done() or Provider.Close() which must be called to release
+// provider resources.
+//
+// Supported options: WithLazyDiscovery, WithOperationTimeout,
+// WithTracer, WithMetricsSink, WithDebugWriter, WithFetchRetries,
+// WithResponseLimits, WithRateLimits, WithClaimLimits, WithDiscoveryTTL,
+// WithJWKSRefreshInterval
+func NewProvider(c *Config, opt ...Option) (*Provider, error) {
+	return NewProviderWithContext(context.Background(), c, opt...)
+}
+
+// NewProviderWithContext is the same as NewProvider, except the provider's
+// discovery request is made with the ctx, so the caller can bound or cancel
+// it.  When the ctx doesn't have a deadline, the discovery is bounded by the
+// provider's operation timeout (see WithOperationTimeout).  The ctx is only
+// used while the provider is created.
+//
+// See Provider.Done() or Provider.Close() which must be called to release
+// provider resources.
+//
+// Supported options: the same options as NewProvider
+func NewProviderWithContext(ctx context.Context, c *Config, opt ...Option) (*Provider, error) {
 	const op = "NewProvider"
+	if ctx == nil {
+		return nil, fmt.Errorf("%s: context is nil: %w", op, ErrNilParameter)
+	}
 	if c == nil {
 		return nil, fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
 	}
 	if err := c.Validate(); err != nil {
 		return nil, fmt.Errorf("%s: provider config is invalid: %w", op, err)
 	}
+	opts := getProviderOpts(opt...)
+	if opts.withFetchRetries.retries < 0 || opts.withFetchRetries.backoff < 0 {
+		return nil, fmt.Errorf("%s: fetch retries and backoff must not be negative: %w", op, ErrInvalidParameter)
+	}
+	if err := opts.withResponseLimits.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := opts.withClaimLimits.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := opts.withRateLimits.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if opts.withDiscoveryTTL < 0 {
+		return nil, fmt.Errorf("%s: discovery TTL must not be negative: %w", op, ErrInvalidParameter)
+	}
+	if opts.withJWKSRefreshInterval < 0 {
+		return nil, fmt.Errorf("%s: JWKS refresh interval must not be negative: %w", op, ErrInvalidParameter)
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	backgroundCtx, cancel := context.WithCancel(context.Background())
 	// initializing the Provider with it's background ctx/cancel will
 	// allow us to use p.Stop() to release any resources when returning errors
 	// from this function.
 	p := &Provider{
-		config:              c,
-		backgroundCtx:       ctx,
+		tracer:              opts.withTracer,
+		operationTimeout:    opts.withOperationTimeout,
+		metrics:             opts.withMetricsSink,
+		debugWriter:         opts.withDebugWriter,
+		fetchRetry:          opts.withFetchRetries,
+		responseLimits:      opts.withResponseLimits,
+		claimLimits:         opts.withClaimLimits,
+		rateLimiters:        opts.withRateLimits.buckets(),
+		throttleFunc:        opts.withThrottleFunc,
+		discoveryTTL:        opts.withDiscoveryTTL,
+		jwksRefreshInterval: opts.withJWKSRefreshInterval,
+		config:              c.copy(),
+		backgroundCtx:       backgroundCtx,
 		backgroundCtxCancel: cancel,
 	}
 
-	oidcCtx, err := p.HTTPClientContext(p.backgroundCtx)
-	if err != nil {
+	if _, err := p.HTTPClient(); err != nil {
 		p.Done() // release the backgroundCtxCancel resources
 		return nil, fmt.Errorf("%s: unable to create http client: %w", op, err)
 	}
+	if opts.withLazyDiscovery {
+		p.startDiscoveryRefresh()
+		p.startJWKSRefresh()
+		return p, nil
+	}
+	discoveryCtx, discoveryCancel := p.operationContext(ctx)
+	defer discoveryCancel()
+	if err := p.discover(discoveryCtx); err != nil {
+		p.Done() // release the backgroundCtxCancel resources
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	p.startDiscoveryRefresh()
+	p.startJWKSRefresh()
+	return p, nil
+}
 
-	provider, err := oidc.NewProvider(oidcCtx, c.Issuer) // makes http req to issuer for discovery
+// discover makes an http request to the provider's issuer for its discovery
+// document and initializes the provider's key set from its jwks_uri.
+func (p *Provider) discover(ctx context.Context) (e error) {
+	const op = "Provider.discover"
+	config := p.currentConfig()
+	start := time.Now()
+	ctx, span := p.startSpan(ctx, "oidc.Discovery", config)
+	defer func() {
+		span.End(e)
+		p.recordOperation(config, MetricsOpDiscovery, start, e)
+	}()
+	var provider *oidc.Provider
+	var err error
+	if config.ProviderMetadata != nil {
+		// the static metadata is used instead of a discovery request
+		provider, err = newStaticProvider(ctx, config.Issuer, config.ProviderMetadata)
+	} else {
+		var oidcCtx context.Context
+		oidcCtx, err = p.limitedClientContext(ctx, discoveryEndpoint)
+		if err != nil {
+			return fmt.Errorf("%s: unable to create http client: %w", op, err)
+		}
+		err = p.fetchRetry.do(ctx, func() error {
+			var err error
+			provider, err = oidc.NewProvider(oidcCtx, config.Issuer) // makes http req to issuer for discovery
+			return err
+		})
+	}
 	if err != nil {
-		p.Done() // release the backgroundCtxCancel resources
 		// we don't know what's causing the problem, so we won't classify the
-		// error with a Kind
-		return nil, fmt.Errorf("%s: unable to create provider: %w", op, err)
+		// error with a Kind, unless the response was too large
+		if !errors.Is(err, ErrResponseTooLarge) && strings.Contains(err.Error(), ErrResponseTooLarge.Error()) {
+			err = fmt.Errorf("%s: %w", err.Error(), ErrResponseTooLarge)
+		}
+		return fmt.Errorf("%s: unable to create provider: %w", op, err)
+	}
+	var discovery struct {
+		JWKSURL string `json:"jwks_uri"`
+	}
+	if err := provider.Claims(&discovery); err != nil {
+		return fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+	}
+	if config.FAPI {
+		var m providerMetadata
+		if err := provider.Claims(&m); err != nil {
+			return fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+		}
+		if err := validFAPIProvider(m); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	client, err := p.httpClient()
+	if err != nil {
+		return fmt.Errorf("%s: unable to create http client: %w", op, err)
 	}
 	p.provider = provider
+	p.jwksURL = discovery.JWKSURL
+	p.discoveredAt = config.Now()
+	p.keySet = newKeySet(p.backgroundCtx, p.operationTimeout, p.config, p.jwksURL, p.endpointClient(client, jwksEndpoint))
+	return nil
+}
 
-	return p, nil
+// discovered returns the provider's discovered oidc.Provider and key set.
+// When the provider was created using WithLazyDiscovery, the discovery
+// happens during the first call.  Concurrent callers share a single
+// discovery request and a failed discovery is retried by the next caller.
+func (p *Provider) discovered(ctx context.Context) (*oidc.Provider, oidc.KeySet, error) {
+	const op = "Provider.discovered"
+	if p.parent != nil {
+		p.syncParentDiscovery()
+	}
+	p.mu.RLock()
+	provider, keySet := p.provider, p.keySet
+	p.mu.RUnlock()
+	if provider != nil {
+		return provider, keySet, nil
+	}
+	// the shared discovery isn't bound to any one caller's ctx (so a caller
+	// giving up doesn't fail the discovery for everyone else), but each
+	// caller stops waiting when its ctx is done.
+	ch := p.discoveryGroup.DoChan("discovery", func() (interface{}, error) {
+		p.mu.RLock()
+		done := p.provider != nil
+		p.mu.RUnlock()
+		if done {
+			return nil, nil
+		}
+		discoveryCtx, cancel := p.operationContext(p.backgroundContext(ctx))
+		defer cancel()
+		if p.parent != nil {
+			return nil, p.discoverFromParent(discoveryCtx)
+		}
+		return nil, p.discover(discoveryCtx)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("%s: %w", op, ctx.Err())
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", op, r.Err)
+		}
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.provider, p.keySet, nil
+}
+
+// operationContext returns a ctx limited by the provider's operation timeout
+// when ctx doesn't already have a deadline.  The returned cancel func must be
+// called when the operation completes.
+func (p *Provider) operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil || p.operationTimeout <= 0 {
+		return ctx, func() {}
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, p.operationTimeout)
+}
+
+// newKeySet returns a key set for the jwksURL from the config's JWKSCache or
+// the DefaultJWKSCache() when the config doesn't have one.  The key set's
+// background refreshes stop when the backgroundCtx is done, and are limited by
+// the operationTimeout.
+func newKeySet(backgroundCtx context.Context, operationTimeout time.Duration, c *Config, jwksURL string, client *http.Client) oidc.KeySet {
+	cache := c.JWKSCache
+	if cache == nil {
+		cache = DefaultJWKSCache()
+	}
+	ks := cache.keySet(backgroundCtx, jwksURL, client)
+	ks.pins = c.JWKSPins
+	ks.operationTimeout = operationTimeout
+	return ks
+}
+
+// authScopes returns the scopes requested by the oidcRequest's authentication
+// request, which always include the openid scope.  The offline_access scope is
+// included for requests with offline access, unless the config's profile omits
+// it.
+func authScopes(config *Config, oidcRequest Request) []string {
+	var scopes []string
+	switch {
+	case len(oidcRequest.Scopes()) > 0:
+		scopes = oidcRequest.Scopes()
+	default:
+		scopes = copyStrings(config.Scopes)
+	}
+	// Add the "openid" scope, which is a required scope for oidc flows
+	if !strutils.StrListContains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	if oidcRequest.OfflineAccess() && !config.quirks().omitOfflineAccessScope && !strutils.StrListContains(scopes, oidc.ScopeOfflineAccess) {
+		scopes = append(scopes, oidc.ScopeOfflineAccess)
+	}
+	return scopes
 }
 
 // Done with the provider's background resources and must be called for every
-// Provider created
+// Provider created (unless Provider.Close is called).  Done doesn't wait for
+// the provider's background activities to stop, see Provider.Close for a
+// graceful shutdown.
 func (p *Provider) Done() {
 	// checking for nil here prevents a panic when developers neglect to check
 	// the for an error before deferring a call to p.Done():
@@ -109,19 +417,95 @@ func (p *Provider) Done() {
 		p.backgroundCtxCancel = nil
 	}
 
-	// release the http.Client's pooled transport resources.
-	if p.client != nil {
+	// release the http.Client's pooled transport resources, unless the
+	// transport is shared with other providers via a TransportRegistry.
+	if p.client != nil && !p.sharedTransport {
 		p.client.CloseIdleConnections()
 	}
 }
 
+// Config returns a copy of the provider's configuration.
+func (p *Provider) Config() *Config {
+	return p.currentConfig().copy()
+}
+
+// UpdateConfig replaces the provider's configuration with a copy of c.
+// Requests already in progress continue to use the previous configuration.
+// The issuer cannot be changed, since the provider's discovery document is
+// specific to its issuer.  If the ProviderCA changes, the provider's http
+// client is replaced, which is also true if the TransportRegistry changes.
+func (p *Provider) UpdateConfig(c *Config) error {
+	const op = "Provider.UpdateConfig"
+	if c == nil {
+		return fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
+	}
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("%s: provider config is invalid: %w", op, err)
+	}
+	c = c.copy()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c.Issuer != p.config.Issuer {
+		return fmt.Errorf("%s: issuer %s cannot be changed to %s: %w", op, p.config.Issuer, c.Issuer, ErrInvalidIssuer)
+	}
+	prev := p.config
+	p.config = c
+	newClient := c.ProviderCA != prev.ProviderCA || c.TransportRegistry != prev.TransportRegistry
+	// the pins are copied with the config, so the key set is rebuilt whenever
+	// the provider has pins
+	if !newClient && c.JWKSCache == prev.JWKSCache && c.JWKSPins == nil && prev.JWKSPins == nil {
+		return nil
+	}
+	if newClient && p.client != nil {
+		if !p.sharedTransport {
+			p.client.CloseIdleConnections()
+		}
+		p.client = nil
+	}
+	client, err := p.httpClient()
+	if err != nil {
+		return fmt.Errorf("%s: unable to create http client: %w", op, err)
+	}
+	if p.provider != nil {
+		p.keySet = newKeySet(p.backgroundCtx, p.operationTimeout, c, p.jwksURL, p.endpointClient(client, jwksEndpoint))
+	}
+	return nil
+}
+
+// currentConfig returns the provider's current config, which must not be
+// modified.
+func (p *Provider) currentConfig() *Config {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.config
+}
+
 // AuthURL will generate a URL the caller can use to kick off an OIDC
 // authorization code (with optional PKCE) or an implicit flow with an IdP.
+// The config's default Prompts and Display are used when the request doesn't
+// have its own.
+//
+// When the config enforces the FAPI profile (see WithFAPIProfile), the
+// request must satisfy the profile and its parameters are pushed to the
+// provider's pushed_authorization_request_endpoint, so the URL only has the
+// client_id and the request_uri which references them.
 //
 // See NewRequest() to create an oidc flow Request with a valid state and Nonce that
 // will uniquely identify the user's authentication attempt throughout the flow.
 func (p *Provider) AuthURL(ctx context.Context, oidcRequest Request) (url string, e error) {
+	return p.authURL(ctx, oidcRequest, true)
+}
+
+// authURL generates the AuthURL for the request, whose parameters are pushed
+// when push is true and the config enforces the FAPI profile.
+func (p *Provider) authURL(ctx context.Context, oidcRequest Request, push bool) (url string, e error) {
 	const op = "Provider.AuthURL"
+	config := p.currentConfig()
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	ctx, span := p.startSpan(ctx, "oidc.AuthURL", config)
+	defer func() { span.End(e) }()
 	if oidcRequest.State() == "" {
 		return "", fmt.Errorf("%s: request id is empty: %w", op, ErrInvalidParameter)
 	}
@@ -131,6 +515,11 @@ func (p *Provider) AuthURL(ctx context.Context, oidcRequest Request) (url string
 	if oidcRequest.State() == oidcRequest.Nonce() {
 		return "", fmt.Errorf("%s: request id and nonce cannot be equal: %w", op, ErrInvalidParameter)
 	}
+	if config.FAPI {
+		if err := validFAPIRequest(oidcRequest); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
 	withImplicit, withImplicitAccessToken := oidcRequest.ImplicitFlow()
 	if oidcRequest.PKCEVerifier() != nil && withImplicit {
 		return "", fmt.Errorf("%s: request requests both implicit flow and authorization code with PKCE: %w", op, ErrInvalidParameter)
@@ -141,35 +530,41 @@ func (p *Provider) AuthURL(ctx context.Context, oidcRequest Request) (url string
 	if err := p.validRedirect(oidcRequest.RedirectURL()); err != nil {
 		return "", fmt.Errorf("%s: %w", op, err)
 	}
-	var scopes []string
-	switch {
-	case len(oidcRequest.Scopes()) > 0:
-		scopes = oidcRequest.Scopes()
-	default:
-		scopes = p.config.Scopes
-	}
-	// Add the "openid" scope, which is a required scope for oidc flows
-	if !strutils.StrListContains(scopes, oidc.ScopeOpenID) {
-		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	provider, _, err := p.discovered(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to discover provider: %w", op, err)
 	}
+	scopes := authScopes(config, oidcRequest)
+	q := config.quirks()
 
 	// Configure an OpenID Connect aware OAuth2 client
 	oauth2Config := oauth2.Config{
-		ClientID:     p.config.ClientID,
-		ClientSecret: string(p.config.ClientSecret),
+		ClientID:     config.ClientID,
+		ClientSecret: string(config.ClientSecret),
 		RedirectURL:  oidcRequest.RedirectURL(),
-		Endpoint:     p.provider.Endpoint(),
+		Endpoint:     provider.Endpoint(),
 		Scopes:       scopes,
 	}
-	authCodeOpts := []oauth2.AuthCodeOption{
-		oidc.Nonce(oidcRequest.Nonce()),
-	}
+	// sized for the nonce along with the most common optional params, which
+	// avoids growing the slice in the typical case.
+	authCodeOpts := make([]oauth2.AuthCodeOption, 0, 4)
+	authCodeOpts = append(authCodeOpts, oidc.Nonce(oidcRequest.Nonce()))
 	if withImplicit {
 		reqTokens := []string{"id_token"}
 		if withImplicitAccessToken {
 			reqTokens = append(reqTokens, "token")
 		}
-		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("response_mode", "form_post"), oauth2.SetAuthURLParam("response_type", strings.Join(reqTokens, " ")))
+		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("response_mode", string(FormPostResponseMode)), oauth2.SetAuthURLParam("response_type", strings.Join(reqTokens, " ")))
+	}
+	if m := oidcRequest.ResponseMode(); m != "" {
+		if err := supportedResponseMode(config, m); err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		if withImplicit && m == QueryResponseMode {
+			return "", fmt.Errorf("%s: the query response mode can't be used with the implicit flow: %w", op, ErrInvalidParameter)
+		}
+		// overrides the implicit flow's default form_post response mode
+		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("response_mode", string(m)))
 	}
 	if oidcRequest.PKCEVerifier() != nil {
 		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("code_challenge", oidcRequest.PKCEVerifier().Challenge()), oauth2.SetAuthURLParam("code_challenge_method", string(oidcRequest.PKCEVerifier().Method())))
@@ -177,19 +572,40 @@ func (p *Provider) AuthURL(ctx context.Context, oidcRequest Request) (url string
 	if secs, exp := oidcRequest.MaxAge(); !exp.IsZero() {
 		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("max_age", strconv.Itoa(int(secs))))
 	}
-	if len(oidcRequest.Prompts()) > 0 {
-		prompts := make([]string, 0, len(oidcRequest.Prompts()))
-		for _, v := range oidcRequest.Prompts() {
-			prompts = append(prompts, string(v))
+	// the request's prompts and display override the config's defaults
+	requestPrompts := oidcRequest.Prompts()
+	if len(requestPrompts) == 0 {
+		requestPrompts = config.Prompts
+	}
+	prompts := make([]string, 0, len(requestPrompts)+1)
+	for _, v := range requestPrompts {
+		prompts = append(prompts, string(v))
+	}
+	// offline access requires consent, unless the request relies on a
+	// previous consent using prompt=none or the config's profile doesn't
+	// require it.  See:
+	// https://openid.net/specs/openid-connect-core-1_0.html#OfflineAccess
+	if oidcRequest.OfflineAccess() && !q.omitOfflineAccessConsent && !strutils.StrListContains(prompts, string(None)) {
+		prompts = append(prompts, string(Consent))
+	}
+	if oidcRequest.OfflineAccess() {
+		for k, v := range q.offlineAccessParams {
+			authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam(k, v))
 		}
+	}
+	if len(prompts) > 0 {
 		prompts = strutils.RemoveDuplicatesStable(prompts, false)
 		if strutils.StrListContains(prompts, string(None)) && len(prompts) > 1 {
 			return "", fmt.Errorf(`%s: prompts (%s) includes "none" with other values: %w`, op, prompts, ErrInvalidParameter)
 		}
 		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("prompt", strings.Join(prompts, " ")))
 	}
-	if oidcRequest.Display() != "" {
-		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("display", string(oidcRequest.Display())))
+	display := oidcRequest.Display()
+	if display == "" {
+		display = config.Display
+	}
+	if display != "" {
+		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("display", string(display)))
 	}
 	if len(oidcRequest.UILocales()) > 0 {
 		locales := make([]string, 0, len(oidcRequest.UILocales()))
@@ -198,13 +614,35 @@ func (p *Provider) AuthURL(ctx context.Context, oidcRequest Request) (url string
 		}
 		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("ui_locales", strings.Join(locales, " ")))
 	}
+	if len(oidcRequest.ClaimsLocales()) > 0 {
+		locales := make([]string, 0, len(oidcRequest.ClaimsLocales()))
+		for _, l := range oidcRequest.ClaimsLocales() {
+			locales = append(locales, l.String())
+		}
+		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("claims_locales", strings.Join(locales, " ")))
+	}
 	if len(oidcRequest.Claims()) > 0 {
 		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("claims", string(oidcRequest.Claims())))
 	}
 	if len(oidcRequest.ACRValues()) > 0 {
 		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("acr_values", strings.Join(oidcRequest.ACRValues(), " ")))
 	}
-	return oauth2Config.AuthCodeURL(oidcRequest.State(), authCodeOpts...), nil
+	if oidcRequest.AuthAudience() != "" {
+		authCodeOpts = append(authCodeOpts, oauth2.SetAuthURLParam("audience", oidcRequest.AuthAudience()))
+	}
+	authURL := oauth2Config.AuthCodeURL(oidcRequest.State(), authCodeOpts...)
+	if !push || !config.FAPI {
+		return authURL, nil
+	}
+	endpoint, params, err := p.authURLParams(ctx, authURL)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	pushed, err := p.pushAuthorizationRequest(ctx, params)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return authEndpointURL(endpoint, pushed), nil
 }
 
 // Exchange will request a token from the oidc token endpoint, using the
@@ -217,7 +655,9 @@ func (p *Provider) AuthURL(ctx context.Context, oidcRequest Request) (url string
 // existing Request for the user's oidc authentication flow.
 //
 // On success, the Token returned will include an IDToken and may
-// include an AccessToken and RefreshToken.
+// include an AccessToken and RefreshToken.  When the Request has offline access
+// (see WithOfflineAccess), use Token.RefreshTokenGranted() to check whether
+// the provider granted a RefreshToken.
 //
 // Any tokens returned will have been verified.
 // See: Provider.VerifyIDToken for info about id_token verification.
@@ -227,9 +667,23 @@ func (p *Provider) AuthURL(ctx context.Context, oidcRequest Request) (url string
 // https://openid.net/specs/openid-connect-core-1_0.html#CodeFlowTokenValidation)
 //
 // The id_token c_hash claim is verified when present.
-func (p *Provider) Exchange(ctx context.Context, oidcRequest Request, authorizationState string, authorizationCode string) (*Tk, error) {
+//
+// The Token's GrantedScopes() may be fewer than its RequestedScopes(), see
+// Tk.DeniedScopes().  When the Request has required scopes (see
+// WithRequiredScopes) which weren't granted, an error wrapping
+// ErrScopesNotGranted is returned.
+func (p *Provider) Exchange(ctx context.Context, oidcRequest Request, authorizationState string, authorizationCode string) (_ *Tk, e error) {
 	const op = "Provider.Exchange"
-	if p.config == nil {
+	config := p.currentConfig()
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	start := time.Now()
+	ctx, span := p.startSpan(ctx, "oidc.Exchange", config)
+	defer func() {
+		span.End(e)
+		p.recordOperation(config, MetricsOpExchange, start, e)
+	}()
+	if config == nil {
 		return nil, fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
 	}
 	if oidcRequest == nil {
@@ -251,7 +705,11 @@ func (p *Provider) Exchange(ctx context.Context, oidcRequest Request, authorizat
 		return nil, fmt.Errorf("%s: authentication request is expired: %w", op, ErrInvalidParameter)
 	}
 
-	oidcCtx, err := p.HTTPClientContext(ctx)
+	provider, _, err := p.discovered(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	oidcCtx, err := p.limitedClientContext(ctx, tokenEndpoint)
 	if err != nil {
 		return nil, fmt.Errorf("%s: unable to create http client: %w", op, err)
 	}
@@ -260,15 +718,15 @@ func (p *Provider) Exchange(ctx context.Context, oidcRequest Request, authorizat
 	case len(oidcRequest.Scopes()) > 0:
 		scopes = oidcRequest.Scopes()
 	default:
-		scopes = p.config.Scopes
+		scopes = config.Scopes
 	}
 	// Add the "openid" scope, which is a required scope for oidc flows
 	scopes = append([]string{oidc.ScopeOpenID}, scopes...)
 	var oauth2Config = oauth2.Config{
-		ClientID:     p.config.ClientID,
-		ClientSecret: string(p.config.ClientSecret),
+		ClientID:     config.ClientID,
+		ClientSecret: string(config.ClientSecret),
 		RedirectURL:  oidcRequest.RedirectURL(),
-		Endpoint:     p.provider.Endpoint(),
+		Endpoint:     provider.Endpoint(),
 		Scopes:       scopes,
 	}
 	var authCodeOpts []oauth2.AuthCodeOption
@@ -277,17 +735,35 @@ func (p *Provider) Exchange(ctx context.Context, oidcRequest Request, authorizat
 	}
 	oauth2Token, err := oauth2Config.Exchange(oidcCtx, authorizationCode, authCodeOpts...)
 	if err != nil {
-		return nil, fmt.Errorf("%s: unable to exchange auth code with provider: %w", op, p.convertError(err))
+		return nil, fmt.Errorf("%s: unable to exchange auth code with provider: %w", op, newOAuthError(err, convertError(err)))
+	}
+	if config.DPoPKey != nil {
+		if err := verifyDPoPTokenBinding(config.DPoPKey, oauth2Token); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
 	}
 
 	idToken, ok := oauth2Token.Extra("id_token").(string)
 	if !ok {
 		return nil, fmt.Errorf("%s: id_token is missing from auth code exchange: %w", op, ErrMissingIDToken)
 	}
-	t, err := NewToken(IDToken(idToken), oauth2Token, WithNow(p.config.NowFunc))
+	// an encrypted id_token is decrypted, so the token has the signed id_token
+	decrypted, err := decryptIDToken(config.IDTokenDecryptionKeys, IDToken(idToken))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	tokenOpts := []Option{WithNow(config.NowFunc)}
+	if oidcRequest.OfflineAccess() {
+		tokenOpts = append(tokenOpts, WithOfflineAccess())
+	}
+	t, err := NewToken(decrypted, oauth2Token, tokenOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("%s: unable to create new id_token: %w", op, err)
 	}
+	requested := authScopes(config, oidcRequest)
+	if err := t.setScopes(requested, requested, oidcRequest.RequiredScopes(), oauth2Token); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 	claims, err := p.VerifyIDToken(ctx, t.IDToken(), oidcRequest)
 	if err != nil {
 		return nil, fmt.Errorf("%s: id_token failed verification: %w", op, err)
@@ -309,6 +785,165 @@ func (p *Provider) Exchange(ctx context.Context, oidcRequest Request, authorizat
 	return t, nil
 }
 
+// RefreshToken will request a new Token from the provider's token endpoint
+// using the refresh_token from t.
+//
+// When the provider's response includes a new id_token, it will be verified
+// (see: Provider.VerifyIDToken), although the nonce and max_age checks are
+// skipped since a refresh isn't associated with a Request.  When the response
+// doesn't include a new id_token, the returned Token will contain the id_token
+// from t.  The provider may not return a new refresh_token, in which case the
+// refresh_token from t is retained.  The returned Token retains t's
+// OfflineAccessRequested().
+//
+// When present, the new id_token at_hash claim is verified against the new
+// access_token.  When t has an id_token, the new id_token's iss and sub must
+// equal t's, and its aud must contain the client_id.
+//
+// When t is a *Tk, the returned Token retains its requested and required
+// scopes, and an error wrapping ErrScopesNotGranted is returned when any of
+// the required scopes aren't granted by the refresh.
+//
+// A provider which rotates refresh tokens returns a new refresh_token for
+// every refresh, and t's refresh_token can't be used again, so the returned
+// Token must replace t wherever t is persisted (see clientauth.Client.Refresh).
+// An error wrapping a RefreshTokenRejectedError is returned when the provider
+// rejects t's refresh_token with an invalid_grant error.
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#RefreshTokens
+func (p *Provider) RefreshToken(ctx context.Context, t Token) (_ *Tk, e error) {
+	const op = "Provider.RefreshToken"
+	config := p.currentConfig()
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	start := time.Now()
+	ctx, span := p.startSpan(ctx, "oidc.RefreshToken", config)
+	defer func() {
+		span.End(e)
+		p.recordOperation(config, MetricsOpRefreshToken, start, e)
+	}()
+	if config == nil {
+		return nil, fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
+	}
+	if t == nil {
+		return nil, fmt.Errorf("%s: token is nil: %w", op, ErrNilParameter)
+	}
+	if t.RefreshToken() == "" {
+		return nil, fmt.Errorf("%s: refresh_token is empty: %w", op, ErrInvalidParameter)
+	}
+	provider, _, err := p.discovered(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	oidcCtx, err := p.limitedClientContext(ctx, tokenEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create http client: %w", op, err)
+	}
+	var oauth2Config = oauth2.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: string(config.ClientSecret),
+		Endpoint:     provider.Endpoint(),
+	}
+	// a token without an access_token is never valid, so the token source will
+	// always use the refresh_token to get a new token from the provider.
+	oauth2Token, err := oauth2Config.TokenSource(oidcCtx, &oauth2.Token{RefreshToken: string(t.RefreshToken())}).Token()
+	if err != nil {
+		err = newOAuthError(err, convertError(err))
+		var oauthErr *OAuthError
+		if errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant" {
+			err = &RefreshTokenRejectedError{OAuthError: oauthErr}
+		}
+		return nil, fmt.Errorf("%s: unable to refresh token with provider: %w", op, err)
+	}
+	if config.DPoPKey != nil {
+		if err := verifyDPoPTokenBinding(config.DPoPKey, oauth2Token); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	idToken := t.IDToken()
+	var newIDToken bool
+	if raw, ok := oauth2Token.Extra("id_token").(string); ok && raw != "" {
+		if idToken, err = decryptIDToken(config.IDTokenDecryptionKeys, IDToken(raw)); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		newIDToken = true
+	}
+	tokenOpts := []Option{WithNow(config.NowFunc)}
+	if t.OfflineAccessRequested() {
+		tokenOpts = append(tokenOpts, WithOfflineAccess())
+	}
+	refreshed, err := NewToken(idToken, oauth2Token, tokenOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create new token: %w", op, err)
+	}
+	// a refresh doesn't request scopes, so the provider grants the scopes
+	// which were previously granted (or fewer)
+	if tk, ok := t.(*Tk); ok {
+		if err := refreshed.setScopes(tk.requestedScopes, tk.grantedScopes, tk.requiredScopes, oauth2Token); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if !newIDToken {
+		return refreshed, nil
+	}
+	claims, err := p.verifyIDToken(ctx, refreshed.IDToken(), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: id_token failed verification: %w", op, err)
+	}
+	if err := verifyRefreshedIDToken(config, t.IDToken(), claims); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if refreshed.AccessToken() != "" {
+		if _, err := refreshed.IDToken().VerifyAccessToken(refreshed.AccessToken()); err != nil {
+			return nil, fmt.Errorf("%s: access_token failed verification: %w", op, err)
+		}
+	}
+	return refreshed, nil
+}
+
+// verifyRefreshedIDToken verifies that the verified claims of an id_token
+// returned by a refresh have the same iss and sub as the original id_token, and
+// that its aud contains the client_id.  Nothing is compared when there's no
+// original id_token.  See:
+// https://openid.net/specs/openid-connect-core-1_0.html#RefreshTokenResponse
+func verifyRefreshedIDToken(config *Config, original IDToken, claims map[string]interface{}) error {
+	const op = "verifyRefreshedIDToken"
+	if original == "" {
+		return nil
+	}
+	var prev struct {
+		Issuer  string `json:"iss"`
+		Subject string `json:"sub"`
+	}
+	if err := original.Claims(&prev); err != nil {
+		return fmt.Errorf("%s: unable to parse original id_token claims: %w", op, err)
+	}
+	iss, _ := claims["iss"].(string)
+	if iss != prev.Issuer {
+		return fmt.Errorf("%s: refreshed id_token iss (%s) is not equal to the original iss (%s): %w", op, iss, prev.Issuer, ErrInvalidIssuer)
+	}
+	sub, _ := claims["sub"].(string)
+	if sub != prev.Subject {
+		return fmt.Errorf("%s: refreshed id_token sub (%s) is not equal to the original sub (%s): %w", op, sub, prev.Subject, ErrInvalidSubject)
+	}
+	var aud []string
+	switch v := claims["aud"].(type) {
+	case string:
+		aud = []string{v}
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				aud = append(aud, s)
+			}
+		}
+	}
+	if !strutils.StrListContains(aud, config.ClientID) {
+		return fmt.Errorf("%s: refreshed id_token aud (%s) doesn't contain the client_id (%s): %w", op, aud, config.ClientID, ErrInvalidAudience)
+	}
+	return nil
+}
+
 // UserInfo gets the UserInfo claims from the provider using the token produced
 // by the tokenSource.  Only JSON user info responses are supported (signed JWT
 // responses are not).  The WithAudiences option is supported to specify
@@ -320,11 +955,24 @@ func (p *Provider) Exchange(ctx context.Context, oidcRequest Request, authorizat
 //   * audiences (aud) - if the aud claim is included in returned claims and
 //     WithAudiences option is provided.
 //
+// See Provider.RawUserInfo(...) for access to the raw response.
+//
+// An error wrapping a SubjectMismatchError is returned when the sub doesn't
+// match the validSubject.  Some providers return a different (but linked)
+// subject format, which can be accepted using WithUserInfoSubject.  When
+// WithUserInfoMismatchClaims is provided, the claims are populated even when
+// a SubjectMismatchError is returned, so the app can reconcile the subjects.
+//
+// An error wrapping ErrUserInfoUnsupported is returned when the provider
+// doesn't advertise a userinfo_endpoint and the config doesn't have a
+// UserInfoURL.
+//
+// Supported options: WithAudiences, WithUserInfoSubject,
+// WithUserInfoMismatchClaims, WithEssentialClaims
+//
 // See: https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse
 func (p *Provider) UserInfo(ctx context.Context, tokenSource oauth2.TokenSource, validSubject string, claims interface{}, opt ...Option) error {
 	const op = "Provider.UserInfo"
-	opts := getUserInfoOpts(opt...)
-
 	if tokenSource == nil {
 		return fmt.Errorf("%s: token source is nil: %w", op, ErrNilParameter)
 	}
@@ -334,42 +982,17 @@ func (p *Provider) UserInfo(ctx context.Context, tokenSource oauth2.TokenSource,
 	if reflect.ValueOf(claims).Kind() != reflect.Ptr {
 		return fmt.Errorf("%s: interface parameter must to be a pointer: %w", op, ErrInvalidParameter)
 	}
-	oidcCtx, err := p.HTTPClientContext(ctx)
-	if err != nil {
-		return fmt.Errorf("%s: unable to create http client: %w", op, err)
-	}
-
-	userinfo, err := p.provider.UserInfo(oidcCtx, tokenSource)
-	if err != nil {
-		return fmt.Errorf("%s: provider UserInfo request failed: %w", op, p.convertError(err))
-	}
-	type verifyClaims struct {
-		Sub string
-		Iss string
-		Aud []string
-	}
-	var vc verifyClaims
-	err = userinfo.Claims(&vc)
-	if err != nil {
-		return fmt.Errorf("%s: failed to parse claims for UserInfo verification: %w", op, err)
-	}
-	// Subject is required to match
-	if vc.Sub != validSubject {
-		return fmt.Errorf("%s: %w", op, ErrInvalidSubject)
-	}
-	// optional issuer check...
-	if vc.Iss != "" && vc.Iss != p.config.Issuer {
-		return fmt.Errorf("%s: %w", op, ErrInvalidIssuer)
-	}
-	// optional audiences check...
-	if len(opts.withAudiences) > 0 {
-		if err := p.verifyAudience(opts.withAudiences, vc.Aud); err != nil {
-			return fmt.Errorf("%s: %w", op, ErrInvalidAudience)
+	resp, err := p.RawUserInfo(ctx, tokenSource, validSubject, opt...)
+	var mismatch *SubjectMismatchError
+	if errors.As(err, &mismatch) && mismatch.Response != nil {
+		if err := json.Unmarshal(mismatch.Response.Body, claims); err != nil {
+			return fmt.Errorf("%s: failed to get UserInfo claims: %w", op, err)
 		}
 	}
-
-	err = userinfo.Claims(&claims)
 	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := json.Unmarshal(resp.Body, claims); err != nil {
 		return fmt.Errorf("%s: failed to get UserInfo claims: %w", op, err)
 	}
 	return nil
@@ -378,7 +1001,11 @@ func (p *Provider) UserInfo(ctx context.Context, tokenSource oauth2.TokenSource,
 // userInfoOptions is the set of available options for the Provider.UserInfo
 // function
 type userInfoOptions struct {
-	withAudiences []string
+	withAudiences           []string
+	withSubjectStrictness   SubjectStrictness
+	withLinkedSubjectClaims []string
+	withMismatchClaims      bool
+	withEssentialClaims     Request
 }
 
 // userInfoDefaults is a handy way to get the defaults at runtime and during unit
@@ -399,9 +1026,9 @@ func getUserInfoOpts(opt ...Option) userInfoOptions {
 //  It verifies:
 //   * signature (including if a supported signing algorithm was used)
 //   * issuer (iss)
-//   * expiration (exp)
-//   * issued at (iat) (with a leeway of 1 min)
-//   * not before (nbf) (with a leeway of 1 min)
+//   * expiration (exp) (with a leeway of the config's ClockSkew)
+//   * issued at (iat) (with a leeway of the config's ClockSkew or 1 min)
+//   * not before (nbf) (with a leeway of the config's ClockSkew or 1 min)
 //   * nonce (nonce)
 //   * audience (aud) contains all audiences required from the provider's config
 //   * when there are multiple audiences (aud), then one of them must equal
@@ -412,7 +1039,17 @@ func getUserInfoOpts(opt ...Option) userInfoOptions {
 //   * when there is a single audience (aud) and it is not equal to the client
 //     id, then the authorized party (azp) must equal the client id
 //   * when max_age was requested, the auth_time claim is verified (with a leeway
-//     of 1 min)
+//     of the config's ClockSkew or 1 min)
+//
+// An encrypted (JWE) id_token is decrypted using the config's
+// IDTokenDecryptionKeys before it's verified.
+//
+// The checks performed (which passed or failed, and their timing) are
+// recorded in the VerificationResult provided by the WithVerificationResult
+// option, which can explain a failed login beyond the error returned.
+//
+// Supported options: WithEssentialClaims, WithVerificationResult,
+// WithACRVerification, WithACRPolicy
 //
 // See: https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
 func (p *Provider) VerifyIDToken(ctx context.Context, t IDToken, oidcRequest Request, opt ...Option) (map[string]interface{}, error) {
@@ -420,99 +1057,286 @@ func (p *Provider) VerifyIDToken(ctx context.Context, t IDToken, oidcRequest Req
 	if t == "" {
 		return nil, fmt.Errorf("%s: id_token is empty: %w", op, ErrInvalidParameter)
 	}
+	if oidcRequest == nil {
+		return nil, fmt.Errorf("%s: request is nil: %w", op, ErrNilParameter)
+	}
 	if oidcRequest.Nonce() == "" {
 		return nil, fmt.Errorf("%s: nonce is empty: %w", op, ErrInvalidParameter)
 	}
-	algs := []string{}
-	for _, a := range p.config.SupportedSigningAlgs {
-		algs = append(algs, string(a))
+	opts := getVerifyIDTokenOpts(opt...)
+	result := opts.withVerificationResult
+	result.begin()
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	claims, err := p.verifyIDToken(ctx, t, oidcRequest, result)
+	if err != nil {
+		return nil, err
 	}
-	oidcConfig := &oidc.Config{
-		SkipClientIDCheck:    true,
-		SupportedSigningAlgs: algs,
-		Now:                  p.config.Now,
+	if opts.withACRPolicy != nil {
+		err := verifyACR(opts.withACRPolicy, oidcRequest, claims)
+		if err := result.record(VerificationCheckACR, err); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if opts.withEssentialClaims != nil {
+		err := verifyEssentialClaims(opts.withEssentialClaims, claimsParamIDToken, claims)
+		if err := result.record(VerificationCheckEssentialClaims, err); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
 	}
-	verifier := p.provider.Verifier(oidcConfig)
-	nowTime := p.config.Now() // intialized right after the Verifier so there idea of nowTime sort of coresponds.
-	leeway := 1 * time.Minute
+	return claims, nil
+}
 
-	// verifier.Verify will check the supported algs, signature, iss, exp, nbf.
-	// aud will be checked later in this function.
+// verifyIDToken does the heavy lifting for VerifyIDToken.  When the
+// oidcRequest is nil (as it is for an id_token returned from a refresh), the
+// nonce and max_age checks are skipped and the configured audiences are used.
+// The checks performed are recorded in the optional result.
+func (p *Provider) verifyIDToken(ctx context.Context, t IDToken, oidcRequest Request, result *VerificationResult) (_ map[string]interface{}, e error) {
+	const op = "Provider.VerifyIDToken"
+	config := p.currentConfig()
+	start := time.Now()
+	ctx, span := p.startSpan(ctx, "oidc.VerifyIDToken", config)
+	defer func() {
+		span.End(e)
+		p.recordOperation(config, MetricsOpVerifyIDToken, start, e)
+	}()
+	if t.encrypted() {
+		var err error
+		t, err = decryptIDToken(config.IDTokenDecryptionKeys, t)
+		if err := result.record(VerificationCheckDecryption, err); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if len(t) > MaxTokenSize {
+		err := fmt.Errorf("%s: id_token is larger than %d bytes: %w", op, MaxTokenSize, ErrMalformedToken)
+		return nil, result.record(VerificationCheckSize, err)
+	}
+	if err := result.record(VerificationCheckSize, p.claimLimits.checkJWT("id_token", string(t))); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	_, keySet, err := p.discovered(ctx)
+	if err := result.record(VerificationCheckKeySet, err); err != nil {
+		return nil, fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	verifier := p.idTokenVerifier(config, keySet)
+	claims, err := verifyIDTokenClaims(ctx, config, verifier, t, oidcRequest, result)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return claims, nil
+}
+
+// verifyIDTokenClaims verifies the id_token using the verifier, and then
+// verifies the claims which the verifier doesn't check against the config and
+// the optional oidcRequest.  The checks performed are recorded in the optional
+// result.
+func verifyIDTokenClaims(ctx context.Context, config *Config, verifier *oidc.IDTokenVerifier, t IDToken, oidcRequest Request, result *VerificationResult) (map[string]interface{}, error) {
+	const op = "verifyIDTokenClaims"
+	nowTime := config.Now() // intialized right after the Verifier so there idea of nowTime sort of coresponds.
+	leeway := DefaultClockSkew
+	if config.ClockSkew > 0 {
+		leeway = config.ClockSkew
+	}
+
+	// verifier.Verify will check the supported algs, signature, iss, exp, nbf
+	// (unless the config has a ClockSkew, see newJWTVerifier).  aud will be
+	// checked later in this function.
 	oidcIDToken, err := verifier.Verify(ctx, string(t))
 	if err != nil {
-		return nil, fmt.Errorf("%s: invalid id_token: %w", op, p.convertError(err))
+		err = convertError(err)
+	}
+	if err := result.record(VerificationCheckSignature, err); err != nil {
+		return nil, fmt.Errorf("%s: invalid id_token: %w", op, err)
+	}
+	if config.ClockSkew > 0 {
+		err := verifySkewedExpiry(nowTime, config.ClockSkew, oidcIDToken)
+		if err := result.record(VerificationCheckExpiry, err); err != nil {
+			return nil, fmt.Errorf("%s: invalid id_token: %w", op, err)
+		}
+	}
+	q := config.quirks()
+	if q.issuerWithoutScheme {
+		err := q.verifyIssuer(config, oidcIDToken.Issuer)
+		if err := result.record(VerificationCheckIssuer, err); err != nil {
+			return nil, fmt.Errorf("%s: invalid id_token: %w", op, err)
+		}
 	}
 	// so.. we still need to check: nonce, iat, auth_time, azp, the aud includes
 	// additional audiences configured.
-	if oidcIDToken.Nonce != oidcRequest.Nonce() {
-		return nil, fmt.Errorf("%s: invalid id_token nonce: %w", op, ErrInvalidNonce)
+	if oidcRequest != nil {
+		if oidcIDToken.Nonce != oidcRequest.Nonce() {
+			err := fmt.Errorf("%s: invalid id_token nonce: %w", op, ErrInvalidNonce)
+			return nil, result.record(VerificationCheckNonce, err)
+		}
+		result.record(VerificationCheckNonce, nil)
 	}
 	if nowTime.Add(leeway).Before(oidcIDToken.IssuedAt) {
-		return nil, fmt.Errorf(
+		err := fmt.Errorf(
 			"%s: invalid id_token current time %v before the iat (issued at) time %v: %w",
 			op,
 			nowTime,
 			oidcIDToken.IssuedAt,
 			ErrInvalidIssuedAt,
 		)
+		return nil, result.record(VerificationCheckIssuedAt, err)
 	}
+	result.record(VerificationCheckIssuedAt, nil)
 
 	var audiences []string
 	switch {
-	case len(oidcRequest.Audiences()) > 0:
+	case oidcRequest != nil && len(oidcRequest.Audiences()) > 0:
 		audiences = oidcRequest.Audiences()
 	default:
-		audiences = p.config.Audiences
+		audiences = config.Audiences
 	}
-	if err := p.verifyAudience(audiences, oidcIDToken.Audience); err != nil {
-		return nil, fmt.Errorf("%s: invalid id_token audiences: %w", op, err)
+	if err := verifyAudience(audiences, oidcIDToken.Audience); err != nil {
+		err = fmt.Errorf("%s: invalid id_token audiences: %w", op, err)
+		return nil, result.record(VerificationCheckAudience, err)
 	}
-	if len(oidcIDToken.Audience) > 1 && !strutils.StrListContains(oidcIDToken.Audience, p.config.ClientID) {
-		return nil, fmt.Errorf("%s: invalid id_token: multiple audiences (%s) and one of them is not equal client_id (%s): %w", op, oidcIDToken.Audience, p.config.ClientID, ErrInvalidAudience)
+	if len(oidcIDToken.Audience) > 1 && !strutils.StrListContains(oidcIDToken.Audience, config.ClientID) {
+		err := fmt.Errorf("%s: invalid id_token: multiple audiences (%s) and one of them is not equal client_id (%s): %w", op, oidcIDToken.Audience, config.ClientID, ErrInvalidAudience)
+		return nil, result.record(VerificationCheckAudience, err)
 	}
+	result.record(VerificationCheckAudience, nil)
 
+	// use the claims already decoded by the verifier, rather than decoding
+	// the id_token again.
 	var claims map[string]interface{}
-	if err := t.Claims(&claims); err != nil {
-		return nil, fmt.Errorf("%s: %w", op, err)
+	if err := oidcIDToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%s: unable to unmarshal id_token claims: %w", op, err)
 	}
 
 	azp, foundAzp := claims["azp"]
-	if foundAzp {
-		if azp != p.config.ClientID {
-			return nil, fmt.Errorf("%s: invalid id_token: authorized party (%s) is not equal client_id (%s): %w", op, azp, p.config.ClientID, ErrInvalidAuthorizedParty)
+	// a profile may allow a cross-client id_token, where the azp is another
+	// client and the aud includes the client_id.
+	foreignAzp := q.foreignAuthorizedParty && strutils.StrListContains(oidcIDToken.Audience, config.ClientID)
+	if foundAzp && !foreignAzp {
+		if azp != config.ClientID {
+			err := fmt.Errorf("%s: invalid id_token: authorized party (%s) is not equal client_id (%s): %w", op, azp, config.ClientID, ErrInvalidAuthorizedParty)
+			return nil, result.record(VerificationCheckAuthorizedParty, err)
 		}
 	}
-	if len(oidcIDToken.Audience) > 1 && azp != p.config.ClientID {
-		return nil, fmt.Errorf("%s: invalid id_token: multiple audiences and authorized party (%s) is not equal client_id (%s): %w", op, azp, p.config.ClientID, ErrInvalidAuthorizedParty)
+	if len(oidcIDToken.Audience) > 1 && azp != config.ClientID {
+		err := fmt.Errorf("%s: invalid id_token: multiple audiences and authorized party (%s) is not equal client_id (%s): %w", op, azp, config.ClientID, ErrInvalidAuthorizedParty)
+		return nil, result.record(VerificationCheckAuthorizedParty, err)
 	}
-	if (len(oidcIDToken.Audience) == 1 && oidcIDToken.Audience[0] != p.config.ClientID) && azp != p.config.ClientID {
-		return nil, fmt.Errorf(
+	if (len(oidcIDToken.Audience) == 1 && oidcIDToken.Audience[0] != config.ClientID) && azp != config.ClientID {
+		err := fmt.Errorf(
 			"%s: invalid id_token: one audience (%s) which is not the client_id (%s) and authorized party (%s) is not equal client_id (%s): %w",
 			op,
 			oidcIDToken.Audience[0],
-			p.config.ClientID,
+			config.ClientID,
 			azp,
-			p.config.ClientID,
+			config.ClientID,
 			ErrInvalidAuthorizedParty)
+		return nil, result.record(VerificationCheckAuthorizedParty, err)
 	}
+	result.record(VerificationCheckAuthorizedParty, nil)
 
+	if oidcRequest == nil {
+		return claims, nil
+	}
 	if secs, authAfter := oidcRequest.MaxAge(); !authAfter.IsZero() {
 		atClaim, ok := claims["auth_time"].(float64)
 		if !ok {
-			return nil, fmt.Errorf("%s: missing auth_time claim when max age was requested: %w", op, ErrMissingClaim)
+			err := fmt.Errorf("%s: missing auth_time claim when max age was requested: %w", op, ErrMissingClaim)
+			return nil, result.record(VerificationCheckAuthTime, err)
 		}
 		authTime := time.Unix(int64(atClaim), 0)
 		if !authTime.Add(leeway).After(authAfter) {
-			return nil, fmt.Errorf("%s: auth_time (%s) is beyond max age (%d): %w", op, authTime, secs, ErrExpiredAuthTime)
+			err := fmt.Errorf("%s: auth_time (%s) is beyond max age (%d): %w", op, authTime, secs, ErrExpiredAuthTime)
+			return nil, result.record(VerificationCheckAuthTime, err)
 		}
+		result.record(VerificationCheckAuthTime, nil)
 	}
 
 	return claims, nil
 }
 
+// idTokenVerifier returns a verifier for the config and key set.  Since a
+// config is never modified once it's assigned to the provider, the verifier is
+// reused until the config or key set are replaced, which saves building a
+// verifier for every id_token verified.
+func (p *Provider) idTokenVerifier(config *Config, keySet oidc.KeySet) *oidc.IDTokenVerifier {
+	p.mu.RLock()
+	v := p.verifier
+	p.mu.RUnlock()
+	if v != nil && v.config == config && v.keySet == keySet {
+		return v.verifier
+	}
+
+	v = &providerVerifier{
+		config:   config,
+		keySet:   keySet,
+		verifier: newIDTokenVerifier(config, keySet),
+	}
+	p.mu.Lock()
+	p.verifier = v
+	p.mu.Unlock()
+	return v.verifier
+}
+
+// newIDTokenVerifier builds an id_token verifier for the config and key set.
+// The verifier checks the supported algs, signature, iss, exp and nbf.
+func newIDTokenVerifier(config *Config, keySet oidc.KeySet) *oidc.IDTokenVerifier {
+	return newJWTVerifier(config, keySet, config.SupportedSigningAlgs)
+}
+
+// newJWTVerifier builds a verifier for the provider's JWTs which are verified
+// like an id_token (like logout tokens), which are signed with one of the
+// supported algs.
+func newJWTVerifier(config *Config, keySet oidc.KeySet, supported []Alg) *oidc.IDTokenVerifier {
+	algs := make([]string, 0, len(supported))
+	for _, a := range supported {
+		algs = append(algs, string(a))
+	}
+	oidcConfig := &oidc.Config{
+		SkipClientIDCheck:    true,
+		SupportedSigningAlgs: algs,
+		Now:                  config.Now,
+		// the iss is checked by verifyIDTokenClaims, when the config's
+		// profile allows an issuer the verifier can't check.
+		SkipIssuerCheck: config.quirks().issuerWithoutScheme,
+		// the verifier's exp and nbf leeways are fixed, so they're checked
+		// by verifyIDTokenClaims when the config has a ClockSkew.
+		SkipExpiryCheck: config.ClockSkew > 0,
+	}
+	return oidc.NewVerifier(config.Issuer, keySet, oidcConfig)
+}
+
+// verifySkewedExpiry verifies the exp and nbf claims of a token verified
+// without an expiry check, allowing for the clock skew.
+func verifySkewedExpiry(now time.Time, skew time.Duration, t *oidc.IDToken) error {
+	const op = "verifySkewedExpiry"
+	if t.Expiry.Add(skew).Before(now) {
+		return fmt.Errorf("%s: token is expired (Token Expiry: %v): %w", op, t.Expiry, ErrExpiredToken)
+	}
+	var claims struct {
+		NotBefore *float64 `json:"nbf"`
+	}
+	if err := t.Claims(&claims); err != nil {
+		return fmt.Errorf("%s: unable to unmarshal claims: %w", op, err)
+	}
+	if claims.NotBefore != nil {
+		nbf := time.Unix(int64(*claims.NotBefore), 0)
+		if now.Add(skew).Before(nbf) {
+			return fmt.Errorf("%s: current time %v before the nbf (not before) time: %v: %w", op, now, nbf, ErrInvalidNotBefore)
+		}
+	}
+	return nil
+}
+
+// providerVerifier is an id_token verifier along with the config and key set
+// it was built from.
+type providerVerifier struct {
+	config   *Config
+	keySet   oidc.KeySet
+	verifier *oidc.IDTokenVerifier
+}
+
 // verifyAudience simply verified that the aud claim against the allowed
 // audiences.
-func (p *Provider) verifyAudience(allowedAudiences, audienceClaim []string) error {
+func verifyAudience(allowedAudiences, audienceClaim []string) error {
 	const op = "verifyAudiences"
 	if len(allowedAudiences) > 0 {
 		found := false
@@ -531,8 +1355,10 @@ func (p *Provider) verifyAudience(allowedAudiences, audienceClaim []string) erro
 
 // convertError is used to convert errors from the core-os and oauth2 library
 // calls of: provider.Exchange, verifier.Verify and provider.UserInfo
-func (p *Provider) convertError(e error) error {
+func convertError(e error) error {
 	switch {
+	case strings.Contains(e.Error(), ErrResponseTooLarge.Error()):
+		return fmt.Errorf("%s: %w", e.Error(), ErrResponseTooLarge)
 	case strings.Contains(e.Error(), "id token issued by a different provider"):
 		return fmt.Errorf("%s: %w", e.Error(), ErrInvalidIssuer)
 	case strings.Contains(e.Error(), "signed with unsupported algorithm"):
@@ -543,8 +1369,12 @@ func (p *Provider) convertError(e error) error {
 		return fmt.Errorf("%s: %w", e.Error(), ErrInvalidIssuedAt)
 	case strings.Contains(e.Error(), "token is expired"):
 		return fmt.Errorf("%s: %w", e.Error(), ErrExpiredToken)
+	case strings.Contains(e.Error(), ErrUnpinnedKey.Error()):
+		return fmt.Errorf("%s: %w", e.Error(), ErrUnpinnedKey)
 	case strings.Contains(e.Error(), "failed to verify id token signature"):
 		return fmt.Errorf("%s: %w", e.Error(), ErrInvalidSignature)
+	case strings.Contains(e.Error(), "malformed jwt"):
+		return fmt.Errorf("%s: %w", e.Error(), ErrMalformedToken)
 	case strings.Contains(e.Error(), "failed to decode keys"):
 		return fmt.Errorf("%s: %w", e.Error(), ErrInvalidJWKs)
 	case strings.Contains(e.Error(), "get keys failed"):
@@ -567,6 +1397,17 @@ func (p *Provider) HTTPClient() (*http.Client, error) {
 	const op = "Provider.NewHTTPClient"
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	c, err := p.httpClient()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return c, nil
+}
+
+// httpClient returns the provider's http.Client, creating it if needed.  The
+// caller must hold p.mu's write lock.
+func (p *Provider) httpClient() (*http.Client, error) {
+	const op = "Provider.httpClient"
 	if p.client != nil {
 		return p.client, nil
 	}
@@ -576,28 +1417,33 @@ func (p *Provider) HTTPClient() (*http.Client, error) {
 		return nil, fmt.Errorf("%s: the provider's config is nil %w", op, ErrNilParameter)
 	}
 
-	// use the cleanhttp package to create a "pooled" transport that's better
-	// configured for requests that re-use the same provider host.  Among other
-	// things, this transport supports better concurrency when making requests
-	// to the same host.  On the downside, this transport can leak file
-	// descriptors over time, so we'll be sure to call
-	// client.CloseIdleConnections() in the Provider.Done() to stave that off.
-	tr := cleanhttp.DefaultPooledTransport()
-
-	if p.config.ProviderCA != "" {
-		certPool := x509.NewCertPool()
-		if ok := certPool.AppendCertsFromPEM([]byte(p.config.ProviderCA)); !ok {
-			return nil, fmt.Errorf("%s: %w", op, ErrInvalidCACert)
-		}
-
-		tr.TLSClientConfig = &tls.Config{
-			RootCAs: certPool,
-		}
+	var tr *http.Transport
+	var err error
+	switch r := p.config.TransportRegistry; {
+	case r != nil:
+		tr, err = r.Transport(p.config.ProviderCA)
+	default:
+		// the transport isn't shared, so its idle connections are closed in
+		// Provider.Done()
+		tr, err = newPooledTransport(p.config.ProviderCA)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	// the transport is never shared when the config has client certificates
+	// (see Config.Validate)
+	tr = withClientCertificates(tr, p.config.ClientCertificates)
+	p.sharedTransport = p.config.TransportRegistry != nil
 
 	c := &http.Client{
 		Transport: tr,
 	}
+	if p.debugWriter != nil {
+		c.Transport = &debugTransport{base: tr, w: p.debugWriter}
+	}
+	if p.tracer != nil {
+		c.Transport = &traceTransport{base: c.Transport, tracer: p.tracer}
+	}
 	p.client = c
 	return p.client, nil
 }
@@ -621,7 +1467,8 @@ func (p *Provider) HTTPClientContext(ctx context.Context) (context.Context, erro
 // loopback uris. Ref: https://tools.ietf.org/html/rfc8252#section-7.3
 func (p *Provider) validRedirect(uri string) error {
 	const op = "Provider.validRedirect"
-	if len(p.config.AllowedRedirectURLs) == 0 {
+	config := p.currentConfig()
+	if len(config.AllowedRedirectURLs) == 0 {
 		return nil
 	}
 
@@ -631,8 +1478,8 @@ func (p *Provider) validRedirect(uri string) error {
 	}
 
 	// if uri isn't a loopback, just string search the allowed list
-	if !strutils.StrListContains([]string{"localhost", "127.0.0.1", "::1"}, inputURI.Hostname()) {
-		if !strutils.StrListContains(p.config.AllowedRedirectURLs, uri) {
+	if !isLoopback(inputURI.Hostname()) {
+		if !strutils.StrListContains(config.AllowedRedirectURLs, uri) {
 			return fmt.Errorf("%s: redirect URI %s: %w", op, uri, ErrUnauthorizedRedirectURI)
 		}
 	}
@@ -640,7 +1487,7 @@ func (p *Provider) validRedirect(uri string) error {
 	// otherwise, search for a match in a port-agnostic manner, per the OAuth RFC.
 	inputURI.Host = inputURI.Hostname()
 
-	for _, a := range p.config.AllowedRedirectURLs {
+	for _, a := range config.AllowedRedirectURLs {
 		allowedURI, err := url.Parse(a)
 		if err != nil {
 			return fmt.Errorf("%s: allowed redirect URI %s is an invalid URI %s: %w", op, allowedURI, err.Error(), ErrInvalidParameter)
@@ -653,3 +1500,77 @@ func (p *Provider) validRedirect(uri string) error {
 	}
 	return fmt.Errorf("%s: redirect URI %s: %w", op, uri, ErrUnauthorizedRedirectURI)
 }
+
+// DefaultOperationTimeout is the default limit for each of a provider's
+// network operations (discovery, exchange, JWKS, userinfo, refresh, etc) when
+// the operation's ctx doesn't have a deadline.
+const DefaultOperationTimeout = 30 * time.Second
+
+// providerOptions is the set of available options for NewProvider
+type providerOptions struct {
+	withLazyDiscovery       bool
+	withOperationTimeout    time.Duration
+	withTracer              Tracer
+	withMetricsSink         MetricsSink
+	withDebugWriter         io.Writer
+	withFetchRetries        retryPolicy
+	withResponseLimits      ResponseLimits
+	withClaimLimits         ClaimLimits
+	withRateLimits          RateLimits
+	withThrottleFunc        ThrottleFunc
+	withDiscoveryTTL        time.Duration
+	withJWKSRefreshInterval time.Duration
+}
+
+// providerDefaults is a handy way to get the defaults at runtime and
+// during unit tests.
+func providerDefaults() providerOptions {
+	return providerOptions{
+		withOperationTimeout: DefaultOperationTimeout,
+		withFetchRetries:     defaultRetryPolicy(),
+	}
+}
+
+// getProviderOpts gets the defaults and applies the opt overrides passed
+// in.
+func getProviderOpts(opt ...Option) providerOptions {
+	opts := providerDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithLazyDiscovery provides an option to defer the provider's discovery
+// request to the issuer until the provider is first used, which allows a
+// Provider to be created while its issuer is unreachable. Concurrent first
+// uses share a single discovery request, and a failed discovery is retried by
+// the next use.
+//
+// Valid for: Provider
+func WithLazyDiscovery() Option {
+	return func(o interface{}) {
+		if o, ok := o.(*providerOptions); ok {
+			o.withLazyDiscovery = true
+		}
+	}
+}
+
+// WithOperationTimeout provides an optional limit for each of the provider's
+// network operations when the operation's ctx doesn't have a deadline.  A ctx
+// deadline always takes precedence.  A timeout of zero disables the limit.
+// DefaultOperationTimeout is the default.
+//
+// When used with a JWKSCache, it limits each jwks_uri fetch which is started
+// by a caller whose ctx doesn't have a deadline.  When used with NewProvider,
+// it also limits the provider's background refreshes of its keys.
+//
+// Valid for: Provider and JWKSCache
+func WithOperationTimeout(timeout time.Duration) Option {
+	return func(o interface{}) {
+		switch v := o.(type) {
+		case *providerOptions:
+			v.withOperationTimeout = timeout
+		case *jwksCacheOptions:
+			v.withOperationTimeout = timeout
+		}
+	}
+}
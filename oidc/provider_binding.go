@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"fmt"
+)
+
+// ProviderMismatchError is returned when a request bound to one provider (see
+// WithProviderBinding) is completed using another provider, or using a
+// redirect URL that isn't registered for its provider.  It's the result of a
+// mix-up attack (or a misconfiguration) when several providers share a
+// callback.  It wraps ErrProviderMismatch, and errors.As can be used to get a
+// ProviderMismatchError from a callback's error.
+type ProviderMismatchError struct {
+	// State is the request's state.
+	State string
+
+	// RequestIssuer is the issuer of the provider the request is bound to.
+	RequestIssuer string
+
+	// ProviderIssuer is the issuer of the provider which received the
+	// request's response.
+	ProviderIssuer string
+
+	// RedirectURL is set when the response wasn't received using a redirect
+	// URL registered for the request's provider.
+	RedirectURL string
+}
+
+// Error satisfies the error interface.
+func (e *ProviderMismatchError) Error() string {
+	if e.RedirectURL != "" {
+		return fmt.Sprintf("request for state %q is bound to provider %q and its response was received using redirect URL %q which isn't registered for it: %s", e.State, e.RequestIssuer, e.RedirectURL, e.Unwrap())
+	}
+	return fmt.Sprintf("request for state %q is bound to provider %q and its response was received by provider %q: %s", e.State, e.RequestIssuer, e.ProviderIssuer, e.Unwrap())
+}
+
+// Unwrap returns ErrProviderMismatch.
+func (e *ProviderMismatchError) Unwrap() error { return ErrProviderMismatch }
+
+// VerifyProviderBinding verifies that a request bound to a provider (see
+// WithProviderBinding) is being completed by the provider, and that its
+// RedirectURL() is one of the provider's AllowedRedirectURLs.  A mismatch
+// returns an error wrapping a *ProviderMismatchError.  Requests which aren't
+// bound to a provider are always valid.
+//
+// The callback package's handlers use it for every request, and it should be
+// used by apps that implement their own callbacks.  It complements
+// VerifyResponseIssuer, which relies on the provider supporting the iss
+// response parameter.
+func (p *Provider) VerifyProviderBinding(oidcRequest Request) error {
+	const op = "Provider.VerifyProviderBinding"
+	if oidcRequest == nil {
+		return fmt.Errorf("%s: request is nil: %w", op, ErrNilParameter)
+	}
+	issuer := oidcRequest.ProviderIssuer()
+	if issuer == "" {
+		return nil
+	}
+	config := p.currentConfig()
+	if config == nil {
+		return fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
+	}
+	mismatch := &ProviderMismatchError{
+		State:          oidcRequest.State(),
+		RequestIssuer:  issuer,
+		ProviderIssuer: config.Issuer,
+	}
+	if issuer != config.Issuer {
+		return fmt.Errorf("%s: %w", op, mismatch)
+	}
+	if err := p.validRedirect(oidcRequest.RedirectURL()); err != nil {
+		mismatch.RedirectURL = oidcRequest.RedirectURL()
+		return fmt.Errorf("%s: %w", op, mismatch)
+	}
+	return nil
+}
+
+// WithProviderBinding optionally binds the request to the provider with the
+// issuer, which is verified when the request is completed (see
+// Provider.VerifyProviderBinding).  Provider.NewRequest(...) uses it to bind
+// its requests to the provider.
+//
+// Option is valid for: Request
+func WithProviderBinding(issuer string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*reqOptions); ok {
+			o.withProviderIssuer = issuer
+		}
+	}
+}
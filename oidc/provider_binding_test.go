@@ -0,0 +1,56 @@
+package oidc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_VerifyProviderBinding(t *testing.T) {
+	t.Parallel()
+	redirect := "https://app.example.com/callback"
+	tp := StartTestProvider(t)
+	p := testNewProvider(t, "test-client-id", "test-client-secret", redirect, tp)
+	defer p.Done()
+
+	tests := []struct {
+		name            string
+		opts            []Option
+		redirectURL     string
+		wantIsErr       error
+		wantRedirectURL string
+	}{
+		{name: "unbound", redirectURL: "https://evil.example.com/callback"},
+		{name: "bound", opts: []Option{WithProviderBinding(tp.Addr())}, redirectURL: redirect},
+		{name: "other-provider", opts: []Option{WithProviderBinding("https://other.example.com")}, redirectURL: redirect, wantIsErr: ErrProviderMismatch},
+		{name: "unregistered-redirect", opts: []Option{WithProviderBinding(tp.Addr())}, redirectURL: "https://evil.example.com/callback", wantIsErr: ErrProviderMismatch, wantRedirectURL: "https://evil.example.com/callback"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			oidcRequest, err := NewRequest(time.Minute, tt.redirectURL, tt.opts...)
+			require.NoError(err)
+			err = p.VerifyProviderBinding(oidcRequest)
+			if tt.wantIsErr == nil {
+				require.NoError(err)
+				return
+			}
+			require.Error(err)
+			assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+			var mismatch *ProviderMismatchError
+			require.True(errors.As(err, &mismatch))
+			assert.Equal(oidcRequest.State(), mismatch.State)
+			assert.Equal(oidcRequest.ProviderIssuer(), mismatch.RequestIssuer)
+			assert.Equal(tp.Addr(), mismatch.ProviderIssuer)
+			assert.Equal(tt.wantRedirectURL, mismatch.RedirectURL)
+		})
+	}
+	t.Run("nil-request", func(t *testing.T) {
+		err := p.VerifyProviderBinding(nil)
+		assert.Truef(t, errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+}
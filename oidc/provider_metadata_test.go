@@ -0,0 +1,142 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderMetadata_Validate(t *testing.T) {
+	t.Parallel()
+	valid := func() *ProviderMetadata {
+		return &ProviderMetadata{
+			AuthURL:  "https://idp.example.com/authorize",
+			TokenURL: "https://idp.example.com/token",
+			JWKSURL:  "https://idp.example.com/jwks",
+		}
+	}
+	tests := []struct {
+		name      string
+		m         func() *ProviderMetadata
+		wantIsErr error
+	}{
+		{name: "valid", m: valid},
+		{name: "optional-urls", m: func() *ProviderMetadata {
+			m := valid()
+			m.UserInfoURL = "https://idp.example.com/userinfo"
+			m.EndSessionURL = "https://idp.example.com/logout"
+			m.RevocationURL = "https://idp.example.com/revoke"
+			m.IntrospectionURL = "https://idp.example.com/introspect"
+			return m
+		}},
+		{name: "nil", m: func() *ProviderMetadata { return nil }, wantIsErr: ErrNilParameter},
+		{name: "missing-auth-url", m: func() *ProviderMetadata {
+			m := valid()
+			m.AuthURL = ""
+			return m
+		}, wantIsErr: ErrInvalidParameter},
+		{name: "missing-jwks-url", m: func() *ProviderMetadata {
+			m := valid()
+			m.JWKSURL = ""
+			return m
+		}, wantIsErr: ErrInvalidParameter},
+		{name: "invalid-token-url", m: func() *ProviderMetadata {
+			m := valid()
+			m.TokenURL = "ftp://idp.example.com/token"
+			return m
+		}, wantIsErr: ErrInvalidParameter},
+		{name: "invalid-userinfo-url", m: func() *ProviderMetadata {
+			m := valid()
+			m.UserInfoURL = "/userinfo"
+			return m
+		}, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.m().Validate()
+			if tt.wantIsErr != nil {
+				assert.Truef(t, errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNewProvider_providerMetadata(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	priv, _, alg, _ := tp.SigningKeys()
+	redirect := "https://example.com/callback"
+
+	// the issuer doesn't have a discovery document
+	issuer := "https://static.example.com"
+	m := &ProviderMetadata{
+		AuthURL:              "https://static.example.com/authorize",
+		TokenURL:             tp.Addr() + "/token",
+		JWKSURL:              tp.Addr() + "/.well-known/jwks.json",
+		CodeChallengeMethods: []string{"S256"},
+	}
+	tc, err := NewConfig(issuer, "client-id", "client-secret", []Alg{alg}, []string{redirect}, WithProviderCA(tp.CACert()), WithProviderMetadata(m))
+	require.NoError(t, err)
+	assert.Equal(t, m, tc.ProviderMetadata)
+
+	p, err := NewProvider(tc)
+	require.NoError(t, err)
+	t.Cleanup(p.Done)
+
+	t.Run("auth-url", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		oidcRequest, err := NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		authURL, err := p.AuthURL(ctx, oidcRequest)
+		require.NoError(err)
+		assert.True(strings.HasPrefix(authURL, m.AuthURL+"?"))
+	})
+	t.Run("supports", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		ok, err := p.Supports(ctx, FeaturePKCES256)
+		require.NoError(err)
+		assert.True(ok)
+		ok, err = p.Supports(ctx, FeatureUserInfo)
+		require.NoError(err)
+		assert.False(ok)
+	})
+	t.Run("verify-id-token", func(t *testing.T) {
+		require := require.New(t)
+		oidcRequest, err := NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		idToken := TestSignJWT(t, priv, alg, map[string]interface{}{
+			"iss":   issuer,
+			"aud":   "client-id",
+			"sub":   "alice@example.com",
+			"nonce": oidcRequest.Nonce(),
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}, nil)
+		_, err = p.VerifyIDToken(ctx, IDToken(idToken), oidcRequest)
+		require.NoError(err)
+	})
+	t.Run("health-check", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		status, err := p.HealthCheck(ctx)
+		require.NoError(err)
+		assert.True(status.Healthy)
+		assert.Zero(status.DiscoveryLatency)
+	})
+	t.Run("config-copy", func(t *testing.T) {
+		c := p.Config()
+		c.ProviderMetadata.CodeChallengeMethods[0] = "plain"
+		assert.Equal(t, []string{"S256"}, p.Config().ProviderMetadata.CodeChallengeMethods)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewConfig(issuer, "client-id", "client-secret", []Alg{alg}, []string{redirect}, WithProviderMetadata(&ProviderMetadata{AuthURL: m.AuthURL}))
+		assert.Truef(t, errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
@@ -0,0 +1,78 @@
+package oidc
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ProviderRegistry is a registry of Providers keyed by their issuer, which
+// allows multi-tenant apps to look up the Provider for a tenant's IdP (see
+// DomainResolver).
+//
+// A ProviderRegistry is safe for concurrent use.  The registry doesn't own
+// its Providers, so it doesn't call their Done() when they're removed.
+type ProviderRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]*Provider
+}
+
+// NewProviderRegistry creates a new ProviderRegistry.
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{
+		providers: map[string]*Provider{},
+	}
+}
+
+// Register adds the Provider to the registry using its config's issuer.  An
+// issuer can only be registered once.
+func (r *ProviderRegistry) Register(p *Provider) error {
+	const op = "ProviderRegistry.Register"
+	if p == nil {
+		return fmt.Errorf("%s: provider is nil: %w", op, ErrNilParameter)
+	}
+	config := p.currentConfig()
+	if config == nil {
+		return fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.providers[config.Issuer]; ok {
+		return fmt.Errorf("%s: issuer %s is already registered: %w", op, config.Issuer, ErrInvalidParameter)
+	}
+	r.providers[config.Issuer] = p
+	return nil
+}
+
+// Provider returns the registered Provider for the issuer.  If the issuer
+// isn't registered, then an error wrapping ErrNotFound is returned.
+func (r *ProviderRegistry) Provider(issuer string) (*Provider, error) {
+	const op = "ProviderRegistry.Provider"
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.providers[issuer]
+	if !ok {
+		return nil, fmt.Errorf("%s: issuer %s: %w", op, issuer, ErrNotFound)
+	}
+	return p, nil
+}
+
+// Remove the issuer's Provider from the registry.  It's not an error to
+// remove an issuer that isn't registered.
+func (r *ProviderRegistry) Remove(issuer string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.providers, issuer)
+}
+
+// Issuers returns the sorted issuers of the registered Providers.
+func (r *ProviderRegistry) Issuers() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	issuers := make([]string, 0, len(r.providers))
+	for iss := range r.providers {
+		issuers = append(issuers, iss)
+	}
+	sort.Strings(issuers)
+	return issuers
+}
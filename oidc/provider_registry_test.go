@@ -0,0 +1,50 @@
+package oidc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderRegistry(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	tp1, tp2 := StartTestProvider(t), StartTestProvider(t)
+	p1 := testNewProvider(t, "test-client-id", "test-client-secret", "https://app.example.com/callback", tp1)
+	defer p1.Done()
+	p2 := testNewProvider(t, "test-client-id", "test-client-secret", "https://app.example.com/callback", tp2)
+	defer p2.Done()
+
+	r := NewProviderRegistry()
+	err := r.Register(nil)
+	require.Error(err)
+	assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+
+	require.NoError(r.Register(p1))
+	require.NoError(r.Register(p2))
+	err = r.Register(p1)
+	require.Error(err)
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+
+	got, err := r.Provider(tp1.Addr())
+	require.NoError(err)
+	assert.Equal(p1, got)
+	got, err = r.Provider(tp2.Addr())
+	require.NoError(err)
+	assert.Equal(p2, got)
+
+	issuers := []string{tp1.Addr(), tp2.Addr()}
+	if issuers[0] > issuers[1] {
+		issuers[0], issuers[1] = issuers[1], issuers[0]
+	}
+	assert.Equal(issuers, r.Issuers())
+
+	r.Remove(tp1.Addr())
+	r.Remove(tp1.Addr())
+	_, err = r.Provider(tp1.Addr())
+	require.Error(err)
+	assert.Truef(errors.Is(err, ErrNotFound), "wanted \"%s\" but got \"%s\"", ErrNotFound, err)
+	assert.Equal([]string{tp2.Addr()}, r.Issuers())
+}
@@ -11,7 +11,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -33,6 +35,8 @@ func TestNewProvider(t *testing.T) {
 	tests := []struct {
 		name      string
 		config    *Config
+		opts      []Option
+		wantLazy  bool
 		wantErr   bool
 		wantIsErr error
 	}{
@@ -40,6 +44,31 @@ func TestNewProvider(t *testing.T) {
 			name:   "valid",
 			config: testNewConfig(t, clientID, clientSecret, redirect, tp),
 		},
+		{
+			name:     "valid-lazy-discovery",
+			config:   testNewConfig(t, clientID, clientSecret, redirect, tp),
+			opts:     []Option{WithLazyDiscovery()},
+			wantLazy: true,
+		},
+		{
+			name: "lazy-discovery-unreachable-issuer",
+			config: func() *Config {
+				c := testNewConfig(t, clientID, clientSecret, redirect, tp)
+				c.Issuer = "https://127.0.0.1:1"
+				return c
+			}(),
+			opts:     []Option{WithLazyDiscovery()},
+			wantLazy: true,
+		},
+		{
+			name: "unreachable-issuer",
+			config: func() *Config {
+				c := testNewConfig(t, clientID, clientSecret, redirect, tp)
+				c.Issuer = "https://127.0.0.1:1"
+				return c
+			}(),
+			wantErr: true,
+		},
 		{
 			name:      "nil-config",
 			config:    nil,
@@ -60,15 +89,22 @@ func TestNewProvider(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			assert, require := assert.New(t), require.New(t)
-			got, err := NewProvider(tt.config)
+			got, err := NewProvider(tt.config, tt.opts...)
 			if tt.wantErr {
 				require.Error(err)
-				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				if tt.wantIsErr != nil {
+					assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				}
 				return
 			}
 			require.NoError(err)
+			defer got.Done()
 			assert.NotNil(got.config)
-			assert.NotNil(got.provider)
+			if tt.wantLazy {
+				assert.Nil(got.provider)
+			} else {
+				assert.NotNil(got.provider)
+			}
 			assert.NotNil(got.client)
 			assert.NotNil(got.backgroundCtx)
 			assert.NotNil(got.backgroundCtxCancel)
@@ -76,6 +112,295 @@ func TestNewProvider(t *testing.T) {
 	}
 }
 
+func TestNewProviderWithContext(t *testing.T) {
+	t.Parallel()
+	tp := StartTestProvider(t)
+	tc := testNewConfig(t, "client-id", "client-secret", "https://redirect", tp)
+
+	t.Run("valid", func(t *testing.T) {
+		require := require.New(t)
+		p, err := NewProviderWithContext(context.Background(), tc)
+		require.NoError(err)
+		p.Done()
+	})
+	t.Run("canceled", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := NewProviderWithContext(ctx, tc)
+		require.Error(err)
+		assert.Truef(errors.Is(err, context.Canceled), "wanted \"%s\" but got \"%s\"", context.Canceled, err)
+	})
+	t.Run("deadline", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		slow := StartTestProvider(t)
+		slow.SetResponseDelay(time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := NewProviderWithContext(ctx, testNewConfig(t, "client-id", "client-secret", "https://redirect", slow))
+		require.Error(err)
+		assert.Truef(errors.Is(err, context.DeadlineExceeded), "wanted \"%s\" but got \"%s\"", context.DeadlineExceeded, err)
+		assert.Less(int64(time.Since(start)), int64(time.Second))
+	})
+	t.Run("lazy-ignores-ctx", func(t *testing.T) {
+		require := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		p, err := NewProviderWithContext(ctx, tc, WithLazyDiscovery())
+		require.NoError(err)
+		defer p.Done()
+		oidcRequest, err := NewRequest(time.Minute, "https://redirect")
+		require.NoError(err)
+		_, err = p.AuthURL(context.Background(), oidcRequest)
+		require.NoError(err)
+	})
+	t.Run("nil-ctx", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		//nolint:staticcheck // testing a nil ctx
+		_, err := NewProviderWithContext(nil, tc)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+}
+
+func TestProvider_LazyDiscovery(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+
+	t.Run("discovery-on-first-use", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, err := NewProvider(testNewConfig(t, clientID, "test-client-secret", redirect, tp), WithLazyDiscovery())
+		require.NoError(err)
+		defer p.Done()
+		require.Nil(p.provider)
+
+		oidcRequest, err := NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+		tp.SetExpectedAuthCode("test-code")
+		priv, _, alg, _ := tp.SigningKeys()
+		idToken := IDToken(TestSignJWT(t, priv, alg, map[string]interface{}{
+			"iss":   tp.Addr(),
+			"aud":   clientID,
+			"sub":   "alice@example.com",
+			"nonce": oidcRequest.Nonce(),
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}, nil))
+
+		// concurrent first uses share the discovery
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := p.VerifyIDToken(ctx, idToken, oidcRequest)
+				assert.NoError(err)
+			}()
+		}
+		wg.Wait()
+		assert.NotNil(p.provider)
+		discovered := p.provider
+
+		authURL, err := p.AuthURL(ctx, oidcRequest)
+		require.NoError(err)
+		assert.True(strings.HasPrefix(authURL, tp.Addr()))
+		assert.Equal(discovered, p.provider)
+	})
+	t.Run("unreachable-issuer", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c := testNewConfig(t, clientID, "test-client-secret", redirect, tp)
+		c.Issuer = "https://127.0.0.1:1"
+		p, err := NewProvider(c, WithLazyDiscovery())
+		require.NoError(err)
+		defer p.Done()
+
+		oidcRequest, err := NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		// every use retries the discovery
+		for i := 0; i < 2; i++ {
+			_, err = p.AuthURL(ctx, oidcRequest)
+			require.Error(err)
+			assert.Contains(err.Error(), "unable to discover provider")
+			assert.Nil(p.provider)
+		}
+	})
+}
+
+func TestProvider_OperationTimeout(t *testing.T) {
+	t.Parallel()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+	tp.SetExpectedRefreshToken("test-refresh-token")
+	const timeout = 50 * time.Millisecond
+	const delay = time.Second
+
+	newProvider := func(t *testing.T, opt ...Option) *Provider {
+		t.Helper()
+		tc := testNewConfig(t, clientID, "test-client-secret", redirect, tp)
+		// a new cache ensures the jwks are fetched
+		cache, err := NewJWKSCache()
+		require.NoError(t, err)
+		tc.JWKSCache = cache
+		p, err := NewProvider(tc, append([]Option{WithOperationTimeout(timeout)}, opt...)...)
+		require.NoError(t, err)
+		t.Cleanup(p.Done)
+		return p
+	}
+	p := newProvider(t)
+	lazy := newProvider(t, WithLazyDiscovery())
+
+	oidcRequest, err := NewRequest(time.Minute, redirect)
+	require.NoError(t, err)
+	tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+	priv, _, alg, _ := tp.SigningKeys()
+	idToken := IDToken(TestSignJWT(t, priv, alg, map[string]interface{}{
+		"iss":   tp.Addr(),
+		"aud":   clientID,
+		"sub":   "alice@example.com",
+		"nonce": oidcRequest.Nonce(),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+	}, nil))
+	refreshToken, err := NewToken(idToken, &oauth2.Token{AccessToken: "access", RefreshToken: "test-refresh-token", Expiry: time.Now().Add(-time.Minute)})
+	require.NoError(t, err)
+
+	operations := []struct {
+		name string
+		fn   func(ctx context.Context) error
+	}{
+		{
+			name: "discovery",
+			fn: func(ctx context.Context) error {
+				_, err := lazy.AuthURL(ctx, oidcRequest)
+				return err
+			},
+		},
+		{
+			name: "exchange",
+			fn: func(ctx context.Context) error {
+				_, err := p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+				return err
+			},
+		},
+		{
+			name: "jwks",
+			fn: func(ctx context.Context) error {
+				_, err := p.VerifyIDToken(ctx, idToken, oidcRequest)
+				return err
+			},
+		},
+		{
+			name: "userinfo",
+			fn: func(ctx context.Context) error {
+				var claims map[string]interface{}
+				return p.UserInfo(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "access"}), "alice@example.com", &claims)
+			},
+		},
+		{
+			name: "refresh",
+			fn: func(ctx context.Context) error {
+				_, err := p.RefreshToken(ctx, refreshToken)
+				return err
+			},
+		},
+		{
+			name: "health-check",
+			fn: func(ctx context.Context) error {
+				_, err := p.HealthCheck(ctx)
+				return err
+			},
+		},
+	}
+
+	tp.SetResponseDelay(delay)
+	t.Cleanup(func() { tp.SetResponseDelay(0) })
+	for _, op := range operations {
+		op := op
+		t.Run(op.name+"-default-timeout", func(t *testing.T) {
+			t.Parallel()
+			start := time.Now()
+			err := op.fn(context.Background())
+			require.Error(t, err)
+			assert.Less(t, int64(time.Since(start)), int64(delay))
+		})
+		t.Run(op.name+"-canceled", func(t *testing.T) {
+			t.Parallel()
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			start := time.Now()
+			err := op.fn(ctx)
+			require.Error(t, err)
+			assert.Less(t, int64(time.Since(start)), int64(delay))
+		})
+	}
+}
+
+func TestProvider_concurrentDiscovery(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetResponseDelay(50 * time.Millisecond)
+
+	sink := &testMetricsSink{}
+	p, err := NewProvider(testNewConfig(t, "client-id", "client-secret", redirect, tp), WithLazyDiscovery(), WithMetricsSink(sink))
+	require.NoError(err)
+	defer p.Done()
+	oidcRequest, err := NewRequest(time.Minute, redirect)
+	require.NoError(err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == 0 {
+				// a caller giving up doesn't fail the shared discovery
+				shortCtx, cancel := context.WithTimeout(ctx, time.Millisecond)
+				defer cancel()
+				_, err := p.AuthURL(shortCtx, oidcRequest)
+				assert.Error(err)
+				return
+			}
+			_, err := p.AuthURL(ctx, oidcRequest)
+			assert.NoError(err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(1, sink.latencies()[tp.Addr()+" "+MetricsOpDiscovery])
+}
+
+func TestProvider_OperationTimeout_ctxDeadline(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	tp := StartTestProvider(t)
+	p, err := NewProvider(testNewConfig(t, "client-id", "client-secret", "https://redirect", tp), WithOperationTimeout(250*time.Millisecond))
+	require.NoError(err)
+	defer p.Done()
+
+	// the ctx deadline takes precedence over the provider's timeout
+	tp.SetResponseDelay(500 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = p.HealthCheck(ctx)
+	require.NoError(err)
+
+	// discovery for a new provider is limited by the timeout
+	_, err = NewProvider(testNewConfig(t, "client-id", "client-secret", "https://redirect", tp), WithOperationTimeout(250*time.Millisecond))
+	require.Error(err)
+	assert.Contains(err.Error(), "deadline exceeded")
+}
+
 func TestProvider_Done(t *testing.T) {
 	t.Parallel()
 	tp := StartTestProvider(t)
@@ -141,6 +466,189 @@ func TestProvider_Done(t *testing.T) {
 	})
 }
 
+func TestProvider_Config(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	tp := StartTestProvider(t)
+	p := testNewProvider(t, "client-id", "client-secret", "https://redirect", tp)
+
+	got := p.Config()
+	assert.Equal(p.config, got)
+	got.AllowedRedirectURLs[0] = "https://changed"
+	got.ClientID = "changed"
+	assert.Equal([]string{"https://redirect"}, p.config.AllowedRedirectURLs)
+	assert.Equal("client-id", p.config.ClientID)
+}
+
+func TestProvider_UpdateConfig(t *testing.T) {
+	t.Parallel()
+	tp := StartTestProvider(t)
+	p := testNewProvider(t, "client-id", "client-secret", "https://redirect", tp)
+
+	validConfig := func() *Config {
+		c := p.Config()
+		c.ClientID = "new-client-id"
+		c.AllowedRedirectURLs = []string{"https://new-redirect"}
+		return c
+	}
+	invalidConfig := validConfig()
+	invalidConfig.ClientID = ""
+	newIssuerConfig := validConfig()
+	newIssuerConfig.Issuer = "https://new-issuer"
+	newCAConfig := validConfig()
+	_, newCA := TestGenerateCA(t, []string{"localhost"})
+	newCAConfig.ProviderCA = newCA
+
+	tests := []struct {
+		name      string
+		c         *Config
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name: "valid",
+			c:    validConfig(),
+		},
+		{
+			name: "valid-new-ca",
+			c:    newCAConfig,
+		},
+		{
+			name:      "nil-config",
+			wantErr:   true,
+			wantIsErr: ErrNilParameter,
+		},
+		{
+			name:      "invalid-config",
+			c:         invalidConfig,
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "new-issuer",
+			c:         newIssuerConfig,
+			wantErr:   true,
+			wantIsErr: ErrInvalidIssuer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			prevClient, err := p.HTTPClient()
+			require.NoError(err)
+			prev := p.Config()
+			err = p.UpdateConfig(tt.c)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				assert.Equal(prev, p.Config())
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.c, p.Config())
+
+			// the provider must use a copy of the config
+			tt.c.ClientID = "changed"
+			assert.Equal("new-client-id", p.Config().ClientID)
+
+			client, err := p.HTTPClient()
+			require.NoError(err)
+			if prev.ProviderCA != tt.c.ProviderCA {
+				assert.NotEqual(prevClient, client)
+			} else {
+				assert.Equal(prevClient, client)
+			}
+		})
+	}
+	t.Run("new-provider-copies-config", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c := testNewConfig(t, "client-id", "client-secret", "https://redirect", tp)
+		p, err := NewProvider(c)
+		require.NoError(err)
+		defer p.Done()
+		c.ClientID = "changed"
+		c.AllowedRedirectURLs[0] = "https://changed"
+		assert.Equal("client-id", p.Config().ClientID)
+		assert.Equal([]string{"https://redirect"}, p.Config().AllowedRedirectURLs)
+	})
+}
+
+// TestProvider_Concurrency is intended to be run with the race detector. It
+// exercises the provider's methods while its config is being replaced.
+func TestProvider_Concurrency(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+	p := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+
+	oidcRequest, err := NewRequest(time.Minute, redirect)
+	require.NoError(t, err)
+	tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+
+	const workers = 10
+	const iterations = 10
+	done := make(chan struct{})
+	updated := make(chan struct{})
+	go func() {
+		defer close(updated)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			c := p.Config()
+			// toggle settings which don't change the outcome of the
+			// requests being made concurrently
+			if i%2 == 0 {
+				c.Audiences = []string{clientID}
+				c.Scopes = append(c.Scopes, "email")
+				c.SupportedSigningAlgs = append(c.SupportedSigningAlgs, RS256)
+			} else {
+				c.Audiences = nil
+				c.Scopes = []string{oidc.ScopeOpenID}
+				c.SupportedSigningAlgs = c.SupportedSigningAlgs[:1]
+			}
+			assert.NoError(t, p.UpdateConfig(c))
+		}
+	}()
+
+	errs := make(chan error, workers*iterations)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				if _, err := p.AuthURL(ctx, oidcRequest); err != nil {
+					errs <- err
+					continue
+				}
+				tk, err := p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+				if err != nil {
+					errs <- err
+					continue
+				}
+				if _, err := p.VerifyIDToken(ctx, tk.IDToken(), oidcRequest); err != nil {
+					errs <- err
+				}
+				_ = p.Config()
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-updated
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
 func TestProvider_AuthURL(t *testing.T) {
 	ctx := context.Background()
 	clientID := "test-client-id"
@@ -173,6 +681,7 @@ func TestProvider_AuthURL(t *testing.T) {
 		WithDisplay(WAP),
 		WithPrompts(Login, Consent, SelectAccount),
 		WithUILocales(language.AmericanEnglish, language.Spanish),
+		WithClaimsLocales(language.Japanese, language.English),
 		WithClaims([]byte(reqClaims)),
 		WithACRValues("phr", "phrh"),
 	)
@@ -208,6 +717,31 @@ func TestProvider_AuthURL(t *testing.T) {
 	)
 	require.NoError(t, err)
 
+	reqWithAuthAudience, err := NewRequest(
+		1*time.Minute,
+		redirect,
+		WithAuthAudience("https://api.example.com"),
+		WithAudiences("id-token-audience"),
+	)
+	require.NoError(t, err)
+
+	reqWithOfflineAccess, err := NewRequest(
+		1*time.Minute,
+		redirect,
+		WithOfflineAccess(),
+		WithScopes("email", "offline_access"),
+		WithPrompts(Login),
+	)
+	require.NoError(t, err)
+
+	reqWithOfflineAccessNoPrompt, err := NewRequest(
+		1*time.Minute,
+		redirect,
+		WithOfflineAccess(),
+		WithPrompts(None),
+	)
+	require.NoError(t, err)
+
 	type args struct {
 		ctx         context.Context
 		oidcRequest Request
@@ -285,11 +819,12 @@ func TestProvider_AuthURL(t *testing.T) {
 			},
 			wantURL: func() string {
 				return fmt.Sprintf(
-					"%s/authorize?acr_values=%s&claims=%s&client_id=%s&display=%s&nonce=%s&prompt=%s&redirect_uri=%s&response_type=code&scope=openid+email+profile&state=%s&ui_locales=%s",
+					"%s/authorize?acr_values=%s&claims=%s&claims_locales=%s&client_id=%s&display=%s&nonce=%s&prompt=%s&redirect_uri=%s&response_type=code&scope=openid+email+profile&state=%s&ui_locales=%s",
 					tp.Addr(),
 					"phr+phrh", // r.ACRValues() encoded
 					// r.Claims() encoded
 					`%0A%09%7B%0A%09%09%22id_token%22%3A%0A%09%09+%7B%0A%09%09++%22auth_time%22%3A+%7B%22essential%22%3A+true%7D%2C%0A%09%09++%22acr%22%3A+%7B%22values%22%3A+%5B%22urn%3Amace%3Aincommon%3Aiap%3Asilver%22%5D+%7D%0A%09%09+%7D%0A%09+++%7D%0A%09+++`,
+					"ja+en", // r.ClaimsLocales() encoded
 					clientID,
 					"wap", // r.Display()
 					allOptsRequest.Nonce(),
@@ -300,6 +835,25 @@ func TestProvider_AuthURL(t *testing.T) {
 				)
 			}(),
 		},
+		{
+			name: "valid-with-auth-audience",
+			p:    p,
+			args: args{
+				ctx:         ctx,
+				oidcRequest: reqWithAuthAudience,
+			},
+			wantURL: func() string {
+				return fmt.Sprintf(
+					"%s/authorize?audience=%s&client_id=%s&nonce=%s&redirect_uri=%s&response_type=code&scope=openid&state=%s",
+					tp.Addr(),
+					"https%3A%2F%2Fapi.example.com", // r.AuthAudience() encoded
+					clientID,
+					reqWithAuthAudience.Nonce(),
+					redirectEncoded,
+					reqWithAuthAudience.State(),
+				)
+			}(),
+		},
 		{
 			name: "valid-using-implicit-flow-no-access-token",
 			p:    p,
@@ -401,6 +955,42 @@ func TestProvider_AuthURL(t *testing.T) {
 			wantErr:   true,
 			wantIsErr: ErrInvalidParameter,
 		},
+		{
+			name: "valid-offline-access",
+			p:    p,
+			args: args{
+				ctx:         ctx,
+				oidcRequest: reqWithOfflineAccess,
+			},
+			wantURL: func() string {
+				return fmt.Sprintf(
+					"%s/authorize?client_id=%s&nonce=%s&prompt=login+consent&redirect_uri=%s&response_type=code&scope=openid+email+offline_access&state=%s",
+					tp.Addr(),
+					clientID,
+					reqWithOfflineAccess.Nonce(),
+					redirectEncoded,
+					reqWithOfflineAccess.State(),
+				)
+			}(),
+		},
+		{
+			name: "valid-offline-access-prompt-none",
+			p:    p,
+			args: args{
+				ctx:         ctx,
+				oidcRequest: reqWithOfflineAccessNoPrompt,
+			},
+			wantURL: func() string {
+				return fmt.Sprintf(
+					"%s/authorize?client_id=%s&nonce=%s&prompt=none&redirect_uri=%s&response_type=code&scope=openid+offline_access&state=%s",
+					tp.Addr(),
+					clientID,
+					reqWithOfflineAccessNoPrompt.Nonce(),
+					redirectEncoded,
+					reqWithOfflineAccessNoPrompt.State(),
+				)
+			}(),
+		},
 		{
 			name: "bad-prompts",
 			p:    p,
@@ -601,6 +1191,32 @@ func TestProvider_Exchange(t *testing.T) {
 		assert.Nil(gotTk)
 		assert.Truef(errors.Is(err, ErrMissingAccessToken), "wanted \"%s\" but got \"%s\"", ErrMissingAccessToken, err)
 	})
+	t.Run("offline-access", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp.SetOmitIDTokens(false)
+		offlineRequest, err := NewRequest(10*time.Second, redirect, WithOfflineAccess())
+		require.NoError(err)
+		tp.SetExpectedAuthNonce(offlineRequest.Nonce())
+		tp.SetExpectedAuthCode("valid-code")
+
+		tp.SetExpectedRefreshToken("")
+		gotTk, err := p.Exchange(ctx, offlineRequest, offlineRequest.State(), "valid-code")
+		require.NoError(err)
+		assert.True(gotTk.OfflineAccessRequested())
+		assert.False(gotTk.RefreshTokenGranted())
+
+		tp.SetExpectedRefreshToken("test-refresh-token")
+		defer tp.SetExpectedRefreshToken("")
+		gotTk, err = p.Exchange(ctx, offlineRequest, offlineRequest.State(), "valid-code")
+		require.NoError(err)
+		assert.True(gotTk.OfflineAccessRequested())
+		assert.True(gotTk.RefreshTokenGranted())
+
+		refreshed, err := p.RefreshToken(ctx, gotTk)
+		require.NoError(err)
+		assert.True(refreshed.OfflineAccessRequested())
+		assert.True(refreshed.RefreshTokenGranted())
+	})
 	t.Run("expired-token", func(t *testing.T) {
 		assert, require := assert.New(t), require.New(t)
 		tp.SetOmitIDTokens(false)
@@ -613,6 +1229,243 @@ func TestProvider_Exchange(t *testing.T) {
 	})
 }
 
+func TestProvider_grantedScopes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+	tp.SetExpectedRefreshToken("test-refresh-token")
+	p := testNewProvider(t, "test-client-id", "test-client-secret", redirect, tp)
+
+	exchange := func(t *testing.T, opt ...Option) (*Tk, error) {
+		t.Helper()
+		r, err := NewRequest(time.Minute, redirect, append([]Option{WithScopes("email", "profile")}, opt...)...)
+		require.NoError(t, err)
+		tp.SetExpectedAuthNonce(r.Nonce())
+		return p.Exchange(ctx, r, r.State(), "test-code")
+	}
+
+	// the subtests aren't parallel, since they change the test provider's
+	// granted scopes
+	t.Run("all-granted", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp.SetGrantedScopes()
+		tk, err := exchange(t, WithRequiredScopes("email"))
+		require.NoError(err)
+		assert.Equal([]string{"openid", "email", "profile"}, tk.RequestedScopes())
+		assert.Equal([]string{"openid", "email", "profile"}, tk.GrantedScopes())
+		assert.Empty(tk.DeniedScopes())
+	})
+	t.Run("downgraded", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp.SetGrantedScopes("openid", "email")
+		tk, err := exchange(t)
+		require.NoError(err)
+		assert.Equal([]string{"openid", "email"}, tk.GrantedScopes())
+		assert.Equal([]string{"profile"}, tk.DeniedScopes())
+	})
+	t.Run("required-not-granted", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp.SetGrantedScopes("openid", "email")
+		_, err := exchange(t, WithRequiredScopes("email", "profile"))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrScopesNotGranted), "wanted \"%s\" but got \"%s\"", ErrScopesNotGranted, err)
+		assert.Contains(err.Error(), "profile")
+	})
+	t.Run("refresh", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp.SetGrantedScopes("openid", "email")
+		tk, err := exchange(t, WithRequiredScopes("email"))
+		require.NoError(err)
+
+		// the previously granted scopes are retained when the refresh
+		// response doesn't include them
+		tp.SetGrantedScopes()
+		refreshed, err := p.RefreshToken(ctx, tk)
+		require.NoError(err)
+		assert.Equal(tk.RequestedScopes(), refreshed.RequestedScopes())
+		assert.Equal([]string{"openid", "email"}, refreshed.GrantedScopes())
+
+		tp.SetGrantedScopes("openid")
+		_, err = p.RefreshToken(ctx, refreshed)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrScopesNotGranted), "wanted \"%s\" but got \"%s\"", ErrScopesNotGranted, err)
+	})
+}
+
+func TestProvider_RefreshToken(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	clientSecret := "test-client-secret"
+	redirect := "https://test-redirect"
+
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedRefreshToken("test-refresh-token")
+	p := testNewProvider(t, clientID, clientSecret, redirect, tp)
+
+	priorIDToken := IDToken(tp.issueSignedJWT())
+	validToken, err := NewToken(priorIDToken, &oauth2.Token{AccessToken: "prior", RefreshToken: "test-refresh-token"})
+	require.NoError(t, err)
+	noRefreshToken, err := NewToken(priorIDToken, &oauth2.Token{AccessToken: "prior"})
+	require.NoError(t, err)
+	badRefreshToken, err := NewToken(priorIDToken, &oauth2.Token{AccessToken: "prior", RefreshToken: "bad"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		p           *Provider
+		token       Token
+		omitIDToken bool
+		wantErr     bool
+		wantIsErr   error
+		wantErrStr  string
+	}{
+		{
+			name:  "valid",
+			p:     p,
+			token: validToken,
+		},
+		{
+			name:        "valid-without-id-token",
+			p:           p,
+			token:       validToken,
+			omitIDToken: true,
+		},
+		{
+			name:      "nil-config",
+			p:         &Provider{},
+			token:     validToken,
+			wantErr:   true,
+			wantIsErr: ErrNilParameter,
+		},
+		{
+			name:      "nil-token",
+			p:         p,
+			wantErr:   true,
+			wantIsErr: ErrNilParameter,
+		},
+		{
+			name:      "missing-refresh-token",
+			p:         p,
+			token:     noRefreshToken,
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:       "bad-refresh-token",
+			p:          p,
+			token:      badRefreshToken,
+			wantErr:    true,
+			wantIsErr:  ErrRefreshTokenRejected,
+			wantErrStr: "invalid_grant",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			tp.SetOmitIDTokens(tt.omitIDToken)
+			defer tp.SetOmitIDTokens(false)
+			gotTk, err := tt.p.RefreshToken(ctx, tt.token)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Nil(gotTk)
+				if tt.wantIsErr != nil {
+					assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				}
+				if tt.wantErrStr != "" {
+					assert.Contains(err.Error(), tt.wantErrStr)
+				}
+				return
+			}
+			require.NoError(err)
+			assert.NotEqual(tt.token.AccessToken(), gotTk.AccessToken())
+			assert.Equal(tt.token.RefreshToken(), gotTk.RefreshToken())
+			if tt.omitIDToken {
+				assert.Equal(tt.token.IDToken(), gotTk.IDToken())
+				return
+			}
+			assert.NotEqual(tt.token.IDToken(), gotTk.IDToken())
+		})
+	}
+	t.Run("expired-id-token", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp.SetExpectedExpiry(-1 * time.Minute)
+		defer tp.SetExpectedExpiry(5 * time.Second)
+		gotTk, err := p.RefreshToken(ctx, validToken)
+		require.Error(err)
+		assert.Nil(gotTk)
+		assert.Truef(errors.Is(err, ErrExpiredToken), "wanted \"%s\" but got \"%s\"", ErrExpiredToken, err)
+	})
+	t.Run("different-subject", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp.SetCustomClaims(map[string]interface{}{"sub": "eve@example.com"})
+		defer tp.SetCustomClaims(map[string]interface{}{})
+		gotTk, err := p.RefreshToken(ctx, validToken)
+		require.Error(err)
+		assert.Nil(gotTk)
+		assert.Truef(errors.Is(err, ErrInvalidSubject), "wanted \"%s\" but got \"%s\"", ErrInvalidSubject, err)
+	})
+}
+
+func Test_verifyRefreshedIDToken(t *testing.T) {
+	t.Parallel()
+	_, priv := TestGenerateKeys(t)
+	original := IDToken(TestSignJWT(t, priv, ES256, map[string]interface{}{
+		"iss": "https://issuer.example.com",
+		"sub": "alice@example.com",
+		"aud": "client-id",
+	}, nil))
+	config := &Config{ClientID: "client-id"}
+	tests := []struct {
+		name     string
+		original IDToken
+		claims   map[string]interface{}
+		wantErr  error
+	}{
+		{
+			name:     "valid",
+			original: original,
+			claims:   map[string]interface{}{"iss": "https://issuer.example.com", "sub": "alice@example.com", "aud": []interface{}{"other", "client-id"}},
+		},
+		{
+			name:   "no-original",
+			claims: map[string]interface{}{"iss": "https://other.example.com"},
+		},
+		{
+			name:     "different-issuer",
+			original: original,
+			claims:   map[string]interface{}{"iss": "https://other.example.com", "sub": "alice@example.com", "aud": "client-id"},
+			wantErr:  ErrInvalidIssuer,
+		},
+		{
+			name:     "different-subject",
+			original: original,
+			claims:   map[string]interface{}{"iss": "https://issuer.example.com", "sub": "eve@example.com", "aud": "client-id"},
+			wantErr:  ErrInvalidSubject,
+		},
+		{
+			name:     "missing-client-audience",
+			original: original,
+			claims:   map[string]interface{}{"iss": "https://issuer.example.com", "sub": "alice@example.com", "aud": "other"},
+			wantErr:  ErrInvalidAudience,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyRefreshedIDToken(config, tt.original, tt.claims)
+			if tt.wantErr != nil {
+				require.Truef(t, errors.Is(err, tt.wantErr), "wanted \"%s\" but got \"%s\"", tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
 func TestHTTPClient(t *testing.T) {
 	// HTTPClient if mostly covered by other tests, but we need to make
 	// sure we handle nil configs and invalid CA certs
@@ -1385,6 +2238,22 @@ func TestProvider_VerifyIDToken(t *testing.T) {
 	})
 }
 
+func TestProvider_idTokenVerifier(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	p := testNewProvider(t, "client-id", "client-secret", "https://redirect", tp)
+	_, keySet, err := p.discovered(ctx)
+	require.NoError(err)
+
+	v := p.idTokenVerifier(p.currentConfig(), keySet)
+	assert.Same(v, p.idTokenVerifier(p.currentConfig(), keySet))
+
+	require.NoError(p.UpdateConfig(p.Config()))
+	assert.NotSame(v, p.idTokenVerifier(p.currentConfig(), keySet))
+}
+
 func TestProvider_validRedirect(t *testing.T) {
 	tests := []struct {
 		uri      string
@@ -1425,3 +2294,110 @@ func TestProvider_validRedirect(t *testing.T) {
 		})
 	}
 }
+
+func BenchmarkProvider_AuthURL(b *testing.B) {
+	ctx := context.Background()
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(b)
+	p := testNewProvider(b, "test-client-id", "test-client-secret", redirect, tp)
+	verifier, err := NewCodeVerifier()
+	require.NoError(b, err)
+	oidcRequest, err := NewRequest(time.Minute, redirect, WithPKCE(verifier), WithScopes("email", "profile"))
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.AuthURL(ctx, oidcRequest); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProvider_Exchange(b *testing.B) {
+	ctx := context.Background()
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(b)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+	p := testNewProvider(b, "test-client-id", "test-client-secret", redirect, tp)
+	oidcRequest, err := NewRequest(time.Hour, redirect)
+	require.NoError(b, err)
+	tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProvider_VerifyIDToken(b *testing.B) {
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(b)
+	p := testNewProvider(b, clientID, "test-client-secret", redirect, tp)
+	oidcRequest, err := NewRequest(time.Hour, redirect)
+	require.NoError(b, err)
+	priv, _, alg, _ := tp.SigningKeys()
+	idToken := IDToken(TestSignJWT(b, priv, alg, map[string]interface{}{
+		"iss":   tp.Addr(),
+		"aud":   clientID,
+		"sub":   "alice@example.com",
+		"nonce": oidcRequest.Nonce(),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}, nil))
+	// warm the JWKS cache
+	_, err = p.VerifyIDToken(ctx, idToken, oidcRequest)
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.VerifyIDToken(ctx, idToken, oidcRequest); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestProvider_AuthURL_configDefaults(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tc := testNewConfig(t, "test-client-id", "test-client-secret", redirect, tp)
+	tc.Prompts = []Prompt{SelectAccount}
+	tc.Display = Popup
+	p, err := NewProvider(tc)
+	require.NoError(t, err)
+	t.Cleanup(p.Done)
+
+	tests := []struct {
+		name        string
+		opt         []Option
+		wantPrompt  string
+		wantDisplay string
+	}{
+		{name: "defaults", wantPrompt: "select_account", wantDisplay: "popup"},
+		{name: "request-prompts", opt: []Option{WithPrompts(Login)}, wantPrompt: "login", wantDisplay: "popup"},
+		{name: "request-display", opt: []Option{WithDisplay(Touch)}, wantPrompt: "select_account", wantDisplay: "touch"},
+		{name: "offline-access", opt: []Option{WithOfflineAccess()}, wantPrompt: "select_account consent", wantDisplay: "popup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			oidcRequest, err := NewRequest(time.Minute, redirect, tt.opt...)
+			require.NoError(err)
+			got, err := p.AuthURL(ctx, oidcRequest)
+			require.NoError(err)
+			u, err := url.Parse(got)
+			require.NoError(err)
+			assert.Equal(tt.wantPrompt, u.Query().Get("prompt"))
+			assert.Equal(tt.wantDisplay, u.Query().Get("display"))
+		})
+	}
+}
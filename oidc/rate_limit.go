@@ -0,0 +1,187 @@
+package oidc
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket which limits the rate of a provider's requests
+// to one of its endpoints.  A zero Rate doesn't limit the endpoint's
+// requests.
+type RateLimit struct {
+	// Rate is the sustained number of requests per second sent to the
+	// endpoint.
+	Rate float64
+
+	// Burst is the number of requests which may be sent at once, before the
+	// Rate applies.  A zero Burst allows a single request at once.
+	Burst int
+}
+
+// RateLimits are the client-side rate limits for the requests sent to a
+// provider's endpoints, which keep bursts of logins, refreshes or token
+// validations from tripping the IdP's own throttling.  A request which
+// exceeds its endpoint's limit waits until it's allowed, or until its ctx is
+// done.  The limits are shared by all of the provider's operations.
+type RateLimits struct {
+	// Discovery limits the discovery requests.
+	Discovery RateLimit
+
+	// Token limits the token endpoint requests (exchange and refresh).
+	Token RateLimit
+
+	// JWKS limits the JSON Web Key Set requests.
+	JWKS RateLimit
+
+	// UserInfo limits the userinfo endpoint requests.
+	UserInfo RateLimit
+}
+
+// ThrottleFunc is called each time a request waits for its endpoint's rate
+// limit (see WithRateLimits).  The endpoint is one of: "discovery", "token",
+// "jwks" or "userinfo", and wait is how long the request will be delayed.
+// ThrottleFunc is called synchronously, so it must not block.
+type ThrottleFunc func(endpoint string, wait time.Duration)
+
+// WithRateLimits provides optional client-side rate limits for the
+// provider's requests, and an optional ThrottleFunc which observes the
+// requests that are delayed.  See RateLimits.
+//
+// Valid for: Provider
+func WithRateLimits(l RateLimits, onThrottle ThrottleFunc) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*providerOptions); ok {
+			o.withRateLimits = l
+			o.withThrottleFunc = onThrottle
+		}
+	}
+}
+
+// validate checks that none of the rates or bursts are negative.
+func (l RateLimits) validate() error {
+	const op = "RateLimits.validate"
+	for _, r := range []RateLimit{l.Discovery, l.Token, l.JWKS, l.UserInfo} {
+		if r.Rate < 0 || r.Burst < 0 {
+			return fmt.Errorf("%s: rate limits must not be negative: %w", op, ErrInvalidParameter)
+		}
+	}
+	return nil
+}
+
+// buckets returns a token bucket for each of the limited endpoints
+func (l RateLimits) buckets() map[string]*tokenBucket {
+	buckets := map[string]*tokenBucket{}
+	for endpoint, r := range map[string]RateLimit{
+		discoveryEndpoint: l.Discovery,
+		tokenEndpoint:     l.Token,
+		jwksEndpoint:      l.JWKS,
+		userInfoEndpoint:  l.UserInfo,
+	} {
+		if r.Rate > 0 {
+			buckets[endpoint] = newTokenBucket(r)
+		}
+	}
+	return buckets
+}
+
+// tokenBucket is a token bucket rate limiter, which is full when it's
+// created.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	// now is time.Now, except in unit tests
+	now func() time.Time
+}
+
+// newTokenBucket creates a full tokenBucket for the rate limit
+func newTokenBucket(r RateLimit) *tokenBucket {
+	burst := float64(r.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   r.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// reserve takes a token from the bucket and returns how long the caller must
+// wait before the token is available.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a reserved token to the bucket, when its caller gives up
+// waiting for it.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// rateLimitTransport is an http.RoundTripper which delays requests that
+// exceed the endpoint's rate limit.
+type rateLimitTransport struct {
+	base       http.RoundTripper
+	endpoint   string
+	bucket     *tokenBucket
+	onThrottle ThrottleFunc
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if wait := t.bucket.reserve(); wait > 0 {
+		if t.onThrottle != nil {
+			t.onThrottle(t.endpoint, wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			t.bucket.cancel()
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, fmt.Errorf("%s request canceled while rate limited: %w", t.endpoint, req.Context().Err())
+		case <-timer.C:
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the base transport's idle connections.
+func (t *rateLimitTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if tr, ok := t.base.(closeIdler); ok {
+		tr.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,125 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_tokenBucket(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	now := time.Now()
+	b := newTokenBucket(RateLimit{Rate: 2, Burst: 2})
+	b.last = now
+	b.now = func() time.Time { return now }
+
+	// the bucket starts full
+	assert.Equal(time.Duration(0), b.reserve())
+	assert.Equal(time.Duration(0), b.reserve())
+	// and then requests are delayed until the rate's tokens are available
+	assert.Equal(500*time.Millisecond, b.reserve())
+	assert.Equal(time.Second, b.reserve())
+
+	// a canceled reservation returns its token
+	b.cancel()
+	assert.Equal(time.Second, b.reserve())
+
+	// the bucket refills at the rate, but never beyond its burst
+	now = now.Add(time.Hour)
+	assert.Equal(time.Duration(0), b.reserve())
+	assert.Equal(time.Duration(0), b.reserve())
+	assert.Equal(500*time.Millisecond, b.reserve())
+
+	// a zero burst allows a single request at once
+	b = newTokenBucket(RateLimit{Rate: 1})
+	b.last = now
+	b.now = func() time.Time { return now }
+	assert.Equal(time.Duration(0), b.reserve())
+	assert.Equal(time.Second, b.reserve())
+}
+
+func TestRateLimits_validate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		limits  RateLimits
+		wantErr bool
+	}{
+		{name: "zero", limits: RateLimits{}},
+		{name: "valid", limits: RateLimits{Token: RateLimit{Rate: 10, Burst: 5}, JWKS: RateLimit{Rate: 0.5}}},
+		{name: "negative-rate", limits: RateLimits{Discovery: RateLimit{Rate: -1}}, wantErr: true},
+		{name: "negative-burst", limits: RateLimits{UserInfo: RateLimit{Rate: 1, Burst: -1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			err := tt.limits.validate()
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+				return
+			}
+			require.NoError(err)
+		})
+	}
+}
+
+func TestProvider_rateLimits(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+
+	t.Run("invalid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c := testNewConfig(t, clientID, "test-client-secret", redirect, tp)
+		_, err := NewProvider(c, WithRateLimits(RateLimits{Token: RateLimit{Rate: -1}}, nil))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("throttled", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		var mu sync.Mutex
+		var throttled []string
+		onThrottle := func(endpoint string, wait time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			throttled = append(throttled, endpoint)
+			assert.Greater(int64(wait), int64(time.Minute))
+		}
+		c := testNewConfig(t, clientID, "test-client-secret", redirect, tp)
+		p, err := NewProvider(c, WithRateLimits(RateLimits{UserInfo: RateLimit{Rate: 0.001}}, onThrottle))
+		require.NoError(err)
+		t.Cleanup(p.Done)
+
+		oidcRequest, err := NewRequest(time.Minute, redirect)
+		require.NoError(err)
+		tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+		tk, err := p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+		require.NoError(err)
+
+		// the first userinfo request uses the bucket's only token
+		var claims map[string]interface{}
+		require.NoError(p.UserInfo(ctx, tk.StaticTokenSource(), "alice@example.com", &claims))
+
+		// so the next one waits until its ctx is done
+		timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		err = p.UserInfo(timeoutCtx, tk.StaticTokenSource(), "alice@example.com", &claims)
+		require.Error(err)
+		assert.Truef(errors.Is(err, context.DeadlineExceeded), "wanted \"%s\" but got \"%s\"", context.DeadlineExceeded, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal([]string{userInfoEndpoint}, throttled)
+	})
+}
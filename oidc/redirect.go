@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NewRequest creates a new Request for the provider using one of its
+// registered redirect URLs (see Config.AllowedRedirectURLs), which allows a
+// single provider to serve apps with several hostnames.  The redirectURL is
+// validated when the request is created, rather than when its AuthURL is
+// generated.  If the redirectURL is empty, the first of the config's
+// AllowedRedirectURLs is used.  See RedirectURLForHost(...) for selecting a
+// redirect URL using the host of an incoming http request.
+//
+// The request's RedirectURL() is used for both its AuthURL and its Exchange,
+// and the callback package's handlers can verify that the provider's response
+// was received using it (see callback.WithRedirectURLVerification).
+//
+// The request is bound to the provider (see WithProviderBinding), so the
+// callback package's handlers only complete it using the same provider.  Its
+// expiration uses the provider's clock (see Clock), unless the WithNow option
+// is provided.
+//
+// See the package's NewRequest(...) for the supported options.
+func (p *Provider) NewRequest(expireIn time.Duration, redirectURL string, opt ...Option) (*Req, error) {
+	const op = "Provider.NewRequest"
+	config := p.currentConfig()
+	if config == nil {
+		return nil, fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
+	}
+	if redirectURL == "" {
+		if len(config.AllowedRedirectURLs) == 0 {
+			return nil, fmt.Errorf("%s: redirect URL is empty and there are no allowed redirect URLs: %w", op, ErrInvalidParameter)
+		}
+		redirectURL = config.AllowedRedirectURLs[0]
+	}
+	if err := p.validRedirect(redirectURL); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	opt = append([]Option{WithProviderBinding(config.Issuer), WithNow(config.NowFunc)}, opt...)
+	r, err := NewRequest(expireIn, redirectURL, opt...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return r, nil
+}
+
+// RedirectURLForHost returns the first of the config's AllowedRedirectURLs
+// whose host (including its port) matches the host, which is typically the
+// Host of the incoming http request that starts an authentication flow.
+// Hosts are compared case-insensitively, and the port of a loopback redirect
+// URL is ignored.  An error wrapping ErrUnauthorizedRedirectURI is returned
+// when there isn't a match.
+func (p *Provider) RedirectURLForHost(host string) (string, error) {
+	const op = "Provider.RedirectURLForHost"
+	config := p.currentConfig()
+	if config == nil {
+		return "", fmt.Errorf("%s: provider config is nil: %w", op, ErrNilParameter)
+	}
+	if host == "" {
+		return "", fmt.Errorf("%s: host is empty: %w", op, ErrInvalidParameter)
+	}
+	for _, allowed := range config.AllowedRedirectURLs {
+		u, err := url.Parse(allowed)
+		if err != nil {
+			return "", fmt.Errorf("%s: allowed redirect URI %s is an invalid URI %s: %w", op, allowed, err.Error(), ErrInvalidParameter)
+		}
+		if RedirectHostsEqual(u.Host, host) {
+			return allowed, nil
+		}
+	}
+	return "", fmt.Errorf("%s: no redirect URI for host %s: %w", op, host, ErrUnauthorizedRedirectURI)
+}
+
+// RedirectHostsEqual reports whether the hosts (which may include ports) of
+// two redirect URLs are equal.  Hosts are compared case-insensitively, and the
+// ports of loopback hosts are ignored.
+// See: https://tools.ietf.org/html/rfc8252#section-7.3
+func RedirectHostsEqual(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a == b {
+		return true
+	}
+	ua, ub := url.URL{Host: a}, url.URL{Host: b}
+	if !isLoopback(ua.Hostname()) {
+		return false
+	}
+	return ua.Hostname() == ub.Hostname()
+}
+
+// isLoopback reports whether the hostname is a loopback host.
+func isLoopback(hostname string) bool {
+	switch hostname {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
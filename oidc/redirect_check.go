@@ -0,0 +1,214 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// RedirectIssueSeverity is the severity of a RedirectURLIssue.
+type RedirectIssueSeverity int
+
+const (
+	// RedirectIssueWarning is a likely mistake, which some providers accept.
+	RedirectIssueWarning RedirectIssueSeverity = iota
+
+	// RedirectIssueError is a mistake which will cause logins to fail.
+	RedirectIssueError
+)
+
+// String returns the severity's name.
+func (s RedirectIssueSeverity) String() string {
+	switch s {
+	case RedirectIssueWarning:
+		return "warning"
+	case RedirectIssueError:
+		return "error"
+	default:
+		return fmt.Sprintf("RedirectIssueSeverity(%d)", int(s))
+	}
+}
+
+// RedirectURLIssue is a problem with a redirect URL found by
+// Config.CheckRedirectURLs.
+type RedirectURLIssue struct {
+	// URL is the redirect URL with the issue.
+	URL string
+
+	// Severity is the issue's severity.
+	Severity RedirectIssueSeverity
+
+	// Message describes the issue and how to fix it.
+	Message string
+}
+
+// String returns a description of the issue, suitable for logging.
+func (i RedirectURLIssue) String() string {
+	return fmt.Sprintf("%s: redirect URL %q: %s", i.Severity, i.URL, i.Message)
+}
+
+// CheckRedirectURLs is a development-time helper which checks the config's
+// AllowedRedirectURLs and the optional redirectURLs the app uses (for
+// example: the redirect URL of its NewRequest calls) for common mistakes,
+// which otherwise cause the first login to fail cryptically at the provider.
+// It returns the issues found, which are empty when there aren't any.  It
+// checks:
+//
+//   - the URL is absolute, and doesn't have a fragment or surrounding
+//     whitespace (errors).
+//
+//   - the URL's host resolves, unless it's a loopback or IP address (an
+//     error).  Use WithRedirectURLResolver to override the resolver.
+//
+//   - http isn't used for a non-loopback host, a loopback redirect uses an IP
+//     literal rather than "localhost", and a private-use URI scheme is a
+//     reverse domain name (warnings).
+//
+//   - the redirectURLs are allowed by the AllowedRedirectURLs (with a
+//     port-agnostic match for loopback URLs), and it's noted when they only
+//     differ by a trailing slash (errors).
+//
+// See: https://tools.ietf.org/html/rfc6749#section-3.1.2 and
+// https://tools.ietf.org/html/rfc8252#section-7
+//
+// Supported options: WithRedirectURLResolver
+func (c *Config) CheckRedirectURLs(ctx context.Context, redirectURLs []string, opt ...Option) []RedirectURLIssue {
+	opts := getRedirectCheckOpts(opt...)
+	var issues []RedirectURLIssue
+	checked := map[string]bool{}
+	for _, u := range append(copyStrings(c.AllowedRedirectURLs), redirectURLs...) {
+		if checked[u] {
+			continue
+		}
+		checked[u] = true
+		issues = append(issues, checkRedirectURL(ctx, u, opts)...)
+	}
+	if len(c.AllowedRedirectURLs) == 0 {
+		return issues
+	}
+	for _, u := range redirectURLs {
+		if redirectAllowed(c.AllowedRedirectURLs, u) {
+			continue
+		}
+		issue := RedirectURLIssue{URL: u, Severity: RedirectIssueError, Message: "isn't one of the AllowedRedirectURLs, so it will be rejected"}
+		for _, allowed := range c.AllowedRedirectURLs {
+			if strings.TrimSuffix(allowed, "/") == strings.TrimSuffix(u, "/") {
+				issue.Message = fmt.Sprintf("only differs from the allowed redirect URL %q by a trailing slash, which must match exactly", allowed)
+				break
+			}
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// checkRedirectURL checks the redirect URL for common mistakes.
+func checkRedirectURL(ctx context.Context, redirectURL string, opts redirectCheckOptions) []RedirectURLIssue {
+	var issues []RedirectURLIssue
+	add := func(s RedirectIssueSeverity, format string, a ...interface{}) {
+		issues = append(issues, RedirectURLIssue{URL: redirectURL, Severity: s, Message: fmt.Sprintf(format, a...)})
+	}
+	if strings.TrimSpace(redirectURL) != redirectURL {
+		add(RedirectIssueError, "has leading or trailing whitespace")
+	}
+	u, err := url.Parse(strings.TrimSpace(redirectURL))
+	if err != nil {
+		add(RedirectIssueError, "is an invalid URL: %s", err)
+		return issues
+	}
+	if u.Fragment != "" || strings.Contains(redirectURL, "#") {
+		add(RedirectIssueError, "must not have a fragment")
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "":
+		add(RedirectIssueError, "must be an absolute URL")
+		return issues
+	default:
+		// a private-use URI scheme of a native app
+		if !strings.Contains(u.Scheme, ".") {
+			add(RedirectIssueWarning, "private-use URI scheme %q should be a reverse domain name (for example: com.example.app)", u.Scheme)
+		}
+		return issues
+	}
+	host := u.Hostname()
+	switch {
+	case host == "":
+		add(RedirectIssueError, "doesn't have a host")
+	case host == "localhost":
+		add(RedirectIssueWarning, "loopback redirect URLs should use 127.0.0.1 or [::1] rather than localhost, which may not resolve to a loopback interface")
+	case isLoopback(host):
+	default:
+		if u.Scheme == "http" {
+			add(RedirectIssueWarning, "uses http for a non-loopback host, which most providers reject (use https)")
+		}
+		if net.ParseIP(host) == nil {
+			if _, err := opts.withResolver(ctx, host); err != nil {
+				add(RedirectIssueError, "host %s doesn't resolve: %s", host, err)
+			}
+		}
+	}
+	return issues
+}
+
+// redirectAllowed reports whether the uri is one of the allowed redirect
+// URLs, using a port-agnostic match for loopback URLs.
+// See: https://tools.ietf.org/html/rfc8252#section-7.3
+func redirectAllowed(allowed []string, uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if a == uri {
+			return true
+		}
+		if !isLoopback(u.Hostname()) {
+			continue
+		}
+		au, err := url.Parse(a)
+		if err != nil {
+			continue
+		}
+		au.Host, u.Host = au.Hostname(), u.Hostname()
+		if au.String() == u.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectCheckOptions is the set of available options for
+// Config.CheckRedirectURLs
+type redirectCheckOptions struct {
+	withResolver func(ctx context.Context, host string) ([]string, error)
+}
+
+// redirectCheckDefaults is a handy way to get the defaults at runtime and
+// during unit tests.
+func redirectCheckDefaults() redirectCheckOptions {
+	return redirectCheckOptions{withResolver: net.DefaultResolver.LookupHost}
+}
+
+// getRedirectCheckOpts gets the Config.CheckRedirectURLs defaults and applies
+// the opt overrides passed in
+func getRedirectCheckOpts(opt ...Option) redirectCheckOptions {
+	opts := redirectCheckDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithRedirectURLResolver provides an optional func for resolving the hosts
+// of redirect URLs, which returns an error when a host doesn't resolve.  The
+// default is net.DefaultResolver.LookupHost.
+//
+// Valid for: Config.CheckRedirectURLs
+func WithRedirectURLResolver(fn func(ctx context.Context, host string) ([]string, error)) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*redirectCheckOptions); ok && fn != nil {
+			o.withResolver = fn
+		}
+	}
+}
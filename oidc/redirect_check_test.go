@@ -0,0 +1,126 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_CheckRedirectURLs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	resolver := WithRedirectURLResolver(func(_ context.Context, host string) ([]string, error) {
+		if host == "unresolvable.example.com" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"192.0.2.1"}, nil
+	})
+
+	tests := []struct {
+		name         string
+		allowed      []string
+		redirectURLs []string
+		want         []RedirectURLIssue
+	}{
+		{
+			name:         "valid",
+			allowed:      []string{"https://app.example.com/callback", "http://127.0.0.1/callback", "com.example.app:/callback", "https://192.0.2.1/callback"},
+			redirectURLs: []string{"https://app.example.com/callback", "http://127.0.0.1:49152/callback", "http://[::1]/callback/"},
+			want: []RedirectURLIssue{
+				{URL: "http://[::1]/callback/", Severity: RedirectIssueError, Message: "isn't one of the AllowedRedirectURLs, so it will be rejected"},
+			},
+		},
+		{
+			name:    "no-allowed-urls",
+			allowed: nil,
+			redirectURLs: []string{
+				"https://app.example.com/callback",
+			},
+		},
+		{
+			name:    "fragment",
+			allowed: []string{"https://app.example.com/callback#done"},
+			want: []RedirectURLIssue{
+				{URL: "https://app.example.com/callback#done", Severity: RedirectIssueError, Message: "must not have a fragment"},
+			},
+		},
+		{
+			name:    "relative",
+			allowed: []string{"/callback"},
+			want: []RedirectURLIssue{
+				{URL: "/callback", Severity: RedirectIssueError, Message: "must be an absolute URL"},
+			},
+		},
+		{
+			name:    "invalid",
+			allowed: []string{"https://app.example.com:port/callback"},
+			want: []RedirectURLIssue{
+				{URL: "https://app.example.com:port/callback", Severity: RedirectIssueError, Message: `is an invalid URL: parse "https://app.example.com:port/callback": invalid port ":port" after host`},
+			},
+		},
+		{
+			name:    "whitespace",
+			allowed: []string{"https://app.example.com/callback "},
+			want: []RedirectURLIssue{
+				{URL: "https://app.example.com/callback ", Severity: RedirectIssueError, Message: "has leading or trailing whitespace"},
+			},
+		},
+		{
+			name:    "http-non-loopback",
+			allowed: []string{"http://app.example.com/callback"},
+			want: []RedirectURLIssue{
+				{URL: "http://app.example.com/callback", Severity: RedirectIssueWarning, Message: "uses http for a non-loopback host, which most providers reject (use https)"},
+			},
+		},
+		{
+			name:    "localhost",
+			allowed: []string{"http://localhost:8080/callback"},
+			want: []RedirectURLIssue{
+				{URL: "http://localhost:8080/callback", Severity: RedirectIssueWarning, Message: "loopback redirect URLs should use 127.0.0.1 or [::1] rather than localhost, which may not resolve to a loopback interface"},
+			},
+		},
+		{
+			name:    "private-use-scheme",
+			allowed: []string{"myapp:/callback"},
+			want: []RedirectURLIssue{
+				{URL: "myapp:/callback", Severity: RedirectIssueWarning, Message: `private-use URI scheme "myapp" should be a reverse domain name (for example: com.example.app)`},
+			},
+		},
+		{
+			name:    "unresolvable",
+			allowed: []string{"https://unresolvable.example.com/callback"},
+			want: []RedirectURLIssue{
+				{URL: "https://unresolvable.example.com/callback", Severity: RedirectIssueError, Message: "host unresolvable.example.com doesn't resolve: no such host"},
+			},
+		},
+		{
+			name:         "trailing-slash",
+			allowed:      []string{"https://app.example.com/callback/"},
+			redirectURLs: []string{"https://app.example.com/callback"},
+			want: []RedirectURLIssue{
+				{URL: "https://app.example.com/callback", Severity: RedirectIssueError, Message: `only differs from the allowed redirect URL "https://app.example.com/callback/" by a trailing slash, which must match exactly`},
+			},
+		},
+		{
+			name:         "not-allowed",
+			allowed:      []string{"https://app.example.com/callback"},
+			redirectURLs: []string{"https://other.example.com/callback"},
+			want: []RedirectURLIssue{
+				{URL: "https://other.example.com/callback", Severity: RedirectIssueError, Message: "isn't one of the AllowedRedirectURLs, so it will be rejected"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{AllowedRedirectURLs: tt.allowed}
+			assert.Equal(t, tt.want, c.CheckRedirectURLs(ctx, tt.redirectURLs, resolver))
+		})
+	}
+	t.Run("string", func(t *testing.T) {
+		i := RedirectURLIssue{URL: "http://app.example.com", Severity: RedirectIssueWarning, Message: "uses http"}
+		assert.Equal(t, `warning: redirect URL "http://app.example.com": uses http`, i.String())
+	})
+}
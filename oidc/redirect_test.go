@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_NewRequest(t *testing.T) {
+	t.Parallel()
+	tp := StartTestProvider(t)
+	p := testNewProvider(t, "test-client-id", "test-client-secret", "https://app.example.com/callback", tp)
+	defer p.Done()
+	c := p.currentConfig().copy()
+	c.AllowedRedirectURLs = []string{"https://app.example.com/callback", "https://app.example.org/callback"}
+	require.NoError(t, p.UpdateConfig(c))
+
+	tests := []struct {
+		name        string
+		redirectURL string
+		want        string
+		wantErr     bool
+		wantIsErr   error
+	}{
+		{name: "valid", redirectURL: "https://app.example.org/callback", want: "https://app.example.org/callback"},
+		{name: "default", want: "https://app.example.com/callback"},
+		{name: "unauthorized", redirectURL: "https://evil.example.com/callback", wantErr: true, wantIsErr: ErrUnauthorizedRedirectURI},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := p.NewRequest(time.Minute, tt.redirectURL)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got.RedirectURL())
+			assert.Equal(tp.Addr(), got.ProviderIssuer())
+		})
+	}
+}
+
+func TestProvider_RedirectURLForHost(t *testing.T) {
+	t.Parallel()
+	tp := StartTestProvider(t)
+	p := testNewProvider(t, "test-client-id", "test-client-secret", "https://app.example.com/callback", tp)
+	defer p.Done()
+	c := p.currentConfig().copy()
+	c.AllowedRedirectURLs = []string{"https://app.example.com/callback", "https://app.example.org:8443/callback", "http://127.0.0.1:8080/callback"}
+	require.NoError(t, p.UpdateConfig(c))
+
+	tests := []struct {
+		name      string
+		host      string
+		want      string
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "valid", host: "app.example.com", want: "https://app.example.com/callback"},
+		{name: "valid-case-and-port", host: "APP.example.org:8443", want: "https://app.example.org:8443/callback"},
+		{name: "valid-loopback", host: "127.0.0.1:9999", want: "http://127.0.0.1:8080/callback"},
+		{name: "missing-port", host: "app.example.org", wantErr: true, wantIsErr: ErrUnauthorizedRedirectURI},
+		{name: "unknown-host", host: "evil.example.com", wantErr: true, wantIsErr: ErrUnauthorizedRedirectURI},
+		{name: "empty-host", wantErr: true, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := p.RedirectURLForHost(tt.host)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.want, got)
+		})
+	}
+}
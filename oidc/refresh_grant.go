@@ -0,0 +1,35 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/oauth2"
+)
+
+// RefreshTokenGrant will request a new Token from the provider's token
+// endpoint using a refresh_token which was persisted without the rest of its
+// Token, and the id_token issued with it.  The id_token is required, since a
+// Token always has one: it's retained when the provider doesn't issue a new
+// id_token, and otherwise the new id_token is verified like it is by
+// Provider.RefreshToken.
+//
+// Unlike Provider.Exchange, a refresh isn't a response to an authentication
+// request, so it doesn't have a state to verify (see RFC 6749 section 6).
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#RefreshTokens
+func (p *Provider) RefreshTokenGrant(ctx context.Context, idToken IDToken, refreshToken RefreshToken) (*Tk, error) {
+	const op = "Provider.RefreshTokenGrant"
+	if refreshToken == "" {
+		return nil, fmt.Errorf("%s: refresh_token is empty: %w", op, ErrInvalidParameter)
+	}
+	t, err := NewToken(idToken, &oauth2.Token{RefreshToken: string(refreshToken)})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	refreshed, err := p.RefreshToken(ctx, t)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return refreshed, nil
+}
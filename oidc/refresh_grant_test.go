@@ -0,0 +1,52 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_RefreshTokenGrant(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedRefreshToken("test-refresh-token")
+	p := testNewProvider(t, "test-client-id", "test-client-secret", redirect, tp)
+	priorIDToken := IDToken(tp.issueSignedJWT())
+
+	tests := []struct {
+		name         string
+		idToken      IDToken
+		refreshToken RefreshToken
+		wantIsErr    error
+		wantErrStr   string
+	}{
+		{name: "valid", idToken: priorIDToken, refreshToken: "test-refresh-token"},
+		{name: "missing-refresh-token", idToken: priorIDToken, wantIsErr: ErrInvalidParameter},
+		{name: "missing-id-token", refreshToken: "test-refresh-token", wantIsErr: ErrInvalidParameter},
+		{name: "rejected", idToken: priorIDToken, refreshToken: "bad", wantErrStr: "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := p.RefreshTokenGrant(ctx, tt.idToken, tt.refreshToken)
+			if tt.wantIsErr != nil || tt.wantErrStr != "" {
+				require.Error(err)
+				if tt.wantIsErr != nil {
+					assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				}
+				assert.Contains(err.Error(), tt.wantErrStr)
+				return
+			}
+			require.NoError(err)
+			assert.NotEmpty(got.AccessToken())
+			assert.NotEmpty(got.IDToken())
+			assert.Equal(RefreshToken("test-refresh-token"), got.RefreshToken())
+		})
+	}
+}
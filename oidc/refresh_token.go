@@ -1,6 +1,9 @@
 package oidc
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 // RefreshToken is an oauth refresh_token.
 // See https://tools.ietf.org/html/rfc6749#section-1.5.
@@ -18,3 +21,56 @@ func (t RefreshToken) String() string {
 func (t RefreshToken) MarshalJSON() ([]byte, error) {
 	return json.Marshal(RedactedRefreshToken)
 }
+
+// RefreshTokenRejectedError is returned by Provider.RefreshToken when the
+// provider rejects the refresh_token with an invalid_grant error.  The
+// provider's response doesn't say why, and the refresh_token may have expired,
+// been revoked, been issued to another client or (for a provider which rotates
+// refresh tokens) already been used.  In every case the refresh_token can't be
+// used again, so the app should discard it and have the user log in again.
+//
+// It wraps the provider's OAuthError, and errors.Is(err,
+// ErrRefreshTokenRejected) reports true for it.
+type RefreshTokenRejectedError struct {
+	// OAuthError is the provider's invalid_grant response.
+	OAuthError *OAuthError
+}
+
+// Error satisfies the error interface.
+func (e *RefreshTokenRejectedError) Error() string {
+	return fmt.Sprintf("%s: refresh_token was rejected (it may have expired, been revoked or been reused): %s", ErrRefreshTokenRejected, e.OAuthError)
+}
+
+// Unwrap returns the provider's OAuthError.
+func (e *RefreshTokenRejectedError) Unwrap() error { return e.OAuthError }
+
+// Is reports whether the target is ErrRefreshTokenRejected.
+func (e *RefreshTokenRejectedError) Is(target error) bool { return target == ErrRefreshTokenRejected }
+
+// RefreshTokenReusedError is returned when a rejected refresh_token (see
+// RefreshTokenRejectedError) is known to have already been rotated, which
+// confirms it was reused.  A provider which rotates refresh tokens typically
+// revokes every token issued for a reused refresh_token, since the reuse
+// indicates it may have been stolen, so the app should discard all of its
+// tokens and force the user to log in again.  Provider.RefreshToken can't know
+// whether a refresh_token was rotated, so it's only returned by callers which
+// track rotated refresh tokens (see clientauth.Client.Refresh).
+//
+// It wraps the RefreshTokenRejectedError, and errors.Is(err,
+// ErrRefreshTokenReused) and errors.Is(err, ErrRefreshTokenRejected) both
+// report true for it.
+type RefreshTokenReusedError struct {
+	// Rejected is the provider's rejection of the reused refresh_token.
+	Rejected *RefreshTokenRejectedError
+}
+
+// Error satisfies the error interface.
+func (e *RefreshTokenReusedError) Error() string {
+	return fmt.Sprintf("%s: refresh_token was already rotated: %s", ErrRefreshTokenReused, e.Rejected)
+}
+
+// Unwrap returns the provider's rejection.
+func (e *RefreshTokenReusedError) Unwrap() error { return e.Rejected }
+
+// Is reports whether the target is ErrRefreshTokenReused.
+func (e *RefreshTokenReusedError) Is(target error) bool { return target == ErrRefreshTokenReused }
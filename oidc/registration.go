@@ -0,0 +1,378 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/coreos/go-oidc"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// ClientMetadata is the metadata of a client registered with a provider's
+// registration_endpoint.  Only the commonly used parameters have fields, and
+// any others (including a provider's extensions) can be provided using Extra.
+// See: https://tools.ietf.org/html/rfc7591#section-2 and
+// https://openid.net/specs/openid-connect-registration-1_0.html#ClientMetadata
+type ClientMetadata struct {
+	// RedirectURIs are the client's redirect URLs.
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+
+	// TokenEndpointAuthMethod is the client's authentication method for the
+	// token endpoint (like "client_secret_basic" or "private_key_jwt").
+	TokenEndpointAuthMethod string `json:"token_endpoint_auth_method,omitempty"`
+
+	// GrantTypes are the grant types the client may use (like
+	// "authorization_code" and "refresh_token").
+	GrantTypes []string `json:"grant_types,omitempty"`
+
+	// ResponseTypes are the response types the client may use (like "code").
+	ResponseTypes []string `json:"response_types,omitempty"`
+
+	// ClientName is the client's human-readable name.
+	ClientName string `json:"client_name,omitempty"`
+
+	// ClientURI is the URL of the client's home page.
+	ClientURI string `json:"client_uri,omitempty"`
+
+	// LogoURI is the URL of the client's logo.
+	LogoURI string `json:"logo_uri,omitempty"`
+
+	// Scope is the space separated list of scopes the client may request.
+	Scope string `json:"scope,omitempty"`
+
+	// Contacts are the email addresses of the people responsible for the
+	// client.
+	Contacts []string `json:"contacts,omitempty"`
+
+	// JWKSURI is the URL of the client's JSON Web Key Set.
+	JWKSURI string `json:"jwks_uri,omitempty"`
+
+	// JWKS is the client's JSON Web Key Set, which must not be provided along
+	// with the JWKSURI.
+	JWKS *jose.JSONWebKeySet `json:"jwks,omitempty"`
+
+	// IDTokenSignedResponseAlg is the alg the provider must sign the client's
+	// id_tokens with.
+	IDTokenSignedResponseAlg Alg `json:"id_token_signed_response_alg,omitempty"`
+
+	// PostLogoutRedirectURIs are the client's post logout redirect URLs.
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+
+	// Extra are additional metadata parameters, which override the fields
+	// above when they have the same name.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// ClientInformation is a registered client's information, which is returned
+// when a client is registered, read or updated.  The RegistrationAccessToken
+// and RegistrationClientURI are required to read, update or delete the client,
+// so they (and the ClientSecret) must be stored securely.  See:
+// https://tools.ietf.org/html/rfc7591#section-3.2.1 and
+// https://tools.ietf.org/html/rfc7592#section-3
+type ClientInformation struct {
+	ClientMetadata
+
+	// ClientID is the client's client_id.
+	ClientID string `json:"client_id"`
+
+	// ClientSecret is the client's optional client_secret.
+	ClientSecret ClientSecret `json:"client_secret,omitempty"`
+
+	// ClientIDIssuedAt is the optional time (seconds since the epoch) the
+	// client_id was issued.
+	ClientIDIssuedAt int64 `json:"client_id_issued_at,omitempty"`
+
+	// ClientSecretExpiresAt is the time (seconds since the epoch) the
+	// client_secret expires, which is zero when it doesn't expire.
+	ClientSecretExpiresAt int64 `json:"client_secret_expires_at,omitempty"`
+
+	// RegistrationAccessToken is the access token used to read, update or
+	// delete the client.
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+
+	// RegistrationClientURI is the URL used to read, update or delete the
+	// client.
+	RegistrationClientURI string `json:"registration_client_uri,omitempty"`
+
+	// Body is the provider's raw JSON response, which includes any metadata
+	// which doesn't have a field.
+	Body []byte `json:"-"`
+}
+
+// RegistrationClient registers clients with a provider's
+// registration_endpoint, and reads, updates and deletes the registered
+// clients, so products can provision their own clients with providers that
+// allow it.  See: https://tools.ietf.org/html/rfc7591 and
+// https://tools.ietf.org/html/rfc7592
+type RegistrationClient struct {
+	endpoint           string
+	initialAccessToken string
+	client             *http.Client
+}
+
+// NewRegistrationClient creates a RegistrationClient for the issuer, whose
+// registration_endpoint is discovered using its discovery document.  An error
+// wrapping ErrRegistrationFailed is returned when the issuer doesn't have a
+// registration_endpoint.
+//
+// Supported options: WithProviderCA, WithInitialAccessToken
+func NewRegistrationClient(ctx context.Context, issuer string, opt ...Option) (*RegistrationClient, error) {
+	const op = "NewRegistrationClient"
+	if issuer == "" {
+		return nil, fmt.Errorf("%s: issuer is empty: %w", op, ErrInvalidParameter)
+	}
+	opts := getRegistrationOpts(opt...)
+	tr, err := newPooledTransport(opts.withProviderCA)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	client := &http.Client{Transport: tr}
+	discoveryCtx := oidc.ClientContext(ctx, limitedClient(client, discoveryEndpoint, DefaultMaxResponseSize))
+	provider, err := oidc.NewProvider(discoveryCtx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to discover issuer: %w", op, convertError(err))
+	}
+	var m providerMetadata
+	if err := provider.Claims(&m); err != nil {
+		return nil, fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+	}
+	if m.RegistrationEndpoint == "" {
+		return nil, fmt.Errorf("%s: issuer doesn't have a registration_endpoint: %w", op, ErrRegistrationFailed)
+	}
+	return &RegistrationClient{
+		endpoint:           m.RegistrationEndpoint,
+		initialAccessToken: opts.withInitialAccessToken,
+		client:             limitedClient(client, registrationEndpoint, DefaultMaxResponseSize),
+	}, nil
+}
+
+// Endpoint returns the provider's registration_endpoint.
+func (c *RegistrationClient) Endpoint() string {
+	return c.endpoint
+}
+
+// Register a client with the metadata, and return its information.  See:
+// https://tools.ietf.org/html/rfc7591#section-3.1
+func (c *RegistrationClient) Register(ctx context.Context, m *ClientMetadata) (*ClientInformation, error) {
+	const op = "RegistrationClient.Register"
+	if m == nil {
+		return nil, fmt.Errorf("%s: metadata is nil: %w", op, ErrNilParameter)
+	}
+	params, err := m.params()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	body, err := c.do(ctx, http.MethodPost, c.endpoint, c.initialAccessToken, params, http.StatusCreated)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	info, err := parseClientInformation(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return info, nil
+}
+
+// Read the registered client's current information.  See:
+// https://tools.ietf.org/html/rfc7592#section-2.1
+func (c *RegistrationClient) Read(ctx context.Context, info *ClientInformation) (*ClientInformation, error) {
+	const op = "RegistrationClient.Read"
+	if err := info.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	body, err := c.do(ctx, http.MethodGet, info.RegistrationClientURI, info.RegistrationAccessToken, nil, http.StatusOK)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	current, err := parseClientInformation(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	current.keepRegistration(info)
+	return current, nil
+}
+
+// Update the registered client's metadata with info's ClientMetadata, and
+// return its updated information.  The update replaces all of the client's
+// metadata, so omitted metadata may be reset to the provider's defaults.  See:
+// https://tools.ietf.org/html/rfc7592#section-2.2
+func (c *RegistrationClient) Update(ctx context.Context, info *ClientInformation) (*ClientInformation, error) {
+	const op = "RegistrationClient.Update"
+	if err := info.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	params, err := info.ClientMetadata.params()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	params["client_id"] = info.ClientID
+	if info.ClientSecret != "" {
+		params["client_secret"] = string(info.ClientSecret)
+	}
+	body, err := c.do(ctx, http.MethodPut, info.RegistrationClientURI, info.RegistrationAccessToken, params, http.StatusOK)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	updated, err := parseClientInformation(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	updated.keepRegistration(info)
+	return updated, nil
+}
+
+// Delete the registered client.  See:
+// https://tools.ietf.org/html/rfc7592#section-2.3
+func (c *RegistrationClient) Delete(ctx context.Context, info *ClientInformation) error {
+	const op = "RegistrationClient.Delete"
+	if err := info.validate(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := c.do(ctx, http.MethodDelete, info.RegistrationClientURI, info.RegistrationAccessToken, nil, http.StatusNoContent); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// do sends the request with the optional JSON params, authenticated with the
+// optional bearer token, and returns the response body.  An error (which is an
+// *OAuthError) is returned when the response's status isn't the wantStatus.
+func (c *RegistrationClient) do(ctx context.Context, method, u, token string, params map[string]interface{}, wantStatus int) ([]byte, error) {
+	const op = "RegistrationClient.do"
+	var reqBody []byte
+	if params != nil {
+		var err error
+		if reqBody, err = json.Marshal(params); err != nil {
+			return nil, fmt.Errorf("%s: unable to encode metadata: %s: %w", op, err, ErrInvalidParameter)
+		}
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create request: %s: %w", op, err, ErrRegistrationFailed)
+	}
+	req.Header.Set("Accept", "application/json")
+	if params != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, err, ErrRegistrationFailed)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to read response body: %s: %w", op, err, ErrRegistrationFailed)
+	}
+	if resp.StatusCode != wantStatus {
+		oauthErr := parseOAuthErrorBody(body)
+		oauthErr.StatusCode = resp.StatusCode
+		oauthErr.err = fmt.Errorf("%s: %s %s: %w", op, resp.Status, body, ErrRegistrationFailed)
+		return nil, oauthErr
+	}
+	return body, nil
+}
+
+// parseClientInformation parses the client information response.
+func parseClientInformation(body []byte) (*ClientInformation, error) {
+	const op = "parseClientInformation"
+	var info ClientInformation
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse response: %s: %w", op, err, ErrRegistrationFailed)
+	}
+	if info.ClientID == "" {
+		return nil, fmt.Errorf("%s: response is missing the client_id: %w", op, ErrRegistrationFailed)
+	}
+	info.Body = body
+	return &info, nil
+}
+
+// params returns the metadata's parameters, including its Extra parameters.
+func (m *ClientMetadata) params() (map[string]interface{}, error) {
+	const op = "ClientMetadata.params"
+	if m.JWKSURI != "" && m.JWKS != nil {
+		return nil, fmt.Errorf("%s: jwks_uri and jwks must not both be provided: %w", op, ErrInvalidParameter)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to encode metadata: %s: %w", op, err, ErrInvalidParameter)
+	}
+	params := map[string]interface{}{}
+	if err := json.Unmarshal(b, &params); err != nil {
+		return nil, fmt.Errorf("%s: unable to decode metadata: %s: %w", op, err, ErrInvalidParameter)
+	}
+	for k, v := range m.Extra {
+		params[k] = v
+	}
+	return params, nil
+}
+
+// validate checks the client information has what's needed to read, update or
+// delete the client.
+func (i *ClientInformation) validate() error {
+	const op = "ClientInformation.validate"
+	switch {
+	case i == nil:
+		return fmt.Errorf("%s: client information is nil: %w", op, ErrNilParameter)
+	case i.ClientID == "":
+		return fmt.Errorf("%s: client_id is empty: %w", op, ErrInvalidParameter)
+	case i.RegistrationClientURI == "":
+		return fmt.Errorf("%s: registration_client_uri is empty: %w", op, ErrInvalidParameter)
+	case i.RegistrationAccessToken == "":
+		return fmt.Errorf("%s: registration_access_token is empty: %w", op, ErrInvalidParameter)
+	}
+	return nil
+}
+
+// keepRegistration keeps the previous registration_access_token and
+// registration_client_uri when a provider's response omits them, since they
+// may only be returned when they change.  See:
+// https://tools.ietf.org/html/rfc7592#section-3
+func (i *ClientInformation) keepRegistration(prev *ClientInformation) {
+	if i.RegistrationAccessToken == "" {
+		i.RegistrationAccessToken = prev.RegistrationAccessToken
+	}
+	if i.RegistrationClientURI == "" {
+		i.RegistrationClientURI = prev.RegistrationClientURI
+	}
+}
+
+// registrationOptions is the set of available options for
+// NewRegistrationClient
+type registrationOptions struct {
+	withProviderCA         string
+	withInitialAccessToken string
+}
+
+// registrationDefaults is a handy way to get the defaults at runtime and
+// during unit tests.
+func registrationDefaults() registrationOptions {
+	return registrationOptions{}
+}
+
+// getRegistrationOpts gets the NewRegistrationClient defaults and applies the
+// opt overrides passed in
+func getRegistrationOpts(opt ...Option) registrationOptions {
+	opts := registrationDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithInitialAccessToken provides an optional initial access token, which
+// providers may require to register a client.  See:
+// https://tools.ietf.org/html/rfc7591#section-3
+//
+// Valid for: NewRegistrationClient
+func WithInitialAccessToken(token string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*registrationOptions); ok {
+			o.withInitialAccessToken = token
+		}
+	}
+}
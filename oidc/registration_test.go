@@ -0,0 +1,208 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// testRegistrationServer is a minimal registration_endpoint, which stores the
+// registered clients in memory.
+type testRegistrationServer struct {
+	*httptest.Server
+	initialAccessToken string
+
+	mu      sync.Mutex
+	clients map[string]map[string]interface{}
+}
+
+func newTestRegistrationServer(t *testing.T, initialAccessToken string, withEndpoint bool) *testRegistrationServer {
+	t.Helper()
+	s := &testRegistrationServer{
+		initialAccessToken: initialAccessToken,
+		clients:            map[string]map[string]interface{}{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve(withEndpoint)))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testRegistrationServer) serve(withEndpoint bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		writeErr := func(status int, code string) {
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": code + " description"})
+		}
+		switch {
+		case req.URL.Path == "/.well-known/openid-configuration":
+			doc := map[string]interface{}{
+				"issuer":   s.URL,
+				"jwks_uri": s.URL + "/jwks",
+			}
+			if withEndpoint {
+				doc["registration_endpoint"] = s.URL + "/register"
+			}
+			_ = json.NewEncoder(w).Encode(doc)
+		case req.URL.Path == "/register" && req.Method == http.MethodPost:
+			if s.initialAccessToken != "" && req.Header.Get("Authorization") != "Bearer "+s.initialAccessToken {
+				writeErr(http.StatusUnauthorized, "invalid_token")
+				return
+			}
+			var m map[string]interface{}
+			if err := json.NewDecoder(req.Body).Decode(&m); err != nil {
+				writeErr(http.StatusBadRequest, "invalid_client_metadata")
+				return
+			}
+			if _, ok := m["redirect_uris"]; !ok {
+				writeErr(http.StatusBadRequest, "invalid_redirect_uri")
+				return
+			}
+			id := "client-" + string(rune('a'+len(s.clients)))
+			m["client_id"] = id
+			m["client_secret"] = "secret-" + id
+			m["client_secret_expires_at"] = 0
+			m["registration_access_token"] = "rat-" + id
+			m["registration_client_uri"] = s.URL + "/register/" + id
+			s.clients[id] = m
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(m)
+		case strings.HasPrefix(req.URL.Path, "/register/"):
+			id := strings.TrimPrefix(req.URL.Path, "/register/")
+			m, ok := s.clients[id]
+			if !ok || req.Header.Get("Authorization") != "Bearer rat-"+id {
+				writeErr(http.StatusUnauthorized, "invalid_token")
+				return
+			}
+			switch req.Method {
+			case http.MethodGet:
+				_ = json.NewEncoder(w).Encode(m)
+			case http.MethodPut:
+				var updated map[string]interface{}
+				if err := json.NewDecoder(req.Body).Decode(&updated); err != nil || updated["client_id"] != id {
+					writeErr(http.StatusBadRequest, "invalid_client_metadata")
+					return
+				}
+				if _, ok := updated["registration_access_token"]; ok {
+					writeErr(http.StatusBadRequest, "invalid_client_metadata")
+					return
+				}
+				updated["client_secret"] = m["client_secret"]
+				s.clients[id] = updated
+				// the registration_access_token and registration_client_uri
+				// are omitted, since they didn't change.
+				_ = json.NewEncoder(w).Encode(updated)
+			case http.MethodDelete:
+				delete(s.clients, id)
+				w.WriteHeader(http.StatusNoContent)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func TestRegistrationClient(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("lifecycle", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		srv := newTestRegistrationServer(t, "initial-token", true)
+		c, err := NewRegistrationClient(ctx, srv.URL, WithInitialAccessToken("initial-token"))
+		require.NoError(err)
+		assert.Equal(srv.URL+"/register", c.Endpoint())
+
+		info, err := c.Register(ctx, &ClientMetadata{
+			RedirectURIs:             []string{"https://example.com/callback"},
+			TokenEndpointAuthMethod:  "client_secret_basic",
+			ClientName:               "test-client",
+			IDTokenSignedResponseAlg: RS256,
+			Extra:                    map[string]interface{}{"software_id": "cap"},
+		})
+		require.NoError(err)
+		assert.Equal("client-a", info.ClientID)
+		assert.Equal(ClientSecret("secret-client-a"), info.ClientSecret)
+		assert.Equal("rat-client-a", info.RegistrationAccessToken)
+		assert.Equal(srv.URL+"/register/client-a", info.RegistrationClientURI)
+		assert.Equal([]string{"https://example.com/callback"}, info.RedirectURIs)
+		assert.Equal(RS256, info.IDTokenSignedResponseAlg)
+		assert.Contains(string(info.Body), `"software_id":"cap"`)
+
+		read, err := c.Read(ctx, info)
+		require.NoError(err)
+		assert.Equal(info.ClientID, read.ClientID)
+		assert.Equal("test-client", read.ClientName)
+
+		info.ClientName = "updated-client"
+		updated, err := c.Update(ctx, info)
+		require.NoError(err)
+		assert.Equal("updated-client", updated.ClientName)
+		assert.Equal(info.RegistrationAccessToken, updated.RegistrationAccessToken)
+		assert.Equal(info.RegistrationClientURI, updated.RegistrationClientURI)
+
+		require.NoError(c.Delete(ctx, updated))
+		_, err = c.Read(ctx, updated)
+		require.Truef(errors.Is(err, ErrRegistrationFailed), "wanted \"%s\" but got \"%s\"", ErrRegistrationFailed, err)
+		var oauthErr *OAuthError
+		require.True(errors.As(err, &oauthErr))
+		assert.Equal(http.StatusUnauthorized, oauthErr.StatusCode)
+		assert.Equal("invalid_token", oauthErr.Code)
+	})
+	t.Run("invalid-metadata", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		srv := newTestRegistrationServer(t, "", true)
+		c, err := NewRegistrationClient(ctx, srv.URL)
+		require.NoError(err)
+		_, err = c.Register(ctx, &ClientMetadata{ClientName: "test-client"})
+		var oauthErr *OAuthError
+		require.True(errors.As(err, &oauthErr))
+		assert.Equal("invalid_redirect_uri", oauthErr.Code)
+
+		_, err = c.Register(ctx, &ClientMetadata{JWKSURI: "https://example.com/jwks", JWKS: &jose.JSONWebKeySet{}})
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+
+		_, err = c.Register(ctx, nil)
+		assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+	t.Run("missing-initial-access-token", func(t *testing.T) {
+		require := require.New(t)
+		srv := newTestRegistrationServer(t, "initial-token", true)
+		c, err := NewRegistrationClient(ctx, srv.URL)
+		require.NoError(err)
+		_, err = c.Register(ctx, &ClientMetadata{RedirectURIs: []string{"https://example.com/callback"}})
+		require.Truef(errors.Is(err, ErrRegistrationFailed), "wanted \"%s\" but got \"%s\"", ErrRegistrationFailed, err)
+	})
+	t.Run("invalid-client-information", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		srv := newTestRegistrationServer(t, "", true)
+		c, err := NewRegistrationClient(ctx, srv.URL)
+		require.NoError(err)
+		_, err = c.Read(ctx, nil)
+		assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+		_, err = c.Update(ctx, &ClientInformation{ClientID: "client-a"})
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+		err = c.Delete(ctx, &ClientInformation{ClientID: "client-a", RegistrationClientURI: srv.URL + "/register/client-a"})
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("no-registration-endpoint", func(t *testing.T) {
+		srv := newTestRegistrationServer(t, "", false)
+		_, err := NewRegistrationClient(ctx, srv.URL)
+		assert.Truef(t, errors.Is(err, ErrRegistrationFailed), "wanted \"%s\" but got \"%s\"", ErrRegistrationFailed, err)
+	})
+	t.Run("empty-issuer", func(t *testing.T) {
+		_, err := NewRegistrationClient(ctx, "")
+		assert.Truef(t, errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
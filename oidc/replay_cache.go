@@ -0,0 +1,143 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ReplayCache defines an interface for detecting replayed single-use IDs (like
+// the jti of a logout token or a DPoP proof), which is shared by every
+// instance of an app so a value used with one instance can't be replayed to
+// another.  There's no leader: every instance adds the IDs it sees to the
+// cache, and the cache decides which add was first.
+//
+// Implementations must be concurrently safe, and:
+//
+//   - Add must be an atomic check-and-set of the ID (for example: Redis SET NX
+//     or memcached add), so exactly one of any concurrent adds of the same ID
+//     succeeds, even when they're made by different instances.
+//
+//   - an ID must be remembered until its expiration, after which the value it
+//     identifies is rejected as expired, so it can't be replayed.  It may be
+//     forgotten after its expiration.
+//
+//   - Add must return an error (and not succeed) when the cache is
+//     unavailable, so replays are never accepted because of an outage.
+//
+// A replicated cache whose replicas may accept the same ID before they're
+// consistent (like an asynchronously replicated Redis failover) can accept a
+// replay during that window, so a cache should use a single primary for each
+// ID.
+type ReplayCache interface {
+	// Add the ID, which expires at expiresAt.  If the ID was already added
+	// and hasn't expired, then an error wrapping ErrReplayDetected is
+	// returned.  IDs which have already expired don't need to be added.
+	Add(ctx context.Context, id string, expiresAt time.Time) error
+}
+
+// MemoryReplayCache implements the ReplayCache interface using an in-memory
+// map, which is the default for apps with a single instance.  Expired IDs are
+// removed by DeleteExpired.  It is concurrently safe.
+type MemoryReplayCache struct {
+	mu      sync.Mutex
+	ids     map[string]time.Time
+	nowFunc func() time.Time
+}
+
+// ensure that MemoryReplayCache implements the ReplayCache interface.
+var _ ReplayCache = (*MemoryReplayCache)(nil)
+
+// NewMemoryReplayCache creates a new MemoryReplayCache.
+//
+// Supported options: WithNow
+func NewMemoryReplayCache(opt ...Option) *MemoryReplayCache {
+	opts := getReplayCacheOpts(opt...)
+	return &MemoryReplayCache{
+		ids:     map[string]time.Time{},
+		nowFunc: opts.withNowFunc,
+	}
+}
+
+// Add implements the ReplayCache.Add() interface function.
+func (c *MemoryReplayCache) Add(_ context.Context, id string, expiresAt time.Time) error {
+	const op = "MemoryReplayCache.Add"
+	if id == "" {
+		return fmt.Errorf("%s: id is empty: %w", op, ErrInvalidParameter)
+	}
+	now := c.now()
+	if !expiresAt.After(now) {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if exp, ok := c.ids[id]; ok && exp.After(now) {
+		return fmt.Errorf("%s: %q was already used: %w", op, id, ErrReplayDetected)
+	}
+	c.ids[id] = expiresAt
+	return nil
+}
+
+// DeleteExpired removes the IDs which are expired at the time now, and returns
+// the number removed.
+func (c *MemoryReplayCache) DeleteExpired(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n int
+	for id, exp := range c.ids {
+		if !exp.After(now) {
+			delete(c.ids, id)
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of IDs in the cache.
+func (c *MemoryReplayCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.ids)
+}
+
+// now returns the current time using the optional nowFunc
+func (c *MemoryReplayCache) now() time.Time {
+	if c.nowFunc != nil {
+		return c.nowFunc()
+	}
+	return time.Now()
+}
+
+// replayCacheOptions is the set of available options for NewMemoryReplayCache
+type replayCacheOptions struct {
+	withNowFunc func() time.Time
+}
+
+// replayCacheDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func replayCacheDefaults() replayCacheOptions {
+	return replayCacheOptions{}
+}
+
+// getReplayCacheOpts gets the NewMemoryReplayCache defaults and applies the opt
+// overrides passed in
+func getReplayCacheOpts(opt ...Option) replayCacheOptions {
+	opts := replayCacheDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithReplayCache provides an optional ReplayCache which is used to reject
+// replayed DPoP proofs, using their jti.  A MemoryReplayCache is sufficient
+// for an app with a single instance, and an app with multiple instances
+// requires a shared cache.
+//
+// Valid for: VerifyDPoPProof and Confirmation.VerifyRequest
+func WithReplayCache(c ReplayCache) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*dpopOptions); ok {
+			o.withReplayCache = c
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryReplayCache(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	now := time.Now()
+	c := NewMemoryReplayCache(WithNow(func() time.Time { return now }))
+
+	require.NoError(c.Add(ctx, "jti-1", now.Add(time.Minute)))
+	err := c.Add(ctx, "jti-1", now.Add(time.Minute))
+	assert.Truef(errors.Is(err, ErrReplayDetected), "wanted \"%s\" but got \"%s\"", ErrReplayDetected, err)
+	require.NoError(c.Add(ctx, "jti-2", now.Add(time.Hour)))
+
+	// an expired ID isn't added
+	require.NoError(c.Add(ctx, "jti-3", now.Add(-time.Minute)))
+	assert.Equal(2, c.Len())
+
+	err = c.Add(ctx, "", now.Add(time.Minute))
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+
+	// an ID can be added again once it's expired
+	now = now.Add(2 * time.Minute)
+	require.NoError(c.Add(ctx, "jti-1", now.Add(time.Minute)))
+
+	assert.Equal(0, c.DeleteExpired(now))
+	assert.Equal(2, c.DeleteExpired(now.Add(2*time.Hour)))
+	assert.Equal(0, c.Len())
+}
+
+func TestMemoryReplayCache_Concurrent(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	c := NewMemoryReplayCache()
+	const adds = 50
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		success int
+	)
+	for i := 0; i < adds; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Add(ctx, "jti", time.Now().Add(time.Minute)); err == nil {
+				mu.Lock()
+				success++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, success)
+}
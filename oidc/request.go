@@ -2,6 +2,8 @@ package oidc
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"time"
 
 	"golang.org/x/text/language"
@@ -107,6 +109,14 @@ type Request interface {
 	// https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest
 	UILocales() []language.Tag
 
+	// ClaimsLocales optionally specifies End-User's preferred languages and
+	// scripts for claims being returned, via language Tags, ordered by
+	// preference.  See LocalizedClaim(...) for selecting a claim's localized
+	// value.
+	//
+	// https://openid.net/specs/openid-connect-core-1_0.html#ClaimsLanguagesAndScripts
+	ClaimsLocales() []language.Tag
+
 	// Claims optionally requests that specific claims be returned using
 	// the claims parameter.
 	//
@@ -117,14 +127,60 @@ type Request interface {
 	// Server is being requested to use for processing this Authentication
 	// Request, with the values appearing in order of preference.
 	//
-	// NOTE: Requested acr_values are not verified by the Provider.Exchange(...)
-	// or Provider.VerifyIDToken() functions, since the request/return values
-	// are determined by the provider's implementation. You'll need to verify
-	// the claims returned yourself based on values provided by you OIDC
-	// Provider's documentation.
+	// NOTE: Requested acr_values are not verified by default, since the
+	// request/return values are determined by the provider's implementation.
+	// Use the WithACRVerification or WithACRPolicy options with
+	// Provider.VerifyIDToken(...) to verify the acr claim returned.
 	//
 	// https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest
 	ACRValues() []string
+
+	// ResponseMode optionally specifies how the Authorization Server returns
+	// the authentication response's parameters.  When it's empty, the
+	// provider's default is used (or form_post for the implicit flow).
+	//
+	// https://openid.net/specs/oauth-v2-multiple-response-types-1_0.html#ResponseModes
+	ResponseMode() ResponseMode
+
+	// OfflineAccess optionally requests a refresh_token, which can be used to
+	// get new tokens when the End-User isn't present.  See
+	// Token.RefreshTokenGranted() to check if a refresh_token was granted.
+	//
+	// https://openid.net/specs/openid-connect-core-1_0.html#OfflineAccess
+	OfflineAccess() bool
+
+	// AuthAudience optionally specifies the audience parameter of the
+	// authentication request, which some providers (like Auth0) require to
+	// issue an access_token for an API.  It's not related to the audiences
+	// used to verify an id_token (see Audiences()).
+	AuthAudience() string
+
+	// ReturnTo optionally specifies the URL the user is returned to after a
+	// successful authentication, which is typically the page they originally
+	// requested.  It's not sent to the provider.  See
+	// callback.WithReturnToAllowList(...) for validating it in a callback.
+	ReturnTo() string
+
+	// RequiredScopes optionally specifies scopes which the provider must
+	// grant.  When any of them aren't granted, Provider.Exchange(...) returns
+	// an error wrapping ErrScopesNotGranted.  See Tk.DeniedScopes() for the
+	// requested scopes which weren't granted.
+	RequiredScopes() []string
+
+	// Fingerprint optionally specifies the fingerprint of the user agent which
+	// started the request's authentication flow.  It's not sent to the
+	// provider.  See callback.WithFingerprintVerification(...) for verifying
+	// it in a callback.
+	Fingerprint() *Fingerprint
+
+	// ProviderIssuer optionally specifies the issuer of the provider which
+	// the request's authentication flow was started with.  It's not sent to
+	// the provider.  Provider.NewRequest(...) binds its requests to the
+	// provider, and the callback package's handlers verify that a bound
+	// request is completed by the same provider, to protect against mix-up
+	// attacks when several providers share a callback.  See
+	// Provider.VerifyProviderBinding(...).
+	ProviderIssuer() string
 }
 
 // Req represents the oidc request used for oidc flows and implements the Request interface.
@@ -190,6 +246,11 @@ type Req struct {
 	// language Tags, ordered by preference.
 	withUILocales []language.Tag
 
+	// withClaimsLocales optionally specifies End-User's preferred languages
+	// and scripts for claims being returned, via language Tags, ordered by
+	// preference.
+	withClaimsLocales []language.Tag
+
 	// withClaims optionally requests that specific claims be returned
 	// using the claims parameter.
 	withClaims []byte
@@ -198,6 +259,34 @@ type Req struct {
 	// Server is being requested to use for processing this Authentication
 	// Request, with the values appearing in order of preference.
 	withACRValues []string
+
+	// withResponseMode optionally specifies how the Authorization Server
+	// returns the authentication response's parameters.
+	withResponseMode ResponseMode
+
+	// withOfflineAccess optionally requests a refresh_token, which can be used
+	// to get new tokens when the End-User isn't present.
+	withOfflineAccess bool
+
+	// withAuthAudience optionally specifies the audience parameter of the
+	// authentication request.
+	withAuthAudience string
+
+	// withReturnTo optionally specifies the URL the user is returned to after
+	// a successful authentication.
+	withReturnTo string
+
+	// withRequiredScopes optionally specifies scopes which the provider must
+	// grant.
+	withRequiredScopes []string
+
+	// withFingerprint optionally specifies the fingerprint of the user agent
+	// which started the authentication flow.
+	withFingerprint *Fingerprint
+
+	// withProviderIssuer optionally specifies the issuer of the provider which
+	// the authentication flow was started with.
+	withProviderIssuer string
 }
 
 // ensure that Request implements the Request interface.
@@ -206,6 +295,7 @@ var _ Request = (*Req)(nil)
 // NewRequest creates a new Request (*Req).
 //  Supports the options:
 //   * WithState
+//   * WithNonce
 //   * WithNow
 //   * WithAudiences
 //   * WithScopes
@@ -215,16 +305,35 @@ var _ Request = (*Req)(nil)
 //   * WithPrompts
 //   * WithDisplay
 //   * WithUILocales
+//   * WithClaimsLocales
 //   * WithClaims
+//   * WithResponseMode
+//   * WithOfflineAccess
+//   * WithAuthAudience
+//   * WithReturnTo
+//   * WithRequiredScopes
+//   * WithFingerprint
+//   * WithProviderBinding
+//   * WithRandReader
 func NewRequest(expireIn time.Duration, redirectURL string, opt ...Option) (*Req, error) {
 	const op = "oidc.NewRequest"
 	opts := getReqOpts(opt...)
 	if redirectURL == "" {
 		return nil, fmt.Errorf("%s: redirect URL is empty: %w", op, ErrInvalidParameter)
 	}
-	nonce, err := NewID(WithPrefix("n"))
-	if err != nil {
-		return nil, fmt.Errorf("%s: unable to generate a request's nonce: %w", op, err)
+	var nonce string
+	switch {
+	case opts.withNonce != "":
+		if err := validNonce(opts.withNonce); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		nonce = opts.withNonce
+	default:
+		var err error
+		nonce, err = NewID(WithPrefix("n"), WithRandReader(opts.withRandReader))
+		if err != nil {
+			return nil, fmt.Errorf("%s: unable to generate a request's nonce: %w", op, err)
+		}
 	}
 
 	var state string
@@ -233,7 +342,7 @@ func NewRequest(expireIn time.Duration, redirectURL string, opt ...Option) (*Req
 		state = opts.withState
 	default:
 		var err error
-		state, err = NewID(WithPrefix("st"))
+		state, err = NewID(WithPrefix("st"), WithRandReader(opts.withRandReader))
 		if err != nil {
 			return nil, fmt.Errorf("%s: unable to generate a request's state: %w", op, err)
 		}
@@ -245,20 +354,39 @@ func NewRequest(expireIn time.Duration, redirectURL string, opt ...Option) (*Req
 	if opts.withVerifier != nil && opts.withImplicitFlow != nil {
 		return nil, fmt.Errorf("%s: requested both implicit flow and authorization code with PKCE: %w", op, ErrInvalidParameter)
 	}
+	if opts.withResponseMode != "" {
+		if err := validResponseMode(opts.withResponseMode); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if opts.withImplicitFlow != nil && opts.withResponseMode == QueryResponseMode {
+			return nil, fmt.Errorf("%s: the query response mode can't be used with the implicit flow: %w", op, ErrInvalidParameter)
+		}
+	}
+	if opts.withOfflineAccess && opts.withImplicitFlow != nil {
+		return nil, fmt.Errorf("%s: offline access can't be used with the implicit flow: %w", op, ErrInvalidParameter)
+	}
 	r := &Req{
-		state:         state,
-		nonce:         nonce,
-		redirectURL:   redirectURL,
-		nowFunc:       opts.withNowFunc,
-		audiences:     opts.withAudiences,
-		scopes:        opts.withScopes,
-		withImplicit:  opts.withImplicitFlow,
-		withVerifier:  opts.withVerifier,
-		withPrompts:   opts.withPrompts,
-		withDisplay:   opts.withDisplay,
-		withUILocales: opts.withUILocales,
-		withClaims:    opts.withClaims,
-		withACRValues: opts.withACRValues,
+		state:              state,
+		nonce:              nonce,
+		redirectURL:        redirectURL,
+		nowFunc:            opts.withNowFunc,
+		audiences:          opts.withAudiences,
+		scopes:             opts.withScopes,
+		withImplicit:       opts.withImplicitFlow,
+		withVerifier:       opts.withVerifier,
+		withPrompts:        opts.withPrompts,
+		withDisplay:        opts.withDisplay,
+		withUILocales:      opts.withUILocales,
+		withClaimsLocales:  opts.withClaimsLocales,
+		withClaims:         opts.withClaims,
+		withACRValues:      opts.withACRValues,
+		withResponseMode:   opts.withResponseMode,
+		withOfflineAccess:  opts.withOfflineAccess,
+		withAuthAudience:   opts.withAuthAudience,
+		withReturnTo:       opts.withReturnTo,
+		withRequiredScopes: opts.withRequiredScopes,
+		withFingerprint:    opts.withFingerprint,
+		withProviderIssuer: opts.withProviderIssuer,
 	}
 	r.expiration = r.now().Add(expireIn)
 	if opts.withMaxAge != nil {
@@ -333,6 +461,17 @@ func (r *Req) UILocales() []language.Tag {
 	return cp
 }
 
+// ClaimsLocales() implements the Request.ClaimsLocales() interface function
+// and returns a copy of the ClaimsLocales
+func (r *Req) ClaimsLocales() []language.Tag {
+	if r.withClaimsLocales == nil {
+		return nil
+	}
+	cp := make([]language.Tag, len(r.withClaimsLocales))
+	copy(cp, r.withClaimsLocales)
+	return cp
+}
+
 // Claims() implements the Request.Claims() interface function
 // and returns a copy of the claims request.
 func (r *Req) Claims() []byte {
@@ -355,6 +494,29 @@ func (r *Req) ACRValues() []string {
 	return cp
 }
 
+// ResponseMode() implements the Request.ResponseMode() interface function.
+func (r *Req) ResponseMode() ResponseMode { return r.withResponseMode }
+
+// OfflineAccess() implements the Request.OfflineAccess() interface function.
+func (r *Req) OfflineAccess() bool { return r.withOfflineAccess }
+
+// AuthAudience() implements the Request.AuthAudience() interface function.
+func (r *Req) AuthAudience() string { return r.withAuthAudience }
+
+// ReturnTo implements the Request.ReturnTo() interface function.
+func (r *Req) ReturnTo() string { return r.withReturnTo }
+
+// RequiredScopes implements the Request.RequiredScopes() interface function
+// and returns a copy of the required scopes.
+func (r *Req) RequiredScopes() []string { return copyStrings(r.withRequiredScopes) }
+
+// Fingerprint implements the Request.Fingerprint() interface function and
+// returns a copy of the fingerprint.
+func (r *Req) Fingerprint() *Fingerprint { return r.withFingerprint.copy() }
+
+// ProviderIssuer implements the Request.ProviderIssuer() interface function.
+func (r *Req) ProviderIssuer() string { return r.withProviderIssuer }
+
 // MaxAge: when authAfter is not a zero value (authTime.IsZero()) then the
 // id_token's auth_time claim must be after the specified time.
 //
@@ -394,9 +556,13 @@ const RequestExpirySkew = 1 * time.Second
 
 // IsExpired returns true if the request has expired.
 func (r *Req) IsExpired() bool {
-	return r.expiration.Before(time.Now().Add(RequestExpirySkew))
+	return r.expiration.Before(r.now().Add(RequestExpirySkew))
 }
 
+// Expiration returns when the request expires, which a store can use to
+// expire its persisted requests.
+func (r *Req) Expiration() time.Time { return r.expiration }
+
 // now returns the current time using the optional timeFn
 func (r *Req) now() time.Time {
 	if r.nowFunc != nil {
@@ -416,18 +582,28 @@ type maxAge struct {
 
 // reqOptions is the set of available options for Req functions
 type reqOptions struct {
-	withNowFunc      func() time.Time
-	withScopes       []string
-	withAudiences    []string
-	withImplicitFlow *implicitFlow
-	withVerifier     CodeVerifier
-	withMaxAge       *maxAge
-	withPrompts      []Prompt
-	withDisplay      Display
-	withUILocales    []language.Tag
-	withClaims       []byte
-	withACRValues    []string
-	withState        string
+	withNowFunc        func() time.Time
+	withScopes         []string
+	withAudiences      []string
+	withImplicitFlow   *implicitFlow
+	withVerifier       CodeVerifier
+	withMaxAge         *maxAge
+	withPrompts        []Prompt
+	withDisplay        Display
+	withUILocales      []language.Tag
+	withClaimsLocales  []language.Tag
+	withClaims         []byte
+	withACRValues      []string
+	withState          string
+	withNonce          string
+	withResponseMode   ResponseMode
+	withOfflineAccess  bool
+	withAuthAudience   string
+	withReturnTo       string
+	withRequiredScopes []string
+	withFingerprint    *Fingerprint
+	withProviderIssuer string
+	withRandReader     io.Reader
 }
 
 // reqDefaults is a handy way to get the defaults at runtime and during unit
@@ -516,13 +692,19 @@ func WithMaxAge(seconds uint) Option {
 // See MaxAge() if wish to specify an allowable elapsed time in seconds since
 // the last time the End-User was actively authenticated by the OP.
 //
-// Option is valid for: Request
+// When used with a Config, the prompts are the default for the provider's
+// requests which don't have their own prompts.
+//
+// Option is valid for: Config and Request
 //
 // https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest
 func WithPrompts(prompts ...Prompt) Option {
 	return func(o interface{}) {
-		if o, ok := o.(*reqOptions); ok {
-			o.withPrompts = prompts
+		switch v := o.(type) {
+		case *reqOptions:
+			v.withPrompts = prompts
+		case *configOptions:
+			v.withPrompts = prompts
 		}
 	}
 }
@@ -530,13 +712,19 @@ func WithPrompts(prompts ...Prompt) Option {
 // WithDisplay optionally specifies how the Authorization Server displays the
 // authentication and consent user interface pages to the End-User.
 //
-// Option is valid for: Request
+// When used with a Config, the display is the default for the provider's
+// requests which don't have their own display.
+//
+// Option is valid for: Config and Request
 //
 // https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest
 func WithDisplay(d Display) Option {
 	return func(o interface{}) {
-		if o, ok := o.(*reqOptions); ok {
-			o.withDisplay = d
+		switch v := o.(type) {
+		case *reqOptions:
+			v.withDisplay = d
+		case *configOptions:
+			v.withDisplay = d
 		}
 	}
 }
@@ -555,6 +743,22 @@ func WithUILocales(locales ...language.Tag) Option {
 	}
 }
 
+// WithClaimsLocales optionally specifies End-User's preferred languages and
+// scripts for claims being returned, via language Tags, ordered by
+// preference.  See LocalizedClaim(...) for selecting a claim's localized
+// value.
+//
+// Option is valid for: Request
+//
+// https://openid.net/specs/openid-connect-core-1_0.html#ClaimsLanguagesAndScripts
+func WithClaimsLocales(locales ...language.Tag) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*reqOptions); ok {
+			o.withClaimsLocales = locales
+		}
+	}
+}
+
 // WithClaims optionally requests that specific claims be returned using
 // the claims parameter.
 //
@@ -573,11 +777,10 @@ func WithClaims(json []byte) Option {
 // Server is being requested to use for processing this Authentication
 // Request, with the values appearing in order of preference.
 //
-// NOTE: Requested acr_values are not verified by the Provider.Exchange(...)
-// or Provider.VerifyIDToken() functions, since the request/return values
-// are determined by the provider's implementation. You'll need to verify
-// the claims returned yourself based on values provided by you OIDC
-// Provider's documentation.
+// NOTE: Requested acr_values are not verified by default, since the
+// request/return values are determined by the provider's implementation.  Use
+// the WithACRVerification or WithACRPolicy options with
+// Provider.VerifyIDToken(...) to verify the acr claim returned.
 //
 // Option is valid for: Request
 //
@@ -590,6 +793,53 @@ func WithACRValues(values ...string) Option {
 	}
 }
 
+// WithAuthAudience optionally specifies the audience parameter of the
+// authentication request, which providers like Auth0 require to issue an
+// access_token for an API (identified by the audience) during the
+// authorization code flow.  It's distinct from WithAudiences, which specifies
+// the audiences used to verify the id_token's aud claim.
+//
+// Option is valid for: Request
+func WithAuthAudience(audience string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*reqOptions); ok {
+			o.withAuthAudience = audience
+		}
+	}
+}
+
+// WithReturnTo optionally specifies the URL the user is returned to after a
+// successful authentication, which is typically the page they originally
+// requested.  It's stored with the request (it's not sent to the provider), and
+// it should be validated with callback.ValidReturnTo(...) before it's used, so
+// the app can't be used as an open redirector.
+//
+// Option is valid for: Request
+func WithReturnTo(returnTo string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*reqOptions); ok {
+			o.withReturnTo = returnTo
+		}
+	}
+}
+
+// WithRequiredScopes optionally specifies scopes which the provider must grant
+// for the request.  Providers may grant fewer scopes than were requested (for
+// example, when the user declines to consent to some of them), so
+// Provider.Exchange(...) returns an error wrapping ErrScopesNotGranted when any
+// of the required scopes aren't granted.  The required scopes are retained by
+// the Token, so they're also required when it's refreshed.  Required scopes
+// should also be requested (see WithScopes).
+//
+// Option is valid for: Request
+func WithRequiredScopes(scopes ...string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*reqOptions); ok {
+			o.withRequiredScopes = scopes
+		}
+	}
+}
+
 // WithState optionally specifies a value to use for the request's state.
 // Typically, state is a random string generated for you when you create
 // a new Request. This option allows you to override that auto-generated value
@@ -625,3 +875,83 @@ func WithState(s string) Option {
 		}
 	}
 }
+
+// MinNonceLength is the minimum length of a nonce provided with the WithNonce
+// option.
+const MinNonceLength = DefaultIDLength
+
+// minNonceEntropy is the minimum estimated entropy (in bits) of a nonce
+// provided with the WithNonce option.
+const minNonceEntropy = 56
+
+// WithNonce optionally overrides the auto-generated nonce when creating a new
+// Request, for integrations which must supply their own nonce (for example: a
+// front-end which generates the nonce and binds it to its own session).
+//
+// The nonce is used to mitigate replay attacks, so it must be unique and
+// non-guessable.  NewRequest returns an ErrInvalidParameter error when the
+// nonce is shorter than MinNonceLength, isn't printable ASCII, or is too
+// predictable (made up of too few distinct characters).  See NewID(...) for a
+// function that generates a sufficiently random string.
+//
+// Option is valid for: Request
+func WithNonce(n string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*reqOptions); ok {
+			o.withNonce = n
+		}
+	}
+}
+
+// validNonce checks that a nonce provided with WithNonce is long enough, is
+// printable ASCII and that its estimated entropy is at least minNonceEntropy.
+// The entropy is estimated from the frequency of the nonce's characters, which
+// rejects nonces like "aaaaaaaaaaaaaaaaaaaa" or "abababababababababab".
+func validNonce(n string) error {
+	const op = "validNonce"
+	if len(n) < MinNonceLength {
+		return fmt.Errorf("%s: nonce is shorter than %d chars: %w", op, MinNonceLength, ErrInvalidParameter)
+	}
+	freq := map[rune]int{}
+	for _, r := range n {
+		if r < '!' || r > '~' {
+			return fmt.Errorf("%s: nonce must be printable ASCII: %w", op, ErrInvalidParameter)
+		}
+		freq[r]++
+	}
+	var bitsPerChar float64
+	for _, count := range freq {
+		p := float64(count) / float64(len(n))
+		bitsPerChar -= p * math.Log2(p)
+	}
+	if bitsPerChar*float64(len(n)) < minNonceEntropy {
+		return fmt.Errorf("%s: nonce doesn't have enough entropy: %w", op, ErrInvalidParameter)
+	}
+	return nil
+}
+
+// WithOfflineAccess optionally requests a refresh_token, which can be used to
+// get new tokens when the End-User isn't present.  For a Request, the
+// offline_access scope is requested along with prompt=consent (unless the
+// request's prompts include "none"), which the specification requires for
+// offline access.  The config's Profile may adjust how offline access is
+// requested (see WithProfile).  Offline access can't be used with the implicit
+// flow, since it never returns a refresh_token.
+//
+// Providers may silently ignore the request (for example: when the client
+// isn't allowed offline access), so check Token.RefreshTokenGranted() before
+// relying on a refresh_token.
+//
+// Option is valid for: Request and Token
+//
+// https://openid.net/specs/openid-connect-core-1_0.html#OfflineAccess
+func WithOfflineAccess() Option {
+	return func(o interface{}) {
+		switch v := o.(type) {
+		case *reqOptions:
+			v.withOfflineAccess = true
+		case *tokenOptions:
+			v.withOfflineAccess = true
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/cap/oidc/internal/strutils"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// DefaultRequestObjectTTL is the amount of time a request object is valid.
+const DefaultRequestObjectTTL = 5 * time.Minute
+
+// requestObjectKeyAlgs are the supported key management algorithms for
+// encrypted request objects, in order of preference.
+var requestObjectKeyAlgs = []jose.KeyAlgorithm{
+	jose.RSA_OAEP_256,
+	jose.RSA_OAEP,
+	jose.ECDH_ES_A256KW,
+	jose.ECDH_ES_A192KW,
+	jose.ECDH_ES_A128KW,
+	jose.ECDH_ES,
+}
+
+// requestObjectContentEncs are the supported content encryption algorithms
+// for encrypted request objects, in order of preference.
+var requestObjectContentEncs = []jose.ContentEncryption{
+	jose.A256GCM,
+	jose.A192GCM,
+	jose.A128GCM,
+	jose.A256CBC_HS512,
+	jose.A192CBC_HS384,
+	jose.A128CBC_HS256,
+}
+
+// defaultRequestObjectContentEnc is used when the provider's discovery
+// document doesn't advertise its supported content encryption algorithms.
+// See: https://openid.net/specs/openid-connect-registration-1_0.html#ClientMetadata
+const defaultRequestObjectContentEnc = jose.A128CBC_HS256
+
+// requestObjectMetadata is the discovery metadata used to encrypt request
+// objects
+type requestObjectMetadata struct {
+	EncryptionAlgs []string `json:"request_object_encryption_alg_values_supported"`
+	EncryptionEncs []string `json:"request_object_encryption_enc_values_supported"`
+}
+
+// RequestObject returns a request object for the oidcRequest, which passes
+// the parameters of its authentication request (see Provider.AuthURL) by
+// value as a JWT signed by the signer.  The request object's "iss" is the
+// config's ClientID and its "aud" is the config's Issuer.
+//
+// When WithRequestObjectEncryption is used, the signed request object is
+// encrypted (as a nested JWT) to one of the encryption keys published at the
+// provider's jwks_uri, so its parameters are confidential as well as
+// integrity protected.
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#RequestObject
+//
+// Supported options: WithRequestObjectEncryption
+func (p *Provider) RequestObject(ctx context.Context, oidcRequest Request, signer *JWTSigner, opt ...Option) (string, error) {
+	const op = "Provider.RequestObject"
+	if signer == nil {
+		return "", fmt.Errorf("%s: signer is nil: %w", op, ErrNilParameter)
+	}
+	opts := getRequestObjectOpts(opt...)
+	authURL, err := p.authURL(ctx, oidcRequest, false)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	_, params, err := p.authURLParams(ctx, authURL)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	requestObject, err := p.requestObject(ctx, params, signer, opts.withEncryption)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return requestObject, nil
+}
+
+// authURLParams splits the authURL into the provider's authorization endpoint
+// and the authentication request's parameters.
+func (p *Provider) authURLParams(ctx context.Context, authURL string) (string, url.Values, error) {
+	const op = "Provider.authURLParams"
+	// the request's parameters are appended to the authorization endpoint,
+	// which may have its own query parameters that must stay in the URL
+	provider, _, err := p.discovered(ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	endpoint := provider.Endpoint().AuthURL
+	if !strings.HasPrefix(authURL, endpoint) || len(authURL) == len(endpoint) {
+		return "", nil, fmt.Errorf("%s: auth url doesn't start with the authorization endpoint: %w", op, ErrInvalidParameter)
+	}
+	params, err := url.ParseQuery(authURL[len(endpoint)+1:])
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: unable to parse auth url: %s: %w", op, err, ErrInvalidParameter)
+	}
+	return endpoint, params, nil
+}
+
+// requestObject returns a request object with the params, which is signed by
+// the signer and optionally encrypted.
+func (p *Provider) requestObject(ctx context.Context, params url.Values, signer *JWTSigner, encrypt bool) (string, error) {
+	const op = "Provider.requestObject"
+	config := p.currentConfig()
+	claims := make(map[string]interface{}, len(params)+6)
+	for k, v := range params {
+		if len(v) == 0 {
+			continue
+		}
+		switch k {
+		case "claims":
+			// the claims parameter is a JSON object, not a string
+			claims[k] = json.RawMessage(v[0])
+		case "max_age":
+			secs, err := strconv.Atoi(v[0])
+			if err != nil {
+				return "", fmt.Errorf("%s: invalid max_age %q: %w", op, v[0], ErrInvalidParameter)
+			}
+			claims[k] = secs
+		default:
+			claims[k] = v[0]
+		}
+	}
+	jti, err := NewID()
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to generate jti: %w", op, err)
+	}
+	now := config.Now()
+	claims["iss"] = config.ClientID
+	claims["aud"] = config.Issuer
+	claims["jti"] = jti
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(DefaultRequestObjectTTL).Unix()
+
+	signed, err := signer.SignJWT(claims)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if !encrypt {
+		return signed, nil
+	}
+	encrypted, err := p.encryptRequestObject(ctx, signed)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return encrypted, nil
+}
+
+// encryptRequestObject encrypts the signed request object to one of the
+// encryption keys published at the provider's jwks_uri.
+func (p *Provider) encryptRequestObject(ctx context.Context, signed string) (string, error) {
+	const op = "Provider.encryptRequestObject"
+	provider, keySet, err := p.discovered(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	var m requestObjectMetadata
+	if err := provider.Claims(&m); err != nil {
+		return "", fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+	}
+	ks, ok := keySet.(*cachedKeySet)
+	if !ok {
+		return "", fmt.Errorf("%s: provider's key set doesn't publish encryption keys: %w", op, ErrNotFound)
+	}
+	keys, err := ks.keys(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to get provider's keys: %w", op, err)
+	}
+	recipient, err := requestObjectRecipient(keys, m.EncryptionAlgs)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	enc, err := requestObjectContentEnc(m.EncryptionEncs)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	encrypter, err := jose.NewEncrypter(enc, recipient, (&jose.EncrypterOptions{}).WithContentType("JWT"))
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to create encrypter: %w", op, err)
+	}
+	jwe, err := encrypter.Encrypt([]byte(signed))
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to encrypt request object: %w", op, err)
+	}
+	encrypted, err := jwe.CompactSerialize()
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to serialize request object: %w", op, err)
+	}
+	return encrypted, nil
+}
+
+// requestObjectRecipient returns the recipient for an encrypted request
+// object, which is the first of the keys that's published for encryption and
+// that can be used with a supported key management algorithm.  When the
+// provider advertises its supported algorithms, only those are used.
+func requestObjectRecipient(keys []jose.JSONWebKey, advertised []string) (jose.Recipient, error) {
+	const op = "requestObjectRecipient"
+	for _, k := range keys {
+		switch {
+		case k.Use == "enc":
+		case k.Use == "" && supportedRequestObjectKeyAlg(k.Algorithm):
+		default:
+			continue
+		}
+		candidates := requestObjectKeyAlgs
+		if k.Algorithm != "" {
+			candidates = []jose.KeyAlgorithm{jose.KeyAlgorithm(k.Algorithm)}
+		}
+		for _, alg := range candidates {
+			if !supportedRequestObjectKeyAlg(string(alg)) {
+				continue
+			}
+			if len(advertised) > 0 && !strutils.StrListContains(advertised, string(alg)) {
+				continue
+			}
+			if !keyAlgMatchesKey(alg, k.Key) {
+				continue
+			}
+			return jose.Recipient{Algorithm: alg, Key: k.Key, KeyID: k.KeyID}, nil
+		}
+	}
+	return jose.Recipient{}, fmt.Errorf("%s: provider doesn't publish a supported encryption key: %w", op, ErrNotFound)
+}
+
+// requestObjectContentEnc returns the content encryption algorithm for an
+// encrypted request object, which is the most preferred of the advertised
+// algorithms.
+func requestObjectContentEnc(advertised []string) (jose.ContentEncryption, error) {
+	const op = "requestObjectContentEnc"
+	if len(advertised) == 0 {
+		return defaultRequestObjectContentEnc, nil
+	}
+	for _, enc := range requestObjectContentEncs {
+		if strutils.StrListContains(advertised, string(enc)) {
+			return enc, nil
+		}
+	}
+	return "", fmt.Errorf("%s: none of the provider's content encryption algorithms (%s) are supported: %w", op, advertised, ErrInvalidParameter)
+}
+
+// supportedRequestObjectKeyAlg returns true when the alg is a supported key
+// management algorithm.
+func supportedRequestObjectKeyAlg(alg string) bool {
+	for _, a := range requestObjectKeyAlgs {
+		if string(a) == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// keyAlgMatchesKey returns true when the key management algorithm can be used
+// with the public key.
+func keyAlgMatchesKey(alg jose.KeyAlgorithm, key interface{}) bool {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return alg == jose.RSA_OAEP_256 || alg == jose.RSA_OAEP
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(string(alg), string(jose.ECDH_ES))
+	default:
+		return false
+	}
+}
+
+// requestObjectOptions is the set of available options for the
+// Provider.RequestObject function
+type requestObjectOptions struct {
+	withEncryption bool
+}
+
+// requestObjectDefaults is a handy way to get the defaults at runtime and
+// during unit tests.
+func requestObjectDefaults() requestObjectOptions {
+	return requestObjectOptions{}
+}
+
+// getRequestObjectOpts gets the Provider.RequestObject defaults and applies
+// the opt overrides passed in
+func getRequestObjectOpts(opt ...Option) requestObjectOptions {
+	opts := requestObjectDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithRequestObject provides an optional signer for an AuthRequest, whose
+// parameters are passed by value in a request object signed by the signer
+// (see Provider.RequestObject).  Only the client_id, response_type and scope
+// parameters are also sent outside of the request object.
+//
+// Valid for: Provider.AuthRequest
+func WithRequestObject(signer *JWTSigner) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*authRequestOptions); ok {
+			o.withRequestObjectSigner = signer
+		}
+	}
+}
+
+// WithRequestObjectEncryption optionally encrypts request objects to one of
+// the encryption keys published at the provider's jwks_uri, which is required
+// by deployments (like FAPI) that need confidential authorization parameters.
+//
+// Valid for: Provider.RequestObject and Provider.AuthRequest
+func WithRequestObjectEncryption() Option {
+	return func(o interface{}) {
+		switch v := o.(type) {
+		case *requestObjectOptions:
+			v.withEncryption = true
+		case *authRequestOptions:
+			v.withRequestObjectEncryption = true
+		}
+	}
+}
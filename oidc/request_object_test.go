@@ -0,0 +1,248 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// testRequestObjectProvider starts a provider whose jwks_uri publishes the
+// keys and whose discovery document includes the metadata.
+func testRequestObjectProvider(t *testing.T, keys []jose.JSONWebKey, metadata map[string]interface{}) *Provider {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/jwks":
+			_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: keys})
+		default:
+			doc := map[string]interface{}{
+				"issuer":                 srv.URL,
+				"authorization_endpoint": srv.URL + "/authorize",
+				"token_endpoint":         srv.URL + "/token",
+				"jwks_uri":               srv.URL + "/jwks",
+			}
+			for k, v := range metadata {
+				doc[k] = v
+			}
+			_ = json.NewEncoder(w).Encode(doc)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	c, err := NewConfig(srv.URL, "client-id", "client-secret", []Alg{ES256}, []string{"https://example.com/callback"})
+	require.NoError(t, err)
+	p, err := NewProvider(c)
+	require.NoError(t, err)
+	t.Cleanup(p.Done)
+	return p
+}
+
+func TestProvider_RequestObject(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	pub, priv := TestGenerateKeys(t)
+	signer, err := NewJWTSigner(priv.(crypto.Signer), ES256, "rp-key")
+	require.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	sigKey := jose.JSONWebKey{Key: pub, KeyID: "sig", Use: "sig", Algorithm: string(ES256)}
+	rsaEncKey := jose.JSONWebKey{Key: &rsaKey.PublicKey, KeyID: "rsa-enc", Use: "enc"}
+	ecEncKey := jose.JSONWebKey{Key: &ecKey.PublicKey, KeyID: "ec-enc", Algorithm: string(jose.ECDH_ES_A256KW)}
+
+	tests := []struct {
+		name       string
+		keys       []jose.JSONWebKey
+		metadata   map[string]interface{}
+		encrypt    bool
+		decryptKey interface{}
+		wantKeyID  string
+		wantAlg    jose.KeyAlgorithm
+		wantEnc    jose.ContentEncryption
+		wantIsErr  error
+	}{
+		{name: "signed", keys: []jose.JSONWebKey{sigKey}},
+		{
+			name:       "encrypted-rsa",
+			keys:       []jose.JSONWebKey{sigKey, rsaEncKey, ecEncKey},
+			encrypt:    true,
+			decryptKey: rsaKey,
+			wantKeyID:  "rsa-enc",
+			wantAlg:    jose.RSA_OAEP_256,
+			wantEnc:    defaultRequestObjectContentEnc,
+		},
+		{
+			name: "encrypted-advertised-algs",
+			keys: []jose.JSONWebKey{sigKey, rsaEncKey, ecEncKey},
+			metadata: map[string]interface{}{
+				"request_object_encryption_alg_values_supported": []string{"RSA1_5", "ECDH-ES+A256KW"},
+				"request_object_encryption_enc_values_supported": []string{"A128CBC-HS256", "A256GCM"},
+			},
+			encrypt:    true,
+			decryptKey: ecKey,
+			wantKeyID:  "ec-enc",
+			wantAlg:    jose.ECDH_ES_A256KW,
+			wantEnc:    jose.A256GCM,
+		},
+		{name: "missing-encryption-key", keys: []jose.JSONWebKey{sigKey}, encrypt: true, wantIsErr: ErrNotFound},
+		{
+			name:      "unsupported-enc",
+			keys:      []jose.JSONWebKey{rsaEncKey},
+			metadata:  map[string]interface{}{"request_object_encryption_enc_values_supported": []string{"unknown"}},
+			encrypt:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			p := testRequestObjectProvider(t, tt.keys, tt.metadata)
+			oidcRequest, err := NewRequest(time.Minute, "https://example.com/callback", WithMaxAge(60), WithClaims([]byte(`{"id_token":{"acr":null}}`)))
+			require.NoError(err)
+
+			var opts []Option
+			if tt.encrypt {
+				opts = append(opts, WithRequestObjectEncryption())
+			}
+			requestObject, err := p.RequestObject(ctx, oidcRequest, signer, opts...)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+
+			signed := requestObject
+			if tt.encrypt {
+				jwe, err := jose.ParseEncrypted(requestObject)
+				require.NoError(err)
+				assert.Equal(tt.wantKeyID, jwe.Header.KeyID)
+				assert.Equal(string(tt.wantAlg), jwe.Header.Algorithm)
+				assert.Equal(string(tt.wantEnc), jwe.Header.ExtraHeaders["enc"])
+				assert.Equal("JWT", jwe.Header.ExtraHeaders["cty"])
+				plaintext, err := jwe.Decrypt(tt.decryptKey)
+				require.NoError(err)
+				signed = string(plaintext)
+			}
+			parsed, err := jwt.ParseSigned(signed)
+			require.NoError(err)
+			var claims struct {
+				jwt.Claims
+				ClientID     string          `json:"client_id"`
+				ResponseType string          `json:"response_type"`
+				RedirectURI  string          `json:"redirect_uri"`
+				Scope        string          `json:"scope"`
+				State        string          `json:"state"`
+				Nonce        string          `json:"nonce"`
+				MaxAge       int             `json:"max_age"`
+				ClaimsParam  json.RawMessage `json:"claims"`
+			}
+			require.NoError(parsed.Claims(pub, &claims))
+			assert.Equal("client-id", claims.Issuer)
+			assert.Equal(jwt.Audience{p.currentConfig().Issuer}, claims.Audience)
+			assert.NotEmpty(claims.ID)
+			assert.NoError(claims.Validate(jwt.Expected{Time: time.Now()}))
+			assert.Equal("client-id", claims.ClientID)
+			assert.Equal("code", claims.ResponseType)
+			assert.Equal("https://example.com/callback", claims.RedirectURI)
+			assert.Equal("openid", claims.Scope)
+			assert.Equal(oidcRequest.State(), claims.State)
+			assert.Equal(oidcRequest.Nonce(), claims.Nonce)
+			assert.Equal(60, claims.MaxAge)
+			assert.JSONEq(`{"id_token":{"acr":null}}`, string(claims.ClaimsParam))
+		})
+	}
+	t.Run("nil-signer", func(t *testing.T) {
+		p := testRequestObjectProvider(t, nil, nil)
+		oidcRequest, err := NewRequest(time.Minute, "https://example.com/callback")
+		require.NoError(t, err)
+		_, err = p.RequestObject(ctx, oidcRequest, nil)
+		assert.Truef(t, errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+}
+
+func TestProvider_AuthRequest_requestObject(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	_, priv := TestGenerateKeys(t)
+	signer, err := NewJWTSigner(priv.(crypto.Signer), ES256, "rp-key")
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := testRequestObjectProvider(t, []jose.JSONWebKey{{Key: &rsaKey.PublicKey, KeyID: "enc", Use: "enc"}}, nil)
+	oidcRequest, err := NewRequest(time.Minute, "https://example.com/callback")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		opts        []Option
+		wantEncrypt bool
+		wantIsErr   error
+	}{
+		{name: "get", opts: []Option{WithRequestObject(signer)}},
+		{name: "post", opts: []Option{WithRequestObject(signer), WithAuthRequestMethod(http.MethodPost)}},
+		{name: "encrypted", opts: []Option{WithRequestObject(signer), WithRequestObjectEncryption()}, wantEncrypt: true},
+		{name: "encryption-without-signer", opts: []Option{WithRequestObjectEncryption()}, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			r, err := p.AuthRequest(ctx, oidcRequest, tt.opts...)
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			params, err := r.Params()
+			require.NoError(err)
+			assert.ElementsMatch([]string{"client_id", "response_type", "scope", "request"}, mapKeys(params))
+			assert.Equal("client-id", params.Get("client_id"))
+			assert.Equal("code", params.Get("response_type"))
+			assert.Equal("openid", params.Get("scope"))
+
+			requestObject := params.Get("request")
+			if tt.wantEncrypt {
+				jwe, err := jose.ParseEncrypted(requestObject)
+				require.NoError(err)
+				plaintext, err := jwe.Decrypt(rsaKey)
+				require.NoError(err)
+				requestObject = string(plaintext)
+			}
+			parsed, err := jwt.ParseSigned(requestObject)
+			require.NoError(err)
+			var claims map[string]interface{}
+			require.NoError(parsed.UnsafeClaimsWithoutVerification(&claims))
+			assert.Equal(oidcRequest.State(), claims["state"])
+			assert.Equal("https://example.com/callback", claims["redirect_uri"])
+		})
+	}
+}
+
+// mapKeys returns the keys of the url.Values
+func mapKeys(v url.Values) []string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -34,6 +34,7 @@ func TestNewRequest(t *testing.T) {
 		wantAudiences   []string
 		wantScopes      []string
 		wantVerifier    CodeVerifier
+		wantNonce       string
 		wantErr         bool
 		wantIsErr       error
 	}{
@@ -65,6 +66,22 @@ func TestNewRequest(t *testing.T) {
 			wantErr:   true,
 			wantIsErr: ErrInvalidParameter,
 		},
+		{
+			name:            "valid-with-nonce",
+			expireIn:        defaultExpireIn,
+			redirectURL:     "https://bob.com",
+			opts:            []Option{WithNonce("n_bZ3m0Ta9Qq4Kx7LwR2vE")},
+			wantRedirectURL: "https://bob.com",
+			wantNonce:       "n_bZ3m0Ta9Qq4Kx7LwR2vE",
+		},
+		{
+			name:        "low-entropy-nonce",
+			expireIn:    defaultExpireIn,
+			redirectURL: "https://bob.com",
+			opts:        []Option{WithNonce("abababababababababababab")},
+			wantErr:     true,
+			wantIsErr:   ErrInvalidParameter,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -87,6 +104,41 @@ func TestNewRequest(t *testing.T) {
 			assert.Equalf(got.Audiences(), tt.wantAudiences, "wanted \"%s\" but got \"%s\"", tt.wantAudiences, got.Audiences())
 			assert.Equalf(got.Scopes(), tt.wantScopes, "wanted \"%s\" but got \"%s\"", tt.wantScopes, got.Scopes())
 			assert.Equalf(got.PKCEVerifier(), tt.wantVerifier, "wanted \"%s\" but got \"%s\"", tt.wantVerifier, got.PKCEVerifier())
+			if tt.wantNonce != "" {
+				assert.Equalf(tt.wantNonce, got.Nonce(), "wanted \"%s\" but got \"%s\"", tt.wantNonce, got.Nonce())
+			}
+		})
+	}
+}
+
+func Test_validNonce(t *testing.T) {
+	t.Parallel()
+	generated, err := NewID()
+	require.NoError(t, err)
+	tests := []struct {
+		name    string
+		nonce   string
+		wantErr bool
+	}{
+		{name: "generated", nonce: generated},
+		{name: "generated-with-prefix", nonce: "n_" + generated},
+		{name: "too-short", nonce: "bZ3m0Ta9Qq4Kx7", wantErr: true},
+		{name: "repeated", nonce: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", wantErr: true},
+		{name: "alternating", nonce: "abababababababababababab", wantErr: true},
+		{name: "few-distinct", nonce: "abcdabcdabcdabcdabcdabcd", wantErr: true},
+		{name: "whitespace", nonce: "bZ3m0Ta9Qq 4Kx7LwR2vEyU", wantErr: true},
+		{name: "non-ascii", nonce: "bZ3m0Ta9Qqé4Kx7LwR2vEyU", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			err := validNonce(tt.nonce)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+				return
+			}
+			require.NoError(err)
 		})
 	}
 }
@@ -189,6 +241,37 @@ func Test_WithPrompts(t *testing.T) {
 	})
 }
 
+func Test_WithOfflineAccess(t *testing.T) {
+	t.Parallel()
+	t.Run("reqOptions", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		opts := getReqOpts()
+		testOpts := reqDefaults()
+		assert.Equal(opts, testOpts)
+
+		opts = getReqOpts(WithOfflineAccess())
+		testOpts = reqDefaults()
+		testOpts.withOfflineAccess = true
+		assert.Equal(opts, testOpts)
+	})
+	t.Run("tokenOptions", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		opts := getTokenOpts(WithOfflineAccess())
+		testOpts := tokenDefaults()
+		testOpts.withOfflineAccess = true
+		assert.Equal(opts, testOpts)
+	})
+	t.Run("implicit-flow", func(t *testing.T) {
+		t.Parallel()
+		assert, require := assert.New(t), require.New(t)
+		_, err := NewRequest(1*time.Minute, "https://redirect", WithOfflineAccess(), WithImplicitFlow())
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
+
 func Test_WithDisplay(t *testing.T) {
 	t.Parallel()
 	t.Run("reqOptions", func(t *testing.T) {
@@ -282,6 +365,20 @@ func Test_WithACRValues(t *testing.T) {
 	})
 }
 
+func Test_WithAuthAudience(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	opts := getReqOpts(WithAuthAudience("https://api.example.com"))
+	testOpts := reqDefaults()
+	testOpts.withAuthAudience = "https://api.example.com"
+	assert.Equal(opts, testOpts)
+
+	r, err := NewRequest(time.Minute, "https://redirect", WithAuthAudience("https://api.example.com"))
+	require.NoError(err)
+	assert.Equal("https://api.example.com", r.AuthAudience())
+	assert.Empty(r.Audiences())
+}
+
 func Test_WithState(t *testing.T) {
 	t.Parallel()
 	t.Run("reqOptions", func(t *testing.T) {
@@ -302,3 +399,33 @@ func Test_WithState(t *testing.T) {
 		assert.Equal(opts, testOpts)
 	})
 }
+
+func Test_WithReturnTo(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	opts := getReqOpts(WithReturnTo("/orders"))
+	testOpts := reqDefaults()
+	testOpts.withReturnTo = "/orders"
+	assert.Equal(opts, testOpts)
+
+	r, err := NewRequest(time.Minute, "https://redirect", WithReturnTo("/orders"))
+	require.NoError(err)
+	assert.Equal("/orders", r.ReturnTo())
+}
+
+func Test_WithRequiredScopes(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	opts := getReqOpts(WithRequiredScopes("email", "profile"))
+	testOpts := reqDefaults()
+	testOpts.withRequiredScopes = []string{"email", "profile"}
+	assert.Equal(opts, testOpts)
+
+	r, err := NewRequest(time.Minute, "https://redirect", WithRequiredScopes("email"))
+	require.NoError(err)
+	assert.Equal([]string{"email"}, r.RequiredScopes())
+
+	r, err = NewRequest(time.Minute, "https://redirect")
+	require.NoError(err)
+	assert.Empty(r.RequiredScopes())
+}
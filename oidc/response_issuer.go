@@ -0,0 +1,38 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+)
+
+// VerifyResponseIssuer verifies an authorization response's iss parameter,
+// which protects against mix-up attacks when an app uses more than one
+// provider.  When the iss is not empty, it must be the config's Issuer.  An
+// empty iss is only allowed when the config doesn't enforce the FAPI profile
+// and the provider doesn't advertise the
+// authorization_response_iss_parameter_supported metadata.  Every
+// authorization response (including error responses) should be verified.
+//
+// The callback package's handlers verify every response's iss.  See:
+// https://tools.ietf.org/html/rfc9207
+func (p *Provider) VerifyResponseIssuer(ctx context.Context, iss string) error {
+	const op = "Provider.VerifyResponseIssuer"
+	config := p.currentConfig()
+	if iss != "" {
+		if iss != config.Issuer {
+			return fmt.Errorf("%s: response issuer %q is not the provider's issuer: %w", op, iss, ErrInvalidIssuer)
+		}
+		return nil
+	}
+	if config.FAPI {
+		return fmt.Errorf("%s: response is missing the iss parameter: %w", op, ErrFAPIViolation)
+	}
+	required, err := p.Supports(ctx, FeatureResponseIssuer)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if required {
+		return fmt.Errorf("%s: response is missing the iss parameter: %w", op, ErrInvalidIssuer)
+	}
+	return nil
+}
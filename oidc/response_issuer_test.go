@@ -0,0 +1,48 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_VerifyResponseIssuer(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	optional := testRequestObjectProvider(t, nil, nil)
+	required := testRequestObjectProvider(t, nil, map[string]interface{}{"authorization_response_iss_parameter_supported": true})
+	fapiProvider := startTestFAPIProvider(t, nil)
+	fapi, err := NewProvider(fapiProvider.config(t))
+	require.NoError(t, err)
+	defer fapi.Done()
+
+	tests := []struct {
+		name      string
+		p         *Provider
+		iss       string
+		wantIsErr error
+	}{
+		{name: "valid", p: required, iss: required.currentConfig().Issuer},
+		{name: "optional-missing", p: optional},
+		{name: "optional-valid", p: optional, iss: optional.currentConfig().Issuer},
+		{name: "optional-mismatch", p: optional, iss: "https://attacker.example.com", wantIsErr: ErrInvalidIssuer},
+		{name: "required-missing", p: required, wantIsErr: ErrInvalidIssuer},
+		{name: "fapi-missing", p: fapi, wantIsErr: ErrFAPIViolation},
+		{name: "fapi-valid", p: fapi, iss: fapi.currentConfig().Issuer},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			err := tt.p.VerifyResponseIssuer(ctx, tt.iss)
+			if tt.wantIsErr != nil {
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			assert.NoError(err)
+		})
+	}
+}
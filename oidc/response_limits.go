@@ -0,0 +1,227 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/coreos/go-oidc"
+)
+
+// DefaultMaxResponseSize is the default limit for the bytes read from each of
+// a provider's responses.
+const DefaultMaxResponseSize = 1024 * 1024
+
+// The provider endpoints with response limits
+const (
+	discoveryEndpoint    = "discovery"
+	tokenEndpoint        = "token"
+	jwksEndpoint         = "jwks"
+	userInfoEndpoint     = "userinfo"
+	registrationEndpoint = "registration"
+)
+
+// ResponseLimits are the maximum number of bytes read from the responses of a
+// provider's endpoints.  A response which exceeds its limit fails with an
+// ErrResponseTooLarge error, so a misbehaving (or compromised) provider or
+// proxy can't cause unbounded memory use.  A zero limit uses
+// DefaultMaxResponseSize.
+type ResponseLimits struct {
+	// Discovery limits the discovery document response.
+	Discovery int64
+
+	// Token limits the token endpoint responses (exchange and refresh).
+	Token int64
+
+	// JWKS limits the JSON Web Key Set responses.
+	JWKS int64
+
+	// UserInfo limits the userinfo endpoint responses.
+	UserInfo int64
+}
+
+// WithResponseLimits provides optional limits for the bytes read from the
+// provider's responses.  See ResponseLimits.
+//
+// Valid for: Provider
+func WithResponseLimits(l ResponseLimits) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*providerOptions); ok {
+			o.withResponseLimits = l
+		}
+	}
+}
+
+// validate checks that none of the limits are negative.
+func (l ResponseLimits) validate() error {
+	const op = "ResponseLimits.validate"
+	if l.Discovery < 0 || l.Token < 0 || l.JWKS < 0 || l.UserInfo < 0 {
+		return fmt.Errorf("%s: response limits must not be negative: %w", op, ErrInvalidParameter)
+	}
+	return nil
+}
+
+// limit returns the limit for the endpoint
+func (l ResponseLimits) limit(endpoint string) int64 {
+	var limit int64
+	switch endpoint {
+	case discoveryEndpoint:
+		limit = l.Discovery
+	case tokenEndpoint:
+		limit = l.Token
+	case jwksEndpoint:
+		limit = l.JWKS
+	case userInfoEndpoint:
+		limit = l.UserInfo
+	}
+	if limit == 0 {
+		return DefaultMaxResponseSize
+	}
+	return limit
+}
+
+// limitedClientContext returns a new Context that carries the provider's
+// http client for the endpoint (see endpointClient and HTTPClientContext)
+func (p *Provider) limitedClientContext(ctx context.Context, endpoint string) (context.Context, error) {
+	const op = "Provider.limitedClientContext"
+	c, err := p.HTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return oidc.ClientContext(ctx, p.endpointClient(c, endpoint)), nil
+}
+
+// endpointClient returns a client which uses c's transport for the
+// endpoint's requests, but limits the bytes read from the endpoint's responses
+// and the rate of its requests (see WithResponseLimits and WithRateLimits).
+// The token endpoint's requests authenticate the client using a
+// private_key_jwt client assertion when the config has a
+// ClientAssertionSigner, or a client_secret_jwt client assertion when it has
+// a ClientSecretJWTAlg.  The token endpoint and userinfo requests include a
+// DPoP proof when the config has a DPoPKey.
+func (p *Provider) endpointClient(c *http.Client, endpoint string) *http.Client {
+	c = limitedClient(c, endpoint, p.responseLimits.limit(endpoint))
+	if bucket, ok := p.rateLimiters[endpoint]; ok {
+		c.Transport = &rateLimitTransport{
+			base:       c.Transport,
+			endpoint:   endpoint,
+			bucket:     bucket,
+			onThrottle: p.throttleFunc,
+		}
+	}
+	if endpoint == tokenEndpoint {
+		if config := p.currentConfig(); config != nil && (config.ClientAssertionSigner != nil || config.ClientSecretJWTAlg != "") {
+			c.Transport = &clientAssertionTransport{
+				base:      c.Transport,
+				signer:    config.ClientAssertionSigner,
+				secret:    config.ClientSecret,
+				secretAlg: config.ClientSecretJWTAlg,
+				clientID:  config.ClientID,
+				nowFunc:   config.NowFunc,
+			}
+		}
+	}
+	if endpoint == tokenEndpoint || endpoint == userInfoEndpoint {
+		if config := p.currentConfig(); config != nil && config.DPoPKey != nil {
+			c.Transport = &dpopTransport{
+				base:    c.Transport,
+				key:     config.DPoPKey,
+				nowFunc: config.NowFunc,
+			}
+		}
+	}
+	return c
+}
+
+// limitedClient returns a client which uses c's transport, but limits the
+// bytes read from every response body.
+func limitedClient(c *http.Client, endpoint string, limit int64) *http.Client {
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &http.Client{
+		Transport:     &limitTransport{base: base, endpoint: endpoint, limit: limit},
+		CheckRedirect: c.CheckRedirect,
+		Jar:           c.Jar,
+		Timeout:       c.Timeout,
+	}
+}
+
+// limitTransport is an http.RoundTripper which limits the bytes read from
+// every response body.
+type limitTransport struct {
+	base     http.RoundTripper
+	endpoint string
+	limit    int64
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength > t.limit {
+		resp.Body.Close()
+		return nil, tooLargeError(t.endpoint, t.limit)
+	}
+	resp.Body = &limitedBody{
+		ReadCloser: resp.Body,
+		endpoint:   t.endpoint,
+		limit:      t.limit,
+		remaining:  t.limit,
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the base transport's idle connections.
+func (t *limitTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if tr, ok := t.base.(closeIdler); ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// limitedBody is a response body which fails once more than its limit has
+// been read.  Unlike an io.LimitedReader, exceeding the limit is an error
+// rather than an EOF, so a truncated response is never mistaken for a
+// complete one.
+type limitedBody struct {
+	io.ReadCloser
+	endpoint  string
+	limit     int64
+	remaining int64
+	err       error
+}
+
+// Read satisfies the io.Reader interface.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.remaining <= 0 {
+		// the limit has been reached, so the body must be at its EOF
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			b.err = tooLargeError(b.endpoint, b.limit)
+			return 0, b.err
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// tooLargeError returns an ErrResponseTooLarge error for the endpoint
+func tooLargeError(endpoint string, limit int64) error {
+	return fmt.Errorf("%s response exceeds %d bytes: %w", endpoint, limit, ErrResponseTooLarge)
+}
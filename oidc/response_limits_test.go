@@ -0,0 +1,151 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_limitedClient(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body := strings.Repeat("a", 10)
+		if req.URL.Query().Get("chunked") == "" {
+			w.Header().Set("Content-Length", "10")
+		}
+		_, _ = w.Write([]byte(body))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name    string
+		limit   int64
+		chunked bool
+		wantErr bool
+	}{
+		{name: "under-limit", limit: 11},
+		{name: "at-limit", limit: 10},
+		{name: "over-limit", limit: 9, wantErr: true},
+		{name: "chunked-at-limit", limit: 10, chunked: true},
+		{name: "chunked-over-limit", limit: 9, chunked: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			c := limitedClient(srv.Client(), "test", tt.limit)
+			url := srv.URL
+			if tt.chunked {
+				url += "?chunked=true"
+			}
+			resp, err := c.Get(url)
+			if err == nil {
+				defer resp.Body.Close()
+				var body []byte
+				body, err = ioutil.ReadAll(resp.Body)
+				if err == nil {
+					assert.Equal(strings.Repeat("a", 10), string(body))
+				}
+			}
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, ErrResponseTooLarge), "wanted \"%s\" but got \"%s\"", ErrResponseTooLarge, err)
+				assert.Contains(err.Error(), "test response exceeds 9 bytes")
+				return
+			}
+			require.NoError(err)
+		})
+	}
+}
+
+func TestProvider_responseLimits(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+
+	newProvider := func(t *testing.T, l ResponseLimits) (*Provider, error) {
+		// a cache per provider keeps the keys from being shared between
+		// tests
+		cache, err := NewJWKSCache()
+		require.NoError(t, err)
+		c := testNewConfig(t, clientID, "test-client-secret", redirect, tp)
+		c.JWKSCache = cache
+		p, err := NewProvider(c, WithResponseLimits(l))
+		if err == nil {
+			t.Cleanup(p.Done)
+		}
+		return p, err
+	}
+	newRequest := func(t *testing.T) Request {
+		oidcRequest, err := NewRequest(time.Minute, redirect)
+		require.NoError(t, err)
+		tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+		return oidcRequest
+	}
+	t.Run("invalid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := newProvider(t, ResponseLimits{Token: -1})
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("defaults", func(t *testing.T) {
+		require := require.New(t)
+		p, err := newProvider(t, ResponseLimits{})
+		require.NoError(err)
+		oidcRequest := newRequest(t)
+		tk, err := p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+		require.NoError(err)
+		var claims map[string]interface{}
+		require.NoError(p.UserInfo(ctx, tk.StaticTokenSource(), "alice@example.com", &claims))
+	})
+	t.Run("discovery", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := newProvider(t, ResponseLimits{Discovery: 10})
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrResponseTooLarge), "wanted \"%s\" but got \"%s\"", ErrResponseTooLarge, err)
+	})
+	t.Run("token", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, err := newProvider(t, ResponseLimits{Token: 10})
+		require.NoError(err)
+		oidcRequest := newRequest(t)
+		_, err = p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrResponseTooLarge), "wanted \"%s\" but got \"%s\"", ErrResponseTooLarge, err)
+	})
+	t.Run("jwks", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, err := newProvider(t, ResponseLimits{JWKS: 10})
+		require.NoError(err)
+		oidcRequest := newRequest(t)
+		_, err = p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrResponseTooLarge), "wanted \"%s\" but got \"%s\"", ErrResponseTooLarge, err)
+	})
+	t.Run("userinfo", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		p, err := newProvider(t, ResponseLimits{UserInfo: 10})
+		require.NoError(err)
+		oidcRequest := newRequest(t)
+		tk, err := p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+		require.NoError(err)
+		var claims map[string]interface{}
+		err = p.UserInfo(ctx, tk.StaticTokenSource(), "alice@example.com", &claims)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrResponseTooLarge), "wanted \"%s\" but got \"%s\"", ErrResponseTooLarge, err)
+	})
+}
@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResponseMode is a string value that specifies how the Authorization Server
+// returns the authentication response's parameters.
+//
+// See: https://openid.net/specs/oauth-v2-multiple-response-types-1_0.html#ResponseModes
+type ResponseMode string
+
+const (
+	// Defined the ResponseMode values which are always supported.  Extension
+	// response modes (like "web_message") are supported when they're
+	// registered with the provider's Config (see WithResponseModes).
+	//
+	// See: https://openid.net/specs/oauth-v2-multiple-response-types-1_0.html#ResponseModes
+	// See: https://openid.net/specs/oauth-v2-form-post-response-mode-1_0.html
+	QueryResponseMode    ResponseMode = "query"
+	FragmentResponseMode ResponseMode = "fragment"
+	FormPostResponseMode ResponseMode = "form_post"
+)
+
+// knownResponseModes are the response modes which don't need to be
+// registered with a Config
+var knownResponseModes = []ResponseMode{QueryResponseMode, FragmentResponseMode, FormPostResponseMode}
+
+// WithResponseModes provides an optional list of extension response modes
+// (like "web_message") which may be used by the provider's Requests, in
+// addition to the query, fragment and form_post response modes.
+//
+// Valid for: Config
+func WithResponseModes(modes ...ResponseMode) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withResponseModes = append(o.withResponseModes, modes...)
+		}
+	}
+}
+
+// WithResponseMode optionally specifies how the Authorization Server returns
+// the authentication response's parameters.  Extension response modes must be
+// registered with the provider's Config (see WithResponseModes).  The query
+// response mode can't be used with the implicit flow, which uses the
+// form_post response mode by default.
+//
+// Option is valid for: Request
+//
+// https://openid.net/specs/oauth-v2-multiple-response-types-1_0.html#ResponseModes
+func WithResponseMode(m ResponseMode) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*reqOptions); ok {
+			o.withResponseMode = m
+		}
+	}
+}
+
+// validResponseMode checks that the response mode is a valid parameter value
+func validResponseMode(m ResponseMode) error {
+	const op = "validResponseMode"
+	if m == "" || strings.ContainsAny(string(m), " \t\r\n") {
+		return fmt.Errorf("%s: response mode %q is invalid: %w", op, m, ErrInvalidParameter)
+	}
+	return nil
+}
+
+// supportedResponseMode checks that the response mode is either a known
+// response mode or one of the config's extension response modes.
+func supportedResponseMode(c *Config, m ResponseMode) error {
+	const op = "supportedResponseMode"
+	for _, known := range knownResponseModes {
+		if m == known {
+			return nil
+		}
+	}
+	for _, registered := range c.ResponseModes {
+		if m == registered {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: response mode %q is not registered (see WithResponseModes): %w", op, m, ErrInvalidParameter)
+}
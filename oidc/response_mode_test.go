@@ -0,0 +1,82 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_AuthURL_responseMode(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tc := testNewConfig(t, "test-client-id", "test-client-secret", redirect, tp)
+	tc.ResponseModes = []ResponseMode{"web_message"}
+	p, err := NewProvider(tc)
+	require.NoError(t, err)
+	t.Cleanup(p.Done)
+
+	tests := []struct {
+		name      string
+		opt       []Option
+		want      string
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "default", want: ""},
+		{name: "implicit-default", opt: []Option{WithImplicitFlow()}, want: "form_post"},
+		{name: "known", opt: []Option{WithResponseMode(FragmentResponseMode)}, want: "fragment"},
+		{name: "implicit-override", opt: []Option{WithImplicitFlow(), WithResponseMode(FragmentResponseMode)}, want: "fragment"},
+		{name: "registered", opt: []Option{WithResponseMode("web_message")}, want: "web_message"},
+		{name: "unregistered", opt: []Option{WithResponseMode("jwt")}, wantErr: true, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			oidcRequest, err := NewRequest(time.Minute, redirect, tt.opt...)
+			require.NoError(err)
+			got, err := p.AuthURL(ctx, oidcRequest)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			u, err := url.Parse(got)
+			require.NoError(err)
+			assert.Equal(tt.want, u.Query().Get("response_mode"))
+		})
+	}
+}
+
+func TestWithResponseMode(t *testing.T) {
+	t.Parallel()
+	t.Run("implicit-query", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := NewRequest(time.Minute, "https://redirect", WithImplicitFlow(), WithResponseMode(QueryResponseMode))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := NewRequest(time.Minute, "https://redirect", WithResponseMode("web message"))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("config", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		c, err := NewConfig("https://issuer", "client-id", "client-secret", []Alg{RS256}, nil, WithResponseModes("web_message"))
+		require.NoError(err)
+		assert.Equal([]ResponseMode{"web_message"}, c.ResponseModes)
+
+		_, err = NewConfig("https://issuer", "client-id", "client-secret", []Alg{RS256}, nil, WithResponseModes(""))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
@@ -0,0 +1,136 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFetchRetries is the default number of times a discovery or JWKS
+	// fetch is retried after a transient failure.
+	DefaultFetchRetries = 2
+
+	// DefaultFetchRetryBackoff is the default base delay between fetch
+	// retries, which doubles with every retry (with jitter).
+	DefaultFetchRetryBackoff = 100 * time.Millisecond
+)
+
+// WithFetchRetries provides optional bounds for retrying discovery and JWKS
+// fetches which fail with a transient error: a network error or a 429/5xx
+// response.  Other failures (an invalid discovery document or JWKS, an
+// unknown key, an invalid signature, etc) are never retried.  The delay
+// before each retry is a random (jitter) duration up to the backoff, which
+// doubles after each retry.  Zero retries disables retrying.  The defaults
+// are DefaultFetchRetries and DefaultFetchRetryBackoff.
+//
+// When used with a JWKSCache, the retries apply to every jwks_uri fetched by
+// the cache.  When used with NewProvider, they apply to the provider's
+// discovery requests.
+//
+// Valid for: Provider and JWKSCache
+func WithFetchRetries(retries int, backoff time.Duration) Option {
+	return func(o interface{}) {
+		switch v := o.(type) {
+		case *providerOptions:
+			v.withFetchRetries = retryPolicy{retries: retries, backoff: backoff}
+		case *jwksCacheOptions:
+			v.withFetchRetries = retryPolicy{retries: retries, backoff: backoff}
+		}
+	}
+}
+
+// retryPolicy bounds the retries of transient fetch failures.
+type retryPolicy struct {
+	retries int
+	backoff time.Duration
+}
+
+// defaultRetryPolicy returns the default retryPolicy for fetches
+func defaultRetryPolicy() retryPolicy {
+	return retryPolicy{retries: DefaultFetchRetries, backoff: DefaultFetchRetryBackoff}
+}
+
+// do calls fn until it succeeds, fails with an error which isn't transient,
+// the retries are exhausted or the ctx is done.  It returns fn's last error.
+func (r retryPolicy) do(ctx context.Context, fn func() error) error {
+	backoff := r.backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.retries || !isTransientFetchError(err) {
+			return err
+		}
+		timer := time.NewTimer(jitter(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+var (
+	// jitterRand is the source of the retry jitter, which doesn't need to be
+	// cryptographically secure.
+	jitterRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	jitterRandMu sync.Mutex
+)
+
+// jitter returns a random duration in [d/2, d]
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	jitterRandMu.Lock()
+	defer jitterRandMu.Unlock()
+	return d/2 + time.Duration(jitterRand.Int63n(int64(d/2)+1))
+}
+
+// fetchStatusError is returned for an unsuccessful http response to a fetch.
+type fetchStatusError struct {
+	statusCode int
+	msg        string
+}
+
+func (e *fetchStatusError) Error() string { return e.msg }
+
+// statusPrefixRE matches the status that prefixes the errors returned by the
+// coreos package for unsuccessful discovery responses.
+var statusPrefixRE = regexp.MustCompile(`^([1-5][0-9][0-9]) `)
+
+// isTransientFetchError returns true for network errors and 429/5xx
+// responses, which may succeed if the fetch is retried.
+func isTransientFetchError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrResponseTooLarge) {
+		return false
+	}
+	var statusErr *fetchStatusError
+	if errors.As(err, &statusErr) {
+		return isTransientStatus(statusErr.statusCode)
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return true
+	}
+	if m := statusPrefixRE.FindStringSubmatch(err.Error()); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return isTransientStatus(code)
+	}
+	return false
+}
+
+// isTransientStatus returns true for http status codes that are worth
+// retrying.
+func isTransientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
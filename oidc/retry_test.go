@@ -0,0 +1,170 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_isTransientFetchError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"network", &url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("connection refused")}, true},
+		{"wrapped-network", fmt.Errorf("get keys failed: %w", &url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("EOF")}), true},
+		{"canceled", &url.Error{Op: "Get", URL: "https://example.com", Err: context.Canceled}, false},
+		{"deadline", fmt.Errorf("get keys failed: %w", context.DeadlineExceeded), false},
+		{"status-503", &fetchStatusError{statusCode: http.StatusServiceUnavailable}, true},
+		{"status-429", &fetchStatusError{statusCode: http.StatusTooManyRequests}, true},
+		{"status-404", &fetchStatusError{statusCode: http.StatusNotFound}, false},
+		{"discovery-502", errors.New("502 Bad Gateway: upstream failed"), true},
+		{"discovery-404", errors.New("404 Not Found: "), false},
+		{"invalid-document", errors.New("oidc: failed to decode provider discovery object: EOF"), false},
+		{"invalid-signature", errors.New("failed to verify id token signature"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isTransientFetchError(tt.err))
+		})
+	}
+}
+
+func Test_retryPolicy_do(t *testing.T) {
+	t.Parallel()
+	transient := &fetchStatusError{statusCode: http.StatusServiceUnavailable, msg: "503"}
+	permanent := errors.New("permanent")
+	tests := []struct {
+		name         string
+		policy       retryPolicy
+		errs         []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{"success", retryPolicy{retries: 2}, []error{nil}, 1, nil},
+		{"retried", retryPolicy{retries: 2, backoff: time.Millisecond}, []error{transient, transient, nil}, 3, nil},
+		{"exhausted", retryPolicy{retries: 2, backoff: time.Millisecond}, []error{transient, transient, transient, nil}, 3, transient},
+		{"permanent", retryPolicy{retries: 2}, []error{permanent, nil}, 1, permanent},
+		{"disabled", retryPolicy{}, []error{transient, nil}, 1, transient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			var attempts int
+			err := tt.policy.do(context.Background(), func() error {
+				err := tt.errs[attempts]
+				attempts++
+				return err
+			})
+			assert.Equal(tt.wantErr, err)
+			assert.Equal(tt.wantAttempts, attempts)
+		})
+	}
+	t.Run("ctx-done", func(t *testing.T) {
+		assert := assert.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var attempts int
+		err := retryPolicy{retries: 5, backoff: time.Hour}.do(ctx, func() error {
+			attempts++
+			return transient
+		})
+		assert.Equal(transient, err)
+		assert.Equal(1, attempts)
+	})
+}
+
+func Test_jitter(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	assert.Equal(time.Duration(0), jitter(0))
+	for i := 0; i < 100; i++ {
+		got := jitter(100 * time.Millisecond)
+		assert.GreaterOrEqual(int64(got), int64(50*time.Millisecond))
+		assert.LessOrEqual(int64(got), int64(100*time.Millisecond))
+	}
+}
+
+func TestProvider_discoveryRetries(t *testing.T) {
+	t.Parallel()
+	var requests, failures int64
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt64(&requests, 1) <= atomic.LoadInt64(&failures) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   srv.URL,
+			"jwks_uri": srv.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(srv.Close)
+	c, err := NewConfig(srv.URL, "client-id", "client-secret", []Alg{ES256}, []string{"https://redirect"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		failures     int64
+		wantRequests int64
+		wantErr      bool
+		wantIsErr    error
+	}{
+		{
+			name:         "default-retries",
+			failures:     2,
+			wantRequests: 3,
+		},
+		{
+			name:         "exhausted",
+			opts:         []Option{WithFetchRetries(1, time.Millisecond)},
+			failures:     2,
+			wantRequests: 2,
+			wantErr:      true,
+		},
+		{
+			name:         "disabled",
+			opts:         []Option{WithFetchRetries(0, 0)},
+			failures:     1,
+			wantRequests: 1,
+			wantErr:      true,
+		},
+		{
+			name:      "invalid",
+			opts:      []Option{WithFetchRetries(-1, 0)},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			atomic.StoreInt64(&requests, 0)
+			atomic.StoreInt64(&failures, tt.failures)
+			p, err := NewProvider(c, tt.opts...)
+			if tt.wantErr {
+				require.Error(err)
+				if tt.wantIsErr != nil {
+					assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				}
+			} else {
+				require.NoError(err)
+				p.Done()
+			}
+			assert.Equal(tt.wantRequests, atomic.LoadInt64(&requests))
+		})
+	}
+}
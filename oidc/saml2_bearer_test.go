@@ -0,0 +1,107 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_SAML2BearerGrant(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	assertion := `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_test">...</saml:Assertion>`
+
+	tests := []struct {
+		name      string
+		assertion []byte
+		opt       []Option
+		setup     func(tp *TestProvider)
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name:      "valid",
+			assertion: []byte(assertion),
+		},
+		{
+			name:      "valid-with-scopes",
+			assertion: []byte(assertion),
+			opt:       []Option{WithScopes("email")},
+		},
+		{
+			name:      "empty-assertion",
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "unexpected-assertion",
+			assertion: []byte("<saml:Assertion>unexpected</saml:Assertion>"),
+			wantErr:   true,
+		},
+		{
+			name:      "missing-id-token",
+			assertion: []byte(assertion),
+			setup:     func(tp *TestProvider) { tp.SetOmitIDTokens(true) },
+			wantErr:   true,
+			wantIsErr: ErrMissingIDToken,
+		},
+		{
+			name:      "invalid-id-token",
+			assertion: []byte(assertion),
+			setup: func(tp *TestProvider) {
+				tp.SetCustomClaims(map[string]interface{}{"iss": "https://different.example.com"})
+			},
+			wantErr:   true,
+			wantIsErr: ErrInvalidIssuer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			tp := StartTestProvider(t)
+			tp.SetExpectedSAMLAssertion(assertion)
+			if tt.setup != nil {
+				tt.setup(tp)
+			}
+			p := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+			defer p.Done()
+
+			got, err := p.SAML2BearerGrant(ctx, tt.assertion, tt.opt...)
+			if tt.wantErr {
+				require.Error(err)
+				if tt.wantIsErr != nil {
+					assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				}
+				return
+			}
+			require.NoError(err)
+			assert.NotEmpty(got.IDToken())
+			assert.NotEmpty(got.AccessToken())
+		})
+	}
+	t.Run("unexpected-assertion-oauth-error", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := StartTestProvider(t)
+		p := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+		defer p.Done()
+		_, err := p.SAML2BearerGrant(ctx, []byte(assertion))
+		require.Error(err)
+		var oauthErr *OAuthError
+		require.True(errors.As(err, &oauthErr))
+		assert.Equal("invalid_grant", oauthErr.Code)
+	})
+}
+
+func Test_getGrantOpts(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	opts := getGrantOpts(WithScopes("email", "profile"))
+	testOpts := grantDefaults()
+	testOpts.withScopes = []string{"openid", "email", "profile"}
+	assert.Equal(opts, testOpts)
+}
@@ -0,0 +1,32 @@
+/*
+session is a package that provides server-side sessions for web apps which
+log users in via an OIDC provider.
+
+Rather than storing the user's tokens (or a JWT) in a cookie, a Manager issues
+each session an opaque, random reference ID which is the only thing sent to
+the browser.  The session's verified oidc.Token and claims are kept in a
+Store, so a session can be revoked instantly by deleting it.
+
+* a MemoryStore is provided, and other backends (redis, a database, etc) can
+be used by implementing the Store interface
+
+* sessions have a sliding idle timeout (see WithIdleTimeout) which is
+extended every time the session is used, and an absolute max lifetime (see
+WithMaxLifetime)
+
+* the Manager's SetCookie, FromRequest and ClearCookie functions read and
+write the session's reference ID in a secure, http-only cookie
+
+* a Session implements encoding.BinaryMarshaler using a versioned format (see
+FormatVersion), so a Store can persist it with gob or as bytes, and data
+persisted by this release can be read by future releases
+
+* the Manager's RequireSession middleware requires a valid session, and
+either redirects browser routes to the login or responds to API routes with
+a 401 "login required" JSON problem (see WithAPIResponse)
+
+* the Manager's BackChannelLogout handler revokes the sessions (and
+optionally their refresh tokens) of the provider's back-channel logout
+tokens, when the Store implements the Finder interface
+*/
+package session
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// FormatVersion is the current version of a Session's persisted format (see
+// Session.MarshalBinary).
+const FormatVersion = 1
+
+// storedSession is the persisted format of a Session.  The Token is persisted
+// using the oidc.Tk's versioned format (see oidc.MarshalToken).
+type storedSession struct {
+	Version   int                    `json:"version"`
+	ID        string                 `json:"id"`
+	Token     json.RawMessage        `json:"token,omitempty"`
+	Claims    map[string]interface{} `json:"claims,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	ExpiresAt time.Time              `json:"expires_at"`
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler (which is also used by
+// encoding/gob), so a Store can persist Sessions using any backend.  The
+// format is versioned JSON (see FormatVersion), which includes the session's
+// unredacted tokens, so it must be stored securely.
+func (s *Session) MarshalBinary() ([]byte, error) {
+	const op = "Session.MarshalBinary"
+	ss := storedSession{
+		Version:   FormatVersion,
+		ID:        s.ID,
+		Claims:    s.Claims,
+		CreatedAt: s.CreatedAt,
+		ExpiresAt: s.ExpiresAt,
+	}
+	if s.Token != nil {
+		data, err := oidc.MarshalToken(s.Token)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		ss.Token = data
+	}
+	data, err := json.Marshal(ss)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler (which is also used
+// by encoding/gob).  Data persisted by a newer version of the format returns
+// an error wrapping oidc.ErrUnsupportedFormatVersion.  The claims' numbers
+// are unmarshaled as float64 values, like the claims of a verified id_token.
+func (s *Session) UnmarshalBinary(data []byte) error {
+	const op = "Session.UnmarshalBinary"
+	var ss storedSession
+	if err := json.Unmarshal(data, &ss); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// a future version of the format must migrate prior versions here
+	switch {
+	case ss.Version < 1:
+		return fmt.Errorf("%s: version is missing: %w", op, oidc.ErrUnsupportedFormatVersion)
+	case ss.Version > FormatVersion:
+		return fmt.Errorf("%s: version %d is newer than %d: %w", op, ss.Version, FormatVersion, oidc.ErrUnsupportedFormatVersion)
+	}
+	*s = Session{
+		ID:        ss.ID,
+		Claims:    ss.Claims,
+		CreatedAt: ss.CreatedAt,
+		ExpiresAt: ss.ExpiresAt,
+	}
+	if len(ss.Token) > 0 {
+		t, err := oidc.UnmarshalToken(ss.Token)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		s.Token = t
+	}
+	return nil
+}
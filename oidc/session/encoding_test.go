@@ -0,0 +1,72 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestSession_MarshalBinary(t *testing.T) {
+	t.Parallel()
+	// the times are UTC, since a Local time is unmarshaled with a different
+	// (but equal) location
+	now := time.Now().UTC().Truncate(time.Second)
+	tk, err := oidc.NewToken("id-token", &oauth2.Token{AccessToken: "access-token", Expiry: now.Add(time.Hour)})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		s    *Session
+	}{
+		{
+			name: "valid",
+			s: &Session{
+				ID:        "s_0123456789",
+				Token:     tk,
+				Claims:    map[string]interface{}{"sub": "alice", "email_verified": true, "iat": float64(now.Unix())},
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Minute),
+			},
+		},
+		{
+			name: "without-token",
+			s:    &Session{ID: "s_0123456789", CreatedAt: now, ExpiresAt: now.Add(time.Minute)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			data, err := tt.s.MarshalBinary()
+			require.NoError(err)
+			got := &Session{}
+			require.NoError(got.UnmarshalBinary(data))
+			assert.Equal(tt.s, got)
+
+			// a Session can be persisted using gob
+			var buf bytes.Buffer
+			require.NoError(gob.NewEncoder(&buf).Encode(tt.s))
+			got = &Session{}
+			require.NoError(gob.NewDecoder(&buf).Decode(got))
+			assert.Equal(tt.s, got)
+		})
+	}
+	t.Run("newer-version", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		err := (&Session{}).UnmarshalBinary([]byte(`{"version":2,"id":"s_0123456789"}`))
+		require.Error(err)
+		assert.Truef(errors.Is(err, oidc.ErrUnsupportedFormatVersion), "wanted \"%s\" but got \"%s\"", oidc.ErrUnsupportedFormatVersion, err)
+	})
+	t.Run("invalid-token", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		err := (&Session{}).UnmarshalBinary([]byte(`{"version":1,"id":"s_0123456789","token":{"version":1}}`))
+		require.Error(err)
+		assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+	})
+}
@@ -0,0 +1,186 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// maxLogoutRequestSize is the maximum size of a back-channel logout request's
+// body, which is a form with a logout_token.
+const maxLogoutRequestSize = oidc.MaxTokenSize + 1024
+
+// Logout revokes the sessions of a verified back-channel logout token (see
+// oidc.Provider.VerifyLogoutToken): the sessions of the token's issuer whose
+// claims have the token's sid and sub (when the token has them).  The
+// manager's store must implement the Finder interface.  The revoked sessions
+// are returned, so their tokens can be revoked with the provider.  It's not an
+// error when there aren't any sessions to revoke.
+func (m *Manager) Logout(ctx context.Context, lt *oidc.LogoutToken) ([]*Session, error) {
+	const op = "Manager.Logout"
+	if lt == nil {
+		return nil, fmt.Errorf("%s: logout token is nil: %w", op, oidc.ErrNilParameter)
+	}
+	if lt.SessionID == "" && lt.Subject == "" {
+		return nil, fmt.Errorf("%s: logout token doesn't have a sid or sub: %w", op, oidc.ErrInvalidParameter)
+	}
+	finder, ok := m.store.(Finder)
+	if !ok {
+		return nil, fmt.Errorf("%s: store doesn't implement the Finder interface: %w", op, oidc.ErrInvalidParameter)
+	}
+	sessions, err := finder.Find(ctx, lt.Issuer, lt.SessionID, lt.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, s := range sessions {
+		if err := m.store.Delete(ctx, s.ID); err != nil {
+			return nil, fmt.Errorf("%s: unable to revoke session: %w", op, err)
+		}
+	}
+	return sessions, nil
+}
+
+// BackChannelLogout creates a handler for the provider's back-channel logout
+// requests, which provides single logout: the request's logout token is
+// verified (see oidc.Provider.VerifyLogoutToken) and its sessions are revoked
+// (see Logout).  The manager's store must implement the Finder interface.
+//
+// As required by the spec, the handler responds with 200 OK when the logout
+// succeeds and 400 Bad Request (with an OAuth error body) when it fails.
+// Replayed logout tokens are only detected when a WithLogoutReplayCache is
+// provided, since logging out the same sessions again is harmless.
+//
+// Supported options: WithRevokeRefreshTokensOnLogout, WithLogoutReplayCache
+//
+// See: https://openid.net/specs/openid-connect-backchannel-1_0.html
+func (m *Manager) BackChannelLogout(p *oidc.Provider, opt ...oidc.Option) (http.HandlerFunc, error) {
+	const op = "Manager.BackChannelLogout"
+	if p == nil {
+		return nil, fmt.Errorf("%s: provider is nil: %w", op, oidc.ErrNilParameter)
+	}
+	if _, ok := m.store.(Finder); !ok {
+		return nil, fmt.Errorf("%s: store doesn't implement the Finder interface: %w", op, oidc.ErrInvalidParameter)
+	}
+	opts := getLogoutOpts(opt...)
+	return func(w http.ResponseWriter, req *http.Request) {
+		const op = "Manager.BackChannelLogout"
+		w.Header().Set("Cache-Control", "no-store")
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeLogoutError(w, http.StatusMethodNotAllowed, "invalid_request", "method not allowed")
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, maxLogoutRequestSize)
+		if err := req.ParseForm(); err != nil {
+			writeLogoutError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("%s: unable to parse form: %s", op, err))
+			return
+		}
+		lt, err := p.VerifyLogoutToken(req.Context(), req.PostForm.Get("logout_token"))
+		if err != nil {
+			writeLogoutError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("%s: %s", op, err))
+			return
+		}
+		if opts.withReplayCache != nil {
+			if err := addLogoutToken(req.Context(), opts.withReplayCache, lt); err != nil {
+				writeLogoutError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("%s: %s", op, err))
+				return
+			}
+		}
+		sessions, err := m.Logout(req.Context(), lt)
+		if err != nil {
+			writeLogoutError(w, http.StatusBadRequest, "logout_failed", fmt.Sprintf("%s: %s", op, err))
+			return
+		}
+		if opts.withRevokeRefreshTokens {
+			var tokens []oidc.RefreshToken
+			for _, s := range sessions {
+				if s.Token != nil && s.Token.RefreshToken() != "" {
+					tokens = append(tokens, s.Token.RefreshToken())
+				}
+			}
+			if err := p.RevokeRefreshTokens(req.Context(), tokens...); err != nil {
+				writeLogoutError(w, http.StatusBadRequest, "logout_failed", fmt.Sprintf("%s: sessions were revoked, but their refresh tokens weren't: %s", op, err))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}, nil
+}
+
+// addLogoutToken adds the logout token's jti to the replay cache until the
+// token expires.
+func addLogoutToken(ctx context.Context, c oidc.ReplayCache, lt *oidc.LogoutToken) error {
+	const op = "session.addLogoutToken"
+	if lt.ID == "" {
+		return fmt.Errorf("%s: missing jti claim: %w", op, oidc.ErrInvalidLogoutToken)
+	}
+	exp, _ := lt.Claims["exp"].(float64)
+	if err := c.Add(ctx, "logout:"+lt.Issuer+":"+lt.ID, time.Unix(int64(exp), 0)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// writeLogoutError writes an OAuth error response for a back-channel logout
+// request.
+func writeLogoutError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// logoutOptions is the set of available options for Manager.BackChannelLogout
+type logoutOptions struct {
+	withRevokeRefreshTokens bool
+	withReplayCache         oidc.ReplayCache
+}
+
+// logoutDefaults is a handy way to get the defaults at runtime and during unit
+// tests.
+func logoutDefaults() logoutOptions {
+	return logoutOptions{}
+}
+
+// getLogoutOpts gets the logout defaults and applies the opt overrides passed
+// in
+func getLogoutOpts(opt ...oidc.Option) logoutOptions {
+	opts := logoutDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithRevokeRefreshTokensOnLogout provides an optional revocation of the
+// refresh tokens of the sessions revoked by a back-channel logout, using the
+// provider's revocation_endpoint (see oidc.Provider.RevokeRefreshTokens).  The
+// sessions are revoked even when a revocation fails, and the failure is
+// reported to the provider with a 400 Bad Request response.
+//
+// Valid for: Manager.BackChannelLogout
+func WithRevokeRefreshTokensOnLogout() oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*logoutOptions); ok {
+			o.withRevokeRefreshTokens = true
+		}
+	}
+}
+
+// WithLogoutReplayCache provides an optional oidc.ReplayCache which is used to
+// reject replayed logout tokens, using their iss and jti.  Logout tokens
+// without a jti are rejected.  An app with multiple instances requires a
+// shared cache.
+//
+// Valid for: Manager.BackChannelLogout
+func WithLogoutReplayCache(c oidc.ReplayCache) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*logoutOptions); ok {
+			o.withReplayCache = c
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package session
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// testLogoutProvider is a provider which signs logout tokens and has a
+// revocation_endpoint.
+type testLogoutProvider struct {
+	srv     *httptest.Server
+	priv    *ecdsa.PrivateKey
+	p       *oidc.Provider
+	mu      sync.Mutex
+	revoked []string
+	status  int
+}
+
+func startTestLogoutProvider(t *testing.T) *testLogoutProvider {
+	t.Helper()
+	pub, priv := oidc.TestGenerateKeys(t)
+	tp := &testLogoutProvider{priv: priv.(*ecdsa.PrivateKey), status: http.StatusOK}
+	tp.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"issuer":              tp.srv.URL,
+				"jwks_uri":            tp.srv.URL + "/jwks",
+				"revocation_endpoint": tp.srv.URL + "/revoke",
+			})
+		case "/jwks":
+			_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: pub, Algorithm: string(oidc.ES256)}}})
+		case "/revoke":
+			tp.mu.Lock()
+			defer tp.mu.Unlock()
+			tp.revoked = append(tp.revoked, req.FormValue("token"))
+			w.WriteHeader(tp.status)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(tp.srv.Close)
+	c, err := oidc.NewConfig(tp.srv.URL, "client-id", "client-secret", []oidc.Alg{oidc.ES256}, []string{"https://example.com/callback"})
+	require.NoError(t, err)
+	tp.p, err = oidc.NewProvider(c)
+	require.NoError(t, err)
+	t.Cleanup(tp.p.Done)
+	return tp
+}
+
+// logoutToken returns a signed logout token for the sid and sub.
+func (tp *testLogoutProvider) logoutToken(t *testing.T, sid, sub string) string {
+	t.Helper()
+	claims := map[string]interface{}{
+		"iss":    tp.srv.URL,
+		"aud":    "client-id",
+		"iat":    time.Now().Unix(),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+		"jti":    "test-jti",
+		"events": map[string]interface{}{oidc.BackChannelLogoutEvent: map[string]interface{}{}},
+	}
+	if sid != "" {
+		claims["sid"] = sid
+	}
+	if sub != "" {
+		claims["sub"] = sub
+	}
+	return oidc.TestSignJWT(t, tp.priv, oidc.ES256, claims, nil)
+}
+
+func (tp *testLogoutProvider) revokedTokens() []string {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return tp.revoked
+}
+
+func TestManager_BackChannelLogout(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	// setup creates a manager with alice's two sessions and bob's session.
+	setup := func(t *testing.T, tp *testLogoutProvider) (*Manager, *MemoryStore) {
+		t.Helper()
+		store := NewMemoryStore()
+		m, err := NewManager(store)
+		require.NoError(t, err)
+		for _, s := range []struct{ id, sid, sub string }{
+			{"s1", "sid-1", "alice"},
+			{"s2", "sid-2", "alice"},
+			{"s3", "sid-3", "bob"},
+		} {
+			tk, err := oidc.NewToken("id-token", &oauth2.Token{AccessToken: "access", RefreshToken: "refresh-" + s.id})
+			require.NoError(t, err)
+			claims := map[string]interface{}{"iss": tp.srv.URL, "sid": s.sid, "sub": s.sub}
+			require.NoError(t, store.Write(ctx, &Session{ID: s.id, Token: tk, Claims: claims, ExpiresAt: time.Now().Add(time.Hour)}))
+		}
+		return m, store
+	}
+	remaining := func(store *MemoryStore) []string {
+		var ids []string
+		for _, id := range []string{"s1", "s2", "s3"} {
+			if _, err := store.Read(ctx, id); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	post := func(h http.HandlerFunc, logoutToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(url.Values{"logout_token": {logoutToken}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h(w, req)
+		return w
+	}
+
+	t.Run("by-sid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := startTestLogoutProvider(t)
+		m, store := setup(t, tp)
+		h, err := m.BackChannelLogout(tp.p)
+		require.NoError(err)
+		w := post(h, tp.logoutToken(t, "sid-1", "alice"))
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Equal("no-store", w.Header().Get("Cache-Control"))
+		assert.Equal([]string{"s2", "s3"}, remaining(store))
+		assert.Empty(tp.revokedTokens())
+	})
+	t.Run("by-sub-with-revocation", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := startTestLogoutProvider(t)
+		m, store := setup(t, tp)
+		h, err := m.BackChannelLogout(tp.p, WithRevokeRefreshTokensOnLogout())
+		require.NoError(err)
+		w := post(h, tp.logoutToken(t, "", "alice"))
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Equal([]string{"s3"}, remaining(store))
+		assert.ElementsMatch([]string{"refresh-s1", "refresh-s2"}, tp.revokedTokens())
+	})
+	t.Run("revocation-error", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := startTestLogoutProvider(t)
+		tp.status = http.StatusUnauthorized
+		m, store := setup(t, tp)
+		h, err := m.BackChannelLogout(tp.p, WithRevokeRefreshTokensOnLogout())
+		require.NoError(err)
+		w := post(h, tp.logoutToken(t, "sid-3", ""))
+		assert.Equal(http.StatusBadRequest, w.Code)
+		assert.Contains(w.Body.String(), "logout_failed")
+		// the sessions are revoked regardless
+		assert.Equal([]string{"s1", "s2"}, remaining(store))
+	})
+	t.Run("invalid-logout-token", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := startTestLogoutProvider(t)
+		m, store := setup(t, tp)
+		h, err := m.BackChannelLogout(tp.p)
+		require.NoError(err)
+		w := post(h, tp.logoutToken(t, "", ""))
+		assert.Equal(http.StatusBadRequest, w.Code)
+		var body map[string]string
+		require.NoError(json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal("invalid_request", body["error"])
+		assert.Contains(body["error_description"], oidc.ErrInvalidLogoutToken.Error())
+
+		w = post(h, "")
+		assert.Equal(http.StatusBadRequest, w.Code)
+		assert.Equal([]string{"s1", "s2", "s3"}, remaining(store))
+	})
+	t.Run("replayed", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := startTestLogoutProvider(t)
+		m, store := setup(t, tp)
+		cache := oidc.NewMemoryReplayCache()
+		h, err := m.BackChannelLogout(tp.p, WithLogoutReplayCache(cache))
+		require.NoError(err)
+		logoutToken := tp.logoutToken(t, "sid-1", "alice")
+		w := post(h, logoutToken)
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Equal([]string{"s2", "s3"}, remaining(store))
+		assert.Equal(1, cache.Len())
+
+		w = post(h, logoutToken)
+		assert.Equal(http.StatusBadRequest, w.Code)
+		assert.Contains(w.Body.String(), oidc.ErrReplayDetected.Error())
+	})
+	t.Run("method-not-allowed", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := startTestLogoutProvider(t)
+		m, _ := setup(t, tp)
+		h, err := m.BackChannelLogout(tp.p)
+		require.NoError(err)
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodGet, "/logout?logout_token="+tp.logoutToken(t, "sid-1", ""), nil))
+		assert.Equal(http.StatusMethodNotAllowed, w.Code)
+	})
+	t.Run("invalid-parameters", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := startTestLogoutProvider(t)
+		m, err := NewManager(NewMemoryStore())
+		require.NoError(err)
+		_, err = m.BackChannelLogout(nil)
+		assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+
+		// a store must implement Finder
+		m, err = NewManager(struct{ Store }{NewMemoryStore()})
+		require.NoError(err)
+		_, err = m.BackChannelLogout(tp.p)
+		assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+		_, err = m.Logout(ctx, &oidc.LogoutToken{Subject: "alice"})
+		assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+	})
+}
+
+func TestManager_Logout(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	tk, err := oidc.NewToken("id-token", nil)
+	require.NoError(err)
+	store := NewMemoryStore()
+	m, err := NewManager(store)
+	require.NoError(err)
+	require.NoError(store.Write(ctx, &Session{ID: "s1", Token: tk, Claims: map[string]interface{}{"iss": "https://idp", "sub": "alice", "sid": "sid-1"}}))
+	require.NoError(store.Write(ctx, &Session{ID: "s2", Token: tk, Claims: map[string]interface{}{"iss": "https://other-idp", "sub": "alice", "sid": "sid-1"}}))
+
+	_, err = m.Logout(ctx, nil)
+	assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+	_, err = m.Logout(ctx, &oidc.LogoutToken{Issuer: "https://idp"})
+	assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+
+	revoked, err := m.Logout(ctx, &oidc.LogoutToken{Issuer: "https://idp", Subject: "alice"})
+	require.NoError(err)
+	require.Len(revoked, 1)
+	assert.Equal("s1", revoked[0].ID)
+	_, err = store.Read(ctx, "s1")
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+	_, err = store.Read(ctx, "s2")
+	assert.NoError(err)
+
+	// it's not an error when there aren't any sessions
+	revoked, err = m.Logout(ctx, &oidc.LogoutToken{Issuer: "https://idp", Subject: "alice"})
+	require.NoError(err)
+	assert.Empty(revoked)
+}
@@ -0,0 +1,251 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+const (
+	// DefaultIdleTimeout is the default amount of time a session can go
+	// unused before it expires.
+	DefaultIdleTimeout = 30 * time.Minute
+
+	// DefaultMaxLifetime is the default maximum amount of time a session can
+	// be used, no matter how often it's used.
+	DefaultMaxLifetime = 12 * time.Hour
+
+	// DefaultCookieName is the default name of the cookie which holds a
+	// session's reference ID.
+	DefaultCookieName = "cap_session"
+
+	// idEntropy is the number of bits of entropy in a session's reference ID.
+	idEntropy = 256
+)
+
+// Manager creates, loads and revokes Sessions in a Store.  A session's
+// expiration slides forward by the idle timeout every time it's loaded, up to
+// its max lifetime.  It is concurrently safe.
+type Manager struct {
+	store       Store
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+	cookieName  string
+
+	// nowFunc returns the current time, and is overridden by tests.
+	nowFunc func() time.Time
+}
+
+// NewManager creates a new Manager which persists its sessions in the store.
+//
+// Supported options: WithIdleTimeout, WithMaxLifetime, WithCookieName
+func NewManager(store Store, opt ...oidc.Option) (*Manager, error) {
+	const op = "NewManager"
+	if store == nil {
+		return nil, fmt.Errorf("%s: store is nil: %w", op, oidc.ErrNilParameter)
+	}
+	opts := getManagerOpts(opt...)
+	switch {
+	case opts.withIdleTimeout <= 0:
+		return nil, fmt.Errorf("%s: idle timeout must be greater than zero: %w", op, oidc.ErrInvalidParameter)
+	case opts.withMaxLifetime < 0:
+		return nil, fmt.Errorf("%s: max lifetime must not be negative: %w", op, oidc.ErrInvalidParameter)
+	case opts.withCookieName == "":
+		return nil, fmt.Errorf("%s: cookie name is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	return &Manager{
+		store:       store,
+		idleTimeout: opts.withIdleTimeout,
+		maxLifetime: opts.withMaxLifetime,
+		cookieName:  opts.withCookieName,
+		nowFunc:     time.Now,
+	}, nil
+}
+
+// Create a new Session for the user's verified token and claims, and write
+// it to the store.
+func (m *Manager) Create(ctx context.Context, t oidc.Token, claims map[string]interface{}) (*Session, error) {
+	const op = "Manager.Create"
+	if t == nil {
+		return nil, fmt.Errorf("%s: token is nil: %w", op, oidc.ErrNilParameter)
+	}
+	id, err := oidc.NewID(oidc.WithEntropy(idEntropy))
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to generate session ID: %w", op, err)
+	}
+	now := m.nowFunc()
+	s := &Session{
+		ID:        id,
+		Token:     t,
+		Claims:    claims,
+		CreatedAt: now,
+	}
+	s.ExpiresAt = m.expiry(s, now)
+	if err := m.store.Write(ctx, s); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return s, nil
+}
+
+// Get the Session for the reference ID and slide its expiration forward.  If
+// the session doesn't exist (or was revoked), then an error wrapping
+// oidc.ErrNotFound is returned.  If the session is expired, then it's deleted
+// and an error wrapping oidc.ErrExpiredSession is returned.
+func (m *Manager) Get(ctx context.Context, id string) (*Session, error) {
+	const op = "Manager.Get"
+	if id == "" {
+		return nil, fmt.Errorf("%s: session ID is empty: %w", op, oidc.ErrNotFound)
+	}
+	s, err := m.store.Read(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	now := m.nowFunc()
+	if s.Expired(now) {
+		if err := m.store.Delete(ctx, id); err != nil {
+			return nil, fmt.Errorf("%s: unable to delete expired session: %w", op, err)
+		}
+		return nil, fmt.Errorf("%s: %w", op, oidc.ErrExpiredSession)
+	}
+	s.ExpiresAt = m.expiry(s, now)
+	if err := m.store.Touch(ctx, id, s.ExpiresAt); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return s, nil
+}
+
+// Revoke the session for the reference ID, so it can't be used again.  It's
+// not an error to revoke a session that doesn't exist.
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	const op = "Manager.Revoke"
+	if err := m.store.Delete(ctx, id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// SetCookie writes the session's reference ID to a secure, http-only cookie.
+// The cookie has no expiration, since the session expires server-side.
+func (m *Manager) SetCookie(w http.ResponseWriter, s *Session) error {
+	const op = "Manager.SetCookie"
+	if s == nil {
+		return fmt.Errorf("%s: session is nil: %w", op, oidc.ErrNilParameter)
+	}
+	http.SetCookie(w, m.cookie(s.ID, 0))
+	return nil
+}
+
+// ClearCookie removes the session's cookie from the user's browser.  It
+// doesn't revoke the session (see Revoke).
+func (m *Manager) ClearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, m.cookie("", -1))
+}
+
+// FromRequest gets the Session whose reference ID is in the request's
+// cookie, like Get(...).  If the request doesn't have a cookie, then an error
+// wrapping oidc.ErrNotFound is returned.
+func (m *Manager) FromRequest(req *http.Request) (*Session, error) {
+	const op = "Manager.FromRequest"
+	if req == nil {
+		return nil, fmt.Errorf("%s: request is nil: %w", op, oidc.ErrNilParameter)
+	}
+	c, err := req.Cookie(m.cookieName)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s cookie: %w", op, m.cookieName, oidc.ErrNotFound)
+	}
+	s, err := m.Get(req.Context(), c.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return s, nil
+}
+
+// expiry returns the session's expiration when it's used at the time now.
+func (m *Manager) expiry(s *Session, now time.Time) time.Time {
+	exp := now.Add(m.idleTimeout)
+	if m.maxLifetime > 0 {
+		if max := s.CreatedAt.Add(m.maxLifetime); max.Before(exp) {
+			exp = max
+		}
+	}
+	return exp
+}
+
+// cookie returns the session cookie for the value.
+func (m *Manager) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.cookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// managerOptions is the set of available options for a Manager
+type managerOptions struct {
+	withIdleTimeout time.Duration
+	withMaxLifetime time.Duration
+	withCookieName  string
+}
+
+// managerDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func managerDefaults() managerOptions {
+	return managerOptions{
+		withIdleTimeout: DefaultIdleTimeout,
+		withMaxLifetime: DefaultMaxLifetime,
+		withCookieName:  DefaultCookieName,
+	}
+}
+
+// getManagerOpts gets the manager defaults and applies the opt overrides
+// passed in
+func getManagerOpts(opt ...oidc.Option) managerOptions {
+	opts := managerDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithIdleTimeout provides an optional amount of time a session can go unused
+// before it expires.  The default is DefaultIdleTimeout.
+//
+// Valid for: Manager
+func WithIdleTimeout(d time.Duration) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*managerOptions); ok {
+			o.withIdleTimeout = d
+		}
+	}
+}
+
+// WithMaxLifetime provides an optional maximum amount of time a session can be
+// used after it's created, no matter how often it's used.  The default is
+// DefaultMaxLifetime, and zero allows a session to be used indefinitely as
+// long as it doesn't go unused for the idle timeout.
+//
+// Valid for: Manager
+func WithMaxLifetime(d time.Duration) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*managerOptions); ok {
+			o.withMaxLifetime = d
+		}
+	}
+}
+
+// WithCookieName provides an optional name for the cookie which holds a
+// session's reference ID.  The default is DefaultCookieName.
+//
+// Valid for: Manager
+func WithCookieName(name string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*managerOptions); ok {
+			o.withCookieName = name
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewManager(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		store     Store
+		opts      []oidc.Option
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "valid", store: NewMemoryStore()},
+		{name: "nil-store", wantErr: true, wantIsErr: oidc.ErrNilParameter},
+		{name: "zero-idle-timeout", store: NewMemoryStore(), opts: []oidc.Option{WithIdleTimeout(0)}, wantErr: true, wantIsErr: oidc.ErrInvalidParameter},
+		{name: "negative-max-lifetime", store: NewMemoryStore(), opts: []oidc.Option{WithMaxLifetime(-1)}, wantErr: true, wantIsErr: oidc.ErrInvalidParameter},
+		{name: "empty-cookie-name", store: NewMemoryStore(), opts: []oidc.Option{WithCookieName("")}, wantErr: true, wantIsErr: oidc.ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			m, err := NewManager(tt.store, tt.opts...)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				assert.Nil(m)
+				return
+			}
+			require.NoError(err)
+			assert.NotNil(m)
+		})
+	}
+}
+
+func TestManager(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tk, err := oidc.NewToken("id-token", nil)
+	require.NoError(t, err)
+	claims := map[string]interface{}{"sub": "alice"}
+
+	newManager := func(t *testing.T, now *time.Time) (*Manager, *MemoryStore) {
+		t.Helper()
+		store := NewMemoryStore()
+		m, err := NewManager(store, WithIdleTimeout(10*time.Minute), WithMaxLifetime(time.Hour))
+		require.NoError(t, err)
+		m.nowFunc = func() time.Time { return *now }
+		return m, store
+	}
+
+	t.Run("sliding-expiration", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		now := time.Now()
+		m, _ := newManager(t, &now)
+		_, err := m.Create(ctx, nil, claims)
+		assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+
+		s, err := m.Create(ctx, tk, claims)
+		require.NoError(err)
+		assert.Len(s.ID, 43)
+		assert.Equal(now.Add(10*time.Minute), s.ExpiresAt)
+		other, err := m.Create(ctx, tk, claims)
+		require.NoError(err)
+		assert.NotEqual(s.ID, other.ID)
+
+		// every use slides the expiration, up to the max lifetime
+		for i := 0; i < 6; i++ {
+			now = now.Add(9 * time.Minute)
+			got, err := m.Get(ctx, s.ID)
+			require.NoError(err)
+			assert.Equal(claims, got.Claims)
+		}
+		got, err := m.Get(ctx, s.ID)
+		require.NoError(err)
+		assert.Equal(s.CreatedAt.Add(time.Hour), got.ExpiresAt)
+
+		now = now.Add(7 * time.Minute)
+		_, err = m.Get(ctx, s.ID)
+		assert.Truef(errors.Is(err, oidc.ErrExpiredSession), "wanted \"%s\" but got \"%s\"", oidc.ErrExpiredSession, err)
+		_, err = m.Get(ctx, s.ID)
+		assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+	})
+	t.Run("idle-timeout", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		now := time.Now()
+		m, store := newManager(t, &now)
+		s, err := m.Create(ctx, tk, claims)
+		require.NoError(err)
+		now = now.Add(10 * time.Minute)
+		_, err = m.Get(ctx, s.ID)
+		assert.Truef(errors.Is(err, oidc.ErrExpiredSession), "wanted \"%s\" but got \"%s\"", oidc.ErrExpiredSession, err)
+		assert.Equal(0, store.Len())
+	})
+	t.Run("revoke", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		now := time.Now()
+		m, _ := newManager(t, &now)
+		s, err := m.Create(ctx, tk, claims)
+		require.NoError(err)
+		require.NoError(m.Revoke(ctx, s.ID))
+		require.NoError(m.Revoke(ctx, s.ID))
+		_, err = m.Get(ctx, s.ID)
+		assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+		_, err = m.Get(ctx, "")
+		assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+	})
+	t.Run("cookie", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		now := time.Now()
+		m, _ := newManager(t, &now)
+		s, err := m.Create(ctx, tk, claims)
+		require.NoError(err)
+
+		rec := httptest.NewRecorder()
+		require.NoError(m.SetCookie(rec, s))
+		cookies := rec.Result().Cookies()
+		require.Len(cookies, 1)
+		assert.Equal(DefaultCookieName, cookies[0].Name)
+		assert.Equal(s.ID, cookies[0].Value)
+		assert.True(cookies[0].Secure)
+		assert.True(cookies[0].HttpOnly)
+		assert.Equal(http.SameSiteLaxMode, cookies[0].SameSite)
+		err = m.SetCookie(rec, nil)
+		assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		_, err = m.FromRequest(req)
+		assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+		req.AddCookie(cookies[0])
+		got, err := m.FromRequest(req)
+		require.NoError(err)
+		assert.Equal(s.ID, got.ID)
+		_, err = m.FromRequest(nil)
+		assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+
+		rec = httptest.NewRecorder()
+		m.ClearCookie(rec)
+		cookies = rec.Result().Cookies()
+		require.Len(cookies, 1)
+		assert.Equal(-1, cookies[0].MaxAge)
+		assert.Empty(cookies[0].Value)
+	})
+}
+
+func Test_ManagerOptions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	opts := getManagerOpts()
+	assert.Equal(managerDefaults(), opts)
+
+	opts = getManagerOpts(WithIdleTimeout(time.Minute), WithMaxLifetime(time.Hour), WithCookieName("sid"))
+	testOpts := managerDefaults()
+	testOpts.withIdleTimeout = time.Minute
+	testOpts.withMaxLifetime = time.Hour
+	testOpts.withCookieName = "sid"
+	assert.Equal(testOpts, opts)
+}
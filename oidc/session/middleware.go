@@ -0,0 +1,194 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// LoginRequiredError is the error code of a "login required" response (see
+// WriteLoginRequired).
+const LoginRequiredError = "login_required"
+
+// LoginURLFunc returns the URL which starts a login for the request, which is
+// usually the provider's AuthURL(...) for a new oidc.Request that's been
+// written to the callback's request store.
+type LoginURLFunc func(w http.ResponseWriter, req *http.Request) (string, error)
+
+// LoginRequiredProblem is the JSON problem body (see RFC 7807) of a "login
+// required" response for an API route.
+type LoginRequiredProblem struct {
+	// Type is the problem type, which is always "about:blank".
+	Type string `json:"type"`
+
+	// Title is the problem's summary, which is the status's text.
+	Title string `json:"title"`
+
+	// Status is the response's status code.
+	Status int `json:"status"`
+
+	// Detail explains why a login is required.
+	Detail string `json:"detail,omitempty"`
+
+	// Error is the error code, which is always LoginRequiredError.
+	Error string `json:"error"`
+
+	// AuthURL is the URL the user must visit to log in.
+	AuthURL string `json:"auth_url,omitempty"`
+}
+
+// sessionKey is the request context key of the session loaded by
+// RequireSession.
+type sessionKey struct{}
+
+// FromContext returns the session loaded by the RequireSession middleware,
+// and false when the context doesn't have one.
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*Session)
+	return s, ok && s != nil
+}
+
+// RequireSession creates a middleware which requires the request to have a
+// valid session (see FromRequest).  The session is added to the context of
+// the request passed to the next handler (see FromContext).
+//
+// When the request doesn't have a valid session, a login is required and the
+// login func is called for the URL which starts it.  By default, the user is
+// redirected to the URL, which is the right response for a browser route.
+// API routes should use the WithAPIResponse option, so their clients receive
+// a 401 response (see WriteLoginRequired) instead of a redirect they can't
+// follow.  Since the option is provided per middleware, each route can select
+// its response.
+//
+// Supported options: WithAPIResponse, WithRealm
+func (m *Manager) RequireSession(login LoginURLFunc, opt ...oidc.Option) (func(http.Handler) http.Handler, error) {
+	const op = "Manager.RequireSession"
+	if login == nil {
+		return nil, fmt.Errorf("%s: login func is nil: %w", op, oidc.ErrNilParameter)
+	}
+	opts := getMiddlewareOpts(opt...)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			s, err := m.FromRequest(req)
+			switch {
+			case err == nil:
+				next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), sessionKey{}, s)))
+				return
+			case !errors.Is(err, oidc.ErrNotFound) && !errors.Is(err, oidc.ErrExpiredSession):
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			authURL, loginErr := login(w, req)
+			if loginErr != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if !opts.withAPIResponse {
+				http.Redirect(w, req, authURL, http.StatusFound)
+				return
+			}
+			wOpts := []oidc.Option{WithRealm(opts.withRealm)}
+			if errors.Is(err, oidc.ErrExpiredSession) {
+				wOpts = append(wOpts, withSessionExpired())
+			}
+			WriteLoginRequired(w, authURL, wOpts...)
+		})
+	}, nil
+}
+
+// WriteLoginRequired writes a "login required" response for an API route:
+// a 401 Unauthorized with an RFC 6750 style WWW-Authenticate header and a
+// JSON problem body (see LoginRequiredProblem) with the authURL the client
+// should send the user to.
+//
+// Supported options: WithRealm
+//
+// See: https://tools.ietf.org/html/rfc6750#section-3
+func WriteLoginRequired(w http.ResponseWriter, authURL string, opt ...oidc.Option) {
+	opts := getMiddlewareOpts(opt...)
+	detail := "a login is required"
+	var challenge []string
+	if opts.withRealm != "" {
+		challenge = append(challenge, fmt.Sprintf("realm=%q", opts.withRealm))
+	}
+	if opts.withSessionExpired {
+		// the client presented a credential (the session), so the challenge
+		// has an error code
+		detail = "the session is expired and a login is required"
+		challenge = append(challenge, `error="invalid_token"`, fmt.Sprintf("error_description=%q", detail))
+	}
+	w.Header().Set("WWW-Authenticate", strings.TrimSpace("Bearer "+strings.Join(challenge, ", ")))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusUnauthorized)
+	_ = json.NewEncoder(w).Encode(LoginRequiredProblem{
+		Type:    "about:blank",
+		Title:   http.StatusText(http.StatusUnauthorized),
+		Status:  http.StatusUnauthorized,
+		Detail:  detail,
+		Error:   LoginRequiredError,
+		AuthURL: authURL,
+	})
+}
+
+// middlewareOptions is the set of available options for RequireSession and
+// WriteLoginRequired
+type middlewareOptions struct {
+	withAPIResponse    bool
+	withRealm          string
+	withSessionExpired bool
+}
+
+// middlewareDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func middlewareDefaults() middlewareOptions {
+	return middlewareOptions{}
+}
+
+// getMiddlewareOpts gets the middleware defaults and applies the opt overrides
+// passed in
+func getMiddlewareOpts(opt ...oidc.Option) middlewareOptions {
+	opts := middlewareDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithAPIResponse provides an optional "login required" response for API
+// routes, which responds with a 401 Unauthorized (see WriteLoginRequired)
+// instead of redirecting to the login URL.
+//
+// Valid for: Manager.RequireSession
+func WithAPIResponse() oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*middlewareOptions); ok {
+			o.withAPIResponse = true
+		}
+	}
+}
+
+// WithRealm provides an optional realm for the WWW-Authenticate header of a
+// "login required" response.
+//
+// Valid for: Manager.RequireSession and WriteLoginRequired
+func WithRealm(realm string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*middlewareOptions); ok {
+			o.withRealm = realm
+		}
+	}
+}
+
+// withSessionExpired provides an optional "login required" response for an
+// expired session.
+func withSessionExpired() oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*middlewareOptions); ok {
+			o.withSessionExpired = true
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_RequireSession(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const authURL = "https://idp.example.com/authorize?state=st_1"
+
+	now := time.Now()
+	m, err := NewManager(NewMemoryStore())
+	require.NoError(t, err)
+	m.nowFunc = func() time.Time { return now }
+	tk, err := oidc.NewToken("id-token", nil)
+	require.NoError(t, err)
+	valid, err := m.Create(ctx, tk, map[string]interface{}{"sub": "alice"})
+	require.NoError(t, err)
+	expired, err := m.Create(ctx, tk, map[string]interface{}{"sub": "bob"})
+	require.NoError(t, err)
+	expired.ExpiresAt = now.Add(-time.Minute)
+	require.NoError(t, m.store.Write(ctx, expired))
+
+	login := func(http.ResponseWriter, *http.Request) (string, error) { return authURL, nil }
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s, ok := FromContext(req.Context())
+		require.True(t, ok)
+		_, _ = w.Write([]byte(s.Claims["sub"].(string)))
+	})
+	newReq := func(s *Session) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/api/resource", nil)
+		if s != nil {
+			req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: s.ID})
+		}
+		return req
+	}
+
+	tests := []struct {
+		name          string
+		login         LoginURLFunc
+		opt           []oidc.Option
+		session       *Session
+		wantStatus    int
+		wantBody      string
+		wantLocation  string
+		wantChallenge string
+		wantDetail    string
+	}{
+		{name: "valid-session", session: valid, wantStatus: http.StatusOK, wantBody: "alice"},
+		{name: "browser-missing-session", wantStatus: http.StatusFound, wantLocation: authURL},
+		{
+			name:          "api-missing-session",
+			opt:           []oidc.Option{WithAPIResponse(), WithRealm("example")},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer realm="example"`,
+			wantDetail:    "a login is required",
+		},
+		{
+			name:          "api-missing-session-without-realm",
+			opt:           []oidc.Option{WithAPIResponse()},
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: "Bearer",
+			wantDetail:    "a login is required",
+		},
+		{
+			name:          "api-expired-session",
+			opt:           []oidc.Option{WithAPIResponse()},
+			session:       expired,
+			wantStatus:    http.StatusUnauthorized,
+			wantChallenge: `Bearer error="invalid_token", error_description="the session is expired and a login is required"`,
+			wantDetail:    "the session is expired and a login is required",
+		},
+		{
+			name:       "login-error",
+			login:      func(http.ResponseWriter, *http.Request) (string, error) { return "", errors.New("login error") },
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			l := login
+			if tt.login != nil {
+				l = tt.login
+			}
+			mw, err := m.RequireSession(l, tt.opt...)
+			require.NoError(err)
+			w := httptest.NewRecorder()
+			mw(next).ServeHTTP(w, newReq(tt.session))
+			assert.Equal(tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(tt.wantBody, w.Body.String())
+			}
+			if tt.wantLocation != "" {
+				assert.Equal(tt.wantLocation, w.Header().Get("Location"))
+			}
+			if tt.wantChallenge == "" {
+				assert.Empty(w.Header().Get("WWW-Authenticate"))
+				return
+			}
+			assert.Equal(tt.wantChallenge, w.Header().Get("WWW-Authenticate"))
+			assert.Equal("application/problem+json", w.Header().Get("Content-Type"))
+			assert.Equal("no-store", w.Header().Get("Cache-Control"))
+			var problem LoginRequiredProblem
+			require.NoError(json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(LoginRequiredProblem{
+				Type:    "about:blank",
+				Title:   "Unauthorized",
+				Status:  http.StatusUnauthorized,
+				Detail:  tt.wantDetail,
+				Error:   LoginRequiredError,
+				AuthURL: authURL,
+			}, problem)
+		})
+	}
+	t.Run("nil-login", func(t *testing.T) {
+		_, err := m.RequireSession(nil)
+		assert.Truef(t, errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+	})
+}
+
+func TestFromContext(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	_, ok := FromContext(context.Background())
+	assert.False(ok)
+	s := &Session{ID: "s1"}
+	got, ok := FromContext(context.WithValue(context.Background(), sessionKey{}, s))
+	assert.True(ok)
+	assert.Equal(s, got)
+}
@@ -0,0 +1,190 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// Session is a logged in user's server-side session.
+type Session struct {
+	// ID is the session's opaque reference ID, which is sent to the user's
+	// browser.
+	ID string
+
+	// Token is the user's verified oidc.Token.
+	Token oidc.Token
+
+	// Claims are the user's verified claims (typically from the id_token).
+	Claims map[string]interface{}
+
+	// CreatedAt is when the session was created.
+	CreatedAt time.Time
+
+	// ExpiresAt is when the session expires, unless it's used before then.
+	ExpiresAt time.Time
+}
+
+// Expired returns true when the session is expired at the time now.
+func (s *Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// Store defines an interface for persisting Sessions, which allows a Manager
+// to use any backend (redis, a database, etc).
+//
+// Implementations must be concurrently safe.
+type Store interface {
+	// Read an existing Session for the ID.  If a Session is not found for
+	// the ID, then an error wrapping oidc.ErrNotFound is returned.
+	Read(ctx context.Context, id string) (*Session, error)
+
+	// Write the Session, replacing any existing Session with the same ID.
+	Write(ctx context.Context, s *Session) error
+
+	// Touch updates the expiration of an existing Session for the ID.  It
+	// must not create a Session, so a Session that's deleted (revoked) while
+	// it's being used stays deleted.  If a Session is not found for the ID,
+	// then an error wrapping oidc.ErrNotFound is returned.
+	Touch(ctx context.Context, id string, expiresAt time.Time) error
+
+	// Delete the Session for the ID.  It's not an error to delete an ID that
+	// doesn't exist.
+	Delete(ctx context.Context, id string) error
+}
+
+// Finder defines an optional interface for a Store which can find sessions by
+// their claims, which is required to log out the sessions of a provider's
+// back-channel logout (see Manager.Logout).
+//
+// Implementations must be concurrently safe.
+type Finder interface {
+	// Find the sessions whose claims match the issuer (iss), the provider's
+	// session ID (sid) and the subject (sub).  Empty arguments match every
+	// session, but at least one of sid and sub is provided.  It's not an
+	// error when no sessions are found.
+	Find(ctx context.Context, iss, sid, sub string) ([]*Session, error)
+}
+
+// MemoryStore implements the Store interface using an in-memory map.  Expired
+// sessions are removed by a Manager when they're used, or by calling
+// DeleteExpired.  It is concurrently safe.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+// ensure that MemoryStore implements the Store and Finder interfaces.
+var (
+	_ Store  = (*MemoryStore)(nil)
+	_ Finder = (*MemoryStore)(nil)
+)
+
+// NewMemoryStore creates a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: map[string]Session{},
+	}
+}
+
+// Read implements the Store.Read() interface function.
+func (s *MemoryStore) Read(_ context.Context, id string) (*Session, error) {
+	const op = "MemoryStore.Read"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: session not found: %w", op, oidc.ErrNotFound)
+	}
+	return &sess, nil
+}
+
+// Write implements the Store.Write() interface function.
+func (s *MemoryStore) Write(_ context.Context, sess *Session) error {
+	const op = "MemoryStore.Write"
+	switch {
+	case sess == nil:
+		return fmt.Errorf("%s: session is nil: %w", op, oidc.ErrNilParameter)
+	case sess.ID == "":
+		return fmt.Errorf("%s: session ID is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sess.ID] = *sess
+	return nil
+}
+
+// Touch implements the Store.Touch() interface function.
+func (s *MemoryStore) Touch(_ context.Context, id string, expiresAt time.Time) error {
+	const op = "MemoryStore.Touch"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return fmt.Errorf("%s: session not found: %w", op, oidc.ErrNotFound)
+	}
+	sess.ExpiresAt = expiresAt
+	s.sessions[id] = sess
+	return nil
+}
+
+// Delete implements the Store.Delete() interface function.
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// Find implements the Finder.Find() interface function.
+func (s *MemoryStore) Find(_ context.Context, iss, sid, sub string) ([]*Session, error) {
+	const op = "MemoryStore.Find"
+	if sid == "" && sub == "" {
+		return nil, fmt.Errorf("%s: sid and sub are empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var found []*Session
+	for _, sess := range s.sessions {
+		if claimMatches(sess.Claims, "iss", iss) && claimMatches(sess.Claims, "sid", sid) && claimMatches(sess.Claims, "sub", sub) {
+			sess := sess
+			found = append(found, &sess)
+		}
+	}
+	return found, nil
+}
+
+// claimMatches returns true when the value is empty or equal to the claim's
+// string value.
+func claimMatches(claims map[string]interface{}, claim, value string) bool {
+	if value == "" {
+		return true
+	}
+	v, ok := claims[claim].(string)
+	return ok && v == value
+}
+
+// DeleteExpired removes the sessions which are expired at the time now, and
+// returns the number removed.
+func (s *MemoryStore) DeleteExpired(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int
+	for id, sess := range s.sessions {
+		if sess.Expired(now) {
+			delete(s.sessions, id)
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of sessions in the store.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.sessions)
+}
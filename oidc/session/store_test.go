@@ -0,0 +1,100 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	now := time.Now()
+	tk, err := oidc.NewToken("id-token", nil)
+	require.NoError(err)
+	s := NewMemoryStore()
+
+	_, err = s.Read(ctx, "s1")
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+	err = s.Write(ctx, nil)
+	assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+	err = s.Write(ctx, &Session{})
+	assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+	err = s.Touch(ctx, "s1", now)
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+	s1 := &Session{ID: "s1", Token: tk, CreatedAt: now, ExpiresAt: now.Add(time.Minute)}
+	require.NoError(s.Write(ctx, s1))
+	require.NoError(s.Write(ctx, &Session{ID: "s2", Token: tk, CreatedAt: now, ExpiresAt: now.Add(time.Hour)}))
+	got, err := s.Read(ctx, "s1")
+	require.NoError(err)
+	assert.Equal(s1, got)
+
+	// the store keeps a copy of the session
+	got.ExpiresAt = now
+	got, err = s.Read(ctx, "s1")
+	require.NoError(err)
+	assert.Equal(now.Add(time.Minute), got.ExpiresAt)
+
+	require.NoError(s.Touch(ctx, "s1", now.Add(2*time.Minute)))
+	got, err = s.Read(ctx, "s1")
+	require.NoError(err)
+	assert.Equal(now.Add(2*time.Minute), got.ExpiresAt)
+
+	assert.Equal(2, s.Len())
+	assert.Equal(1, s.DeleteExpired(now.Add(3*time.Minute)))
+	assert.Equal(1, s.Len())
+	_, err = s.Read(ctx, "s1")
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+	require.NoError(s.Delete(ctx, "s2"))
+	require.NoError(s.Delete(ctx, "s2"))
+	assert.Equal(0, s.Len())
+}
+
+func TestMemoryStore_Find(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	tk, err := oidc.NewToken("id-token", nil)
+	require.NoError(err)
+	s := NewMemoryStore()
+	for id, claims := range map[string]map[string]interface{}{
+		"s1": {"iss": "https://idp-1", "sub": "alice", "sid": "sid-1"},
+		"s2": {"iss": "https://idp-1", "sub": "alice", "sid": "sid-2"},
+		"s3": {"iss": "https://idp-1", "sub": "bob", "sid": "sid-3"},
+		"s4": {"iss": "https://idp-2", "sub": "alice", "sid": "sid-1"},
+		"s5": nil,
+	} {
+		require.NoError(s.Write(ctx, &Session{ID: id, Token: tk, Claims: claims}))
+	}
+	ids := func(sessions []*Session) []string {
+		var ids []string
+		for _, sess := range sessions {
+			ids = append(ids, sess.ID)
+		}
+		return ids
+	}
+
+	got, err := s.Find(ctx, "https://idp-1", "sid-1", "")
+	require.NoError(err)
+	assert.ElementsMatch([]string{"s1"}, ids(got))
+	got, err = s.Find(ctx, "https://idp-1", "", "alice")
+	require.NoError(err)
+	assert.ElementsMatch([]string{"s1", "s2"}, ids(got))
+	got, err = s.Find(ctx, "", "", "alice")
+	require.NoError(err)
+	assert.ElementsMatch([]string{"s1", "s2", "s4"}, ids(got))
+	got, err = s.Find(ctx, "https://idp-1", "sid-1", "bob")
+	require.NoError(err)
+	assert.Empty(got)
+
+	_, err = s.Find(ctx, "https://idp-1", "", "")
+	assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+}
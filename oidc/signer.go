@@ -0,0 +1,190 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// JWTSigner signs JWTs (like private_key_jwt client assertions) using a
+// crypto.Signer, which allows the RP's keys to live in an HSM, a cloud KMS or
+// Vault's transit secrets engine rather than in process memory.  Any
+// crypto.Signer whose public key is an RSA, ECDSA or Ed25519 key can be used,
+// including the standard library's private keys.
+//
+// A JWTSigner is safe for concurrent use if its crypto.Signer is.
+type JWTSigner struct {
+	signer crypto.Signer
+	alg    Alg
+	keyID  string
+}
+
+// NewJWTSigner creates a new JWTSigner for the signer, which signs using the
+// alg.  The keyID is optional and is included as the "kid" header of every
+// signed JWT, which should match the key's ID in the RP's published JWKS (see
+// JWKSPublisher).
+func NewJWTSigner(signer crypto.Signer, alg Alg, keyID string) (*JWTSigner, error) {
+	const op = "NewJWTSigner"
+	if signer == nil {
+		return nil, fmt.Errorf("%s: signer is nil: %w", op, ErrNilParameter)
+	}
+	if err := validSignerAlg(signer.Public(), alg); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &JWTSigner{
+		signer: signer,
+		alg:    alg,
+		keyID:  keyID,
+	}, nil
+}
+
+// Alg returns the signer's signing algorithm.
+func (s *JWTSigner) Alg() Alg { return s.alg }
+
+// KeyID returns the signer's optional key ID.
+func (s *JWTSigner) KeyID() string { return s.keyID }
+
+// Public returns the signer's public key.
+func (s *JWTSigner) Public() crypto.PublicKey { return s.signer.Public() }
+
+// SignJWT returns a compact serialized JWT with the claims, which must be
+// able to be marshaled as a JSON object.
+func (s *JWTSigner) SignJWT(claims interface{}) (string, error) {
+	const op = "JWTSigner.SignJWT"
+	opts := (&jose.SignerOptions{}).WithType("JWT")
+	if s.keyID != "" {
+		opts = opts.WithHeader("kid", s.keyID)
+	}
+	sig, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.SignatureAlgorithm(s.alg), Key: &opaqueSigner{signer: s.signer, alg: s.alg}},
+		opts,
+	)
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to create signer: %w", op, err)
+	}
+	raw, err := jwt.Signed(sig).Claims(claims).CompactSerialize()
+	if err != nil {
+		return "", fmt.Errorf("%s: unable to sign jwt: %w", op, err)
+	}
+	return raw, nil
+}
+
+// validSignerAlg verifies that the alg can be used with the public key.
+func validSignerAlg(pub crypto.PublicKey, alg Alg) error {
+	const op = "validSignerAlg"
+	if !supportedAlgorithms[alg] {
+		return fmt.Errorf("%s: %s is not a supported algorithm: %w", op, alg, ErrUnsupportedAlg)
+	}
+	var ok bool
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case RS256, RS384, RS512, PS256, PS384, PS512:
+			ok = true
+		}
+	case *ecdsa.PublicKey:
+		switch alg {
+		case ES256:
+			ok = k.Curve.Params().BitSize == 256
+		case ES384:
+			ok = k.Curve.Params().BitSize == 384
+		case ES512:
+			ok = k.Curve.Params().BitSize == 521
+		}
+	case ed25519.PublicKey:
+		ok = alg == EdDSA
+	default:
+		return fmt.Errorf("%s: unsupported public key type %T: %w", op, pub, ErrInvalidParameter)
+	}
+	if !ok {
+		return fmt.Errorf("%s: %s can't be used with the signer's %T: %w", op, alg, pub, ErrUnsupportedAlg)
+	}
+	return nil
+}
+
+// opaqueSigner adapts a crypto.Signer to go-jose's OpaqueSigner interface, so
+// JWTs can be signed without access to the private key.
+type opaqueSigner struct {
+	signer crypto.Signer
+	alg    Alg
+}
+
+// ensure that opaqueSigner implements the jose.OpaqueSigner interface.
+var _ jose.OpaqueSigner = (*opaqueSigner)(nil)
+
+// Public satisfies the jose.OpaqueSigner interface.
+func (s *opaqueSigner) Public() *jose.JSONWebKey {
+	return &jose.JSONWebKey{Key: s.signer.Public(), Algorithm: string(s.alg), Use: "sig"}
+}
+
+// Algs satisfies the jose.OpaqueSigner interface.
+func (s *opaqueSigner) Algs() []jose.SignatureAlgorithm {
+	return []jose.SignatureAlgorithm{jose.SignatureAlgorithm(s.alg)}
+}
+
+// SignPayload satisfies the jose.OpaqueSigner interface.
+func (s *opaqueSigner) SignPayload(payload []byte, alg jose.SignatureAlgorithm) ([]byte, error) {
+	const op = "opaqueSigner.SignPayload"
+	if Alg(alg) != s.alg {
+		return nil, fmt.Errorf("%s: %s is not the signer's algorithm: %w", op, alg, ErrUnsupportedAlg)
+	}
+	var hash crypto.Hash
+	switch s.alg {
+	case RS256, ES256, PS256:
+		hash = crypto.SHA256
+	case RS384, ES384, PS384:
+		hash = crypto.SHA384
+	case RS512, ES512, PS512:
+		hash = crypto.SHA512
+	case EdDSA:
+		// Ed25519 signs the message itself, rather than its digest
+		return s.signer.Sign(rand.Reader, payload, crypto.Hash(0))
+	default:
+		return nil, fmt.Errorf("%s: %s is not a supported algorithm: %w", op, alg, ErrUnsupportedAlg)
+	}
+	h := hash.New()
+	_, _ = h.Write(payload)
+	digest := h.Sum(nil)
+
+	var opts crypto.SignerOpts = hash
+	switch s.alg {
+	case PS256, PS384, PS512:
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	}
+	sig, err := s.signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if pub, ok := s.signer.Public().(*ecdsa.PublicKey); ok {
+		// crypto.Signers return ASN.1 encoded ECDSA signatures, but JWS
+		// signatures are the fixed size concatenation of r and s.
+		// See: https://tools.ietf.org/html/rfc7518#section-3.4
+		return ecdsaJWSSignature(pub, sig)
+	}
+	return sig, nil
+}
+
+// ecdsaJWSSignature converts an ASN.1 encoded ECDSA signature into a JWS
+// signature.
+func ecdsaJWSSignature(pub *ecdsa.PublicKey, sig []byte) ([]byte, error) {
+	const op = "ecdsaJWSSignature"
+	var parsed struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(sig, &parsed); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse signature: %s: %w", op, err, ErrInvalidSignature)
+	}
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	out := make([]byte, 2*size)
+	parsed.R.FillBytes(out[:size])
+	parsed.S.FillBytes(out[size:])
+	return out, nil
+}
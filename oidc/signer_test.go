@@ -0,0 +1,116 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// testKMSSigner is a crypto.Signer which hides its private key, like a key
+// backed by an HSM or KMS.
+type testKMSSigner struct {
+	signer crypto.Signer
+}
+
+func (s *testKMSSigner) Public() crypto.PublicKey { return s.signer.Public() }
+
+func (s *testKMSSigner) Sign(r io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(r, digest, opts)
+}
+
+func TestJWTSigner_SignJWT(t *testing.T) {
+	t.Parallel()
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		signer crypto.Signer
+		alg    Alg
+	}{
+		{"ES256", p256, ES256},
+		{"ES384", p384, ES384},
+		{"ES512", p521, ES512},
+		{"RS256", rsaKey, RS256},
+		{"RS512", rsaKey, RS512},
+		{"PS256", rsaKey, PS256},
+		{"PS384", rsaKey, PS384},
+		{"EdDSA", edKey, EdDSA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			s, err := NewJWTSigner(&testKMSSigner{signer: tt.signer}, tt.alg, "key-1")
+			require.NoError(err)
+			assert.Equal(tt.alg, s.Alg())
+			assert.Equal("key-1", s.KeyID())
+			assert.Equal(tt.signer.Public(), s.Public())
+
+			raw, err := s.SignJWT(map[string]interface{}{"sub": "alice"})
+			require.NoError(err)
+			jws, err := jose.ParseSigned(raw)
+			require.NoError(err)
+			assert.Equal("key-1", jws.Signatures[0].Header.KeyID)
+			assert.Equal(string(tt.alg), jws.Signatures[0].Header.Algorithm)
+			payload, err := jws.Verify(tt.signer.Public())
+			require.NoError(err)
+			assert.JSONEq(`{"sub":"alice"}`, string(payload))
+
+			// the test helpers accept a crypto.Signer as well
+			raw = TestSignJWT(t, &testKMSSigner{signer: tt.signer}, tt.alg, map[string]interface{}{"sub": "alice"}, nil)
+			jws, err = jose.ParseSigned(raw)
+			require.NoError(err)
+			_, err = jws.Verify(tt.signer.Public())
+			require.NoError(err)
+		})
+	}
+}
+
+func TestNewJWTSigner(t *testing.T) {
+	t.Parallel()
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tests := []struct {
+		name      string
+		signer    crypto.Signer
+		alg       Alg
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "valid", signer: p256, alg: ES256},
+		{name: "nil-signer", alg: ES256, wantErr: true, wantIsErr: ErrNilParameter},
+		{name: "unsupported-alg", signer: p256, alg: "HS256", wantErr: true, wantIsErr: ErrUnsupportedAlg},
+		{name: "alg-key-mismatch", signer: p256, alg: RS256, wantErr: true, wantIsErr: ErrUnsupportedAlg},
+		{name: "alg-curve-mismatch", signer: p256, alg: ES384, wantErr: true, wantIsErr: ErrUnsupportedAlg},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			_, err := NewJWTSigner(tt.signer, tt.alg, "")
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package oidc
+
+// userInfoSigningAlgs returns the supported signing algorithms for signed
+// userinfo responses.
+func (c *Config) userInfoSigningAlgs() []Alg {
+	if len(c.UserInfoSigningAlgs) > 0 {
+		return c.UserInfoSigningAlgs
+	}
+	return c.SupportedSigningAlgs
+}
+
+// logoutTokenSigningAlgs returns the supported signing algorithms for
+// back-channel logout tokens.
+func (c *Config) logoutTokenSigningAlgs() []Alg {
+	if len(c.LogoutTokenSigningAlgs) > 0 {
+		return c.LogoutTokenSigningAlgs
+	}
+	return c.SupportedSigningAlgs
+}
+
+// copyAlgs returns a copy of the algs or nil if the algs are nil.
+func copyAlgs(algs []Alg) []Alg {
+	if algs == nil {
+		return nil
+	}
+	cp := make([]Alg, len(algs))
+	copy(cp, algs)
+	return cp
+}
+
+// containsAlg returns true when the alg is one of the algs.
+func containsAlg(algs []Alg, alg Alg) bool {
+	for _, a := range algs {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// WithUserInfoSigningAlgs provides an optional list of supported signing
+// algorithms for signed userinfo responses (see Config.UserInfoSigningAlgs).
+//
+// Valid for: Config
+func WithUserInfoSigningAlgs(alg ...Alg) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withUserInfoSigningAlgs = alg
+		}
+	}
+}
+
+// WithLogoutTokenSigningAlgs provides an optional list of supported signing
+// algorithms for back-channel logout tokens (see
+// Config.LogoutTokenSigningAlgs).
+//
+// Valid for: Config
+func WithLogoutTokenSigningAlgs(alg ...Alg) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*configOptions); ok {
+			o.withLogoutTokenSigningAlgs = alg
+		}
+	}
+}
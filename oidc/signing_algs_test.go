@@ -0,0 +1,146 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestConfig_signingAlgs(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	redirect := []string{"https://example.com/callback"}
+
+	c, err := NewConfig("https://example.com", "client-id", "secret", []Alg{RS256}, redirect)
+	require.NoError(err)
+	assert.Equal([]Alg{RS256}, c.userInfoSigningAlgs())
+	assert.Equal([]Alg{RS256}, c.logoutTokenSigningAlgs())
+
+	c, err = NewConfig("https://example.com", "client-id", "secret", []Alg{RS256}, redirect,
+		WithUserInfoSigningAlgs(ES256, PS256),
+		WithLogoutTokenSigningAlgs(EdDSA),
+	)
+	require.NoError(err)
+	assert.Equal([]Alg{ES256, PS256}, c.userInfoSigningAlgs())
+	assert.Equal([]Alg{EdDSA}, c.logoutTokenSigningAlgs())
+
+	cp := c.copy()
+	cp.UserInfoSigningAlgs[0] = RS512
+	cp.LogoutTokenSigningAlgs[0] = RS512
+	assert.Equal([]Alg{ES256, PS256}, c.UserInfoSigningAlgs)
+	assert.Equal([]Alg{EdDSA}, c.LogoutTokenSigningAlgs)
+
+	_, err = NewConfig("https://example.com", "client-id", "secret", []Alg{RS256}, redirect, WithUserInfoSigningAlgs("HS256"))
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	_, err = NewConfig("https://example.com", "client-id", "secret", []Alg{RS256}, redirect, WithLogoutTokenSigningAlgs("none"))
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+}
+
+func TestProvider_signedUserInfo(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	const clientID, clientSecret = "test-client-id", "test-client-secret"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetSignUserInfo(true)
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{
+		AccessToken: "dummy_access_token",
+		Expiry:      time.Now().Add(10 * time.Second),
+	})
+
+	tests := []struct {
+		name      string
+		algs      []Alg
+		aud       interface{}
+		wantIsErr error
+	}{
+		{name: "valid", aud: clientID},
+		{name: "valid-without-aud"},
+		{name: "valid-with-userinfo-algs", algs: []Alg{RS256, ES256}, aud: []string{clientID, "other"}},
+		{name: "unsupported-alg", algs: []Alg{RS256}, wantIsErr: ErrUnsupportedAlg},
+		{name: "wrong-aud", aud: "other", wantIsErr: ErrInvalidAudience},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			c := testNewConfig(t, clientID, clientSecret, redirect, tp)
+			c.UserInfoSigningAlgs = tt.algs
+			p, err := NewProvider(c)
+			require.NoError(err)
+			defer p.Done()
+
+			reply := map[string]interface{}{"sub": "alice", "iss": tp.Addr(), "email": "alice@example.com"}
+			if tt.aud != nil {
+				reply["aud"] = tt.aud
+			}
+			tp.SetUserInfoReply(reply)
+
+			resp, err := p.RawUserInfo(ctx, tokenSource, "alice")
+			if tt.wantIsErr != nil {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal("application/jwt", resp.ContentType)
+			assert.NotEmpty(resp.JWT)
+			var claims map[string]interface{}
+			require.NoError(json.Unmarshal(resp.Body, &claims))
+			assert.Equal("alice@example.com", claims["email"])
+		})
+	}
+}
+
+func TestProvider_VerifyLogoutToken_signingAlgs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	priv, _, alg, _ := tp.SigningKeys()
+	token := TestSignJWT(t, priv, alg, map[string]interface{}{
+		"iss":    tp.Addr(),
+		"aud":    "test-client-id",
+		"iat":    time.Now().Unix(),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+		"jti":    "test-jti",
+		"sid":    "test-sid",
+		"events": map[string]interface{}{BackChannelLogoutEvent: map[string]interface{}{}},
+	}, nil)
+
+	tests := []struct {
+		name       string
+		idTokenAlg Alg
+		logoutAlgs []Alg
+		wantErr    bool
+	}{
+		{name: "id-token-algs", idTokenAlg: alg},
+		{name: "logout-token-algs", idTokenAlg: RS256, logoutAlgs: []Alg{alg}},
+		{name: "unsupported-logout-token-alg", idTokenAlg: alg, logoutAlgs: []Alg{RS256}, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			c := testNewConfig(t, "test-client-id", "test-client-secret", "https://example.com/callback", tp)
+			c.SupportedSigningAlgs = []Alg{tt.idTokenAlg}
+			c.LogoutTokenSigningAlgs = tt.logoutAlgs
+			p, err := NewProvider(c)
+			require.NoError(err)
+			defer p.Done()
+
+			lt, err := p.VerifyLogoutToken(ctx, token)
+			if tt.wantErr {
+				assert.Error(err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal("test-sid", lt.SessionID)
+		})
+	}
+}
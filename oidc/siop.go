@@ -0,0 +1,303 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/hashicorp/cap/oidc/internal/strutils"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// SelfIssuedAuthEndpoint is the default authorization endpoint of a
+// Self-Issued OpenID Provider (SIOP), which is the End-User's wallet that's
+// registered to handle the openid: scheme.
+//
+// See: https://openid.net/specs/openid-connect-self-issued-v2-1_0.html
+const SelfIssuedAuthEndpoint = "openid://"
+
+// SelfIssuedIssuerV1 is the issuer (iss) of id_tokens from a SIOPv1 provider.
+// The issuer of id_tokens from a SIOPv2 provider is equal to their subject.
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#SelfIssued
+const SelfIssuedIssuerV1 = "https://self-issued.me"
+
+// jwkThumbprintURIPrefix is the prefix of a SIOPv2 subject which is the
+// thumbprint of its sub_jwk.  See: https://tools.ietf.org/html/rfc9278
+const jwkThumbprintURIPrefix = "urn:ietf:params:oauth:jwk-thumbprint:sha-256:"
+
+// selfIssuedIssuedAtSkew is the allowed clock skew of an id_token's iat claim,
+// since a self-issued id_token is signed by the End-User's device.
+const selfIssuedIssuedAtSkew = time.Minute
+
+// DIDResolver resolves the public keys of Decentralized Identifiers (DIDs),
+// which are used to verify self-issued id_tokens whose subject is a DID.
+//
+// See: https://www.w3.org/TR/did-core/
+type DIDResolver interface {
+	// ResolveKey returns the DID's public key for the kid (the id_token's key
+	// ID), which is usually a DID URL (like did:example:123#key-1).
+	ResolveKey(ctx context.Context, did string, kid string) (crypto.PublicKey, error)
+}
+
+// SelfIssuedAuthURL will generate a URL the caller can use to kick off an
+// authentication request with a Self-Issued OpenID Provider (SIOP), like the
+// End-User's wallet.  Since a SIOP isn't discovered, no Provider is needed and
+// the relying party's client_id is the Request's RedirectURL().  The request
+// uses the implicit flow (an id_token response type), and the Request's
+// ResponseMode() is used when it has one.
+//
+// See VerifySelfIssuedIDToken(...) to verify the id_token in the response.
+//
+// Supported options: WithSelfIssuedAuthEndpoint, WithClientMetadata
+//
+// See: https://openid.net/specs/openid-connect-self-issued-v2-1_0.html#name-self-issued-openid-provider-a
+func SelfIssuedAuthURL(oidcRequest Request, opt ...Option) (string, error) {
+	const op = "SelfIssuedAuthURL"
+	if oidcRequest == nil {
+		return "", fmt.Errorf("%s: request is nil: %w", op, ErrNilParameter)
+	}
+	if oidcRequest.State() == "" {
+		return "", fmt.Errorf("%s: request id is empty: %w", op, ErrInvalidParameter)
+	}
+	if oidcRequest.Nonce() == "" {
+		return "", fmt.Errorf("%s: request nonce is empty: %w", op, ErrInvalidParameter)
+	}
+	if oidcRequest.RedirectURL() == "" {
+		return "", fmt.Errorf("%s: request redirect URL is empty: %w", op, ErrInvalidParameter)
+	}
+	opts := getSelfIssuedOpts(opt...)
+	if opts.withAuthEndpoint == "" {
+		return "", fmt.Errorf("%s: authorization endpoint is empty: %w", op, ErrInvalidParameter)
+	}
+	scopes := oidcRequest.Scopes()
+	if !strutils.StrListContains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	params := url.Values{
+		"response_type": {"id_token"},
+		"client_id":     {oidcRequest.RedirectURL()},
+		"redirect_uri":  {oidcRequest.RedirectURL()},
+		"scope":         {strings.Join(scopes, " ")},
+		"state":         {oidcRequest.State()},
+		"nonce":         {oidcRequest.Nonce()},
+	}
+	if m := oidcRequest.ResponseMode(); m != "" {
+		params.Set("response_mode", string(m))
+	}
+	if opts.withClientMetadata != nil {
+		metadata, err := json.Marshal(opts.withClientMetadata)
+		if err != nil {
+			return "", fmt.Errorf("%s: unable to encode client metadata: %s: %w", op, err, ErrInvalidParameter)
+		}
+		params.Set("client_metadata", string(metadata))
+	}
+	sep := "?"
+	if strings.Contains(opts.withAuthEndpoint, "?") {
+		sep = "&"
+	}
+	return opts.withAuthEndpoint + sep + params.Encode(), nil
+}
+
+// VerifySelfIssuedIDToken verifies a self-issued id_token, which is signed by
+// the End-User's own key instead of a provider's published keys.  On success,
+// the id_token's claims are returned.
+//
+// The id_token's key is either its sub_jwk claim, in which case its subject
+// must be the key's thumbprint, or its subject must be a Decentralized
+// Identifier (DID) which is resolved by the WithDIDResolver option.
+//
+//  It verifies:
+//   * signature (using the sub_jwk or the subject's DID key)
+//   * issuer (iss) is equal to the subject (SIOPv2) or is
+//     SelfIssuedIssuerV1 (SIOPv1)
+//   * audience (aud) contains the Request's RedirectURL() (its client_id)
+//   * nonce is equal to the Request's Nonce()
+//   * expiration (exp), not before (nbf) and issued at (iat)
+//   * the Request isn't expired
+//
+// Supported options: WithDIDResolver, WithNow
+//
+// See: https://openid.net/specs/openid-connect-self-issued-v2-1_0.html#name-self-issued-id-token-valida
+func VerifySelfIssuedIDToken(ctx context.Context, t IDToken, oidcRequest Request, opt ...Option) (map[string]interface{}, error) {
+	const op = "VerifySelfIssuedIDToken"
+	if t == "" {
+		return nil, fmt.Errorf("%s: id_token is empty: %w", op, ErrInvalidParameter)
+	}
+	if len(t) > MaxTokenSize {
+		return nil, fmt.Errorf("%s: id_token is larger than %d bytes: %w", op, MaxTokenSize, ErrMalformedToken)
+	}
+	if oidcRequest == nil {
+		return nil, fmt.Errorf("%s: request is nil: %w", op, ErrNilParameter)
+	}
+	if oidcRequest.IsExpired() {
+		return nil, fmt.Errorf("%s: request is expired: %w", op, ErrExpiredRequest)
+	}
+	opts := getSelfIssuedOpts(opt...)
+
+	jws, err := jose.ParseSigned(string(t))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, err, ErrMalformedToken)
+	}
+	if len(jws.Signatures) != 1 {
+		return nil, fmt.Errorf("%s: id_token must have a single signature: %w", op, ErrMalformedToken)
+	}
+	header := jws.Signatures[0].Header
+	if !supportedAlgorithms[Alg(header.Algorithm)] {
+		return nil, fmt.Errorf("%s: %s is not a supported algorithm: %w", op, header.Algorithm, ErrUnsupportedAlg)
+	}
+
+	// the key is determined by the id_token's unverified claims, and the
+	// claims are only trusted once the signature is verified by the key.
+	var unverified struct {
+		Subject string          `json:"sub"`
+		SubJWK  json.RawMessage `json:"sub_jwk"`
+	}
+	if err := json.Unmarshal(jws.UnsafePayloadWithoutVerification(), &unverified); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse claims: %s: %w", op, err, ErrMalformedToken)
+	}
+	var key interface{}
+	switch {
+	case len(unverified.SubJWK) > 0:
+		var jwk jose.JSONWebKey
+		if err := jwk.UnmarshalJSON(unverified.SubJWK); err != nil {
+			return nil, fmt.Errorf("%s: invalid sub_jwk: %s: %w", op, err, ErrInvalidJWKs)
+		}
+		if !jwk.IsPublic() {
+			return nil, fmt.Errorf("%s: sub_jwk is not a public key: %w", op, ErrInvalidJWKs)
+		}
+		thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unable to compute the sub_jwk thumbprint: %s: %w", op, err, ErrInvalidJWKs)
+		}
+		encoded := base64.RawURLEncoding.EncodeToString(thumbprint)
+		if unverified.Subject != encoded && unverified.Subject != jwkThumbprintURIPrefix+encoded {
+			return nil, fmt.Errorf("%s: subject is not the sub_jwk thumbprint: %w", op, ErrInvalidSubject)
+		}
+		key = jwk.Key
+	case strings.HasPrefix(unverified.Subject, "did:"):
+		if opts.withDIDResolver == nil {
+			return nil, fmt.Errorf("%s: a DID resolver is required to verify a DID subject: %w", op, ErrInvalidParameter)
+		}
+		k, err := opts.withDIDResolver.ResolveKey(ctx, unverified.Subject, header.KeyID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: unable to resolve DID key: %s: %w", op, err, ErrInvalidSignature)
+		}
+		key = k
+	default:
+		return nil, fmt.Errorf("%s: subject is neither a sub_jwk thumbprint nor a DID: %w", op, ErrInvalidSubject)
+	}
+	payload, err := jws.Verify(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, err, ErrInvalidSignature)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse claims: %s: %w", op, err, ErrMalformedToken)
+	}
+	var registered struct {
+		jwt.Claims
+		Nonce string `json:"nonce"`
+	}
+	if err := json.Unmarshal(payload, &registered); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse claims: %s: %w", op, err, ErrMalformedToken)
+	}
+	if registered.Issuer != registered.Subject && registered.Issuer != SelfIssuedIssuerV1 {
+		return nil, fmt.Errorf("%s: issuer %s is neither the subject nor %s: %w", op, registered.Issuer, SelfIssuedIssuerV1, ErrInvalidIssuer)
+	}
+	if !registered.Audience.Contains(oidcRequest.RedirectURL()) {
+		return nil, fmt.Errorf("%s: audience doesn't contain %s: %w", op, oidcRequest.RedirectURL(), ErrInvalidAudience)
+	}
+	if registered.Nonce != oidcRequest.Nonce() {
+		return nil, fmt.Errorf("%s: nonce is not equal to the request's nonce: %w", op, ErrInvalidNonce)
+	}
+
+	now := time.Now()
+	if opts.withNowFunc != nil {
+		now = opts.withNowFunc()
+	}
+	switch {
+	case registered.Expiry == nil:
+		return nil, fmt.Errorf("%s: exp claim is missing: %w", op, ErrMissingClaim)
+	case !now.Before(registered.Expiry.Time()):
+		return nil, fmt.Errorf("%s: id_token expired at %s: %w", op, registered.Expiry.Time(), ErrExpiredToken)
+	case registered.NotBefore != nil && now.Before(registered.NotBefore.Time()):
+		return nil, fmt.Errorf("%s: id_token is not valid before %s: %w", op, registered.NotBefore.Time(), ErrInvalidNotBefore)
+	case registered.IssuedAt == nil:
+		return nil, fmt.Errorf("%s: iat claim is missing: %w", op, ErrMissingClaim)
+	case registered.IssuedAt.Time().After(now.Add(selfIssuedIssuedAtSkew)):
+		return nil, fmt.Errorf("%s: id_token was issued in the future at %s: %w", op, registered.IssuedAt.Time(), ErrInvalidIssuedAt)
+	}
+	return claims, nil
+}
+
+// selfIssuedOptions is the set of available options for the self-issued
+// provider functions
+type selfIssuedOptions struct {
+	withAuthEndpoint   string
+	withClientMetadata map[string]interface{}
+	withDIDResolver    DIDResolver
+	withNowFunc        func() time.Time
+}
+
+// selfIssuedDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func selfIssuedDefaults() selfIssuedOptions {
+	return selfIssuedOptions{
+		withAuthEndpoint: SelfIssuedAuthEndpoint,
+	}
+}
+
+// getSelfIssuedOpts gets the self-issued provider defaults and applies the opt
+// overrides passed in
+func getSelfIssuedOpts(opt ...Option) selfIssuedOptions {
+	opts := selfIssuedDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithSelfIssuedAuthEndpoint provides an optional authorization endpoint for a
+// Self-Issued OpenID Provider, which defaults to SelfIssuedAuthEndpoint.  It
+// allows relying parties to use a wallet's custom scheme or universal link.
+//
+// Valid for: SelfIssuedAuthURL
+func WithSelfIssuedAuthEndpoint(endpoint string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*selfIssuedOptions); ok {
+			o.withAuthEndpoint = endpoint
+		}
+	}
+}
+
+// WithClientMetadata provides the relying party's optional metadata (like its
+// client_name and subject_syntax_types_supported), which is passed by value
+// to a Self-Issued OpenID Provider using the client_metadata parameter.
+//
+// Valid for: SelfIssuedAuthURL
+func WithClientMetadata(metadata map[string]interface{}) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*selfIssuedOptions); ok {
+			o.withClientMetadata = metadata
+		}
+	}
+}
+
+// WithDIDResolver provides an optional DIDResolver, which is required to
+// verify self-issued id_tokens whose subject is a DID.
+//
+// Valid for: VerifySelfIssuedIDToken
+func WithDIDResolver(r DIDResolver) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*selfIssuedOptions); ok {
+			o.withDIDResolver = r
+		}
+	}
+}
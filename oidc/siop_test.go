@@ -0,0 +1,340 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestSelfIssuedAuthURL(t *testing.T) {
+	t.Parallel()
+	redirect := "https://rp.example.com/callback"
+	tests := []struct {
+		name      string
+		req       func() Request
+		opt       []Option
+		wantURL   func() string
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name: "valid",
+			req: func() Request {
+				r, err := NewRequest(time.Minute, redirect, WithState("s"), WithNonce("test-nonce-0123456789abcdef"))
+				require.NoError(t, err)
+				return r
+			},
+			wantURL: func() string {
+				return SelfIssuedAuthEndpoint + "?" + url.Values{
+					"response_type": {"id_token"},
+					"client_id":     {redirect},
+					"redirect_uri":  {redirect},
+					"scope":         {"openid"},
+					"state":         {"s"},
+					"nonce":         {"test-nonce-0123456789abcdef"},
+				}.Encode()
+			},
+		},
+		{
+			name: "valid-with-all-options",
+			req: func() Request {
+				r, err := NewRequest(time.Minute, redirect, WithState("s"), WithNonce("test-nonce-0123456789abcdef"), WithScopes("email"), WithResponseMode(FormPostResponseMode))
+				require.NoError(t, err)
+				return r
+			},
+			opt: []Option{
+				WithSelfIssuedAuthEndpoint("https://wallet.example.com/authorize?tenant=1"),
+				WithClientMetadata(map[string]interface{}{"client_name": "rp"}),
+			},
+			wantURL: func() string {
+				return "https://wallet.example.com/authorize?tenant=1&" + url.Values{
+					"response_type":   {"id_token"},
+					"client_id":       {redirect},
+					"redirect_uri":    {redirect},
+					"scope":           {"openid email"},
+					"state":           {"s"},
+					"nonce":           {"test-nonce-0123456789abcdef"},
+					"response_mode":   {"form_post"},
+					"client_metadata": {`{"client_name":"rp"}`},
+				}.Encode()
+			},
+		},
+		{
+			name:      "nil-request",
+			req:       func() Request { return nil },
+			wantErr:   true,
+			wantIsErr: ErrNilParameter,
+		},
+		{
+			name: "empty-auth-endpoint",
+			req: func() Request {
+				r, err := NewRequest(time.Minute, redirect, WithState("s"), WithNonce("test-nonce-0123456789abcdef"))
+				require.NoError(t, err)
+				return r
+			},
+			opt:       []Option{WithSelfIssuedAuthEndpoint("")},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name: "invalid-client-metadata",
+			req: func() Request {
+				r, err := NewRequest(time.Minute, redirect, WithState("s"), WithNonce("test-nonce-0123456789abcdef"))
+				require.NoError(t, err)
+				return r
+			},
+			opt:       []Option{WithClientMetadata(map[string]interface{}{"bad": make(chan int)})},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := SelfIssuedAuthURL(tt.req(), tt.opt...)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.wantURL(), got)
+		})
+	}
+}
+
+type testDIDResolver struct {
+	keys map[string]crypto.PublicKey
+}
+
+func (r *testDIDResolver) ResolveKey(_ context.Context, did string, _ string) (crypto.PublicKey, error) {
+	k, ok := r.keys[did]
+	if !ok {
+		return nil, fmt.Errorf("unknown did: %s", did)
+	}
+	return k, nil
+}
+
+func TestVerifySelfIssuedIDToken(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redirect := "https://rp.example.com/callback"
+	pub, priv := TestGenerateKeys(t)
+	_, otherPriv := TestGenerateKeys(t)
+
+	jwk := jose.JSONWebKey{Key: pub}
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	require.NoError(t, err)
+	v1Subject := base64.RawURLEncoding.EncodeToString(thumbprint)
+	v2Subject := jwkThumbprintURIPrefix + v1Subject
+	var subJWK map[string]interface{}
+	raw, err := jwk.MarshalJSON()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &subJWK))
+
+	did := "did:example:123"
+	resolver := &testDIDResolver{keys: map[string]crypto.PublicKey{did: pub}}
+
+	req, err := NewRequest(time.Minute, redirect, WithState("s"), WithNonce("test-nonce-0123456789abcdef"))
+	require.NoError(t, err)
+
+	now := time.Now()
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":     v2Subject,
+			"sub":     v2Subject,
+			"sub_jwk": subJWK,
+			"aud":     redirect,
+			"nonce":   "test-nonce-0123456789abcdef",
+			"iat":     float64(now.Unix()),
+			"exp":     float64(now.Add(time.Minute).Unix()),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name      string
+		token     IDToken
+		req       Request
+		opt       []Option
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name:  "valid-v2",
+			token: IDToken(TestSignJWT(t, priv, ES256, claims(nil), nil)),
+			req:   req,
+		},
+		{
+			name:  "valid-v1",
+			token: IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"iss": SelfIssuedIssuerV1, "sub": v1Subject}), nil)),
+			req:   req,
+		},
+		{
+			name:  "valid-did",
+			token: IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"iss": did, "sub": did, "sub_jwk": nil}), nil)),
+			req:   req,
+			opt:   []Option{WithDIDResolver(resolver)},
+		},
+		{
+			name:      "empty-token",
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "nil-request",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(nil), nil)),
+			wantErr:   true,
+			wantIsErr: ErrNilParameter,
+		},
+		{
+			name:      "malformed-token",
+			token:     "not-a-jwt",
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrMalformedToken,
+		},
+		{
+			name:      "did-without-resolver",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"iss": did, "sub": did, "sub_jwk": nil}), nil)),
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "unknown-did",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"iss": "did:example:456", "sub": "did:example:456", "sub_jwk": nil}), nil)),
+			req:       req,
+			opt:       []Option{WithDIDResolver(resolver)},
+			wantErr:   true,
+			wantIsErr: ErrInvalidSignature,
+		},
+		{
+			name:      "subject-not-thumbprint",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"iss": "alice", "sub": "alice"}), nil)),
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrInvalidSubject,
+		},
+		{
+			name:      "missing-key",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"iss": "alice", "sub": "alice", "sub_jwk": nil}), nil)),
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrInvalidSubject,
+		},
+		{
+			name:      "invalid-signature",
+			token:     IDToken(TestSignJWT(t, otherPriv, ES256, claims(nil), nil)),
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrInvalidSignature,
+		},
+		{
+			name:      "invalid-issuer",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"iss": "https://op.example.com"}), nil)),
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrInvalidIssuer,
+		},
+		{
+			name:      "invalid-audience",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"aud": "https://other.example.com"}), nil)),
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrInvalidAudience,
+		},
+		{
+			name:      "invalid-nonce",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"nonce": "other"}), nil)),
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrInvalidNonce,
+		},
+		{
+			name:      "missing-exp",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"exp": nil}), nil)),
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrMissingClaim,
+		},
+		{
+			name:      "expired",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(nil), nil)),
+			req:       req,
+			opt:       []Option{WithNow(func() time.Time { return now.Add(time.Hour) })},
+			wantErr:   true,
+			wantIsErr: ErrExpiredToken,
+		},
+		{
+			name:      "not-before",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"nbf": float64(now.Add(30 * time.Second).Unix())}), nil)),
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrInvalidNotBefore,
+		},
+		{
+			name:      "issued-in-the-future",
+			token:     IDToken(TestSignJWT(t, priv, ES256, claims(map[string]interface{}{"iat": float64(now.Add(10 * time.Minute).Unix()), "exp": float64(now.Add(time.Hour).Unix())}), nil)),
+			req:       req,
+			wantErr:   true,
+			wantIsErr: ErrInvalidIssuedAt,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := VerifySelfIssuedIDToken(ctx, tt.token, tt.req, tt.opt...)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal("test-nonce-0123456789abcdef", got["nonce"])
+		})
+	}
+	t.Run("expired-request", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		expired, err := NewRequest(time.Nanosecond, redirect, WithState("s"), WithNonce("test-nonce-0123456789abcdef"))
+		require.NoError(err)
+		time.Sleep(time.Millisecond)
+		_, err = VerifySelfIssuedIDToken(ctx, IDToken(TestSignJWT(t, priv, ES256, claims(nil), nil)), expired)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrExpiredRequest), "wanted \"%s\" but got \"%s\"", ErrExpiredRequest, err)
+	})
+}
+
+func Test_getSelfIssuedOpts(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	resolver := &testDIDResolver{}
+	opts := getSelfIssuedOpts(
+		WithSelfIssuedAuthEndpoint("https://wallet.example.com"),
+		WithClientMetadata(map[string]interface{}{"client_name": "rp"}),
+		WithDIDResolver(resolver),
+	)
+	testOpts := selfIssuedDefaults()
+	testOpts.withAuthEndpoint = "https://wallet.example.com"
+	testOpts.withClientMetadata = map[string]interface{}{"client_name": "rp"}
+	testOpts.withDIDResolver = resolver
+	assert.Equal(opts, testOpts)
+}
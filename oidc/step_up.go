@@ -0,0 +1,154 @@
+package oidc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/cap/oidc/internal/strutils"
+)
+
+// StepUpPolicy is the authentication an operation requires, which is used to
+// decide whether a user must re-authenticate (step-up) before the operation is
+// allowed.
+type StepUpPolicy struct {
+	// ACRValues is an optional list of acceptable Authentication Context
+	// Class References, in order of preference.  When it's not empty, the
+	// user's acr claim must be one of them.
+	ACRValues []string
+
+	// AMRValues is an optional list of Authentication Methods References
+	// (like "mfa" or "hwk") which must all be in the user's amr claim.
+	AMRValues []string
+
+	// MaxAge is the optional maximum amount of time since the user's
+	// auth_time.  When it's zero, the user's authentication time isn't
+	// checked.
+	MaxAge time.Duration
+}
+
+// StepUpDecision is the result of evaluating verified claims against a
+// StepUpPolicy.
+type StepUpDecision struct {
+	// Required is true when the user must re-authenticate.
+	Required bool
+
+	// Reasons describe why re-authentication is required.
+	Reasons []string
+}
+
+// EvaluateStepUp decides whether the user of the verified claims (typically
+// from Provider.VerifyIDToken) must re-authenticate to satisfy the policy.
+// The acr, amr and auth_time claims are checked, and a missing claim that's
+// required by the policy requires re-authentication.  Use NewStepUpRequest(...)
+// to create the Request for the re-authentication.
+//
+// Supported options: WithNow
+func EvaluateStepUp(claims map[string]interface{}, policy StepUpPolicy, opt ...Option) (*StepUpDecision, error) {
+	const op = "EvaluateStepUp"
+	if claims == nil {
+		return nil, fmt.Errorf("%s: claims are nil: %w", op, ErrNilParameter)
+	}
+	if policy.MaxAge < 0 {
+		return nil, fmt.Errorf("%s: max age must not be negative: %w", op, ErrInvalidParameter)
+	}
+	opts := getStepUpOpts(opt...)
+	now := time.Now()
+	if opts.withNowFunc != nil {
+		now = opts.withNowFunc()
+	}
+	d := &StepUpDecision{}
+	if len(policy.ACRValues) > 0 {
+		acr, _ := claims["acr"].(string)
+		if !strutils.StrListContains(policy.ACRValues, acr) {
+			d.Reasons = append(d.Reasons, fmt.Sprintf("acr %q is not one of %q", acr, policy.ACRValues))
+		}
+	}
+	if len(policy.AMRValues) > 0 {
+		amr := claimStrings(claims["amr"])
+		for _, required := range policy.AMRValues {
+			if !strutils.StrListContains(amr, required) {
+				d.Reasons = append(d.Reasons, fmt.Sprintf("amr %q doesn't include %q", amr, required))
+			}
+		}
+	}
+	if policy.MaxAge > 0 {
+		authTime, ok := claims["auth_time"].(float64)
+		switch {
+		case !ok:
+			d.Reasons = append(d.Reasons, "auth_time is missing")
+		case now.Sub(time.Unix(int64(authTime), 0)) > policy.MaxAge:
+			d.Reasons = append(d.Reasons, fmt.Sprintf("auth_time is older than %s", policy.MaxAge))
+		}
+	}
+	d.Required = len(d.Reasons) > 0
+	return d, nil
+}
+
+// NewStepUpRequest creates a new Request for a user to re-authenticate so
+// the policy is satisfied.  The request uses prompt=login, the policy's
+// ACRValues as its acr_values and its MaxAge (in seconds) as its max_age, so
+// the resulting id_token's auth_time is verified during the exchange.  The
+// policy's AMRValues can't be requested, so the resulting claims should be
+// evaluated again with EvaluateStepUp(...).
+//
+// The opts are the same as NewRequest(...), although the policy's prompt,
+// acr_values and max_age override the WithPrompts, WithACRValues and
+// WithMaxAge options.
+func NewStepUpRequest(expireIn time.Duration, redirectURL string, policy StepUpPolicy, opt ...Option) (*Req, error) {
+	const op = "NewStepUpRequest"
+	if policy.MaxAge < 0 {
+		return nil, fmt.Errorf("%s: max age must not be negative: %w", op, ErrInvalidParameter)
+	}
+	reqOpts := append([]Option{}, opt...)
+	reqOpts = append(reqOpts, WithPrompts(Login))
+	if len(policy.ACRValues) > 0 {
+		reqOpts = append(reqOpts, WithACRValues(policy.ACRValues...))
+	}
+	if policy.MaxAge > 0 {
+		reqOpts = append(reqOpts, WithMaxAge(uint(policy.MaxAge/time.Second)))
+	}
+	r, err := NewRequest(expireIn, redirectURL, reqOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return r, nil
+}
+
+// claimStrings returns a claim's value as a list of strings, where the claim
+// may be a single string or a list.
+func claimStrings(v interface{}) []string {
+	switch c := v.(type) {
+	case string:
+		return []string{c}
+	case []string:
+		return c
+	case []interface{}:
+		s := make([]string, 0, len(c))
+		for _, e := range c {
+			if str, ok := e.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	}
+	return nil
+}
+
+// stepUpOptions is the set of available options for EvaluateStepUp
+type stepUpOptions struct {
+	withNowFunc func() time.Time
+}
+
+// stepUpDefaults is a handy way to get the defaults at runtime and during unit
+// tests.
+func stepUpDefaults() stepUpOptions {
+	return stepUpOptions{}
+}
+
+// getStepUpOpts gets the step-up defaults and applies the opt overrides passed
+// in
+func getStepUpOpts(opt ...Option) stepUpOptions {
+	opts := stepUpDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
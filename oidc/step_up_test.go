@@ -0,0 +1,131 @@
+package oidc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateStepUp(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	recent := float64(now.Add(-time.Minute).Unix())
+	stale := float64(now.Add(-time.Hour).Unix())
+	tests := []struct {
+		name         string
+		claims       map[string]interface{}
+		policy       StepUpPolicy
+		wantRequired bool
+		wantReasons  int
+		wantErr      bool
+		wantIsErr    error
+	}{
+		{
+			name:   "no-policy",
+			claims: map[string]interface{}{},
+		},
+		{
+			name:   "satisfied",
+			claims: map[string]interface{}{"acr": "gold", "amr": []interface{}{"pwd", "mfa"}, "auth_time": recent},
+			policy: StepUpPolicy{ACRValues: []string{"silver", "gold"}, AMRValues: []string{"mfa"}, MaxAge: 5 * time.Minute},
+		},
+		{
+			name:         "acr-not-acceptable",
+			claims:       map[string]interface{}{"acr": "bronze"},
+			policy:       StepUpPolicy{ACRValues: []string{"gold"}},
+			wantRequired: true,
+			wantReasons:  1,
+		},
+		{
+			name:         "missing-acr",
+			claims:       map[string]interface{}{},
+			policy:       StepUpPolicy{ACRValues: []string{"gold"}},
+			wantRequired: true,
+			wantReasons:  1,
+		},
+		{
+			name:         "missing-amr-methods",
+			claims:       map[string]interface{}{"amr": "pwd"},
+			policy:       StepUpPolicy{AMRValues: []string{"mfa", "hwk"}},
+			wantRequired: true,
+			wantReasons:  2,
+		},
+		{
+			name:         "stale-auth-time",
+			claims:       map[string]interface{}{"auth_time": stale},
+			policy:       StepUpPolicy{MaxAge: 5 * time.Minute},
+			wantRequired: true,
+			wantReasons:  1,
+		},
+		{
+			name:         "missing-auth-time",
+			claims:       map[string]interface{}{},
+			policy:       StepUpPolicy{MaxAge: 5 * time.Minute},
+			wantRequired: true,
+			wantReasons:  1,
+		},
+		{
+			name:      "nil-claims",
+			wantErr:   true,
+			wantIsErr: ErrNilParameter,
+		},
+		{
+			name:      "negative-max-age",
+			claims:    map[string]interface{}{},
+			policy:    StepUpPolicy{MaxAge: -1},
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := EvaluateStepUp(tt.claims, tt.policy, WithNow(func() time.Time { return now }))
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.wantRequired, got.Required)
+			assert.Len(got.Reasons, tt.wantReasons)
+		})
+	}
+}
+
+func TestNewStepUpRequest(t *testing.T) {
+	t.Parallel()
+	redirect := "https://app.example.com/callback"
+	t.Run("valid", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		policy := StepUpPolicy{ACRValues: []string{"gold"}, AMRValues: []string{"mfa"}, MaxAge: 90 * time.Second}
+		r, err := NewStepUpRequest(time.Minute, redirect, policy, WithPrompts(Consent), WithScopes("email"))
+		require.NoError(err)
+		assert.Equal([]Prompt{Login}, r.Prompts())
+		assert.Equal([]string{"gold"}, r.ACRValues())
+		secs, authAfter := r.MaxAge()
+		assert.Equal(uint(90), secs)
+		assert.False(authAfter.IsZero())
+		assert.Equal([]string{"openid", "email"}, r.Scopes())
+	})
+	t.Run("without-max-age", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		r, err := NewStepUpRequest(time.Minute, redirect, StepUpPolicy{})
+		require.NoError(err)
+		assert.Equal([]Prompt{Login}, r.Prompts())
+		assert.Empty(r.ACRValues())
+		secs, authAfter := r.MaxAge()
+		assert.Zero(secs)
+		assert.True(authAfter.IsZero())
+	})
+	t.Run("invalid", func(t *testing.T) {
+		assert := assert.New(t)
+		_, err := NewStepUpRequest(time.Minute, redirect, StepUpPolicy{MaxAge: -1})
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+		_, err = NewStepUpRequest(time.Minute, "", StepUpPolicy{})
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
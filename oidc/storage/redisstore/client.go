@@ -0,0 +1,144 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// DefaultKeyPrefix is the default prefix of the stores' keys.
+const DefaultKeyPrefix = "cap:"
+
+// Client defines an interface for a Redis client, which the stores use to
+// run commands.
+//
+// Implementations must be concurrently safe.
+type Client interface {
+	// Do runs the command (for example: "SET", key, value, "PX", 1000) and
+	// returns its reply: a []byte or string for a bulk or simple string
+	// reply, an int64 for an integer reply and an []interface{} for an array
+	// reply.  A nil reply must be returned as a nil reply and a nil error.
+	Do(ctx context.Context, args ...interface{}) (interface{}, error)
+}
+
+// ClientFunc is an adapter which allows a func to be used as a Client.
+type ClientFunc func(ctx context.Context, args ...interface{}) (interface{}, error)
+
+// Do implements the Client.Do() interface function.
+func (f ClientFunc) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	return f(ctx, args...)
+}
+
+// bytesReply returns a bulk string reply, or nil for a nil reply.
+func bytesReply(reply interface{}) ([]byte, error) {
+	const op = "redisstore.bytesReply"
+	switch v := reply.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("%s: unexpected %T reply: %w", op, reply, oidc.ErrInvalidParameter)
+	}
+}
+
+// intReply returns an integer reply.
+func intReply(reply interface{}) (int64, error) {
+	const op = "redisstore.intReply"
+	switch v := reply.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	default:
+		return 0, fmt.Errorf("%s: unexpected %T reply: %w", op, reply, oidc.ErrInvalidParameter)
+	}
+}
+
+// stringsReply returns an array reply of bulk strings.
+func stringsReply(reply interface{}) ([]string, error) {
+	const op = "redisstore.stringsReply"
+	switch v := reply.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, e := range v {
+			b, err := bytesReply(e)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			values = append(values, string(b))
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("%s: unexpected %T reply: %w", op, reply, oidc.ErrInvalidParameter)
+	}
+}
+
+// milliseconds returns the duration in whole milliseconds (rounded up), which
+// is the resolution of a key's expiration.
+func milliseconds(d time.Duration) int64 {
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+// storeOptions is the set of available options for the stores.
+type storeOptions struct {
+	withKeyPrefix string
+	withWrapper   oidc.Wrapper
+}
+
+// storeDefaults is a handy way to get the defaults at runtime and during unit
+// tests.
+func storeDefaults() storeOptions {
+	return storeOptions{withKeyPrefix: DefaultKeyPrefix}
+}
+
+// getStoreOpts gets the store defaults and applies the opt overrides passed
+// in
+func getStoreOpts(opt ...oidc.Option) storeOptions {
+	opts := storeDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithKeyPrefix provides an optional prefix for the store's keys, which
+// defaults to DefaultKeyPrefix.
+//
+// Valid for: NewRequestStore, NewTokenStore, NewSessionStore and
+// NewReplayCache
+func WithKeyPrefix(prefix string) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*storeOptions); ok {
+			o.withKeyPrefix = prefix
+		}
+	}
+}
+
+// WithWrapper provides an optional oidc.Wrapper which encrypts the values of
+// the store's keys: the tokens, the requests (including their nonce and PKCE
+// verifier) and the sessions.  The keys themselves (and the sets which index
+// sessions by their sid and sub claims) aren't encrypted.  Values are
+// re-encrypted with the wrapper's current key every time they're written, so
+// they're migrated to a rotated key (and unencrypted values are encrypted) on
+// their next write.
+//
+// Valid for: NewRequestStore, NewTokenStore and NewSessionStore
+func WithWrapper(w oidc.Wrapper) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*storeOptions); ok {
+			o.withWrapper = w
+		}
+	}
+}
@@ -0,0 +1,49 @@
+/*
+redisstore is a package that provides Redis backed stores for the requests,
+tokens and sessions of production deployments, so each deployment doesn't need
+to write (and debug) its own persistence layer.
+
+* a RequestStore implements the callback package's RequestReader,
+RequestWriter and PhaseTracker interfaces, and requests expire with their
+oidc.Request
+
+* a TokenStore implements the clientauth package's TokenStore interface
+
+* a SessionStore implements the session package's Store and Finder interfaces,
+and sessions expire at their ExpiresAt
+
+* a ReplayCache implements the oidc package's ReplayCache interface
+
+* requests, tokens and sessions are persisted using their versioned formats
+(see oidc.RequestFormatVersion), so data persisted by this release can be
+read by future releases
+
+* the persisted requests, tokens and sessions are encrypted when the stores
+have an oidc.Wrapper (see WithWrapper)
+
+* every key has a prefix (see WithKeyPrefix), so a Redis database can be
+shared with the app
+
+The package doesn't depend on a Redis client, so the stores use a Client which
+is easily adapted from the app's client (like github.com/redis/go-redis/v9).
+The persisted data includes nonces, PKCE verifiers and unredacted tokens, so
+the stores should have a wrapper and the Redis server must be secured
+accordingly.
+
+Example:
+
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	client := redisstore.ClientFunc(func(ctx context.Context, args ...interface{}) (interface{}, error) {
+	  v, err := rdb.Do(ctx, args...).Result()
+	  if err == redis.Nil {
+	    return nil, nil
+	  }
+	  return v, err
+	})
+	requests, err := redisstore.NewRequestStore(client)
+	if err != nil {
+	  // handle err
+	}
+	h, err := callback.AuthCode(ctx, p, requests, successFn, errorFn)
+*/
+package redisstore
@@ -0,0 +1,54 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// ReplayCache implements the oidc.ReplayCache interface using Redis.  Each ID
+// is added using SET NX with the ID's expiration, which is an atomic
+// check-and-set of the ID for every instance using the same Redis primary.
+//
+// It is concurrently safe.
+type ReplayCache struct {
+	client Client
+	prefix string
+}
+
+// ensure that ReplayCache implements the oidc.ReplayCache interface.
+var _ oidc.ReplayCache = (*ReplayCache)(nil)
+
+// NewReplayCache creates a new ReplayCache.
+//
+// Supported options: WithKeyPrefix
+func NewReplayCache(c Client, opt ...oidc.Option) (*ReplayCache, error) {
+	const op = "redisstore.NewReplayCache"
+	if c == nil {
+		return nil, fmt.Errorf("%s: client is nil: %w", op, oidc.ErrNilParameter)
+	}
+	opts := getStoreOpts(opt...)
+	return &ReplayCache{client: c, prefix: opts.withKeyPrefix}, nil
+}
+
+// Add implements the oidc.ReplayCache.Add() interface function.
+func (c *ReplayCache) Add(ctx context.Context, id string, expiresAt time.Time) error {
+	const op = "ReplayCache.Add"
+	if id == "" {
+		return fmt.Errorf("%s: id is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	reply, err := c.client.Do(ctx, "SET", c.prefix+"replay:"+id, "1", "NX", "PX", milliseconds(ttl))
+	switch {
+	case err != nil:
+		return fmt.Errorf("%s: %w", op, err)
+	case reply == nil:
+		return fmt.Errorf("%s: %q was already used: %w", op, id, oidc.ErrReplayDetected)
+	}
+	return nil
+}
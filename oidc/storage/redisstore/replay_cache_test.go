@@ -0,0 +1,38 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayCache(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	c := newTestClient()
+	rc, err := NewReplayCache(c)
+	require.NoError(err)
+
+	require.NoError(rc.Add(ctx, "jti-1", time.Now().Add(time.Minute)))
+	err = rc.Add(ctx, "jti-1", time.Now().Add(time.Minute))
+	assert.Truef(errors.Is(err, oidc.ErrReplayDetected), "wanted \"%s\" but got \"%s\"", oidc.ErrReplayDetected, err)
+
+	// an expired ID isn't added
+	require.NoError(rc.Add(ctx, "jti-2", time.Now().Add(-time.Minute)))
+	assert.Equal([]string{"cap:replay:jti-1"}, c.keys())
+
+	// an ID can be added again once it's expired
+	c.expire("cap:replay:jti-1")
+	require.NoError(rc.Add(ctx, "jti-1", time.Now().Add(time.Minute)))
+
+	err = rc.Add(ctx, "", time.Now().Add(time.Minute))
+	assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+	_, err = NewReplayCache(nil)
+	assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+}
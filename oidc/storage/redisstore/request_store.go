@@ -0,0 +1,229 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/callback"
+)
+
+// RequestStore implements the callback package's RequestReader, RequestWriter
+// and PhaseTracker interfaces using Redis, so requests can be shared by every
+// instance of an app.  A request's key expires with the request, and each
+// phase of its flow is a marker key which is set using SET NX, so only one
+// callback can transition a flow's phase.  The requests (including their
+// nonce and PKCE verifier) are encrypted when the store has an oidc.Wrapper
+// (see WithWrapper).
+//
+// It is concurrently safe.
+type RequestStore struct {
+	client  Client
+	prefix  string
+	wrapper oidc.Wrapper
+}
+
+// ensure that RequestStore implements the callback interfaces.
+var (
+	_ callback.RequestReader = (*RequestStore)(nil)
+	_ callback.RequestWriter = (*RequestStore)(nil)
+	_ callback.PhaseTracker  = (*RequestStore)(nil)
+)
+
+// NewRequestStore creates a new RequestStore.
+//
+// Supported options: WithKeyPrefix and WithWrapper
+func NewRequestStore(c Client, opt ...oidc.Option) (*RequestStore, error) {
+	const op = "redisstore.NewRequestStore"
+	if c == nil {
+		return nil, fmt.Errorf("%s: client is nil: %w", op, oidc.ErrNilParameter)
+	}
+	opts := getStoreOpts(opt...)
+	return &RequestStore{client: c, prefix: opts.withKeyPrefix, wrapper: opts.withWrapper}, nil
+}
+
+// Read implements the callback.RequestReader.Read() interface function and
+// returns an *oidc.Req.  If a request is not found for the state, then an
+// error wrapping oidc.ErrNotFound is returned.
+func (s *RequestStore) Read(ctx context.Context, state string) (oidc.Request, error) {
+	const op = "RequestStore.Read"
+	reply, err := s.client.Do(ctx, "GET", s.key(state))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	data, err := bytesReply(reply)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", op, err)
+	case data == nil:
+		return nil, fmt.Errorf("%s: request for state %q: %w", op, state, oidc.ErrNotFound)
+	}
+	if data, err = unwrap(ctx, s.wrapper, data, wrapAAD("request", state)); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	r := &oidc.Req{}
+	if err := r.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return r, nil
+}
+
+// Write implements the callback.RequestWriter.Write() interface function,
+// replacing any existing request for the same state.  The request's flow is
+// in the callback.PhaseIssued phase.  The request must be an *oidc.Req, and
+// an error wrapping oidc.ErrExpiredRequest is returned when it's expired.
+func (s *RequestStore) Write(ctx context.Context, oidcRequest oidc.Request) error {
+	const op = "RequestStore.Write"
+	if oidcRequest == nil {
+		return fmt.Errorf("%s: request is nil: %w", op, oidc.ErrNilParameter)
+	}
+	r, ok := oidcRequest.(*oidc.Req)
+	switch {
+	case !ok:
+		return fmt.Errorf("%s: request is a %T and must be an *oidc.Req: %w", op, oidcRequest, oidc.ErrInvalidParameter)
+	case r.State() == "":
+		return fmt.Errorf("%s: request state is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	ttl := time.Until(r.Expiration())
+	if ttl <= 0 {
+		return fmt.Errorf("%s: request for state %q: %w", op, r.State(), oidc.ErrExpiredRequest)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if data, err = wrap(ctx, s.wrapper, data, wrapAAD("request", r.State())); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// rewriting a request restarts its flow
+	if _, err := s.client.Do(ctx, s.markerArgs("DEL", r.State())...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := s.client.Do(ctx, "SET", s.key(r.State()), data, "PX", milliseconds(ttl)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Phase returns the phase of the request's flow.  If a request is not found
+// for the state, then an error wrapping oidc.ErrNotFound is returned.
+func (s *RequestStore) Phase(ctx context.Context, state string) (callback.FlowPhase, error) {
+	const op = "RequestStore.Phase"
+	if _, err := s.ttl(ctx, state); err != nil {
+		return callback.PhaseUnknown, fmt.Errorf("%s: %w", op, err)
+	}
+	for p := callback.PhaseExchanged; p > callback.PhaseIssued; p-- {
+		reply, err := s.client.Do(ctx, "EXISTS", s.marker(state, p))
+		if err != nil {
+			return callback.PhaseUnknown, fmt.Errorf("%s: %w", op, err)
+		}
+		n, err := intReply(reply)
+		if err != nil {
+			return callback.PhaseUnknown, fmt.Errorf("%s: %w", op, err)
+		}
+		if n > 0 {
+			return p, nil
+		}
+	}
+	return callback.PhaseIssued, nil
+}
+
+// Transition implements the callback.PhaseTracker.Transition() interface
+// function.  The to phase's marker is set using SET NX, so only one callback
+// can transition a flow's phase.
+func (s *RequestStore) Transition(ctx context.Context, state string, from, to callback.FlowPhase) error {
+	const op = "RequestStore.Transition"
+	if from < callback.PhaseIssued || to != from+1 || to > callback.PhaseExchanged {
+		return fmt.Errorf("%s: %s to %s is not a valid transition: %w", op, from, to, oidc.ErrInvalidParameter)
+	}
+	ttl, err := s.ttl(ctx, state)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if from > callback.PhaseIssued {
+		reply, err := s.client.Do(ctx, "EXISTS", s.marker(state, from))
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		n, err := intReply(reply)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if n == 0 {
+			return s.phaseError(ctx, op, state, from, to)
+		}
+	}
+	args := []interface{}{"SET", s.marker(state, to), "1", "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", ttl)
+	}
+	reply, err := s.client.Do(ctx, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if reply == nil {
+		return s.phaseError(ctx, op, state, from, to)
+	}
+	return nil
+}
+
+// Delete the request for the state, which should be done once its flow is
+// completed.  It's not an error to delete a state that doesn't exist.
+func (s *RequestStore) Delete(ctx context.Context, state string) error {
+	const op = "RequestStore.Delete"
+	args := append(s.markerArgs("DEL", state), s.key(state))
+	if _, err := s.client.Do(ctx, args...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// ttl returns the remaining milliseconds until the request for the state
+// expires, which is -1 when it doesn't expire.  If a request is not found for
+// the state, then an error wrapping oidc.ErrNotFound is returned.
+func (s *RequestStore) ttl(ctx context.Context, state string) (int64, error) {
+	const op = "RequestStore.ttl"
+	reply, err := s.client.Do(ctx, "PTTL", s.key(state))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	ttl, err := intReply(reply)
+	switch {
+	case err != nil:
+		return 0, fmt.Errorf("%s: %w", op, err)
+	case ttl == -2:
+		return 0, fmt.Errorf("%s: request for state %q: %w", op, state, oidc.ErrNotFound)
+	}
+	return ttl, nil
+}
+
+// phaseError returns a callback.PhaseError for a transition that failed.
+func (s *RequestStore) phaseError(ctx context.Context, op, state string, from, to callback.FlowPhase) error {
+	current, err := s.Phase(ctx, state)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return fmt.Errorf("%s: %w", op, &callback.PhaseError{State: state, Current: current, From: from, To: to})
+}
+
+// key returns the key of the request for the state.
+func (s *RequestStore) key(state string) string {
+	return s.prefix + "request:" + state
+}
+
+// marker returns the key of the marker for the phase of the request's flow.
+func (s *RequestStore) marker(state string, p callback.FlowPhase) string {
+	return s.key(state) + ":phase:" + strconv.Itoa(int(p))
+}
+
+// markerArgs returns the command followed by every phase marker key of the
+// request's flow.
+func (s *RequestStore) markerArgs(cmd, state string) []interface{} {
+	args := []interface{}{cmd}
+	for p := callback.PhaseCallbackReceived; p <= callback.PhaseExchanged; p++ {
+		args = append(args, s.marker(state, p))
+	}
+	return args
+}
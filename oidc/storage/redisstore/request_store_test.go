@@ -0,0 +1,98 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/callback"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestStore(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	c := newTestClient()
+	s, err := NewRequestStore(c)
+	require.NoError(err)
+
+	v, err := oidc.NewCodeVerifier()
+	require.NoError(err)
+	r, err := oidc.NewRequest(time.Minute, "https://app.example.com/callback", oidc.WithPKCE(v))
+	require.NoError(err)
+	require.NoError(s.Write(ctx, r))
+	assert.Equal([]string{"cap:request:" + r.State()}, c.keys())
+
+	got, err := s.Read(ctx, r.State())
+	require.NoError(err)
+	assert.Equal(r.State(), got.State())
+	assert.Equal(r.Nonce(), got.Nonce())
+	assert.Equal(v.Verifier(), got.PKCEVerifier().Verifier())
+
+	phase, err := s.Phase(ctx, r.State())
+	require.NoError(err)
+	assert.Equal(callback.PhaseIssued, phase)
+
+	err = s.Transition(ctx, r.State(), callback.PhaseCallbackReceived, callback.PhaseExchanged)
+	assert.Truef(errors.Is(err, oidc.ErrOutOfOrderCallback), "wanted \"%s\" but got \"%s\"", oidc.ErrOutOfOrderCallback, err)
+	require.NoError(s.Transition(ctx, r.State(), callback.PhaseIssued, callback.PhaseCallbackReceived))
+	err = s.Transition(ctx, r.State(), callback.PhaseIssued, callback.PhaseCallbackReceived)
+	assert.Truef(errors.Is(err, oidc.ErrDuplicateCallback), "wanted \"%s\" but got \"%s\"", oidc.ErrDuplicateCallback, err)
+	var phaseErr *callback.PhaseError
+	require.True(errors.As(err, &phaseErr))
+	assert.Equal(callback.PhaseCallbackReceived, phaseErr.Current)
+	require.NoError(s.Transition(ctx, r.State(), callback.PhaseCallbackReceived, callback.PhaseExchanged))
+	phase, err = s.Phase(ctx, r.State())
+	require.NoError(err)
+	assert.Equal(callback.PhaseExchanged, phase)
+
+	// rewriting a request restarts its flow
+	require.NoError(s.Write(ctx, r))
+	phase, err = s.Phase(ctx, r.State())
+	require.NoError(err)
+	assert.Equal(callback.PhaseIssued, phase)
+
+	err = s.Transition(ctx, r.State(), callback.PhaseIssued, callback.PhaseExchanged)
+	assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+	err = s.Transition(ctx, "unknown", callback.PhaseIssued, callback.PhaseCallbackReceived)
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+	// the request expires with its key
+	require.NoError(s.Transition(ctx, r.State(), callback.PhaseIssued, callback.PhaseCallbackReceived))
+	c.expire("cap:request:" + r.State())
+	_, err = s.Read(ctx, r.State())
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+	require.NoError(s.Write(ctx, r))
+	require.NoError(s.Delete(ctx, r.State()))
+	assert.Empty(c.keys())
+	require.NoError(s.Delete(ctx, r.State()))
+
+	expired, err := oidc.NewRequest(time.Minute, "https://app.example.com/callback", oidc.WithNow(func() time.Time { return time.Now().Add(-time.Hour) }))
+	require.NoError(err)
+	err = s.Write(ctx, expired)
+	assert.Truef(errors.Is(err, oidc.ErrExpiredRequest), "wanted \"%s\" but got \"%s\"", oidc.ErrExpiredRequest, err)
+	err = s.Write(ctx, nil)
+	assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+}
+
+func TestNewRequestStore(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	_, err := NewRequestStore(nil)
+	assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+
+	ctx := context.Background()
+	c := newTestClient()
+	s, err := NewRequestStore(c, WithKeyPrefix("app:cap:"))
+	require.NoError(err)
+	r, err := oidc.NewRequest(time.Minute, "https://app.example.com/callback")
+	require.NoError(err)
+	require.NoError(s.Write(ctx, r))
+	require.NoError(s.Transition(ctx, r.State(), callback.PhaseIssued, callback.PhaseCallbackReceived))
+	assert.Equal([]string{"app:cap:request:" + r.State(), "app:cap:request:" + r.State() + ":phase:2"}, c.keys())
+}
@@ -0,0 +1,228 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/session"
+)
+
+// SessionStore implements the session package's Store and Finder interfaces
+// using Redis.  A session's key expires at its ExpiresAt, and its ID is added
+// to sets indexed by its sid and sub claims so it can be found by a
+// back-channel logout.  IDs of expired sessions are removed from the sets by
+// Find and Delete.  The sessions are encrypted when the store has an
+// oidc.Wrapper (see WithWrapper), although their index sets aren't.
+//
+// It is concurrently safe.
+type SessionStore struct {
+	client  Client
+	prefix  string
+	wrapper oidc.Wrapper
+}
+
+// ensure that SessionStore implements the session.Store and session.Finder
+// interfaces.
+var (
+	_ session.Store  = (*SessionStore)(nil)
+	_ session.Finder = (*SessionStore)(nil)
+)
+
+// NewSessionStore creates a new SessionStore.
+//
+// Supported options: WithKeyPrefix and WithWrapper
+func NewSessionStore(c Client, opt ...oidc.Option) (*SessionStore, error) {
+	const op = "redisstore.NewSessionStore"
+	if c == nil {
+		return nil, fmt.Errorf("%s: client is nil: %w", op, oidc.ErrNilParameter)
+	}
+	opts := getStoreOpts(opt...)
+	return &SessionStore{client: c, prefix: opts.withKeyPrefix, wrapper: opts.withWrapper}, nil
+}
+
+// Read implements the session.Store.Read() interface function.
+func (s *SessionStore) Read(ctx context.Context, id string) (*session.Session, error) {
+	const op = "SessionStore.Read"
+	sess, err := s.read(ctx, id)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", op, err)
+	case sess == nil:
+		return nil, fmt.Errorf("%s: session not found: %w", op, oidc.ErrNotFound)
+	}
+	return sess, nil
+}
+
+// Write implements the session.Store.Write() interface function.  An error
+// wrapping oidc.ErrExpiredSession is returned when the session is expired.
+func (s *SessionStore) Write(ctx context.Context, sess *session.Session) error {
+	const op = "SessionStore.Write"
+	switch {
+	case sess == nil:
+		return fmt.Errorf("%s: session is nil: %w", op, oidc.ErrNilParameter)
+	case sess.ID == "":
+		return fmt.Errorf("%s: session ID is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	if _, err := s.set(ctx, sess); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, index := range s.indexes(sess) {
+		if _, err := s.client.Do(ctx, "SADD", index, sess.ID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// Touch implements the session.Store.Touch() interface function.  The
+// session is set using SET XX, so a session that's deleted while it's being
+// touched stays deleted.
+func (s *SessionStore) Touch(ctx context.Context, id string, expiresAt time.Time) error {
+	const op = "SessionStore.Touch"
+	sess, err := s.Read(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	sess.ExpiresAt = expiresAt
+	ok, err := s.set(ctx, sess, "XX")
+	switch {
+	case err != nil:
+		return fmt.Errorf("%s: %w", op, err)
+	case !ok:
+		return fmt.Errorf("%s: session not found: %w", op, oidc.ErrNotFound)
+	}
+	return nil
+}
+
+// Delete implements the session.Store.Delete() interface function.
+func (s *SessionStore) Delete(ctx context.Context, id string) error {
+	const op = "SessionStore.Delete"
+	sess, err := s.read(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if sess == nil {
+		return nil
+	}
+	if _, err := s.client.Do(ctx, "DEL", s.key(id)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, index := range s.indexes(sess) {
+		if _, err := s.client.Do(ctx, "SREM", index, id); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// Find implements the session.Finder.Find() interface function.
+func (s *SessionStore) Find(ctx context.Context, iss, sid, sub string) ([]*session.Session, error) {
+	const op = "SessionStore.Find"
+	var index string
+	switch {
+	case sid != "":
+		index = s.prefix + "session-sid:" + sid
+	case sub != "":
+		index = s.prefix + "session-sub:" + sub
+	default:
+		return nil, fmt.Errorf("%s: sid and sub are empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	reply, err := s.client.Do(ctx, "SMEMBERS", index)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	ids, err := stringsReply(reply)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	var found []*session.Session
+	for _, id := range ids {
+		sess, err := s.read(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if sess == nil {
+			// the session expired, so its ID is removed from the index
+			if _, err := s.client.Do(ctx, "SREM", index, id); err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			continue
+		}
+		if (iss == "" || claim(sess, "iss") == iss) &&
+			(sid == "" || claim(sess, "sid") == sid) &&
+			(sub == "" || claim(sess, "sub") == sub) {
+			found = append(found, sess)
+		}
+	}
+	return found, nil
+}
+
+// read returns the session for the ID, or nil when it's not found.
+func (s *SessionStore) read(ctx context.Context, id string) (*session.Session, error) {
+	const op = "SessionStore.read"
+	reply, err := s.client.Do(ctx, "GET", s.key(id))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	data, err := bytesReply(reply)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	if data, err = unwrap(ctx, s.wrapper, data, wrapAAD("session", id)); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	sess := &session.Session{}
+	if err := sess.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return sess, nil
+}
+
+// set sets the session's key to expire at its ExpiresAt, and returns false
+// when it's not set because of a SET condition (NX or XX).
+func (s *SessionStore) set(ctx context.Context, sess *session.Session, condition ...interface{}) (bool, error) {
+	const op = "SessionStore.set"
+	ttl := time.Until(sess.ExpiresAt)
+	if ttl <= 0 {
+		return false, fmt.Errorf("%s: %w", op, oidc.ErrExpiredSession)
+	}
+	data, err := sess.MarshalBinary()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	if data, err = wrap(ctx, s.wrapper, data, wrapAAD("session", sess.ID)); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	args := append([]interface{}{"SET", s.key(sess.ID), data, "PX", milliseconds(ttl)}, condition...)
+	reply, err := s.client.Do(ctx, args...)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	return reply != nil, nil
+}
+
+// key returns the key of the session for the ID.
+func (s *SessionStore) key(id string) string {
+	return s.prefix + "session:" + id
+}
+
+// indexes returns the keys of the sets which index the session by its sid
+// and sub claims.
+func (s *SessionStore) indexes(sess *session.Session) []string {
+	var keys []string
+	if sid := claim(sess, "sid"); sid != "" {
+		keys = append(keys, s.prefix+"session-sid:"+sid)
+	}
+	if sub := claim(sess, "sub"); sub != "" {
+		keys = append(keys, s.prefix+"session-sub:"+sub)
+	}
+	return keys
+}
+
+// claim returns the session's string claim, or an empty string.
+func claim(sess *session.Session, name string) string {
+	v, _ := sess.Claims[name].(string)
+	return v
+}
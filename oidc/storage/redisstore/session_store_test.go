@@ -0,0 +1,88 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionStore(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	c := newTestClient()
+	s, err := NewSessionStore(c)
+	require.NoError(err)
+
+	alice := &session.Session{
+		ID:        "s_alice",
+		Claims:    map[string]interface{}{"iss": "https://op.example.com", "sub": "alice", "sid": "sid-1"},
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	bob := &session.Session{
+		ID:        "s_bob",
+		Claims:    map[string]interface{}{"iss": "https://op.example.com", "sub": "bob"},
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	require.NoError(s.Write(ctx, alice))
+	require.NoError(s.Write(ctx, bob))
+	assert.Equal([]string{
+		"cap:session-sid:sid-1",
+		"cap:session-sub:alice",
+		"cap:session-sub:bob",
+		"cap:session:s_alice",
+		"cap:session:s_bob",
+	}, c.keys())
+
+	got, err := s.Read(ctx, alice.ID)
+	require.NoError(err)
+	assert.Equal(alice, got)
+
+	require.NoError(s.Touch(ctx, alice.ID, now.Add(2*time.Hour)))
+	got, err = s.Read(ctx, alice.ID)
+	require.NoError(err)
+	assert.Equal(now.Add(2*time.Hour), got.ExpiresAt)
+	err = s.Touch(ctx, "s_unknown", now.Add(time.Hour))
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+	err = s.Touch(ctx, alice.ID, now.Add(-time.Hour))
+	assert.Truef(errors.Is(err, oidc.ErrExpiredSession), "wanted \"%s\" but got \"%s\"", oidc.ErrExpiredSession, err)
+
+	found, err := s.Find(ctx, "https://op.example.com", "sid-1", "")
+	require.NoError(err)
+	require.Len(found, 1)
+	assert.Equal(alice.ID, found[0].ID)
+	found, err = s.Find(ctx, "", "", "bob")
+	require.NoError(err)
+	require.Len(found, 1)
+	assert.Equal(bob.ID, found[0].ID)
+	found, err = s.Find(ctx, "https://other.example.com", "", "bob")
+	require.NoError(err)
+	assert.Empty(found)
+	_, err = s.Find(ctx, "https://op.example.com", "", "")
+	assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+
+	// an expired session is removed from the indexes by Find
+	c.expire("cap:session:s_bob")
+	found, err = s.Find(ctx, "", "", "bob")
+	require.NoError(err)
+	assert.Empty(found)
+	assert.NotContains(c.keys(), "cap:session-sub:bob")
+
+	require.NoError(s.Delete(ctx, alice.ID))
+	assert.Empty(c.keys())
+	require.NoError(s.Delete(ctx, alice.ID))
+	_, err = s.Read(ctx, alice.ID)
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+	err = s.Write(ctx, nil)
+	assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+}
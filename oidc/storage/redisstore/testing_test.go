@@ -0,0 +1,173 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// testClient is an in-memory Client, which only understands the commands
+// used by the stores so they can be tested without a Redis server.
+type testClient struct {
+	mu      sync.Mutex
+	strings map[string][]byte
+	sets    map[string]map[string]bool
+	expires map[string]time.Time
+	// commands are the name of every command run
+	commands []string
+}
+
+func newTestClient() *testClient {
+	return &testClient{
+		strings: map[string][]byte{},
+		sets:    map[string]map[string]bool{},
+		expires: map[string]time.Time{},
+	}
+}
+
+// expire expires the key, as if its expiration passed.
+func (c *testClient) expire(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expires[key] = time.Now().Add(-time.Millisecond)
+}
+
+// keys returns the keys which exist, in order.
+func (c *testClient) keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []string
+	for k := range c.strings {
+		if c.exists(k) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range c.sets {
+		if c.exists(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// exists returns true when the key exists, removing it when it's expired.
+func (c *testClient) exists(key string) bool {
+	if exp, ok := c.expires[key]; ok && !time.Now().Before(exp) {
+		delete(c.strings, key)
+		delete(c.sets, key)
+		delete(c.expires, key)
+	}
+	_, isString := c.strings[key]
+	_, isSet := c.sets[key]
+	return isString || isSet
+}
+
+func (c *testClient) Do(_ context.Context, args ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cmd := strings.ToUpper(fmt.Sprint(args[0]))
+	c.commands = append(c.commands, cmd)
+	keys := make([]string, 0, len(args)-1)
+	for _, a := range args[1:] {
+		keys = append(keys, fmt.Sprint(a))
+	}
+	switch cmd {
+	case "GET":
+		if !c.exists(keys[0]) {
+			return nil, nil
+		}
+		return c.strings[keys[0]], nil
+	case "SET":
+		var (
+			ttl    time.Duration
+			nx, xx bool
+		)
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(fmt.Sprint(args[i])) {
+			case "PX":
+				i++
+				ttl = time.Duration(args[i].(int64)) * time.Millisecond
+			case "NX":
+				nx = true
+			case "XX":
+				xx = true
+			default:
+				return nil, fmt.Errorf("unsupported SET argument: %v", args[i])
+			}
+		}
+		exists := c.exists(keys[0])
+		if (nx && exists) || (xx && !exists) {
+			return nil, nil
+		}
+		switch v := args[2].(type) {
+		case []byte:
+			c.strings[keys[0]] = v
+		default:
+			c.strings[keys[0]] = []byte(fmt.Sprint(v))
+		}
+		delete(c.expires, keys[0])
+		if ttl > 0 {
+			c.expires[keys[0]] = time.Now().Add(ttl)
+		}
+		return "OK", nil
+	case "DEL":
+		var n int64
+		for _, k := range keys {
+			if c.exists(k) {
+				delete(c.strings, k)
+				delete(c.sets, k)
+				delete(c.expires, k)
+				n++
+			}
+		}
+		return n, nil
+	case "EXISTS":
+		if c.exists(keys[0]) {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case "PTTL":
+		if !c.exists(keys[0]) {
+			return int64(-2), nil
+		}
+		exp, ok := c.expires[keys[0]]
+		if !ok {
+			return int64(-1), nil
+		}
+		return milliseconds(time.Until(exp)), nil
+	case "SADD":
+		c.exists(keys[0])
+		if c.sets[keys[0]] == nil {
+			c.sets[keys[0]] = map[string]bool{}
+		}
+		for _, m := range keys[1:] {
+			c.sets[keys[0]][m] = true
+		}
+		return int64(len(keys) - 1), nil
+	case "SREM":
+		if !c.exists(keys[0]) {
+			return int64(0), nil
+		}
+		for _, m := range keys[1:] {
+			delete(c.sets[keys[0]], m)
+		}
+		if len(c.sets[keys[0]]) == 0 {
+			delete(c.sets, keys[0])
+		}
+		return int64(len(keys) - 1), nil
+	case "SMEMBERS":
+		members := []interface{}{}
+		if c.exists(keys[0]) {
+			for m := range c.sets[keys[0]] {
+				members = append(members, []byte(m))
+			}
+		}
+		return members, nil
+	default:
+		return nil, fmt.Errorf("unsupported command: %s", cmd)
+	}
+}
@@ -0,0 +1,95 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/clientauth"
+)
+
+// TokenStore implements the clientauth package's TokenStore interface using
+// Redis.  Tokens are persisted using oidc.MarshalToken, and their keys don't
+// expire since a token may be refreshed.  The tokens are encrypted when the
+// store has an oidc.Wrapper (see WithWrapper).
+//
+// It is concurrently safe.
+type TokenStore struct {
+	client  Client
+	prefix  string
+	wrapper oidc.Wrapper
+}
+
+// ensure that TokenStore implements the clientauth.TokenStore interface.
+var _ clientauth.TokenStore = (*TokenStore)(nil)
+
+// NewTokenStore creates a new TokenStore.
+//
+// Supported options: WithKeyPrefix and WithWrapper
+func NewTokenStore(c Client, opt ...oidc.Option) (*TokenStore, error) {
+	const op = "redisstore.NewTokenStore"
+	if c == nil {
+		return nil, fmt.Errorf("%s: client is nil: %w", op, oidc.ErrNilParameter)
+	}
+	opts := getStoreOpts(opt...)
+	return &TokenStore{client: c, prefix: opts.withKeyPrefix, wrapper: opts.withWrapper}, nil
+}
+
+// Read implements the clientauth.TokenStore.Read() interface function and
+// returns an *oidc.Tk.  If a token is not found for the key, then an error
+// wrapping oidc.ErrNotFound is returned.
+func (s *TokenStore) Read(ctx context.Context, key string) (oidc.Token, error) {
+	const op = "TokenStore.Read"
+	reply, err := s.client.Do(ctx, "GET", s.key(key))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	data, err := bytesReply(reply)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", op, err)
+	case data == nil:
+		return nil, fmt.Errorf("%s: token for key %q: %w", op, key, oidc.ErrNotFound)
+	}
+	if data, err = unwrap(ctx, s.wrapper, data, wrapAAD("token", key)); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	tk, err := oidc.UnmarshalToken(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return tk, nil
+}
+
+// Write implements the clientauth.TokenStore.Write() interface function.
+func (s *TokenStore) Write(ctx context.Context, key string, t oidc.Token) error {
+	const op = "TokenStore.Write"
+	if key == "" {
+		return fmt.Errorf("%s: key is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	data, err := oidc.MarshalToken(t)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if data, err = wrap(ctx, s.wrapper, data, wrapAAD("token", key)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := s.client.Do(ctx, "SET", s.key(key), data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Delete implements the clientauth.TokenStore.Delete() interface function.
+func (s *TokenStore) Delete(ctx context.Context, key string) error {
+	const op = "TokenStore.Delete"
+	if _, err := s.client.Do(ctx, "DEL", s.key(key)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// key returns the Redis key of the token's key.
+func (s *TokenStore) key(key string) string {
+	return s.prefix + "token:" + key
+}
@@ -0,0 +1,42 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestTokenStore(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	c := newTestClient()
+	s, err := NewTokenStore(c)
+	require.NoError(err)
+
+	_, err = s.Read(ctx, "alice")
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+	tk, err := oidc.NewToken("id-token", &oauth2.Token{AccessToken: "access-token", RefreshToken: "refresh-token"})
+	require.NoError(err)
+	require.NoError(s.Write(ctx, "alice", tk))
+	assert.Equal([]string{"cap:token:alice"}, c.keys())
+	got, err := s.Read(ctx, "alice")
+	require.NoError(err)
+	assert.Equal(tk.IDToken(), got.IDToken())
+	assert.Equal(tk.RefreshToken(), got.RefreshToken())
+
+	require.NoError(s.Delete(ctx, "alice"))
+	_, err = s.Read(ctx, "alice")
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+	err = s.Write(ctx, "", tk)
+	assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+	_, err = NewTokenStore(nil)
+	assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+}
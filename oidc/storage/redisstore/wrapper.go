@@ -0,0 +1,60 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// encryptedData is the persisted form of a key's value when the store has an
+// oidc.Wrapper (see WithWrapper).
+type encryptedData struct {
+	Wrapped *oidc.EncryptedBlob `json:"wrapped"`
+}
+
+// wrapAAD returns the additional authenticated data used to encrypt the
+// value of a request, token or session, which prevents the encrypted value
+// from being used as the value of a different key.  It doesn't include the
+// store's key prefix.
+func wrapAAD(kind, id string) []byte {
+	return []byte("cap:redisstore:" + kind + ":" + id)
+}
+
+// wrap encrypts the data using the wrapper, or returns the data unchanged when
+// the wrapper is nil.
+func wrap(ctx context.Context, w oidc.Wrapper, data, aad []byte) ([]byte, error) {
+	const op = "redisstore.wrap"
+	if w == nil {
+		return data, nil
+	}
+	blob, err := w.Encrypt(ctx, data, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to encrypt data: %w", op, err)
+	}
+	wrapped, err := json.Marshal(encryptedData{Wrapped: blob})
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to marshal encrypted data: %w", op, err)
+	}
+	return wrapped, nil
+}
+
+// unwrap decrypts data that was encrypted by wrap(...).  When the store has a
+// wrapper, unencrypted data is still returned, so data written before the
+// wrapper was added can be read and is encrypted the next time it's written.
+func unwrap(ctx context.Context, w oidc.Wrapper, data, aad []byte) ([]byte, error) {
+	const op = "redisstore.unwrap"
+	var encrypted encryptedData
+	if err := json.Unmarshal(data, &encrypted); err != nil || encrypted.Wrapped == nil || len(encrypted.Wrapped.Ciphertext) == 0 {
+		return data, nil
+	}
+	if w == nil {
+		return nil, fmt.Errorf("%s: data is encrypted and the store doesn't have a wrapper: %w", op, oidc.ErrInvalidParameter)
+	}
+	plaintext, err := w.Decrypt(ctx, encrypted.Wrapped, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to decrypt data: %w", op, err)
+	}
+	return plaintext, nil
+}
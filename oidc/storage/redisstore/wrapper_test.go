@@ -0,0 +1,131 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestWithWrapper(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	c := newTestClient()
+	w, err := oidc.NewAESGCMWrapper("key-1", []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+
+	// value returns the persisted value of the key, and asserts that it's
+	// encrypted without any of the plaintexts.
+	value := func(t *testing.T, key string, plaintexts ...string) []byte {
+		t.Helper()
+		c.mu.Lock()
+		data, ok := c.strings[key]
+		c.mu.Unlock()
+		require.True(t, ok)
+		var encrypted encryptedData
+		require.NoError(t, json.Unmarshal(data, &encrypted))
+		require.NotNil(t, encrypted.Wrapped)
+		assert.Equal(t, w.KeyID(), encrypted.Wrapped.KeyID)
+		for _, p := range plaintexts {
+			assert.NotContains(t, string(data), p)
+		}
+		return data
+	}
+
+	t.Run("tokens", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		plain, err := NewTokenStore(c)
+		require.NoError(err)
+		s, err := NewTokenStore(c, WithWrapper(w))
+		require.NoError(err)
+
+		// tokens written before the wrapper was added are still read
+		tk, err := oidc.NewToken("id-token", &oauth2.Token{AccessToken: "access-token", RefreshToken: "refresh-token"})
+		require.NoError(err)
+		require.NoError(plain.Write(ctx, "alice", tk))
+		got, err := s.Read(ctx, "alice")
+		require.NoError(err)
+		assert.Equal(tk.RefreshToken(), got.RefreshToken())
+
+		require.NoError(s.Write(ctx, "alice", tk))
+		aliceData := value(t, "cap:token:alice", "id-token", "access-token", "refresh-token")
+		got, err = s.Read(ctx, "alice")
+		require.NoError(err)
+		assert.Equal(tk.IDToken(), got.IDToken())
+		assert.Equal(tk.RefreshToken(), got.RefreshToken())
+
+		_, err = plain.Read(ctx, "alice")
+		assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+
+		// encrypted values can't be used as another key's token
+		_, err = c.Do(ctx, "SET", "cap:token:bob", aliceData)
+		require.NoError(err)
+		_, err = s.Read(ctx, "bob")
+		assert.Truef(errors.Is(err, oidc.ErrDecryptionFailed), "wanted \"%s\" but got \"%s\"", oidc.ErrDecryptionFailed, err)
+	})
+	t.Run("requests", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		s, err := NewRequestStore(c, WithWrapper(w))
+		require.NoError(err)
+		v, err := oidc.NewCodeVerifier()
+		require.NoError(err)
+		r, err := oidc.NewRequest(time.Minute, "https://app.example.com/callback", oidc.WithPKCE(v))
+		require.NoError(err)
+		require.NoError(s.Write(ctx, r))
+		value(t, "cap:request:"+r.State(), r.Nonce(), v.Verifier(), "https://app.example.com/callback")
+
+		got, err := s.Read(ctx, r.State())
+		require.NoError(err)
+		assert.Equal(r.Nonce(), got.Nonce())
+		assert.Equal(v.Verifier(), got.PKCEVerifier().Verifier())
+	})
+	t.Run("sessions", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		s, err := NewSessionStore(c, WithWrapper(w))
+		require.NoError(err)
+		now := time.Now().UTC().Truncate(time.Second)
+		sess := &session.Session{
+			ID:        "s_alice",
+			Claims:    map[string]interface{}{"iss": "https://op.example.com", "sub": "alice", "sid": "sid-1", "email": "alice@example.com"},
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Minute),
+		}
+		require.NoError(s.Write(ctx, sess))
+		value(t, "cap:session:s_alice", "alice@example.com")
+
+		// touching a session keeps it encrypted
+		require.NoError(s.Touch(ctx, sess.ID, now.Add(2*time.Minute)))
+		value(t, "cap:session:s_alice", "alice@example.com")
+		got, err := s.Read(ctx, sess.ID)
+		require.NoError(err)
+		assert.Equal("alice@example.com", got.Claims["email"])
+
+		found, err := s.Find(ctx, "https://op.example.com", "sid-1", "")
+		require.NoError(err)
+		require.Len(found, 1)
+		assert.Equal("alice@example.com", found[0].Claims["email"])
+	})
+	t.Run("rotation", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		s, err := NewTokenStore(c, WithWrapper(w))
+		require.NoError(err)
+		tk, err := oidc.NewToken("id-token", &oauth2.Token{AccessToken: "access-token"})
+		require.NoError(err)
+		require.NoError(s.Write(ctx, "carol", tk))
+
+		require.NoError(w.Rotate("key-2", []byte("fedcba9876543210fedcba9876543210")))
+		got, err := s.Read(ctx, "carol")
+		require.NoError(err)
+		assert.Equal(tk.IDToken(), got.IDToken())
+		// the token is re-encrypted with the current key when it's written
+		require.NoError(s.Write(ctx, "carol", got))
+		value(t, "cap:token:carol", "id-token", "access-token")
+	})
+}
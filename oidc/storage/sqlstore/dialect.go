@@ -0,0 +1,107 @@
+package sqlstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// Dialect is the SQL dialect of a store's database.
+type Dialect int
+
+const (
+	// Postgres is the PostgreSQL dialect.
+	Postgres Dialect = iota + 1
+
+	// MySQL is the MySQL (and MariaDB) dialect.
+	MySQL
+)
+
+// String returns the dialect's name.
+func (d Dialect) String() string {
+	switch d {
+	case Postgres:
+		return "postgres"
+	case MySQL:
+		return "mysql"
+	default:
+		return "unknown"
+	}
+}
+
+// valid returns an error when the dialect isn't supported.
+func (d Dialect) valid() error {
+	const op = "Dialect.valid"
+	switch d {
+	case Postgres, MySQL:
+		return nil
+	default:
+		return fmt.Errorf("%s: unsupported dialect %d: %w", op, d, oidc.ErrInvalidParameter)
+	}
+}
+
+// blobType is the column type of persisted data.
+func (d Dialect) blobType() string {
+	if d == MySQL {
+		return "LONGBLOB"
+	}
+	return "BYTEA"
+}
+
+// timeType is the column type of timestamps.
+func (d Dialect) timeType() string {
+	if d == MySQL {
+		return "DATETIME(6)"
+	}
+	return "TIMESTAMPTZ"
+}
+
+// sha256Hex returns an expression of the hex encoded SHA-256 hash of the
+// column's value, which matches tokenKeyHash(...).  Postgres requires version
+// 11 or later for its sha256 function.
+func (d Dialect) sha256Hex(col string) string {
+	if d == MySQL {
+		return "SHA2(" + col + ", 256)"
+	}
+	return "encode(sha256(convert_to(" + col + ", 'UTF8')), 'hex')"
+}
+
+// bind rewrites the query's ? placeholders for the dialect.
+func (d Dialect) bind(query string) string {
+	if d != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// upsert returns a query which inserts a row, or updates the row with the same
+// key.
+func (d Dialect) upsert(table, key string, cols ...string) string {
+	all := append([]string{key}, cols...)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(all)), ", ")
+	updates := make([]string, 0, len(cols))
+	for _, c := range cols {
+		if d == MySQL {
+			updates = append(updates, c+" = VALUES("+c+")")
+			continue
+		}
+		updates = append(updates, c+" = EXCLUDED."+c)
+	}
+	q := "INSERT INTO " + table + " (" + strings.Join(all, ", ") + ") VALUES (" + placeholders + ")"
+	if d == MySQL {
+		return q + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+	}
+	return d.bind(q + " ON CONFLICT (" + key + ") DO UPDATE SET " + strings.Join(updates, ", "))
+}
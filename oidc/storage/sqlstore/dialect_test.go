@@ -0,0 +1,83 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialect(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	assert.Equal("postgres", Postgres.String())
+	assert.Equal("mysql", MySQL.String())
+	assert.Equal("unknown", Dialect(0).String())
+	err := Dialect(0).valid()
+	assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+
+	assert.Equal("SELECT data FROM t WHERE a = $1 AND b = $2", Postgres.bind("SELECT data FROM t WHERE a = ? AND b = ?"))
+	assert.Equal("SELECT data FROM t WHERE a = ? AND b = ?", MySQL.bind("SELECT data FROM t WHERE a = ? AND b = ?"))
+	assert.Equal(
+		"INSERT INTO t (k, a, b) VALUES ($1, $2, $3) ON CONFLICT (k) DO UPDATE SET a = EXCLUDED.a, b = EXCLUDED.b",
+		Postgres.upsert("t", "k", "a", "b"),
+	)
+	assert.Equal(
+		"INSERT INTO t (k, a, b) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE a = VALUES(a), b = VALUES(b)",
+		MySQL.upsert("t", "k", "a", "b"),
+	)
+	assert.Equal("encode(sha256(convert_to(k, 'UTF8')), 'hex')", Postgres.sha256Hex("k"))
+	assert.Equal("SHA2(k, 256)", MySQL.sha256Hex("k"))
+}
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	for _, d := range []Dialect{Postgres, MySQL} {
+		d := d
+		t.Run(d.String(), func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			db, tdb := testOpenDB(t, d)
+			for _, table := range []string{migrationsTable, "cap_requests", "cap_tokens", "cap_sessions"} {
+				assert.Contains(tdb.tables, table)
+			}
+			assert.NotContains(tdb.tables, "cap_tokens_v2")
+			assert.Equal([]string{"key_hash", "data"}, tdb.tables["cap_tokens"].cols)
+			assert.Len(tdb.tables[migrationsTable].rows, 2)
+
+			// migrating again doesn't reapply the migrations
+			require.NoError(Migrate(ctx, db, d))
+			assert.Len(tdb.tables[migrationsTable].rows, 2)
+
+			migrations, err := Migrations(d)
+			require.NoError(err)
+			require.Len(migrations, 2)
+			for i, m := range migrations {
+				assert.Equal(i+1, m.Version)
+				for _, stmt := range m.Statements {
+					if d == MySQL {
+						assert.NotContains(stmt, "BYTEA")
+						assert.NotContains(stmt, "TIMESTAMPTZ")
+						continue
+					}
+					assert.NotContains(stmt, "LONGBLOB")
+					assert.NotContains(stmt, "DATETIME")
+				}
+			}
+		})
+	}
+	t.Run("invalid", func(t *testing.T) {
+		assert := assert.New(t)
+		err := Migrate(ctx, nil, Postgres)
+		assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+		db, err := sql.Open("cap-sqlstore-test", "invalid-dialect")
+		require.NoError(t, err)
+		defer db.Close()
+		err = Migrate(ctx, db, Dialect(0))
+		assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+	})
+}
@@ -0,0 +1,44 @@
+/*
+sqlstore is a package that provides database/sql backed stores for the
+requests, tokens and sessions of production deployments, so each deployment
+doesn't need to write (and debug) its own persistence layer.
+
+* a RequestStore implements the callback package's RequestReader,
+RequestWriter and PhaseTracker interfaces
+
+* a TokenStore implements the clientauth package's TokenStore interface
+
+* a SessionStore implements the session package's Store and Finder interfaces
+
+* the Postgres (11 or later) and MySQL dialects are supported, and Migrate
+creates (and upgrades) their schemas, which are versioned in the
+cap_schema_migrations table
+
+* requests, tokens and sessions are persisted using their versioned formats
+(see oidc.RequestFormatVersion), so data persisted by this release can be
+read by future releases
+
+* the persisted requests, tokens and sessions are encrypted when the stores
+have an oidc.Wrapper (see WithWrapper)
+
+The package doesn't depend on a database driver, so the app must import one
+(like github.com/jackc/pgx/v5/stdlib or github.com/go-sql-driver/mysql).  The
+persisted data includes nonces, PKCE verifiers and unredacted tokens, so the
+stores should have a wrapper and the database must be secured accordingly.
+
+Example:
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+	  // handle err
+	}
+	if err := sqlstore.Migrate(ctx, db, sqlstore.Postgres); err != nil {
+	  // handle err
+	}
+	requests, err := sqlstore.NewRequestStore(db, sqlstore.Postgres)
+	if err != nil {
+	  // handle err
+	}
+	h, err := callback.AuthCode(ctx, p, requests, successFn, errorFn)
+*/
+package sqlstore
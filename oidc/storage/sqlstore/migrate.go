@@ -0,0 +1,121 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// migrationsTable records the versions of the schema's applied migrations.
+const migrationsTable = "cap_schema_migrations"
+
+// Migration is a version of the stores' schema.
+type Migration struct {
+	// Version is the schema's version, which starts at 1.
+	Version int
+
+	// Statements are the DDL statements which upgrade the schema from the
+	// prior version.
+	Statements []string
+}
+
+// Migrations returns the schema migrations for the dialect, in order, which
+// can be used by apps that manage their schemas with their own migration
+// tools.  See Migrate(...) for applying them.
+func Migrations(d Dialect) ([]Migration, error) {
+	const op = "sqlstore.Migrations"
+	if err := d.valid(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	blob, ts := d.blobType(), d.timeType()
+	return []Migration{
+		{
+			Version: 1,
+			Statements: []string{
+				"CREATE TABLE cap_requests (state VARCHAR(255) NOT NULL PRIMARY KEY, data " + blob + " NOT NULL, phase INTEGER NOT NULL, expires_at " + ts + " NOT NULL)",
+				"CREATE INDEX cap_requests_expires_at ON cap_requests (expires_at)",
+				"CREATE TABLE cap_tokens (token_key VARCHAR(255) NOT NULL PRIMARY KEY, data " + blob + " NOT NULL)",
+				"CREATE TABLE cap_sessions (id VARCHAR(255) NOT NULL PRIMARY KEY, data " + blob + " NOT NULL, iss VARCHAR(255) NOT NULL, sid VARCHAR(255) NOT NULL, sub VARCHAR(255) NOT NULL, expires_at " + ts + " NOT NULL)",
+				"CREATE INDEX cap_sessions_sid ON cap_sessions (sid)",
+				"CREATE INDEX cap_sessions_sub ON cap_sessions (sub)",
+				"CREATE INDEX cap_sessions_expires_at ON cap_sessions (expires_at)",
+			},
+		},
+		{
+			// cap_tokens is keyed by the hash of the token key (see
+			// TokenStore), since keys may be longer than an indexed column
+			// allows.  The existing tokens are kept.
+			Version: 2,
+			Statements: []string{
+				"CREATE TABLE cap_tokens_v2 (key_hash CHAR(64) NOT NULL PRIMARY KEY, data " + blob + " NOT NULL)",
+				"INSERT INTO cap_tokens_v2 (key_hash, data) SELECT " + d.sha256Hex("token_key") + ", data FROM cap_tokens",
+				"DROP TABLE cap_tokens",
+				"ALTER TABLE cap_tokens_v2 RENAME TO cap_tokens",
+			},
+		},
+	}, nil
+}
+
+// Migrate creates (or upgrades) the stores' schema in the db, by applying the
+// dialect's migrations which haven't been applied yet.  Each migration is
+// applied in a transaction and recorded in the cap_schema_migrations table.
+// MySQL implicitly commits DDL statements, so a migration which fails part way
+// must be repaired manually.
+//
+// Migrate should be run once per deployment (rather than concurrently by
+// every instance of an app).
+func Migrate(ctx context.Context, db *sql.DB, d Dialect) error {
+	const op = "sqlstore.Migrate"
+	if db == nil {
+		return fmt.Errorf("%s: db is nil: %w", op, oidc.ErrNilParameter)
+	}
+	migrations, err := Migrations(d)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	create := "CREATE TABLE IF NOT EXISTS " + migrationsTable + " (version INTEGER NOT NULL PRIMARY KEY, applied_at " + d.timeType() + " NOT NULL)"
+	if _, err := db.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("%s: unable to create %s: %w", op, migrationsTable, err)
+	}
+	var current int
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM "+migrationsTable).Scan(&current); err != nil {
+		return fmt.Errorf("%s: unable to read schema version: %w", op, err)
+	}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := applyMigration(ctx, db, d, m); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration applies the migration and records its version in a
+// transaction.
+func applyMigration(ctx context.Context, db *sql.DB, d Dialect, m Migration) error {
+	const op = "sqlstore.applyMigration"
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: unable to begin transaction: %w", op, err)
+	}
+	for _, stmt := range m.Statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("%s: version %d: %w", op, m.Version, err)
+		}
+	}
+	insert := d.bind("INSERT INTO " + migrationsTable + " (version, applied_at) VALUES (?, ?)")
+	if _, err := tx.ExecContext(ctx, insert, m.Version, time.Now().UTC()); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("%s: unable to record version %d: %w", op, m.Version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: unable to commit version %d: %w", op, m.Version, err)
+	}
+	return nil
+}
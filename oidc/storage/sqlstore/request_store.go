@@ -0,0 +1,186 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/callback"
+)
+
+// RequestStore implements the callback package's RequestReader, RequestWriter
+// and PhaseTracker interfaces using the cap_requests table, so requests can be
+// shared by every instance of an app.  Expired requests aren't read by
+// callbacks, and should be removed periodically using DeleteExpired.  The
+// requests (including their nonce and PKCE verifier) are encrypted when the
+// store has an oidc.Wrapper (see WithWrapper).
+//
+// It is concurrently safe.
+type RequestStore struct {
+	db      *sql.DB
+	dialect Dialect
+	wrapper oidc.Wrapper
+}
+
+// ensure that RequestStore implements the callback interfaces.
+var (
+	_ callback.RequestReader = (*RequestStore)(nil)
+	_ callback.RequestWriter = (*RequestStore)(nil)
+	_ callback.PhaseTracker  = (*RequestStore)(nil)
+)
+
+// NewRequestStore creates a new RequestStore, whose db has the schema created
+// by Migrate(...).
+//
+// Supported options: WithWrapper
+func NewRequestStore(db *sql.DB, d Dialect, opt ...oidc.Option) (*RequestStore, error) {
+	const op = "sqlstore.NewRequestStore"
+	if db == nil {
+		return nil, fmt.Errorf("%s: db is nil: %w", op, oidc.ErrNilParameter)
+	}
+	if err := d.valid(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	opts := getStoreOpts(opt...)
+	return &RequestStore{db: db, dialect: d, wrapper: opts.withWrapper}, nil
+}
+
+// Read implements the callback.RequestReader.Read() interface function and
+// returns an *oidc.Req.  If a request is not found for the state, then an
+// error wrapping oidc.ErrNotFound is returned.
+func (s *RequestStore) Read(ctx context.Context, state string) (oidc.Request, error) {
+	const op = "RequestStore.Read"
+	var data []byte
+	err := s.db.QueryRowContext(ctx, s.dialect.bind("SELECT data FROM cap_requests WHERE state = ?"), state).Scan(&data)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("%s: request for state %q: %w", op, state, oidc.ErrNotFound)
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	data, err = unwrap(ctx, s.wrapper, data, wrapAAD("cap_requests", state))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	r := &oidc.Req{}
+	if err := r.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return r, nil
+}
+
+// Write implements the callback.RequestWriter.Write() interface function,
+// replacing any existing request for the same state.  The request's flow is
+// in the callback.PhaseIssued phase.  The request must be an *oidc.Req.
+func (s *RequestStore) Write(ctx context.Context, oidcRequest oidc.Request) error {
+	const op = "RequestStore.Write"
+	r, err := persistedRequest(oidcRequest)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if data, err = wrap(ctx, s.wrapper, data, wrapAAD("cap_requests", r.State())); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	upsert := s.dialect.upsert("cap_requests", "state", "data", "phase", "expires_at")
+	if _, err := s.db.ExecContext(ctx, upsert, r.State(), data, int(callback.PhaseIssued), r.Expiration().UTC()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Phase returns the phase of the request's flow.  If a request is not found
+// for the state, then an error wrapping oidc.ErrNotFound is returned.
+func (s *RequestStore) Phase(ctx context.Context, state string) (callback.FlowPhase, error) {
+	const op = "RequestStore.Phase"
+	var phase int
+	err := s.db.QueryRowContext(ctx, s.dialect.bind("SELECT phase FROM cap_requests WHERE state = ?"), state).Scan(&phase)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return callback.PhaseUnknown, fmt.Errorf("%s: request for state %q: %w", op, state, oidc.ErrNotFound)
+	case err != nil:
+		return callback.PhaseUnknown, fmt.Errorf("%s: %w", op, err)
+	}
+	return callback.FlowPhase(phase), nil
+}
+
+// Transition implements the callback.PhaseTracker.Transition() interface
+// function, using a conditional update so only one callback can transition a
+// flow's phase.
+func (s *RequestStore) Transition(ctx context.Context, state string, from, to callback.FlowPhase) error {
+	const op = "RequestStore.Transition"
+	if from < callback.PhaseIssued || to != from+1 || to > callback.PhaseExchanged {
+		return fmt.Errorf("%s: %s to %s is not a valid transition: %w", op, from, to, oidc.ErrInvalidParameter)
+	}
+	update := s.dialect.bind("UPDATE cap_requests SET phase = ? WHERE state = ? AND phase = ?")
+	result, err := s.db.ExecContext(ctx, update, int(to), state, int(from))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 1 {
+		return nil
+	}
+	current, err := s.Phase(ctx, state)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return fmt.Errorf("%s: %w", op, &callback.PhaseError{State: state, Current: current, From: from, To: to})
+}
+
+// Delete the request for the state, which should be done once its flow is
+// completed.  It's not an error to delete a state that doesn't exist.
+func (s *RequestStore) Delete(ctx context.Context, state string) error {
+	const op = "RequestStore.Delete"
+	if _, err := s.db.ExecContext(ctx, s.dialect.bind("DELETE FROM cap_requests WHERE state = ?"), state); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// DeleteExpired removes the requests which are expired at the time now, and
+// returns the number removed.
+func (s *RequestStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	const op = "RequestStore.DeleteExpired"
+	return deleteExpired(ctx, s.db, s.dialect, op, "cap_requests", now)
+}
+
+// persistedRequest returns the request as an *oidc.Req, which is the only
+// Request implementation that can be persisted.
+func persistedRequest(oidcRequest oidc.Request) (*oidc.Req, error) {
+	const op = "sqlstore.persistedRequest"
+	if oidcRequest == nil {
+		return nil, fmt.Errorf("%s: request is nil: %w", op, oidc.ErrNilParameter)
+	}
+	r, ok := oidcRequest.(*oidc.Req)
+	if !ok {
+		return nil, fmt.Errorf("%s: request is a %T and must be an *oidc.Req: %w", op, oidcRequest, oidc.ErrInvalidParameter)
+	}
+	if r.State() == "" {
+		return nil, fmt.Errorf("%s: request state is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	return r, nil
+}
+
+// deleteExpired removes the table's rows which are expired at the time now,
+// and returns the number removed.
+func deleteExpired(ctx context.Context, db *sql.DB, d Dialect, op, table string, now time.Time) (int64, error) {
+	result, err := db.ExecContext(ctx, d.bind("DELETE FROM "+table+" WHERE expires_at <= ?"), now.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return n, nil
+}
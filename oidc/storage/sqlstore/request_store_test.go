@@ -0,0 +1,94 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/callback"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	for _, d := range []Dialect{Postgres, MySQL} {
+		d := d
+		t.Run(d.String(), func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			db, _ := testOpenDB(t, d)
+			s, err := NewRequestStore(db, d)
+			require.NoError(err)
+
+			v, err := oidc.NewCodeVerifier()
+			require.NoError(err)
+			r, err := oidc.NewRequest(time.Minute, "https://app.example.com/callback", oidc.WithPKCE(v), oidc.WithScopes("email"))
+			require.NoError(err)
+			require.NoError(s.Write(ctx, r))
+
+			got, err := s.Read(ctx, r.State())
+			require.NoError(err)
+			assert.Equal(r.State(), got.State())
+			assert.Equal(r.Nonce(), got.Nonce())
+			assert.Equal(r.Scopes(), got.Scopes())
+			assert.Equal(v.Verifier(), got.PKCEVerifier().Verifier())
+
+			phase, err := s.Phase(ctx, r.State())
+			require.NoError(err)
+			assert.Equal(callback.PhaseIssued, phase)
+
+			require.NoError(s.Transition(ctx, r.State(), callback.PhaseIssued, callback.PhaseCallbackReceived))
+			err = s.Transition(ctx, r.State(), callback.PhaseIssued, callback.PhaseCallbackReceived)
+			assert.Truef(errors.Is(err, oidc.ErrDuplicateCallback), "wanted \"%s\" but got \"%s\"", oidc.ErrDuplicateCallback, err)
+			var phaseErr *callback.PhaseError
+			require.True(errors.As(err, &phaseErr))
+			assert.Equal(callback.PhaseCallbackReceived, phaseErr.Current)
+			require.NoError(s.Transition(ctx, r.State(), callback.PhaseCallbackReceived, callback.PhaseExchanged))
+
+			// rewriting a request restarts its flow
+			require.NoError(s.Write(ctx, r))
+			err = s.Transition(ctx, r.State(), callback.PhaseCallbackReceived, callback.PhaseExchanged)
+			assert.Truef(errors.Is(err, oidc.ErrOutOfOrderCallback), "wanted \"%s\" but got \"%s\"", oidc.ErrOutOfOrderCallback, err)
+
+			err = s.Transition(ctx, r.State(), callback.PhaseIssued, callback.PhaseExchanged)
+			assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+			err = s.Transition(ctx, "unknown", callback.PhaseIssued, callback.PhaseCallbackReceived)
+			assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+			require.NoError(s.Delete(ctx, r.State()))
+			_, err = s.Read(ctx, r.State())
+			assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+			require.NoError(s.Delete(ctx, r.State()))
+
+			err = s.Write(ctx, nil)
+			assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+		})
+	}
+}
+
+func TestRequestStore_DeleteExpired(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	db, _ := testOpenDB(t, Postgres)
+	s, err := NewRequestStore(db, Postgres)
+	require.NoError(err)
+
+	short, err := oidc.NewRequest(time.Minute, "https://app.example.com/callback")
+	require.NoError(err)
+	long, err := oidc.NewRequest(time.Hour, "https://app.example.com/callback")
+	require.NoError(err)
+	require.NoError(s.Write(ctx, short))
+	require.NoError(s.Write(ctx, long))
+
+	n, err := s.DeleteExpired(ctx, time.Now().Add(2*time.Minute))
+	require.NoError(err)
+	assert.Equal(int64(1), n)
+	_, err = s.Read(ctx, short.State())
+	assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+	_, err = s.Read(ctx, long.State())
+	require.NoError(err)
+}
@@ -0,0 +1,208 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/session"
+)
+
+// SessionStore implements the session package's Store and Finder interfaces
+// using the cap_sessions table.  The iss, sid and sub claims of each session
+// are indexed, so its sessions can be found for a provider's back-channel
+// logout.  Expired sessions should be removed periodically using
+// DeleteExpired.  The sessions are encrypted when the store has an
+// oidc.Wrapper (see WithWrapper), although their indexed claims aren't.
+//
+// It is concurrently safe.
+type SessionStore struct {
+	db      *sql.DB
+	dialect Dialect
+	wrapper oidc.Wrapper
+}
+
+// ensure that SessionStore implements the session.Store and session.Finder
+// interfaces.
+var (
+	_ session.Store  = (*SessionStore)(nil)
+	_ session.Finder = (*SessionStore)(nil)
+)
+
+// NewSessionStore creates a new SessionStore, whose db has the schema created
+// by Migrate(...).
+//
+// Supported options: WithWrapper
+func NewSessionStore(db *sql.DB, d Dialect, opt ...oidc.Option) (*SessionStore, error) {
+	const op = "sqlstore.NewSessionStore"
+	if db == nil {
+		return nil, fmt.Errorf("%s: db is nil: %w", op, oidc.ErrNilParameter)
+	}
+	if err := d.valid(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	opts := getStoreOpts(opt...)
+	return &SessionStore{db: db, dialect: d, wrapper: opts.withWrapper}, nil
+}
+
+// Read implements the session.Store.Read() interface function.
+func (s *SessionStore) Read(ctx context.Context, id string) (*session.Session, error) {
+	const op = "SessionStore.Read"
+	var data []byte
+	err := s.db.QueryRowContext(ctx, s.dialect.bind("SELECT data FROM cap_sessions WHERE id = ?"), id).Scan(&data)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("%s: session not found: %w", op, oidc.ErrNotFound)
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	sess, err := s.unmarshal(ctx, id, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return sess, nil
+}
+
+// Write implements the session.Store.Write() interface function.
+func (s *SessionStore) Write(ctx context.Context, sess *session.Session) error {
+	const op = "SessionStore.Write"
+	switch {
+	case sess == nil:
+		return fmt.Errorf("%s: session is nil: %w", op, oidc.ErrNilParameter)
+	case sess.ID == "":
+		return fmt.Errorf("%s: session ID is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	data, err := s.marshal(ctx, sess)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	upsert := s.dialect.upsert("cap_sessions", "id", "data", "iss", "sid", "sub", "expires_at")
+	args := []interface{}{sess.ID, data, claim(sess, "iss"), claim(sess, "sid"), claim(sess, "sub"), sess.ExpiresAt.UTC()}
+	if _, err := s.db.ExecContext(ctx, upsert, args...); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Touch implements the session.Store.Touch() interface function.  The
+// session is only updated when it exists, so a session that's deleted while
+// it's being touched stays deleted.
+func (s *SessionStore) Touch(ctx context.Context, id string, expiresAt time.Time) error {
+	const op = "SessionStore.Touch"
+	sess, err := s.Read(ctx, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	sess.ExpiresAt = expiresAt
+	data, err := s.marshal(ctx, sess)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	update := s.dialect.bind("UPDATE cap_sessions SET data = ?, expires_at = ? WHERE id = ?")
+	result, err := s.db.ExecContext(ctx, update, data, expiresAt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: session not found: %w", op, oidc.ErrNotFound)
+	}
+	return nil
+}
+
+// Delete implements the session.Store.Delete() interface function.
+func (s *SessionStore) Delete(ctx context.Context, id string) error {
+	const op = "SessionStore.Delete"
+	if _, err := s.db.ExecContext(ctx, s.dialect.bind("DELETE FROM cap_sessions WHERE id = ?"), id); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Find implements the session.Finder.Find() interface function.
+func (s *SessionStore) Find(ctx context.Context, iss, sid, sub string) ([]*session.Session, error) {
+	const op = "SessionStore.Find"
+	if sid == "" && sub == "" {
+		return nil, fmt.Errorf("%s: sid and sub are empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	var where []string
+	var args []interface{}
+	for _, c := range []struct{ col, value string }{{"iss", iss}, {"sid", sid}, {"sub", sub}} {
+		if c.value == "" {
+			continue
+		}
+		where = append(where, c.col+" = ?")
+		args = append(args, c.value)
+	}
+	query := s.dialect.bind("SELECT id, data FROM cap_sessions WHERE " + strings.Join(where, " AND "))
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+	var found []*session.Session
+	for rows.Next() {
+		var id string
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		sess, err := s.unmarshal(ctx, id, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		found = append(found, sess)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return found, nil
+}
+
+// DeleteExpired removes the sessions which are expired at the time now, and
+// returns the number removed.
+func (s *SessionStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	const op = "SessionStore.DeleteExpired"
+	return deleteExpired(ctx, s.db, s.dialect, op, "cap_sessions", now)
+}
+
+// marshal returns the session's data, which is encrypted when the store has a
+// wrapper.
+func (s *SessionStore) marshal(ctx context.Context, sess *session.Session) ([]byte, error) {
+	const op = "SessionStore.marshal"
+	data, err := sess.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if data, err = wrap(ctx, s.wrapper, data, wrapAAD("cap_sessions", sess.ID)); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return data, nil
+}
+
+// unmarshal returns the session for the ID's data.
+func (s *SessionStore) unmarshal(ctx context.Context, id string, data []byte) (*session.Session, error) {
+	const op = "SessionStore.unmarshal"
+	data, err := unwrap(ctx, s.wrapper, data, wrapAAD("cap_sessions", id))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	sess := &session.Session{}
+	if err := sess.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return sess, nil
+}
+
+// claim returns the session's string claim, or an empty string.
+func claim(sess *session.Session, name string) string {
+	v, _ := sess.Claims[name].(string)
+	return v
+}
@@ -0,0 +1,81 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, d := range []Dialect{Postgres, MySQL} {
+		d := d
+		t.Run(d.String(), func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			db, _ := testOpenDB(t, d)
+			s, err := NewSessionStore(db, d)
+			require.NoError(err)
+
+			alice := &session.Session{
+				ID:        "s_alice",
+				Claims:    map[string]interface{}{"iss": "https://op.example.com", "sub": "alice", "sid": "sid-1"},
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Minute),
+			}
+			bob := &session.Session{
+				ID:        "s_bob",
+				Claims:    map[string]interface{}{"iss": "https://op.example.com", "sub": "bob"},
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+			}
+			require.NoError(s.Write(ctx, alice))
+			require.NoError(s.Write(ctx, bob))
+
+			got, err := s.Read(ctx, alice.ID)
+			require.NoError(err)
+			assert.Equal(alice, got)
+
+			require.NoError(s.Touch(ctx, alice.ID, now.Add(2*time.Minute)))
+			got, err = s.Read(ctx, alice.ID)
+			require.NoError(err)
+			assert.Equal(now.Add(2*time.Minute), got.ExpiresAt)
+			err = s.Touch(ctx, "s_unknown", now)
+			assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+			found, err := s.Find(ctx, "https://op.example.com", "sid-1", "")
+			require.NoError(err)
+			require.Len(found, 1)
+			assert.Equal(alice.ID, found[0].ID)
+			found, err = s.Find(ctx, "", "", "bob")
+			require.NoError(err)
+			require.Len(found, 1)
+			assert.Equal(bob.ID, found[0].ID)
+			found, err = s.Find(ctx, "https://other.example.com", "", "bob")
+			require.NoError(err)
+			assert.Empty(found)
+			_, err = s.Find(ctx, "https://op.example.com", "", "")
+			assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+
+			n, err := s.DeleteExpired(ctx, now.Add(5*time.Minute))
+			require.NoError(err)
+			assert.Equal(int64(1), n)
+			_, err = s.Read(ctx, alice.ID)
+			assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+			require.NoError(s.Delete(ctx, bob.ID))
+			_, err = s.Read(ctx, bob.ID)
+			assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+			err = s.Write(ctx, nil)
+			assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+		})
+	}
+}
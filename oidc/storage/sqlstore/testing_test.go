@@ -0,0 +1,316 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testDriver is a database/sql driver for an in-memory database which only
+// understands the simple statements used by the stores, so they can be tested
+// without a database server.  Every connection to the same DSN shares a
+// database.
+type testDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*testDB
+}
+
+var (
+	testSQLDriver    = &testDriver{dbs: map[string]*testDB{}}
+	testSQLDriverSeq int64
+)
+
+func init() {
+	sql.Register("cap-sqlstore-test", testSQLDriver)
+}
+
+// testOpenDB opens a new, empty in-memory database with the dialect's schema.
+func testOpenDB(t *testing.T, d Dialect) (*sql.DB, *testDB) {
+	t.Helper()
+	dsn := "db-" + strconv.FormatInt(atomic.AddInt64(&testSQLDriverSeq, 1), 10)
+	db, err := sql.Open("cap-sqlstore-test", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	require.NoError(t, Migrate(context.Background(), db, d))
+	testSQLDriver.mu.Lock()
+	defer testSQLDriver.mu.Unlock()
+	return db, testSQLDriver.dbs[dsn]
+}
+
+func (d *testDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db, ok := d.dbs[dsn]
+	if !ok {
+		db = &testDB{tables: map[string]*testTable{}}
+		d.dbs[dsn] = db
+	}
+	return &testConn{db: db}, nil
+}
+
+// testDB is an in-memory database.
+type testDB struct {
+	mu     sync.Mutex
+	tables map[string]*testTable
+	// statements are every statement executed, with ? placeholders
+	statements []string
+}
+
+// testTable is an in-memory table, whose rows are keyed by their first column.
+type testTable struct {
+	cols []string
+	rows map[string]map[string]driver.Value
+}
+
+type testConn struct{ db *testDB }
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	return &testStmt{db: c.db, query: query}, nil
+}
+func (c *testConn) Close() error              { return nil }
+func (c *testConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *testConn) Commit() error             { return nil }
+func (c *testConn) Rollback() error           { return nil }
+
+type testStmt struct {
+	db    *testDB
+	query string
+}
+
+func (s *testStmt) Close() error  { return nil }
+func (s *testStmt) NumInput() int { return -1 }
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	n, _, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	_, rows, err := s.db.run(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+var (
+	testPostgresPlaceholder = regexp.MustCompile(`\$\d+`)
+	testCreateTable         = regexp.MustCompile(`^CREATE TABLE (IF NOT EXISTS )?(\w+) \((.*)\)$`)
+	testInsert              = regexp.MustCompile(`^INSERT INTO (\w+) \(([^)]*)\) VALUES \([^)]*\)(.*)$`)
+	testInsertSelect        = regexp.MustCompile(`^INSERT INTO (\w+) \([^)]*\) SELECT .* FROM (\w+)$`)
+	testDropTable           = regexp.MustCompile(`^DROP TABLE (\w+)$`)
+	testRenameTable         = regexp.MustCompile(`^ALTER TABLE (\w+) RENAME TO (\w+)$`)
+	testSelect              = regexp.MustCompile(`^SELECT ([\w, ]+) FROM (\w+) WHERE (.*)$`)
+	testUpdate              = regexp.MustCompile(`^UPDATE (\w+) SET (.*) WHERE (.*)$`)
+	testDelete              = regexp.MustCompile(`^DELETE FROM (\w+) WHERE (.*)$`)
+)
+
+// run runs the query, returning the number of rows affected or the rows
+// selected.
+func (db *testDB) run(query string, args []driver.Value) (int64, driver.Rows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	query = testPostgresPlaceholder.ReplaceAllString(query, "?")
+	db.statements = append(db.statements, query)
+
+	switch {
+	case strings.HasPrefix(query, "CREATE INDEX"):
+		return 0, nil, nil
+	case strings.HasPrefix(query, "SELECT COALESCE(MAX(version), 0) FROM "):
+		var max int64
+		if t, ok := db.tables[migrationsTable]; ok {
+			for _, r := range t.rows {
+				if v := r["version"].(int64); v > max {
+					max = v
+				}
+			}
+		}
+		return 0, &testRows{cols: []string{"max"}, values: [][]driver.Value{{max}}}, nil
+	}
+	if m := testCreateTable.FindStringSubmatch(query); m != nil {
+		if _, ok := db.tables[m[2]]; ok {
+			if m[1] != "" {
+				return 0, nil, nil
+			}
+			return 0, nil, fmt.Errorf("table %s already exists", m[2])
+		}
+		var cols []string
+		for _, def := range strings.Split(m[3], ", ") {
+			cols = append(cols, strings.Fields(def)[0])
+		}
+		db.tables[m[2]] = &testTable{cols: cols, rows: map[string]map[string]driver.Value{}}
+		return 0, nil, nil
+	}
+	if m := testInsertSelect.FindStringSubmatch(query); m != nil {
+		// the selected expressions aren't evaluated, so only an empty table
+		// can be copied
+		from, err := db.table(m[2])
+		if err != nil {
+			return 0, nil, err
+		}
+		if _, err := db.table(m[1]); err != nil {
+			return 0, nil, err
+		}
+		if len(from.rows) > 0 {
+			return 0, nil, fmt.Errorf("unsupported copy of %d rows: %s", len(from.rows), query)
+		}
+		return 0, nil, nil
+	}
+	if m := testDropTable.FindStringSubmatch(query); m != nil {
+		if _, err := db.table(m[1]); err != nil {
+			return 0, nil, err
+		}
+		delete(db.tables, m[1])
+		return 0, nil, nil
+	}
+	if m := testRenameTable.FindStringSubmatch(query); m != nil {
+		t, err := db.table(m[1])
+		if err != nil {
+			return 0, nil, err
+		}
+		delete(db.tables, m[1])
+		db.tables[m[2]] = t
+		return 0, nil, nil
+	}
+	if m := testInsert.FindStringSubmatch(query); m != nil {
+		t, err := db.table(m[1])
+		if err != nil {
+			return 0, nil, err
+		}
+		cols := strings.Split(m[2], ", ")
+		row := map[string]driver.Value{}
+		for i, c := range cols {
+			row[c] = args[i]
+		}
+		key := fmt.Sprint(args[0])
+		if _, exists := t.rows[key]; exists && !strings.Contains(m[3], "ON CONFLICT") && !strings.Contains(m[3], "ON DUPLICATE KEY") {
+			return 0, nil, fmt.Errorf("duplicate key %s", key)
+		}
+		t.rows[key] = row
+		return 1, nil, nil
+	}
+	if m := testSelect.FindStringSubmatch(query); m != nil {
+		t, err := db.table(m[2])
+		if err != nil {
+			return 0, nil, err
+		}
+		matched, err := t.where(m[3], args)
+		if err != nil {
+			return 0, nil, err
+		}
+		rows := &testRows{cols: strings.Split(m[1], ", ")}
+		for _, r := range matched {
+			values := make([]driver.Value, 0, len(rows.cols))
+			for _, c := range rows.cols {
+				values = append(values, r[c])
+			}
+			rows.values = append(rows.values, values)
+		}
+		return 0, rows, nil
+	}
+	if m := testUpdate.FindStringSubmatch(query); m != nil {
+		t, err := db.table(m[1])
+		if err != nil {
+			return 0, nil, err
+		}
+		sets := strings.Split(m[2], ", ")
+		matched, err := t.where(m[3], args[len(sets):])
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, r := range matched {
+			for i, set := range sets {
+				r[strings.TrimSuffix(set, " = ?")] = args[i]
+			}
+		}
+		return int64(len(matched)), nil, nil
+	}
+	if m := testDelete.FindStringSubmatch(query); m != nil {
+		t, err := db.table(m[1])
+		if err != nil {
+			return 0, nil, err
+		}
+		matched, err := t.where(m[2], args)
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, r := range matched {
+			delete(t.rows, fmt.Sprint(r[t.cols[0]]))
+		}
+		return int64(len(matched)), nil, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported statement: %s", query)
+}
+
+func (db *testDB) table(name string) (*testTable, error) {
+	t, ok := db.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("table %s doesn't exist", name)
+	}
+	return t, nil
+}
+
+// where returns the rows which match the "col = ? AND col <= ?" conditions,
+// ordered by their key.
+func (t *testTable) where(conditions string, args []driver.Value) ([]map[string]driver.Value, error) {
+	conds := strings.Split(conditions, " AND ")
+	if len(conds) != len(args) {
+		return nil, fmt.Errorf("%d conditions and %d args", len(conds), len(args))
+	}
+	keys := make([]string, 0, len(t.rows))
+	for k := range t.rows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var matched []map[string]driver.Value
+	for _, k := range keys {
+		r := t.rows[k]
+		match := true
+		for i, c := range conds {
+			f := strings.Fields(c)
+			switch f[1] {
+			case "=":
+				match = match && fmt.Sprint(r[f[0]]) == fmt.Sprint(args[i])
+			case "<=":
+				match = match && !r[f[0]].(time.Time).After(args[i].(time.Time))
+			default:
+				return nil, fmt.Errorf("unsupported condition: %s", c)
+			}
+		}
+		if match {
+			matched = append(matched, r)
+		}
+	}
+	return matched, nil
+}
+
+type testRows struct {
+	cols   []string
+	values [][]driver.Value
+}
+
+func (r *testRows) Columns() []string { return r.cols }
+func (r *testRows) Close() error      { return nil }
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -0,0 +1,107 @@
+package sqlstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/clientauth"
+)
+
+// TokenStore implements the clientauth package's TokenStore interface using
+// the cap_tokens table.  Tokens are persisted using oidc.MarshalToken, keyed by
+// the hex encoded SHA-256 hash of their key, since keys (like a
+// clientauth.TokenKey with many scopes) may be longer than an indexed column
+// allows.  The tokens are encrypted when the store has an oidc.Wrapper (see
+// WithWrapper).
+//
+// It is concurrently safe.
+type TokenStore struct {
+	db      *sql.DB
+	dialect Dialect
+	wrapper oidc.Wrapper
+}
+
+// ensure that TokenStore implements the clientauth.TokenStore interface.
+var _ clientauth.TokenStore = (*TokenStore)(nil)
+
+// NewTokenStore creates a new TokenStore, whose db has the schema created by
+// Migrate(...).
+//
+// Supported options: WithWrapper
+func NewTokenStore(db *sql.DB, d Dialect, opt ...oidc.Option) (*TokenStore, error) {
+	const op = "sqlstore.NewTokenStore"
+	if db == nil {
+		return nil, fmt.Errorf("%s: db is nil: %w", op, oidc.ErrNilParameter)
+	}
+	if err := d.valid(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	opts := getStoreOpts(opt...)
+	return &TokenStore{db: db, dialect: d, wrapper: opts.withWrapper}, nil
+}
+
+// Read implements the clientauth.TokenStore.Read() interface function and
+// returns an *oidc.Tk.  If a token is not found for the key, then an error
+// wrapping oidc.ErrNotFound is returned.
+func (s *TokenStore) Read(ctx context.Context, key string) (oidc.Token, error) {
+	const op = "TokenStore.Read"
+	var data []byte
+	hash := tokenKeyHash(key)
+	err := s.db.QueryRowContext(ctx, s.dialect.bind("SELECT data FROM cap_tokens WHERE key_hash = ?"), hash).Scan(&data)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("%s: token for key %q: %w", op, key, oidc.ErrNotFound)
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	data, err = unwrap(ctx, s.wrapper, data, wrapAAD("cap_tokens", hash))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	tk, err := oidc.UnmarshalToken(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return tk, nil
+}
+
+// Write implements the clientauth.TokenStore.Write() interface function.
+func (s *TokenStore) Write(ctx context.Context, key string, t oidc.Token) error {
+	const op = "TokenStore.Write"
+	if key == "" {
+		return fmt.Errorf("%s: key is empty: %w", op, oidc.ErrInvalidParameter)
+	}
+	data, err := oidc.MarshalToken(t)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	hash := tokenKeyHash(key)
+	if data, err = wrap(ctx, s.wrapper, data, wrapAAD("cap_tokens", hash)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := s.db.ExecContext(ctx, s.dialect.upsert("cap_tokens", "key_hash", "data"), hash, data); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// Delete implements the clientauth.TokenStore.Delete() interface function.
+func (s *TokenStore) Delete(ctx context.Context, key string) error {
+	const op = "TokenStore.Delete"
+	if _, err := s.db.ExecContext(ctx, s.dialect.bind("DELETE FROM cap_tokens WHERE key_hash = ?"), tokenKeyHash(key)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// tokenKeyHash returns the fixed length hash of the key, which is the
+// cap_tokens table's primary key.
+func tokenKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,66 @@
+package sqlstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestTokenStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	for _, d := range []Dialect{Postgres, MySQL} {
+		d := d
+		t.Run(d.String(), func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			db, tdb := testOpenDB(t, d)
+			s, err := NewTokenStore(db, d)
+			require.NoError(err)
+
+			_, err = s.Read(ctx, "alice")
+			assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+			tk, err := oidc.NewToken("id-token", &oauth2.Token{AccessToken: "access-token", RefreshToken: "refresh-token"})
+			require.NoError(err)
+			require.NoError(s.Write(ctx, "alice", tk))
+			got, err := s.Read(ctx, "alice")
+			require.NoError(err)
+			assert.Equal(tk.IDToken(), got.IDToken())
+			assert.Equal(tk.RefreshToken(), got.RefreshToken())
+
+			// writing a key replaces its token
+			tk, err = oidc.NewToken("id-token-2", &oauth2.Token{AccessToken: "access-token-2"})
+			require.NoError(err)
+			require.NoError(s.Write(ctx, "alice", tk))
+			got, err = s.Read(ctx, "alice")
+			require.NoError(err)
+			assert.Equal(oidc.IDToken("id-token-2"), got.IDToken())
+
+			require.NoError(s.Delete(ctx, "alice"))
+			_, err = s.Read(ctx, "alice")
+			assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+
+			// keys longer than an indexed column allows are stored by their
+			// fixed length hash
+			long := strings.Repeat("scope ", 1000)
+			require.NoError(s.Write(ctx, long, tk))
+			got, err = s.Read(ctx, long)
+			require.NoError(err)
+			assert.Equal(tk.IDToken(), got.IDToken())
+			require.Len(tdb.tables["cap_tokens"].rows, 1)
+			for k := range tdb.tables["cap_tokens"].rows {
+				assert.Len(k, 64)
+				assert.Equal(tokenKeyHash(long), k)
+			}
+			require.NoError(s.Delete(ctx, long))
+			_, err = s.Read(ctx, long)
+			assert.Truef(errors.Is(err, oidc.ErrNotFound), "wanted \"%s\" but got \"%s\"", oidc.ErrNotFound, err)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package sqlstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/cap/oidc"
+)
+
+// encryptedData is the persisted form of a row's data when the store has an
+// oidc.Wrapper (see WithWrapper).
+type encryptedData struct {
+	Wrapped *oidc.EncryptedBlob `json:"wrapped"`
+}
+
+// wrapAAD returns the additional authenticated data used to encrypt the data
+// of a table's row, which prevents the encrypted data from being used as the
+// data of a different row or table.
+func wrapAAD(table, id string) []byte {
+	return []byte("cap:sqlstore:" + table + ":" + id)
+}
+
+// wrap encrypts the data using the wrapper, or returns the data unchanged when
+// the wrapper is nil.
+func wrap(ctx context.Context, w oidc.Wrapper, data, aad []byte) ([]byte, error) {
+	const op = "sqlstore.wrap"
+	if w == nil {
+		return data, nil
+	}
+	blob, err := w.Encrypt(ctx, data, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to encrypt data: %w", op, err)
+	}
+	wrapped, err := json.Marshal(encryptedData{Wrapped: blob})
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to marshal encrypted data: %w", op, err)
+	}
+	return wrapped, nil
+}
+
+// unwrap decrypts data that was encrypted by wrap(...).  When the store has a
+// wrapper, unencrypted data is still returned, so data written before the
+// wrapper was added can be read and is encrypted the next time it's written.
+func unwrap(ctx context.Context, w oidc.Wrapper, data, aad []byte) ([]byte, error) {
+	const op = "sqlstore.unwrap"
+	var encrypted encryptedData
+	if err := json.Unmarshal(data, &encrypted); err != nil || encrypted.Wrapped == nil || len(encrypted.Wrapped.Ciphertext) == 0 {
+		return data, nil
+	}
+	if w == nil {
+		return nil, fmt.Errorf("%s: data is encrypted and the store doesn't have a wrapper: %w", op, oidc.ErrInvalidParameter)
+	}
+	plaintext, err := w.Decrypt(ctx, encrypted.Wrapped, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to decrypt data: %w", op, err)
+	}
+	return plaintext, nil
+}
+
+// storeOptions is the set of available options for the stores.
+type storeOptions struct {
+	withWrapper oidc.Wrapper
+}
+
+// storeDefaults is a handy way to get the defaults at runtime and during unit
+// tests.
+func storeDefaults() storeOptions {
+	return storeOptions{}
+}
+
+// getStoreOpts gets the store defaults and applies the opt overrides passed
+// in
+func getStoreOpts(opt ...oidc.Option) storeOptions {
+	opts := storeDefaults()
+	oidc.ApplyOpts(&opts, opt...)
+	return opts
+}
+
+// WithWrapper provides an optional oidc.Wrapper which encrypts the data of the
+// store's rows: the tokens, the requests (including their nonce and PKCE
+// verifier) and the sessions.  The columns used to find rows (like a
+// session's iss, sid and sub) aren't encrypted.  Data is re-encrypted with the
+// wrapper's current key every time it's written, so it's migrated to a rotated
+// key (and unencrypted data is encrypted) on its next write.
+//
+// Valid for: NewRequestStore, NewTokenStore and NewSessionStore
+func WithWrapper(w oidc.Wrapper) oidc.Option {
+	return func(o interface{}) {
+		if o, ok := o.(*storeOptions); ok {
+			o.withWrapper = w
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package sqlstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/hashicorp/cap/oidc/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestWithWrapper(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	for _, d := range []Dialect{Postgres, MySQL} {
+		d := d
+		t.Run(d.String(), func(t *testing.T) {
+			db, tdb := testOpenDB(t, d)
+			w, err := oidc.NewAESGCMWrapper("key-1", []byte("0123456789abcdef0123456789abcdef"))
+			require.NoError(t, err)
+
+			// rowData returns the persisted data of the table's row, and
+			// asserts that it's encrypted without any of the plaintexts.
+			rowData := func(t *testing.T, table, key string, plaintexts ...string) []byte {
+				t.Helper()
+				row, ok := tdb.tables[table].rows[key]
+				require.True(t, ok)
+				data := row["data"].([]byte)
+				var encrypted encryptedData
+				require.NoError(t, json.Unmarshal(data, &encrypted))
+				require.NotNil(t, encrypted.Wrapped)
+				assert.Equal(t, w.KeyID(), encrypted.Wrapped.KeyID)
+				for _, p := range plaintexts {
+					assert.NotContains(t, string(data), p)
+				}
+				return data
+			}
+
+			t.Run("tokens", func(t *testing.T) {
+				assert, require := assert.New(t), require.New(t)
+				plain, err := NewTokenStore(db, d)
+				require.NoError(err)
+				s, err := NewTokenStore(db, d, WithWrapper(w))
+				require.NoError(err)
+
+				// tokens written before the wrapper was added are still read
+				tk, err := oidc.NewToken("id-token", &oauth2.Token{AccessToken: "access-token", RefreshToken: "refresh-token"})
+				require.NoError(err)
+				require.NoError(plain.Write(ctx, "alice", tk))
+				got, err := s.Read(ctx, "alice")
+				require.NoError(err)
+				assert.Equal(tk.RefreshToken(), got.RefreshToken())
+
+				require.NoError(s.Write(ctx, "alice", tk))
+				aliceData := rowData(t, "cap_tokens", tokenKeyHash("alice"), "id-token", "access-token", "refresh-token")
+				got, err = s.Read(ctx, "alice")
+				require.NoError(err)
+				assert.Equal(tk.IDToken(), got.IDToken())
+				assert.Equal(tk.RefreshToken(), got.RefreshToken())
+
+				_, err = plain.Read(ctx, "alice")
+				assert.Truef(errors.Is(err, oidc.ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrInvalidParameter, err)
+
+				// encrypted data can't be used as another key's token
+				require.NoError(s.Write(ctx, "bob", tk))
+				tdb.tables["cap_tokens"].rows[tokenKeyHash("bob")]["data"] = aliceData
+				_, err = s.Read(ctx, "bob")
+				assert.Truef(errors.Is(err, oidc.ErrDecryptionFailed), "wanted \"%s\" but got \"%s\"", oidc.ErrDecryptionFailed, err)
+			})
+			t.Run("requests", func(t *testing.T) {
+				assert, require := assert.New(t), require.New(t)
+				s, err := NewRequestStore(db, d, WithWrapper(w))
+				require.NoError(err)
+				v, err := oidc.NewCodeVerifier()
+				require.NoError(err)
+				r, err := oidc.NewRequest(time.Minute, "https://app.example.com/callback", oidc.WithPKCE(v))
+				require.NoError(err)
+				require.NoError(s.Write(ctx, r))
+				rowData(t, "cap_requests", r.State(), r.Nonce(), v.Verifier(), "https://app.example.com/callback")
+
+				got, err := s.Read(ctx, r.State())
+				require.NoError(err)
+				assert.Equal(r.Nonce(), got.Nonce())
+				assert.Equal(v.Verifier(), got.PKCEVerifier().Verifier())
+			})
+			t.Run("sessions", func(t *testing.T) {
+				assert, require := assert.New(t), require.New(t)
+				s, err := NewSessionStore(db, d, WithWrapper(w))
+				require.NoError(err)
+				now := time.Now().UTC().Truncate(time.Second)
+				sess := &session.Session{
+					ID:        "s_alice",
+					Claims:    map[string]interface{}{"iss": "https://op.example.com", "sub": "alice", "sid": "sid-1", "email": "alice@example.com"},
+					CreatedAt: now,
+					ExpiresAt: now.Add(time.Minute),
+				}
+				require.NoError(s.Write(ctx, sess))
+				rowData(t, "cap_sessions", sess.ID, "alice@example.com")
+
+				// touching a session keeps it encrypted
+				require.NoError(s.Touch(ctx, sess.ID, now.Add(2*time.Minute)))
+				rowData(t, "cap_sessions", sess.ID, "alice@example.com")
+				got, err := s.Read(ctx, sess.ID)
+				require.NoError(err)
+				assert.Equal("alice@example.com", got.Claims["email"])
+				assert.True(now.Add(2 * time.Minute).Equal(got.ExpiresAt))
+
+				found, err := s.Find(ctx, "https://op.example.com", "sid-1", "")
+				require.NoError(err)
+				require.Len(found, 1)
+				assert.Equal("alice@example.com", found[0].Claims["email"])
+			})
+			t.Run("rotation", func(t *testing.T) {
+				assert, require := assert.New(t), require.New(t)
+				s, err := NewTokenStore(db, d, WithWrapper(w))
+				require.NoError(err)
+				tk, err := oidc.NewToken("id-token", &oauth2.Token{AccessToken: "access-token"})
+				require.NoError(err)
+				require.NoError(s.Write(ctx, "carol", tk))
+
+				require.NoError(w.Rotate("key-2", []byte("fedcba9876543210fedcba9876543210")))
+				got, err := s.Read(ctx, "carol")
+				require.NoError(err)
+				assert.Equal(tk.IDToken(), got.IDToken())
+				// the token is re-encrypted with the current key when it's
+				// written
+				require.NoError(s.Write(ctx, "carol", got))
+				rowData(t, "cap_tokens", tokenKeyHash("carol"), "id-token", "access-token")
+			})
+		})
+	}
+}
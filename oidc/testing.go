@@ -3,8 +3,10 @@ package oidc
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/sha512"
 	"crypto/x509"
@@ -12,10 +14,13 @@ import (
 	"encoding/base64"
 	"encoding/pem"
 	"hash"
+	"io"
 	"math/big"
+	mathrand "math/rand"
 	"net"
 	"reflect"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,8 +30,22 @@ import (
 	"gopkg.in/square/go-jose.v2/jwt"
 )
 
+// TestingT defines a very slim interface required by a TestProvider and any
+// test functions it uses, which allows a TestProvider to be used outside of
+// tests (see DevProvider).  A *testing.T satisfies the interface.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+	FailNow()
+}
+
+// CleanupT defines a single function interface for a testing.Cleanup(func()).
+type CleanupT interface{ Cleanup(func()) }
+
+// HelperT defines a single function interface for a testing.Helper().
+type HelperT interface{ Helper() }
+
 // TestGenerateKeys will generate a test ECDSA P-256 pub/priv key pair.
-func TestGenerateKeys(t *testing.T) (crypto.PublicKey, crypto.PrivateKey) {
+func TestGenerateKeys(t testing.TB) (crypto.PublicKey, crypto.PrivateKey) {
 	t.Helper()
 	require := require.New(t)
 	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
@@ -34,11 +53,23 @@ func TestGenerateKeys(t *testing.T) (crypto.PublicKey, crypto.PrivateKey) {
 	return &priv.PublicKey, priv
 }
 
-// TestSignJWT will bundle the provided claims into a test signed JWT.
-func TestSignJWT(t *testing.T, key crypto.PrivateKey, alg Alg, claims interface{}, keyID []byte) string {
-	t.Helper()
+// TestSignJWT will bundle the provided claims into a test signed JWT.  Besides
+// the standard library's private keys, the key may be any crypto.Signer (like
+// a key backed by an HSM or KMS).
+func TestSignJWT(t TestingT, key crypto.PrivateKey, alg Alg, claims interface{}, keyID []byte) string {
+	if v, ok := t.(HelperT); ok {
+		v.Helper()
+	}
 	require := require.New(t)
 
+	switch key.(type) {
+	case *ecdsa.PrivateKey, *rsa.PrivateKey, ed25519.PrivateKey:
+	default:
+		if s, ok := key.(crypto.Signer); ok {
+			key = &opaqueSigner{signer: s, alg: alg}
+		}
+	}
+
 	hdr := map[jose.HeaderKey]interface{}{}
 	if keyID != nil {
 		hdr["key_id"] = string(keyID)
@@ -57,9 +88,32 @@ func TestSignJWT(t *testing.T, key crypto.PrivateKey, alg Alg, claims interface{
 	return raw
 }
 
+// TestSeededRandReader returns a deterministic source of random bytes for the
+// seed, which can be used with the WithRandReader option to generate the same
+// IDs, state, nonces and PKCE code verifiers during every test run.  It's safe
+// for concurrent use, although concurrent callers will get the bytes in a
+// nondeterministic order.
+func TestSeededRandReader(t testing.TB, seed int64) io.Reader {
+	t.Helper()
+	return &seededRandReader{r: mathrand.New(mathrand.NewSource(seed))}
+}
+
+// seededRandReader is an io.Reader of deterministic random bytes
+type seededRandReader struct {
+	mu sync.Mutex
+	r  *mathrand.Rand
+}
+
+// Read satisfies the io.Reader interface.
+func (s *seededRandReader) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Read(p)
+}
+
 // TestGenerateCA will generate a test x509 CA cert, along with it encoded in a
 // PEM format.
-func TestGenerateCA(t *testing.T, hosts []string) (*x509.Certificate, string) {
+func TestGenerateCA(t testing.TB, hosts []string) (*x509.Certificate, string) {
 	t.Helper()
 	require := require.New(t)
 
@@ -161,7 +215,7 @@ func testDefaultJWT(t *testing.T, privKey crypto.PrivateKey, expireIn time.Durat
 // TestProvider's client ID/secret and use the TestProviders signing algorithm
 // when building the configuration. This is helpful internally, but
 // intentionally not exported.
-func testNewConfig(t *testing.T, clientID, clientSecret, allowedRedirectURL string, tp *TestProvider) *Config {
+func testNewConfig(t testing.TB, clientID, clientSecret, allowedRedirectURL string, tp *TestProvider) *Config {
 	const op = "testNewConfig"
 	t.Helper()
 	require := require.New(t)
@@ -188,7 +242,7 @@ func testNewConfig(t *testing.T, clientID, clientSecret, allowedRedirectURL stri
 // testNewProvider creates a new Provider.  It uses the TestProvider (tp) to properly
 // construct the provider's configuration (see testNewConfig). This is helpful internally, but
 // intentionally not exported.
-func testNewProvider(t *testing.T, clientID, clientSecret, redirectURL string, tp *TestProvider) *Provider {
+func testNewProvider(t testing.TB, clientID, clientSecret, redirectURL string, tp *TestProvider) *Provider {
 	const op = "testNewProvider"
 	t.Helper()
 	require := require.New(t)
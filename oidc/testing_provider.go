@@ -7,14 +7,12 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"crypto/sha512"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
-	"hash"
 	"io/ioutil"
 	"log"
 	"net"
@@ -24,7 +22,6 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"testing"
 	"time"
 
 	"github.com/hashicorp/cap/oidc/internal/strutils"
@@ -107,6 +104,11 @@ import (
 //  * Authorization State: SetExpectedState sets the value for the state parameter
 //  returned from the /authorized endpoint
 //
+//  * Authorization Response Issuer: SetResponseIssuer(...) includes the
+//  provider's issuer as the iss parameter of /authorize responses and
+//  advertises authorization_response_iss_parameter_supported.  It's off by
+//  default.
+//
 //  * Token Responses: SetDisableToken disables the /token endpoint, causing
 //  it to return a 401 http status.
 //
@@ -114,10 +116,38 @@ import (
 //  causing them to return a 401 http status.
 //
 //  * PKCE verifier: SetPKCEVerifier(oidc.CodeVerifier) sets the PKCE code_verifier
-//  and PKCEVerifier() returns the current verifier.
+//  and PKCEVerifier() returns the current verifier.  A code_verifier which
+//  matches the code_challenge sent to the /authorize endpoint is also accepted.
 //
 //  * UserInfo: SetUserInfoReply sets the UserInfo endpoint response and
-//  UserInfoReply() returns the current response.
+//  UserInfoReply() returns the current response.  SetSignUserInfo makes the
+//  endpoint return the response as a signed JWT (application/jwt).
+//
+//  * Refresh Tokens: SetExpectedRefreshToken(...) updates the refresh_token
+//  issued by the /token endpoint and the refresh_token allowed when using the
+//  refresh_token grant. The refresh_token is empty by default, which means no
+//  refresh_tokens are issued.
+//
+//  * Refresh Token Rotation: SetRotateRefreshTokens(...) makes every refresh
+//  issue a new refresh_token, so the previous refresh_token is rejected with an
+//  invalid_grant error like a reused refresh_token.  Refresh tokens aren't
+//  rotated by default.
+//
+//  * SAML 2.0 Bearer Assertions: SetExpectedSAMLAssertion(...) updates the
+//  assertion allowed when using the saml2-bearer grant.  The assertion is
+//  empty by default, which means the grant isn't allowed.
+//
+//  * On-Behalf-Of: SetExpectedOnBehalfOfAssertion(...) updates the assertion
+//  (an access token) allowed when using the on-behalf-of flow.  The assertion
+//  is empty by default, which means the flow isn't allowed.
+//
+//  * Latency: SetResponseDelay(...) delays every response by the duration,
+//  which is helpful when testing timeouts and cancellations.  There's no delay
+//  by default.
+//
+//  * Granted Scopes: SetGrantedScopes(...) sets the scope parameter of the
+//  /token endpoint's responses.  The scope parameter is omitted by default,
+//  which means the requested scopes were granted.
 type TestProvider struct {
 	httpServer *httptest.Server
 	caCert     string
@@ -134,18 +164,28 @@ type TestProvider struct {
 	expectedAuthCode  string
 	expectedAuthNonce string
 	expectedState     string
+	expectedRefresh   string
+	expectedAssertion string
+	expectedOBO       string
+	rotateRefresh     bool
+	rotations         int
 	customClaims      map[string]interface{}
 	customAudiences   []string
 	omitAuthTimeClaim bool
 	omitIDToken       bool
 	omitAccessToken   bool
 	disableUserInfo   bool
+	signUserInfo      bool
+	responseIssuer    bool
 	disableJWKs       bool
 	disableToken      bool
 	disableImplicit   bool
 	invalidJWKs       bool
 	nowFunc           func() time.Time
 	pkceVerifier      CodeVerifier
+	codeChallenge     string
+	responseDelay     time.Duration
+	grantedScopes     []string
 
 	// privKey *ecdsa.PrivateKey
 	privKey crypto.PrivateKey
@@ -153,7 +193,7 @@ type TestProvider struct {
 	keyID   string
 	alg     Alg
 
-	t *testing.T
+	t TestingT
 
 	client *http.Client
 }
@@ -169,9 +209,12 @@ func (p *TestProvider) Stop() {
 // StartTestProvider creates and starts a running TestProvider http server.  The
 // WithPort option is supported.  The TestProvider will be shutdown when the
 // test and all it's subtests complete via a registered function with
-// t.Cleanup(...).
-func StartTestProvider(t *testing.T, opt ...Option) *TestProvider {
-	t.Helper()
+// t.Cleanup(...).  When t doesn't support Cleanup (see CleanupT), the caller
+// must Stop() the TestProvider.
+func StartTestProvider(t TestingT, opt ...Option) *TestProvider {
+	if v, ok := t.(HelperT); ok {
+		v.Helper()
+	}
 	require := require.New(t)
 	opts := getTestProviderOpts(opt...)
 
@@ -213,8 +256,13 @@ func StartTestProvider(t *testing.T, opt ...Option) *TestProvider {
 	}
 	p.httpServer = httptestNewUnstartedServerWithPort(t, p, opts.withPort)
 	p.httpServer.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	if opts.withHandler != nil {
+		p.httpServer.Config.Handler = opts.withHandler(p)
+	}
 	p.httpServer.StartTLS()
-	t.Cleanup(p.Stop)
+	if c, ok := t.(CleanupT); ok {
+		c.Cleanup(p.Stop)
+	}
 
 	cert := p.httpServer.Certificate()
 
@@ -232,6 +280,7 @@ type testProviderOptions struct {
 	withPort     int
 	withAtHashOf string
 	withCHashOf  string
+	withHandler  func(*TestProvider) http.Handler
 }
 
 // testProviderDefaults is a handy way to get the defaults at runtime and during unit
@@ -250,7 +299,7 @@ func getTestProviderOpts(opt ...Option) testProviderOptions {
 
 // WithTestPort provides an optional port for the test provider.
 //
-// Valid for: TestProvider.StartTestProvider
+// Valid for: TestProvider.StartTestProvider and DevProvider
 func WithTestPort(port int) Option {
 	return func(o interface{}) {
 		if o, ok := o.(*testProviderOptions); ok {
@@ -259,6 +308,19 @@ func WithTestPort(port int) Option {
 	}
 }
 
+// withTestHandler provides an optional func which returns the http.Handler
+// of the TestProvider's http server, which allows the handler to wrap the
+// TestProvider (see DevProvider).
+//
+// Valid for: TestProvider.StartTestProvider
+func withTestHandler(fn func(*TestProvider) http.Handler) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*testProviderOptions); ok {
+			o.withHandler = fn
+		}
+	}
+}
+
 // withTestAtHash provides an option to request the at_hash claim. Valid for:
 // TestProvider.issueSignedJWT
 func withTestAtHash(accessToken string) Option {
@@ -290,7 +352,9 @@ func (p *TestProvider) HTTPClient() *http.Client {
 	if p.client != nil {
 		return p.client
 	}
-	p.t.Helper()
+	if v, ok := p.t.(HelperT); ok {
+		v.Helper()
+	}
 	require := require.New(p.t)
 
 	// use the cleanhttp package to create a "pooled" transport that's better
@@ -348,6 +412,47 @@ func (p *TestProvider) SetExpectedAuthCode(code string) {
 	p.expectedAuthCode = code
 }
 
+// SetExpectedRefreshToken configures the refresh_token issued by /token and
+// the refresh_token allowed when using the refresh_token grant.  No
+// refresh_tokens are issued when it's empty.
+func (p *TestProvider) SetExpectedRefreshToken(refreshToken string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expectedRefresh = refreshToken
+}
+
+// SetRotateRefreshTokens configures whether every refresh issues a new
+// refresh_token, which replaces the ExpectedRefreshToken.
+func (p *TestProvider) SetRotateRefreshTokens(rotate bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rotateRefresh = rotate
+}
+
+// SetExpectedSAMLAssertion configures the SAML assertion (its XML) allowed
+// when using the saml2-bearer grant.  The grant isn't allowed when it's empty.
+func (p *TestProvider) SetExpectedSAMLAssertion(assertion string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expectedAssertion = assertion
+}
+
+// SetExpectedOnBehalfOfAssertion configures the assertion (an access token)
+// allowed when using the on-behalf-of flow.  The flow isn't allowed when it's
+// empty.
+func (p *TestProvider) SetExpectedOnBehalfOfAssertion(assertion string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expectedOBO = assertion
+}
+
+// ExpectedRefreshToken returns the refresh_token issued by /token.
+func (p *TestProvider) ExpectedRefreshToken() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.expectedRefresh
+}
+
 // SetExpectedAuthNonce configures the nonce value required for /auth.
 func (p *TestProvider) SetExpectedAuthNonce(nonce string) {
 	p.mu.Lock()
@@ -385,7 +490,9 @@ func (p *TestProvider) SetCustomAudience(customAudiences ...string) {
 func (p *TestProvider) SetNowFunc(n func() time.Time) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.t.Helper()
+	if v, ok := p.t.(HelperT); ok {
+		v.Helper()
+	}
 	require := require.New(p.t)
 	require.NotNilf(n, "TestProvider.SetNowFunc: time func is nil")
 	p.nowFunc = n
@@ -437,7 +544,7 @@ func (p *TestProvider) SetDisableJWKs(disable bool) {
 func (p *TestProvider) SetInvalidJWKS(invalid bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.invalidJWKs = true
+	p.invalidJWKs = invalid
 }
 
 // SetExpectedState sets the value for the state parameter returned from
@@ -455,6 +562,23 @@ func (p *TestProvider) SetDisableToken(disable bool) {
 	p.disableToken = disable
 }
 
+// SetGrantedScopes sets the scope parameter of the /token endpoint's
+// authorization code and refresh responses.  When no scopes are provided, the
+// parameter is omitted.
+func (p *TestProvider) SetGrantedScopes(scopes ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.grantedScopes = scopes
+}
+
+// SetResponseDelay delays every response by the duration, unless the request
+// is canceled first.
+func (p *TestProvider) SetResponseDelay(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.responseDelay = d
+}
+
 // SetDisableImplicit makes implicit flow responses return 401
 func (p *TestProvider) SetDisableImplicit(disable bool) {
 	p.mu.Lock()
@@ -466,7 +590,9 @@ func (p *TestProvider) SetDisableImplicit(disable bool) {
 func (p *TestProvider) SetPKCEVerifier(verifier CodeVerifier) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.t.Helper()
+	if v, ok := p.t.(HelperT); ok {
+		v.Helper()
+	}
 	require.NotNil(p.t, verifier)
 	p.pkceVerifier = verifier
 }
@@ -485,6 +611,24 @@ func (p *TestProvider) SetUserInfoReply(resp interface{}) {
 	p.replyUserinfo = resp
 }
 
+// SetSignUserInfo makes the UserInfo endpoint return its response as a JWT
+// (application/jwt) signed by the provider's signing keys.
+func (p *TestProvider) SetSignUserInfo(sign bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.signUserInfo = sign
+}
+
+// SetResponseIssuer makes the provider advertise
+// authorization_response_iss_parameter_supported and include its issuer as the
+// iss parameter of its authorization responses.
+// See: https://www.rfc-editor.org/rfc/rfc9207.html
+func (p *TestProvider) SetResponseIssuer(enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.responseIssuer = enabled
+}
+
 // SetUserInfoReply sets the UserInfo endpoint response.
 func (p *TestProvider) UserInfoReply() interface{} {
 	p.mu.Lock()
@@ -514,7 +658,9 @@ func (p *TestProvider) SetSigningKeys(privKey crypto.PrivateKey, pubKey crypto.P
 	const op = "TestProvider.SetSigningKeys"
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.t.Helper()
+	if v, ok := p.t.(HelperT); ok {
+		v.Helper()
+	}
 	require := require.New(p.t)
 	require.NotNilf(privKey, "%s: private key is nil")
 	require.NotNilf(pubKey, "%s: public key is empty")
@@ -536,7 +682,9 @@ func (p *TestProvider) SetSigningKeys(privKey crypto.PrivateKey, pubKey crypto.P
 
 func (p *TestProvider) writeJSON(w http.ResponseWriter, out interface{}) error {
 	const op = "TestProvider.writeJSON"
-	p.t.Helper()
+	if v, ok := p.t.(HelperT); ok {
+		v.Helper()
+	}
 	require := require.New(p.t)
 	require.NotNilf(w, "%s: http.ResponseWriter is nil")
 	enc := json.NewEncoder(w)
@@ -546,37 +694,25 @@ func (p *TestProvider) writeJSON(w http.ResponseWriter, out interface{}) error {
 // writeImplicitResponse will write the required form data response for an
 // implicit flow response to the OIDC authorize endpoint
 func (p *TestProvider) writeImplicitResponse(w http.ResponseWriter, state, redirectURL string) error {
-	p.t.Helper()
+	if v, ok := p.t.(HelperT); ok {
+		v.Helper()
+	}
 	require := require.New(p.t)
 	require.NotNilf(w, "%s: http.ResponseWriter is nil")
 
-	w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
-	const respForm = `
-<!DOCTYPE html>
-<html lang="en">
-<head><title>Submit This Form</title></head>
-<body onload="javascript:document.forms[0].submit()">
-<form method="post" action="%s">
-<input type="hidden" name="state" id="state" value="%s"/>
-%s
-</form>
-</body>
-</html>`
-	const tokenField = `<input type="hidden" name="%s" id="%s" value="%s"/>
-`
 	accessToken := p.issueSignedJWT()
 	idToken := p.issueSignedJWT(withTestAtHash(accessToken))
-	var respTokens strings.Builder
+	params := url.Values{"state": {state}}
 	if !p.omitAccessToken {
-		respTokens.WriteString(fmt.Sprintf(tokenField, "access_token", "access_token", accessToken))
+		params.Set("access_token", accessToken)
 	}
 	if !p.omitIDToken {
-		respTokens.WriteString(fmt.Sprintf(tokenField, "id_token", "id_token", idToken))
+		params.Set("id_token", idToken)
 	}
-	if _, err := w.Write([]byte(fmt.Sprintf(respForm, redirectURL, state, respTokens.String()))); err != nil {
-		return err
+	if p.responseIssuer {
+		params.Set("iss", p.Addr())
 	}
-	return nil
+	return WriteFormPost(w, redirectURL, params)
 }
 
 func (p *TestProvider) issueSignedJWT(opt ...Option) string {
@@ -613,33 +749,38 @@ func (p *TestProvider) issueSignedJWT(opt ...Option) string {
 // test at_hash and c_hash id_token claims. This is helpful internally, but
 // intentionally not exported.
 func (p *TestProvider) testHash(data string) string {
-	p.t.Helper()
+	if v, ok := p.t.(HelperT); ok {
+		v.Helper()
+	}
 	require := require.New(p.t)
 	require.NotEmptyf(data, "testHash: data to hash is empty")
-	var h hash.Hash
-	switch p.alg {
-	case RS256, ES256, PS256:
-		h = sha256.New()
-	case RS384, ES384, PS384:
-		h = sha512.New384()
-	case RS512, ES512, PS512:
-		h = sha512.New()
-	case EdDSA:
+	if p.alg == EdDSA {
 		return "EdDSA-hash"
-	default:
-		require.FailNowf("", "testHash: unsupported signing algorithm %s", string(p.alg))
 	}
-	require.NotNil(h)
-	_, _ = h.Write([]byte(string(data))) // hash documents that Write will never return an error
-	sum := h.Sum(nil)[:h.Size()/2]
-	actual := base64.RawURLEncoding.EncodeToString(sum)
+	actual, err := TokenHash(p.alg, data)
+	require.NoErrorf(err, "testHash: unable to hash data")
 	return actual
 }
 
+// validVerifier returns true when the code_verifier matches the PKCE verifier
+// or the code_challenge sent to the /authorize endpoint.
+func (p *TestProvider) validVerifier(codeVerifier string) bool {
+	if codeVerifier == p.pkceVerifier.Verifier() {
+		return true
+	}
+	if p.codeChallenge == "" {
+		return false
+	}
+	h := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(h[:]) == p.codeChallenge
+}
+
 // writeAuthErrorResponse writes a standard OIDC authentication error response.
 // See: https://openid.net/specs/openid-connect-core-1_0.html#AuthError
 func (p *TestProvider) writeAuthErrorResponse(w http.ResponseWriter, req *http.Request, redirectURL, state, errorCode, errorMessage string) {
-	p.t.Helper()
+	if v, ok := p.t.(HelperT); ok {
+		v.Helper()
+	}
 	require := require.New(p.t)
 	require.NotNilf(w, "%s: http.ResponseWriter is nil")
 	require.NotNilf(req, "%s: http.Request is nil")
@@ -650,6 +791,9 @@ func (p *TestProvider) writeAuthErrorResponse(w http.ResponseWriter, req *http.R
 		"?state=" + url.QueryEscape(state) +
 		"&error=" + url.QueryEscape(errorCode)
 
+	if p.responseIssuer {
+		redirectURI += "&iss=" + url.QueryEscape(p.Addr())
+	}
 	if errorMessage != "" {
 		// add optional error response parameter
 		redirectURI += "&error_description=" + url.QueryEscape(errorMessage)
@@ -689,10 +833,23 @@ func (p *TestProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		userInfo            = "/userinfo"
 		wellKnownJwks       = "/.well-known/jwks.json"
 	)
+	p.mu.Lock()
+	delay := p.responseDelay
+	p.mu.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.t.Helper()
+	if v, ok := p.t.(HelperT); ok {
+		v.Helper()
+	}
 	require := require.New(p.t)
 	require.NotNilf(w, "%s: http.ResponseWriter is nil")
 	require.NotNilf(req, "%s: http.Request is nil")
@@ -715,12 +872,14 @@ func (p *TestProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			TokenEndpoint    string `json:"token_endpoint"`
 			JWKSURI          string `json:"jwks_uri"`
 			UserinfoEndpoint string `json:"userinfo_endpoint,omitempty"`
+			ResponseIssuer   bool   `json:"authorization_response_iss_parameter_supported,omitempty"`
 		}{
 			Issuer:           p.Addr(),
 			AuthEndpoint:     p.Addr() + authorize,
 			TokenEndpoint:    p.Addr() + token,
 			JWKSURI:          p.Addr() + wellKnownJwks,
 			UserinfoEndpoint: p.Addr() + userInfo,
+			ResponseIssuer:   p.responseIssuer,
 		}
 		if p.disableUserInfo {
 			reply.UserinfoEndpoint = ""
@@ -771,6 +930,9 @@ func (p *TestProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			p.writeAuthErrorResponse(w, req, redirectURI, state, "invalid_request", "missing state parameter")
 			return
 		}
+		if challenge := req.FormValue("code_challenge"); challenge != "" {
+			p.codeChallenge = challenge
+		}
 
 		if redirectURI == "" {
 			p.writeAuthErrorResponse(w, req, redirectURI, state, "invalid_request", "missing redirect_uri parameter")
@@ -799,6 +961,9 @@ func (p *TestProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 		redirectURI += "?state=" + url.QueryEscape(s) +
 			"&code=" + url.QueryEscape(p.expectedAuthCode)
+		if p.responseIssuer {
+			redirectURI += "&iss=" + url.QueryEscape(p.Addr())
+		}
 
 		http.Redirect(w, req, redirectURI, http.StatusFound)
 
@@ -832,6 +997,86 @@ func (p *TestProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 
 		switch {
+		case req.FormValue("grant_type") == "refresh_token":
+			if p.expectedRefresh == "" || req.FormValue("refresh_token") != p.expectedRefresh {
+				_ = p.writeTokenErrorResponse(w, http.StatusBadRequest, "invalid_grant", "unexpected refresh token")
+				return
+			}
+			if p.rotateRefresh {
+				p.rotations++
+				p.expectedRefresh = fmt.Sprintf("rotated-refresh-token-%d", p.rotations)
+			}
+			accessToken := p.issueSignedJWT()
+			idToken := p.issueSignedJWT(withTestAtHash(accessToken))
+			reply := struct {
+				AccessToken  string `json:"access_token,omitempty"`
+				IDToken      string `json:"id_token,omitempty"`
+				RefreshToken string `json:"refresh_token,omitempty"`
+				Scope        string `json:"scope,omitempty"`
+			}{
+				AccessToken:  accessToken,
+				IDToken:      idToken,
+				RefreshToken: p.expectedRefresh,
+				Scope:        strings.Join(p.grantedScopes, " "),
+			}
+			if p.omitIDToken {
+				reply.IDToken = ""
+			}
+			if err := p.writeJSON(w, &reply); err != nil {
+				require.NoErrorf(err, "%s: internal error: %w", token, err)
+			}
+			return
+		case req.FormValue("grant_type") == SAML2BearerGrantType:
+			assertion, err := base64.RawURLEncoding.DecodeString(req.FormValue("assertion"))
+			if err != nil || p.expectedAssertion == "" || string(assertion) != p.expectedAssertion {
+				_ = p.writeTokenErrorResponse(w, http.StatusBadRequest, "invalid_grant", "unexpected assertion")
+				return
+			}
+			accessToken := p.issueSignedJWT()
+			idToken := p.issueSignedJWT(withTestAtHash(accessToken))
+			reply := struct {
+				AccessToken string `json:"access_token,omitempty"`
+				IDToken     string `json:"id_token,omitempty"`
+			}{
+				AccessToken: accessToken,
+				IDToken:     idToken,
+			}
+			if p.omitIDToken {
+				reply.IDToken = ""
+			}
+			if err := p.writeJSON(w, &reply); err != nil {
+				require.NoErrorf(err, "%s: internal error: %w", token, err)
+			}
+			return
+		case req.FormValue("grant_type") == JWTBearerGrantType:
+			switch {
+			case req.FormValue("requested_token_use") != OnBehalfOfTokenUse:
+				_ = p.writeTokenErrorResponse(w, http.StatusBadRequest, "invalid_request", "unexpected requested_token_use")
+				return
+			case p.expectedOBO == "" || req.FormValue("assertion") != p.expectedOBO:
+				_ = p.writeTokenErrorResponse(w, http.StatusBadRequest, "invalid_grant", "unexpected assertion")
+				return
+			case req.FormValue("scope") == "":
+				_ = p.writeTokenErrorResponse(w, http.StatusBadRequest, "invalid_scope", "missing scope")
+				return
+			}
+			reply := struct {
+				AccessToken  string `json:"access_token"`
+				TokenType    string `json:"token_type"`
+				ExpiresIn    int    `json:"expires_in"`
+				RefreshToken string `json:"refresh_token,omitempty"`
+				Scope        string `json:"scope"`
+			}{
+				AccessToken:  p.issueSignedJWT(),
+				TokenType:    "Bearer",
+				ExpiresIn:    3600,
+				RefreshToken: p.expectedRefresh,
+				Scope:        req.FormValue("scope"),
+			}
+			if err := p.writeJSON(w, &reply); err != nil {
+				require.NoErrorf(err, "%s: internal error: %w", token, err)
+			}
+			return
 		case req.FormValue("grant_type") != "authorization_code":
 			_ = p.writeTokenErrorResponse(w, http.StatusBadRequest, "invalid_request", "bad grant_type")
 			return
@@ -841,7 +1086,7 @@ func (p *TestProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		case req.FormValue("code") != p.expectedAuthCode:
 			_ = p.writeTokenErrorResponse(w, http.StatusUnauthorized, "invalid_grant", "unexpected auth code")
 			return
-		case req.FormValue("code_verifier") != "" && req.FormValue("code_verifier") != p.pkceVerifier.Verifier():
+		case req.FormValue("code_verifier") != "" && !p.validVerifier(req.FormValue("code_verifier")):
 			_ = p.writeTokenErrorResponse(w, http.StatusUnauthorized, "invalid_verifier", "unexpected verifier")
 			return
 		}
@@ -849,11 +1094,15 @@ func (p *TestProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		accessToken := p.issueSignedJWT()
 		idToken := p.issueSignedJWT(withTestAtHash(accessToken), withTestCHash(p.expectedAuthCode))
 		reply := struct {
-			AccessToken string `json:"access_token,omitempty"`
-			IDToken     string `json:"id_token,omitempty"`
+			AccessToken  string `json:"access_token,omitempty"`
+			IDToken      string `json:"id_token,omitempty"`
+			RefreshToken string `json:"refresh_token,omitempty"`
+			Scope        string `json:"scope,omitempty"`
 		}{
-			AccessToken: accessToken,
-			IDToken:     idToken,
+			AccessToken:  accessToken,
+			IDToken:      idToken,
+			RefreshToken: p.expectedRefresh,
+			Scope:        strings.Join(p.grantedScopes, " "),
 		}
 		if p.omitIDToken {
 			reply.IDToken = ""
@@ -877,6 +1126,12 @@ func (p *TestProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			return
 		}
 
+		if p.signUserInfo {
+			w.Header().Set("Content-Type", "application/jwt")
+			_, err := w.Write([]byte(TestSignJWT(p.t, p.privKey, p.alg, p.replyUserinfo, nil)))
+			require.NoErrorf(err, "%s: internal error: %w", userInfo, err)
+			return
+		}
 		if err := p.writeJSON(w, p.replyUserinfo); err != nil {
 			require.NoErrorf(err, "%s: internal error: %w", userInfo, err)
 			return
@@ -892,8 +1147,10 @@ func (p *TestProvider) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 // httptestNewUnstartedServerWithPort is roughly the same as
 // httptest.NewUnstartedServer() but allows the caller to explicitly choose the
 // port if desired.
-func httptestNewUnstartedServerWithPort(t *testing.T, handler http.Handler, port int) *httptest.Server {
-	t.Helper()
+func httptestNewUnstartedServerWithPort(t TestingT, handler http.Handler, port int) *httptest.Server {
+	if v, ok := t.(HelperT); ok {
+		v.Helper()
+	}
 	require := require.New(t)
 	require.NotNil(handler)
 	if port == 0 {
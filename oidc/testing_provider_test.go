@@ -1,6 +1,7 @@
 package oidc
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -100,6 +101,16 @@ func TestTestProvider_SetExpectedAuthNonce(t *testing.T) {
 	})
 }
 
+func TestTestProvider_SetExpectedRefreshToken(t *testing.T) {
+	t.Run("simple", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := StartTestProvider(t)
+		require.Empty(tp.ExpectedRefreshToken())
+		tp.SetExpectedRefreshToken("green")
+		assert.Equal("green", tp.ExpectedRefreshToken())
+	})
+}
+
 func TestTestProvider_SetAllowedRedirectURIs(t *testing.T) {
 	t.Run("simple", func(t *testing.T) {
 		assert, require := assert.New(t), require.New(t)
@@ -245,6 +256,25 @@ func TestTestProvider_SetExpectedState(t *testing.T) {
 	})
 }
 
+func TestTestProvider_SetResponseIssuer(t *testing.T) {
+	t.Run("simple", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := StartTestProvider(t)
+		require.False(tp.responseIssuer)
+		tp.SetResponseIssuer(true)
+		assert.True(tp.responseIssuer)
+
+		c, err := NewConfig(tp.Addr(), "test-client-id", "test-client-secret", []Alg{ES256}, []string{"https://example.com"}, WithProviderCA(tp.CACert()))
+		require.NoError(err)
+		p, err := NewProvider(c)
+		require.NoError(err)
+		defer p.Done()
+		supported, err := p.Supports(context.Background(), FeatureResponseIssuer)
+		require.NoError(err)
+		assert.True(supported)
+	})
+}
+
 func TestTestProvider_SetPKCEVerifier(t *testing.T) {
 	t.Run("simple", func(t *testing.T) {
 		assert, require := assert.New(t), require.New(t)
@@ -554,3 +584,24 @@ func startEchoServer(t *testing.T) *httptest.Server {
 	t.Cleanup(s.Close)
 	return s
 }
+
+func TestTestProvider_SetResponseDelay(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	tp := StartTestProvider(t)
+	tp.SetResponseDelay(100 * time.Millisecond)
+
+	start := time.Now()
+	resp, err := tp.HTTPClient().Get(tp.Addr() + "/.well-known/openid-configuration")
+	require.NoError(err)
+	defer resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.GreaterOrEqual(int64(time.Since(start)), int64(100*time.Millisecond))
+
+	tp.SetResponseDelay(0)
+	start = time.Now()
+	resp, err = tp.HTTPClient().Get(tp.Addr() + "/.well-known/openid-configuration")
+	require.NoError(err)
+	defer resp.Body.Close()
+	assert.Less(int64(time.Since(start)), int64(100*time.Millisecond))
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/hashicorp/cap/oidc/internal/strutils"
 	"golang.org/x/oauth2"
 )
 
@@ -31,6 +33,15 @@ type Token interface {
 	// IsExpired returns true if the token has expired. Implementations should
 	// support a time skew (perhaps TokenExpirySkew) when checking expiration.
 	IsExpired() bool
+
+	// OfflineAccessRequested returns true when the Token was returned for a
+	// Request with offline access (see WithOfflineAccess).
+	OfflineAccessRequested() bool
+
+	// RefreshTokenGranted returns true when the Token has a refresh_token.
+	// Providers may silently ignore a request for offline access, so it
+	// should be checked before relying on a refresh_token.
+	RefreshTokenGranted() bool
 }
 
 // StaticTokenSource is a single function interface that defines a method to
@@ -50,6 +61,18 @@ type Tk struct {
 
 	// nowFunc is an optional function that returns the current time
 	nowFunc func() time.Time
+
+	// offlineAccess indicates whether or not the Token was returned for a
+	// Request with offline access.
+	offlineAccess bool
+
+	// requestedScopes, grantedScopes and requiredScopes are the scopes
+	// requested for the Token, granted by the provider and required by the
+	// Token's Request (see WithRequiredScopes).  They're empty when the Token
+	// wasn't returned by a Provider.
+	requestedScopes []string
+	grantedScopes   []string
+	requiredScopes  []string
 }
 
 // ensure that Tk implements the Token interface
@@ -57,7 +80,7 @@ var _ Token = (*Tk)(nil)
 
 // NewToken creates a new Token (*Tk).  The IDToken is required and the
 // *oauth2.Token may be nil.  Supports the WithNow option (with a default to
-// time.Now).
+// time.Now) and the WithOfflineAccess option.
 func NewToken(i IDToken, t *oauth2.Token, opt ...Option) (*Tk, error) {
 	// since oauth2 is part of stdlib we're not going to worry about it leaking
 	// into our abstraction in this factory
@@ -67,9 +90,10 @@ func NewToken(i IDToken, t *oauth2.Token, opt ...Option) (*Tk, error) {
 	}
 	opts := getTokenOpts(opt...)
 	return &Tk{
-		idToken:    i,
-		underlying: t,
-		nowFunc:    opts.withNowFunc,
+		idToken:       i,
+		underlying:    t,
+		nowFunc:       opts.withNowFunc,
+		offlineAccess: opts.withOfflineAccess,
 	}, nil
 }
 
@@ -124,7 +148,7 @@ func (t *Tk) IsExpired() bool {
 	if t.underlying.Expiry.IsZero() {
 		return false
 	}
-	return t.underlying.Expiry.Round(0).Before(time.Now().Add(TokenExpirySkew))
+	return t.underlying.Expiry.Round(0).Before(t.now().Add(TokenExpirySkew))
 }
 
 // Valid will ensure that the access_token is not empty or expired. It will
@@ -139,6 +163,99 @@ func (t *Tk) Valid() bool {
 	return !t.IsExpired()
 }
 
+// OfflineAccessRequested implements the Token.OfflineAccessRequested()
+// interface function.
+func (t *Tk) OfflineAccessRequested() bool { return t.offlineAccess }
+
+// RefreshTokenGranted implements the Token.RefreshTokenGranted() interface
+// function.
+func (t *Tk) RefreshTokenGranted() bool { return t.RefreshToken() != "" }
+
+// RequestedScopes returns a copy of the scopes requested for the Token.
+func (t *Tk) RequestedScopes() []string { return copyStrings(t.requestedScopes) }
+
+// GrantedScopes returns a copy of the scopes granted by the provider for the
+// Token.  The granted scopes are the scope parameter of the provider's token
+// response, or the scope (or scp) claim of a JWT access_token when the
+// parameter is missing.  When both are missing, the requested scopes were
+// granted (see https://tools.ietf.org/html/rfc6749#section-5.1).
+func (t *Tk) GrantedScopes() []string { return copyStrings(t.grantedScopes) }
+
+// DeniedScopes returns the requested scopes which the provider didn't grant,
+// which may be empty.  Some providers don't include the openid or
+// offline_access scopes in their granted scopes, so they may be denied even
+// though the Token has an id_token or refresh_token.
+func (t *Tk) DeniedScopes() []string { return missingScopes(t.requestedScopes, t.grantedScopes) }
+
+// setScopes sets the Token's requested, granted and required scopes.  The
+// granted scopes are taken from the oauth2.Token, or they're the prevGranted
+// scopes when they're not included.  An error wrapping ErrScopesNotGranted is
+// returned when any of the required scopes weren't granted.
+func (t *Tk) setScopes(requested, prevGranted, required []string, oauth2Token *oauth2.Token) error {
+	const op = "Tk.setScopes"
+	t.requestedScopes = copyStrings(requested)
+	t.requiredScopes = copyStrings(required)
+	t.grantedScopes = tokenScopes(oauth2Token)
+	if t.grantedScopes == nil {
+		t.grantedScopes = copyStrings(prevGranted)
+	}
+	if missing := missingScopes(required, t.grantedScopes); len(missing) > 0 {
+		return fmt.Errorf("%s: %s: %w", op, strings.Join(missing, " "), ErrScopesNotGranted)
+	}
+	return nil
+}
+
+// tokenScopes returns the scopes of a token response's scope parameter or of
+// its JWT access_token's scope (or scp) claim.  It returns nil when neither
+// are present.
+func tokenScopes(t *oauth2.Token) []string {
+	if t == nil {
+		return nil
+	}
+	if s, ok := t.Extra("scope").(string); ok && strings.TrimSpace(s) != "" {
+		return strings.Fields(s)
+	}
+	var claims struct {
+		Scope string      `json:"scope"`
+		Scp   interface{} `json:"scp"`
+	}
+	if err := UnmarshalClaims(t.AccessToken, &claims); err != nil {
+		// the access_token is opaque
+		return nil
+	}
+	switch scp := claims.Scp.(type) {
+	case string:
+		if claims.Scope == "" {
+			claims.Scope = scp
+		}
+	case []interface{}:
+		if claims.Scope == "" {
+			var scopes []string
+			for _, v := range scp {
+				if s, ok := v.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+			return scopes
+		}
+	}
+	if strings.TrimSpace(claims.Scope) == "" {
+		return nil
+	}
+	return strings.Fields(claims.Scope)
+}
+
+// missingScopes returns the scopes which aren't in the granted scopes.
+func missingScopes(scopes, granted []string) []string {
+	var missing []string
+	for _, s := range scopes {
+		if !strutils.StrListContains(granted, s) {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
 // now returns the current time using the optional nowFunc.
 func (t *Tk) now() time.Time {
 	if t.nowFunc != nil {
@@ -149,7 +266,8 @@ func (t *Tk) now() time.Time {
 
 // tokenOptions is the set of available options for Token functions
 type tokenOptions struct {
-	withNowFunc func() time.Time
+	withNowFunc       func() time.Time
+	withOfflineAccess bool
 }
 
 // tokenDefaults is a handy way to get the defaults at runtime and during unit
@@ -166,19 +284,68 @@ func getTokenOpts(opt ...Option) tokenOptions {
 	return opts
 }
 
+// MaxTokenSize is the maximum size (in bytes) of a raw JWT that will be
+// parsed.  Larger tokens are rejected before they're decoded.
+const MaxTokenSize = 128 * 1024
+
+// MaxClaimsDepth is the maximum nesting depth of the JSON objects and arrays
+// in a JWT's claims.
+const MaxClaimsDepth = 32
+
 // UnmarshalClaims will retrieve the claims from the provided raw JWT token.
+// Tokens larger than MaxTokenSize, and claims which aren't valid UTF-8 or are
+// nested deeper than MaxClaimsDepth are rejected.
 func UnmarshalClaims(rawToken string, claims interface{}) error {
 	const op = "UnmarshalClaims"
-	parts := strings.Split(string(rawToken), ".")
-	if len(parts) != 3 {
-		return fmt.Errorf("%s: malformed jwt, expected 3 parts got %d: %w", op, len(parts), ErrInvalidParameter)
+	if len(rawToken) > MaxTokenSize {
+		return fmt.Errorf("%s: jwt is larger than %d bytes: %w", op, MaxTokenSize, ErrMalformedToken)
+	}
+	// find the payload without splitting the token, which avoids allocating
+	// the parts.
+	if n := strings.Count(rawToken, ".") + 1; n != 3 {
+		return fmt.Errorf("%s: malformed jwt, expected 3 parts got %d: %w", op, n, ErrInvalidParameter)
 	}
-	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	payload := rawToken[strings.IndexByte(rawToken, '.')+1 : strings.LastIndexByte(rawToken, '.')]
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
 	if err != nil {
 		return fmt.Errorf("%s: malformed jwt claims: %w", op, err)
 	}
+	if err := validClaimsJSON(raw); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
 	if err := json.Unmarshal(raw, claims); err != nil {
 		return fmt.Errorf("%s: unable to marshal jwt JSON: %w", op, err)
 	}
 	return nil
 }
+
+// validClaimsJSON checks that raw claims are valid UTF-8 and aren't nested
+// deeper than MaxClaimsDepth, before they are unmarshaled.  It doesn't
+// validate the JSON, which is left to the json package.
+func validClaimsJSON(raw []byte) error {
+	const op = "validClaimsJSON"
+	if !utf8.Valid(raw) {
+		return fmt.Errorf("%s: claims are not valid UTF-8: %w", op, ErrMalformedToken)
+	}
+	var depth int
+	var inString, escaped bool
+	for _, b := range raw {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && b == '\\':
+			escaped = true
+		case b == '"':
+			inString = !inString
+		case inString:
+		case b == '{' || b == '[':
+			depth++
+			if depth > MaxClaimsDepth {
+				return fmt.Errorf("%s: claims are nested deeper than %d: %w", op, MaxClaimsDepth, ErrMalformedToken)
+			}
+		case b == '}' || b == ']':
+			depth--
+		}
+	}
+	return nil
+}
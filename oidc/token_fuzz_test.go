@@ -0,0 +1,80 @@
+//go:build go1.18
+// +build go1.18
+
+package oidc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func FuzzUnmarshalClaims(f *testing.F) {
+	_, priv := TestGenerateKeys(f)
+	f.Add(TestSignJWT(f, priv, ES256, map[string]interface{}{"sub": "alice", "groups": []string{"a", "b"}}, nil))
+	f.Add("e30.e30.")
+	f.Add("e30.eyJhIjpbW1tbXV1dXX0.sig")
+	f.Add("..")
+	f.Add("not-a-jwt")
+	f.Fuzz(func(t *testing.T, rawToken string) {
+		var claims map[string]interface{}
+		if err := UnmarshalClaims(rawToken, &claims); err != nil {
+			return
+		}
+		// claims which are accepted can always be marshaled again
+		if _, err := json.Marshal(claims); err != nil {
+			t.Errorf("unable to marshal accepted claims: %s", err)
+		}
+	})
+}
+
+func FuzzIDToken_verifyHashClaims(f *testing.F) {
+	_, priv := TestGenerateKeys(f)
+	f.Add(TestSignJWT(f, priv, ES256, map[string]interface{}{"at_hash": "hash", "c_hash": "hash"}, nil), "access-token")
+	f.Add(TestSignJWT(f, priv, ES256, map[string]interface{}{"at_hash": 1, "c_hash": []string{}}, nil), "")
+	f.Add("e30.eyJhdF9oYXNoIjoiaGFzaCJ9.", "code")
+	f.Fuzz(func(t *testing.T, idToken, token string) {
+		// the id_token's claims are attacker controlled, so verifying them
+		// must never panic
+		_, _ = IDToken(idToken).VerifyAccessToken(AccessToken(token))
+		_, _ = IDToken(idToken).VerifyAuthorizationCode(token)
+	})
+}
+
+func FuzzNewToken(f *testing.F) {
+	_, priv := TestGenerateKeys(f)
+	f.Add(TestSignJWT(f, priv, ES256, map[string]interface{}{"sub": "alice"}, nil), "access-token", "refresh-token", int64(60))
+	f.Add("", "", "", int64(0))
+	f.Add("id-token", "access-token", "", int64(-1))
+	f.Fuzz(func(t *testing.T, idToken, accessToken, refreshToken string, expiresIn int64) {
+		tk, err := NewToken(IDToken(idToken), &oauth2.Token{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			Expiry:       time.Now().Add(time.Duration(expiresIn) * time.Second),
+		})
+		if err != nil {
+			return
+		}
+		if string(tk.IDToken()) != idToken || string(tk.AccessToken()) != accessToken || string(tk.RefreshToken()) != refreshToken {
+			t.Errorf("token doesn't match the token response")
+		}
+		// tokens are always redacted when they're logged or marshaled
+		for _, tt := range []struct {
+			token    interface{ String() string }
+			redacted string
+		}{
+			{tk.IDToken(), RedactedIDToken},
+			{tk.AccessToken(), RedactedAccessToken},
+			{tk.RefreshToken(), RedactedRefreshToken},
+		} {
+			if got := tt.token.String(); got != tt.redacted {
+				t.Errorf("token not redacted: %s", got)
+			}
+			if b, err := json.Marshal(tt.token); err != nil || string(b) != `"`+tt.redacted+`"` {
+				t.Errorf("token not redacted: %s (err: %v)", b, err)
+			}
+		}
+	})
+}
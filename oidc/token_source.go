@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc"
+	"golang.org/x/oauth2"
+)
+
+// VerifiedTokenSource returns an oauth2.TokenSource which verifies the tokens
+// from ts before they are used.  It allows tokens minted by other libraries
+// (golang.org/x/oauth2, a workload identity provider, etc) to be used with the
+// provider's features, like Provider.UserInfo.
+//
+// Every token from ts must have an access_token and must not be expired.
+//
+// When a token includes an id_token (see oauth2.Token.Extra), the id_token is
+// verified like an id_token returned from a refresh (see
+// Provider.VerifyIDToken, without the nonce and max_age checks).
+//
+// When the WithAudiences option is provided, the access_token must be a JWT
+// which is signed by the provider's keys, issued by the provider, not expired
+// and has one of the audiences.
+//
+// The ctx is used when the tokens are verified (to fetch the provider's
+// keys, etc).
+//
+// Supported options: WithAudiences
+func (p *Provider) VerifiedTokenSource(ctx context.Context, ts oauth2.TokenSource, opt ...Option) (oauth2.TokenSource, error) {
+	const op = "Provider.VerifiedTokenSource"
+	if ts == nil {
+		return nil, fmt.Errorf("%s: token source is nil: %w", op, ErrNilParameter)
+	}
+	opts := getTokenSourceOpts(opt...)
+	return &verifiedTokenSource{
+		ctx:       ctx,
+		p:         p,
+		ts:        ts,
+		audiences: opts.withAudiences,
+	}, nil
+}
+
+// verifiedTokenSource is the oauth2.TokenSource returned by
+// Provider.VerifiedTokenSource
+type verifiedTokenSource struct {
+	ctx       context.Context
+	p         *Provider
+	ts        oauth2.TokenSource
+	audiences []string
+
+	// mu guards verified, which is the most recently verified token.  Token
+	// sources typically return the same token until it expires, so it only
+	// needs to be verified once.
+	mu       sync.Mutex
+	verified *oauth2.Token
+}
+
+// Token satisfies the oauth2.TokenSource interface and returns a verified
+// token.
+func (s *verifiedTokenSource) Token() (*oauth2.Token, error) {
+	const op = "verifiedTokenSource.Token"
+	t, err := s.ts.Token()
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to get token: %w", op, err)
+	}
+	if t == nil || t.AccessToken == "" {
+		return nil, fmt.Errorf("%s: %w", op, ErrMissingAccessToken)
+	}
+	if !t.Valid() {
+		return nil, fmt.Errorf("%s: token is expired: %w", op, ErrExpiredToken)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.verified == t {
+		return t, nil
+	}
+	if raw, ok := t.Extra("id_token").(string); ok && raw != "" {
+		if _, err := s.p.verifyIDToken(s.ctx, IDToken(raw), nil, nil); err != nil {
+			return nil, fmt.Errorf("%s: id_token failed verification: %w", op, err)
+		}
+	}
+	if len(s.audiences) > 0 {
+		if err := s.verifyAccessToken(t.AccessToken); err != nil {
+			return nil, fmt.Errorf("%s: access_token failed verification: %w", op, err)
+		}
+	}
+	s.verified = t
+	return t, nil
+}
+
+// verifyAccessToken verifies that a JWT access_token is signed by the
+// provider's keys, issued by the provider, not expired and has one of the
+// audiences.
+func (s *verifiedTokenSource) verifyAccessToken(accessToken string) error {
+	const op = "verifiedTokenSource.verifyAccessToken"
+	if strings.Count(accessToken, ".") != 2 {
+		return fmt.Errorf("%s: access_token is not a jwt: %w", op, ErrMalformedToken)
+	}
+	if len(accessToken) > MaxTokenSize {
+		return fmt.Errorf("%s: access_token is larger than %d bytes: %w", op, MaxTokenSize, ErrMalformedToken)
+	}
+	config := s.p.currentConfig()
+	_, keySet, err := s.p.discovered(s.ctx)
+	if err != nil {
+		return fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	algs := make([]string, 0, len(config.SupportedSigningAlgs))
+	for _, a := range config.SupportedSigningAlgs {
+		algs = append(algs, string(a))
+	}
+	// the client_id isn't checked, since the audiences are checked instead
+	verifier := oidc.NewVerifier(config.Issuer, keySet, &oidc.Config{
+		SkipClientIDCheck:    true,
+		SupportedSigningAlgs: algs,
+		Now:                  config.Now,
+	})
+	verified, err := verifier.Verify(s.ctx, accessToken)
+	if err != nil {
+		return fmt.Errorf("%s: invalid access_token: %w", op, convertError(err))
+	}
+	if err := verifyAudience(s.audiences, verified.Audience); err != nil {
+		return fmt.Errorf("%s: invalid access_token audiences: %w", op, err)
+	}
+	return nil
+}
+
+// tokenSourceOptions is the set of available options for the
+// Provider.VerifiedTokenSource function
+type tokenSourceOptions struct {
+	withAudiences []string
+}
+
+// tokenSourceDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func tokenSourceDefaults() tokenSourceOptions {
+	return tokenSourceOptions{}
+}
+
+// getTokenSourceOpts gets the Provider.VerifiedTokenSource defaults and
+// applies the opt overrides passed in
+func getTokenSourceOpts(opt ...Option) tokenSourceOptions {
+	opts := tokenSourceDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
@@ -0,0 +1,137 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestProvider_VerifiedTokenSource(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+	p := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+
+	oidcRequest, err := NewRequest(time.Minute, redirect)
+	require.NoError(t, err)
+	tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+	tk, err := p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+	require.NoError(t, err)
+
+	priv, _, alg, keyID := tp.SigningKeys()
+	signAccessToken := func(key crypto.PrivateKey, aud ...string) string {
+		now := time.Now()
+		return TestSignJWT(t, key, alg, jwt.Claims{
+			Issuer:   tp.Addr(),
+			Subject:  "alice@example.com",
+			Audience: aud,
+			IssuedAt: jwt.NewNumericDate(now),
+			Expiry:   jwt.NewNumericDate(now.Add(time.Minute)),
+		}, []byte(keyID))
+	}
+	_, otherPriv := TestGenerateKeys(t)
+	expiry := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name      string
+		token     *oauth2.Token
+		opt       []Option
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name:  "opaque-access-token",
+			token: &oauth2.Token{AccessToken: "opaque", Expiry: expiry},
+		},
+		{
+			name:      "missing-access-token",
+			token:     &oauth2.Token{Expiry: expiry},
+			wantErr:   true,
+			wantIsErr: ErrMissingAccessToken,
+		},
+		{
+			name:      "expired",
+			token:     &oauth2.Token{AccessToken: "opaque", Expiry: time.Now().Add(-time.Minute)},
+			wantErr:   true,
+			wantIsErr: ErrExpiredToken,
+		},
+		{
+			name:  "valid-id-token",
+			token: (&oauth2.Token{AccessToken: "opaque", Expiry: expiry}).WithExtra(map[string]interface{}{"id_token": string(tk.IDToken())}),
+		},
+		{
+			name: "invalid-id-token",
+			token: (&oauth2.Token{AccessToken: "opaque", Expiry: expiry}).WithExtra(map[string]interface{}{
+				"id_token": testDefaultJWT(t, otherPriv, time.Minute, "", nil),
+			}),
+			wantErr: true,
+		},
+		{
+			name:  "valid-jwt-access-token",
+			token: &oauth2.Token{AccessToken: signAccessToken(priv, "api"), Expiry: expiry},
+			opt:   []Option{WithAudiences("api")},
+		},
+		{
+			name:      "invalid-access-token-audience",
+			token:     &oauth2.Token{AccessToken: signAccessToken(priv, "other-api"), Expiry: expiry},
+			opt:       []Option{WithAudiences("api")},
+			wantErr:   true,
+			wantIsErr: ErrInvalidAudience,
+		},
+		{
+			name:      "invalid-access-token-signature",
+			token:     &oauth2.Token{AccessToken: signAccessToken(otherPriv, "api"), Expiry: expiry},
+			opt:       []Option{WithAudiences("api")},
+			wantErr:   true,
+			wantIsErr: ErrInvalidSignature,
+		},
+		{
+			name:      "opaque-access-token-with-audiences",
+			token:     &oauth2.Token{AccessToken: "opaque", Expiry: expiry},
+			opt:       []Option{WithAudiences("api")},
+			wantErr:   true,
+			wantIsErr: ErrMalformedToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			ts, err := p.VerifiedTokenSource(ctx, oauth2.StaticTokenSource(tt.token), tt.opt...)
+			require.NoError(err)
+			got, err := ts.Token()
+			if tt.wantErr {
+				require.Error(err)
+				if tt.wantIsErr != nil {
+					assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				}
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.token, got)
+		})
+	}
+	t.Run("nil-token-source", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := p.VerifiedTokenSource(ctx, nil)
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+	})
+	t.Run("userinfo", func(t *testing.T) {
+		require := require.New(t)
+		ts, err := p.VerifiedTokenSource(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: signAccessToken(priv, "api"), Expiry: expiry}), WithAudiences("api"))
+		require.NoError(err)
+		var claims map[string]interface{}
+		require.NoError(p.UserInfo(ctx, ts, "alice@example.com", &claims))
+	})
+}
@@ -1,7 +1,10 @@
 package oidc
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -83,6 +86,24 @@ func TestNewToken(t *testing.T) {
 			wantExpired:      false,
 			wantValid:        true,
 		},
+		{
+			name:       "valid-offline-access",
+			idToken:    IDToken(testJWT),
+			oauthToken: testUnderlying,
+			opts:       []Option{WithOfflineAccess()},
+			want: &Tk{
+				idToken:       IDToken(testJWT),
+				underlying:    testUnderlying,
+				offlineAccess: true,
+			},
+			wantIDToken:      IDToken(testJWT),
+			wantAccessToken:  AccessToken(testAccessToken),
+			wantRefreshToken: RefreshToken(testRefreshToken),
+			wantTokenSource:  oauth2.StaticTokenSource(testUnderlying),
+			wantExpiry:       testExpiry,
+			wantExpired:      false,
+			wantValid:        true,
+		},
 		{
 			name:    "valid-without-accessToken",
 			idToken: IDToken(testJWT),
@@ -136,11 +157,117 @@ func TestNewToken(t *testing.T) {
 			assert.Equalf(tt.wantTokenSource, got.StaticTokenSource(), "t.StaticTokenSource() = %v, want %v", tt.wantTokenSource, got.StaticTokenSource())
 			assert.Equalf(tt.wantExpired, got.IsExpired(), "t.Expired() = %v, want %v", tt.wantExpired, got.IsExpired())
 			assert.Equalf(tt.wantValid, got.Valid(), "t.Valid() = %v, want %v", tt.wantValid, got.Valid())
+			assert.Equalf(tt.want.offlineAccess, got.OfflineAccessRequested(), "t.OfflineAccessRequested() = %v, want %v", got.OfflineAccessRequested(), tt.want.offlineAccess)
+			assert.Equalf(tt.wantRefreshToken != "", got.RefreshTokenGranted(), "t.RefreshTokenGranted() = %v, want %v", got.RefreshTokenGranted(), tt.wantRefreshToken != "")
 			testAssertEqualFunc(t, tt.want.nowFunc, got.nowFunc, "now = %p,want %p", tt.want.nowFunc, got.nowFunc)
 		})
 	}
 }
 
+func Test_tokenScopes(t *testing.T) {
+	t.Parallel()
+	jwt := func(claims map[string]interface{}) string {
+		payload, err := json.Marshal(claims)
+		require.NoError(t, err)
+		return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+	}
+	tests := []struct {
+		name  string
+		token *oauth2.Token
+		want  []string
+	}{
+		{name: "nil"},
+		{
+			name:  "scope-param",
+			token: (&oauth2.Token{AccessToken: jwt(map[string]interface{}{"scope": "ignored"})}).WithExtra(map[string]interface{}{"scope": "openid  email"}),
+			want:  []string{"openid", "email"},
+		},
+		{
+			name:  "scope-claim",
+			token: &oauth2.Token{AccessToken: jwt(map[string]interface{}{"scope": "openid email"})},
+			want:  []string{"openid", "email"},
+		},
+		{
+			name:  "scp-string-claim",
+			token: &oauth2.Token{AccessToken: jwt(map[string]interface{}{"scp": "email profile"})},
+			want:  []string{"email", "profile"},
+		},
+		{
+			name:  "scp-array-claim",
+			token: &oauth2.Token{AccessToken: jwt(map[string]interface{}{"scp": []string{"email", "profile"}})},
+			want:  []string{"email", "profile"},
+		},
+		{
+			name:  "jwt-without-scopes",
+			token: &oauth2.Token{AccessToken: jwt(map[string]interface{}{"sub": "alice"})},
+		},
+		{
+			name:  "opaque",
+			token: &oauth2.Token{AccessToken: "opaque-access-token"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			assert.Equal(tt.want, tokenScopes(tt.token))
+		})
+	}
+}
+
+func TestTk_setScopes(t *testing.T) {
+	t.Parallel()
+	requested := []string{"openid", "email", "profile"}
+	granted := (&oauth2.Token{AccessToken: "opaque"}).WithExtra(map[string]interface{}{"scope": "openid email"})
+	tests := []struct {
+		name        string
+		prevGranted []string
+		required    []string
+		token       *oauth2.Token
+		wantGranted []string
+		wantDenied  []string
+		wantErr     bool
+	}{
+		{
+			name:        "granted",
+			token:       granted,
+			required:    []string{"email"},
+			wantGranted: []string{"openid", "email"},
+			wantDenied:  []string{"profile"},
+		},
+		{
+			name:        "prev-granted",
+			prevGranted: requested,
+			token:       &oauth2.Token{AccessToken: "opaque"},
+			wantGranted: requested,
+		},
+		{
+			name:        "required-not-granted",
+			token:       granted,
+			required:    []string{"email", "profile"},
+			wantGranted: []string{"openid", "email"},
+			wantDenied:  []string{"profile"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			tk, err := NewToken("id-token", tt.token)
+			require.NoError(err)
+			err = tk.setScopes(requested, tt.prevGranted, tt.required, tt.token)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, ErrScopesNotGranted), "wanted \"%s\" but got \"%s\"", ErrScopesNotGranted, err)
+			} else {
+				require.NoError(err)
+			}
+			assert.Equal(requested, tk.RequestedScopes())
+			assert.Equal(tt.wantGranted, tk.GrantedScopes())
+			assert.Equal(tt.wantDenied, tk.DeniedScopes())
+		})
+	}
+}
+
 func TestUnmarshalClaims(t *testing.T) {
 	// UnmarshalClaims testing is covered by other tests but we do have just a
 	// few more test to add here.
@@ -153,4 +280,54 @@ func TestUnmarshalClaims(t *testing.T) {
 		require.Error(err)
 		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
 	})
+	encode := func(payload string) string {
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+	}
+	tests := []struct {
+		name      string
+		jwt       string
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name: "valid",
+			jwt:  encode(`{"sub":"alice","address":{"country":"US"},"groups":["a","b"],"name":"{[\"}"}`),
+		},
+		{
+			name:      "too-large",
+			jwt:       encode(`{"sub":"` + strings.Repeat("a", MaxTokenSize) + `"}`),
+			wantErr:   true,
+			wantIsErr: ErrMalformedToken,
+		},
+		{
+			name: "max-depth",
+			jwt:  encode(`{"a":` + strings.Repeat("[", MaxClaimsDepth-1) + strings.Repeat("]", MaxClaimsDepth-1) + `}`),
+		},
+		{
+			name:      "too-deep",
+			jwt:       encode(`{"a":` + strings.Repeat("[", MaxClaimsDepth) + strings.Repeat("]", MaxClaimsDepth) + `}`),
+			wantErr:   true,
+			wantIsErr: ErrMalformedToken,
+		},
+		{
+			name:      "invalid-utf8",
+			jwt:       encode("{\"sub\":\"\xff\xfe\"}"),
+			wantErr:   true,
+			wantIsErr: ErrMalformedToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			var claims map[string]interface{}
+			err := UnmarshalClaims(tt.jwt, &claims)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.NotEmpty(claims)
+		})
+	}
 }
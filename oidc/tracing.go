@@ -0,0 +1,159 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Attribute keys of the provider's trace spans.  Spans only include safe
+// attributes; tokens, codes, secrets, states and nonces are never included.
+const (
+	TraceAttrIssuer   = "oidc.issuer"
+	TraceAttrClientID = "oidc.client_id"
+)
+
+// traceRequestIDHeaders are the response headers which IdPs use to identify
+// their requests.  When they're in a response to one of the provider's
+// requests, they're recorded in the span's attributes (using the
+// "http.response.header.<lowercase name>" key), so issues can be correlated
+// across the provider's and IdP's logs.
+var traceRequestIDHeaders = []string{
+	"X-Request-Id",
+	"Request-Id",
+	"X-Correlation-Id",
+	"X-Ms-Request-Id",
+	"X-Amzn-Requestid",
+	"X-Okta-Request-Id",
+}
+
+// Tracer creates the trace spans of a Provider's operations.  Implementations
+// must be safe for concurrent use.
+//
+// See the oidc/tracing/otel module for a ready-made OpenTelemetry Tracer.
+type Tracer interface {
+	// Start starts a span with the name and attributes, which is a child of
+	// the ctx's span (if any).  It returns a copy of the ctx which carries the
+	// new span.
+	Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span)
+
+	// SpanFromContext returns the span carried by the ctx, or nil when the ctx
+	// doesn't carry a span.
+	SpanFromContext(ctx context.Context) Span
+
+	// ContextWithSpan returns a copy of the ctx which carries the span.
+	ContextWithSpan(ctx context.Context, span Span) context.Context
+}
+
+// Span is a trace span started by a Tracer.
+type Span interface {
+	// SetAttribute sets the span's attribute for the key to the values.
+	SetAttribute(key string, values []string)
+
+	// Inject adds the span's trace context (e.g. the W3C traceparent and
+	// tracestate headers) to the header of an http request made during the
+	// span.
+	Inject(header http.Header)
+
+	// End records the err (if any) as the span's status, and ends the span.
+	End(err error)
+}
+
+// WithTracer provides an optional Tracer which is used to create spans for
+// the provider's operations: discovery, issuing an auth URL, exchange,
+// id_token verification, userinfo and refresh.  Spans are not created by
+// default.
+//
+// When tracing is enabled, the provider's http requests to the IdP carry the
+// trace context of their span, and the request-id headers of the IdP's
+// responses are recorded in the span's attributes.
+//
+// Valid for: Provider
+func WithTracer(t Tracer) Option {
+	return func(o interface{}) {
+		if t == nil {
+			return
+		}
+		if o, ok := o.(*providerOptions); ok {
+			o.withTracer = t
+		}
+	}
+}
+
+// startSpan starts a span for a provider operation with the config's safe
+// attributes.  The span is a no-op when the provider doesn't have a Tracer.
+func (p *Provider) startSpan(ctx context.Context, name string, config *Config) (context.Context, Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if p.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	var attrs map[string]string
+	if config != nil {
+		attrs = map[string]string{
+			TraceAttrIssuer:   config.Issuer,
+			TraceAttrClientID: config.ClientID,
+		}
+	}
+	return p.tracer.Start(ctx, name, attrs)
+}
+
+// backgroundContext returns the provider's background ctx, carrying the ctx's
+// span (if any), for work which outlives the ctx but is part of its trace.
+func (p *Provider) backgroundContext(ctx context.Context) context.Context {
+	if p.tracer == nil || ctx == nil {
+		return p.backgroundCtx
+	}
+	if span := p.tracer.SpanFromContext(ctx); span != nil {
+		return p.tracer.ContextWithSpan(p.backgroundCtx, span)
+	}
+	return p.backgroundCtx
+}
+
+// noopSpan is a Span that discards everything
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, []string) {}
+func (noopSpan) Inject(http.Header)            {}
+func (noopSpan) End(error)                     {}
+
+// traceTransport is an http.RoundTripper which propagates the trace context of
+// the request's span and records the response's request-id headers in the
+// span's attributes.
+type traceTransport struct {
+	base   http.RoundTripper
+	tracer Tracer
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span := t.tracer.SpanFromContext(req.Context())
+	if span == nil {
+		return t.base.RoundTrip(req)
+	}
+	// a RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	span.Inject(req.Header)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	for _, h := range traceRequestIDHeaders {
+		if v := resp.Header.Values(h); len(v) > 0 {
+			span.SetAttribute("http.response.header."+strings.ToLower(h), v)
+		}
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the base transport's idle connections, which
+// allows http.Client.CloseIdleConnections() to work with the traceTransport.
+func (t *traceTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if tr, ok := t.base.(closeIdler); ok {
+		tr.CloseIdleConnections()
+	}
+}
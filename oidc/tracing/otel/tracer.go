@@ -0,0 +1,104 @@
+// Package otel provides an oidc.Tracer which creates OpenTelemetry spans for
+// the operations of oidc Providers.  The provider's http requests carry the
+// W3C trace context (traceparent and tracestate headers) of their span.
+//
+// Example:
+//
+//	tracer, err := otel.NewTracer(otelapi.GetTracerProvider())
+//	if err != nil {
+//	  // handle err
+//	}
+//	p, err := oidc.NewProvider(pc, oidc.WithTracer(tracer))
+package otel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/hashicorp/cap/oidc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the OpenTelemetry tracer used by providers
+const TracerName = "github.com/hashicorp/cap/oidc"
+
+// Tracer is an oidc.Tracer backed by an OpenTelemetry trace.Tracer.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// ensure that Tracer implements the oidc.Tracer interface
+var _ oidc.Tracer = (*Tracer)(nil)
+
+// NewTracer creates a Tracer using the tracer provider's TracerName tracer.
+func NewTracer(tp trace.TracerProvider) (*Tracer, error) {
+	const op = "otel.NewTracer"
+	if tp == nil {
+		return nil, fmt.Errorf("%s: tracer provider is nil: %w", op, oidc.ErrNilParameter)
+	}
+	return &Tracer{tracer: tp.Tracer(TracerName)}, nil
+}
+
+// Start satisfies the oidc.Tracer interface.
+func (t *Tracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, oidc.Span) {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]attribute.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, attribute.String(k, attrs[k]))
+	}
+	ctx, s := t.tracer.Start(ctx, name, trace.WithAttributes(kvs...))
+	return ctx, &span{span: s}
+}
+
+// SpanFromContext satisfies the oidc.Tracer interface.  It returns nil when
+// the ctx doesn't carry a span with a valid span context.
+func (t *Tracer) SpanFromContext(ctx context.Context) oidc.Span {
+	s := trace.SpanFromContext(ctx)
+	if !s.SpanContext().IsValid() {
+		return nil
+	}
+	return &span{span: s}
+}
+
+// ContextWithSpan satisfies the oidc.Tracer interface.  The ctx is returned
+// unchanged when the span wasn't created by a Tracer.
+func (t *Tracer) ContextWithSpan(ctx context.Context, s oidc.Span) context.Context {
+	if s, ok := s.(*span); ok {
+		return trace.ContextWithSpan(ctx, s.span)
+	}
+	return ctx
+}
+
+// span is an oidc.Span backed by an OpenTelemetry trace.Span.
+type span struct {
+	span trace.Span
+}
+
+// SetAttribute satisfies the oidc.Span interface.
+func (s *span) SetAttribute(key string, values []string) {
+	s.span.SetAttributes(attribute.StringSlice(key, values))
+}
+
+// Inject satisfies the oidc.Span interface.
+func (s *span) Inject(header http.Header) {
+	ctx := trace.ContextWithSpan(context.Background(), s.span)
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// End satisfies the oidc.Span interface.
+func (s *span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,160 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/cap/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewTracer(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	_, err := NewTracer(nil)
+	require.Error(err)
+	assert.Truef(errors.Is(err, oidc.ErrNilParameter), "wanted \"%s\" but got \"%s\"", oidc.ErrNilParameter, err)
+}
+
+func TestTracer(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tracerProvider := &testTracerProvider{}
+	tracer, err := NewTracer(tracerProvider)
+	require.NoError(t, err)
+
+	t.Run("provider", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tp := oidc.StartTestProvider(t)
+		pc, err := oidc.NewConfig(tp.Addr(), "test-client-id", "test-client-secret", []oidc.Alg{oidc.RS256}, []string{"https://test-redirect"}, oidc.WithProviderCA(tp.CACert()))
+		require.NoError(err)
+		var dump strings.Builder
+		p, err := oidc.NewProvider(pc, oidc.WithTracer(tracer), oidc.WithDebugWriter(&dump))
+		require.NoError(err)
+		defer p.Done()
+
+		var discovery *testSpan
+		for _, s := range tracerProvider.ended() {
+			if s.name == "oidc.Discovery" {
+				discovery = s
+			}
+		}
+		require.NotNil(discovery)
+		assert.Contains(discovery.attrs, attribute.String(oidc.TraceAttrIssuer, tp.Addr()))
+		assert.Contains(discovery.attrs, attribute.String(oidc.TraceAttrClientID, "test-client-id"))
+		sc := discovery.SpanContext()
+		assert.Contains(dump.String(), "Traceparent: 00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01")
+	})
+	t.Run("span", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		assert.Nil(tracer.SpanFromContext(ctx))
+
+		spanCtx, s := tracer.Start(ctx, "test", nil)
+		require.NotNil(tracer.SpanFromContext(spanCtx))
+		// the span can be carried by another ctx
+		require.NotNil(tracer.SpanFromContext(tracer.ContextWithSpan(ctx, s)))
+
+		s.SetAttribute("http.response.header.x-request-id", []string{"req-1", "req-2"})
+		s.End(errors.New("failed"))
+		recorded := s.(*span).span.(*testSpan)
+		assert.Contains(recorded.attrs, attribute.StringSlice("http.response.header.x-request-id", []string{"req-1", "req-2"}))
+		assert.Equal(codes.Error, recorded.status)
+		require.Len(recorded.errs, 1)
+		assert.True(recorded.isEnded)
+	})
+}
+
+// testTracerProvider is a trace.TracerProvider which records spans
+type testTracerProvider struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (tp *testTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &testTracer{tp: tp}
+}
+
+func (tp *testTracerProvider) ended() []*testSpan {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	var spans []*testSpan
+	for _, s := range tp.spans {
+		if s.isEnded {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+type testTracer struct {
+	tp *testTracerProvider
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	cfg := trace.NewSpanStartConfig(opts...)
+	t.tp.mu.Lock()
+	defer t.tp.mu.Unlock()
+	// spans have a valid span context, so their trace context is propagated
+	traceID := trace.SpanContextFromContext(ctx).TraceID()
+	if !traceID.IsValid() {
+		traceID = trace.TraceID{0x01, byte(len(t.tp.spans) + 1)}
+	}
+	s := &testSpan{
+		Span: trace.SpanFromContext(context.Background()),
+		spanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     trace.SpanID{0x01, byte(len(t.tp.spans) + 1)},
+			TraceFlags: trace.FlagsSampled,
+		}),
+		tp:    t.tp,
+		name:  name,
+		attrs: cfg.Attributes(),
+	}
+	t.tp.spans = append(t.tp.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+// testSpan embeds a noop span and records what's needed by tests
+type testSpan struct {
+	trace.Span
+	spanContext trace.SpanContext
+	tp          *testTracerProvider
+	name        string
+	attrs       []attribute.KeyValue
+	errs        []error
+	status      codes.Code
+	isEnded     bool
+}
+
+func (s *testSpan) SpanContext() trace.SpanContext { return s.spanContext }
+
+func (s *testSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.tp.mu.Lock()
+	defer s.tp.mu.Unlock()
+	s.attrs = append(s.attrs, kv...)
+}
+
+func (s *testSpan) RecordError(err error, _ ...trace.EventOption) {
+	s.tp.mu.Lock()
+	defer s.tp.mu.Unlock()
+	s.errs = append(s.errs, err)
+}
+
+func (s *testSpan) SetStatus(code codes.Code, _ string) {
+	s.tp.mu.Lock()
+	defer s.tp.mu.Unlock()
+	s.status = code
+}
+
+func (s *testSpan) End(...trace.SpanEndOption) {
+	s.tp.mu.Lock()
+	defer s.tp.mu.Unlock()
+	s.isEnded = true
+}
@@ -0,0 +1,217 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_tracing(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetExpectedAuthCode("test-code")
+	tp.SetExpectedRefreshToken("test-refresh-token")
+
+	tracer := &testTracer{}
+	p, err := NewProvider(testNewConfig(t, clientID, "test-client-secret", redirect, tp), WithLazyDiscovery(), WithTracer(tracer))
+	require.NoError(t, err)
+	defer p.Done()
+
+	oidcRequest, err := NewRequest(time.Minute, redirect)
+	require.NoError(t, err)
+	tp.SetExpectedAuthNonce(oidcRequest.Nonce())
+
+	assert, require := assert.New(t), require.New(t)
+	_, err = p.AuthURL(ctx, oidcRequest)
+	require.NoError(err)
+	tk, err := p.Exchange(ctx, oidcRequest, oidcRequest.State(), "test-code")
+	require.NoError(err)
+	_, err = p.RefreshToken(ctx, tk)
+	require.NoError(err)
+	var claims map[string]interface{}
+	require.NoError(p.UserInfo(ctx, tk.StaticTokenSource(), "alice@example.com", &claims))
+	_, err = p.VerifyIDToken(ctx, "not-a-token", oidcRequest)
+	require.Error(err)
+
+	spans := tracer.ended()
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.name)
+		assert.Equal([]string{tp.Addr()}, s.attrs[TraceAttrIssuer])
+		assert.Equal([]string{clientID}, s.attrs[TraceAttrClientID])
+		for _, values := range s.attrs {
+			for _, secret := range []string{string(tk.IDToken()), string(tk.AccessToken()), "test-code", "test-refresh-token", oidcRequest.Nonce(), oidcRequest.State()} {
+				assert.NotContains(values, secret)
+			}
+		}
+	}
+	// spans are in the order they started, so the nested discovery and
+	// verification spans follow their parents.
+	assert.Equal([]string{
+		"oidc.AuthURL",
+		"oidc.Discovery",
+		"oidc.Exchange",
+		"oidc.VerifyIDToken",
+		"oidc.RefreshToken",
+		"oidc.VerifyIDToken",
+		"oidc.UserInfo",
+		"oidc.VerifyIDToken",
+	}, names)
+
+	failed := spans[len(spans)-1]
+	require.Error(failed.err)
+	assert.True(strings.Contains(failed.err.Error(), "malformed"))
+	for _, s := range spans[:len(spans)-1] {
+		assert.NoError(s.err)
+	}
+}
+
+func TestProvider_tracePropagation(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	redirect := "https://test-redirect"
+	tp := StartTestProvider(t)
+
+	t.Run("enabled", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tracer := &testTracer{}
+		var dump strings.Builder
+		p, err := NewProvider(testNewConfig(t, "test-client-id", "test-client-secret", redirect, tp), WithTracer(tracer), WithDebugWriter(&dump))
+		require.NoError(err)
+		defer p.Done()
+		spans := tracer.ended()
+		require.Len(spans, 1)
+		assert.Contains(dump.String(), "Traceparent: "+spans[0].traceParent())
+	})
+	t.Run("disabled", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		tracer := &testTracer{}
+		// the ctx has a span, but the provider's tracing isn't enabled
+		spanCtx, span := tracer.Start(ctx, "app", nil)
+		defer span.End(nil)
+		var dump strings.Builder
+		p, err := NewProviderWithContext(spanCtx, testNewConfig(t, "test-client-id", "test-client-secret", redirect, tp), WithDebugWriter(&dump))
+		require.NoError(err)
+		defer p.Done()
+		assert.NotContains(dump.String(), "Traceparent")
+	})
+}
+
+func Test_traceTransport(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Traceparent", req.Header.Get("Traceparent"))
+		w.Header().Add("X-Request-Id", "req-1")
+		w.Header().Add("X-Request-Id", "req-2")
+		w.Header().Set("X-Ms-Request-Id", "ms-req")
+	}))
+	defer srv.Close()
+	tracer := &testTracer{}
+	client := &http.Client{Transport: &traceTransport{base: http.DefaultTransport, tracer: tracer}}
+
+	t.Run("span", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		ctx, span := tracer.Start(context.Background(), "test", nil)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		require.NoError(err)
+		resp, err := client.Do(req)
+		require.NoError(err)
+		resp.Body.Close()
+		assert.Empty(req.Header.Get("Traceparent"), "the caller's request must not be modified")
+		s := span.(*testSpan)
+		assert.Equal(s.traceParent(), resp.Header.Get("X-Traceparent"))
+		assert.Equal([]string{"req-1", "req-2"}, s.attrs["http.response.header.x-request-id"])
+		assert.Equal([]string{"ms-req"}, s.attrs["http.response.header.x-ms-request-id"])
+	})
+	t.Run("no-span", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		resp, err := client.Get(srv.URL)
+		require.NoError(err)
+		resp.Body.Close()
+		assert.Empty(resp.Header.Get("X-Traceparent"))
+	})
+}
+
+// testTracer is a Tracer which records spans
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+// testSpanKey is the ctx key of a testSpan
+type testSpanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs map[string]string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := &testSpan{tracer: t, id: len(t.spans) + 1, name: name, attrs: map[string][]string{}}
+	for k, v := range attrs {
+		s.attrs[k] = []string{v}
+	}
+	t.spans = append(t.spans, s)
+	return context.WithValue(ctx, testSpanKey{}, s), s
+}
+
+func (t *testTracer) SpanFromContext(ctx context.Context) Span {
+	if s, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		return s
+	}
+	return nil
+}
+
+func (t *testTracer) ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, testSpanKey{}, span)
+}
+
+func (t *testTracer) ended() []*testSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var spans []*testSpan
+	for _, s := range t.spans {
+		if s.isEnded {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+// testSpan records what's needed by tests
+type testSpan struct {
+	tracer  *testTracer
+	id      int
+	name    string
+	attrs   map[string][]string
+	err     error
+	isEnded bool
+}
+
+func (s *testSpan) traceParent() string { return fmt.Sprintf("test-span-%d", s.id) }
+
+func (s *testSpan) SetAttribute(key string, values []string) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.attrs[key] = values
+}
+
+func (s *testSpan) Inject(header http.Header) {
+	header.Set("Traceparent", s.traceParent())
+}
+
+func (s *testSpan) End(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.err = err
+	s.isEnded = true
+}
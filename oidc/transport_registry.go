@@ -0,0 +1,97 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// TransportRegistry is a registry of pooled http transports keyed by their
+// CA bundle.  Providers configured with the same registry (see
+// WithTransportRegistry) and ProviderCA share a transport, so their
+// connections (file descriptors) and TLS sessions are reused, which is
+// helpful when many Providers are created (multi-tenant).
+//
+// A TransportRegistry is safe for concurrent use.  Since its transports are
+// shared, their idle connections are not closed by Provider.Done(); see
+// TransportRegistry.CloseIdleConnections()
+type TransportRegistry struct {
+	mu         sync.Mutex
+	transports map[string]*http.Transport
+}
+
+// NewTransportRegistry creates a new TransportRegistry.
+func NewTransportRegistry() *TransportRegistry {
+	return &TransportRegistry{
+		transports: map[string]*http.Transport{},
+	}
+}
+
+// Transport returns the registry's transport for the PEM encoded CA bundle,
+// creating it if needed.  An empty caPEM returns the transport which uses the
+// installed system CA chain.
+func (r *TransportRegistry) Transport(caPEM string) (*http.Transport, error) {
+	const op = "TransportRegistry.Transport"
+	sum := sha256.Sum256([]byte(caPEM))
+	key := hex.EncodeToString(sum[:])
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tr, ok := r.transports[key]; ok {
+		return tr, nil
+	}
+	tr, err := newPooledTransport(caPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	r.transports[key] = tr
+	return tr, nil
+}
+
+// Len returns the number of transports in the registry.
+func (r *TransportRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.transports)
+}
+
+// CloseIdleConnections closes the idle connections of every transport in the
+// registry.
+func (r *TransportRegistry) CloseIdleConnections() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tr := range r.transports {
+		tr.CloseIdleConnections()
+	}
+}
+
+// newPooledTransport creates a transport which uses the PEM encoded CA
+// bundle, or the installed system CA chain when caPEM is empty.
+func newPooledTransport(caPEM string) (*http.Transport, error) {
+	const op = "newPooledTransport"
+	// use the cleanhttp package to create a "pooled" transport that's better
+	// configured for requests that re-use the same provider host.  Among other
+	// things, this transport supports better concurrency when making requests
+	// to the same host.  On the downside, this transport can leak file
+	// descriptors over time, so its idle connections need to be closed when
+	// it's no longer used.
+	tr := cleanhttp.DefaultPooledTransport()
+
+	if caPEM != "" {
+		certPool := x509.NewCertPool()
+		if ok := certPool.AppendCertsFromPEM([]byte(caPEM)); !ok {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidCACert)
+		}
+
+		tr.TLSClientConfig = &tls.Config{
+			RootCAs: certPool,
+		}
+	}
+	return tr, nil
+}
@@ -0,0 +1,112 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportRegistry_Transport(t *testing.T) {
+	t.Parallel()
+	_, ca1 := TestGenerateCA(t, []string{"localhost"})
+	_, ca2 := TestGenerateCA(t, []string{"localhost"})
+
+	tests := []struct {
+		name      string
+		caPEM     string
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name: "system-ca",
+		},
+		{
+			name:  "ca1",
+			caPEM: ca1,
+		},
+		{
+			name:  "ca2",
+			caPEM: ca2,
+		},
+		{
+			name:      "invalid-ca",
+			caPEM:     "not-a-ca",
+			wantErr:   true,
+			wantIsErr: ErrInvalidCACert,
+		},
+	}
+	r := NewTransportRegistry()
+	seen := map[*http.Transport]bool{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := r.Transport(tt.caPEM)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.False(seen[got], "transport should be unique per CA")
+			seen[got] = true
+			if tt.caPEM == "" {
+				assert.Nil(got.TLSClientConfig)
+			} else {
+				assert.NotNil(got.TLSClientConfig.RootCAs)
+			}
+
+			again, err := r.Transport(tt.caPEM)
+			require.NoError(err)
+			assert.Same(got, again)
+		})
+	}
+	assert.Equal(t, 3, r.Len())
+	r.CloseIdleConnections()
+}
+
+func TestProvider_TransportRegistry(t *testing.T) {
+	t.Parallel()
+	assert, require := assert.New(t), require.New(t)
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	r := NewTransportRegistry()
+
+	tc := testNewConfig(t, "client-id", "client-secret", "https://redirect", tp)
+	tc.TransportRegistry = r
+	p1, err := NewProvider(tc)
+	require.NoError(err)
+	defer p1.Done()
+	p2, err := NewProvider(tc)
+	require.NoError(err)
+	defer p2.Done()
+
+	c1, err := p1.HTTPClient()
+	require.NoError(err)
+	c2, err := p2.HTTPClient()
+	require.NoError(err)
+	assert.Same(c1.Transport, c2.Transport)
+	assert.Equal(1, r.Len())
+
+	// a provider without the registry has its own transport
+	p3 := testNewProvider(t, "client-id", "client-secret", "https://redirect", tp)
+	c3, err := p3.HTTPClient()
+	require.NoError(err)
+	assert.NotSame(c1.Transport, c3.Transport)
+
+	// done with one provider doesn't stop the other from using the transport
+	p1.Done()
+	_, err = p2.HealthCheck(ctx)
+	require.NoError(err)
+
+	// updating the config to remove the registry replaces the client
+	updated := p2.Config()
+	updated.TransportRegistry = nil
+	require.NoError(p2.UpdateConfig(updated))
+	c2, err = p2.HTTPClient()
+	require.NoError(err)
+	assert.NotSame(c1.Transport, c2.Transport)
+}
@@ -0,0 +1,311 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// signedUserInfoContentType is the media type of a signed userinfo response.
+const signedUserInfoContentType = "application/jwt"
+
+// UserInfoResponse is the raw response from a provider's userinfo endpoint,
+// which allows callers to archive the exact response or handle
+// provider-specific extensions.
+type UserInfoResponse struct {
+	// Body is the response's raw JSON body.
+	Body []byte
+
+	// Header is the response's headers.
+	Header http.Header
+
+	// ContentType is the media type of the response's Content-Type header,
+	// without its parameters (like charset).
+	ContentType string
+
+	// JWT is the response's signed JWT, when the provider signed the
+	// response (its ContentType is application/jwt).  The Body is the JWT's
+	// verified claims.
+	JWT string
+}
+
+// RawUserInfo gets the raw UserInfo response from the provider using the
+// token produced by the tokenSource.  The response's claims are verified like
+// Provider.UserInfo(...) before the response is returned.  The WithAudiences
+// option is supported to specify optional audiences to verify when the aud
+// claim is present in the response.
+//
+// A signed response (application/jwt) is verified using the provider's keys,
+// and its signing algorithm must be one of the config's UserInfoSigningAlgs
+// (or SupportedSigningAlgs).  When its aud claim is present, it must contain
+// the config's client_id.
+//
+// An error wrapping a SubjectMismatchError is returned when the response's sub
+// doesn't match the validSubject (see WithUserInfoSubject and
+// WithUserInfoMismatchClaims).  An error wrapping ErrUserInfoUnsupported is
+// returned when the provider doesn't have a userinfo endpoint (see
+// Config.UserInfoURL).
+//
+// Supported options: WithAudiences, WithUserInfoSubject,
+// WithUserInfoMismatchClaims, WithEssentialClaims
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#UserInfoResponse
+func (p *Provider) RawUserInfo(ctx context.Context, tokenSource oauth2.TokenSource, validSubject string, opt ...Option) (_ *UserInfoResponse, e error) {
+	const op = "Provider.RawUserInfo"
+	config := p.currentConfig()
+	ctx, cancel := p.operationContext(ctx)
+	defer cancel()
+	start := time.Now()
+	ctx, span := p.startSpan(ctx, "oidc.UserInfo", config)
+	defer func() {
+		span.End(e)
+		p.recordOperation(config, MetricsOpUserInfo, start, e)
+	}()
+	opts := getUserInfoOpts(opt...)
+
+	if tokenSource == nil {
+		return nil, fmt.Errorf("%s: token source is nil: %w", op, ErrNilParameter)
+	}
+	provider, keySet, err := p.discovered(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to discover provider: %w", op, err)
+	}
+	userInfoURL, err := userInfoEndpointURL(config, provider)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	c, err := p.HTTPClient()
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to create http client: %w", op, err)
+	}
+	// the response's headers are captured by the client's transport, since
+	// the userinfo returned by the provider only includes its body.
+	client := p.endpointClient(c, userInfoEndpoint)
+	capture := &headerCaptureTransport{base: client.Transport}
+	client.Transport = capture
+
+	raw, err := userInfoRequest(ctx, client, userInfoURL, tokenSource)
+	if err != nil {
+		return nil, fmt.Errorf("%s: provider UserInfo request failed: %w", op, newOAuthError(err, convertError(err)))
+	}
+	var body json.RawMessage
+	signed := capture.signedBody()
+	switch signed {
+	case "":
+		if !json.Valid(raw) {
+			return nil, fmt.Errorf("%s: failed to get UserInfo response: invalid JSON", op)
+		}
+		body = raw
+	default:
+		if body, err = verifySignedUserInfo(ctx, config, keySet, signed); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	if err := p.claimLimits.check("userinfo", body); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	type verifyClaims struct {
+		Sub string
+		Iss string
+		Aud jwt.Audience
+	}
+	var vc verifyClaims
+	err = json.Unmarshal(body, &vc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to parse claims for UserInfo verification: %w", op, err)
+	}
+	// optional issuer check...
+	if vc.Iss != "" && vc.Iss != config.Issuer {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidIssuer)
+	}
+	// optional audiences check...
+	if len(opts.withAudiences) > 0 {
+		if err := verifyAudience(opts.withAudiences, vc.Aud); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidAudience)
+		}
+	}
+
+	header := capture.header()
+	resp := &UserInfoResponse{
+		Body:   body,
+		Header: header,
+		JWT:    signed,
+	}
+	if ct := header.Get("Content-Type"); ct != "" {
+		if mediaType, _, err := mime.ParseMediaType(ct); err == nil {
+			resp.ContentType = mediaType
+		}
+	}
+	// Subject is required to match (see WithUserInfoSubject)
+	if err := verifyUserInfoSubject(resp, vc.Sub, validSubject, opts); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if opts.withEssentialClaims != nil {
+		var claims map[string]interface{}
+		if err := json.Unmarshal(body, &claims); err != nil {
+			return nil, fmt.Errorf("%s: failed to parse claims for UserInfo verification: %w", op, err)
+		}
+		if err := verifyEssentialClaims(opts.withEssentialClaims, claimsParamUserInfo, claims); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	return resp, nil
+}
+
+// userInfoEndpointURL returns the config's UserInfoURL, or the provider's
+// advertised userinfo_endpoint.  An error wrapping ErrUserInfoUnsupported is
+// returned when neither is set.
+func userInfoEndpointURL(config *Config, provider *oidc.Provider) (string, error) {
+	const op = "userInfoEndpointURL"
+	if config.UserInfoURL != "" {
+		return config.UserInfoURL, nil
+	}
+	var m providerMetadata
+	if err := provider.Claims(&m); err != nil {
+		return "", fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+	}
+	if m.UserInfoEndpoint == "" {
+		return "", fmt.Errorf("%s: provider doesn't advertise a userinfo_endpoint and the config doesn't have a UserInfoURL: %w", op, ErrUserInfoUnsupported)
+	}
+	return m.UserInfoEndpoint, nil
+}
+
+// userInfoRequest gets the userinfo response's body using the token produced
+// by the tokenSource.  An unsuccessful response's error is "<status>: <body>"
+// (like go-oidc's), so it can be classified by newOAuthError(...)
+func userInfoRequest(ctx context.Context, client *http.Client, userInfoURL string, tokenSource oauth2.TokenSource) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, userInfoURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	token, err := tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get access token: %w", err)
+	}
+	token.SetAuthHeader(req)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return body, nil
+}
+
+// headerCaptureTransport is an http.RoundTripper which captures the headers
+// of the last response.
+type headerCaptureTransport struct {
+	base http.RoundTripper
+
+	mu       sync.Mutex
+	captured http.Header
+	signed   string
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.  The signed body of a
+// successful application/jwt response is captured as well, and replaced by an
+// empty JSON object, since the userinfo returned by the provider only
+// supports JSON responses.
+func (t *headerCaptureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	var signed string
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == signedUserInfoContentType && resp.StatusCode == http.StatusOK {
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		signed = strings.TrimSpace(string(body))
+		resp.Body = ioutil.NopCloser(strings.NewReader("{}"))
+		resp.ContentLength = int64(len("{}"))
+	}
+	t.mu.Lock()
+	t.captured = resp.Header.Clone()
+	t.signed = signed
+	t.mu.Unlock()
+	return resp, nil
+}
+
+// CloseIdleConnections allows http.Client.CloseIdleConnections() to work
+// with the headerCaptureTransport.
+func (t *headerCaptureTransport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if tr, ok := t.base.(closeIdler); ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// signedBody returns the signed body of the last response, which is empty
+// when the response wasn't signed.
+func (t *headerCaptureTransport) signedBody() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.signed
+}
+
+// header returns the headers of the last response.
+func (t *headerCaptureTransport) header() http.Header {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.captured == nil {
+		return http.Header{}
+	}
+	return t.captured
+}
+
+// verifySignedUserInfo verifies a signed userinfo response, and returns its
+// claims.  The response's signature must be verified by the key set using one
+// of the config's userinfo signing algorithms, and when its aud claim is
+// present it must contain the config's client_id.
+func verifySignedUserInfo(ctx context.Context, config *Config, keySet oidc.KeySet, signed string) (json.RawMessage, error) {
+	const op = "verifySignedUserInfo"
+	if len(signed) > MaxTokenSize {
+		return nil, fmt.Errorf("%s: signed response is larger than %d bytes: %w", op, MaxTokenSize, ErrMalformedToken)
+	}
+	jws, err := jose.ParseSigned(signed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, err, ErrMalformedToken)
+	}
+	if len(jws.Signatures) != 1 {
+		return nil, fmt.Errorf("%s: signed response must have a single signature: %w", op, ErrMalformedToken)
+	}
+	if alg := Alg(jws.Signatures[0].Header.Algorithm); !containsAlg(config.userInfoSigningAlgs(), alg) {
+		return nil, fmt.Errorf("%s: %s is not a supported userinfo signing algorithm: %w", op, alg, ErrUnsupportedAlg)
+	}
+	payload, err := keySet.VerifySignature(ctx, signed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, err, ErrInvalidSignature)
+	}
+	var claims struct {
+		Aud jwt.Audience `json:"aud"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse claims: %s: %w", op, err, ErrMalformedToken)
+	}
+	if len(claims.Aud) > 0 && !claims.Aud.Contains(config.ClientID) {
+		return nil, fmt.Errorf("%s: aud doesn't contain the client_id: %w", op, ErrInvalidAudience)
+	}
+	return payload, nil
+}
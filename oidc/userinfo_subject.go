@@ -0,0 +1,106 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SubjectStrictness is how strictly the sub of a UserInfo response is verified
+// against the expected subject (see WithUserInfoSubject).
+type SubjectStrictness int
+
+const (
+	// SubjectStrict requires the response's sub to equal the expected
+	// subject, as required by the spec.  It's the default.
+	SubjectStrict SubjectStrictness = iota
+
+	// SubjectLinked requires the response's sub, or one of its linked subject
+	// claims (for example: Azure's oid), to equal the expected subject.
+	SubjectLinked
+
+	// SubjectUnverified doesn't verify the response's sub, which leaves
+	// reconciling the subjects to the caller.  It should only be used with a
+	// provider whose responses are known to use a different subject format.
+	SubjectUnverified
+)
+
+// SubjectMismatchError is returned when the sub of a UserInfo response doesn't
+// match the expected subject.  It wraps ErrInvalidSubject, and errors.As can
+// be used to get a SubjectMismatchError from an error.
+type SubjectMismatchError struct {
+	// ExpectedSubject is the subject the response was expected to have.
+	ExpectedSubject string
+
+	// Subject is the response's sub.
+	Subject string
+
+	// Response is the verified response (except for its sub), which is only
+	// set when the WithUserInfoMismatchClaims option is provided.  It can be
+	// used to reconcile the subjects, and must not be trusted otherwise.
+	Response *UserInfoResponse
+}
+
+// Error satisfies the error interface.
+func (e *SubjectMismatchError) Error() string {
+	return fmt.Sprintf("user info sub %q doesn't match %q: %s", e.Subject, e.ExpectedSubject, e.Unwrap())
+}
+
+// Unwrap returns ErrInvalidSubject.
+func (e *SubjectMismatchError) Unwrap() error { return ErrInvalidSubject }
+
+// verifyUserInfoSubject verifies the sub of the response's body using the
+// strictness of the opts.
+func verifyUserInfoSubject(resp *UserInfoResponse, sub, validSubject string, opts userInfoOptions) error {
+	const op = "verifyUserInfoSubject"
+	switch {
+	case sub == validSubject:
+		return nil
+	case opts.withSubjectStrictness == SubjectUnverified:
+		return nil
+	case opts.withSubjectStrictness == SubjectLinked && len(opts.withLinkedSubjectClaims) > 0:
+		var claims map[string]interface{}
+		if err := json.Unmarshal(resp.Body, &claims); err != nil {
+			return fmt.Errorf("%s: failed to parse claims for UserInfo verification: %w", op, err)
+		}
+		for _, c := range opts.withLinkedSubjectClaims {
+			if linked, ok := claims[c].(string); ok && linked != "" && linked == validSubject {
+				return nil
+			}
+		}
+	}
+	mismatch := &SubjectMismatchError{ExpectedSubject: validSubject, Subject: sub}
+	if opts.withMismatchClaims {
+		mismatch.Response = resp
+	}
+	return fmt.Errorf("%s: %w", op, mismatch)
+}
+
+// WithUserInfoSubject optionally sets how strictly the sub of a UserInfo
+// response is verified, which defaults to SubjectStrict.  The linkedClaims
+// are the names of the claims which are also accepted as the subject when the
+// strictness is SubjectLinked, since some providers return a different (but
+// linked) subject format.
+//
+// Valid for: Provider.UserInfo and Provider.RawUserInfo
+func WithUserInfoSubject(s SubjectStrictness, linkedClaims ...string) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*userInfoOptions); ok {
+			o.withSubjectStrictness = s
+			o.withLinkedSubjectClaims = linkedClaims
+		}
+	}
+}
+
+// WithUserInfoMismatchClaims optionally returns the claims of a UserInfo
+// response whose sub doesn't match, instead of discarding them, so the app can
+// reconcile the subjects.  The claims are returned using the Response of the
+// SubjectMismatchError, and Provider.UserInfo also populates its claims.
+//
+// Valid for: Provider.UserInfo and Provider.RawUserInfo
+func WithUserInfoMismatchClaims() Option {
+	return func(o interface{}) {
+		if o, ok := o.(*userInfoOptions); ok {
+			o.withMismatchClaims = true
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestProvider_RawUserInfo(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	clientSecret := "test-client-secret"
+	redirect := "https://test-redirect"
+
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	p := testNewProvider(t, clientID, clientSecret, redirect, tp)
+
+	sub := "alice@example.com"
+	reply := map[string]interface{}{
+		"sub":                     sub,
+		"iss":                     tp.Addr(),
+		"aud":                     []string{clientID},
+		"https://example.com/ext": map[string]interface{}{"tier": "gold"},
+	}
+	tp.SetUserInfoReply(reply)
+	wantBody, err := json.Marshal(reply)
+	require.NoError(t, err)
+
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{
+		AccessToken: "dummy_access_token",
+		Expiry:      time.Now().Add(10 * time.Second),
+	})
+
+	tests := []struct {
+		name        string
+		tokenSource oauth2.TokenSource
+		sub         string
+		opt         []Option
+		wantErr     bool
+		wantIsErr   error
+	}{
+		{
+			name:        "valid",
+			tokenSource: tokenSource,
+			sub:         sub,
+		},
+		{
+			name:        "valid-with-audiences",
+			tokenSource: tokenSource,
+			sub:         sub,
+			opt:         []Option{WithAudiences(clientID)},
+		},
+		{
+			name:        "invalid-subject",
+			tokenSource: tokenSource,
+			sub:         "bob@example.com",
+			wantErr:     true,
+			wantIsErr:   ErrInvalidSubject,
+		},
+		{
+			name:        "invalid-audience",
+			tokenSource: tokenSource,
+			sub:         sub,
+			opt:         []Option{WithAudiences("invalid-audience")},
+			wantErr:     true,
+			wantIsErr:   ErrInvalidAudience,
+		},
+		{
+			name:      "nil-token-source",
+			sub:       sub,
+			wantErr:   true,
+			wantIsErr: ErrNilParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			got, err := p.RawUserInfo(ctx, tt.tokenSource, tt.sub, tt.opt...)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				assert.Nil(got)
+				return
+			}
+			require.NoError(err)
+			assert.JSONEq(string(wantBody), string(got.Body))
+			assert.Equal("application/json", got.ContentType)
+			assert.Equal("application/json", got.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestProvider_UserInfo_SubjectMismatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	p := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+	tp.SetUserInfoReply(map[string]interface{}{
+		"sub":   "pairwise-sub",
+		"oid":   "alice-oid",
+		"email": "alice@example.com",
+	})
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{
+		AccessToken: "dummy_access_token",
+		Expiry:      time.Now().Add(10 * time.Second),
+	})
+
+	tests := []struct {
+		name         string
+		sub          string
+		opt          []Option
+		wantErr      bool
+		wantResponse bool
+	}{
+		{name: "strict", sub: "alice-oid", wantErr: true},
+		{name: "strict-with-claims", sub: "alice-oid", opt: []Option{WithUserInfoMismatchClaims()}, wantErr: true, wantResponse: true},
+		{name: "linked", sub: "alice-oid", opt: []Option{WithUserInfoSubject(SubjectLinked, "oid")}},
+		{name: "linked-sub", sub: "pairwise-sub", opt: []Option{WithUserInfoSubject(SubjectLinked, "oid")}},
+		{name: "linked-mismatch", sub: "bob-oid", opt: []Option{WithUserInfoSubject(SubjectLinked, "oid")}, wantErr: true},
+		{name: "linked-without-claims", sub: "alice-oid", opt: []Option{WithUserInfoSubject(SubjectLinked)}, wantErr: true},
+		{name: "unverified", sub: "bob-oid", opt: []Option{WithUserInfoSubject(SubjectUnverified)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			var claims map[string]interface{}
+			err := p.UserInfo(ctx, tokenSource, tt.sub, &claims, tt.opt...)
+			if !tt.wantErr {
+				require.NoError(err)
+				assert.Equal("alice@example.com", claims["email"])
+				return
+			}
+			require.Error(err)
+			assert.Truef(errors.Is(err, ErrInvalidSubject), "wanted \"%s\" but got \"%s\"", ErrInvalidSubject, err)
+			var mismatch *SubjectMismatchError
+			require.True(errors.As(err, &mismatch))
+			assert.Equal(tt.sub, mismatch.ExpectedSubject)
+			assert.Equal("pairwise-sub", mismatch.Subject)
+			if !tt.wantResponse {
+				assert.Nil(mismatch.Response)
+				assert.Nil(claims)
+				return
+			}
+			require.NotNil(mismatch.Response)
+			assert.Equal("application/json", mismatch.Response.ContentType)
+			assert.Equal("alice-oid", claims["oid"])
+
+			got, err := p.RawUserInfo(ctx, tokenSource, tt.sub, tt.opt...)
+			require.Error(err)
+			assert.Nil(got)
+		})
+	}
+}
+
+func TestProvider_RawUserInfo_Unsupported(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	redirect := "https://test-redirect"
+
+	tp := StartTestProvider(t)
+	tp.SetAllowedRedirectURIs([]string{redirect})
+	tp.SetUserInfoReply(map[string]interface{}{"sub": "alice@example.com"})
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{
+		AccessToken: "dummy_access_token",
+		Expiry:      time.Now().Add(10 * time.Second),
+	})
+
+	// the providers are discovered while the userinfo_endpoint isn't
+	// advertised, and the endpoint is available afterwards.
+	tp.SetDisableUserInfo(true)
+	unadvertised := testNewProvider(t, clientID, "test-client-secret", redirect, tp)
+	tc := testNewConfig(t, clientID, "test-client-secret", redirect, tp)
+	tc.UserInfoURL = tp.Addr() + "/userinfo"
+	overridden, err := NewProvider(tc)
+	require.NoError(t, err)
+	t.Cleanup(overridden.Done)
+	tp.SetDisableUserInfo(false)
+
+	t.Run("unsupported", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := unadvertised.RawUserInfo(ctx, tokenSource, "alice@example.com")
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrUserInfoUnsupported), "wanted \"%s\" but got \"%s\"", ErrUserInfoUnsupported, err)
+		assert.False(errors.Is(err, ErrNotFound))
+		supported, err := unadvertised.Supports(ctx, FeatureUserInfo)
+		require.NoError(err)
+		assert.False(supported)
+	})
+	t.Run("override", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		got, err := overridden.RawUserInfo(ctx, tokenSource, "alice@example.com")
+		require.NoError(err)
+		assert.JSONEq(`{"sub":"alice@example.com"}`, string(got.Body))
+		supported, err := overridden.Supports(ctx, FeatureUserInfo)
+		require.NoError(err)
+		assert.True(supported)
+	})
+	t.Run("invalid-override", func(t *testing.T) {
+		tc := testNewConfig(t, clientID, "test-client-secret", redirect, tp)
+		tc.UserInfoURL = "/userinfo"
+		_, err := NewProvider(tc)
+		assert.Truef(t, errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+}
@@ -0,0 +1,170 @@
+package oidc
+
+import (
+	"time"
+)
+
+// VerificationCheck is the name of a check performed while verifying an
+// id_token (see VerificationResult).
+type VerificationCheck string
+
+// Checks performed by Provider.VerifyIDToken, in the order they're performed.
+// A check which doesn't apply to the id_token (for example: the auth_time
+// check when max_age wasn't requested) isn't performed.
+const (
+	// VerificationCheckDecryption decrypts an encrypted (JWE) id_token.
+	VerificationCheckDecryption VerificationCheck = "decryption"
+
+	// VerificationCheckSize checks the id_token's size and claim limits.
+	VerificationCheckSize VerificationCheck = "size"
+
+	// VerificationCheckKeySet discovers the provider's key set.
+	VerificationCheckKeySet VerificationCheck = "key_set"
+
+	// VerificationCheckSignature checks the alg, signature, iss, and (unless
+	// the config has a ClockSkew) the exp and nbf claims, which are checked
+	// together by the verifier.
+	VerificationCheckSignature VerificationCheck = "signature"
+
+	// VerificationCheckExpiry checks the exp and nbf claims allowing for the
+	// config's ClockSkew.
+	VerificationCheckExpiry VerificationCheck = "expiry"
+
+	// VerificationCheckIssuer checks the iss claim for profiles which allow
+	// an issuer the verifier can't check.
+	VerificationCheckIssuer VerificationCheck = "issuer"
+
+	// VerificationCheckNonce checks the nonce claim.
+	VerificationCheckNonce VerificationCheck = "nonce"
+
+	// VerificationCheckIssuedAt checks the iat claim.
+	VerificationCheckIssuedAt VerificationCheck = "issued_at"
+
+	// VerificationCheckAudience checks the aud claim.
+	VerificationCheckAudience VerificationCheck = "audience"
+
+	// VerificationCheckAuthorizedParty checks the azp claim.
+	VerificationCheckAuthorizedParty VerificationCheck = "authorized_party"
+
+	// VerificationCheckAuthTime checks the auth_time claim when max_age was
+	// requested.
+	VerificationCheckAuthTime VerificationCheck = "auth_time"
+
+	// VerificationCheckACR checks the acr claim (see WithACRVerification and
+	// WithACRPolicy).
+	VerificationCheckACR VerificationCheck = "acr"
+
+	// VerificationCheckEssentialClaims checks the essential claims (see
+	// WithEssentialClaims).
+	VerificationCheckEssentialClaims VerificationCheck = "essential_claims"
+)
+
+// VerificationCheckResult is the outcome of a single check.
+type VerificationCheckResult struct {
+	// Check is the check performed.
+	Check VerificationCheck
+
+	// Passed is true when the check passed.
+	Passed bool
+
+	// Reason is a machine-readable reason (see MetricsErrorType) for a failed
+	// check, which is empty when the check passed.
+	Reason string
+
+	// Err is the error of a failed check.
+	Err error
+
+	// Duration is how long the check took.
+	Duration time.Duration
+}
+
+// VerificationResult explains an id_token verification, which can be used to
+// explain a failed login to end users or operators beyond a single wrapped
+// error (see WithVerificationResult).
+type VerificationResult struct {
+	// Checks are the checks performed, in order.  Verification stops at the
+	// first failed check, so it's always the last one.
+	Checks []VerificationCheckResult
+
+	// Duration is how long the verification took.
+	Duration time.Duration
+
+	start time.Time
+	last  time.Time
+}
+
+// Passed returns true when every check performed passed.
+func (r *VerificationResult) Passed() bool {
+	return r.Failed() == nil
+}
+
+// Failed returns the failed check, or nil when no checks failed.
+func (r *VerificationResult) Failed() *VerificationCheckResult {
+	if r == nil {
+		return nil
+	}
+	for i := range r.Checks {
+		if !r.Checks[i].Passed {
+			return &r.Checks[i]
+		}
+	}
+	return nil
+}
+
+// Reason returns the machine-readable reason of the failed check, or an empty
+// string when no checks failed.
+func (r *VerificationResult) Reason() string {
+	if f := r.Failed(); f != nil {
+		return f.Reason
+	}
+	return ""
+}
+
+// begin resets the result for a new verification.
+func (r *VerificationResult) begin() {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	*r = VerificationResult{start: now, last: now}
+}
+
+// record adds the outcome of the check, which took the time since the previous
+// check was recorded, and returns the check's err.  It's a no-op for a nil
+// result, so callers don't have to check if a result was requested.
+func (r *VerificationResult) record(check VerificationCheck, err error) error {
+	if r == nil {
+		return err
+	}
+	now := time.Now()
+	if r.start.IsZero() {
+		r.start, r.last = now, now
+	}
+	c := VerificationCheckResult{
+		Check:    check,
+		Passed:   err == nil,
+		Duration: now.Sub(r.last),
+	}
+	if err != nil {
+		c.Reason = MetricsErrorType(err)
+		c.Err = err
+	}
+	r.Checks = append(r.Checks, c)
+	r.last = now
+	r.Duration = now.Sub(r.start)
+	return err
+}
+
+// WithVerificationResult optionally provides a VerificationResult which is
+// populated with the checks performed (which passed or failed, and their
+// timing) while verifying an id_token.  The result is populated whether or not
+// the verification succeeds.
+//
+// Valid for: Provider.VerifyIDToken
+func WithVerificationResult(r *VerificationResult) Option {
+	return func(o interface{}) {
+		if o, ok := o.(*verifyIDTokenOptions); ok {
+			o.withVerificationResult = r
+		}
+	}
+}
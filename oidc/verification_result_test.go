@@ -0,0 +1,150 @@
+package oidc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_VerifyIDToken_verificationResult(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+	priv, _, alg, _ := tp.SigningKeys()
+	redirect := "https://example.com/callback"
+	p := testNewProvider(t, "client-id", "client-secret", redirect, tp)
+
+	now := time.Now()
+	tests := []struct {
+		name       string
+		claims     map[string]interface{}
+		reqOpts    []Option
+		verifyOpts func(Request) []Option
+		wantChecks []VerificationCheck
+		wantReason string
+	}{
+		{
+			name: "valid",
+			wantChecks: []VerificationCheck{
+				VerificationCheckSize,
+				VerificationCheckKeySet,
+				VerificationCheckSignature,
+				VerificationCheckNonce,
+				VerificationCheckIssuedAt,
+				VerificationCheckAudience,
+				VerificationCheckAuthorizedParty,
+			},
+		},
+		{
+			name:    "valid-max-age-and-essential-claims",
+			claims:  map[string]interface{}{"auth_time": now.Unix()},
+			reqOpts: []Option{WithMaxAge(60), WithClaims([]byte(`{"id_token":{"sub":{"essential":true}}}`))},
+			verifyOpts: func(r Request) []Option {
+				return []Option{WithEssentialClaims(r)}
+			},
+			wantChecks: []VerificationCheck{
+				VerificationCheckSize,
+				VerificationCheckKeySet,
+				VerificationCheckSignature,
+				VerificationCheckNonce,
+				VerificationCheckIssuedAt,
+				VerificationCheckAudience,
+				VerificationCheckAuthorizedParty,
+				VerificationCheckAuthTime,
+				VerificationCheckEssentialClaims,
+			},
+		},
+		{
+			name:   "expired",
+			claims: map[string]interface{}{"exp": now.Add(-time.Hour).Unix()},
+			wantChecks: []VerificationCheck{
+				VerificationCheckSize,
+				VerificationCheckKeySet,
+				VerificationCheckSignature,
+			},
+			wantReason: "expired_token",
+		},
+		{
+			name:   "invalid-audience",
+			claims: map[string]interface{}{"aud": "another-client-id"},
+			wantChecks: []VerificationCheck{
+				VerificationCheckSize,
+				VerificationCheckKeySet,
+				VerificationCheckSignature,
+				VerificationCheckNonce,
+				VerificationCheckIssuedAt,
+				VerificationCheckAudience,
+				VerificationCheckAuthorizedParty,
+			},
+			wantReason: "invalid_authorized_party",
+		},
+		{
+			name:   "invalid-nonce",
+			claims: map[string]interface{}{"nonce": "invalid"},
+			wantChecks: []VerificationCheck{
+				VerificationCheckSize,
+				VerificationCheckKeySet,
+				VerificationCheckSignature,
+				VerificationCheckNonce,
+			},
+			wantReason: "invalid_nonce",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			oidcRequest, err := NewRequest(time.Minute, redirect, tt.reqOpts...)
+			require.NoError(err)
+			claims := map[string]interface{}{
+				"iss":   tp.Addr(),
+				"aud":   "client-id",
+				"sub":   "alice@example.com",
+				"nonce": oidcRequest.Nonce(),
+				"iat":   now.Unix(),
+				"exp":   now.Add(time.Minute).Unix(),
+			}
+			for k, v := range tt.claims {
+				claims[k] = v
+			}
+			idToken := IDToken(TestSignJWT(t, priv, alg, claims, nil))
+
+			var result VerificationResult
+			opts := []Option{WithVerificationResult(&result)}
+			if tt.verifyOpts != nil {
+				opts = append(opts, tt.verifyOpts(oidcRequest)...)
+			}
+			_, err = p.VerifyIDToken(ctx, idToken, oidcRequest, opts...)
+
+			var got []VerificationCheck
+			for _, c := range result.Checks {
+				got = append(got, c.Check)
+			}
+			assert.Equal(tt.wantChecks, got)
+			assert.Equal(tt.wantReason, result.Reason())
+			assert.NotZero(result.Duration)
+			if tt.wantReason == "" {
+				require.NoError(err)
+				assert.True(result.Passed())
+				assert.Nil(result.Failed())
+				return
+			}
+			require.Error(err)
+			assert.False(result.Passed())
+			failed := result.Failed()
+			require.NotNil(failed)
+			assert.Equal(tt.wantChecks[len(tt.wantChecks)-1], failed.Check)
+			assert.ErrorIs(err, failed.Err)
+		})
+	}
+}
+
+func TestVerificationResult_nil(t *testing.T) {
+	t.Parallel()
+	var r *VerificationResult
+	assert.True(t, r.Passed())
+	assert.Empty(t, r.Reason())
+	assert.ErrorIs(t, r.record(VerificationCheckNonce, ErrInvalidNonce), ErrInvalidNonce)
+}
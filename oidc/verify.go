@@ -0,0 +1,149 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coreos/go-oidc"
+)
+
+// IDTokenExpectations are the expected values for an id_token verified by
+// VerifyIDToken.
+type IDTokenExpectations struct {
+	// Issuer is the required issuer (iss) of the id_token.
+	Issuer string
+
+	// ClientID is the required client_id of the relying party the id_token was
+	// issued to, which is used to verify the aud and azp claims.
+	ClientID string
+
+	// SupportedSigningAlgs is the required list of algorithms the id_token may
+	// be signed with.
+	SupportedSigningAlgs []Alg
+
+	// Audiences is an optional list of audiences, and when provided the
+	// id_token's aud claim must contain one of them.
+	Audiences []string
+
+	// Nonce is an optional nonce, and when provided the id_token's nonce claim
+	// must be equal to it.
+	Nonce string
+
+	// Profile is an optional compatibility profile for the issuer's IdP (see
+	// WithProfile).
+	Profile Profile
+
+	// NowFunc is an optional time func that returns the current time.
+	NowFunc func() time.Time
+}
+
+// VerifyIDToken verifies an id_token without a Provider, which allows
+// resource servers that only consume id_tokens to verify them without the
+// configuration only needed by a relying party (a client secret, redirect
+// URLs, etc).  The keySet is used to verify the id_token's signature, and
+// IssuerKeySet(...) returns a key set for an issuer's published keys.
+//
+// The id_token is verified like Provider.VerifyIDToken(...), except the nonce
+// is only verified when the expected Nonce is provided and max_age isn't
+// verified.  On success, the id_token's claims are returned.
+func VerifyIDToken(ctx context.Context, keySet oidc.KeySet, t IDToken, expected IDTokenExpectations) (map[string]interface{}, error) {
+	const op = "VerifyIDToken"
+	if keySet == nil {
+		return nil, fmt.Errorf("%s: key set is nil: %w", op, ErrNilParameter)
+	}
+	if t == "" {
+		return nil, fmt.Errorf("%s: id_token is empty: %w", op, ErrInvalidParameter)
+	}
+	if len(t) > MaxTokenSize {
+		return nil, fmt.Errorf("%s: id_token is larger than %d bytes: %w", op, MaxTokenSize, ErrMalformedToken)
+	}
+	config := &Config{
+		Issuer:               expected.Issuer,
+		ClientID:             expected.ClientID,
+		SupportedSigningAlgs: expected.SupportedSigningAlgs,
+		Audiences:            expected.Audiences,
+		Profile:              expected.Profile,
+		NowFunc:              expected.NowFunc,
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: invalid expectations: %w", op, err)
+	}
+	var oidcRequest Request
+	if expected.Nonce != "" {
+		oidcRequest = &Req{nonce: expected.Nonce}
+	}
+	claims, err := verifyIDTokenClaims(ctx, config, newIDTokenVerifier(config, keySet), t, oidcRequest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return claims, nil
+}
+
+// IssuerKeySet returns a key set for the issuer's published keys, which can
+// be used with VerifyIDToken(...).  The issuer's jwks_uri is discovered using
+// its discovery document, and its keys are cached by a JWKSCache (the
+// DefaultJWKSCache(), unless the WithJWKSCache option is provided).  The key
+// set should be reused, since every call discovers the issuer's jwks_uri.
+//
+// Supported options: WithProviderCA, WithJWKSCache, WithJWKSPins
+func IssuerKeySet(ctx context.Context, issuer string, opt ...Option) (oidc.KeySet, error) {
+	const op = "IssuerKeySet"
+	if issuer == "" {
+		return nil, fmt.Errorf("%s: issuer is empty: %w", op, ErrInvalidParameter)
+	}
+	opts := getKeySetOpts(opt...)
+	if opts.withJWKSPins != nil {
+		if err := opts.withJWKSPins.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	tr, err := newPooledTransport(opts.withProviderCA)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	client := &http.Client{Transport: tr}
+	discoveryCtx := oidc.ClientContext(ctx, limitedClient(client, discoveryEndpoint, DefaultMaxResponseSize))
+	provider, err := oidc.NewProvider(discoveryCtx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to discover issuer: %w", op, convertError(err))
+	}
+	var discovery struct {
+		JWKSURL string `json:"jwks_uri"`
+	}
+	if err := provider.Claims(&discovery); err != nil {
+		return nil, fmt.Errorf("%s: unable to read discovery document: %w", op, err)
+	}
+	if discovery.JWKSURL == "" {
+		return nil, fmt.Errorf("%s: discovery document is missing the jwks_uri: %w", op, ErrInvalidJWKs)
+	}
+	cache := opts.withJWKSCache
+	if cache == nil {
+		cache = DefaultJWKSCache()
+	}
+	ks := cache.keySet(context.Background(), discovery.JWKSURL, limitedClient(client, jwksEndpoint, DefaultMaxResponseSize))
+	ks.pins = opts.withJWKSPins.copy()
+	return ks, nil
+}
+
+// keySetOptions is the set of available options for IssuerKeySet
+type keySetOptions struct {
+	withProviderCA string
+	withJWKSCache  *JWKSCache
+	withJWKSPins   *JWKSPins
+}
+
+// keySetDefaults is a handy way to get the defaults at runtime and during
+// unit tests.
+func keySetDefaults() keySetOptions {
+	return keySetOptions{}
+}
+
+// getKeySetOpts gets the IssuerKeySet defaults and applies the opt overrides
+// passed in
+func getKeySetOpts(opt ...Option) keySetOptions {
+	opts := keySetDefaults()
+	ApplyOpts(&opts, opt...)
+	return opts
+}
@@ -0,0 +1,175 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyIDToken(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	clientID := "test-client-id"
+	tp := StartTestProvider(t)
+	tp.SetClientCreds(clientID, "test-client-secret")
+	_, _, alg, _ := tp.SigningKeys()
+
+	cache, err := NewJWKSCache()
+	require.NoError(t, err)
+	keySet, err := IssuerKeySet(ctx, tp.Addr(), WithProviderCA(tp.CACert()), WithJWKSCache(cache))
+	require.NoError(t, err)
+
+	nonce, err := NewID()
+	require.NoError(t, err)
+	tp.SetExpectedAuthNonce(nonce)
+	idToken := IDToken(tp.issueSignedJWT())
+
+	valid := IDTokenExpectations{
+		Issuer:               tp.Addr(),
+		ClientID:             clientID,
+		SupportedSigningAlgs: []Alg{alg},
+	}
+	with := func(f func(e *IDTokenExpectations)) IDTokenExpectations {
+		e := valid
+		f(&e)
+		return e
+	}
+
+	tests := []struct {
+		name      string
+		keySet    bool
+		token     IDToken
+		expected  IDTokenExpectations
+		wantErr   bool
+		wantIsErr error
+	}{
+		{
+			name:     "valid",
+			keySet:   true,
+			token:    idToken,
+			expected: valid,
+		},
+		{
+			name:     "valid-with-nonce",
+			keySet:   true,
+			token:    idToken,
+			expected: with(func(e *IDTokenExpectations) { e.Nonce = nonce }),
+		},
+		{
+			name:      "invalid-nonce",
+			keySet:    true,
+			token:     idToken,
+			expected:  with(func(e *IDTokenExpectations) { e.Nonce = "invalid-nonce" }),
+			wantErr:   true,
+			wantIsErr: ErrInvalidNonce,
+		},
+		{
+			name:      "invalid-audience",
+			keySet:    true,
+			token:     idToken,
+			expected:  with(func(e *IDTokenExpectations) { e.Audiences = []string{"invalid-audience"} }),
+			wantErr:   true,
+			wantIsErr: ErrInvalidAudience,
+		},
+		{
+			name:      "different-client-id",
+			keySet:    true,
+			token:     idToken,
+			expected:  with(func(e *IDTokenExpectations) { e.ClientID = "different-client-id" }),
+			wantErr:   true,
+			wantIsErr: ErrInvalidAuthorizedParty,
+		},
+		{
+			name:      "different-issuer",
+			keySet:    true,
+			token:     idToken,
+			expected:  with(func(e *IDTokenExpectations) { e.Issuer = "https://different.example.com" }),
+			wantErr:   true,
+			wantIsErr: ErrInvalidIssuer,
+		},
+		{
+			name:      "unsupported-alg",
+			keySet:    true,
+			token:     idToken,
+			expected:  with(func(e *IDTokenExpectations) { e.SupportedSigningAlgs = []Alg{EdDSA} }),
+			wantErr:   true,
+			wantIsErr: ErrUnsupportedAlg,
+		},
+		{
+			name:      "missing-client-id",
+			keySet:    true,
+			token:     idToken,
+			expected:  with(func(e *IDTokenExpectations) { e.ClientID = "" }),
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "empty-token",
+			keySet:    true,
+			expected:  valid,
+			wantErr:   true,
+			wantIsErr: ErrInvalidParameter,
+		},
+		{
+			name:      "nil-key-set",
+			token:     idToken,
+			expected:  valid,
+			wantErr:   true,
+			wantIsErr: ErrNilParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			ks := keySet
+			if !tt.keySet {
+				ks = nil
+			}
+			claims, err := VerifyIDToken(ctx, ks, tt.token, tt.expected)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tp.Addr(), claims["iss"])
+		})
+	}
+}
+
+func TestIssuerKeySet(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	tp := StartTestProvider(t)
+
+	t.Run("empty-issuer", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := IssuerKeySet(ctx, "")
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	})
+	t.Run("invalid-ca", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		_, err := IssuerKeySet(ctx, tp.Addr(), WithProviderCA("invalid"))
+		require.Error(err)
+		assert.Truef(errors.Is(err, ErrInvalidCACert), "wanted \"%s\" but got \"%s\"", ErrInvalidCACert, err)
+	})
+	t.Run("untrusted-ca", func(t *testing.T) {
+		require := require.New(t)
+		_, err := IssuerKeySet(ctx, tp.Addr())
+		require.Error(err)
+	})
+	t.Run("options", func(t *testing.T) {
+		assert, require := assert.New(t), require.New(t)
+		cache, err := NewJWKSCache()
+		require.NoError(err)
+		opts := getKeySetOpts(WithProviderCA("ca"), WithJWKSCache(cache))
+		testOpts := keySetDefaults()
+		testOpts.withProviderCA = "ca"
+		testOpts.withJWKSCache = cache
+		assert.Equal(opts, testOpts)
+	})
+}
@@ -0,0 +1,142 @@
+package oidc
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Wrapper encrypts and decrypts persisted auth artifacts (like cached tokens),
+// so they're always encrypted at rest.  Its shape mirrors the wrappers of
+// github.com/hashicorp/go-kms-wrapping, so a KMS, HSM or Vault transit backed
+// wrapper can be used via a small adapter.  Implementations must be
+// concurrently safe, and must be able to decrypt blobs encrypted with any of
+// their (unremoved) previous keys, which allows keys to be rotated.
+type Wrapper interface {
+	// Encrypt the plaintext using the wrapper's current key.  The aad
+	// (additional authenticated data) is optional and must be provided to
+	// Decrypt the returned blob.
+	Encrypt(ctx context.Context, plaintext, aad []byte) (*EncryptedBlob, error)
+
+	// Decrypt the blob using the key identified by its KeyID.
+	Decrypt(ctx context.Context, blob *EncryptedBlob, aad []byte) ([]byte, error)
+}
+
+// EncryptedBlob is the encrypted form of an auth artifact, along with the ID
+// of the key that encrypted it.
+type EncryptedBlob struct {
+	KeyID      string `json:"key_id"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// AESGCMWrapper is a Wrapper which uses AES-GCM with in-memory keys.  Keys are
+// rotated with Rotate(...), and blobs encrypted with previous keys can be
+// decrypted until those keys are removed.  It is concurrently safe.
+type AESGCMWrapper struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// ensure that AESGCMWrapper implements the Wrapper interface.
+var _ Wrapper = (*AESGCMWrapper)(nil)
+
+// NewAESGCMWrapper creates a new AESGCMWrapper whose current key is the AES
+// key (16, 24 or 32 bytes) identified by keyID.
+func NewAESGCMWrapper(keyID string, key []byte) (*AESGCMWrapper, error) {
+	const op = "NewAESGCMWrapper"
+	w := &AESGCMWrapper{keys: map[string]cipher.AEAD{}}
+	if err := w.Rotate(keyID, key); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return w, nil
+}
+
+// KeyID returns the ID of the wrapper's current key.
+func (w *AESGCMWrapper) KeyID() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// Rotate makes the AES key (16, 24 or 32 bytes) identified by keyID the
+// wrapper's current key.  The previous keys can still be used to decrypt.
+func (w *AESGCMWrapper) Rotate(keyID string, key []byte) error {
+	const op = "AESGCMWrapper.Rotate"
+	if keyID == "" {
+		return fmt.Errorf("%s: key ID is empty: %w", op, ErrInvalidParameter)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("%s: invalid key: %s: %w", op, err, ErrInvalidParameter)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("%s: unable to create cipher: %s: %w", op, err, ErrInvalidParameter)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.keys[keyID]; ok {
+		return fmt.Errorf("%s: key ID %s already exists: %w", op, keyID, ErrInvalidParameter)
+	}
+	w.keys[keyID] = aead
+	w.current = keyID
+	return nil
+}
+
+// RemoveKey removes a previous key, after which blobs encrypted with it can't
+// be decrypted.  The current key can't be removed.
+func (w *AESGCMWrapper) RemoveKey(keyID string) error {
+	const op = "AESGCMWrapper.RemoveKey"
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if keyID == w.current {
+		return fmt.Errorf("%s: the current key can't be removed: %w", op, ErrInvalidParameter)
+	}
+	delete(w.keys, keyID)
+	return nil
+}
+
+// Encrypt implements the Wrapper.Encrypt() interface function.  The nonce is
+// prepended to the blob's ciphertext.
+func (w *AESGCMWrapper) Encrypt(_ context.Context, plaintext, aad []byte) (*EncryptedBlob, error) {
+	const op = "AESGCMWrapper.Encrypt"
+	w.mu.RLock()
+	keyID, aead := w.current, w.keys[w.current]
+	w.mu.RUnlock()
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("%s: unable to generate nonce: %w", op, err)
+	}
+	return &EncryptedBlob{
+		KeyID:      keyID,
+		Ciphertext: aead.Seal(nonce, nonce, plaintext, aad),
+	}, nil
+}
+
+// Decrypt implements the Wrapper.Decrypt() interface function.
+func (w *AESGCMWrapper) Decrypt(_ context.Context, blob *EncryptedBlob, aad []byte) ([]byte, error) {
+	const op = "AESGCMWrapper.Decrypt"
+	if blob == nil {
+		return nil, fmt.Errorf("%s: blob is nil: %w", op, ErrNilParameter)
+	}
+	w.mu.RLock()
+	aead, ok := w.keys[blob.KeyID]
+	w.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%s: key ID %s: %w", op, blob.KeyID, ErrNotFound)
+	}
+	if len(blob.Ciphertext) < aead.NonceSize() {
+		return nil, fmt.Errorf("%s: ciphertext is too short: %w", op, ErrDecryptionFailed)
+	}
+	nonce, ciphertext := blob.Ciphertext[:aead.NonceSize()], blob.Ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", op, err, ErrDecryptionFailed)
+	}
+	return plaintext, nil
+}
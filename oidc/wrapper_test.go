@@ -0,0 +1,84 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAESGCMWrapper(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		keyID     string
+		key       []byte
+		wantErr   bool
+		wantIsErr error
+	}{
+		{name: "valid-aes-128", keyID: "key-1", key: make([]byte, 16)},
+		{name: "valid-aes-256", keyID: "key-1", key: make([]byte, 32)},
+		{name: "empty-key-id", key: make([]byte, 32), wantErr: true, wantIsErr: ErrInvalidParameter},
+		{name: "invalid-key-size", keyID: "key-1", key: make([]byte, 10), wantErr: true, wantIsErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert, require := assert.New(t), require.New(t)
+			w, err := NewAESGCMWrapper(tt.keyID, tt.key)
+			if tt.wantErr {
+				require.Error(err)
+				assert.Truef(errors.Is(err, tt.wantIsErr), "wanted \"%s\" but got \"%s\"", tt.wantIsErr, err)
+				return
+			}
+			require.NoError(err)
+			assert.Equal(tt.keyID, w.KeyID())
+		})
+	}
+}
+
+func TestAESGCMWrapper(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	assert, require := assert.New(t), require.New(t)
+	w, err := NewAESGCMWrapper("key-1", []byte("0123456789abcdef"))
+	require.NoError(err)
+	aad := []byte("aad")
+
+	blob, err := w.Encrypt(ctx, []byte("secret"), aad)
+	require.NoError(err)
+	assert.Equal("key-1", blob.KeyID)
+	assert.NotContains(string(blob.Ciphertext), "secret")
+	another, err := w.Encrypt(ctx, []byte("secret"), aad)
+	require.NoError(err)
+	assert.NotEqual(blob.Ciphertext, another.Ciphertext)
+
+	got, err := w.Decrypt(ctx, blob, aad)
+	require.NoError(err)
+	assert.Equal("secret", string(got))
+
+	_, err = w.Decrypt(ctx, blob, []byte("other"))
+	assert.Truef(errors.Is(err, ErrDecryptionFailed), "wanted \"%s\" but got \"%s\"", ErrDecryptionFailed, err)
+	_, err = w.Decrypt(ctx, &EncryptedBlob{KeyID: "key-1", Ciphertext: []byte("short")}, aad)
+	assert.Truef(errors.Is(err, ErrDecryptionFailed), "wanted \"%s\" but got \"%s\"", ErrDecryptionFailed, err)
+	_, err = w.Decrypt(ctx, nil, aad)
+	assert.Truef(errors.Is(err, ErrNilParameter), "wanted \"%s\" but got \"%s\"", ErrNilParameter, err)
+
+	// rotated keys encrypt new blobs, and previous keys still decrypt
+	require.NoError(w.Rotate("key-2", []byte("fedcba9876543210")))
+	assert.Equal("key-2", w.KeyID())
+	rotated, err := w.Encrypt(ctx, []byte("secret"), aad)
+	require.NoError(err)
+	assert.Equal("key-2", rotated.KeyID)
+	_, err = w.Decrypt(ctx, blob, aad)
+	require.NoError(err)
+
+	err = w.Rotate("key-1", []byte("0123456789abcdef"))
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	err = w.RemoveKey("key-2")
+	assert.Truef(errors.Is(err, ErrInvalidParameter), "wanted \"%s\" but got \"%s\"", ErrInvalidParameter, err)
+	require.NoError(w.RemoveKey("key-1"))
+	_, err = w.Decrypt(ctx, blob, aad)
+	assert.Truef(errors.Is(err, ErrNotFound), "wanted \"%s\" but got \"%s\"", ErrNotFound, err)
+}